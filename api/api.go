@@ -0,0 +1,325 @@
+// Package api is the public Go API of CAMUS. It wraps the inference, scoring,
+// preprocessing, and network construction used by the camus command with
+// types of its own, so that code using it doesn't break when the internal
+// packages change.
+//
+// CAMUS logs its progress with the standard library log package; use
+// log.SetOutput(io.Discard) to silence it. Trees passed to these functions may
+// be modified (e.g., node ids are renumbered), so clone them first if they are
+// needed afterwards.
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	in "github.com/jsdoublel/camus/internal/infer"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+// Errors returned by this package wrap one of these (check with errors.Is)
+var (
+	ErrInvalidOption   = in.ErrInvalidOption   // options are not valid
+	ErrInvalidBranch   = in.ErrInvalidBranch   // reticulation branch can't be added to the constraint tree
+	ErrInvalidFile     = pr.ErrInvalidFile     // input file is not valid
+	ErrInvalidFormat   = pr.ErrInvalidFormat   // input could not be parsed
+	ErrNoReticulations = pr.ErrNoReticulations // network has no reticulations
+	ErrUnrooted        = pr.ErrUnrooted        // tree is not rooted
+	ErrNonBinary       = pr.ErrNonBinary       // tree is not binary
+	ErrMulTree         = pr.ErrMulTree         // tree has duplicate labels
+	ErrTipNameMismatch = gr.ErrTipNameMismatch // gene tree taxa are not in the constraint tree
+)
+
+// Options for Infer (see DefaultOptions)
+type Options struct {
+	ScoreMode          string    // edge score mode: "max", "norm", "sym", or "cf"
+	Alpha              float64   // penalty parameter of the "sym" score mode
+	PenaltyScale       string    // how the "sym" penalty grows with cycle length: "flat", "linear", or "log" ("flat" if empty)
+	QuartetFilter      int       // quartet filter mode: 0 (off), 1 (non-restrictive), or 2 (restrictive)
+	Threshold          float64   // quartet filter threshold [0, 1]
+	MinSupport         float64   // gene tree edges with support below this are collapsed
+	CountMode          string    // how quartet topologies are counted: "raw", "set", "length", or "capped:N"
+	ConstraintQuartets string    // how quartets in the constraint tree are counted: "drop", "keep", or "weight:X"
+	Polytomies         string    // how polytomies in the constraint tree are resolved: "none", "arbitrary", or "quartet"
+	MaxReticulations   int       // stop after this many reticulations (no limit if 0)
+	MaxKPerVertex      int       // maximum number of reticulations below any vertex but the root (no limit if 0)
+	Procs              int       // number of parallel processes (all available if 0)
+	Seed               uint64    // seed for randomized components
+	Weights            []float64 // weight of each gene tree (nil if unweighted)
+}
+
+// Options used by the camus command when no flags are given
+func DefaultOptions() Options {
+	return Options{
+		ScoreMode:          "max",
+		Alpha:              0.1,
+		PenaltyScale:       "flat",
+		QuartetFilter:      2,
+		Threshold:          0.5,
+		CountMode:          "raw",
+		ConstraintQuartets: "drop",
+		Polytomies:         "none",
+	}
+}
+
+// Gene trees and their names (line numbers for newick files, names from the
+// trees block for nexus files)
+type GeneTrees struct {
+	Trees []*tree.Tree
+	Names []string
+}
+
+// Reticulation branch given by the taxa below each end on the constraint tree
+type Branch struct {
+	Donor  []string // taxa below the end the branch leaves from
+	Hybrid []string // taxa below the end the branch enters (the hybrid clade)
+}
+
+// Reticulation of an inferred network
+type Reticulation struct {
+	Label     string  // label in the extended newick (e.g., "#H1")
+	Branch            // branch on the constraint tree
+	EdgeScore float64 // edge score of the branch
+}
+
+// Optimal network with a given number of reticulations
+type Network struct {
+	Newick           string         // network in extended newick format
+	Reticulations    []Reticulation // reticulations, sorted by label
+	QuartetSatisfied float64        // percent of quartets satisfied (0 for the constraint tree)
+	Score            float64        // dp score
+}
+
+// Results of Infer
+type Result struct {
+	ConstraintTree string    // constraint tree in newick format (after preprocessing)
+	Networks       []Network // optimal network with 0, 1, 2, ... reticulations
+}
+
+// Support for a reticulation aggregated across gene trees (see ScoreSummary)
+type Summary struct {
+	Support             float64 // supporting quartets out of all informative quartets (pooled across genes)
+	Mean                float64 // mean of per gene support over informative genes
+	Informative         int     // number of genes with at least one informative quartet
+	InformativeFraction float64 // fraction of genes that are informative
+}
+
+// Reads constraint tree (or network) and gene tree files, as the camus command
+// does. format is "newick" or "nexus", and either file may be compressed.
+func ReadInputFiles(treeFile, geneTreeFile, format string) (*tree.Tree, *GeneTrees, error) {
+	f, ok := pr.ParseFormat[format]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w, \"%s\" is not a valid gene tree format", ErrInvalidOption, format)
+	}
+	tre, geneTrees, err := pr.ReadInputFiles(treeFile, geneTreeFile, f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tre, &GeneTrees{Trees: geneTrees.Trees, Names: geneTrees.Names}, nil
+}
+
+// Parses a single newick (or extended newick) tree
+func ParseNewick(s string) (*tree.Tree, error) {
+	tre, err := newick.NewParser(strings.NewReader(s)).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrInvalidFormat, err)
+	}
+	return tre, nil
+}
+
+// Prunes the constraint tree and gene trees in place so that they only have
+// taxa, dropping gene trees left with fewer than four of them
+func RestrictTaxa(tre *tree.Tree, geneTrees *GeneTrees, taxa []string) error {
+	restricted := &pr.GeneTrees{Trees: geneTrees.Trees, Names: geneTrees.Names}
+	if err := pr.RestrictTaxa(tre, restricted, taxa); err != nil {
+		return err
+	}
+	geneTrees.Trees, geneTrees.Names = restricted.Trees, restricted.Names
+	return nil
+}
+
+// Infers the optimal level-1 network with each number of reticulations from a
+// rooted, binary constraint tree and gene trees. Returns ctx.Err() if ctx is
+// cancelled before inference finishes.
+func Infer(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, opts Options) (*Result, error) {
+	inferOpts, err := opts.inferOptions()
+	if err != nil {
+		return nil, err
+	}
+	polytomies, ok := pr.ParsePolytomyMode[opts.Polytomies]
+	if !ok {
+		return nil, fmt.Errorf("%w, \"%s\" is not a valid polytomy resolution mode", ErrInvalidOption, opts.Polytomies)
+	}
+	if tre, inferOpts.ArtificialClades, err = pr.ResolvePolytomies(tre, geneTrees, polytomies); err != nil {
+		return nil, err
+	}
+	results, err := in.Infer(ctx, tre, geneTrees, *inferOpts)
+	if err != nil {
+		return nil, err
+	}
+	reticulations := gr.StableReticulationLabels(results.Branches, gr.DefaultRetLabeling)
+	baseScore, err := strconv.ParseFloat(results.RawScores[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("dp score %s of the constraint tree is not a number, this is a bug! %w", results.RawScores[0], err)
+	}
+	result := &Result{ConstraintTree: results.Tree.Newick(), Networks: make([]Network, len(reticulations)+1)}
+	result.Networks[0] = Network{Newick: result.ConstraintTree, Reticulations: make([]Reticulation, 0), Score: baseScore}
+	for i, labeled := range reticulations {
+		ntw := &result.Networks[i+1]
+		*ntw = Network{
+			Newick:           gr.MakeLabeledNetwork(results.Tree, labeled).Newick(),
+			Reticulations:    make([]Reticulation, 0, len(labeled)),
+			QuartetSatisfied: results.QSatScore[i],
+			Score:            results.Scores[i],
+		}
+		for _, label := range pr.SortedRetLabels(labeled) {
+			br := labeled[label]
+			ntw.Reticulations = append(ntw.Reticulations, Reticulation{
+				Label:     label,
+				Branch:    branchTaxa(results.Tree, br),
+				EdgeScore: results.EdgeScores[br],
+			})
+		}
+	}
+	return result, nil
+}
+
+// Scores each reticulation of a level-1 network against each gene tree: the
+// proportion of the gene tree's informative quartets that support the
+// reticulation (NaN if none are informative). Returns one map from
+// reticulation label to score for each gene tree.
+func Score(ctx context.Context, ntw *tree.Tree, geneTrees []*tree.Tree) ([]map[string]float64, error) {
+	network, err := toNetwork(ntw)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := sc.ReticulationScore(ctx, network, geneTrees)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]float64, len(scores))
+	for i, s := range scores {
+		result[i] = *s
+	}
+	return result, nil
+}
+
+// Support for each reticulation of a level-1 network aggregated across gene
+// trees, by reticulation label
+func ScoreSummary(ctx context.Context, ntw *tree.Tree, geneTrees []*tree.Tree) (map[string]Summary, error) {
+	network, err := toNetwork(ntw)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := sc.ReticulationSummary(ctx, network, geneTrees)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]Summary, len(summaries))
+	for label, s := range summaries {
+		result[label] = Summary{Support: s.Support, Mean: s.Mean, Informative: s.Informative, InformativeFraction: s.InformativeFraction}
+	}
+	return result, nil
+}
+
+// Adds reticulation branches to a rooted, binary constraint tree, returning the
+// level-1 network in extended newick format. The branches must be ones Infer
+// could add, and must not overlap.
+func MakeNetwork(tre *tree.Tree, branches []Branch) (string, error) {
+	td, _, err := pr.Preprocess(context.Background(), tre, nil, nil, nil, 1, pr.QuartetFilterOptions{}, 0, pr.CountMode{})
+	if err != nil {
+		return "", err
+	}
+	resolved := make([]gr.Branch, len(branches))
+	for i, b := range branches {
+		if resolved[i], err = resolveBranch(td, b); err != nil {
+			return "", fmt.Errorf("branch %d: %w", i+1, err)
+		}
+		for j := range i {
+			if !gr.Compatible(resolved[i], resolved[j], td) {
+				return "", fmt.Errorf("%w, branches %d and %d overlap, so they cannot be in the same level-1 network", ErrInvalidBranch, j+1, i+1)
+			}
+		}
+	}
+	labeled := gr.StableReticulationLabels([][]gr.Branch{resolved}, gr.DefaultRetLabeling)[0]
+	return gr.MakeLabeledNetwork(td, labeled).Newick(), nil
+}
+
+// Options used by the internal packages
+func (opts Options) inferOptions() (*in.InferOptions, error) {
+	scorer, ok := sc.NewScorer(opts.ScoreMode)
+	if !ok {
+		return nil, fmt.Errorf("%w, \"%s\" is not a valid score mode", ErrInvalidOption, opts.ScoreMode)
+	}
+	qOpts, err := pr.SetQuartetFilterOptions(opts.QuartetFilter, opts.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrInvalidOption, err)
+	}
+	counting, err := pr.ParseCountMode(opts.CountMode)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrInvalidOption, err)
+	}
+	if counting.Constraint, err = pr.ParseConstraintQuartets(opts.ConstraintQuartets); err != nil {
+		return nil, fmt.Errorf("%w, %w", ErrInvalidOption, err)
+	}
+	if opts.MaxReticulations < 0 || opts.MaxKPerVertex < 0 {
+		return nil, fmt.Errorf("%w, maximum reticulations must be non-negative", ErrInvalidOption)
+	}
+	inferOpts, err := in.MakeInferOptions(opts.Procs, 0, 0, qOpts, opts.MinSupport, scorer, counting.AsSet, opts.Alpha)
+	if err != nil {
+		return nil, err
+	}
+	if opts.PenaltyScale != "" {
+		if inferOpts.PenaltyScale, ok = sc.ParsePenaltyScale[opts.PenaltyScale]; !ok {
+			return nil, fmt.Errorf("%w, \"%s\" is not a valid penalty scale", ErrInvalidOption, opts.PenaltyScale)
+		}
+	}
+	inferOpts.CountCap = counting.Cap
+	inferOpts.LengthWeights = counting.Length
+	inferOpts.ConstraintQuartets = counting.Constraint
+	inferOpts.MaxReticulations = opts.MaxReticulations
+	inferOpts.MaxKPerVertex = opts.MaxKPerVertex
+	inferOpts.Seed = opts.Seed
+	inferOpts.Weights = opts.Weights
+	return inferOpts, nil
+}
+
+// Converts extended (or rich) newick tree to a network, accepting hybrid
+// clades written under both parents and unrooted networks
+func toNetwork(ntw *tree.Tree) (*gr.Network, error) {
+	if _, err := pr.NormalizeRichNewick(ntw); err != nil {
+		return nil, err
+	}
+	if _, err := pr.NormalizeHybridCopies(ntw); err != nil {
+		return nil, err
+	}
+	return pr.ConvertToNetwork(ntw)
+}
+
+// Finds constraint tree branch with the donor and hybrid clades of b
+func resolveBranch(td *gr.TreeData, b Branch) (gr.Branch, error) {
+	u, err := td.CladeID(b.Donor)
+	if err != nil {
+		return gr.Branch{}, fmt.Errorf("%w, %w", ErrInvalidBranch, err)
+	}
+	w, err := td.CladeID(b.Hybrid)
+	if err != nil {
+		return gr.Branch{}, fmt.Errorf("%w, %w", ErrInvalidBranch, err)
+	}
+	if !sc.DefaultEdgePolicy.Allows(u, w, td) {
+		return gr.Branch{}, fmt.Errorf("%w, the hybrid clade cannot be the root or contain the donor clade, and the cycle must have more than three edges", ErrInvalidBranch)
+	}
+	return gr.Branch{IDs: [2]int{u, w}}, nil
+}
+
+// Taxa below each end of br
+func branchTaxa(td *gr.TreeData, br gr.Branch) Branch {
+	return Branch{Donor: td.LeafsetNames(td.IdToNodes[br.IDs[gr.Ui]]), Hybrid: td.LeafsetNames(td.IdToNodes[br.IDs[gr.Wi]])}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+const (
+	testConstTree = "(A,(B,(C,(D,(E,(F,(G,(H,(I,J)))))))));"
+	testNetwork   = "(A,(B,((C)#H1,((#H1,D),(E,(F,(G,(H,(I,J)))))))));"
+)
+
+var testGeneTrees = []string{"(A,(B,(C,D)));", "(B,(C,D),E);"}
+
+func parseTestTrees(t *testing.T, newicks ...string) []*tree.Tree {
+	t.Helper()
+	trees := make([]*tree.Tree, len(newicks))
+	for i, nwk := range newicks {
+		var err error
+		if trees[i], err = ParseNewick(nwk); err != nil {
+			t.Fatalf("cannot parse %s as newick tree", nwk)
+		}
+	}
+	return trees
+}
+
+func TestInfer(t *testing.T) {
+	opts := DefaultOptions()
+	opts.QuartetFilter = 0
+	result, err := Infer(context.Background(), parseTestTrees(t, testConstTree)[0], parseTestTrees(t, testGeneTrees...), opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if len(result.Networks) != 2 {
+		t.Fatalf("got %d networks, expected 2", len(result.Networks))
+	}
+	if result.Networks[0].Newick != result.ConstraintTree || len(result.Networks[0].Reticulations) != 0 {
+		t.Errorf("network with no reticulations is not the constraint tree")
+	}
+	ntw := result.Networks[1]
+	if ntw.Newick != testNetwork {
+		t.Errorf("got network %s, expected %s", ntw.Newick, testNetwork)
+	}
+	expected := []Reticulation{{Label: "#H1", Branch: Branch{Donor: []string{"D"}, Hybrid: []string{"C"}}}}
+	if len(ntw.Reticulations) != 1 || ntw.Reticulations[0].EdgeScore <= 0 {
+		t.Fatalf("unexpected reticulations %v", ntw.Reticulations)
+	}
+	ntw.Reticulations[0].EdgeScore = 0
+	if !reflect.DeepEqual(ntw.Reticulations, expected) {
+		t.Errorf("got reticulations %v, expected %v", ntw.Reticulations, expected)
+	}
+	if ntw.QuartetSatisfied <= result.Networks[0].QuartetSatisfied {
+		t.Errorf("reticulation did not satisfy more quartets")
+	}
+}
+
+func TestInfer_InvalidOptions(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(*Options)
+	}{
+		{name: "score mode", modify: func(o *Options) { o.ScoreMode = "bad" }},
+		{name: "quartet filter", modify: func(o *Options) { o.QuartetFilter = 3 }},
+		{name: "count mode", modify: func(o *Options) { o.CountMode = "capped:0" }},
+		{name: "polytomies", modify: func(o *Options) { o.Polytomies = "bad" }},
+		{name: "max reticulations", modify: func(o *Options) { o.MaxReticulations = -1 }},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			test.modify(&opts)
+			_, err := Infer(context.Background(), parseTestTrees(t, testConstTree)[0], parseTestTrees(t, testGeneTrees...), opts)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("expected %v, got %v", ErrInvalidOption, err)
+			}
+		})
+	}
+}
+
+func TestMakeNetwork(t *testing.T) {
+	testCases := []struct {
+		name        string
+		branches    []Branch
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "one branch",
+			branches: []Branch{{Donor: []string{"D"}, Hybrid: []string{"C"}}},
+			expected: testNetwork,
+		},
+		{
+			name:        "hybrid contains donor",
+			branches:    []Branch{{Donor: []string{"J"}, Hybrid: []string{"H", "I", "J"}}},
+			expectedErr: ErrInvalidBranch,
+		},
+		{
+			name:        "not a clade",
+			branches:    []Branch{{Donor: []string{"D"}, Hybrid: []string{"A", "C"}}},
+			expectedErr: ErrInvalidBranch,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ntw, err := MakeNetwork(parseTestTrees(t, testConstTree)[0], test.branches)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if ntw != test.expected {
+				t.Errorf("got network %s, expected %s", ntw, test.expected)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	ntw, geneTrees, err := ReadInputFiles("../internal/score/testdata/network.nwk", "../internal/score/testdata/gene-trees.nwk", "newick")
+	if err != nil {
+		t.Fatalf("ReadInputFiles failed with error %s", err)
+	}
+	geneTrees.Trees = geneTrees.Trees[:2]
+	scores, err := Score(context.Background(), ntw, geneTrees.Trees)
+	if err != nil {
+		t.Fatalf("Score failed with error %s", err)
+	}
+	if len(scores) != len(geneTrees.Trees) {
+		t.Fatalf("got %d rows of scores, expected %d", len(scores), len(geneTrees.Trees))
+	}
+	// from testdata/scores.csv
+	if scores[0]["#H4"] != 0 || scores[1]["#H4"] != 0.3525872442839952 || !math.IsNaN(scores[1]["#H1"]) {
+		t.Errorf("unexpected scores %v %v", scores[0], scores[1])
+	}
+	ntw, geneTrees, err = ReadInputFiles("../internal/score/testdata/network.nwk", "../internal/score/testdata/gene-trees.nwk", "newick")
+	if err != nil {
+		t.Fatalf("ReadInputFiles failed with error %s", err)
+	}
+	summaries, err := ScoreSummary(context.Background(), ntw, geneTrees.Trees[:2])
+	if err != nil {
+		t.Fatalf("ScoreSummary failed with error %s", err)
+	}
+	if s := summaries["#H4"]; s.Informative != 2 || s.Mean != 0.3525872442839952/2 || !math.IsNaN(summaries["#H1"].Support) {
+		t.Errorf("unexpected summary %+v", s)
+	}
+	if _, _, err := ReadInputFiles("../internal/score/testdata/network.nwk", "../internal/score/testdata/gene-trees.nwk", "bad"); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected %v, got %v", ErrInvalidOption, err)
+	}
+}
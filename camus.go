@@ -25,76 +25,393 @@ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
 OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 SOFTWARE.
 
-usage: camus [flags]... <const_tree_file> <gene_tree_file>
+usage:
+
+	camus [infer] [flags]... <const_tree_file> <gene_tree_file>
+	camus score [flags]... <network_file> <gene_tree_file>
+	camus score-edges [flags]... <const_tree_file> <edges_file> <gene_tree_file>
+	camus place [flags]... <network_file> <gene_tree_file>
+	camus compare [flags]... <network_file> <network_file>
+	camus convert [flags]... <network_file>
+	camus report [flags]... <run> <run>...
+	camus stats [flags]... <const_tree_file> <gene_tree_file>
+	camus root [flags]... <tree_file>
+	camus run [flags]... <config>
+	camus completion <bash|zsh|fish>
+	camus help [command|topic]
 
 positional arguments:
 
 	<tree_file>			constraint newick tree
-	<gene_tree_file>	gene tree newick file
+	<gene_tree_file>	gene tree newick file (or directory of FASTA alignments with -alignments)
 
 flags:
 
+	-adaptive-k
+	  	stop the dp at each vertex once its score reaches an upper bound from the subtrees below it, skipping values of k that cannot improve it
+	-alignment-method method
+	  	how quartet topologies are inferred with -alignments [parsimony|distance]; parsimony picks the topology with the most parsimony-informative sites, and distance uses the four-point condition on uncorrected p-distances (default "parsimony")
+	-alignments
+	  	read <gene_tree_file> as a directory of FASTA alignments (one per locus) and infer the quartets of each locus from its alignment instead of a gene tree
+	-alternatives int
+	  	number of best non-chosen branches to report for each number of edges (default 0)
+	-as-unrooted
+	  	treat gene trees as unrooted, removing the root of rooted gene trees when they are read
+	-auto-root
+	  	root an unrooted constraint tree on the edge that the root splits of the most rooted gene trees agree with, instead of stopping with a suggested root
+	-balance-partitions
+	  	draw the same number of genes from every partition in bootstrap replicates
+	-bootstrap int
+	  	number of bootstrap replicates resampling gene trees (within partitions, if given) to estimate support for each reticulation (default 0)
+	-branches file
+	  	score the reticulation branches listed in file (one per line, as U and W clades) on the constraint tree instead of running the dp
+	-cache-dir dir
+	  	cache edge score matrices in dir so reruns on the same data with a different score mode or alpha reuse them
+	-candidate-threshold percent
+	  	write the largest network with reticulations satisfying less than percent of quartets on their own left out, and recorded as candidate gene flow annotations on the backbone instead, to <prefix>_conservative.nwk, listing them in <prefix>_candidates.csv (default 0)
+	-co-optimal n
+	  	write up to n distinct networks with the largest number of edges that score exactly the same as the optimal one to <prefix>_co_optimal.nwk, one per line (default 0)
+	-collapse-identical
+	  	collapse taxa that are sisters in the constraint tree and every gene tree into one representative, expanding them in the output networks
+	-color mode
+	  	color the summary written to stderr at the end of a run [auto|always|never] (default "auto")
+	-compact-traceback
+	  	keep less of the dp traceback in memory, recomputing the cycles of the optimal networks when they are traced back (slower, for machines with little memory)
+	-compare-modes modes
+	  	comma separated score modes [max|norm|sym|cf] to also run on the same preprocessed data, writing a comparison to <prefix>_modes.csv and <prefix>_modes.png
+	-concordance
+	  	write quartet concordance (QC), differential (QD), and informativeness (QI) of each constraint tree branch to <prefix>_concordance.csv
+	-concordance-newick
+	  	also write the constraint tree with the quartet concordance of each branch in newick comments to <prefix>_concordance.nwk (implies -concordance)
+	-constraint-quartets mode
+	  	how gene tree quartets displayed by the constraint tree are counted [drop|keep|weight:X]; keep and weight:X (0 < X < 1) count them (at X times their count) in the percent of quartets satisfied and minor frequencies, although no reticulation can add them (default "drop")
+	-count-mode mode
+	  	how gene tree quartet topologies are counted [raw|set|length|capped:N]; length weights each quartet by the length of the gene tree branch inducing it, and capped:N counts each topology from at most N gene trees (default "raw")
+	-dry-run
+	  	parse inputs, print estimated memory and runtime, and exit without running
+	-embedding
+	  	write the fraction of each gene tree's quartets displayed by each tree displayed by the largest network to <prefix>_embedding.csv
+	-exclusion-support
+	  	compare the largest network to the best network of the same size without each reticulation
 	-f format
 	  	gene tree format [newick|nexus] (default "newick")
+	-fail-on-warning
+	  	exit with an error if any warning is logged, before writing output when possible
+	-gamma
+	  	estimate the inheritance probability of each reticulation edge from gene tree quartets, writing it to the output networks (e.g., #H1:::0.32)
+	-gene-contributions
+	  	write the number of quartets of each gene tree supporting each reticulation of the largest network to <prefix>_gene_contributions.csv
 	-h	prints short help and exits
+	-h-prefix prefix
+	  	prefix of reticulation labels in output networks (labels are #<prefix><n>) (default "H")
+	-h-start int
+	  	number of the first reticulation label (default 1)
 	-hh
 	  	prints help with experimental features and exits
+	-influence
+	  	rerun with each gene tree left out and write an influence ranking to <prefix>_influence.csv
+	-jackknife
+	  	leave out each block of gene trees in turn and write how much of the quartet support of each reticulation of the largest network is left to <prefix>_jackknife.csv
+	-jackknife-block n
+	  	number of consecutive gene trees in each block left out by -jackknife (default 1)
+	-k int
+	  	maximum number of reticulations to infer (default 0, no limit)
+	-log-console level
+	  	level of log messages written to stderr, overriding -verbosity [none|error|warn|info|debug|trace] (default info)
+	-log-file level
+	  	level of log messages written to the log file, overriding -verbosity [none|error|warn|info|debug|trace] (default info)
+	-log-json
+	  	write log messages as json lines with their level, stage, k, best score, and elapsed time
+	-max-filtered fraction
+	  	log a warning if the quartet filter removes more than fraction of unique quartets (default 1)
+	-max-k-per-vertex num
+	  	maximum number of edges in the subtree below any vertex but the root, bounding the work at each vertex (default 0, no limit)
+	-minor-freq
+	  	write an approximate minor quartet frequency (a quick proxy for gamma) of each reticulation to <prefix>_minor_freq.csv
+	-mul-trees mode
+	  	how gene trees with more than one copy of a taxon (e.g., from gene duplication) are handled [error|collapse|copies]; collapse keeps the first copy of each taxon, and copies counts the quartets of every choice of copies, down-weighted by the number of choices (default "error")
 	-n int
 	  	number of parallel processes
+	-n-dp int
+	  	number of parallel processes for edge scores and the dp (defaults to -n)
+	-n-prep int
+	  	number of parallel processes for quartet extraction (defaults to -n)
+	-null-reps int
+	  	number of gene tree sets to simulate under the constraint tree to calibrate score gains against ILS (default 0)
 	-o string
 	  	output prefix
+	-out-format format
+	  	format of the optimal networks written to stdout and the results file [csv|json|nexus|phyloxml]; json also has the branches, edge scores, and run metadata, nexus can be opened in Dendroscope or IcyTree, and phyloxml in Archaeopteryx (default "csv")
+	-outdir string
+	  	output directory; files are written with fixed names instead of using a prefix
+	-overlaps
+	  	write candidate branches left out of the largest network because their cycles overlap chosen cycles to <prefix>_overlaps.csv
+	-partitions file
+	  	assign genes to partitions (one "gene partition" pair per line) for stratified bootstrap and per partition support
+	-progress path
+	  	write a json progress event (phase, percent, current k, and best score) every second to path, which may be a file, a named pipe (FIFO), or a unix socket listening for connections
+	-progress-bar
+	  	draw a progress bar with the estimated time left for the current phase on stderr (only if stderr is a terminal)
+	-qchanges
+	  	write quartets gained/lost between consecutive numbers of edges to <prefix>_qchanges.csv
+	-report-ties
+	  	log the edges that scored exactly the same as each chosen reticulation, for each number of edges, showing when the network is one of several equally good ones
+	-resolve-polytomies mode
+	  	resolve polytomies in the constraint tree [none|arbitrary|quartet]; reticulations between two added edges are not considered (default "none")
+	-restrict file
+	  	only use the taxa listed in file (one per line), pruning the constraint tree and gene trees
 	-s float
 	  	collapse edges in gene trees with support less than value (default 0)
+	-seed uint
+	  	seed for randomized components (including -tie-break seeded); 0 picks a random seed (default 0)
+	-skip-invalid-trees
+	  	skip gene trees that cannot be parsed instead of stopping, listing them in <prefix>_invalid_trees.csv
+	-stream
+	  	read gene trees one at a time while extracting quartets instead of loading them all into memory; cannot be used with options that need every gene tree
 	-t float
 	  	threshold for quartet filter [0, 1] (default 0.5)
+	-telemetry interval
+	  	interval for logging resource usage (0 disables periodic logging) (default 1m0s)
+	-threshold-sweep thresholds
+	  	comma separated quartet filter thresholds to rescore the reticulations of the largest network at (reusing the quartet counts), writing how stable their scores are to <prefix>_threshold_sweep.csv
+	-tie-break policy
+	  	how the dp chooses between edges with exactly the same score [shortest|seeded]; shortest prefers the shorter cycle, then the deeper donor, then the donor and hybrid that come first in the constraint tree, and seeded uses a random order of the edges drawn from -seed (default "shortest")
+	-timeout duration
+	  	stop and exit with an error if the run takes longer than duration (0 means no limit)
 	-v	prints version number and exits
+	-verbosity level
+	  	level of log messages written to both stderr and the log file [none|error|warn|info|debug|trace]; -log-console and -log-file take precedence over it (default info)
+	-weights file
+	  	weight quartets from each gene tree by the weights in file (one number per line, in the same order as the gene trees)
+	-within percent
+	  	write the networks whose score is within percent of the optimal score, for each number of edges, to <prefix>_near_optimal.csv, best first (default 0)
+	-within-max n
+	  	maximum number of networks kept for any part of the tree while enumerating with -within (default 1000)
+
+score flags:
+
+	-as-unrooted
+	  	treat gene trees as unrooted, removing the root of rooted gene trees when they are read
+	-branch-support
+	  	write the network's backbone tree with the percent of quartets around each internal branch that agree with it as support values, instead of scoring reticulations
+	-f format
+	  	gene tree format [newick|nexus] (default "newick")
+	-gamma
+	  	keep the network fixed and write it with the re-estimated inheritance probability (gamma) and support of each reticulation edge (e.g., #H1::0.81:0.32), instead of scoring reticulations
+	-h	prints help and exits
+	-k int
+	  	number of reticulations of the network to score when reading a results csv (default largest)
+	-max-rows num
+	  	split the score matrix into numbered csv files of at most num genes each, listed in an index file, when there are more genes (0 means no limit)
+	-o prefix
+	  	prefix of the csv files and index written when the score matrix is split by -max-rows (default "scores")
+	-restrict file
+	  	only use the taxa listed in file (one per line), pruning the network and gene trees
+	-sparse
+	  	write one row per gene and reticulation with an informative score instead of a matrix
+	-summary-only
+	  	only write support, mean, and number of informative genes for each reticulation
+	-timeout duration
+	  	stop and exit with an error if scoring takes longer than duration (0 means no limit)
+
+score-edges flags:
+
+	-a float
+	  	parameter to adjust penalty for "sym" score mode, from (0, 1] (default 0.1)
+	-f format
+	  	gene tree format [newick|nexus] (default "newick")
+	-h	prints help and exits
+	-n int
+	  	number of parallel processes (default number of cpus)
+	-penalty-scale scale
+	  	how the "sym" penalty grows with the length of the cycle an edge forms scale [flat|linear|log] (default "flat")
+	-q int
+	  	quartet filter mode number [0, 2] (default 2)
+	-s float
+	  	collapse edges in gene trees with support less than value (default 0)
+	-sm modes
+	  	comma separated score modes [max|norm|sym|cf] to score each edge with (default "max,norm,sym")
+	-t float
+	  	threshold for quartet filter [0, 1] (default 0.5)
+
+place flags:
+
+	-csv file
+	  	write the placement of each new taxon and its quartet support to file
+	-f format
+	  	gene tree format [newick|nexus] (default "newick")
+	-h	prints help and exits
+	-k int
+	  	number of reticulations of the network to use when reading a results csv (default largest)
+
+compare flags:
+
+	-h	prints help and exits
+	-k int
+	  	number of reticulations of the networks to compare when reading a results csv (default largest)
+
+convert flags:
+
+	-f format
+	  	gene tree format [newick|nexus] (default "newick")
+	-g file
+	  	label reticulation edges with the fraction of informative quartets in the gene trees in file that support them
+	-h	prints help and exits
+	-k int
+	  	number of reticulations of the network to convert when reading a results csv (default largest)
+	-to format
+	  	graph format to write [dot|graphml|phyloxml] (default "dot")
+
+report flags:
+
+	-h	prints help and exits
+	-k int
+	  	number of reticulations of the networks to compare across runs (default largest of each run)
+	-names names
+	  	comma separated names of the runs in the report, in order (default the name of each output directory)
+	-o prefix
+	  	prefix of the report files (default "report")
+
+stats flags:
+
+	-f format
+	  	gene tree format [newick|nexus] (default "newick")
+	-h	prints help and exits
+	-o prefix
+	  	also write the taxa coverage of each gene tree and the distribution of quartet counts to csv files starting with prefix
+	-root-audit
+	  	write whether the root of each gene tree changes the quartets it contributes (and whether unrooting changed its splits) instead of the summary
+
+root flags:
+
+	-h	prints help and exits
+	-midpoint
+	  	root at the midpoint of the longest path between two taxa (needs branch lengths)
+	-outgroup taxa
+	  	comma separated outgroup taxa to root on, which must be monophyletic
+
+run flags:
+
+	-h	prints help and exits
+	-outdir directory
+	  	results directory (overrides outdir in the config)
+
+exit codes:
+
+	0	success
+	1	runtime error, or an internal error (a bug)
+	2	invalid command line arguments
+	3	input file is missing or could not be parsed
+	4	inputs are not valid (e.g., unrooted constraint tree, mismatched taxa, warnings with -fail-on-warning)
+	5	ran out of a system resource (e.g., disk space, or the -timeout)
 
 examples:
 
 	camus -o output-name constraint.nwk gene-trees.nwk
+	camus score network.nwk gene-trees.nwk > scores.csv
+	camus score-edges constraint.nwk edges.csv gene-trees.nwk > edge-scores.csv
+	camus place network.nwk gene-trees.nwk > placed.nwk
+	camus compare true-network.nwk network.nwk > distances.csv
+	camus convert network.nwk > network.dot
+	camus report -o filtering run-t0.0 run-t0.1 run-t0.2
+	camus stats constraint.nwk gene-trees.nwk > input-stats.csv
+	camus root -outgroup A species.nwk > constraint.nwk
+	camus run pipeline.json
+	camus help scorers
 */
 package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"iter"
 	"log"
+	"maps"
+	"math/rand/v2"
+	"net"
 	"os"
 	"runtime/debug"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/evolbioinfo/gotree/tree"
+
 	gr "github.com/jsdoublel/camus/internal/graphs"
 	in "github.com/jsdoublel/camus/internal/infer"
+	lg "github.com/jsdoublel/camus/internal/logging"
 	pr "github.com/jsdoublel/camus/internal/prep"
 	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
 )
 
 var Version = "dev" // set with ldflags at build time
 
 const (
-	ErrorMessage = "camus encountered an error ::"
-	TimeFormat   = "2006-01-02_15-04-05"
-
-	DefaultFormat     = "newick"
-	DefaultScoreMode  = "max"
-	DefaultQMode      = 2
-	DefaultMinSupport = 0
-	DefaultThreshold  = 0.5
-	DefaultAlpha      = 0.1
+	TimeFormat = "2006-01-02_15-04-05"
+
+	DefaultFormat       = "newick"
+	DefaultScoreMode    = "max"
+	DefaultQMode        = 2
+	DefaultMinSupport   = 0
+	DefaultThreshold    = 0.5
+	DefaultAlpha        = 0.1
+	DefaultPenaltyScale = "flat"
 )
 
-var experimentalFlags = []string{"a", "asSet", "q", "sm"}
+var errWarnings = errors.New("warnings were logged with -fail-on-warning")
+
+var experimentalFlags = []string{"a", "asSet", "audit-quartets", "penalty-scale", "q", "sm"}
 
 type Args struct {
-	prefix       string          // output prefix
-	gtFormat     pr.Format       // gene tree file format
-	treeFile     string          // constraint or network tree file
-	geneTreeFile string          // gene trees
-	inferOpts    in.InferOptions // camus options
+	prefix       string            // output prefix
+	outdir       string            // output directory
+	outFormat    string            // format of the results written to stdout and the results file
+	flags        map[string]string // flags given on the command line
+	gtFormat     pr.Format         // gene tree file format
+	treeFile     string            // constraint or network tree file
+	geneTreeFile string            // gene trees
+	restrictFile string            // file listing taxa to restrict input to
+	weightsFile  string            // file with a weight for each gene tree
+	branchesFile string            // file listing branches to score instead of running the dp
+	asUnrooted   bool              // treat gene trees as unrooted
+	autoRoot     bool              // root an unrooted constraint tree where the rooted gene trees suggest
+	collapse     bool              // collapse identical taxa during inference
+	polytomies   pr.PolytomyMode   // how polytomies in the constraint tree are resolved
+	retLabels    gr.RetLabeling    // naming scheme for reticulation labels
+	inferOpts    in.InferOptions   // camus options
+	qChanges     bool              // write quartets gained/lost between consecutive networks
+	overlaps     bool              // write branches left out of the largest network because their cycles overlap
+	embedding    bool              // write quartet agreement of each gene tree with each tree displayed by the largest network
+	geneContribs bool              // write quartets of each gene tree supporting each reticulation of the largest network
+	concordance  bool              // write quartet concordance of each constraint tree branch
+	concNewick   bool              // also write the constraint tree annotated with quartet concordance
+	gamma        bool              // estimate inheritance probabilities of reticulation edges
+	influence    bool              // run leave-one-out gene influence analysis
+	jackknife    int               // gene trees in each block left out by the jackknife (off if 0)
+	nullReps     int               // number of null simulation replicates
+	bootstrap    int               // number of bootstrap replicates
+	partFile     string            // file assigning genes to partitions
+	balanceParts bool              // draw the same number of genes from every partition
+	maxFiltered  float64           // fraction of quartets filtered above which a warning is logged
+	failOnWarn   bool              // treat logged warnings as errors
+	dryRun       bool              // only estimate resources
+	skipInvalid  bool              // skip gene trees that can't be parsed
+	stream       bool              // read gene trees one at a time instead of all at once
+	alignments   bool              // infer quartets from the alignments in the gene tree file (a directory) instead of gene trees
+	telemetry    time.Duration     // interval for logging resource usage
+	progress     string            // file, FIFO, or unix socket to write progress events to
+	progressBar  bool              // draw a progress bar on stderr
+	timeout      time.Duration     // time limit for the run (no limit if 0)
+	consoleLog   lg.Level          // verbosity of log written to stderr
+	color        bool              // color the end of run summary
+	fileLog      lg.Level          // verbosity of log written to log file
+	logJSON      bool              // write log messages as json lines
 }
 
 // Gets CAMUS version. If Version variable is not set (i.e., it is still "dev"),
@@ -111,12 +428,12 @@ func GetVersion() string {
 }
 
 func Usage(extended bool) {
-	fmt.Fprint(flag.CommandLine.Output(), // nolint
-		"usage: camus [flags]... <const_tree_file> <gene_tree_file>\n",
+	writeCommandUsage(flag.CommandLine.Output()) // nolint
+	fmt.Fprint(flag.CommandLine.Output(),        // nolint
 		"\n",
 		"positional arguments:\n\n",
 		"  <tree_file>\t\tconstraint newick tree\n",
-		"  <gene_tree_file>\tgene tree newick file\n",
+		"  <gene_tree_file>\tgene tree newick file (or directory of FASTA alignments with -alignments)\n",
 		"\n",
 		"flags:\n\n",
 	)
@@ -135,72 +452,411 @@ func Usage(extended bool) {
 	fmt.Fprint(flag.CommandLine.Output(), // nolint
 		"\n",
 		"examples:\n\n",
-		"\tcamus -o output-name constraint.nwk gene-trees.nwk\n\n",
+		"\tcamus -o output-name constraint.nwk gene-trees.nwk\n",
+		"\tcamus score network.nwk gene-trees.nwk > scores.csv\n\n",
 	)
 }
 
-func parseArgs() Args {
+func parseArgs(arguments []string) Args {
 	flag.Usage = func() {
 		Usage(false)
 	}
+	build := inferFlags(flag.CommandLine)
+	flag.CommandLine.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the infer flags on fs, returning a function that checks them once
+// they are parsed and makes the Args
+func inferFlags(fs *flag.FlagSet) func() Args {
 	format, ok := pr.ParseFormat[DefaultFormat]
 	if !ok {
 		panic(fmt.Sprintf("bad default format %s", DefaultFormat))
 	}
-	flag.Var(&format, "f", "gene tree `format` [newick|nexus] (default \"newick\")")
-	prefix := flag.String("o", "", "output prefix")
-	scoreMode := flag.String("sm", DefaultScoreMode, "score `mode` [max|norm|sym]")
-	mode := flag.Int("q", DefaultQMode, "quartet filter mode number [0, 2]")
-	supp := flag.Float64("s", DefaultMinSupport, "collapse edges in gene trees with support less than value (default 0)")
-	thresh := flag.Float64("t", DefaultThreshold, "threshold for quartet filter [0, 1]")
-	alpha := flag.Float64("a", DefaultAlpha, "parameter to adjust penalty for \"sym\" score mode, from (0, 1]")
-	asSet := flag.Bool("asSet", false, "quartet count is calculated as a set (one point per unique topology)")
-	help := flag.Bool("h", false, "prints short help and exits")
-	hhelp := flag.Bool("hh", false, "prints help with experimental features and exits")
-	ver := flag.Bool("v", false, "prints version number and exits")
-	nprocs := flag.Int("n", 0, "number of parallel processes")
-	flag.Parse()
-	if *help {
-		Usage(false)
-		os.Exit(0)
-	}
-	if *hhelp {
-		Usage(true)
-		os.Exit(0)
-	}
-	if *ver {
-		fmt.Println(GetVersion())
-		os.Exit(0)
-	}
-	if flag.NArg() != 2 {
-		parserError("two positional arguments required: <const_tree> <gene_tree_file>")
+	fs.Var(&format, "f", "gene tree `format` [newick|nexus] (default \"newick\")")
+	prefix := fs.String("o", "", "output prefix")
+	outdir := fs.String("outdir", "", "output directory; files are written with fixed names instead of using a prefix")
+	weights := fs.String("weights", "", "weight quartets from each gene tree by the weights in `file` (one number per line, in the same order as the gene trees)")
+	restrict := fs.String("restrict", "", "only use the taxa listed in `file` (one per line), pruning the constraint tree and gene trees")
+	scoreMode := fs.String("sm", DefaultScoreMode, "score `mode` [max|norm|sym|cf]")
+	mode := fs.Int("q", DefaultQMode, "quartet filter mode number [0, 2]")
+	supp := fs.Float64("s", DefaultMinSupport, "collapse edges in gene trees with support less than value (default 0)")
+	thresh := fs.Float64("t", DefaultThreshold, "threshold for quartet filter [0, 1]")
+	alpha := fs.Float64("a", DefaultAlpha, "parameter to adjust penalty for \"sym\" score mode, from (0, 1]")
+	penaltyScale := fs.String("penalty-scale", DefaultPenaltyScale, "how the \"sym\" penalty grows with the length of the cycle an edge forms `scale` [flat|linear|log]; alpha is the penalty of the shortest (four edge) cycle")
+	asSet := fs.Bool("asSet", false, "deprecated alias of -count-mode set, which counts quartets as a set (one point per unique topology)")
+	var countMode pr.CountMode
+	var constraintQuartets pr.ConstraintQuartets
+	fs.Var(&constraintQuartets, "constraint-quartets", "how gene tree quartets displayed by the constraint tree are counted `mode` [drop|keep|weight:X]; keep and weight:X (0 < X < 1) count them (at X times their count) in the percent of quartets satisfied and minor frequencies, although no reticulation can add them (default \"drop\")")
+	fs.Var(&countMode, "count-mode", "how gene tree quartet topologies are counted `mode` [raw|set|length|capped:N]; length weights each quartet by the length of the gene tree branch inducing it, and capped:N counts each topology from at most N gene trees (default \"raw\")")
+	asUnrooted := fs.Bool("as-unrooted", false, "treat gene trees as unrooted, removing the root of rooted gene trees when they are read")
+	autoRoot := fs.Bool("auto-root", false, "root an unrooted constraint tree on the edge that the root splits of the most rooted gene trees agree with, instead of stopping with a suggested root")
+	help := fs.Bool("h", false, "prints short help and exits")
+	hhelp := fs.Bool("hh", false, "prints help with experimental features and exits")
+	ver := fs.Bool("v", false, "prints version number and exits")
+	nprocs := fs.Int("n", 0, "number of parallel processes")
+	nprep := fs.Int("n-prep", 0, "number of parallel processes for quartet extraction (defaults to -n)")
+	ndp := fs.Int("n-dp", 0, "number of parallel processes for edge scores and the dp (defaults to -n)")
+	telemetry := fs.Duration("telemetry", time.Minute, "`interval` for logging resource usage (0 disables periodic logging)")
+	progress := fs.String("progress", "", "write a json progress event (phase, percent, current k, and best score) every second to `path`, which may be a file, a named pipe (FIFO), or a unix socket listening for connections")
+	progressBar := fs.Bool("progress-bar", false, "draw a progress bar with the estimated time left for the current phase on stderr (only if stderr is a terminal)")
+	timeout := fs.Duration("timeout", 0, "stop and exit with an error if the run takes longer than `duration` (0 means no limit)")
+	verbosity, consoleLog, fileLog := lg.Info, lg.Info, lg.Info
+	fs.Var(&verbosity, "verbosity", "`level` of log messages written to both stderr and the log file [none|error|warn|info|debug|trace]; -log-console and -log-file take precedence over it")
+	fs.Var(&consoleLog, "log-console", "`level` of log messages written to stderr, overriding -verbosity [none|error|warn|info|debug|trace]")
+	fs.Var(&fileLog, "log-file", "`level` of log messages written to the log file, overriding -verbosity [none|error|warn|info|debug|trace]")
+	logJSON := fs.Bool("log-json", false, "write log messages as json lines with their level, stage, k, best score, and elapsed time")
+	color := fs.String("color", colorAuto, "color the summary written to stderr at the end of a run `mode` [auto|always|never]")
+	seed := fs.Uint64("seed", 0, "seed for randomized components (including -tie-break seeded); 0 picks a random seed")
+	var tieBreak in.TieBreak
+	fs.Var(&tieBreak, "tie-break", "how the dp chooses between edges with exactly the same score `policy` [shortest|seeded]; shortest prefers the shorter cycle, then the deeper donor, then the donor and hybrid that come first in the constraint tree, and seeded uses a random order of the edges drawn from -seed (default \"shortest\")")
+	coOptimal := fs.Int("co-optimal", 0, "write up to `n` distinct networks with the largest number of edges that score exactly the same as the optimal one to <prefix>_co_optimal.nwk, one per line")
+	within := fs.Float64("within", 0, "write the networks whose score is within `percent` of the optimal score, for each number of edges, to <prefix>_near_optimal.csv, best first")
+	withinMax := fs.Int("within-max", 1000, "maximum number of networks kept for any part of the tree while enumerating with -within")
+	reportTies := fs.Bool("report-ties", false, "log the edges that scored exactly the same as each chosen reticulation, for each number of edges, showing when the network is one of several equally good ones")
+	numAlts := fs.Int("alternatives", 0, "number of best non-chosen branches to report for each number of edges")
+	branches := fs.String("branches", "", "score the reticulation branches listed in `file` (one per line, as U and W clades) on the constraint tree instead of running the dp")
+	cacheDir := fs.String("cache-dir", "", "cache edge score matrices in `dir` so reruns on the same data with a different score mode or alpha reuse them")
+	compareModes := fs.String("compare-modes", "", "comma separated score `modes` [max|norm|sym|cf] to also run on the same preprocessed data, writing a comparison to <prefix>_modes.csv and <prefix>_modes.png")
+	collapse := fs.Bool("collapse-identical", false, "collapse taxa that are sisters in the constraint tree and every gene tree into one representative, expanding them in the output networks")
+	stream := fs.Bool("stream", false, "read gene trees one at a time while extracting quartets instead of loading them all into memory; cannot be used with options that need every gene tree")
+	skipInvalid := fs.Bool("skip-invalid-trees", false, "skip gene trees that cannot be parsed instead of stopping, listing them in <prefix>_invalid_trees.csv")
+	dryRun := fs.Bool("dry-run", false, "parse inputs, print estimated memory and runtime, and exit without running")
+	geneContribs := fs.Bool("gene-contributions", false, "write the number of quartets of each gene tree supporting each reticulation of the largest network to <prefix>_gene_contributions.csv")
+	embedding := fs.Bool("embedding", false, "write the fraction of each gene tree's quartets displayed by each tree displayed by the largest network to <prefix>_embedding.csv")
+	concordance := fs.Bool("concordance", false, "write quartet concordance (QC), differential (QD), and informativeness (QI) of each constraint tree branch to <prefix>_concordance.csv")
+	concNewick := fs.Bool("concordance-newick", false, "also write the constraint tree with the quartet concordance of each branch in newick comments to <prefix>_concordance.nwk (implies -concordance)")
+	overlaps := fs.Bool("overlaps", false, "write candidate branches left out of the largest network because their cycles overlap chosen cycles to <prefix>_overlaps.csv")
+	exclSupport := fs.Bool("exclusion-support", false, "compare the largest network to the best network of the same size without each reticulation")
+	thresholdSweep := fs.String("threshold-sweep", "", "comma separated quartet filter `thresholds` to rescore the reticulations of the largest network at (reusing the quartet counts), writing how stable their scores are to <prefix>_threshold_sweep.csv")
+	candidateThreshold := fs.Float64("candidate-threshold", 0, "write the largest network with reticulations satisfying less than `percent` of quartets on their own left out, and recorded as candidate gene flow annotations on the backbone instead, to <prefix>_conservative.nwk, listing them in <prefix>_candidates.csv")
+	minorFreq := fs.Bool("minor-freq", false, "write an approximate minor quartet frequency (a quick proxy for gamma) of each reticulation to <prefix>_minor_freq.csv")
+	bootstrap := fs.Int("bootstrap", 0, "number of bootstrap replicates resampling gene trees (within partitions, if given) to estimate support for each reticulation")
+	partFile := fs.String("partitions", "", "assign genes to partitions (one \"gene partition\" pair per line) for stratified bootstrap and per partition support")
+	balanceParts := fs.Bool("balance-partitions", false, "draw the same number of genes from every partition in bootstrap replicates")
+	nullReps := fs.Int("null-reps", 0, "number of gene tree sets to simulate under the constraint tree to calibrate score gains against ILS")
+	influence := fs.Bool("influence", false, "rerun with each gene tree left out and write an influence ranking to <prefix>_influence.csv")
+	jackknife := fs.Bool("jackknife", false, "leave out each block of gene trees in turn and write how much of the quartet support of each reticulation of the largest network is left to <prefix>_jackknife.csv")
+	jackknifeBlock := fs.Int("jackknife-block", 1, "`n`umber of consecutive gene trees in each block left out by -jackknife")
+	hPrefix := fs.String("h-prefix", gr.DefaultRetLabeling.Prefix, "`prefix` of reticulation labels in output networks (labels are #<prefix><n>)")
+	hStart := fs.Int("h-start", gr.DefaultRetLabeling.Start, "number of the first reticulation label")
+	maxFiltered := fs.Float64("max-filtered", 1, "log a warning if the quartet filter removes more than `fraction` of unique quartets")
+	failOnWarn := fs.Bool("fail-on-warning", false, "exit with an error if any warning is logged, before writing output when possible")
+	maxRets := fs.Int("k", 0, "maximum number of reticulations to infer (default 0, no limit)")
+	adaptiveK := fs.Bool("adaptive-k", false, "stop the dp at each vertex once its score reaches an upper bound from the subtrees below it, skipping values of k that cannot improve it")
+	compactTraceback := fs.Bool("compact-traceback", false, "keep less of the dp traceback in memory, recomputing the cycles of the optimal networks when they are traced back (slower, for machines with little memory)")
+	maxKVertex := fs.Int("max-k-per-vertex", 0, "maximum number of edges in the subtree below any vertex but the root, bounding the work at each vertex (default 0, no limit)")
+	alignments := fs.Bool("alignments", false, "read <gene_tree_file> as a directory of FASTA alignments (one per locus) and infer the quartets of each locus from its alignment instead of a gene tree")
+	var seqMethod pr.SeqMethod
+	fs.Var(&seqMethod, "alignment-method", "how quartet topologies are inferred with -alignments `method` [parsimony|distance]; parsimony picks the topology with the most parsimony-informative sites, and distance uses the four-point condition on uncorrected p-distances (default \"parsimony\")")
+	var mulTrees pr.MulMode
+	fs.Var(&mulTrees, "mul-trees", "how gene trees with more than one copy of a taxon (e.g., from gene duplication) are handled `mode` [error|collapse|copies]; collapse keeps the first copy of each taxon, and copies counts the quartets of every choice of copies, down-weighted by the number of choices (default \"error\")")
+	var polytomies pr.PolytomyMode
+	fs.Var(&polytomies, "resolve-polytomies", "resolve polytomies in the constraint tree `mode` [none|arbitrary|quartet]; reticulations between two added edges are not considered (default \"none\")")
+	auditQuartets := fs.Int("audit-quartets", 0, "number of random (quartet, edge) pairs whose quartet score is checked against a slow reference implementation, logging a warning for each mismatch")
+	qChanges := fs.Bool("qchanges", false, "write quartets gained/lost between consecutive numbers of edges to <prefix>_qchanges.csv")
+	outFormat := fs.String("out-format", outFormatCSV, "`format` of the optimal networks written to stdout and the results file [csv|json|nexus|phyloxml]; json also has the branches, edge scores, and run metadata, nexus can be opened in Dendroscope or IcyTree, and phyloxml in Archaeopteryx")
+	gamma := fs.Bool("gamma", false, "estimate the inheritance probability of each reticulation edge from gene tree quartets, writing it to the output networks (e.g., #H1:::0.32)")
+	return func() Args {
+		if *help {
+			Usage(false)
+			os.Exit(0)
+		}
+		if *hhelp {
+			Usage(true)
+			os.Exit(0)
+		}
+		if *ver {
+			fmt.Println(GetVersion())
+			os.Exit(0)
+		}
+		if fs.NArg() != 2 {
+			parserError("two positional arguments required: <const_tree> <gene_tree_file>")
+		}
+		if *prefix != "" && *outdir != "" {
+			parserError("-o and -outdir cannot be used together")
+		}
+		scorer, ok := sc.ParseScorer[*scoreMode]
+		if !ok {
+			parserError(fmt.Sprintf("\"%s\" is not a valid score mode: valid score modes are \"max\", \"norm\", \"sym\", and \"cf\"", *scoreMode))
+		}
+		qOpts, err := pr.SetQuartetFilterOptions(*mode, *thresh)
+		if err != nil {
+			parserError(err.Error())
+		}
+		if *asSet {
+			if countMode.Cap != 0 || countMode.Length {
+				parserError(fmt.Sprintf("-asSet and -count-mode %s cannot be used together", countMode))
+			}
+			lg.Warnf("-asSet is deprecated and will be removed, use -count-mode set instead")
+			countMode.AsSet = true
+		}
+		inferOpts, err := in.MakeInferOptions(*nprocs, *nprep, *ndp, qOpts, *supp, scorer, countMode.AsSet, *alpha)
+		if err != nil {
+			parserError(err.Error())
+		}
+		if inferOpts.PenaltyScale, ok = sc.ParsePenaltyScale[*penaltyScale]; !ok {
+			parserError(fmt.Sprintf("\"%s\" is not a valid penalty scale: valid penalty scales are \"flat\", \"linear\", and \"log\"", *penaltyScale))
+		}
+		if *seed == 0 {
+			*seed = rand.Uint64()
+		}
+		inferOpts.Seed = *seed
+		if *branches != "" && (*reportTies || tieBreak != in.TieShortest) {
+			parserError("-branches cannot be used with -tie-break or -report-ties, since the dp is not run")
+		}
+		inferOpts.TieBreak = tieBreak
+		inferOpts.ReportTies = *reportTies
+		if *coOptimal < 0 {
+			parserError("-co-optimal must be non-negative")
+		}
+		if *branches != "" && *coOptimal > 0 {
+			parserError("-branches and -co-optimal cannot be used together, since the dp is not run")
+		}
+		inferOpts.CoOptimal = *coOptimal
+		if *within < 0 || *within > 100 {
+			parserError("-within must be in [0, 100]")
+		}
+		if *withinMax < 1 {
+			parserError("-within-max must be positive")
+		}
+		if *branches != "" && *within > 0 {
+			parserError("-branches and -within cannot be used together, since the dp is not run")
+		}
+		inferOpts.Within, inferOpts.WithinMax = *within, *withinMax
+		if *numAlts < 0 {
+			parserError("-alternatives must be non-negative")
+		}
+		inferOpts.NumAlts = *numAlts
+		inferOpts.Overlaps = true // always logged, only written with -overlaps
+		inferOpts.CountCap = countMode.Cap
+		inferOpts.LengthWeights = countMode.Length
+		inferOpts.ConstraintQuartets = constraintQuartets
+		inferOpts.MulTrees = mulTrees
+		if *autoRoot && *asUnrooted {
+			parserError("-auto-root and -as-unrooted cannot be used together, since the root is suggested by rooted gene trees")
+		}
+		if *jackknifeBlock < 1 {
+			parserError("-jackknife-block must be positive")
+		}
+		var jackknifeSize int // off unless -jackknife
+		if *jackknife {
+			jackknifeSize = *jackknifeBlock
+		}
+		inferOpts.Provenance = *geneContribs || *jackknife // per gene counts are read from the tree data instead of the gene trees
+		if mulTrees == pr.MulCopies {
+			needSingleCopy := map[string]bool{
+				"-count-mode length": countMode.Length, "-collapse-identical": *collapse, "-partitions": *partFile != "",
+				"-resolve-polytomies quartet": polytomies == pr.QuartetResolve, "-gamma": *gamma,
+				"-embedding": *embedding, "-concordance": *concordance || *concNewick, "-gene-contributions": *geneContribs,
+			}
+			for _, name := range slices.Sorted(maps.Keys(needSingleCopy)) {
+				if needSingleCopy[name] {
+					parserError(fmt.Sprintf("-mul-trees copies and %s cannot be used together", name))
+				}
+			}
+		}
+		if *maxRets < 0 {
+			parserError("-k must be non-negative")
+		}
+		inferOpts.MaxReticulations = *maxRets
+		inferOpts.AdaptiveK = *adaptiveK
+		inferOpts.CompactTraceback = *compactTraceback
+		if *maxKVertex < 0 {
+			parserError("-max-k-per-vertex must be non-negative")
+		}
+		inferOpts.MaxKPerVertex = *maxKVertex
+		inferOpts.ExclSupport = *exclSupport
+		inferOpts.MinorFreq = *minorFreq
+		if *thresholdSweep != "" {
+			if qOpts.QuartetFilterOff() {
+				parserError("-threshold-sweep needs the quartet filter (-q 1 or 2)")
+			}
+			if inferOpts.ThresholdSweep, err = parseThresholds(*thresholdSweep); err != nil {
+				parserError(err.Error())
+			}
+		}
+		if *candidateThreshold < 0 || *candidateThreshold > 100 {
+			parserError("-candidate-threshold must be between 0 and 100")
+		}
+		inferOpts.CandidatePercent = *candidateThreshold
+		inferOpts.CacheDir = *cacheDir
+		if *auditQuartets < 0 {
+			parserError("-audit-quartets must be non-negative")
+		}
+		inferOpts.AuditSamples = *auditQuartets
+		if *compareModes != "" {
+			if inferOpts.CompareModes, err = parseCompareModes(*compareModes, scorer); err != nil {
+				parserError(err.Error())
+			}
+		}
+		if *nullReps < 0 {
+			parserError("-null-reps must be non-negative")
+		}
+		if *timeout < 0 {
+			parserError("-timeout must be non-negative")
+		}
+		if *bootstrap < 0 {
+			parserError("-bootstrap must be non-negative")
+		}
+		if *balanceParts && (*partFile == "" || *bootstrap == 0) {
+			parserError("-balance-partitions requires -partitions and -bootstrap")
+		}
+		if *maxFiltered < 0 || *maxFiltered > 1 {
+			parserError("-max-filtered must be between 0 and 1")
+		}
+		if *branches != "" && *collapse {
+			parserError("-branches and -collapse-identical cannot be used together")
+		}
+		if !slices.Contains(outFormats, *outFormat) {
+			parserError(fmt.Sprintf("\"%s\" is not a valid output format: valid formats are %s", *outFormat, strings.Join(outFormats, ", ")))
+		}
+		if *color != colorAuto && *color != colorAlways && *color != colorNever {
+			parserError(fmt.Sprintf("\"%s\" is not a valid color mode: valid modes are \"auto\", \"always\", and \"never\"", *color))
+		}
+		if *stream {
+			needTrees := map[string]bool{
+				"-restrict": *restrict != "", "-collapse-identical": *collapse, "-branches": *branches != "",
+				"-partitions": *partFile != "", "-influence": *influence, "-null-reps": *nullReps > 0,
+				"-bootstrap": *bootstrap > 0, "-resolve-polytomies quartet": polytomies == pr.QuartetResolve,
+				"-gamma": *gamma, "-skip-invalid-trees": *skipInvalid, "-embedding": *embedding,
+				"-concordance": *concordance || *concNewick, "-gene-contributions": *geneContribs,
+				"-jackknife": *jackknife, "-auto-root": *autoRoot,
+			}
+			for _, name := range slices.Sorted(maps.Keys(needTrees)) {
+				if needTrees[name] {
+					parserError(fmt.Sprintf("-stream and %s cannot be used together", name))
+				}
+			}
+		}
+		if *alignments {
+			needTrees := map[string]bool{
+				"-stream": *stream, "-restrict": *restrict != "", "-collapse-identical": *collapse, "-branches": *branches != "",
+				"-partitions": *partFile != "", "-influence": *influence, "-null-reps": *nullReps > 0,
+				"-bootstrap": *bootstrap > 0, "-resolve-polytomies quartet": polytomies == pr.QuartetResolve,
+				"-gamma": *gamma, "-skip-invalid-trees": *skipInvalid, "-embedding": *embedding,
+				"-concordance": *concordance || *concNewick, "-gene-contributions": *geneContribs,
+				"-jackknife": *jackknife, "-auto-root": *autoRoot, "-dry-run": *dryRun, "-s": *supp != 0,
+				"-count-mode length": countMode.Length, "-mul-trees": mulTrees != pr.MulError,
+			}
+			for _, name := range slices.Sorted(maps.Keys(needTrees)) {
+				if needTrees[name] {
+					parserError(fmt.Sprintf("-alignments and %s cannot be used together", name))
+				}
+			}
+			inferOpts.SeqMethod = seqMethod
+		} else if seqMethod != pr.SeqParsimony {
+			parserError("-alignment-method needs -alignments")
+		}
+		flags := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) {
+			flags[f.Name] = f.Value.String()
+		})
+		if _, ok := flags["log-console"]; !ok {
+			consoleLog = verbosity
+		}
+		if _, ok := flags["log-file"]; !ok {
+			fileLog = verbosity
+		}
+		retLabels := gr.RetLabeling{Prefix: *hPrefix, Start: *hStart}
+		if err := retLabels.Validate(); err != nil {
+			parserError(err.Error())
+		}
+		return Args{
+			prefix:       *prefix,
+			outdir:       *outdir,
+			outFormat:    *outFormat,
+			flags:        flags,
+			gtFormat:     format,
+			treeFile:     fs.Arg(0),
+			geneTreeFile: fs.Arg(1),
+			restrictFile: *restrict,
+			weightsFile:  *weights,
+			branchesFile: *branches,
+			asUnrooted:   *asUnrooted,
+			autoRoot:     *autoRoot,
+			collapse:     *collapse,
+			polytomies:   polytomies,
+			retLabels:    retLabels,
+			inferOpts:    *inferOpts,
+			qChanges:     *qChanges,
+			overlaps:     *overlaps,
+			embedding:    *embedding,
+			geneContribs: *geneContribs,
+			concordance:  *concordance || *concNewick,
+			concNewick:   *concNewick,
+			gamma:        *gamma,
+			influence:    *influence,
+			jackknife:    jackknifeSize,
+			nullReps:     *nullReps,
+			bootstrap:    *bootstrap,
+			partFile:     *partFile,
+			balanceParts: *balanceParts,
+			maxFiltered:  *maxFiltered,
+			failOnWarn:   *failOnWarn,
+			dryRun:       *dryRun,
+			skipInvalid:  *skipInvalid,
+			stream:       *stream,
+			alignments:   *alignments,
+			telemetry:    *telemetry,
+			progress:     *progress,
+			progressBar:  *progressBar && stderrIsTerminal(),
+			timeout:      *timeout,
+			consoleLog:   consoleLog,
+			color:        useColor(*color),
+			fileLog:      fileLog,
+			logJSON:      *logJSON,
+		}
 	}
-	scorer, ok := sc.ParseScorer[*scoreMode]
-	if !ok {
-		parserError(fmt.Sprintf("\"%s\" is not a valid score mode: valid score modes are \"max\", \"norm\", and \"sym\"", *scoreMode))
+}
+
+// Parses comma separated score modes to compare; the main score mode is
+// always compared first
+func parseCompareModes(modes string, main sc.InitableScorer) ([]sc.InitableScorer, error) {
+	names := []string{sc.ScorerName(main)}
+	for name := range strings.SplitSeq(modes, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := sc.ParseScorer[name]; !ok {
+			return nil, fmt.Errorf("\"%s\" is not a valid score mode for -compare-modes: valid score modes are \"max\", \"norm\", \"sym\", and \"cf\"", name)
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
 	}
-	qOpts, err := pr.SetQuartetFilterOptions(*mode, *thresh)
-	if err != nil {
-		parserError(err.Error())
+	if len(names) == 1 {
+		return nil, fmt.Errorf("-compare-modes needs a score mode other than the one used (%s)", names[0])
 	}
-	inferOpts, err := in.MakeInferOptions(*nprocs, qOpts, *supp, scorer, *asSet, *alpha)
-	if err != nil {
-		parserError(err.Error())
+	scorers := make([]sc.InitableScorer, len(names))
+	for i, name := range names {
+		scorers[i] = sc.ParseScorer[name]
 	}
-	return Args{
-		prefix:       *prefix,
-		gtFormat:     format,
-		treeFile:     flag.Arg(0),
-		geneTreeFile: flag.Arg(1),
-		inferOpts:    *inferOpts,
+	return scorers, nil
+}
+
+// Parses comma separated quartet filter thresholds, sorted and without
+// duplicates
+func parseThresholds(list string) ([]float64, error) {
+	thresholds := make([]float64, 0)
+	for field := range strings.SplitSeq(list, ",") {
+		t, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("\"%s\" is not a valid threshold for -threshold-sweep", field)
+		}
+		var thresh pr.Threshold
+		if err := thresh.Set(t); err != nil {
+			return nil, fmt.Errorf("-threshold-sweep: %w", err)
+		}
+		thresholds = append(thresholds, t)
 	}
+	slices.Sort(thresholds)
+	return slices.Compact(thresholds), nil
 }
 
-// prints message, usage, and exits (status code 1)
+// prints message, usage, and exits (status code 2)
 func parserError(message string) {
 	fmt.Fprintln(os.Stderr, message+"\n")
 	Usage(false)
-	os.Exit(1)
+	os.Exit(exitUsage)
 }
 
 func defaultPrefix() string {
@@ -219,65 +875,877 @@ func defaultPrefix() string {
 func main() {
 	var exit int
 	defer func() {
+		if r := recover(); r != nil { // otherwise os.Exit would hide the panic
+			lg.Errorf("%v, this is a bug! please report!\n%s", r, debug.Stack())
+			exit = exitRuntime
+		}
 		os.Exit(exit)
 	}()
-	buf := &bytes.Buffer{} // capture pre logfile setup logging
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-	log.SetOutput(io.MultiWriter(os.Stderr, buf))
-	args := parseArgs()
-	if args.prefix == "" {
-		args.prefix = defaultPrefix()
-		log.Printf("output prefix was not set, using \"%s\"", args.prefix)
-	}
-	if logf, err := os.Create(fmt.Sprintf("%s.log", args.prefix)); err == nil {
-		logf.Write(buf.Bytes()) // nolint
-		log.SetOutput(io.MultiWriter(os.Stderr, logf))
+	cmd, _ := findCommand("infer")
+	arguments := os.Args[1:]
+	if len(arguments) > 0 {
+		if named, ok := findCommand(arguments[0]); ok {
+			cmd, arguments = named, arguments[1:]
+		}
+	}
+	exit = cmd.run(arguments)
+}
+
+// Runs infer with args, setting up logging (buf has the messages logged before
+// the log level was known) and the output files; returns the exit code
+func runInfer(args Args, buf *bytes.Buffer) (exit int) {
+	lg.SetLevel(max(args.consoleLog, args.fileLog, lg.Warn)) // warnings are always counted for -fail-on-warning
+	console := newLogWriter(os.Stderr, args.consoleLog, args.logJSON)
+	writeBufferedLog(buf, console)
+	log.SetOutput(io.MultiWriter(console, buf, &loggedWarnings))
+	if args.dryRun {
+		if err := dryRun(args); err != nil {
+			lg.Errorf("%s", err)
+			exit = exitCode(err)
+		}
+		return
+	}
+	out, err := newOutputLayout(args.outdir, args.prefix)
+	if err != nil {
+		lg.Errorf("%s", err)
+		exit = exitCode(err)
+		return
+	}
+	logPath, _ := out.path(logOutput)
+	var file io.Writer // log file (nil if not logging to a file)
+	if args.fileLog == lg.None {
+		setLogOutput(console, nil)
+	} else if logf, err := os.Create(logPath); err == nil {
+		file = newLogWriter(logf, args.fileLog, args.logJSON)
+		writeBufferedLog(buf, file)
+		setLogOutput(console, file)
+		out.record(logOutput)
 		defer func() {
 			log.SetOutput(os.Stderr)
 			_ = logf.Close()
 		}()
 	} else {
-		log.Printf("failed to create log file %s.log, %s", args.prefix, err) // should continue to log to stderr
+		setLogOutput(console, nil)
+		lg.Infof("failed to create log file %s, %s", logPath, err) // should continue to log to stderr
 	}
-	log.Printf("camus %s", GetVersion())
-	log.Printf("invoked as: camus %s", strings.Join(os.Args[1:], " "))
-	if err := run(args); err != nil {
-		log.Printf("%s %s", ErrorMessage, err)
-		exit = 1
+	lg.Infof("camus %s", GetVersion())
+	lg.Infof("invoked as: camus %s", strings.Join(os.Args[1:], " "))
+	lg.Infof("seed: %d", args.inferOpts.Seed)
+	monitor := tm.Start(args.telemetry)
+	if args.progressBar && !args.logJSON {
+		bar := monitor.ShowBar(os.Stderr, barInterval)
+		setLogOutput(bar.Writer(console), file) // messages go above the bar
 	}
+	if args.progress != "" {
+		if w, err := openProgress(args.progress); err == nil {
+			defer func() { _ = w.Close() }() // after the monitor stops
+			monitor.EmitProgress(w, progressInterval)
+		} else {
+			lg.Warnf("not writing progress events, %s", err)
+		}
+	}
+	defer monitor.Stop()
+	ctx, cancel := runContext(args.timeout)
+	defer cancel()
+	err = timeoutError(run(ctx, args, out), args.timeout)
+	if err == nil {
+		err = checkWarnings(args.failOnWarn) // warnings logged while writing output
+	}
+	if err != nil {
+		lg.Errorf("%s", err)
+		exit = exitCode(err)
+	}
+	return
 }
 
-func run(args Args) error {
-	tre, geneTrees, err := pr.ReadInputFiles(args.treeFile, args.geneTreeFile, args.gtFormat)
+func run(ctx context.Context, args Args, out *outputLayout) error {
+	if args.stream {
+		return runStream(ctx, args, out)
+	}
+	if args.alignments {
+		return runAlignments(ctx, args, out)
+	}
+	endPhase := tm.Phase("reading input")
+	tre, geneTrees, err := readInferInputs(args)
 	if err != nil {
 		return err
 	}
-	results, err := in.Infer(tre, geneTrees.Trees, args.inferOpts)
+	if err = writeSkippedTrees(geneTrees.Skipped, out); err != nil {
+		return err
+	}
+	if err = prepareGeneTrees(args, tre, geneTrees); err != nil {
+		return err
+	}
+	if err = autoRootConstraint(args.autoRoot, tre, geneTrees); err != nil {
+		return err
+	}
+	args.inferOpts.GeneNames = geneTrees.Names
+	if args.inferOpts.Weights = geneTrees.Weights; geneTrees.Weights != nil {
+		lg.Infof("weighting quartets from %d gene trees by %s", len(geneTrees.Weights), args.weightsFile)
+	}
+	var collapsed map[string][]string
+	if args.collapse {
+		if collapsed, err = pr.CollapseIdenticalTaxa(tre, geneTrees); err != nil {
+			return err
+		}
+	}
+	if tre, args.inferOpts.ArtificialClades, err = pr.ResolvePolytomies(tre, geneTrees.Trees, args.polytomies); err != nil {
+		return err
+	}
+	if args.branchesFile != "" {
+		endPhase()
+		return scoreBranches(ctx, args, tre, geneTrees, out)
+	}
+	var parts *pr.Partitions
+	if args.partFile != "" {
+		if parts, err = pr.ReadPartitionFile(args.partFile, geneTrees); err != nil {
+			return err
+		}
+		lg.Infof("read %d partitions", len(parts.Names))
+	}
+	endPhase()
+	results, err := in.Infer(ctx, tre, geneTrees.Trees, args.inferOpts)
+	if err != nil {
+		return err
+	}
+	reticulations, err := writeInferOutput(ctx, results, collapsed, geneTrees.Trees, args, out)
 	if err != nil {
 		return err
 	}
-	newicks := make([]string, len(results.Branches))
-	for i, branches := range results.Branches {
-		newicks[i] = gr.MakeNetwork(results.Tree, branches).Newick()
+	if args.influence {
+		influences, err := in.Influence(ctx, tre, geneTrees.Trees, geneTrees.Names, args.inferOpts, results)
+		if err != nil {
+			return err
+		}
+		err = out.write(influenceOutput, func(w io.Writer) error {
+			return pr.WriteInfluenceToCSV(influences, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if k := len(results.Branches); args.jackknife > 0 && k > 0 {
+		summaries, err := in.Jackknife(results.Tree, reticulations[k-1], geneTrees.Names, args.jackknife, args.inferOpts)
+		if err != nil {
+			return err
+		}
+		err = out.write(jackknifeOutput, func(w io.Writer) error {
+			return pr.WriteJackknifeToCSV(summaries, w)
+		})
+		if err != nil {
+			return err
+		}
 	}
-	if err = pr.WriteDPResultsToCSV(results.Tree, newicks, results.QSatScore, os.Stdout); err != nil {
+	if args.nullReps > 0 {
+		gains, err := in.NullCalibration(ctx, tre, geneTrees.Trees, args.inferOpts, args.nullReps, results)
+		if err != nil {
+			return err
+		}
+		err = out.write(nullOutput, func(w io.Writer) error {
+			return pr.WriteNullGainsToCSV(gains, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if k := len(results.Branches); parts != nil && k > 0 {
+		summaries, err := in.PartitionSupport(ctx, results.Tree, reticulations[k-1], geneTrees.Trees, parts)
+		if err != nil {
+			return err
+		}
+		err = out.write(partitionsOutput, func(w io.Writer) error {
+			return pr.WritePartitionSupportToCSV(results.Tree, reticulations[k-1], parts, summaries, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if k := len(results.Branches); args.embedding && k > in.MaxEmbeddingReticulations {
+		lg.Warnf("not writing gene tree embedding, the largest network has %d reticulations and it is limited to %d", k, in.MaxEmbeddingReticulations)
+	} else if args.embedding {
+		var labeled map[string]gr.Branch // backbone only if there are no reticulations
+		if k > 0 {
+			labeled = reticulations[k-1]
+		}
+		emb, err := in.Embedding(ctx, results.Tree, labeled, geneTrees.Trees, args.inferOpts.DPProcs)
+		if err != nil {
+			return err
+		}
+		err = out.write(embeddingOutput, func(w io.Writer) error {
+			return pr.WriteEmbeddingToCSV(emb, geneTrees.Names, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if k := len(results.Branches); args.geneContribs && k > 0 {
+		contribs, err := in.GeneContributions(ctx, results.Tree, reticulations[k-1], geneTrees.Trees, args.inferOpts.DPProcs)
+		if err != nil {
+			return err
+		}
+		err = out.write(geneContribsOutput, func(w io.Writer) error {
+			return pr.WriteGeneContributionsToCSV(contribs, geneTrees.Names, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if args.concordance {
+		concordance, err := in.Concordance(ctx, results.Tree, geneTrees.Trees, args.inferOpts.DPProcs)
+		if err != nil {
+			return err
+		}
+		err = out.write(concordanceOutput, func(w io.Writer) error {
+			return pr.WriteConcordanceToCSV(results.Tree, concordance, w)
+		})
+		if err != nil {
+			return err
+		}
+		if args.concNewick {
+			err = out.write(concNewickOutput, func(w io.Writer) error {
+				return pr.WriteConcordanceNewick(results.Tree, concordance, w)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if k := len(results.Branches); args.bootstrap > 0 && k > 0 {
+		support, err := in.Bootstrap(ctx, tre, geneTrees.Trees, parts, args.bootstrap, args.balanceParts, args.inferOpts, results)
+		if err != nil {
+			return err
+		}
+		err = out.write(bootstrapOutput, func(w io.Writer) error {
+			return pr.WriteBootstrapSupportToCSV(results.Tree, results.Branches[k-1], reticulations[k-1], support, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return finishRun(results, geneTrees.All(), out, args)
+}
+
+// Reads the constraint tree and gene trees (with weights, and skipping invalid
+// gene trees if set)
+func readInferInputs(args Args) (*tree.Tree, *pr.GeneTrees, error) {
+	opts := []pr.InputOption{pr.WithWeights(args.weightsFile)}
+	if args.skipInvalid {
+		opts = append(opts, pr.SkipInvalidTrees())
+	}
+	return pr.ReadInputFiles(args.treeFile, args.geneTreeFile, args.gtFormat, opts...)
+}
+
+// Logs a warning for gene trees skipped with -skip-invalid-trees and lists
+// them in the invalid trees output
+func writeSkippedTrees(skipped []pr.SkippedTree, out *outputLayout) error {
+	if len(skipped) == 0 {
+		return nil
+	}
+	err := out.write(invalidTreesOutput, func(w io.Writer) error {
+		return pr.WriteSkippedTreesToCSV(skipped, w)
+	})
+	if err != nil {
 		return err
 	}
-	f, err := os.Create(fmt.Sprintf("%s.csv", args.prefix))
+	path, _ := out.path(invalidTreesOutput)
+	lg.Warnf("skipped %d gene trees that could not be read (first is gene tree %s: %s), see %s",
+		len(skipped), skipped[0].Name, skipped[0].Err, path)
+	return nil
+}
+
+// Context for a run that is cancelled after timeout (never if timeout is 0)
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// Time between progress events written with -progress
+const progressInterval = time.Second
+
+// Time between redraws of the -progress-bar bar
+const barInterval = 200 * time.Millisecond
+
+// Sends log messages to console and file (if not nil), counting warnings for
+// -fail-on-warning
+func setLogOutput(console, file io.Writer) {
+	if file == nil {
+		log.SetOutput(io.MultiWriter(console, &loggedWarnings))
+		return
+	}
+	log.SetOutput(io.MultiWriter(console, file, &loggedWarnings))
+}
+
+// Opens path for progress events, connecting to it if it is a unix socket and
+// appending to it otherwise (opening a FIFO waits for a reader)
+func openProgress(path string) (io.WriteCloser, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		return net.Dial("unix", path)
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+}
+
+// Adds the time limit to errors from running out of time
+func timeoutError(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("did not finish within -timeout %s: %w", timeout, err)
+	}
+	return err
+}
+
+// Runs infer reading gene trees from a stream (-stream), which only allows
+// options that don't need every gene tree in memory
+func runStream(ctx context.Context, args Args, out *outputLayout) error {
+	endPhase := tm.Phase("reading input")
+	tre, stream, err := pr.ReadStreamInputFiles(args.treeFile, args.geneTreeFile, args.gtFormat, pr.WithWeights(args.weightsFile))
 	if err != nil {
 		return err
 	}
-	defer func() {
-		closeErr := f.Close()
-		if closeErr != nil {
-			log.Printf("error closing %s.csv, %s", args.prefix, closeErr)
+	if args.inferOpts.Weights = stream.Weights; stream.Weights != nil {
+		lg.Infof("weighting quartets from %d gene trees by %s", len(stream.Weights), args.weightsFile)
+	}
+	if tre, args.inferOpts.ArtificialClades, err = pr.ResolvePolytomies(tre, nil, args.polytomies); err != nil {
+		return err
+	}
+	endPhase()
+	lg.Infof("streaming gene trees from %s", args.geneTreeFile)
+	results, err := in.InferStream(ctx, tre, stream, args.inferOpts)
+	if err != nil {
+		return err
+	}
+	if _, err = writeInferOutput(ctx, results, nil, nil, args, out); err != nil {
+		return err
+	}
+	return finishRun(results, stream.All(), out, args)
+}
+
+// Runs infer on quartets inferred from alignments (-alignments) instead of gene
+// trees, which only allows options that don't need gene trees
+func runAlignments(ctx context.Context, args Args, out *outputLayout) error {
+	endPhase := tm.Phase("reading input")
+	tre, alns, weights, err := pr.ReadAlignmentInputs(args.treeFile, args.geneTreeFile, args.weightsFile)
+	if err != nil {
+		return err
+	}
+	lg.Infof("read %d alignments from %s", len(alns), args.geneTreeFile)
+	args.inferOpts.GeneNames = pr.AlignmentNames(alns)
+	if args.inferOpts.Weights = weights; weights != nil {
+		lg.Infof("weighting quartets from %d alignments by %s", len(weights), args.weightsFile)
+	}
+	if tre, args.inferOpts.ArtificialClades, err = pr.ResolvePolytomies(tre, nil, args.polytomies); err != nil {
+		return err
+	}
+	endPhase()
+	results, err := in.InferAlignments(ctx, tre, alns, args.inferOpts)
+	if err != nil {
+		return err
+	}
+	if _, err = writeInferOutput(ctx, results, nil, nil, args, out); err != nil {
+		return err
+	}
+	return finishRun(results, nil, out, args)
+}
+
+// Writes the optimal networks and the outputs that only need the results (the
+// gene trees are only used for -gamma, and may be nil otherwise), returning
+// the labeled reticulations of each network
+func writeInferOutput(ctx context.Context, results *in.DPResults, collapsed map[string][]string, geneTrees []*tree.Tree, args Args, out *outputLayout) ([]map[string]gr.Branch, error) {
+	warnFilteredFraction(results.FilterStats, args.maxFiltered)
+	if err := checkWarnings(args.failOnWarn); err != nil {
+		return nil, err
+	}
+	defer tm.Phase("writing output")()
+	reticulations := gr.StableReticulationLabels(results.Branches, args.retLabels)
+	newicks := make([]string, len(reticulations))
+	networks := make([]*gr.Network, len(reticulations))
+	for i, labeled := range reticulations {
+		ntw := gr.MakeLabeledNetwork(results.Tree, labeled)
+		if args.gamma {
+			var err error
+			if ntw.Gamma, err = in.InheritanceProbabilities(ctx, results.Tree, labeled, geneTrees); err != nil {
+				return nil, err
+			}
 		}
-	}()
-	if err = pr.WriteDPResultsToCSV(results.Tree, newicks, results.QSatScore, f); err != nil {
+		pr.ExpandCollapsedTaxa(ntw.NetTree, collapsed)
+		newicks[i], networks[i] = ntw.Newick(), ntw
+	}
+	constTree := results.Tree.Clone()
+	pr.ExpandCollapsedTaxa(&constTree.Tree, collapsed)
+	constNewick := constTree.Newick()
+	resultsKind, writeResults := resultsOutput, func(w io.Writer) error {
+		return pr.WriteDPResultsToCSV(constNewick, newicks, results.QSatScore, results.RawScores, w)
+	}
+	switch args.outFormat {
+	case outFormatJSON:
+		meta := runMetadata(args)
+		resultsKind, writeResults = resultsJSONOutput, func(w io.Writer) error {
+			return pr.WriteDPResultsToJSON(meta, constNewick, newicks, results.QSatScore, results.RawScores, reticulations, results.EdgeScores, w)
+		}
+	case outFormatNexus:
+		resultsKind, writeResults = resultsNexusOutput, func(w io.Writer) error {
+			return pr.WriteNetworksNexus(&constTree.Tree, networks, results.QSatScore, results.RawScores, w)
+		}
+	case outFormatPhyloXML:
+		resultsKind, writeResults = resultsPhyloXMLOutput, func(w io.Writer) error {
+			return pr.WriteNetworksPhyloXML(&constTree.Tree, networks, results.QSatScore, results.RawScores, w)
+		}
+	}
+	if err := writeResults(os.Stdout); err != nil {
+		return nil, err
+	}
+	err := out.write(resultsKind, writeResults)
+	if err != nil {
+		return nil, err
+	}
+	err = out.write(networksOutput, func(w io.Writer) error {
+		return pr.WriteNewicks(newicks, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = out.write(reticulationsOutput, func(w io.Writer) error {
+		return pr.WriteReticulationLabelsToCSV(results.Tree, reticulations, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = out.write(bipartitionsOutput, func(w io.Writer) error {
+		return pr.WriteReticulationBipartitionsToCSV(results.Tree, reticulations, collapsed, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if results.MinorFreqs != nil {
+		err = out.write(minorFreqOutput, func(w io.Writer) error {
+			return pr.WriteMinorFrequenciesToCSV(reticulations, results.MinorFreqs, w)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k := len(results.Branches); results.Sweep != nil && k > 0 {
+		stable := 0
+		for _, sweep := range results.Sweep {
+			if sweep.Supported() == len(args.inferOpts.ThresholdSweep) {
+				stable++
+			}
+		}
+		lg.Infof("%d of %d reticulations of the largest network satisfy quartets at every threshold of the sweep", stable, len(results.Sweep))
+		err = out.write(sweepOutput, func(w io.Writer) error {
+			return pr.WriteThresholdSweepToCSV(results.Tree, args.inferOpts.ThresholdSweep, results.Sweep, reticulations[k-1], w)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k := len(results.Branches); results.Candidates != nil && k > 0 {
+		if err = writeConservativeNetwork(results, collapsed, reticulations[k-1], out); err != nil {
+			return nil, err
+		}
+	}
+	if len(results.CoOptimal) > 0 {
+		if err = writeCoOptimalNetworks(results, collapsed, args, out); err != nil {
+			return nil, err
+		}
+	}
+	if results.NearOptimal != nil {
+		if err = writeNearOptimalNetworks(results, collapsed, args, out); err != nil {
+			return nil, err
+		}
+	}
+	if plotPath, ok := out.path(plotOutput); ok {
+		if err = pr.WriteResultsLineplot(results.QSatScore, plotPath); err != nil {
+			return nil, err
+		}
+		out.record(plotOutput)
+	}
+	err = out.write(kStatsOutput, func(w io.Writer) error {
+		return pr.WriteKStatsToCSV(results.KStats, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if collapsed != nil {
+		err = out.write(collapsedOutput, func(w io.Writer) error {
+			return pr.WriteCollapsedTaxaToCSV(collapsed, w)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if stats := results.FilterStats; stats != nil {
+		err = out.write(filterFreqOutput, func(w io.Writer) error {
+			return pr.WriteFilterFrequenciesToCSV(stats, w)
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = out.write(filterTaxaOutput, func(w io.Writer) error {
+			return pr.WriteFilterTaxaToCSV(stats, &results.Tree.Tree, w)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if results.Modes != nil {
+		if err = writeModeComparison(results, collapsed, args.retLabels, out); err != nil {
+			return nil, err
+		}
+	}
+	if results.Alternatives != nil {
+		err = out.write(alternativesOutput, func(w io.Writer) error {
+			return pr.WriteAlternativesToCSV(results.Tree, results.Alternatives, reticulations, w)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k := len(results.Branches); args.overlaps && k > 0 {
+		err = out.write(overlapsOutput, func(w io.Writer) error {
+			return pr.WriteOverlapsToCSV(results.Tree, results.Overlaps, reticulations[k-1], w)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k := len(results.Branches); results.Exclusion != nil {
+		err = out.write(exclusionOutput, func(w io.Writer) error {
+			return pr.WriteExclusionSupportToCSV(results.Tree, results.Branches[k-1], reticulations[k-1], results.Scores[k-1], results.Exclusion, w)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if args.qChanges {
+		if err = writeQuartetChanges(results, out); err != nil {
+			return nil, err
+		}
+	}
+	return reticulations, nil
+}
+
+// Writes the largest network without its candidate reticulations (see
+// -candidate-threshold), which are recorded as annotations on the backbone,
+// and the list of candidates
+func writeConservativeNetwork(results *in.DPResults, collapsed map[string][]string, labeled map[string]gr.Branch, out *outputLayout) error {
+	weak := make(map[gr.Branch]bool, len(results.Candidates))
+	for _, c := range results.Candidates {
+		weak[c.Branch] = true
+	}
+	kept, candidates := make(map[string]gr.Branch), make(map[string]gr.Branch)
+	for label, br := range labeled {
+		if weak[br] {
+			candidates[label] = br
+		} else {
+			kept[label] = br
+		}
+	}
+	ntw := gr.MakeLabeledNetwork(results.Tree, kept)
+	ntw.AnnotateCandidates(candidates)
+	pr.ExpandCollapsedTaxa(ntw.NetTree, collapsed)
+	err := out.write(conservativeOutput, func(w io.Writer) error {
+		return pr.WriteNewicks([]string{ntw.Newick()}, w)
+	})
+	if err != nil {
+		return err
+	}
+	return out.write(candidatesOutput, func(w io.Writer) error {
+		return pr.WriteCandidatesToCSV(results.Tree, results.Candidates, labeled, w)
+	})
+}
+
+// Writes every co-optimal network with the largest number of edges (see
+// -co-optimal), labeled so reticulations shared with the optimal networks keep
+// their labels
+func writeCoOptimalNetworks(results *in.DPResults, collapsed map[string][]string, args Args, out *outputLayout) error {
+	labeled := gr.StableReticulationLabels(append(slices.Clone(results.Branches), results.CoOptimal...), args.retLabels)
+	labeled = labeled[len(results.Branches):]
+	newicks := make([]string, len(labeled))
+	for i, l := range labeled {
+		ntw := gr.MakeLabeledNetwork(results.Tree, l)
+		pr.ExpandCollapsedTaxa(ntw.NetTree, collapsed)
+		newicks[i] = ntw.Newick()
+	}
+	return out.write(coOptimalOutput, func(w io.Writer) error {
+		return pr.WriteNewicks(newicks, w)
+	})
+}
+
+// Writes the networks within -within percent of each optimal network, labeled
+// so reticulations shared with the optimal networks keep their labels
+func writeNearOptimalNetworks(results *in.DPResults, collapsed map[string][]string, args Args, out *outputLayout) error {
+	newicks := make([][]string, len(results.NearOptimal))
+	for k, networks := range results.NearOptimal {
+		sets := make([][]gr.Branch, len(networks))
+		for i, n := range networks {
+			sets[i] = n.Branches
+		}
+		labeled := gr.StableReticulationLabels(append(slices.Clone(results.Branches), sets...), args.retLabels)
+		for _, l := range labeled[len(results.Branches):] {
+			ntw := gr.MakeLabeledNetwork(results.Tree, l)
+			pr.ExpandCollapsedTaxa(ntw.NetTree, collapsed)
+			newicks[k] = append(newicks[k], ntw.Newick())
+		}
+	}
+	return out.write(nearOptimalOutput, func(w io.Writer) error {
+		return pr.WriteNearOptimalToCSV(results.NearOptimal, newicks, w)
+	})
+}
+
+// Writes the manifest and prints the end of run summary
+func finishRun(results *in.DPResults, geneTrees iter.Seq2[*tree.Tree, error], out *outputLayout, args Args) error {
+	if err := out.writeManifest(args.inferOpts.Seed); err != nil {
+		return err
+	}
+	if args.consoleLog == lg.None || args.logJSON { // the summary is not json
+		return nil
+	}
+	return printRunSummary(results, geneTrees, out, args)
+}
+
+// Number of gene trees held in memory at once when counting supporting genes
+const summaryBatchSize = 1024
+
+// Prints summary of the optimal networks and output files to stderr. Gene trees
+// are read in batches, so a stream of gene trees is never all in memory, and
+// supporting genes are left out if geneTrees is nil (e.g., with -alignments).
+func printRunSummary(results *in.DPResults, geneTrees iter.Seq2[*tree.Tree, error], out *outputLayout, args Args) error {
+	supporting := make([]int, len(results.Branches))
+	nGenes := 0
+	if geneTrees == nil {
+		geneTrees = func(func(*tree.Tree, error) bool) {}
+	}
+	batch := make([]*tree.Tree, 0, summaryBatchSize)
+	countBatch := func() error {
+		counts, err := sc.SupportingGenes(results.Tree, results.Branches, batch, args.inferOpts.DPProcs)
+		if err != nil {
+			return err
+		}
+		for i, c := range counts {
+			supporting[i] += c
+		}
+		nGenes += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for gt, err := range geneTrees {
+		if err != nil {
+			return err
+		}
+		if err := gt.UpdateTipIndex(); err != nil { // trees read again from a stream are not indexed yet
+			if args.inferOpts.MulTrees == pr.MulError {
+				return fmt.Errorf("gene tree %w", pr.ErrMulTree)
+			}
+			// supporting genes are counted on one copy of each taxon
+			if _, err := pr.CollapseDuplicateTaxa([]*tree.Tree{gt}); err != nil {
+				return err
+			}
+		}
+		if batch = append(batch, gt); len(batch) == summaryBatchSize {
+			if err := countBatch(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := countBatch(); err != nil {
+		return err
+	}
+	rows := make([]summaryRow, len(results.Branches))
+	for i := range rows {
+		rows[i] = summaryRow{k: i + 1, score: results.Scores[i], qSat: results.QSatScore[i], supporting: supporting[i]}
+	}
+	return writeRunSummary(os.Stderr, rows, nGenes, out.paths(), args.color)
+}
+
+// Applies the -mul-trees collapse, -restrict, and -as-unrooted flags of args to
+// the inputs
+func prepareGeneTrees(args Args, tre *tree.Tree, geneTrees *pr.GeneTrees) error {
+	if args.inferOpts.MulTrees == pr.MulCollapse {
+		n, err := pr.CollapseDuplicateTaxa(geneTrees.Trees)
+		if err != nil {
+			return err
+		}
+		if n != 0 {
+			lg.Infof("kept only the first copy of each taxon in %d gene trees with more than one copy of a taxon", n)
+		}
+	}
+	if err := restrictInputs(args.restrictFile, tre, geneTrees); err != nil {
 		return err
 	}
-	if err = pr.WriteResultsLineplot(results.QSatScore, args.prefix); err != nil {
+	setGeneTreeRooting(args.asUnrooted, geneTrees.Trees)
+	return nil
+}
+
+// Prunes tree and gene trees to the taxa in restrictFile (if set)
+func restrictInputs(restrictFile string, tre *tree.Tree, geneTrees *pr.GeneTrees) error {
+	if restrictFile == "" {
+		return nil
+	}
+	taxa, err := pr.ReadTaxaFile(restrictFile)
+	if err != nil {
 		return err
 	}
+	return pr.RestrictTaxa(tre, geneTrees, taxa)
+}
+
+// Writes the networks found with each compared score mode to the modes csv and
+// their quartets satisfied to the modes plot
+func writeModeComparison(results *in.DPResults, collapsed map[string][]string, retLabels gr.RetLabeling, out *outputLayout) error {
+	newicks := make([][]string, len(results.Modes))
+	for i, m := range results.Modes {
+		for _, labeled := range gr.StableReticulationLabels(m.Branches, retLabels) {
+			ntw := gr.MakeLabeledNetwork(results.Tree, labeled)
+			pr.ExpandCollapsedTaxa(ntw.NetTree, collapsed)
+			newicks[i] = append(newicks[i], ntw.Newick())
+		}
+		lg.Infof("score mode %s found networks with up to %d edges", m.Mode, len(m.Branches))
+	}
+	err := out.write(modesOutput, func(w io.Writer) error {
+		return pr.WriteModeComparisonToCSV(results.Modes, newicks, w)
+	})
+	if err != nil {
+		return err
+	}
+	if plotPath, ok := out.path(modesPlotOutput); ok {
+		if err = pr.WriteModesLineplot(results.Modes, plotPath); err != nil {
+			return err
+		}
+		out.record(modesPlotOutput)
+	}
 	return nil
 }
+
+// Scores the branches in the branches file on the constraint tree, writing
+// csv to stdout and the branch scores output
+func scoreBranches(ctx context.Context, args Args, tre *tree.Tree, geneTrees *pr.GeneTrees, out *outputLayout) error {
+	clades, err := pr.ReadBranchesFile(args.branchesFile)
+	if err != nil {
+		return err
+	}
+	td, scores, err := in.ScoreBranchSet(ctx, tre, geneTrees.Trees, clades, args.inferOpts)
+	if err != nil {
+		return err
+	}
+	if err = checkWarnings(args.failOnWarn); err != nil {
+		return err
+	}
+	defer tm.Phase("writing output")()
+	labeled := make(map[string]gr.Branch, len(scores))
+	for i, bs := range scores {
+		labeled[args.retLabels.Label(i)] = bs.Branch
+	}
+	lg.Infof("network with the given branches: %s", gr.MakeLabeledNetwork(td, labeled).Newick())
+	if err = pr.WriteBranchScoresToCSV(td, scores, args.retLabels, os.Stdout); err != nil {
+		return err
+	}
+	err = out.write(branchScoresOutput, func(w io.Writer) error {
+		return pr.WriteBranchScoresToCSV(td, scores, args.retLabels, w)
+	})
+	if err != nil {
+		return err
+	}
+	return out.writeManifest(args.inferOpts.Seed)
+}
+
+// Unroots gene trees if they are treated as unrooted; otherwise rooted gene
+// trees keep their root (quartets are read from unrooted copies)
+func setGeneTreeRooting(asUnrooted bool, geneTrees []*tree.Tree) {
+	if asUnrooted {
+		lg.Infof("treating gene trees as unrooted; removed the root of %d gene trees", pr.UnrootGeneTrees(geneTrees))
+		return
+	}
+	rooted := 0
+	for _, gt := range geneTrees {
+		if gt.Rooted() {
+			rooted++
+		}
+	}
+	if rooted != 0 {
+		lg.Infof("%d of %d gene trees are rooted and keep their root (quartets do not depend on it); use -as-unrooted to unroot them",
+			rooted, len(geneTrees))
+	}
+}
+
+// Roots an unrooted constraint tree in place where the rooted gene trees
+// suggest (see pr.AutoRoot) if autoRoot is set
+func autoRootConstraint(autoRoot bool, tre *tree.Tree, geneTrees *pr.GeneTrees) error {
+	if tre.RemoveSingleNodes(); !autoRoot || tre.Rooted() {
+		return nil
+	}
+	best, err := pr.AutoRoot(tre, geneTrees.Trees, geneTrees.Weights)
+	if err != nil {
+		return err
+	}
+	lg.Infof("rooted the constraint tree on {%s}, which the root split of %g of %g rooted gene trees agrees with",
+		strings.Join(best.Outgroup, ","), best.Agree, best.Informative)
+	return nil
+}
+
+// Parses inputs and prints resource estimate to stdout
+func dryRun(args Args) error {
+	tre, geneTrees, err := readInferInputs(args)
+	if err != nil {
+		return err
+	}
+	if err = prepareGeneTrees(args, tre, geneTrees); err != nil {
+		return err
+	}
+	if err = autoRootConstraint(args.autoRoot, tre, geneTrees); err != nil {
+		return err
+	}
+	if args.collapse {
+		if _, err = pr.CollapseIdenticalTaxa(tre, geneTrees); err != nil {
+			return err
+		}
+	}
+	if tre, _, err = pr.ResolvePolytomies(tre, geneTrees.Trees, args.polytomies); err != nil {
+		return err
+	}
+	est, err := in.EstimateResources(tre, geneTrees.Trees, args.inferOpts)
+	if err != nil {
+		return err
+	}
+	if err = checkWarnings(args.failOnWarn); err != nil {
+		return err
+	}
+	return est.Write(os.Stdout)
+}
+
+// Returns an error if -fail-on-warning is set and any warnings have been
+// logged
+func checkWarnings(failOnWarn bool) error {
+	if n := loggedWarnings.count(); failOnWarn && n > 0 {
+		return fmt.Errorf("%w (%d logged)", errWarnings, n)
+	}
+	return nil
+}
+
+// Logs a warning if the quartet filter removed more than maxFiltered of the
+// unique quartets
+func warnFilteredFraction(stats *pr.FilterStats, maxFiltered float64) {
+	if stats == nil || stats.QuartetsBefore == 0 {
+		return
+	}
+	if frac := float64(stats.QuartetsRemoved) / float64(stats.QuartetsBefore); frac > maxFiltered {
+		lg.Warnf("quartet filter removed %.2f%% of unique quartets (more than -max-filtered %g)",
+			100*frac, maxFiltered)
+	}
+}
+
+// Logs summary of quartets gained/lost between consecutive networks and writes
+// the full lists to the quartet changes csv
+func writeQuartetChanges(results *in.DPResults, out *outputLayout) error {
+	changes := in.CalcQuartetChanges(results)
+	gained, lost := make([][]gr.Quartet, len(changes)), make([][]gr.Quartet, len(changes))
+	for i, change := range changes {
+		gainedCount, lostCount := change.Counts(results.Tree)
+		lg.Infof("%d -> %d edges: %d quartet topologies gained (%d quartets), %d lost (%d quartets)",
+			change.K-1, change.K, len(change.Gained), gainedCount, len(change.Lost), lostCount)
+		gained[i], lost[i] = change.Gained, change.Lost
+	}
+	return out.write(qChangesOutput, func(w io.Writer) error {
+		return pr.WriteQuartetChangesToCSV(results.Tree, gained, lost, w)
+	})
+}
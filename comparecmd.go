@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+type CompareArgs struct {
+	networkFiles [2]string // level-1 networks in extended newick format or infer results csvs
+	k            int       // number of reticulations of networks to use from results csvs
+}
+
+func compareUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus compare [flags]... <network_file> <network_file>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <network_file>\tlevel-1 network in extended newick format, or results csv from infer\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus compare true-network.nwk network.nwk > distances.csv\n",
+		"\tcamus compare -k 2 true-network.nwk infer-results.csv > distances.csv\n\n",
+	)
+}
+
+func parseCompareArgs(arguments []string) CompareArgs {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		compareUsage(fs)
+	}
+	build := compareFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the compare flags on fs, returning a function that checks them once
+// they are parsed and makes the CompareArgs
+func compareFlags(fs *flag.FlagSet) func() CompareArgs {
+	k := fs.Int("k", -1, "number of reticulations of the networks to compare when reading a results csv (default largest)")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() CompareArgs {
+		if *help {
+			compareUsage(fs)
+			os.Exit(0)
+		}
+		if fs.NArg() != 2 {
+			fmt.Fprint(os.Stderr, "two positional arguments required: <network_file> <network_file>\n\n") // nolint
+			compareUsage(fs)
+			os.Exit(exitUsage)
+		}
+		return CompareArgs{
+			networkFiles: [2]string{fs.Arg(0), fs.Arg(1)},
+			k:            *k,
+		}
+	}
+}
+
+// Compares the topology of two networks, writing csv to stdout
+func runCompare(args CompareArgs) error {
+	var networks [2]*gr.Network
+	for i, file := range args.networkFiles {
+		ntw, err := readNetwork(file, args.k)
+		if err != nil {
+			return err
+		}
+		networks[i] = ntw
+	}
+	cmp, err := gr.CompareNetworks(networks[0], networks[1])
+	if err != nil {
+		return err
+	}
+	return pr.WriteNetworkComparisonToCSV(cmp, os.Stdout)
+}
+
+// Reads network from extended (or rich) newick file or infer results csv (if
+// the file ends in .csv)
+func readNetwork(networkFile string, k int) (*gr.Network, error) {
+	tre, err := pr.ReadNetworkFile(networkFile, k)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(networkFile), ".csv") {
+		rooted, err := pr.NormalizeRichNewick(tre)
+		if err != nil {
+			return nil, err
+		}
+		if rooted {
+			lg.Infof("%s was unrooted; rooted it on the edge above the first child of its root", networkFile)
+		}
+		n, err := pr.NormalizeHybridCopies(tre)
+		if err != nil {
+			return nil, err
+		}
+		if n != 0 {
+			lg.Infof("rewrote %d hybrid nodes written as two copies of the same clade in %s", n, networkFile)
+		}
+	}
+	return networkFromTree(tre, networkFile)
+}
+
+// Converts tre read from networkFile to a network, which may have no
+// reticulations
+func networkFromTree(tre *tree.Tree, networkFile string) (*gr.Network, error) {
+	ntw, err := pr.ConvertToNetwork(tre)
+	if errors.Is(err, pr.ErrNoReticulations) { // compared as a network with no reticulations
+		return &gr.Network{NetTree: tre, Reticulations: make(map[string]gr.Branch)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", networkFile, err)
+	}
+	return ntw, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	in "github.com/jsdoublel/camus/internal/infer"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// Flags taking a path whose usage does not name the value `file` or `dir`
+var pathFlags = []string{"o", "outdir", "partitions"}
+
+// Flag as it is offered by completion scripts
+type completionFlag struct {
+	name        string
+	description string
+	takesValue  bool
+	choices     []string // possible values (nil if any value)
+	file        bool     // value is a file or directory
+}
+
+// Possible values of flags with a fixed set of choices
+func flagChoices() map[string][]string {
+	scorers := slices.Sorted(maps.Keys(sc.ParseScorer))
+	levels := slices.Sorted(maps.Keys(lg.ParseLevel))
+	qModes := make([]string, len(pr.QModeDescriptions))
+	for mode := range qModes {
+		qModes[mode] = fmt.Sprint(mode)
+	}
+	return map[string][]string{
+		"f":                   slices.Sorted(maps.Keys(pr.ParseFormat)),
+		"alignment-method":    slices.Sorted(maps.Keys(pr.ParseSeqMethod)),
+		"sm":                  scorers,
+		"compare-modes":       scorers,
+		"count-mode":          {"raw", "set", "length"},
+		"constraint-quartets": {"drop", "keep"},
+		"q":                   qModes,
+		"log-console":         levels,
+		"log-file":            levels,
+		"verbosity":           levels,
+		"mul-trees":           {"error", "collapse", "copies"},
+		"tie-break":           slices.Sorted(maps.Keys(in.ParseTieBreak)),
+		"color":               {colorAuto, colorAlways, colorNever},
+		"out-format":          outFormats,
+		"penalty-scale":       slices.Sorted(maps.Keys(sc.ParsePenaltyScale)),
+		"resolve-polytomies":  slices.Sorted(maps.Keys(pr.ParsePolytomyMode)),
+		"to":                  graphFormats(),
+	}
+}
+
+// Flags of cmd (in alphabetical order)
+func completionFlags(cmd command) []completionFlag {
+	if cmd.flags == nil {
+		return nil
+	}
+	choices := flagChoices()
+	flags := make([]completionFlag, 0)
+	cmd.flags().VisitAll(func(f *flag.Flag) {
+		valueName, usage := flag.UnquoteUsage(f)
+		usage, _, _ = strings.Cut(usage, ";")
+		usage, _, _ = strings.Cut(usage, " [")
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:        f.Name,
+			description: usage,
+			takesValue:  !ok || !boolFlag.IsBoolFlag(),
+			choices:     choices[f.Name],
+			file:        valueName == "file" || valueName == "dir" || slices.Contains(pathFlags, f.Name),
+		})
+	})
+	return flags
+}
+
+// Arguments completed after `camus help` and `camus completion`
+func commandArgChoices(name string) []string {
+	switch name {
+	case "help":
+		names := commandNames()
+		for _, topic := range helpTopics() {
+			names = append(names, topic.name)
+		}
+		return names
+	case "completion":
+		return completionShells
+	}
+	return nil
+}
+
+// Runs `camus completion <shell>`, writing the completion script to stdout
+func runCompletion(arguments []string) error {
+	if len(arguments) != 1 || !slices.Contains(completionShells, arguments[0]) {
+		fmt.Fprintf(os.Stderr, "usage: camus completion <%s>\n", strings.Join(completionShells, "|")) // nolint
+		os.Exit(exitUsage)
+	}
+	return writeCompletion(os.Stdout, arguments[0])
+}
+
+func writeCompletion(w io.Writer, shell string) error {
+	var b strings.Builder
+	switch shell {
+	case "bash":
+		bashCompletion(&b)
+	case "zsh":
+		zshCompletion(&b)
+	case "fish":
+		fishCompletion(&b)
+	default:
+		panic(fmt.Sprintf("unsupported shell %s", shell))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+func bashCompletion(b *strings.Builder) {
+	names := strings.Join(commandNames(), " ")
+	b.WriteString("# bash completion for camus; load with: source <(camus completion bash)\n")
+	b.WriteString("_camus() {\n")
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" cmd=infer flags\n")
+	fmt.Fprintf(b, "\tcase \"${COMP_WORDS[1]}\" in\n\t%s) cmd=\"${COMP_WORDS[1]}\" ;;\n\tesac\n", strings.ReplaceAll(names, " ", "|"))
+	b.WriteString("\tif [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	fmt.Fprintf(b, "\t\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\") $(compgen -f -- \"$cur\"))\n\t\treturn\n\tfi\n", names)
+	b.WriteString("\tcase \"$cmd\" in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(b, "\t%s)\n", cmd.name)
+		if args := commandArgChoices(cmd.name); args != nil {
+			fmt.Fprintf(b, "\t\tCOMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n\t\treturn\n\t\t;;\n", strings.Join(args, " "))
+			continue
+		}
+		flags := completionFlags(cmd)
+		b.WriteString("\t\tcase \"$prev\" in\n")
+		for _, f := range flags {
+			switch {
+			case f.choices != nil:
+				fmt.Fprintf(b, "\t\t-%s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return ;;\n", f.name, strings.Join(f.choices, " "))
+			case f.file:
+				fmt.Fprintf(b, "\t\t-%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", f.name)
+			case f.takesValue:
+				fmt.Fprintf(b, "\t\t-%s) COMPREPLY=(); return ;;\n", f.name)
+			}
+		}
+		b.WriteString("\t\tesac\n")
+		flagNames := make([]string, len(flags))
+		for i, f := range flags {
+			flagNames[i] = "-" + f.name
+		}
+		fmt.Fprintf(b, "\t\tflags=\"%s\"\n\t\t;;\n", strings.Join(flagNames, " "))
+	}
+	b.WriteString("\tesac\n")
+	b.WriteString("\tif [[ $cur == -* ]]; then\n\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n\telse\n\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n\tfi\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o filenames -F _camus camus\n")
+}
+
+func zshCompletion(b *strings.Builder) {
+	quote := func(s string) string {
+		s = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `(`, `\(`, `)`, `\)`, `:`, `\:`).Replace(s)
+		return strings.ReplaceAll(s, "'", `'\''`)
+	}
+	b.WriteString("#compdef camus\n")
+	b.WriteString("# zsh completion for camus; load with: source <(camus completion zsh)\n")
+	b.WriteString("_camus() {\n")
+	b.WriteString("\tlocal cmd=infer\n")
+	fmt.Fprintf(b, "\tcase $words[2] in\n\t%s)\n\t\tcmd=$words[2]\n\t\tshift words\n\t\t(( CURRENT-- ))\n\t\t;;\n", strings.Join(commandNames(), "|"))
+	b.WriteString("\t*)\n\t\tif (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n\t\t\t_alternative 'commands:command:((")
+	for _, cmd := range commands {
+		fmt.Fprintf(b, "%s\\:\"%s\" ", cmd.name, quote(cmd.summary))
+	}
+	b.WriteString("))' 'files:file:_files'\n\t\t\treturn\n\t\tfi\n\t\t;;\n\tesac\n")
+	b.WriteString("\tcase $cmd in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(b, "\t%s)\n", cmd.name)
+		if args := commandArgChoices(cmd.name); args != nil {
+			fmt.Fprintf(b, "\t\t_arguments '1:argument:(%s)'\n\t\t;;\n", strings.Join(args, " "))
+			continue
+		}
+		b.WriteString("\t\t_arguments")
+		for _, f := range completionFlags(cmd) {
+			spec := fmt.Sprintf("-%s[%s]", f.name, quote(f.description))
+			switch {
+			case f.choices != nil:
+				spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.choices, " "))
+			case f.file:
+				spec += fmt.Sprintf(":%s:_files", f.name)
+			case f.takesValue:
+				spec += fmt.Sprintf(":%s:", f.name)
+			}
+			fmt.Fprintf(b, " \\\n\t\t\t'%s'", spec)
+		}
+		b.WriteString(" \\\n\t\t\t'*:file:_files'\n\t\t;;\n")
+	}
+	b.WriteString("\tesac\n}\n")
+	b.WriteString("compdef _camus camus\n")
+}
+
+func fishCompletion(b *strings.Builder) {
+	quote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	}
+	names := strings.Join(commandNames(), " ")
+	b.WriteString("# fish completion for camus; load with: camus completion fish | source\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(b, "complete -c camus -n 'not __fish_seen_subcommand_from %s' -a %s -d %s\n", names, cmd.name, quote(cmd.summary))
+	}
+	for _, cmd := range commands {
+		cond := fmt.Sprintf("__fish_seen_subcommand_from %s", cmd.name)
+		if cmd.name == "infer" { // infer is also the default command
+			others := slices.DeleteFunc(commandNames(), func(name string) bool { return name == "infer" })
+			cond = fmt.Sprintf("not __fish_seen_subcommand_from %s", strings.Join(others, " "))
+		}
+		if args := commandArgChoices(cmd.name); args != nil {
+			fmt.Fprintf(b, "complete -c camus -n '%s' -f -a %s\n", cond, quote(strings.Join(args, " ")))
+			continue
+		}
+		for _, f := range completionFlags(cmd) {
+			line := fmt.Sprintf("complete -c camus -n '%s' -o %s -d %s", cond, f.name, quote(f.description))
+			switch {
+			case f.choices != nil:
+				line += " -x -a " + quote(strings.Join(f.choices, " "))
+			case f.file:
+				line += " -r -F"
+			case f.takesValue:
+				line += " -x"
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+}
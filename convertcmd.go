@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+type ConvertArgs struct {
+	networkFile  string    // level-1 network in extended newick format or infer results csv
+	k            int       // number of reticulations of network to use from results csv
+	graphFormat  string    // format to convert to [dot|graphml|phyloxml]
+	geneTreeFile string    // gene trees to label reticulation edges with their support ("" if none)
+	gtFormat     pr.Format // gene tree file format
+}
+
+func convertUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus convert [flags]... <network_file>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <network_file>\tlevel-1 network in extended newick format, or results csv from infer\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus convert network.nwk > network.dot\n",
+		"\tcamus convert -to graphml -g gene-trees.nwk infer-results.csv > network.graphml\n\n",
+	)
+}
+
+func parseConvertArgs(arguments []string) ConvertArgs {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.Usage = func() {
+		convertUsage(fs)
+	}
+	build := convertFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the convert flags on fs, returning a function that checks them once
+// they are parsed and makes the ConvertArgs
+func convertFlags(fs *flag.FlagSet) func() ConvertArgs {
+	format, ok := pr.ParseFormat[DefaultFormat]
+	if !ok {
+		panic(fmt.Sprintf("bad default format %s", DefaultFormat))
+	}
+	fs.Var(&format, "f", "gene tree `format` [newick|nexus] (default \"newick\")")
+	to := fs.String("to", "dot", "graph `format` to write [dot|graphml|phyloxml]")
+	geneTrees := fs.String("g", "", "label reticulation edges with the fraction of informative quartets in the gene trees in `file` that support them")
+	k := fs.Int("k", -1, "number of reticulations of the network to convert when reading a results csv (default largest)")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() ConvertArgs {
+		if *help {
+			convertUsage(fs)
+			os.Exit(0)
+		}
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, "one positional argument required: <network_file>\n\n") // nolint
+			convertUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if _, ok := pr.ParseGraphFormat[*to]; !ok {
+			fmt.Fprintf(os.Stderr, "\"%s\" is not a valid graph format for -to: valid formats are %s\n\n", *to, strings.Join(graphFormats(), ", ")) // nolint
+			convertUsage(fs)
+			os.Exit(exitUsage)
+		}
+		return ConvertArgs{
+			networkFile:  fs.Arg(0),
+			k:            *k,
+			graphFormat:  *to,
+			geneTreeFile: *geneTrees,
+			gtFormat:     format,
+		}
+	}
+}
+
+// Names of the formats networks can be converted to
+func graphFormats() []string {
+	return slices.Sorted(maps.Keys(pr.ParseGraphFormat))
+}
+
+// Converts a network to a graph format for visualization, writing it to stdout
+func runConvert(args ConvertArgs) error {
+	if args.geneTreeFile == "" {
+		ntw, err := readNetwork(args.networkFile, args.k)
+		if err != nil {
+			return err
+		}
+		return pr.ParseGraphFormat[args.graphFormat](ntw, nil, os.Stdout)
+	}
+	tre, geneTrees, err := readNetworkInputs(args.networkFile, args.k, args.geneTreeFile, args.gtFormat)
+	if err != nil {
+		return err
+	}
+	ntw, err := networkFromTree(tre, args.networkFile)
+	if err != nil {
+		return err
+	}
+	summaries, err := sc.ReticulationSummary(context.Background(), ntw, geneTrees.Trees)
+	if err != nil {
+		return err
+	}
+	support := make(map[string]float64, len(summaries))
+	for label, s := range summaries {
+		support[label] = s.Support
+	}
+	return pr.ParseGraphFormat[args.graphFormat](ntw, support, os.Stdout)
+}
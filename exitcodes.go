@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"syscall"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	in "github.com/jsdoublel/camus/internal/infer"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+// Exit codes, so that workflow managers can tell classes of errors apart
+const (
+	exitOK         = 0
+	exitRuntime    = 1 // error while running, or a failed internal assertion (i.e., a bug)
+	exitUsage      = 2 // invalid command line arguments
+	exitInput      = 3 // input file is missing or could not be parsed
+	exitValidation = 4 // inputs were read but are not valid (e.g., unrooted constraint tree)
+	exitResource   = 5 // ran out of a system resource (e.g., disk space, or time with -timeout)
+)
+
+var (
+	inputErrors = []error{
+		fs.ErrNotExist,
+		pr.ErrInvalidFile,
+		pr.ErrInvalidFormat,
+		gr.ErrInvalidQuartet,
+	}
+	validationErrors = []error{
+		pr.ErrUnrooted,
+		pr.ErrNonBinary,
+		pr.ErrMulTree,
+		pr.ErrTypeOutRange,
+		pr.ErrNoBranchLengths,
+		pr.ErrNoReticulations,
+		pr.ErrOutgroup,
+		gr.ErrTipNameMismatch,
+		gr.ErrNotClade,
+		gr.ErrInvalidRetLabel,
+		gr.ErrDifferentTaxa,
+		in.ErrInvalidOption,
+		in.ErrInvalidBranch,
+		sc.ErrNotLevel1,
+		sc.ErrInvalidScorerOption,
+		errOutdirNotEmpty,
+		errWarnings,
+	}
+	resourceErrors = []error{
+		syscall.ENOSPC,
+		syscall.EDQUOT,
+		syscall.EMFILE,
+		syscall.ENOMEM,
+		context.DeadlineExceeded,
+	}
+)
+
+// Exit code for error returned by a command. Resource errors are checked
+// first, since they are often wrapped in errors from reading or writing files,
+// and validation errors before input errors, since a file can be read but
+// not be valid.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case isAny(err, resourceErrors):
+		return exitResource
+	case isAny(err, validationErrors):
+		return exitValidation
+	case isAny(err, inputErrors):
+		return exitInput
+	default:
+		return exitRuntime
+	}
+}
+
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+const helpWidth = 80
+
+// Subcommand of camus
+type command struct {
+	name    string
+	args    string // positional arguments
+	summary string
+	flags   func() *flag.FlagSet         // flags of the command (nil if it has none)
+	usage   func(fs *flag.FlagSet)       // writes the help of the command with its flags (nil if it has none)
+	run     func(arguments []string) int // runs the command on the arguments after its name, returning the exit code
+}
+
+var commands []command
+
+// commands is set here rather than where it is declared, since running help
+// and completion (and writing the infer usage) refers back to it
+func init() {
+	commands = []command{
+		{name: "infer", args: "<const_tree_file> <gene_tree_file>", summary: "infer level-1 networks from a constraint tree and gene trees (the default command)",
+			flags: func() *flag.FlagSet { return newCommandFlags("infer", func(fs *flag.FlagSet) { inferFlags(fs) }) },
+			run: func(arguments []string) int {
+				buf := &bytes.Buffer{}                              // capture pre logfile setup logging
+				log.SetOutput(io.MultiWriter(buf, &loggedWarnings)) // written to stderr once the console log level is known
+				return runInfer(parseArgs(arguments), buf)
+			}},
+		{name: "score", args: "<network_file> <gene_tree_file>", summary: "score each reticulation of a network with gene trees",
+			flags: func() *flag.FlagSet { return newCommandFlags("score", func(fs *flag.FlagSet) { scoreFlags(fs) }) },
+			usage: scoreUsage, run: subcommand(parseScoreArgs, runScore)},
+		{name: "score-edges", args: "<const_tree_file> <edges_file> <gene_tree_file>", summary: "score candidate edges on a constraint tree with each score mode",
+			flags: func() *flag.FlagSet {
+				return newCommandFlags("score-edges", func(fs *flag.FlagSet) { scoreEdgesFlags(fs) })
+			},
+			usage: scoreEdgesUsage, run: subcommand(parseScoreEdgesArgs, runScoreEdges)},
+		{name: "place", args: "<network_file> <gene_tree_file>", summary: "place taxa missing from a network using quartets from gene trees",
+			flags: func() *flag.FlagSet { return newCommandFlags("place", func(fs *flag.FlagSet) { placeFlags(fs) }) },
+			usage: placeUsage, run: subcommand(parsePlaceArgs, runPlace)},
+		{name: "compare", args: "<network_file> <network_file>", summary: "compare the topology of two networks on the same taxa",
+			flags: func() *flag.FlagSet { return newCommandFlags("compare", func(fs *flag.FlagSet) { compareFlags(fs) }) },
+			usage: compareUsage, run: subcommand(parseCompareArgs, runCompare)},
+		{name: "convert", args: "<network_file>", summary: "convert a network to DOT, GraphML, or PhyloXML for visualization",
+			flags: func() *flag.FlagSet { return newCommandFlags("convert", func(fs *flag.FlagSet) { convertFlags(fs) }) },
+			usage: convertUsage, run: subcommand(parseConvertArgs, runConvert)},
+		{name: "report", args: "<run> <run>...", summary: "compare the networks, quartet curves, and runtimes of several infer runs",
+			flags: func() *flag.FlagSet { return newCommandFlags("report", func(fs *flag.FlagSet) { reportFlags(fs) }) },
+			usage: reportUsage, run: subcommand(parseReportArgs, runReport)},
+		{name: "stats", args: "<const_tree_file> <gene_tree_file>", summary: "summarize gene trees and their quartets before a run",
+			flags: func() *flag.FlagSet { return newCommandFlags("stats", func(fs *flag.FlagSet) { statsFlags(fs) }) },
+			usage: statsUsage, run: subcommand(parseStatsArgs, runStats)},
+		{name: "root", args: "<tree_file>", summary: "root a tree on an outgroup or at its midpoint for use as a constraint tree",
+			flags: func() *flag.FlagSet { return newCommandFlags("root", func(fs *flag.FlagSet) { rootFlags(fs) }) },
+			usage: rootUsage, run: subcommand(parseRootArgs, runRoot)},
+		{name: "run", args: "<config>", summary: "run validate, infer, bootstrap, score, and report from one config into a results directory",
+			flags: func() *flag.FlagSet { return newCommandFlags("run", func(fs *flag.FlagSet) { runFlags(fs) }) },
+			usage: runUsage,
+			run: func(arguments []string) int {
+				log.SetOutput(os.Stderr)
+				return runPipeline(parseRunArgs(arguments))
+			}},
+		{name: "completion", args: "<bash|zsh|fish>", summary: "write a shell completion script to stdout",
+			run: subcommand(func(arguments []string) []string { return arguments }, runCompletion)},
+		{name: "help", args: "[command|topic]", summary: "show help for a command or topic",
+			run: func(arguments []string) int {
+				runHelp(arguments)
+				return exitOK
+			}},
+	}
+}
+
+// Makes the run function of a command that parses its arguments with parse
+// and runs with run, logging to stderr
+func subcommand[A any](parse func(arguments []string) A, run func(args A) error) func(arguments []string) int {
+	return func(arguments []string) int {
+		log.SetOutput(os.Stderr)
+		if err := run(parse(arguments)); err != nil {
+			lg.Errorf("%s", err)
+			return exitCode(err)
+		}
+		return exitOK
+	}
+}
+
+// Writes the usage line of each command
+func writeCommandUsage(w io.Writer) error {
+	var b strings.Builder
+	for i, cmd := range commands {
+		indent, name, flags := "       ", cmd.name, ""
+		if i == 0 {
+			indent = "usage: "
+		}
+		if name == "infer" {
+			name = "[infer]" // the default command
+		}
+		if cmd.flags != nil {
+			flags = " [flags]..."
+		}
+		fmt.Fprintf(&b, "%scamus %s%s %s\n", indent, name, flags, cmd.args)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Makes a flag set with the flags defined by define, without parsing anything
+func newCommandFlags(name string, define func(fs *flag.FlagSet)) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	define(fs)
+	return fs
+}
+
+func findCommand(name string) (command, bool) {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i == -1 {
+		return command{}, false
+	}
+	return commands[i], true
+}
+
+// Help page for the choices of a flag
+type helpTopic struct {
+	name    string
+	summary string // shown in the list of topics
+	intro   string
+	entries []helpEntry
+}
+
+type helpEntry struct {
+	name        string
+	description string
+}
+
+func helpTopics() []helpTopic {
+	filters := make([]helpEntry, len(pr.QModeDescriptions))
+	for mode, desc := range pr.QModeDescriptions {
+		filters[mode] = helpEntry{name: strconv.Itoa(mode), description: desc}
+	}
+	return []helpTopic{
+		{
+			name:    "scorers",
+			summary: "score modes for -sm and -compare-modes",
+			intro: "The score mode sets how the dp scores a candidate edge from the quartets it satisfies. " +
+				"Modes other than max are experimental.",
+			entries: describedEntries(sc.ScorerDescriptions),
+		},
+		{
+			name:    "filters",
+			summary: "quartet filter modes for -q",
+			intro: "The quartet filter removes gene tree quartets with topologies that are likely noise before the dp runs. " +
+				"Filtering is applied to each set of four taxa using the counts of its three topologies across all gene trees, " +
+				"with the threshold set by -t (default " + strconv.FormatFloat(DefaultThreshold, 'g', -1, 64) + ").",
+			entries: filters,
+		},
+		{
+			name:    "formats",
+			summary: "gene tree file formats for -f",
+			intro:   "Constraint trees and networks are always newick (extended newick for networks); -f sets the gene tree format.",
+			entries: describedEntries(pr.FormatDescriptions),
+		},
+	}
+}
+
+// Entries for each choice in descriptions, sorted by name
+func describedEntries(descriptions map[string]string) []helpEntry {
+	entries := make([]helpEntry, 0, len(descriptions))
+	for _, name := range slices.Sorted(maps.Keys(descriptions)) {
+		entries = append(entries, helpEntry{name: name, description: descriptions[name]})
+	}
+	return entries
+}
+
+func findTopic(name string) (helpTopic, bool) {
+	topics := helpTopics()
+	i := slices.IndexFunc(topics, func(t helpTopic) bool { return t.name == name })
+	if i == -1 {
+		return helpTopic{}, false
+	}
+	return topics[i], true
+}
+
+// Runs `camus help [command|topic]`, writing help to stdout
+func runHelp(arguments []string) {
+	if len(arguments) > 1 {
+		fmt.Fprint(os.Stderr, "help takes at most one argument: [command|topic]\n\n") // nolint
+		writeHelpIndex(os.Stderr)                                                     // nolint
+		os.Exit(exitUsage)
+	}
+	if len(arguments) == 0 {
+		writeHelpIndex(os.Stdout) // nolint
+		return
+	}
+	name := arguments[0]
+	if topic, ok := findTopic(name); ok {
+		writeTopic(os.Stdout, topic) // nolint
+		return
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "\"%s\" is not a command or help topic\n\n", name) // nolint
+		writeHelpIndex(os.Stderr)                                                 // nolint
+		os.Exit(exitUsage)
+	}
+	switch {
+	case cmd.name == "infer":
+		inferFlags(flag.CommandLine)
+		flag.CommandLine.SetOutput(os.Stdout)
+		Usage(false)
+	case cmd.usage != nil:
+		fs := cmd.flags()
+		fs.SetOutput(os.Stdout)
+		cmd.usage(fs)
+	default:
+		fmt.Printf("usage: camus %s %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+}
+
+// Writes the list of commands and help topics
+func writeHelpIndex(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("usage: camus help [command|topic]\n\ncommands:\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "  %-12s%s\n", cmd.name, cmd.summary)
+	}
+	b.WriteString("\ntopics:\n\n")
+	for _, topic := range helpTopics() {
+		fmt.Fprintf(&b, "  %-12s%s\n", topic.name, topic.summary)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Writes a help topic, formatted like flag defaults
+func writeTopic(w io.Writer, topic helpTopic) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n\n", topic.name, topic.summary)
+	for _, line := range wrapText(topic.intro, helpWidth) {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n")
+	for _, entry := range topic.entries {
+		fmt.Fprintf(&b, "  %s\n", entry.name)
+		for _, line := range wrapText(entry.description, helpWidth-6) {
+			b.WriteString("    \t" + line + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Splits text into lines of at most width characters (longer words get their
+// own line)
+func wrapText(text string, width int) []string {
+	lines := make([]string, 0)
+	line := ""
+	for _, word := range strings.Fields(text) {
+		switch {
+		case line == "":
+			line = word
+		case len(line)+1+len(word) > width:
+			lines = append(lines, line)
+			line = word
+		default:
+			line += " " + word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,187 @@
+package graphs
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+var ErrDifferentTaxa = errors.New("networks have different taxa")
+
+// Topological differences between two networks on the same taxa
+type NetworkComparison struct {
+	Reticulations       [2]int // number of reticulations in each network
+	SharedReticulations int    // reticulations with the same U and W clades in both networks
+	HardwiredClusters   [2]int // number of distinct non-trivial hardwired clusters in each network
+	HardwiredDistance   int    // hardwired clusters in only one of the networks
+	BackboneRF          int    // clusters in only one of the backbone trees (rooted Robinson-Foulds distance)
+}
+
+// Compares two networks (e.g., from ConvertToNetwork) by their reticulations,
+// hardwired clusters (taxa below each node, following reticulation edges),
+// and backbone trees (the networks with the reticulation edges removed).
+// Returns an error if the networks do not have the same taxa.
+func CompareNetworks(ntw1, ntw2 *Network) (NetworkComparison, error) {
+	taxa1, taxa2 := networkTaxa(ntw1), networkTaxa(ntw2)
+	if !slices.Equal(taxa1, taxa2) {
+		return NetworkComparison{}, fmt.Errorf("%w, %d and %d taxa (%d in common)", ErrDifferentTaxa, len(taxa1), len(taxa2), len(commonTaxa(taxa1, taxa2)))
+	}
+	clusters1, err := ntw1.clusters()
+	if err != nil {
+		return NetworkComparison{}, err
+	}
+	clusters2, err := ntw2.clusters()
+	if err != nil {
+		return NetworkComparison{}, err
+	}
+	rets1, rets2 := clusters1.reticulations, clusters2.reticulations
+	return NetworkComparison{
+		Reticulations:       [2]int{len(rets1), len(rets2)},
+		SharedReticulations: len(rets1) - symmetricDifference(rets1, rets2, true),
+		HardwiredClusters:   [2]int{len(clusters1.hardwired), len(clusters2.hardwired)},
+		HardwiredDistance:   symmetricDifference(clusters1.hardwired, clusters2.hardwired, false),
+		BackboneRF:          symmetricDifference(clusters1.backbone, clusters2.backbone, false),
+	}, nil
+}
+
+// Clusters of a network, each written as its sorted taxa joined by commas
+type networkClusters struct {
+	hardwired     map[string]bool
+	backbone      map[string]bool
+	reticulations map[string]bool // "U clade|W clade" for each reticulation
+	retClades     map[string][2]string
+}
+
+// U and W clades of each reticulation (by label), each written as its sorted
+// taxa joined by commas, so reticulations of networks with different node ids
+// can be matched
+func (ntw *Network) ReticulationClades() (map[string][2]string, error) {
+	clusters, err := ntw.clusters()
+	if err != nil {
+		return nil, err
+	}
+	return clusters.retClades, nil
+}
+
+func (ntw *Network) clusters() (networkClusters, error) {
+	nodes := make(map[int]*tree.Node)
+	for _, n := range ntw.NetTree.Nodes() {
+		nodes[n.Id()] = n
+	}
+	nTaxa := len(networkTaxa(ntw))
+	below := make(map[*tree.Node][]string)     // taxa below each node in the backbone tree
+	retLeaves := make(map[*tree.Node][]string) // reticulation labels below each node
+	ntw.NetTree.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) (keep bool) {
+		switch {
+		case cur.Tip() && strings.Contains(cur.Name(), "#"):
+			if _, ok := ntw.Reticulations[cur.Name()]; ok { // skips placeholder tips (e.g., from MakeNetwork)
+				retLeaves[cur] = []string{cur.Name()}
+			}
+		case cur.Tip():
+			below[cur] = []string{cur.Name()}
+		default:
+			for _, c := range cur.Neigh() {
+				if c != prev {
+					below[cur] = append(below[cur], below[c]...)
+					retLeaves[cur] = append(retLeaves[cur], retLeaves[c]...)
+				}
+			}
+		}
+		return true
+	})
+	// hardwired cluster of a node also has the clusters of the hybrid nodes
+	// its reticulation leaves point to
+	hardwired := make(map[*tree.Node][]string)
+	var hardwiredOf func(n *tree.Node, depth int) ([]string, error)
+	hardwiredOf = func(n *tree.Node, depth int) ([]string, error) {
+		if c, ok := hardwired[n]; ok {
+			return c, nil
+		}
+		if depth > len(ntw.Reticulations) {
+			return nil, fmt.Errorf("%w, reticulations form a directed cycle", ErrInvalidRetLabel)
+		}
+		cluster := slices.Clone(below[n])
+		for _, label := range retLeaves[n] {
+			hybrid, err := hardwiredOf(nodes[ntw.Reticulations[label].IDs[Wi]], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			cluster = append(cluster, hybrid...)
+		}
+		hardwired[n] = cluster
+		return cluster, nil
+	}
+	result := networkClusters{
+		hardwired:     make(map[string]bool),
+		backbone:      make(map[string]bool),
+		reticulations: make(map[string]bool),
+		retClades:     make(map[string][2]string),
+	}
+	for n := range below {
+		cluster, err := hardwiredOf(n, 0)
+		if err != nil {
+			return networkClusters{}, err
+		}
+		if key, size := clusterKey(cluster); size > 1 && size < nTaxa {
+			result.hardwired[key] = true
+		}
+		if key, size := clusterKey(below[n]); size > 1 && size < nTaxa {
+			result.backbone[key] = true
+		}
+	}
+	for label, br := range ntw.Reticulations {
+		uKey, _ := clusterKey(below[nodes[br.IDs[Ui]]])
+		wKey, _ := clusterKey(below[nodes[br.IDs[Wi]]])
+		result.reticulations[uKey+"|"+wKey] = true
+		result.retClades[label] = [2]string{uKey, wKey}
+	}
+	return result, nil
+}
+
+// Key of a set of taxa (which may have duplicates) and its size
+func clusterKey(taxa []string) (string, int) {
+	taxa = slices.Compact(slices.Sorted(slices.Values(taxa)))
+	return strings.Join(taxa, ","), len(taxa)
+}
+
+// Sorted taxa of a network (leaves that are not reticulation leaves)
+func networkTaxa(ntw *Network) []string {
+	taxa := make([]string, 0)
+	for _, tip := range ntw.NetTree.Tips() {
+		if !strings.Contains(tip.Name(), "#") {
+			taxa = append(taxa, tip.Name())
+		}
+	}
+	slices.Sort(taxa)
+	return taxa
+}
+
+func commonTaxa(taxa1, taxa2 []string) []string {
+	return slices.DeleteFunc(slices.Clone(taxa1), func(t string) bool {
+		_, found := slices.BinarySearch(taxa2, t)
+		return !found
+	})
+}
+
+// Number of keys in only one of the sets (or only in set2 if oneSided)
+func symmetricDifference(set1, set2 map[string]bool, oneSided bool) int {
+	diff := 0
+	for key := range maps.Keys(set1) {
+		if !set2[key] {
+			diff++
+		}
+	}
+	if oneSided {
+		return diff
+	}
+	for key := range maps.Keys(set2) {
+		if !set1[key] {
+			diff++
+		}
+	}
+	return diff
+}
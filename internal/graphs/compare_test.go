@@ -0,0 +1,125 @@
+package graphs
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+func TestCompareNetworks(t *testing.T) {
+	constTree := "[&R]((A,(B,(C,F)a)b)c,(D,E)d)e;"
+	testCases := []struct {
+		name        string
+		const1      string
+		edges1      [][2]string
+		const2      string
+		edges2      [][2]string
+		expected    NetworkComparison
+		expectedErr error
+	}{
+		{
+			name:     "same network",
+			const1:   constTree,
+			edges1:   [][2]string{{"F", "E"}},
+			const2:   constTree,
+			edges2:   [][2]string{{"F", "E"}},
+			expected: NetworkComparison{Reticulations: [2]int{1, 1}, SharedReticulations: 1, HardwiredClusters: [2]int{5, 5}},
+		},
+		{
+			name:     "different u",
+			const1:   constTree,
+			edges1:   [][2]string{{"F", "E"}},
+			const2:   constTree,
+			edges2:   [][2]string{{"C", "E"}},
+			expected: NetworkComparison{Reticulations: [2]int{1, 1}, HardwiredClusters: [2]int{5, 5}, HardwiredDistance: 2},
+		},
+		{
+			name:     "tree",
+			const1:   constTree,
+			edges1:   [][2]string{{"F", "E"}},
+			const2:   constTree,
+			expected: NetworkComparison{Reticulations: [2]int{1, 0}, HardwiredClusters: [2]int{5, 4}, HardwiredDistance: 7},
+		},
+		{
+			name:   "different backbone",
+			const1: constTree,
+			edges1: [][2]string{{"F", "E"}},
+			const2: "[&R]((A,(C,(B,F)a)b)c,(D,E)d)e;",
+			edges2: [][2]string{{"F", "E"}},
+			expected: NetworkComparison{Reticulations: [2]int{1, 1}, SharedReticulations: 1, HardwiredClusters: [2]int{5, 5},
+				HardwiredDistance: 2, BackboneRF: 2},
+		},
+		{
+			name:        "different taxa",
+			const1:      constTree,
+			edges1:      [][2]string{{"F", "E"}},
+			const2:      "[&R]((A,(B,(C,G)a)b)c,(D,E)d)e;",
+			edges2:      [][2]string{{"G", "E"}},
+			expectedErr: ErrDifferentTaxa,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ntw1 := makeTestNetwork(t, test.const1, test.edges1)
+			ntw2 := makeTestNetwork(t, test.const2, test.edges2)
+			result, err := CompareNetworks(ntw1, ntw2)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if result != test.expected {
+				t.Errorf("got %+v, expected %+v", result, test.expected)
+			}
+			if test.expectedErr != nil {
+				return
+			}
+			// swapping the networks swaps the per network counts
+			swapped, err := CompareNetworks(ntw2, ntw1)
+			if err != nil {
+				t.Fatalf("unexpected error comparing swapped networks: %v", err)
+			}
+			if swapped.HardwiredDistance != result.HardwiredDistance || swapped.BackboneRF != result.BackboneRF ||
+				swapped.SharedReticulations != result.SharedReticulations || swapped.Reticulations[0] != result.Reticulations[1] {
+				t.Errorf("comparison is not symmetric, %+v != %+v", swapped, result)
+			}
+		})
+	}
+}
+
+func TestReticulationClades(t *testing.T) {
+	ntw := makeTestNetwork(t, "[&R]((A,(B,(C,F)a)b)c,(D,E)d)e;", [][2]string{{"F", "E"}, {"b", "A"}})
+	clades, err := ntw.ReticulationClades()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := map[string][2]string{"#H1": {"B,C,F", "A"}, "#H2": {"F", "E"}}
+	if !maps.Equal(clades, expected) {
+		t.Errorf("got %v, expected %v", clades, expected)
+	}
+}
+
+// Network made by adding edges (pairs of node names) to the constraint tree
+func makeTestNetwork(t *testing.T, constTree string, edges [][2]string) *Network {
+	tre, err := newick.NewParser(strings.NewReader(constTree)).Parse()
+	if err != nil {
+		t.Fatalf("%s cannot be parsed as newick. Test case is written incorrectly", constTree)
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	branches := make([]Branch, len(edges))
+	for i, edge := range edges {
+		u, err := tre.SelectNodes(edge[0])
+		if err != nil || len(u) != 1 {
+			t.Fatalf("cannot find node %s or found too many", edge[0])
+		}
+		w, err := tre.SelectNodes(edge[1])
+		if err != nil || len(w) != 1 {
+			t.Fatalf("cannot find node %s or found too many", edge[1])
+		}
+		branches[i] = Branch{IDs: [2]int{u[0].Id(), w[0].Id()}}
+	}
+	return MakeNetwork(MakeTreeData(tre, nil), branches)
+}
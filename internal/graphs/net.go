@@ -1,16 +1,23 @@
 package graphs
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/evolbioinfo/gotree/tree"
 )
 
 type Network struct {
-	NetTree       *tree.Tree        // tree from extended newick
-	Reticulations map[string]Branch // reticulation branches
+	NetTree       *tree.Tree         // tree from extended newick
+	Reticulations map[string]Branch  // reticulation branches
+	Gamma         map[string]float64 // inheritance probability of each reticulation edge, written by Newick (nil if not estimated)
+	Support       map[string]float64 // support of each reticulation edge, written by Newick (nil if not computed)
 }
 
 const (
@@ -22,6 +29,37 @@ type Branch struct {
 	IDs [2]int // {0: u, 1: w}
 }
 
+var ErrInvalidRetLabel = errors.New("invalid reticulation label")
+
+// Naming scheme for reticulation labels, #<Prefix><n> with n counting up
+// from Start
+type RetLabeling struct {
+	Prefix string
+	Start  int
+}
+
+var DefaultRetLabeling = RetLabeling{Prefix: "H", Start: 1}
+
+// Label of the i-th (from zero) reticulation
+func (l RetLabeling) Label(i int) string {
+	return fmt.Sprintf("#%s%d", l.Prefix, l.Start+i)
+}
+
+// Checks that labels are valid in extended newick and can be told apart
+// from taxon names
+func (l RetLabeling) Validate() error {
+	if l.Prefix == "" {
+		return fmt.Errorf("%w, prefix cannot be empty", ErrInvalidRetLabel)
+	}
+	if strings.ContainsAny(l.Prefix, "#(),:;[]' \t\r\n") {
+		return fmt.Errorf("%w, prefix %q contains a character that is not allowed in newick labels", ErrInvalidRetLabel, l.Prefix)
+	}
+	if l.Start < 0 {
+		return fmt.Errorf("%w, start index must be non-negative, got %d", ErrInvalidRetLabel, l.Start)
+	}
+	return nil
+}
+
 func (br Branch) Empty() bool {
 	return br.IDs == [2]int{0, 0}
 }
@@ -34,32 +72,147 @@ func (br Branch) Collide(br2 Branch) bool {
 }
 
 // Makes extended newick network out of newick tree and branch data computed by
-// the CAMUS algorithm
+// the CAMUS algorithm. Reticulations are labeled #H1, #H2, ... in the order
+// they are added to the tree (see graftOrder), so the network doesn't depend
+// on the order of branches.
 func MakeNetwork(td *TreeData, branches []Branch) *Network {
-	td = td.Clone()
-	ret := make(map[string]Branch)
-	slices.SortFunc(branches, func(br1, br2 Branch) int {
-		if br1.Collide(br2) {
-			if td.Under(br1.IDs[0], br2.IDs[0]) ||
-				td.Under(br1.IDs[0], br2.IDs[1]) ||
-				td.Under(br1.IDs[1], br2.IDs[0]) ||
-				td.Under(br1.IDs[1], br2.IDs[1]) {
-				return -1
-			} else {
-				return 1
+	branches = graftOrder(td, branches)
+	labels := make([]string, len(branches))
+	for i := range branches {
+		labels[i] = DefaultRetLabeling.Label(i)
+	}
+	return makeNetwork(td, branches, labels)
+}
+
+// Makes extended newick network out of newick tree and labeled branches (see
+// StableReticulationLabels)
+func MakeLabeledNetwork(td *TreeData, reticulations map[string]Branch) *Network {
+	branchLabels := make(map[Branch]string, len(reticulations))
+	for label, br := range reticulations {
+		branchLabels[br] = label
+	}
+	branches := graftOrder(td, slices.Collect(maps.Values(reticulations)))
+	labels := make([]string, len(branches))
+	for i, br := range branches {
+		labels[i] = branchLabels[br]
+	}
+	return makeNetwork(td, branches, labels)
+}
+
+// Assigns a label to each distinct branch across a set of networks (e.g., the
+// optimal network for each number of edges), so that the same reticulation
+// has the same label in every network it appears in. Labels are numbered in
+// order of first appearance.
+func StableReticulationLabels(branchSets [][]Branch, labeling RetLabeling) []map[string]Branch {
+	labels := make(map[Branch]string)
+	result := make([]map[string]Branch, len(branchSets))
+	for i, branches := range branchSets {
+		result[i] = make(map[string]Branch, len(branches))
+		for _, br := range branches {
+			label, ok := labels[br]
+			if !ok {
+				label = labeling.Label(len(labels))
+				labels[br] = label
 			}
+			result[i][label] = br
 		}
-		return 0
+	}
+	return result
+}
+
+// Order to graft branches in, which only depends on the taxa below their ends
+// (not on node ids or the order of branches). Branches are sorted by
+// branchKey, then a branch that must be grafted before one sharing a node with
+// it (see compareBranches) is moved ahead of it.
+func graftOrder(td *TreeData, branches []Branch) []Branch {
+	keys := make(map[Branch]branchKey, len(branches))
+	for _, br := range branches {
+		keys[br] = branchKey{td.nodeKey(br.IDs[Ui]), td.nodeKey(br.IDs[Wi])}
+	}
+	sorted := slices.Clone(branches)
+	slices.SortFunc(sorted, func(br1, br2 Branch) int {
+		return keys[br1].compare(keys[br2])
 	})
+	ordered := make([]Branch, 0, len(sorted))
+	for len(sorted) > 0 {
+		i := slices.IndexFunc(sorted, func(br Branch) bool {
+			return !slices.ContainsFunc(sorted, func(other Branch) bool {
+				return other != br && compareBranches(td, other, br) < 0 && compareBranches(td, br, other) > 0
+			})
+		})
+		i = max(i, 0) // constraints form a cycle (not level-1), keep sorted order
+		ordered = append(ordered, sorted[i])
+		sorted = slices.Delete(sorted, i, i+1)
+	}
+	return ordered
+}
+
+// Identifies a node without its id: in a binary tree, two nodes with the same
+// smallest taxon below them have different numbers of taxa below them
+type nodeKey struct {
+	minTaxon string
+	nLeaves  uint64
+}
+
+type branchKey [2]nodeKey
+
+func (k branchKey) compare(k2 branchKey) int {
+	for i := range k {
+		if c := cmp.Or(strings.Compare(k[i].minTaxon, k2[i].minTaxon), cmp.Compare(k[i].nLeaves, k2[i].nLeaves)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (td *TreeData) nodeKey(id int) nodeKey {
+	return nodeKey{minTaxon: td.minTaxon(id), nLeaves: td.NumLeavesBelow[id]}
+}
+
+// Smallest taxon name below node id
+func (td *TreeData) minTaxon(id int) string {
+	if node := td.IdToNodes[id]; node.Tip() {
+		return node.Name()
+	}
+	result := ""
+	for i, child := range td.Children[id] {
+		if m := td.minTaxon(child.Id()); i == 0 || m < result {
+			result = m
+		}
+	}
+	return result
+}
+
+// Branches that share a node are ordered so that the lower branch is grafted
+// first
+func compareBranches(td *TreeData, br1, br2 Branch) int {
+	if br1.Collide(br2) {
+		if td.Under(br1.IDs[0], br2.IDs[0]) ||
+			td.Under(br1.IDs[0], br2.IDs[1]) ||
+			td.Under(br1.IDs[1], br2.IDs[0]) ||
+			td.Under(br1.IDs[1], br2.IDs[1]) {
+			return -1
+		} else {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Grafts branches (in order) onto a copy of the tree, with labels[i] used
+// for the reticulation of branches[i]
+func makeNetwork(td *TreeData, branches []Branch, labels []string) *Network {
+	td = td.Clone()
+	ret := make(map[string]Branch)
 	for i, branch := range branches {
-		ret[fmt.Sprintf("#H%d", i+1)] = branch
+		ret[labels[i]] = branch
 		u, w := td.IdToNodes[branch.IDs[Ui]], td.IdToNodes[branch.IDs[Wi]]
 		uEdge, err := u.ParentEdge()
 		if err != nil {
 			panic(fmt.Sprintf("error in MakeNetwork getting u (id %d): %s", u.Id(), err))
 		}
 		r := td.NewNode()
-		r.SetName(fmt.Sprintf("#H%d", i+1))
+		r.SetName(labels[i])
 		if _, _, _, err := td.GraftTipOnEdge(r, uEdge); err != nil {
 			panic(err)
 		}
@@ -76,19 +229,86 @@ func MakeNetwork(td *TreeData, branches []Branch) *Network {
 		if err != nil {
 			panic(fmt.Sprintf("error in MakeNetwork after grafting w: %s", err))
 		}
-		p.SetName(fmt.Sprintf("#H%d", i+1))
+		p.SetName(labels[i])
 	}
 	cleanTree(&td.Tree)
 	return &Network{NetTree: &td.Tree, Reticulations: ret}
 }
 
+// Extended newick string of the network. If Gamma is set, the reticulation
+// edge (to the #H leaf) is annotated with its inheritance probability and the
+// tree edge into the hybrid node with the rest, e.g., ((A,#H1:::0.3),(B)#H1:::0.7).
+// If Support is set, the reticulation edge's support is written in the
+// support field, e.g., #H1::0.81:0.3 (as in rich newick).
 func (ntw *Network) Newick() string {
+	if ntw.Gamma != nil || ntw.Support != nil {
+		defer ntw.annotateReticulations()()
+	}
 	nwk := ntw.NetTree.Newick()
 	nwk = strings.ReplaceAll(nwk, "####,", "")
 	nwk = strings.ReplaceAll(nwk, ",####", "")
 	return nwk
 }
 
+// Records candidate reticulations (e.g., ones with too little support to
+// draw) as comments on the backbone nodes at their ends instead of grafting
+// them, e.g., [&candidate=#H3,role=donor] on u and [&candidate=#H3,role=hybrid]
+// on w. The backbone nodes keep their ids from the tree data the network was
+// made from.
+func (ntw *Network) AnnotateCandidates(candidates map[string]Branch) {
+	nodes := make(map[int]*tree.Node)
+	for _, n := range ntw.NetTree.Nodes() {
+		if n.Id() >= 0 {
+			nodes[n.Id()] = n
+		}
+	}
+	for _, label := range slices.Sorted(maps.Keys(candidates)) {
+		br := candidates[label]
+		for i, role := range [2]string{Ui: "donor", Wi: "hybrid"} {
+			n, ok := nodes[br.IDs[i]]
+			if !ok {
+				panic(fmt.Sprintf("candidate %s has node id %d, which is not in the network", label, br.IDs[i]))
+			}
+			n.AddComment(fmt.Sprintf("&candidate=%s,role=%s", label, role))
+		}
+	}
+}
+
+// Appends inheritance probabilities and supports to the reticulation labels
+// (skipping NaN ones), returning a function that restores the labels
+func (ntw *Network) annotateReticulations() (restore func()) {
+	renamed := make(map[*tree.Node]string)
+	for _, n := range ntw.NetTree.Nodes() {
+		if !strings.Contains(n.Name(), "#") {
+			continue
+		}
+		support, gamma := "", ""
+		if s, ok := ntw.Support[n.Name()]; ok && n.Tip() && !math.IsNaN(s) {
+			support = strconv.FormatFloat(s, 'f', 4, 64)
+		}
+		if g, ok := ntw.Gamma[n.Name()]; ok && !math.IsNaN(g) {
+			if !n.Tip() {
+				g = 1 - g
+			}
+			gamma = strconv.FormatFloat(g, 'f', 4, 64)
+		}
+		if support == "" && gamma == "" {
+			continue
+		}
+		renamed[n] = n.Name()
+		if gamma == "" {
+			n.SetName(n.Name() + "::" + support)
+		} else {
+			n.SetName(n.Name() + "::" + support + ":" + gamma)
+		}
+	}
+	return func() {
+		for n, name := range renamed {
+			n.SetName(name)
+		}
+	}
+}
+
 // Deletes all branch lengths and support values (since they might be misleading)
 func cleanTree(tre *tree.Tree) {
 	tre.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) (keep bool) {
@@ -100,6 +320,69 @@ func cleanTree(tre *tree.Tree) {
 	})
 }
 
+// Trees displayed by the network with branches (a level-1 set of branches on
+// td), one for each subset of the branches. Tree i takes the reticulation edge
+// of branches[j] (moving the subtree below w onto the edge above u) if bit j
+// of i is set, and the tree edge otherwise, so tree 0 is the constraint tree.
+// Node ids are continuous and tip indices are updated.
+func DisplayedTrees(td *TreeData, branches []Branch) []*tree.Tree {
+	trees := make([]*tree.Tree, 1<<len(branches))
+	for i := range trees {
+		moved := make(map[int]bool)   // w of each reticulation edge taken
+		attached := make(map[int]int) // u -> w of each reticulation edge taken
+		for j, br := range branches {
+			if i&(1<<j) != 0 {
+				moved[br.IDs[Wi]] = true
+				attached[br.IDs[Ui]] = br.IDs[Wi]
+			}
+		}
+		tre := tree.NewTree()
+		var build func(id int) *tree.Node
+		join := func(nodes ...*tree.Node) *tree.Node { // joins the non-nil nodes under a new node
+			nodes = slices.DeleteFunc(nodes, func(n *tree.Node) bool { return n == nil })
+			switch len(nodes) {
+			case 0:
+				return nil
+			case 1:
+				return nodes[0]
+			}
+			parent := tre.NewNode()
+			for _, n := range nodes {
+				tre.ConnectNodes(parent, n)
+			}
+			return parent
+		}
+		build = func(id int) *tree.Node {
+			if n := td.IdToNodes[id]; n.Tip() {
+				tip := tre.NewNode()
+				tip.SetName(n.Name())
+				return tip
+			}
+			var nodes []*tree.Node
+			for _, child := range td.Children[id] {
+				if moved[child.Id()] {
+					continue
+				}
+				node := build(child.Id())
+				if w, ok := attached[child.Id()]; ok {
+					node = join(node, build(w))
+				}
+				nodes = append(nodes, node)
+			}
+			return join(nodes...)
+		}
+		tre.SetRoot(build(td.Root().Id()))
+		for id, n := range tre.Nodes() {
+			n.SetId(id)
+		}
+		if err := tre.UpdateTipIndex(); err != nil {
+			panic(err)
+		}
+		trees[i] = tre
+	}
+	return trees
+}
+
 func (ntw *Network) Level1(td *TreeData) bool {
 	branches := make([]string, 0)
 	for k := range ntw.Reticulations {
@@ -107,11 +390,7 @@ func (ntw *Network) Level1(td *TreeData) bool {
 	}
 	for i := range branches {
 		for j := i + 1; j < len(branches); j++ {
-			r1 := ntw.Reticulations[branches[i]]
-			r2 := ntw.Reticulations[branches[j]]
-			vR1 := td.LCA(r1.IDs[0], r1.IDs[1])
-			vR2 := td.LCA(r2.IDs[0], r2.IDs[1])
-			if vR1 == vR2 || illSorted(vR1, vR2, r1, td) || illSorted(vR2, vR1, r2, td) {
+			if !Compatible(ntw.Reticulations[branches[i]], ntw.Reticulations[branches[j]], td) {
 				return false
 			}
 		}
@@ -119,6 +398,14 @@ func (ntw *Network) Level1(td *TreeData) bool {
 	return true
 }
 
+// Returns true if two branches can be in the same level-1 network (i.e.,
+// their cycles don't overlap)
+func Compatible(r1, r2 Branch, td *TreeData) bool {
+	vR1 := td.LCA(r1.IDs[0], r1.IDs[1])
+	vR2 := td.LCA(r2.IDs[0], r2.IDs[1])
+	return vR1 != vR2 && !illSorted(vR1, vR2, r1, td) && !illSorted(vR2, vR1, r2, td)
+}
+
 func illSorted(v1, v2 int, r1 Branch, td *TreeData) bool {
 	return td.Under(v1, v2) && (td.Under(v2, r1.IDs[0]) || td.Under(v2, r1.IDs[1]))
 }
@@ -1,6 +1,9 @@
 package graphs
 
 import (
+	"errors"
+	"math"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -55,3 +58,254 @@ func TestMakeNetwork(t *testing.T) {
 		})
 	}
 }
+
+func TestNetworkNewick_Gamma(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("[&R]((A,(B,(C,F)a)b)c,(D,E)d)e;")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = constTree.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(constTree, nil)
+	u, _ := constTree.SelectNodes("F")
+	w, _ := constTree.SelectNodes("E")
+	ntw := MakeNetwork(td, []Branch{{IDs: [2]int{u[0].Id(), w[0].Id()}}})
+	plain := ntw.Newick()
+	ntw.Gamma = map[string]float64{"#H1": 0.25}
+	if expected, got := "((A,(B,(C,(#H1:::0.2500,F))a)b)c,(D,(E)#H1:::0.7500)d)e;", ntw.Newick(); got != expected {
+		t.Errorf("%s != %s", got, expected)
+	}
+	ntw.Gamma = map[string]float64{"#H1": math.NaN()}
+	if got := ntw.Newick(); got != plain {
+		t.Errorf("NaN gamma should not be written, %s != %s", got, plain)
+	}
+	ntw.Gamma = map[string]float64{"#H1": 0.25}
+	ntw.Support = map[string]float64{"#H1": 0.8}
+	if expected, got := "((A,(B,(C,(#H1::0.8000:0.2500,F))a)b)c,(D,(E)#H1:::0.7500)d)e;", ntw.Newick(); got != expected {
+		t.Errorf("%s != %s", got, expected)
+	}
+	ntw.Gamma = nil
+	if expected, got := "((A,(B,(C,(#H1::0.8000,F))a)b)c,(D,(E)#H1)d)e;", ntw.Newick(); got != expected {
+		t.Errorf("%s != %s", got, expected)
+	}
+	ntw.Support = nil
+	if got := ntw.Newick(); got != plain {
+		t.Errorf("labels were not restored, %s != %s", got, plain)
+	}
+}
+
+func TestStableReticulationLabels(t *testing.T) {
+	a, b, c := Branch{IDs: [2]int{1, 2}}, Branch{IDs: [2]int{3, 4}}, Branch{IDs: [2]int{5, 6}}
+	result := StableReticulationLabels([][]Branch{{a}, {b, c}, {c, a}}, DefaultRetLabeling)
+	expected := []map[string]Branch{
+		{"#H1": a},
+		{"#H2": b, "#H3": c},
+		{"#H3": c, "#H1": a},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, expected %v", result, expected)
+	}
+}
+
+func TestStableReticulationLabels_Custom(t *testing.T) {
+	a, b := Branch{IDs: [2]int{1, 2}}, Branch{IDs: [2]int{3, 4}}
+	result := StableReticulationLabels([][]Branch{{a}, {b, a}}, RetLabeling{Prefix: "R", Start: 0})
+	expected := []map[string]Branch{
+		{"#R0": a},
+		{"#R1": b, "#R0": a},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, expected %v", result, expected)
+	}
+}
+
+func TestRetLabeling_Validate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		labeling RetLabeling
+		hasError bool
+	}{
+		{name: "default", labeling: DefaultRetLabeling},
+		{name: "custom", labeling: RetLabeling{Prefix: "Ret_", Start: 0}},
+		{name: "empty prefix", labeling: RetLabeling{Prefix: "", Start: 1}, hasError: true},
+		{name: "hash in prefix", labeling: RetLabeling{Prefix: "#H", Start: 1}, hasError: true},
+		{name: "newick character", labeling: RetLabeling{Prefix: "H:", Start: 1}, hasError: true},
+		{name: "negative start", labeling: RetLabeling{Prefix: "H", Start: -1}, hasError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.labeling.Validate()
+			if tc.hasError && !errors.Is(err, ErrInvalidRetLabel) {
+				t.Errorf("expected ErrInvalidRetLabel, got %v", err)
+			} else if !tc.hasError && err != nil {
+				t.Errorf("unexpected error %s", err)
+			}
+		})
+	}
+}
+
+func TestMakeLabeledNetwork(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("[&R]((A,(B,(C,F)a)b)c,(D,E)d)e;")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree; test is written incorrectly")
+	}
+	if err := constTree.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(constTree, nil)
+	u, err := constTree.SelectNodes("F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := constTree.SelectNodes("E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ntw := MakeLabeledNetwork(td, map[string]Branch{"#H7": {IDs: [2]int{u[0].Id(), w[0].Id()}}})
+	expected := "((A,(B,(C,(#H7,F))a)b)c,(D,(E)#H7)d)e;"
+	if result := ntw.Newick(); result != expected {
+		t.Errorf("%s != %s", result, expected)
+	}
+	if _, ok := ntw.Reticulations["#H7"]; !ok || len(ntw.Reticulations) != 1 {
+		t.Errorf("unexpected reticulations %v", ntw.Reticulations)
+	}
+}
+
+func TestNetwork_AnnotateCandidates(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("[&R]((A,(B,(C,F)a)b)c,(D,E)d)e;")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree; test is written incorrectly")
+	}
+	if err := constTree.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(constTree, nil)
+	id := func(name string) int {
+		nodes, err := constTree.SelectNodes(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodes[0].Id()
+	}
+	ntw := MakeLabeledNetwork(td, map[string]Branch{"#H1": {IDs: [2]int{id("F"), id("E")}}})
+	ntw.AnnotateCandidates(map[string]Branch{"#H2": {IDs: [2]int{id("A"), id("a")}}})
+	expected := "((A[&candidate=#H2,role=donor],(B,(C,(#H1,F))a[&candidate=#H2,role=hybrid])b)c,(D,(E)#H1)d)e;"
+	if result := ntw.Newick(); result != expected {
+		t.Errorf("%s != %s", result, expected)
+	}
+	if _, ok := ntw.Reticulations["#H2"]; ok {
+		t.Error("candidate should not be a reticulation of the network")
+	}
+}
+
+func TestMakeNetwork_OrderIndependent(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("[&R]((A,(B,(C,F)a)b)c,(D,E)d)e;")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree; test is written incorrectly")
+	}
+	if err := constTree.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(constTree, nil)
+	branch := func(u, w string) Branch {
+		uNodes, err := constTree.SelectNodes(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wNodes, err := constTree.SelectNodes(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Branch{IDs: [2]int{uNodes[0].Id(), wNodes[0].Id()}}
+	}
+	orders := [][]Branch{
+		{branch("F", "C"), branch("B", "a"), branch("E", "D")},
+		{branch("E", "D"), branch("B", "a"), branch("F", "C")},
+		{branch("B", "a"), branch("F", "C"), branch("E", "D")},
+	}
+	expected := "((A,((#H1,B),(((C)#H3,(#H3,F))a)#H1)b)c,((D)#H2,(#H2,E))d)e;"
+	for _, branches := range orders {
+		if result := MakeNetwork(td, branches).Newick(); result != expected {
+			t.Errorf("branches %v: %s != %s", branches, result, expected)
+		}
+	}
+	labeled := map[string]Branch{"#H1": branch("E", "D"), "#H2": branch("F", "C"), "#H3": branch("B", "a")}
+	expectedLabeled := "((A,((#H3,B),(((C)#H2,(#H2,F))a)#H3)b)c,((D)#H1,(#H1,E))d)e;"
+	for range 5 { // map order is random
+		if result := MakeLabeledNetwork(td, labeled).Newick(); result != expectedLabeled {
+			t.Errorf("%s != %s", result, expectedLabeled)
+		}
+	}
+}
+
+func TestDisplayedTrees(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("[&R]((A,(B,C)b)c,(D,(E,F)f)g)r;")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree; test is written incorrectly")
+	}
+	if err := constTree.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(constTree, nil)
+	branch := func(u, w string) Branch {
+		uNodes, err := constTree.SelectNodes(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wNodes, err := constTree.SelectNodes(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Branch{IDs: [2]int{uNodes[0].Id(), wNodes[0].Id()}}
+	}
+	testCases := []struct {
+		name     string
+		branches []Branch
+		expected []string
+	}{
+		{
+			name:     "none",
+			branches: nil,
+			expected: []string{"((A,(B,C)),(D,(E,F)));"},
+		},
+		{
+			name:     "one",
+			branches: []Branch{branch("A", "C")},
+			expected: []string{"((A,(B,C)),(D,(E,F)));", "(((A,C),B),(D,(E,F)));"},
+		},
+		{
+			name:     "across the root",
+			branches: []Branch{branch("E", "b")},
+			expected: []string{"((A,(B,C)),(D,(E,F)));", "(A,(D,((E,(B,C)),F)));"},
+		},
+		{
+			name:     "two",
+			branches: []Branch{branch("A", "C"), branch("D", "F")},
+			expected: []string{
+				"((A,(B,C)),(D,(E,F)));",
+				"(((A,C),B),(D,(E,F)));",
+				"((A,(B,C)),((D,F),E));",
+				"(((A,C),B),((D,F),E));",
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			trees := DisplayedTrees(td, test.branches)
+			if len(trees) != len(test.expected) {
+				t.Fatalf("got %d trees, expected %d", len(trees), len(test.expected))
+			}
+			for i, tre := range trees {
+				if result := tre.Newick(); result != test.expected[i] {
+					t.Errorf("tree %d: %s != %s", i, result, test.expected[i])
+				}
+				for id, n := range tre.Nodes() {
+					if n.Id() != id {
+						t.Errorf("tree %d: node ids are not continuous", i)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package graphs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+type xmlPhylogeny struct {
+	XMLName   xml.Name           `xml:"phylogeny"`
+	Rooted    bool               `xml:"rooted,attr"`
+	Clade     *xmlClade          `xml:"clade"`
+	Relations []xmlCladeRelation `xml:"clade_relation"`
+}
+
+type xmlClade struct {
+	IDSource   string        `xml:"id_source,attr,omitempty"`
+	Name       string        `xml:"name,omitempty"`
+	Properties []xmlProperty `xml:"property"`
+	Clades     []*xmlClade   `xml:"clade"`
+}
+
+type xmlProperty struct {
+	Ref       string `xml:"ref,attr"`
+	Datatype  string `xml:"datatype,attr"`
+	AppliesTo string `xml:"applies_to,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type xmlCladeRelation struct {
+	IDRef0     string         `xml:"id_ref_0,attr"`
+	IDRef1     string         `xml:"id_ref_1,attr"`
+	Type       string         `xml:"type,attr"`
+	Confidence *xmlConfidence `xml:"confidence"`
+}
+
+type xmlConfidence struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// PhyloXML phylogeny element of the network (without the enclosing phyloxml
+// document). The tree part is written as nested clades, keeping the nodes
+// that reticulations attach to, and each reticulation as a clade_relation of
+// type "hybridization" from the donor clade (id_source "donor_H1") to the
+// hybrid clade (id_source "hybrid_H1"). If Support is set, it is the
+// confidence of the relation, and if Gamma is set, the inheritance
+// probability of the reticulation edge is a camus:gamma property of the
+// hybrid clade.
+func (ntw *Network) PhyloXML() string {
+	ids := make(map[*tree.Node]string)
+	donors, hybrids := make(map[string]string), make(map[string]string)
+	var labels []string
+	var clade func(cur, prev *tree.Node) *xmlClade
+	clade = func(cur, prev *tree.Node) *xmlClade {
+		c := &xmlClade{Name: cur.Name()}
+		if label := cur.Name(); strings.Contains(label, "#") && !cur.Tip() {
+			hybrids[label] = nodeXMLID(ids, cur, "hybrid", label)
+			if g, ok := ntw.Gamma[label]; ok && !math.IsNaN(g) {
+				c.Properties = append(c.Properties, xmlProperty{
+					Ref: "camus:gamma", Datatype: "xsd:double", AppliesTo: "clade",
+					Value: strconv.FormatFloat(g, 'f', 4, 64),
+				})
+			}
+		}
+		for _, n := range cur.Neigh() {
+			if n == prev {
+				continue
+			}
+			if label := n.Name(); n.Tip() && strings.Contains(label, "#") {
+				if label != "####" {
+					donors[label] = nodeXMLID(ids, cur, "donor", label)
+					labels = append(labels, label)
+				}
+				continue
+			}
+			c.Clades = append(c.Clades, clade(n, cur))
+		}
+		c.IDSource = ids[cur]
+		return c
+	}
+	phylogeny := xmlPhylogeny{Rooted: true, Clade: clade(ntw.NetTree.Root(), nil)}
+	for _, label := range labels {
+		hybrid, ok := hybrids[label]
+		if !ok {
+			continue
+		}
+		rel := xmlCladeRelation{IDRef0: donors[label], IDRef1: hybrid, Type: "hybridization"}
+		if s, ok := ntw.Support[label]; ok && !math.IsNaN(s) {
+			rel.Confidence = &xmlConfidence{Type: "support", Value: strconv.FormatFloat(s, 'f', 4, 64)}
+		}
+		phylogeny.Relations = append(phylogeny.Relations, rel)
+	}
+	out, err := xml.MarshalIndent(phylogeny, "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("error writing network as phyloxml: %s", err))
+	}
+	return string(out)
+}
+
+// Id of node n in the phyloxml, made from role and the reticulation label
+// the first time the node is seen (a node can be the end of more than one
+// reticulation)
+func nodeXMLID(ids map[*tree.Node]string, n *tree.Node, role, label string) string {
+	if id, ok := ids[n]; ok {
+		return id
+	}
+	id := role + "_" + strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return -1
+	}, label)
+	ids[n] = id
+	return id
+}
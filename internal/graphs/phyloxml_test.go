@@ -0,0 +1,69 @@
+package graphs
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+func TestNetworkPhyloXML(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("[&R]((A,(B,(C,F)a)b)c,(D,E)d)e;")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree; test is written incorrectly")
+	}
+	if err := constTree.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(constTree, nil)
+	id := func(name string) int {
+		nodes, err := constTree.SelectNodes(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodes[0].Id()
+	}
+	ntw := MakeLabeledNetwork(td, map[string]Branch{"#H1": {IDs: [2]int{id("F"), id("E")}}})
+	ntw.Support = map[string]float64{"#H1": 0.81}
+	ntw.Gamma = map[string]float64{"#H1": 0.3}
+	var phylogeny xmlPhylogeny
+	if err := xml.Unmarshal([]byte(ntw.PhyloXML()), &phylogeny); err != nil {
+		t.Fatalf("phyloxml cannot be read back: %s", err)
+	}
+	expected := xmlCladeRelation{IDRef0: "donor_H1", IDRef1: "hybrid_H1", Type: "hybridization",
+		Confidence: &xmlConfidence{Type: "support", Value: "0.8100"}}
+	if len(phylogeny.Relations) != 1 || phylogeny.Relations[0].IDRef0 != expected.IDRef0 ||
+		phylogeny.Relations[0].IDRef1 != expected.IDRef1 || phylogeny.Relations[0].Type != expected.Type ||
+		*phylogeny.Relations[0].Confidence != *expected.Confidence {
+		t.Errorf("got relations %+v, expected %+v", phylogeny.Relations, expected)
+	}
+	clades := make(map[string]*xmlClade)
+	var tips []string
+	var walk func(c *xmlClade)
+	walk = func(c *xmlClade) {
+		if c.IDSource != "" {
+			clades[c.IDSource] = c
+		}
+		if len(c.Clades) == 0 {
+			tips = append(tips, c.Name)
+		}
+		for _, child := range c.Clades {
+			walk(child)
+		}
+	}
+	walk(phylogeny.Clade)
+	if got := strings.Join(tips, ","); got != "A,B,C,F,D,E" {
+		t.Errorf("got tips %s, expected A,B,C,F,D,E", got)
+	}
+	donor, hybrid := clades["donor_H1"], clades["hybrid_H1"]
+	if donor == nil || len(donor.Clades) != 1 || donor.Clades[0].Name != "F" {
+		t.Errorf("donor clade should be above F, got %+v", donor)
+	}
+	if hybrid == nil || hybrid.Name != "#H1" || len(hybrid.Clades) != 1 || hybrid.Clades[0].Name != "E" {
+		t.Errorf("hybrid clade should be above E, got %+v", hybrid)
+	}
+	if hybrid != nil && (len(hybrid.Properties) != 1 || hybrid.Properties[0].Value != "0.3000") {
+		t.Errorf("hybrid clade should have gamma 0.3000, got %+v", hybrid.Properties)
+	}
+}
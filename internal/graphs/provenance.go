@@ -0,0 +1,62 @@
+package graphs
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Count of a quartet topology from one gene tree
+type GeneCount struct {
+	Gene  uint32 // index of the gene tree, in the order the gene trees were read
+	Count uint32 // count of the topology from the gene tree (weighted like the quartet counts)
+}
+
+// Gene trees each quartet topology was counted from, as a posting list per
+// topology. Lists are sorted by gene once Sort is called. Not safe for
+// concurrent use.
+type QuartetProvenance struct {
+	postings map[Quartet][]GeneCount
+}
+
+func NewQuartetProvenance() *QuartetProvenance {
+	return &QuartetProvenance{postings: make(map[Quartet][]GeneCount)}
+}
+
+// Records count of q from gene tree gene
+func (p *QuartetProvenance) Add(q Quartet, gene int, count uint32) {
+	p.postings[q] = append(p.postings[q], GeneCount{Gene: uint32(gene), Count: count})
+}
+
+// Moves the postings of other into p; the two must not share topologies
+func (p *QuartetProvenance) Merge(other *QuartetProvenance) {
+	for q, genes := range other.postings {
+		p.postings[q] = genes
+	}
+	other.postings = make(map[Quartet][]GeneCount)
+}
+
+// Sorts each posting list by gene, merging counts from the same gene
+func (p *QuartetProvenance) Sort() {
+	for q, genes := range p.postings {
+		slices.SortFunc(genes, func(a, b GeneCount) int { return cmp.Compare(a.Gene, b.Gene) })
+		merged := genes[:0]
+		for _, g := range genes {
+			if n := len(merged); n > 0 && merged[n-1].Gene == g.Gene {
+				merged[n-1].Count += g.Count
+				continue
+			}
+			merged = append(merged, g)
+		}
+		p.postings[q] = slices.Clip(merged)
+	}
+}
+
+// Gene trees q was counted from (nil if none); the list must not be modified
+func (p *QuartetProvenance) Genes(q Quartet) []GeneCount {
+	return p.postings[q]
+}
+
+// Number of topologies with a posting list
+func (p *QuartetProvenance) Len() int {
+	return len(p.postings)
+}
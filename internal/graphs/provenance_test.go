@@ -0,0 +1,33 @@
+package graphs
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestQuartetProvenance(t *testing.T) {
+	q1 := makeQuartet([4]int16{0, 1, 2, 3}, Qtopo1)
+	q2 := makeQuartet([4]int16{0, 1, 2, 4}, Qtopo2)
+	p, other := NewQuartetProvenance(), NewQuartetProvenance()
+	p.Add(q1, 3, 1)
+	p.Add(q1, 0, 2)
+	p.Add(q1, 3, 1) // same gene again, e.g., from another branch
+	other.Add(q2, 1, 5)
+	p.Merge(other)
+	p.Sort()
+	if other.Len() != 0 {
+		t.Errorf("merged provenance still has %d topologies", other.Len())
+	}
+	if p.Len() != 2 {
+		t.Errorf("got %d topologies, expected 2", p.Len())
+	}
+	if expected := []GeneCount{{Gene: 0, Count: 2}, {Gene: 3, Count: 2}}; !slices.Equal(p.Genes(q1), expected) {
+		t.Errorf("got %v for q1, expected %v", p.Genes(q1), expected)
+	}
+	if expected := []GeneCount{{Gene: 1, Count: 5}}; !slices.Equal(p.Genes(q2), expected) {
+		t.Errorf("got %v for q2, expected %v", p.Genes(q2), expected)
+	}
+	if genes := p.Genes(makeQuartet([4]int16{0, 1, 2, 3}, Qtopo3)); genes != nil {
+		t.Errorf("got %v for an unseen topology, expected nil", genes)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"iter"
+	"math"
+	"strconv"
 
 	"github.com/evolbioinfo/gotree/tree"
 )
@@ -108,23 +110,150 @@ func sortTaxa(arr *[4]int16) uint8 {
 	return topo
 }
 
-// Returns hashmap containing quartets from tree
-func QuartetsFromTree(tre, constTree *tree.Tree) (map[Quartet]uint32, error) {
-	tre.UnRoot() // some quartets are missed if tree is rooted
-	treeQuartets := make(map[Quartet]uint32)
+// Returns table containing quartets from tree (tre is not modified)
+func QuartetsFromTree(tre, constTree *tree.Tree) (*QuartetTable, error) {
+	tre = Unrooted(tre)
+	treeQuartets := NewQuartetTable(0)
 	taxaIDsMap, err := MapIDsFromConstTree(tre, constTree)
 	if err != nil {
 		return nil, err
 	}
 	tre.Quartets(false, func(q *tree.Quartet) {
-		treeQuartets[QuartetFromTreeQ(q, taxaIDsMap)] = 1
+		treeQuartets.Set(QuartetFromTreeQ(q, taxaIDsMap), 1)
 	})
 	return treeQuartets, nil
 }
 
+// Same as QuartetsFromTree, but the count of each quartet is weight(length),
+// where length is the sum of the lengths of the branches separating its two
+// pairs of taxa (i.e., the internal branch of the quartet tree). Missing
+// branch lengths count as zero, and quartets with weight zero are left out.
+func WeightedQuartetsFromTree(tre, constTree *tree.Tree, weight func(length float64) uint32) (*QuartetTable, error) {
+	tre = Unrooted(tre)
+	treeQuartets := NewQuartetTable(0)
+	taxaIDsMap, err := MapIDsFromConstTree(tre, constTree)
+	if err != nil {
+		return nil, err
+	}
+	dist := tipDistances(tre)
+	tre.Quartets(false, func(q *tree.Quartet) {
+		length := (dist[q.T1][q.T3] + dist[q.T2][q.T4] - dist[q.T1][q.T2] - dist[q.T3][q.T4]) / 2
+		if w := weight(length); w != 0 {
+			treeQuartets.Set(QuartetFromTreeQ(q, taxaIDsMap), w)
+		}
+	})
+	return treeQuartets, nil
+}
+
+// Same as QuartetsFromTree for a tree that may have more than one copy of a
+// taxon (a MUL tree, e.g., from gene duplication). Every choice of one copy of
+// each of four distinct taxa gives a quartet, and each topology of those taxa
+// is counted as scale times the fraction of the choices that give it, so that
+// each set of four taxa counts (at most) scale no matter how many copies
+// there are. Topologies whose count rounds to zero are left out.
+func MulQuartetsFromTree(tre, constTree *tree.Tree, scale uint32) (*QuartetTable, error) {
+	tre = tre.Clone()
+	tips := tre.Tips()
+	copies := make(map[string]int)
+	taxa := make([]string, len(tips))
+	for i, tip := range tips {
+		taxa[i] = tip.Name()
+		copies[tip.Name()]++
+		tip.SetName(strconv.Itoa(i)) // unique, so that the tree can be indexed
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		return nil, err
+	}
+	copyMap := make([]int16, len(tips))  // tip index -> copy (the tip's position in tips)
+	constMap := make([]int16, len(tips)) // tip index -> constraint tree tip index
+	nCopies := make([]uint32, len(tips)) // tip index -> copies of its taxon
+	for i, tip := range tips {
+		ti, err := tre.TipIndex(tip.Name())
+		if err != nil {
+			panic(err)
+		}
+		constID, err := constTree.TipIndex(taxa[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w, %s", ErrTipNameMismatch, err.Error())
+		}
+		copyMap[ti], constMap[ti], nCopies[ti] = int16(i), int16(constID), uint32(copies[taxa[i]])
+	}
+	seen := NewQuartetTable(0)    // quartets of copies, each counted once (not once per inducing branch)
+	found := NewQuartetTable(0)   // choices of copies giving each topology
+	choices := NewQuartetTable(0) // choices of copies of each set of four taxa
+	Unrooted(tre).Quartets(false, func(tq *tree.Quartet) {
+		if cq := QuartetFromTreeQ(tq, copyMap); !seen.Contains(cq) {
+			seen.Add(cq, 1)
+		} else {
+			return
+		}
+		ids := [...]int16{constMap[tq.T1], constMap[tq.T2], constMap[tq.T3], constMap[tq.T4]}
+		if ids[0] == ids[1] || ids[0] == ids[2] || ids[0] == ids[3] || ids[1] == ids[2] || ids[1] == ids[3] || ids[2] == ids[3] {
+			return // two copies of the same taxon
+		}
+		q := QuartetFromTreeQ(tq, constMap)
+		found.Add(q, 1)
+		choices.Set(q.TaxaSet(), nCopies[tq.T1]*nCopies[tq.T2]*nCopies[tq.T3]*nCopies[tq.T4])
+	})
+	treeQuartets := NewQuartetTable(found.Len())
+	for q, n := range found.All() {
+		if c := uint32(math.Round(float64(scale) * float64(n) / float64(choices.Get(q.TaxaSet())))); c != 0 {
+			treeQuartets.Set(q, c)
+		}
+	}
+	return treeQuartets, nil
+}
+
+// Path length between every pair of tips, indexed by tip index
+func tipDistances(tre *tree.Tree) [][]float64 {
+	tips := tre.Tips()
+	dist := make([][]float64, len(tips))
+	tipIndex := func(n *tree.Node) int {
+		i, err := tre.TipIndex(n.Name())
+		if err != nil {
+			panic(err)
+		}
+		return i
+	}
+	for _, tip := range tips {
+		row := make([]float64, len(tips))
+		var walk func(cur, prev *tree.Node, d float64)
+		walk = func(cur, prev *tree.Node, d float64) {
+			if cur.Tip() {
+				row[tipIndex(cur)] = d
+			}
+			for i, n := range cur.Neigh() {
+				if n != prev {
+					walk(n, cur, d+max(cur.Edges()[i].Length(), 0))
+				}
+			}
+		}
+		walk(tip, nil, 0)
+		dist[tipIndex(tip)] = row
+	}
+	return dist
+}
+
+// Returns tre if it is unrooted, and otherwise an unrooted copy of it, since
+// some quartets are missed if the tree is rooted. Quartets do not depend on the
+// root, so this lets rooted trees keep their root.
+func Unrooted(tre *tree.Tree) *tree.Tree {
+	if !tre.Rooted() {
+		return tre
+	}
+	tre = tre.Clone()
+	tre.UnRoot()
+	return tre
+}
+
 // Create quartet from gotree *tree.Quartet
 func QuartetFromTreeQ(tq *tree.Quartet, constMap []int16) Quartet {
-	taxaIDs := [...]int16{constMap[tq.T1], constMap[tq.T2], constMap[tq.T3], constMap[tq.T4]}
+	return QuartetFromSplit(constMap[tq.T1], constMap[tq.T2], constMap[tq.T3], constMap[tq.T4])
+}
+
+// Create quartet ab|cd from constraint tree tip ids
+func QuartetFromSplit(a, b, c, d int16) Quartet {
+	taxaIDs := [...]int16{a, b, c, d}
 	return makeQuartet(taxaIDs, setTopology(&taxaIDs))
 }
 
@@ -176,6 +305,12 @@ func (q Quartet) AllQuartets() []Quartet {
 	}
 }
 
+// Quartet standing for q's set of four taxa (its first topology), for keying
+// tables by taxa regardless of topology
+func (q Quartet) TaxaSet() Quartet {
+	return q.AllQuartets()[0]
+}
+
 // Not efficient, do no use except for testing !!!
 func (q *Quartet) String(tre *tree.Tree) string {
 	names := make(map[uint16]string)
@@ -197,12 +332,12 @@ func (q *Quartet) String(tre *tree.Tree) string {
 	return qString
 }
 
-func QSetToString(qSet map[Quartet]uint32, tre *tree.Tree) string {
-	if len(qSet) == 0 {
+func QSetToString(qSet *QuartetTable, tre *tree.Tree) string {
+	if qSet.Len() == 0 {
 		return "{}"
 	}
 	str := "{"
-	for q, c := range qSet {
+	for q, c := range qSet.All() {
 		str += fmt.Sprintf("%s:%d, ", q.String(tre), c)
 	}
 	return str[:len(str)-2] + "}"
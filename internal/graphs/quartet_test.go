@@ -2,7 +2,6 @@ package graphs
 
 import (
 	"fmt"
-	"reflect"
 	"slices"
 	"strings"
 	"testing"
@@ -167,18 +166,138 @@ func TestQuartetsFromTree(t *testing.T) {
 			if err != nil {
 				t.Error(err)
 			}
+			rooted := tre.Rooted()
 			qSet, err := QuartetsFromTree(tre, tre)
 			if err != nil {
 				t.Error(err)
 			}
+			if tre.Rooted() != rooted {
+				t.Errorf("tree rooted %t after reading quartets, expected %t", tre.Rooted(), rooted)
+			}
 			expectedQSet := stringListToQMap(t, test.qSet, tre)
-			if !reflect.DeepEqual(qSet, expectedQSet) {
+			if !qSet.Equal(expectedQSet) {
 				t.Errorf("actual %s != expected %s", QSetToString(qSet, tre), QSetToString(expectedQSet, tre))
 			}
 		})
 	}
 }
 
+func TestMulQuartetsFromTree(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((a,b),(c,(d,e)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err = constTree.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		tre      string
+		expected map[string]uint32
+	}{
+		{
+			name:     "single copy",
+			tre:      "((a,b),(c,d));",
+			expected: map[string]uint32{"((a,b),(c,d));": 10},
+		},
+		{
+			name: "two copies",
+			tre:  "((a,b),(c,(d,a)));",
+			expected: map[string]uint32{
+				"((a,b),(c,d));": 5,
+				"((a,d),(b,c));": 5,
+			},
+		},
+		{
+			name: "copies agree",
+			tre:  "(((a,a),b),(c,d));",
+			expected: map[string]uint32{
+				"((a,b),(c,d));": 10,
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader(test.tre)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			qSet, err := MulQuartetsFromTree(tre, constTree, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := NewQuartetTable(0)
+			for nw, count := range test.expected {
+				for q := range stringListToQMap(t, []string{nw}, constTree).All() {
+					expected.Set(q, count)
+				}
+			}
+			if !qSet.Equal(expected) {
+				t.Errorf("actual %s != expected %s", QSetToString(qSet, constTree), QSetToString(expected, constTree))
+			}
+		})
+	}
+}
+
+func TestWeightedQuartetsFromTree(t *testing.T) {
+	nwk := "((((a:1,b:1):2,c:1):3,d:1):1,f:1);"
+	testCases := []struct {
+		name     string
+		weight   func(float64) uint32
+		expected map[string]uint32
+	}{
+		{
+			name:   "length",
+			weight: func(length float64) uint32 { return uint32(length) },
+			expected: map[string]uint32{
+				"(((a,b),c),d);": 2,
+				"(((a,b),c),f);": 2,
+				"(((a,b),d),f);": 5,
+				"(((a,c),d),f);": 3,
+				"(((b,c),d),f);": 3,
+			},
+		},
+		{
+			name: "zero weights",
+			weight: func(length float64) uint32 {
+				if length < 3 {
+					return 0
+				}
+				return 1
+			},
+			expected: map[string]uint32{
+				"(((a,b),d),f);": 1,
+				"(((a,c),d),f);": 1,
+				"(((b,c),d),f);": 1,
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			if err = tre.UpdateTipIndex(); err != nil {
+				t.Fatal(err)
+			}
+			qSet, err := WeightedQuartetsFromTree(tre, tre, test.weight)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := NewQuartetTable(0)
+			for nw, count := range test.expected {
+				for q := range stringListToQMap(t, []string{nw}, tre).All() {
+					expected.Set(q, count)
+				}
+			}
+			if !qSet.Equal(expected) {
+				t.Errorf("actual %s != expected %s", QSetToString(qSet, tre), QSetToString(expected, tre))
+			}
+		})
+	}
+}
+
 func (tq *TestQuartet) Topology(tre *tree.Tree) (uint8, error) {
 	ids := make([]int, 4)
 	partition := make(map[int]bool)
@@ -226,9 +345,9 @@ func (tq *TestQuartet) String() string {
 	return fmt.Sprintf("%s%s|%s%s", tq.set1[0], tq.set1[1], tq.set2[0], tq.set2[1])
 }
 
-func stringListToQMap(t *testing.T, list []string, tre *tree.Tree) map[Quartet]uint32 {
+func stringListToQMap(t *testing.T, list []string, tre *tree.Tree) *QuartetTable {
 	t.Helper()
-	qSet := make(map[Quartet]uint32)
+	qSet := NewQuartetTable(len(list))
 	for _, nwk := range list {
 		tr, err := newick.NewParser(strings.NewReader(nwk)).Parse()
 		if err != nil {
@@ -238,7 +357,7 @@ func stringListToQMap(t *testing.T, list []string, tre *tree.Tree) map[Quartet]u
 		if err != nil {
 			t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
 		}
-		qSet[q] += 1
+		qSet.Add(q, 1)
 	}
 	return qSet
 }
@@ -0,0 +1,197 @@
+package graphs
+
+import (
+	"cmp"
+	"iter"
+	"slices"
+)
+
+const (
+	minTableSize = 16
+	hashMult     = 0x9E3779B97F4A7C15 // 2^64 / golden ratio (fibonacci hashing)
+)
+
+// Open-addressing hash table (linear probing) mapping quartets to counts.
+// Compared to map[Quartet]uint32, entries are stored in two flat arrays,
+// which has much lower memory overhead per entry. NilQuartet marks empty
+// slots; it is never a valid quartet since the topology bits are never zero.
+type QuartetTable struct {
+	keys   []Quartet
+	counts []uint32
+	n      int   // number of entries
+	shift  uint8 // 64 - log2(len(keys))
+	sorted []int // cached slot indices of keys in sorted order (nil if stale)
+}
+
+// Makes table with room for at least capacity entries before growing
+func NewQuartetTable(capacity int) *QuartetTable {
+	size := minTableSize
+	for size*3/4 < capacity {
+		size *= 2
+	}
+	t := &QuartetTable{}
+	t.init(size)
+	return t
+}
+
+func (t *QuartetTable) init(size int) {
+	t.keys = make([]Quartet, size)
+	t.counts = make([]uint32, size)
+	t.n = 0
+	t.shift = 64
+	for s := size; s > 1; s >>= 1 {
+		t.shift--
+	}
+	t.sorted = nil
+}
+
+func (t *QuartetTable) slot(q Quartet) int {
+	return int((uint64(q) * hashMult) >> t.shift)
+}
+
+// Returns the slot containing q, or the empty slot where it would be inserted
+func (t *QuartetTable) find(q Quartet) (int, bool) {
+	mask := len(t.keys) - 1
+	for i := t.slot(q); ; i = (i + 1) & mask {
+		switch t.keys[i] {
+		case q:
+			return i, true
+		case NilQuartet:
+			return i, false
+		}
+	}
+}
+
+// Adds c to the count of q (inserting q if it is not in the table)
+func (t *QuartetTable) Add(q Quartet, c uint32) {
+	if q == NilQuartet {
+		panic("cannot add nil quartet to quartet table")
+	}
+	i, ok := t.find(q)
+	if !ok {
+		if (t.n+1)*4 > len(t.keys)*3 {
+			t.grow()
+			i, _ = t.find(q)
+		}
+		t.keys[i] = q
+		t.n++
+		t.sorted = nil
+	}
+	t.counts[i] += c
+}
+
+// Sets the count of q (inserting q if it is not in the table)
+func (t *QuartetTable) Set(q Quartet, c uint32) {
+	if i, ok := t.find(q); ok {
+		t.counts[i] = c
+		return
+	}
+	t.Add(q, c)
+}
+
+func (t *QuartetTable) grow() {
+	keys, counts := t.keys, t.counts
+	t.init(2 * len(keys))
+	for i, q := range keys {
+		if q != NilQuartet {
+			j, _ := t.find(q)
+			t.keys[j], t.counts[j] = q, counts[i]
+			t.n++
+		}
+	}
+}
+
+// Returns count of q (zero if q is not in the table)
+func (t *QuartetTable) Get(q Quartet) uint32 {
+	if t == nil || t.n == 0 {
+		return 0
+	}
+	if i, ok := t.find(q); ok {
+		return t.counts[i]
+	}
+	return 0
+}
+
+// Returns true if q is in the table
+func (t *QuartetTable) Contains(q Quartet) bool {
+	if t == nil || t.n == 0 {
+		return false
+	}
+	_, ok := t.find(q)
+	return ok
+}
+
+// Removes q from the table (backward shift deletion, so no tombstones are needed)
+func (t *QuartetTable) Delete(q Quartet) {
+	i, ok := t.find(q)
+	if !ok {
+		return
+	}
+	mask := len(t.keys) - 1
+	for j := (i + 1) & mask; t.keys[j] != NilQuartet; j = (j + 1) & mask {
+		home := t.slot(t.keys[j])
+		if (j-home)&mask >= (j-i)&mask { // entry at j can be moved back to the hole at i
+			t.keys[i], t.counts[i] = t.keys[j], t.counts[j]
+			i = j
+		}
+	}
+	t.keys[i], t.counts[i] = NilQuartet, 0
+	t.n--
+	t.sorted = nil
+}
+
+// Number of quartets in the table
+func (t *QuartetTable) Len() int {
+	if t == nil {
+		return 0
+	}
+	return t.n
+}
+
+// Iterates over quartets and their counts in ascending order of quartet. The
+// sorted order is cached, so the table must not be modified during iteration,
+// and iterating is not safe for concurrent use after the table is modified.
+func (t *QuartetTable) All() iter.Seq2[Quartet, uint32] {
+	return func(yield func(Quartet, uint32) bool) {
+		if t == nil {
+			return
+		}
+		if t.sorted == nil {
+			t.sorted = make([]int, 0, t.n)
+			for i, q := range t.keys {
+				if q != NilQuartet {
+					t.sorted = append(t.sorted, i)
+				}
+			}
+			slices.SortFunc(t.sorted, func(i, j int) int { return cmp.Compare(t.keys[i], t.keys[j]) })
+		}
+		for _, i := range t.sorted {
+			if !yield(t.keys[i], t.counts[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Returns true if both tables contain the same quartets with the same counts
+func (t *QuartetTable) Equal(other *QuartetTable) bool {
+	if t.Len() != other.Len() {
+		return false
+	}
+	for q, c := range t.All() {
+		if !other.Contains(q) || other.Get(q) != c {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns deep copy of the table
+func (t *QuartetTable) Clone() *QuartetTable {
+	return &QuartetTable{
+		keys:   slices.Clone(t.keys),
+		counts: slices.Clone(t.counts),
+		n:      t.n,
+		shift:  t.shift,
+	}
+}
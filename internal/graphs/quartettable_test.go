@@ -0,0 +1,80 @@
+package graphs
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestQuartetTable(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	table := NewQuartetTable(0)
+	expected := make(map[Quartet]uint32)
+	quartets := make([]Quartet, 0)
+	for range 5000 {
+		taxa := [4]int16{int16(rng.IntN(100)), int16(rng.IntN(100)), int16(rng.IntN(100)), int16(rng.IntN(100))}
+		q := makeQuartet(taxa, Qtopo1)
+		c := uint32(rng.IntN(5) + 1)
+		table.Add(q, c)
+		expected[q] += c
+		quartets = append(quartets, q)
+	}
+	for i, q := range quartets { // delete every third quartet
+		if i%3 == 0 {
+			table.Delete(q)
+			delete(expected, q)
+		}
+	}
+	table.Delete(makeQuartet([4]int16{200, 201, 202, 203}, Qtopo2)) // not in table
+	if table.Len() != len(expected) {
+		t.Fatalf("table has %d entries, expected %d", table.Len(), len(expected))
+	}
+	for q, c := range expected {
+		if !table.Contains(q) || table.Get(q) != c {
+			t.Errorf("table count %d != expected %d", table.Get(q), c)
+		}
+	}
+	var prev Quartet
+	n := 0
+	for q, c := range table.All() {
+		if q <= prev {
+			t.Errorf("quartets not iterated in sorted order")
+		}
+		if expected[q] != c {
+			t.Errorf("iterated count %d != expected %d", c, expected[q])
+		}
+		prev = q
+		n++
+	}
+	if n != len(expected) {
+		t.Errorf("iterated over %d quartets, expected %d", n, len(expected))
+	}
+	clone := table.Clone()
+	if !clone.Equal(table) {
+		t.Errorf("clone is not equal to table")
+	}
+	clone.Set(prev, 1000)
+	if clone.Equal(table) || table.Get(prev) == 1000 {
+		t.Errorf("modifying clone modified original table")
+	}
+}
+
+func TestQuartetTable_Sorted(t *testing.T) {
+	quartets := []Quartet{
+		makeQuartet([4]int16{5, 6, 7, 8}, Qtopo3),
+		makeQuartet([4]int16{1, 2, 3, 4}, Qtopo1),
+		makeQuartet([4]int16{1, 2, 3, 4}, Qtopo2),
+	}
+	table := NewQuartetTable(len(quartets))
+	for _, q := range quartets {
+		table.Add(q, 1)
+	}
+	result := make([]Quartet, 0)
+	for q := range table.All() {
+		result = append(result, q)
+	}
+	slices.Sort(quartets)
+	if !slices.Equal(result, quartets) {
+		t.Errorf("result %v != expected %v", result, quartets)
+	}
+}
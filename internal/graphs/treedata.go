@@ -3,37 +3,59 @@
 package graphs
 
 import (
-	"github.com/bits-and-blooms/bitset"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync"
+
 	"github.com/evolbioinfo/gotree/tree"
 )
 
+var ErrNotClade = errors.New("taxa are not a clade of the constraint tree")
+
 // Expanded tree struct containing necessary preprocessed data
 type TreeData struct {
 	tree.Tree
-	Children       [][]*tree.Node      // Children for each node
-	IdToNodes      []*tree.Node        // Mapping between id and node pointer
-	quartetSet     [][]Quartet         // Quartets relevant for each subtree
-	quartetCounts  *map[Quartet]uint32 // Count of each unique quartet topology
-	Depths         []int               // Distance from all nodes to the root
-	NumLeavesBelow []uint64            // Number of leaves below node
-	NLeaves        int                 // Number of leaves
-	leafsets       []*bitset.BitSet    // Leaves under each node
-	lca            [][]int             // LCA for each pair of node id
-	tipIndexMap    map[uint16]int      // Tip index to node id map
+	Children       [][]*tree.Node // Children for each node
+	IdToNodes      []*tree.Node   // Mapping between id and node pointer
+	quartetIndex   *QuartetIndex  // Quartets relevant for each subtree
+	quartetCounts  *QuartetTable  // Count of each unique quartet topology
+	Depths         []int          // Distance from all nodes to the root
+	NumLeavesBelow []uint64       // Number of leaves below node
+	NLeaves        int            // Number of leaves
+	leafsets       *leafIntervals // Leaves under each node
+	lca            *lcaTable      // LCA of any pair of node ids
+	tipIndexMap    map[uint16]int // Tip index to node id map
+
+	ConstraintWeight float64 // weight quartets displayed by the tree are counted at (0 if they are not counted)
+
+	occupancy  *occupancyData     // gene trees with each set of four taxa (nil if not tracked)
+	provenance *QuartetProvenance // gene trees each quartet topology was counted from (nil if not kept)
+}
+
+// Number of gene trees with a resolved quartet on each set of four taxa, and
+// the sets mapped to vertices (built on first use, since only some scorers
+// need them)
+type occupancyData struct {
+	counts *QuartetTable // keyed by Quartet.TaxaSet
+	once   sync.Once
+	index  *QuartetIndex
 }
 
 // Preprocess tree data and makes TreeData struct. Pass nil for qCounts if you
 // don't need quartets.
-func MakeTreeData(tre *tree.Tree, qCounts map[Quartet]uint32) *TreeData {
+func MakeTreeData(tre *tree.Tree, qCounts *QuartetTable) *TreeData {
 	children := children(tre)
 	below := countLeavesBelow(tre, children)
 	leafsets := calcLeafset(tre, children)
 	lca := calcLCAs(tre, children)
 	depths := calcDepths(tre)
 	idMap := mapIdToNodes(tre)
-	var qSets [][]Quartet
+	var qIndex *QuartetIndex
 	if qCounts != nil {
-		qSets = mapQuartetsToVertices(tre, qCounts, leafsets)
+		qIndex = mapQuartetsToVertices(tre, qCounts, children, lca)
 	}
 	tipIndexMap := makeTipIndexMap(tre)
 	return &TreeData{Tree: *tre,
@@ -43,8 +65,8 @@ func MakeTreeData(tre *tree.Tree, qCounts map[Quartet]uint32) *TreeData {
 		IdToNodes:      idMap,
 		Depths:         depths,
 		NumLeavesBelow: below,
-		quartetSet:     qSets,
-		quartetCounts:  &qCounts,
+		quartetIndex:   qIndex,
+		quartetCounts:  qCounts,
 		tipIndexMap:    tipIndexMap,
 		NLeaves:        len(tre.AllTipNames()),
 	}
@@ -103,66 +125,119 @@ func GetChildren(node *tree.Node) []*tree.Node {
 	return children
 }
 
-// Calculates the leafset for every node
-func calcLeafset(tre *tree.Tree, children [][]*tree.Node) []*bitset.BitSet {
+// Leafsets of every node stored as intervals. Tips are ranked in DFS order, so
+// the leaves below each node are exactly the tips ranked lo through hi.
+type leafIntervals struct {
+	rank []int32  // DFS rank of each tip (by tip index)
+	tips []uint16 // tip index of each rank
+	lo   []int32  // lowest rank below each node (by id)
+	hi   []int32  // highest rank below each node (by id)
+}
+
+// Ranks the tips in DFS order and finds the interval of ranks below every node
+func calcLeafset(tre *tree.Tree, children [][]*tree.Node) *leafIntervals {
 	nLeaves, err := tre.NbTips()
 	if err != nil {
 		panic(err)
 	}
 	nNodes := len(tre.Nodes())
-	leafset := make([]*bitset.BitSet, nNodes)
-	tre.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) (keep bool) {
-		leafset[cur.Id()] = bitset.New(uint(nLeaves))
+	li := &leafIntervals{
+		rank: make([]int32, nLeaves),
+		tips: make([]uint16, 0, nLeaves),
+		lo:   make([]int32, nNodes),
+		hi:   make([]int32, nNodes),
+	}
+	var visit func(cur *tree.Node)
+	visit = func(cur *tree.Node) {
+		id := cur.Id()
+		li.lo[id] = int32(len(li.tips))
 		if cur.Tip() {
-			leafset[cur.Id()].Set(uint(cur.TipIndex()))
+			li.rank[cur.TipIndex()] = int32(len(li.tips))
+			li.tips = append(li.tips, uint16(cur.TipIndex()))
 		} else {
-			leafset[cur.Id()] = leafset[children[cur.Id()][0].Id()].Clone()
-			for i := range len(children[cur.Id()]) - 1 {
-				leafset[cur.Id()].InPlaceUnion(leafset[children[cur.Id()][i+1].Id()])
+			for _, child := range children[id] {
+				visit(child)
 			}
 		}
-		return true
-	})
-	return leafset
+		li.hi[id] = int32(len(li.tips) - 1)
+	}
+	visit(tre.Root())
+	return li
 }
 
-// Calculates the LCA for every pair of nodes
-func calcLCAs(tre *tree.Tree, children [][]*tree.Node) [][]int {
+// tip (by tip index) is below the node (by id)
+func (li *leafIntervals) contains(id int, tip uint16) bool {
+	r := li.rank[tip]
+	return li.lo[id] <= r && r <= li.hi[id]
+}
+
+// Euler tour of the tree with a sparse table for range minimum queries over
+// it, answering LCA queries in constant time with O(n log n) space
+type lcaTable struct {
+	euler  []int32   // node ids in the order they are visited (each internal node is revisited after each child)
+	first  []int32   // index in euler of each node's first visit
+	last   []int32   // index in euler of each node's last visit
+	depth  []int32   // depth of each node
+	sparse [][]int32 // sparse[j][i] is the node of least depth in euler[i : i+2^j]
+}
+
+// Calculates the Euler tour and sparse table used to find the LCA of any pair
+// of nodes
+func calcLCAs(tre *tree.Tree, children [][]*tree.Node) *lcaTable {
 	nNodes := len(tre.Nodes())
-	lca, below := make([][]int, nNodes), make([][]bool, nNodes) // below[i][j] = true means node j is below node i
-	for i := range nNodes {
-		lca[i] = make([]int, nNodes)
-		below[i] = make([]bool, nNodes)
+	lt := &lcaTable{
+		euler: make([]int32, 0, 2*nNodes-1),
+		first: make([]int32, nNodes),
+		last:  make([]int32, nNodes),
+		depth: make([]int32, nNodes),
 	}
-	tre.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) (keep bool) {
-		below[cur.Id()][cur.Id()] = true
-		lca[cur.Id()][cur.Id()] = cur.Id()
+	var visit func(cur *tree.Node, depth int32)
+	visit = func(cur *tree.Node, depth int32) {
+		id := cur.Id()
+		lt.depth[id] = depth
+		lt.first[id] = int32(len(lt.euler))
+		lt.euler = append(lt.euler, int32(id))
 		if !cur.Tip() {
-			for i := range nNodes {
-				for _, child := range children[cur.Id()] {
-					below[cur.Id()][i] = below[cur.Id()][i] || below[child.Id()][i]
-				}
-			}
-			for c1 := range children[cur.Id()] {
-				for c2 := c1 + 1; c2 < len(children[cur.Id()]); c2++ {
-					for i := range nNodes {
-						for j := range nNodes {
-							childId1 := children[cur.Id()][c1].Id()
-							childId2 := children[cur.Id()][c2].Id()
-							if below[childId1][i] && below[childId2][j] ||
-								i == cur.Id() && below[childId2][j] ||
-								i == cur.Id() && below[childId1][j] {
-								lca[i][j] = cur.Id()
-								lca[j][i] = cur.Id()
-							}
-						}
-					}
-				}
+			for _, child := range children[id] {
+				visit(child, depth+1)
+				lt.euler = append(lt.euler, int32(id))
 			}
 		}
-		return true
-	})
-	return lca
+		lt.last[id] = int32(len(lt.euler) - 1)
+	}
+	visit(tre.Root(), 0)
+	lt.sparse = [][]int32{lt.euler}
+	for j := 1; 1<<j <= len(lt.euler); j++ {
+		prev, half := lt.sparse[j-1], 1<<(j-1)
+		row := make([]int32, len(lt.euler)-1<<j+1)
+		for i := range row {
+			row[i] = lt.shallower(prev[i], prev[i+half])
+		}
+		lt.sparse = append(lt.sparse, row)
+	}
+	return lt
+}
+
+func (lt *lcaTable) shallower(n1, n2 int32) int32 {
+	if lt.depth[n2] < lt.depth[n1] {
+		return n2
+	}
+	return n1
+}
+
+// LCA of the nodes with ids n1 and n2
+func (lt *lcaTable) lca(n1, n2 int) int {
+	i, j := lt.first[n1], lt.first[n2]
+	if i > j {
+		i, j = j, i
+	}
+	level := bits.Len32(uint32(j-i+1)) - 1
+	return int(lt.shallower(lt.sparse[level][i], lt.sparse[level][j-1<<level+1]))
+}
+
+// n2 is n1 or below it
+func (lt *lcaTable) below(n1, n2 int) bool {
+	return lt.first[n1] <= lt.first[n2] && lt.last[n2] <= lt.last[n1]
 }
 
 // Calculate depths for all nodes in tree (slice index = node id)
@@ -193,32 +268,96 @@ func countLeavesBelow(tre *tree.Tree, children [][]*tree.Node) []uint64 {
 	return below
 }
 
-// Maps quartets to vertices where at least 3 taxa from the quartet exist below the vertex
-func mapQuartetsToVertices(tre *tree.Tree, qCounts map[Quartet]uint32, leafsets []*bitset.BitSet) [][]Quartet {
-	qSets := make([][]Quartet, len(tre.Nodes()))
-	n, err := tre.NbTips()
-	if err != nil {
-		panic(err)
+// Vertex to quartet index stored in compressed sparse row form: the quartets
+// for node id v are quartets[offsets[v]:offsets[v+1]]. It is read-only once
+// built, so it's shared between clones of the tree data.
+type QuartetIndex struct {
+	offsets  []int
+	quartets []Quartet
+}
+
+// Quartets mapped to node id v
+func (qi *QuartetIndex) Quartets(v int) []Quartet {
+	return qi.quartets[qi.offsets[v]:qi.offsets[v+1]:qi.offsets[v+1]]
+}
+
+// Total number of (vertex, quartet) entries in the index
+func (qi *QuartetIndex) Len() int {
+	return len(qi.quartets)
+}
+
+// Maps quartets to vertices where at least 3 taxa from the quartet exist below
+// the vertex. These vertices form the path from the lowest LCA of 3 of the
+// quartet's taxa up to the root (two vertices with 3 of the 4 taxa below them
+// share a taxon, so one is below the other), so each quartet is only added to
+// the vertices on its path.
+func mapQuartetsToVertices(tre *tree.Tree, qCounts *QuartetTable, children [][]*tree.Node, lca *lcaTable) *QuartetIndex {
+	nNodes := len(tre.Nodes())
+	tipIDs := makeTipIndexMap(tre)
+	parents := make([]int, nNodes)
+	parents[tre.Root().Id()] = -1
+	for id, cs := range children {
+		for _, child := range cs {
+			if child != nil {
+				parents[child.Id()] = id
+			}
+		}
 	}
-	tre.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) (keep bool) {
-		qSets[cur.Id()] = make([]Quartet, 0)
-		for q := range qCounts {
-			found := 0
-			for i := range 4 {
-				if q.Taxon(i) >= uint16(n) {
-					panic("cannot map quartet taxa to constraint tree")
-				} else if leafsets[cur.Id()].Test(uint(q.Taxon(i))) {
-					// } else if leafsets[cur.Id()][q.Taxa[i]] {
-					found++
-				}
+	// first pass counts entries per vertex so the flat slice is allocated once
+	starts := make([]int, 0, qCounts.Len())
+	offsets := make([]int, nNodes+1)
+	for q := range qCounts.All() {
+		start := quartetVertex(q, tipIDs, lca)
+		starts = append(starts, start)
+		for v := start; v != -1; v = parents[v] {
+			offsets[v+1]++
+		}
+	}
+	for v := range nNodes {
+		offsets[v+1] += offsets[v]
+	}
+	quartets := make([]Quartet, offsets[nNodes])
+	next := slices.Clone(offsets[:nNodes])
+	i := 0
+	for q := range qCounts.All() {
+		for v := starts[i]; v != -1; v = parents[v] {
+			quartets[next[v]] = q
+			next[v]++
+		}
+		i++
+	}
+	return &QuartetIndex{offsets: offsets, quartets: quartets}
+}
+
+// Lowest vertex with at least 3 of the quartet's taxa below it, i.e., the
+// deepest LCA of 3 of its taxa
+func quartetVertex(q Quartet, tipIDs map[uint16]int, lca *lcaTable) int {
+	var ids [4]int
+	for i := range 4 {
+		id, ok := tipIDs[q.Taxon(i)]
+		if !ok {
+			panic("cannot map quartet taxa to constraint tree")
+		}
+		ids[i] = id
+	}
+	lowest := -1
+	for skip := range 4 {
+		v := -1
+		for i, id := range ids {
+			if i == skip {
+				continue
 			}
-			if found >= 3 {
-				qSets[cur.Id()] = append(qSets[cur.Id()], q)
+			if v == -1 {
+				v = id
+			} else {
+				v = lca.lca(v, id)
 			}
 		}
-		return true
-	})
-	return qSets
+		if lowest == -1 || lca.depth[v] > lca.depth[lowest] {
+			lowest = v
+		}
+	}
+	return lowest
 }
 
 func makeTipIndexMap(tre *tree.Tree) map[uint16]int {
@@ -232,12 +371,12 @@ func makeTipIndexMap(tre *tree.Tree) map[uint16]int {
 
 // n2 (id) is in the leafset of n1 (id)
 func (td *TreeData) InLeafset(n1ID, n2ID uint16) bool {
-	return td.leafsets[n1ID].Test(uint(n2ID))
+	return td.leafsets.contains(int(n1ID), n2ID)
 }
 
 // Takes in the node ids of two nodes and returns the id of the LCA
 func (td *TreeData) LCA(n1ID, n2ID int) int {
-	return td.lca[n1ID][n2ID]
+	return td.lca.lca(n1ID, n2ID)
 }
 
 // Finds node's sibling -- assumes binary tree
@@ -255,67 +394,192 @@ func (td *TreeData) Sibling(node *tree.Node) *tree.Node {
 	panic("failed to find node sibling")
 }
 
+// Names of the taxa below n, sorted
+func (td *TreeData) LeafsetNames(n *tree.Node) []string {
+	li := td.leafsets
+	below := slices.Clone(li.tips[li.lo[n.Id()] : li.hi[n.Id()]+1])
+	slices.Sort(below) // in tip index order, which is sorted by name
+	names := make([]string, len(below))
+	for i, t := range below {
+		names[i] = td.IdToNodes[td.TipToNodeID(t)].Name()
+	}
+	return names
+}
+
 // Returns leafset as string for printing/testing
 func (td *TreeData) LeafsetAsString(n *tree.Node) string {
-	result := "{"
-	tips := td.AllTipNames()
-	for i := range len(tips) {
-		// for i, t := range td.leafsets[n.Id()] {
-		if td.leafsets[n.Id()].Test(uint(i)) {
-			result += tips[i] + ","
+	return "{" + strings.Join(td.LeafsetNames(n), ",") + "}"
+}
+
+// Returns id of the node whose leafset is exactly taxa
+func (td *TreeData) CladeID(taxa []string) (int, error) {
+	if len(taxa) == 0 {
+		return 0, fmt.Errorf("%w, clade is empty", ErrNotClade)
+	}
+	seen := make(map[string]bool, len(taxa))
+	lca := -1
+	for _, name := range taxa {
+		ti, err := td.TipIndex(name)
+		if err != nil {
+			return 0, fmt.Errorf("%w, %s", ErrTipNameMismatch, err.Error())
+		}
+		id := td.TipToNodeID(uint16(ti))
+		if lca == -1 {
+			lca = id
+		} else {
+			lca = td.LCA(lca, id)
+		}
+		seen[name] = true
+	}
+	if td.NumLeavesBelow[lca] != uint64(len(seen)) {
+		return 0, fmt.Errorf("%w, smallest clade containing {%s} is %s",
+			ErrNotClade, strings.Join(taxa, ","), td.LeafsetAsString(td.IdToNodes[lca]))
+	}
+	return lca, nil
+}
+
+// Returns quartet as string of the form "A,B|C,D" using tip names
+func (td *TreeData) QuartetString(q Quartet) string {
+	var left, right []string
+	for i, t := range q.Taxa() {
+		name := td.IdToNodes[td.TipToNodeID(t)].Name()
+		if (q.Topology()>>i)%2 == 0 {
+			right = append(right, name)
+		} else {
+			left = append(left, name)
 		}
 	}
-	return result[:len(result)-1] + "}"
+	return strings.Join(left, ",") + "|" + strings.Join(right, ",")
 }
 
 func (td *TreeData) TipToNodeID(idx uint16) int {
 	return td.tipIndexMap[idx]
 }
 
+// Whether the tree induces quartet q's topology, i.e., the pair of q's taxa
+// with the fewest edges between them (by the four point condition) is a
+// neighboring pair in q
+func (td *TreeData) Displays(q Quartet) bool {
+	var nodes [4]int
+	for i, t := range q.Taxa() {
+		nodes[i] = td.TipToNodeID(t)
+	}
+	dist := func(i, j int) int {
+		return td.Depths[nodes[i]] + td.Depths[nodes[j]] - 2*td.Depths[td.LCA(nodes[i], nodes[j])]
+	}
+	sums := [4]int{1: dist(0, 1) + dist(2, 3), 2: dist(0, 2) + dist(1, 3), 3: dist(0, 3) + dist(1, 2)}
+	topo := q.Topology()
+	for i := 1; i < 4; i++ {
+		if (topo>>i)%2 == topo%2 { // taxon i is on the same side as taxon 0
+			return sums[i] < sums[1+i%3] && sums[i] < sums[1+(i+1)%3]
+		}
+	}
+	panic(fmt.Sprintf("quartet %v has no neighbor of taxon %d", q, q.Taxon(0)))
+}
+
 // Get quartets corresponding to a given node (by id)
 func (td *TreeData) Quartets(nid int) []Quartet {
-	if td.quartetSet == nil {
+	if td.quartetIndex == nil {
 		panic("quartet set never initialized")
 	}
-	return td.quartetSet[nid]
+	return td.quartetIndex.Quartets(nid)
 }
 
 // Get count of quartets with a particular topology
 func (td *TreeData) NumQuartet(q Quartet) uint32 {
-	if td.quartetSet == nil {
+	if td.quartetIndex == nil {
 		panic("quartet counts never initialized")
 	}
-	return (*td.quartetCounts)[q]
+	return td.quartetCounts.Get(q)
 }
 
 // n2 is under n1
 func (td *TreeData) Under(n1ID, n2ID int) bool {
-	return td.LCA(n1ID, n2ID) == n1ID && n1ID != n2ID
+	return n1ID != n2ID && td.lca.below(n1ID, n2ID)
 }
 
 // returns total number of quartets (all topologies)
 func (td *TreeData) TotalNumQuartets() uint32 {
 	var result uint32
-	for _, count := range *td.quartetCounts {
+	for _, count := range td.quartetCounts.All() {
 		result += count
 	}
 	return result
 }
 
 func (td *TreeData) TotalNumUniqueQuartets() uint32 {
-	return uint32(len(*td.quartetCounts))
+	return uint32(td.quartetCounts.Len())
 }
 
 func (td *TreeData) Clone() *TreeData {
 	tre := td.Tree.Clone()
 	return &TreeData{
-		Tree:        *tre,
-		Children:    children(tre),
-		IdToNodes:   mapIdToNodes(tre),
-		Depths:      td.Depths,
-		leafsets:    td.leafsets,
-		lca:         td.lca,
-		tipIndexMap: td.tipIndexMap,
-		NLeaves:     td.NLeaves,
+		Tree:           *tre,
+		Children:       children(tre),
+		IdToNodes:      mapIdToNodes(tre),
+		quartetIndex:   td.quartetIndex,
+		quartetCounts:  td.quartetCounts,
+		Depths:         td.Depths,
+		NumLeavesBelow: td.NumLeavesBelow,
+		leafsets:       td.leafsets,
+		lca:            td.lca,
+		tipIndexMap:    td.tipIndexMap,
+		NLeaves:        td.NLeaves,
+
+		ConstraintWeight: td.ConstraintWeight,
+		occupancy:        td.occupancy,
+		provenance:       td.provenance,
+	}
+}
+
+// Sets the number of gene trees (in the same units as the quartet counts) with
+// a resolved quartet on each set of four taxa, keyed by Quartet.TaxaSet
+func (td *TreeData) SetOccupancy(occupancy *QuartetTable) {
+	td.occupancy = &occupancyData{counts: occupancy}
+}
+
+// Whether the occupancy of sets of four taxa is tracked (see SetOccupancy)
+func (td *TreeData) HasOccupancy() bool {
+	return td.occupancy != nil
+}
+
+// Number of gene trees with a resolved quartet on q's set of four taxa
+func (td *TreeData) Occupancy(q Quartet) uint32 {
+	if td.occupancy == nil {
+		panic("occupancy never initialized")
+	}
+	return td.occupancy.counts.Get(q.TaxaSet())
+}
+
+// Sets the gene trees each quartet topology was counted from
+func (td *TreeData) SetProvenance(provenance *QuartetProvenance) {
+	td.provenance = provenance
+}
+
+// Whether the gene trees each quartet was counted from are kept (see
+// SetProvenance)
+func (td *TreeData) HasProvenance() bool {
+	return td.provenance != nil
+}
+
+// Gene trees q was counted from, sorted by gene. Counts are from before the
+// quartet filter, the count cap, and constraint quartet weighting, so they
+// may not add up to the count of q in the tree data.
+func (td *TreeData) QuartetGenes(q Quartet) []GeneCount {
+	if td.provenance == nil {
+		panic("provenance never initialized")
+	}
+	return td.provenance.Genes(q)
+}
+
+// Sets of four taxa (see Quartet.TaxaSet) in some gene tree with at least three
+// taxa under node id v
+func (td *TreeData) OccupiedSets(v int) []Quartet {
+	if td.occupancy == nil {
+		panic("occupancy never initialized")
 	}
+	td.occupancy.once.Do(func() {
+		td.occupancy.index = mapQuartetsToVertices(&td.Tree, td.occupancy.counts, td.Children, td.lca)
+	})
+	return td.occupancy.index.Quartets(v)
 }
@@ -1,10 +1,12 @@
 package graphs
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
-	"github.com/bits-and-blooms/bitset"
 	"github.com/evolbioinfo/gotree/io/newick"
 	"github.com/evolbioinfo/gotree/tree"
 )
@@ -55,6 +57,23 @@ func TestMakeTreeData(t *testing.T) {
 				"r": {"((A,C),(B,D));"},
 			},
 		},
+		{
+			name:     "quartets on different paths",
+			tre:      "(((A,B)a,(C,D)b)c,((E,F)d,G)e)r;",
+			quartets: []string{"((A,B),(C,E));", "((A,E),(F,G));", "((A,C),(B,D));"},
+			leafset: map[string][]string{
+				"c": {"A", "B", "C", "D"},
+				"e": {"E", "F", "G"},
+			},
+			quartetSets: map[string][]string{
+				"a": {},
+				"b": {},
+				"c": {"((A,B),(C,E));", "((A,C),(B,D));"},
+				"d": {},
+				"e": {"((A,E),(F,G));"},
+				"r": {"((A,B),(C,E));", "((A,E),(F,G));", "((A,C),(B,D));"},
+			},
+		},
 	}
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
@@ -76,20 +95,99 @@ func TestMakeTreeData(t *testing.T) {
 			}
 			qc := makeQCounts(t, q, tre)
 			treeData := MakeTreeData(tre, qc)
-			lca := treeData.lca
-			leafset := treeData.leafsets
-			quartetSets := treeData.quartetSet
-			nLeaves := len(lca)
-			for i := range nLeaves {
-				for j := range nLeaves {
-					if lca[i][j] != lca[j][i] {
+			quartetSets := make([][]Quartet, len(tre.Nodes()))
+			for v := range quartetSets {
+				quartetSets[v] = treeData.Quartets(v)
+			}
+			nNodes := len(tre.Nodes())
+			for i := range nNodes {
+				for j := range nNodes {
+					if treeData.LCA(i, j) != treeData.LCA(j, i) {
 						t.Error("lca structure problem")
 					}
 				}
 			}
-			assertLCAEqual(t, lca, test.lca, tre)
-			assertLeafsetEqual(t, leafset, test.leafset, tre)
+			assertLCAEqual(t, treeData, test.lca, tre)
+			assertLeafsetEqual(t, treeData, test.leafset, tre)
 			assertQuartetSetsEqual(t, quartetSets, test.quartetSets, tre)
+			for v := range quartetSets {
+				var expected []Quartet
+				for q := range qc.All() {
+					found := 0
+					for i := range 4 {
+						if treeData.leafsets.contains(v, q.Taxon(i)) {
+							found++
+						}
+					}
+					if found >= 3 {
+						expected = append(expected, q)
+					}
+				}
+				if !slices.Equal(quartetSets[v], expected) {
+					t.Errorf("quartets for node %d: got %v, expected %v", v, quartetSets[v], expected)
+				}
+			}
+			clone := treeData.Clone()
+			for v := range quartetSets {
+				if !slices.Equal(clone.Quartets(v), quartetSets[v]) {
+					t.Errorf("clone quartets for node %d: got %v, expected %v", v, clone.Quartets(v), quartetSets[v])
+				}
+			}
+		})
+	}
+}
+
+func TestTreeData_MatchesAncestors(t *testing.T) {
+	testCases := []struct {
+		name string
+		nwk  string
+	}{
+		{name: "balanced", nwk: "(((A,B),(C,D)),((E,F),(G,H)));"},
+		{name: "caterpillar", nwk: caterpillar(17)},
+		{name: "polytomy", nwk: "((A,B,C),(D,(E,F,G,H)),I);"},
+		{name: "cherry", nwk: "(A,B);"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader(test.nwk)).Parse()
+			if err != nil {
+				t.Fatalf("cannot parse %s as newick tree", test.nwk)
+			}
+			if err = tre.UpdateTipIndex(); err != nil {
+				t.Fatal(err)
+			}
+			td := MakeTreeData(tre, nil)
+			ancestors := func(id int) []int {
+				path := []int{id}
+				for cur := td.IdToNodes[id]; cur != tre.Root(); {
+					cur, _ = cur.Parent()
+					path = append(path, cur.Id())
+				}
+				return path
+			}
+			for i := range td.IdToNodes {
+				for j := range td.IdToNodes {
+					iAnc, jAnc := ancestors(i), ancestors(j)
+					expected := -1
+					for _, a := range iAnc {
+						if slices.Contains(jAnc, a) {
+							expected = a
+							break
+						}
+					}
+					if got := td.LCA(i, j); got != expected {
+						t.Errorf("LCA(%d, %d) = %d, expected %d", i, j, got, expected)
+					}
+					if got := td.Under(i, j); got != (i != j && slices.Contains(jAnc, i)) {
+						t.Errorf("Under(%d, %d) = %t", i, j, got)
+					}
+					if tip := td.IdToNodes[j]; tip.Tip() {
+						if got := td.InLeafset(uint16(i), uint16(tip.TipIndex())); got != slices.Contains(jAnc, i) {
+							t.Errorf("InLeafset(%d, %d) = %t", i, tip.TipIndex(), got)
+						}
+					}
+				}
+			}
 		})
 	}
 }
@@ -157,7 +255,7 @@ func assertLeavesBelow(t *testing.T, tre *tree.Tree, counts []uint64, expected m
 	}
 }
 
-func assertLCAEqual(t *testing.T, lca [][]int, expected map[string][][]string, tre *tree.Tree) {
+func assertLCAEqual(t *testing.T, td *TreeData, expected map[string][][]string, tre *tree.Tree) {
 	t.Helper()
 	for label, pairs := range expected {
 		for _, pair := range pairs {
@@ -167,24 +265,23 @@ func assertLCAEqual(t *testing.T, lca [][]int, expected map[string][][]string, t
 			node1 := getNode(t, pair[0], tre)
 			node2 := getNode(t, pair[1], tre)
 			lcaNode := getNode(t, label, tre)
-			if lca[node1.Id()][node2.Id()] != lcaNode.Id() {
-				t.Fatalf("lca(%s,%s)=%d, want %d", node1.Name(), node2.Name(), lca[node1.Id()][node2.Id()], lcaNode.Id())
+			if got := td.LCA(node1.Id(), node2.Id()); got != lcaNode.Id() {
+				t.Fatalf("lca(%s,%s)=%d, want %d", node1.Name(), node2.Name(), got, lcaNode.Id())
 			}
 		}
 	}
 }
 
-func assertLeafsetEqual(t *testing.T, leafset []*bitset.BitSet, expected map[string][]string, tre *tree.Tree) {
+func assertLeafsetEqual(t *testing.T, td *TreeData, expected map[string][]string, tre *tree.Tree) {
 	t.Helper()
 	for label, leaves := range expected {
 		node := getNode(t, label, tre)
-		leafsetList := leafset[node.Id()]
 		for _, leaf := range leaves {
 			id, err := tre.TipIndex(leaf)
 			if err != nil {
 				t.Fatalf("failed to find tip %q: %v", leaf, err)
 			}
-			if !leafsetList.Test(uint(id)) {
+			if !td.InLeafset(uint16(node.Id()), uint16(id)) {
 				t.Fatalf("leafset for %s missing tip %s", label, leaf)
 			}
 		}
@@ -230,15 +327,140 @@ func getNode(t *testing.T, label string, tre *tree.Tree) *tree.Node {
 	return nodeList[0]
 }
 
-func makeQCounts(t *testing.T, qList []*tree.Tree, constTree *tree.Tree) map[Quartet]uint32 {
+func makeQCounts(t *testing.T, qList []*tree.Tree, constTree *tree.Tree) *QuartetTable {
 	t.Helper()
-	result := make(map[Quartet]uint32)
+	result := NewQuartetTable(len(qList))
 	for _, qt := range qList {
 		q, err := NewQuartet(qt, constTree)
 		if err != nil {
 			t.Fatalf("invalid quartet in test data: %v", err)
 		}
-		result[q] += 1
+		result.Add(q, 1)
 	}
 	return result
 }
+
+func TestCladeID(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(tre, nil)
+	testCases := []struct {
+		name        string
+		taxa        []string
+		expected    string
+		expectedErr error
+	}{
+		{name: "leaf", taxa: []string{"C"}, expected: "{C}"},
+		{name: "clade", taxa: []string{"E", "D", "C"}, expected: "{C,D,E}"},
+		{name: "not a clade", taxa: []string{"B", "C"}, expectedErr: ErrNotClade},
+		{name: "unknown taxon", taxa: []string{"X"}, expectedErr: ErrTipNameMismatch},
+		{name: "empty", taxa: []string{}, expectedErr: ErrNotClade},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := td.CladeID(test.taxa)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err == nil && td.LeafsetAsString(td.IdToNodes[id]) != test.expected {
+				t.Errorf("got clade %s, expected %s", td.LeafsetAsString(td.IdToNodes[id]), test.expected)
+			}
+		})
+	}
+}
+
+func TestLeafsetAsString(t *testing.T) {
+	// traversal order (D, C, E, B, A) is not the alphabetical tip index order
+	tre, err := newick.NewParser(strings.NewReader("((D,(C,E)x)y,(B,A)z)r;")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(tre, nil)
+	testCases := []struct {
+		label    string
+		expected string
+	}{
+		{label: "A", expected: "{A}"},
+		{label: "D", expected: "{D}"},
+		{label: "x", expected: "{C,E}"},
+		{label: "y", expected: "{C,D,E}"},
+		{label: "z", expected: "{A,B}"},
+		{label: "r", expected: "{A,B,C,D,E}"},
+	}
+	for _, test := range testCases {
+		t.Run(test.label, func(t *testing.T) {
+			if got := td.LeafsetAsString(getNode(t, test.label, &td.Tree)); got != test.expected {
+				t.Errorf("got leafset %s, expected %s", got, test.expected)
+			}
+		})
+	}
+}
+
+// Caterpillar tree with n tips, the worst case for tree depth
+func caterpillar(n int) string {
+	nwk := "t0"
+	for i := 1; i < n; i++ {
+		nwk = fmt.Sprintf("(%s,t%d)", nwk, i)
+	}
+	return nwk + ";"
+}
+
+func BenchmarkMakeTreeData(b *testing.B) {
+	for _, n := range []int{64, 256} {
+		tre, err := newick.NewParser(strings.NewReader(caterpillar(n))).Parse()
+		if err != nil {
+			b.Fatalf("cannot parse caterpillar tree: %s", err)
+		}
+		if err = tre.UpdateTipIndex(); err != nil {
+			b.Fatalf("cannot index caterpillar tree: %s", err)
+		}
+		b.Run(fmt.Sprintf("tips=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				MakeTreeData(tre, nil)
+			}
+		})
+	}
+}
+
+func TestDisplays(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := MakeTreeData(tre, nil)
+	testCases := []struct {
+		quartet  string
+		expected bool
+	}{
+		{quartet: "((A,B),(C,D));", expected: true},
+		{quartet: "((A,C),(B,D));", expected: false},
+		{quartet: "((A,E),(D,B));", expected: false},
+		{quartet: "((E,D),(A,C));", expected: true},
+		{quartet: "((C,D),(A,E));", expected: false},
+	}
+	for _, test := range testCases {
+		qt, err := newick.NewParser(strings.NewReader(test.quartet)).Parse()
+		if err != nil {
+			t.Fatal("invalid newick quartet; test is written wrong")
+		}
+		q, err := NewQuartet(qt, tre)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := td.Displays(q); got != test.expected {
+			t.Errorf("%s: got %t, expected %t", test.quartet, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package infer
+
+import (
+	"cmp"
+	"slices"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	"github.com/jsdoublel/camus/internal/pool"
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+// Finds the n best networks that differ from the optimal network (branches)
+// by a single branch. A candidate branch that conflicts with exactly one
+// chosen branch replaces it; a candidate that conflicts with none replaces the
+// lowest scoring chosen branch.
+func (dp *DP[S]) alternatives(branches []gr.Branch, n int) []pr.Alternative {
+	if len(branches) == 0 || n <= 0 {
+		return nil
+	}
+	scores := make([]float64, len(branches))
+	var total float64
+	weakest := 0
+	for i, br := range branches {
+		scores[i] = float64(dp.Scorer.CalcScore(br.IDs[gr.Ui], br.IDs[gr.Wi], dp.Tree))
+		total += scores[i]
+		if scores[i] < scores[weakest] {
+			weakest = i
+		}
+	}
+	candidates := make([][]pr.Alternative, dp.NumNodes)
+	pool.Run(dp.NumNodes, dp.NProcs, func(u int) {
+		for w := range dp.NumNodes {
+			if !dp.Policy.Allows(u, w, dp.Tree) {
+				continue
+			}
+			br := gr.Branch{IDs: [2]int{u, w}}
+			if slices.Contains(branches, br) {
+				continue
+			}
+			replace, conflicts := weakest, 0
+			for i, chosen := range branches {
+				if !gr.Compatible(br, chosen, dp.Tree) {
+					replace = i
+					conflicts++
+				}
+			}
+			if conflicts > 1 {
+				continue
+			}
+			score := total - scores[replace] + float64(dp.Scorer.CalcScore(u, w, dp.Tree))
+			candidates[u] = append(candidates[u], pr.Alternative{
+				Branch:   br,
+				Replaces: branches[replace],
+				Score:    score,
+				Gap:      total - score,
+			})
+		}
+	})
+	alts := slices.Concat(candidates...)
+	slices.SortFunc(alts, func(a1, a2 pr.Alternative) int {
+		return cmp.Or(
+			cmp.Compare(a2.Score, a1.Score),
+			cmp.Compare(a1.Branch.IDs[gr.Ui], a2.Branch.IDs[gr.Ui]),
+			cmp.Compare(a1.Branch.IDs[gr.Wi], a2.Branch.IDs[gr.Wi]),
+		)
+	})
+	alts = alts[:min(n, len(alts))]
+	for i := range alts {
+		altBranches := slices.Clone(branches)
+		altBranches[slices.Index(branches, alts[i].Replaces)] = alts[i].Branch
+		if percent, err := dp.Scorer.PercentQuartetSat(altBranches, dp.Tree); err == nil {
+			alts[i].QSat = percent
+		}
+	}
+	return alts
+}
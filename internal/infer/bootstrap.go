@@ -0,0 +1,150 @@
+package infer
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Resamples the gene trees with replacement reps times, within each partition
+// if parts is not nil, and reruns preprocessing and the dp on each replicate.
+// Returns, for each branch of the largest network in full, the fraction of
+// replicates whose network with the same number of edges contains it. If
+// balance is set, every partition contributes the same number of genes to a
+// replicate (so small partitions are weighted up); otherwise each contributes
+// as many genes as it has.
+func Bootstrap(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, parts *pr.Partitions, reps int, balance bool, opts InferOptions, full *DPResults) ([]float64, error) {
+	if reps < 1 {
+		return nil, fmt.Errorf("%w, number of bootstrap replicates must be positive", ErrInvalidOption)
+	}
+	k := len(full.Branches)
+	if k == 0 {
+		return nil, nil
+	}
+	defer tm.Phase("bootstrap")()
+	if parts == nil {
+		parts = &pr.Partitions{Names: []string{"all"}, Members: [][]int{make([]int, len(geneTrees))}}
+		for i := range geneTrees {
+			parts.Members[0][i] = i
+		}
+	}
+	sizes := stratumSizes(parts, len(geneTrees), balance)
+	lg.Infof("running %d bootstrap replicates resampling gene trees within %d partitions", reps, len(parts.Names))
+	opts.NumAlts, opts.Overlaps, opts.ExclSupport, opts.Within, opts.Provenance = 0, false, false, 0, false
+	opts.GeneNames = nil // replicates repeat and drop gene trees, so names no longer line up
+	rng := opts.NewRand(bootstrapStream)
+	counts := make([]int, k)
+	weights := opts.Weights
+	for r := range reps {
+		var sample []*tree.Tree
+		sample, opts.Weights = resampleGeneTrees(geneTrees, weights, parts, sizes, rng)
+		results, err := inferQuietly(ctx, tre, sample, opts)
+		if err != nil {
+			return nil, fmt.Errorf("bootstrap replicate %d: %w", r+1, err)
+		}
+		if len(results.Branches) >= k {
+			for i, br := range full.Branches[k-1] {
+				if slices.Contains(results.Branches[k-1], br) {
+					counts[i]++
+				}
+			}
+		}
+		if (r+1)%10 == 0 {
+			lg.Debugf("bootstrap finished %d of %d replicates", r+1, reps)
+		}
+	}
+	support := make([]float64, k)
+	for i, c := range counts {
+		support[i] = float64(c) / float64(reps)
+	}
+	return support, nil
+}
+
+// Number of genes drawn from each partition in a replicate
+func stratumSizes(parts *pr.Partitions, nGenes int, balance bool) []int {
+	sizes := make([]int, len(parts.Members))
+	for p, members := range parts.Members {
+		sizes[p] = len(members)
+		if balance {
+			sizes[p] = max(nGenes/len(parts.Members), 1)
+		}
+	}
+	return sizes
+}
+
+// Draws sizes[p] gene trees with replacement from each partition p, along
+// with their weights (nil if weights is nil). Trees are copied, since
+// preprocessing modifies them and a tree can be drawn twice.
+func resampleGeneTrees(geneTrees []*tree.Tree, weights []float64, parts *pr.Partitions, sizes []int, rng *rand.Rand) ([]*tree.Tree, []float64) {
+	sample := make([]*tree.Tree, 0, len(geneTrees))
+	var sampleWeights []float64
+	for p, members := range parts.Members {
+		if len(members) == 0 {
+			continue
+		}
+		for range sizes[p] {
+			g := members[rng.IntN(len(members))]
+			sample = append(sample, geneTrees[g].Clone())
+			if weights != nil {
+				sampleWeights = append(sampleWeights, weights[g])
+			}
+		}
+	}
+	return sample, sampleWeights
+}
+
+// Pooled quartet support of each reticulation of a network (labeled branches
+// on td) from the gene trees of each partition
+func PartitionSupport(ctx context.Context, td *gr.TreeData, labeled map[string]gr.Branch, geneTrees []*tree.Tree, parts *pr.Partitions) ([]map[string]pr.RetSummary, error) {
+	ntw, err := scoringNetwork(td, labeled)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]map[string]pr.RetSummary, len(parts.Names))
+	for p, members := range parts.Members {
+		trees := make([]*tree.Tree, len(members))
+		for i, g := range members {
+			trees[i] = geneTrees[g]
+		}
+		if summaries[p], err = sc.ReticulationSummary(ctx, ntw, trees); err != nil {
+			return nil, fmt.Errorf("partition %s: %w", parts.Names[p], err)
+		}
+	}
+	return summaries, nil
+}
+
+// Inheritance probability of each reticulation of a network (labeled branches
+// on td) estimated from the gene trees (see sc.InheritanceProbabilities)
+func InheritanceProbabilities(ctx context.Context, td *gr.TreeData, labeled map[string]gr.Branch, geneTrees []*tree.Tree) (map[string]float64, error) {
+	if len(labeled) == 0 {
+		return map[string]float64{}, nil
+	}
+	ntw, err := scoringNetwork(td, labeled)
+	if err != nil {
+		return nil, err
+	}
+	return sc.InheritanceProbabilities(ctx, ntw, geneTrees)
+}
+
+// Makes the network with the labeled branches on td, read back from newick so
+// that its node ids and tip indices are set up like a network given to the
+// score command
+func scoringNetwork(td *gr.TreeData, labeled map[string]gr.Branch) (*gr.Network, error) {
+	nwk := gr.MakeLabeledNetwork(td, labeled).Newick()
+	parsed, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return pr.ConvertToNetwork(parsed)
+}
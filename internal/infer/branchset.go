@@ -0,0 +1,142 @@
+package infer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+// Scores a hypothesized set of reticulation branches (given by clades) on the
+// constraint tree without running the dp. Returns an error if a branch is not
+// one the dp could add, or if the branches can't be in the same level-1
+// network.
+func ScoreBranchSet(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, clades []pr.BranchClades, opts InferOptions) (*gr.TreeData, []pr.BranchScore, error) {
+	td, _, err := pr.Preprocess(ctx, tre, geneTrees, opts.Weights, opts.GeneNames, opts.PrepProcs, opts.QuartetOpts, opts.MinSupport, opts.countMode())
+	if err != nil {
+		return nil, nil, fmt.Errorf("preprocess error: %w", err)
+	}
+	branches := make([]gr.Branch, len(clades))
+	for i, bc := range clades {
+		if branches[i], err = resolveBranch(td, bc); err != nil {
+			return nil, nil, fmt.Errorf("branch %d: %w", i+1, err)
+		}
+		for j := range i {
+			if !gr.Compatible(branches[i], branches[j], td) {
+				return nil, nil, fmt.Errorf("%w, branches %d and %d overlap, so they cannot be in the same level-1 network", ErrInvalidBranch, j+1, i+1)
+			}
+		}
+	}
+	asSet := countsAsSet(opts)
+	lg.Infof("scoring %d branches", len(branches))
+	scores := make([]pr.BranchScore, len(branches))
+	for i, br := range branches {
+		satisfied, err := sc.TotalSatQuartets([]gr.Branch{br}, td, asSet)
+		if err != nil {
+			return nil, nil, err
+		}
+		scores[i] = pr.BranchScore{Branch: br, Satisfied: satisfied, Percent: sc.PercentOfQuartets(satisfied, td, asSet)}
+	}
+	return td, scores, nil
+}
+
+// Scores arbitrary candidate edges (given by node labels or clades) on the
+// constraint tree with each score mode in modes, without running the dp.
+// Unlike ScoreBranchSet, the edges do not need to fit in one network, but
+// each must be an edge the dp could add.
+func ScoreEdges(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, edges []pr.EdgeEnds, modes []sc.InitableScorer, opts InferOptions) (*gr.TreeData, []pr.EdgeScore, error) {
+	td, _, err := pr.Preprocess(ctx, tre, geneTrees, opts.Weights, opts.GeneNames, opts.PrepProcs, opts.QuartetOpts, opts.MinSupport, opts.countMode())
+	if err != nil {
+		return nil, nil, fmt.Errorf("preprocess error: %w", err)
+	}
+	scores := make([]pr.EdgeScore, len(edges))
+	branches := make([]gr.Branch, len(edges))
+	asSet := countsAsSet(opts)
+	for i, e := range edges {
+		u, err := resolveEdgeEnd(td, e.U)
+		if err != nil {
+			return nil, nil, fmt.Errorf("edge %d: %w", i+1, err)
+		}
+		w, err := resolveEdgeEnd(td, e.W)
+		if err != nil {
+			return nil, nil, fmt.Errorf("edge %d: %w", i+1, err)
+		}
+		if branches[i], err = checkBranch(td, u, w); err != nil {
+			return nil, nil, fmt.Errorf("edge %d: %w", i+1, err)
+		}
+		satisfied, err := sc.TotalSatQuartets([]gr.Branch{branches[i]}, td, asSet)
+		if err != nil {
+			return nil, nil, err
+		}
+		scores[i] = pr.EdgeScore{Ends: e, Branch: branches[i], Satisfied: satisfied, Percent: sc.PercentOfQuartets(satisfied, td, asSet)}
+	}
+	nGeneTrees := opts.countMode().NumGeneTrees(len(geneTrees), opts.Weights)
+	for _, mode := range modes {
+		lg.Infof("scoring %d edges with score mode %s", len(edges), sc.ScorerName(mode))
+		dp, err := newDPRunner(freshScorer(mode), td, nGeneTrees, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, score := range dp.EdgeScores(branches) {
+			scores[i].Scores = append(scores[i].Scores, score)
+		}
+	}
+	return td, scores, nil
+}
+
+// Finds the constraint tree node for an end of a candidate edge
+func resolveEdgeEnd(td *gr.TreeData, end pr.EdgeEnd) (int, error) {
+	if end.Clade != nil {
+		return td.CladeID(end.Clade)
+	}
+	if _, err := td.TipIndex(end.Label); err == nil {
+		return td.CladeID([]string{end.Label})
+	}
+	id := -1
+	for _, n := range td.IdToNodes {
+		if !n.Tip() && n.Name() == end.Label {
+			if id != -1 {
+				return 0, fmt.Errorf("%w, more than one node of the constraint tree is labeled %s", ErrInvalidBranch, end.Label)
+			}
+			id = n.Id()
+		}
+	}
+	if id == -1 {
+		return 0, fmt.Errorf("%w, no taxon or node of the constraint tree is labeled %s", ErrInvalidBranch, end.Label)
+	}
+	return id, nil
+}
+
+// Whether quartets satisfied by branches are counted as a set, the same as in
+// the dp
+func countsAsSet(opts InferOptions) bool {
+	_, sym := opts.ScoreMode.(*sc.SymDiffScorer)
+	return opts.AsSet || sym
+}
+
+// Finds constraint tree branch from u to w clades
+func resolveBranch(td *gr.TreeData, bc pr.BranchClades) (gr.Branch, error) {
+	u, err := td.CladeID(bc.U)
+	if err != nil {
+		return gr.Branch{}, err
+	}
+	w, err := td.CladeID(bc.W)
+	if err != nil {
+		return gr.Branch{}, err
+	}
+	return checkBranch(td, u, w)
+}
+
+// Branch from u to w, if the dp could add it
+func checkBranch(td *gr.TreeData, u, w int) (gr.Branch, error) {
+	if !sc.DefaultEdgePolicy.Allows(u, w, td) {
+		return gr.Branch{}, fmt.Errorf("%w, %s to %s cannot be added to the constraint tree (w cannot be the root or below u, and the cycle must have more than three edges)",
+			ErrInvalidBranch, td.LeafsetAsString(td.IdToNodes[u]), td.LeafsetAsString(td.IdToNodes[w]))
+	}
+	return gr.Branch{IDs: [2]int{u, w}}, nil
+}
@@ -0,0 +1,55 @@
+package infer
+
+import (
+	"cmp"
+	"slices"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+// Quartets that switch from unsatisfied to satisfied (gained), or from
+// satisfied to unsatisfied (lost), when going from the optimal network with
+// K-1 edges to the optimal network with K edges
+type QuartetChanges struct {
+	K      int
+	Gained []gr.Quartet
+	Lost   []gr.Quartet
+}
+
+// Calculates the quartets gained and lost for each consecutive pair of optimal
+// networks (starting from the constraint tree). Since optimal networks are not
+// necessarily nested, quartets may be lost as well as gained.
+func CalcQuartetChanges(results *DPResults) []QuartetChanges {
+	changes := make([]QuartetChanges, len(results.Branches))
+	prev := make(map[gr.Quartet]bool) // constraint tree satisfies no considered quartets
+	for i, branches := range results.Branches {
+		next := sc.SatisfiedQuartets(branches, results.Tree)
+		changes[i] = QuartetChanges{K: i + 1, Gained: setDifference(next, prev), Lost: setDifference(prev, next)}
+		prev = next
+	}
+	return changes
+}
+
+// Total number of quartets gained and lost (counting all copies of each topology)
+func (qc QuartetChanges) Counts(td *gr.TreeData) (gained, lost uint64) {
+	for _, q := range qc.Gained {
+		gained += uint64(td.NumQuartet(q))
+	}
+	for _, q := range qc.Lost {
+		lost += uint64(td.NumQuartet(q))
+	}
+	return
+}
+
+// returns sorted list of quartets in s1 but not s2
+func setDifference(s1, s2 map[gr.Quartet]bool) []gr.Quartet {
+	diff := make([]gr.Quartet, 0)
+	for q := range s1 {
+		if !s2[q] {
+			diff = append(diff, q)
+		}
+	}
+	slices.SortFunc(diff, func(q1, q2 gr.Quartet) int { return cmp.Compare(q1, q2) })
+	return diff
+}
@@ -0,0 +1,56 @@
+package infer
+
+import (
+	"fmt"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+// Trace of a subproblem whose best network adds an edge at v, kept instead of
+// its cycleTrace with DP.Compact. The cycle traces along the paths of each
+// cycle take up most of the traceback, so they are dropped once v is solved
+// and recomputed from the dp tables when the traceback reaches them.
+type compactCycleTrace[S sc.Score] struct {
+	dp *DP[S]
+	v  int
+	k  int
+}
+
+func (tr *compactCycleTrace[S]) cycles() []*cycleTrace {
+	return tr.dp.recomputeCycle(tr.v, tr.k).cycles()
+}
+
+func (tr *compactCycleTrace[S]) enumerate(limit int, memo enumMemo) [][]gr.Branch {
+	return memo.get(tr, func() [][]gr.Branch {
+		return tr.dp.recomputeCycle(tr.v, tr.k).enumerate(limit, memo)
+	})
+}
+
+// Replaces the cycle traces of v with compact ones (see compactCycleTrace)
+func (dp *DP[S]) compactTraces(v int, traces []trace) {
+	for k, tr := range traces {
+		if _, ok := tr.(*cycleTrace); ok {
+			traces[k] = &compactCycleTrace[S]{dp: dp, v: v, k: k}
+		}
+	}
+}
+
+// Cycle trace of the subproblem of v with k edges, found by scoring the edges
+// at v again the same way solve did, so that the same edge is chosen
+func (dp *DP[S]) recomputeCycle(v, k int) trace {
+	vCycleDP := cycleDP[S]{
+		v:          dp.Tree.IdToNodes[v],
+		scores:     make([][]S, dp.NumNodes),
+		traceNodes: make([][]*cycleTraceNode, dp.NumNodes),
+	}
+	for prevK := range k - 1 { // scoreAddEdgeK updates the cycle dp for k - 1
+		vCycleDP.update(prevK, dp)
+	}
+	var counts edgeCounts
+	_, tr, err := dp.scoreAddEdgeK(vCycleDP.v, k, &vCycleDP, &counts)
+	if err != nil {
+		panic(fmt.Sprintf("no edge found recomputing the cycle of vertex %d with %d edges", v, k))
+	}
+	return tr
+}
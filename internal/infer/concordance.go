@@ -0,0 +1,31 @@
+package infer
+
+import (
+	"context"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Quartet concordance of each branch of the constraint tree in td (see
+// sc.BranchConcordance)
+func Concordance(ctx context.Context, td *gr.TreeData, geneTrees []*tree.Tree, nprocs int) (map[int]pr.Concordance, error) {
+	defer tm.Phase("quartet concordance")()
+	concordance, err := sc.BranchConcordance(ctx, &td.Tree, geneTrees, nprocs)
+	if err != nil {
+		return nil, err
+	}
+	discordant := 0
+	for _, c := range concordance {
+		if c.QC < 0 {
+			discordant++
+		}
+	}
+	lg.Infof("%d of %d constraint tree branches have a discordant topology more frequent than their own", discordant, len(concordance))
+	return concordance, nil
+}
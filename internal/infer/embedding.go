@@ -0,0 +1,61 @@
+package infer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Largest number of reticulations whose displayed trees are compared to the
+// gene trees, since a network with k reticulations displays 2^k trees
+const MaxEmbeddingReticulations = 10
+
+// Quartet agreement between each gene tree and each tree displayed by the
+// network with the labeled branches on td (see sc.DisplayedTreeAgreement)
+func Embedding(ctx context.Context, td *gr.TreeData, labeled map[string]gr.Branch, geneTrees []*tree.Tree, nprocs int) (*pr.Embedding, error) {
+	if len(labeled) > MaxEmbeddingReticulations {
+		return nil, fmt.Errorf("%w, gene tree embedding is limited to networks with %d reticulations, got %d",
+			ErrInvalidOption, MaxEmbeddingReticulations, len(labeled))
+	}
+	defer tm.Phase("gene tree embedding")()
+	labels := pr.SortedRetLabels(labeled)
+	branches := make([]gr.Branch, len(labels))
+	for i, label := range labels {
+		branches[i] = labeled[label]
+	}
+	trees := gr.DisplayedTrees(td, branches)
+	lg.Infof("comparing %d gene trees to the %d trees displayed by the network", len(geneTrees), len(trees))
+	agreement, nQuartets, err := sc.DisplayedTreeAgreement(ctx, trees, geneTrees, nprocs)
+	if err != nil {
+		return nil, err
+	}
+	return &pr.Embedding{Reticulations: labels, Quartets: nQuartets, Agreement: agreement}, nil
+}
+
+// Quartets of each gene tree supporting each reticulation of the network with
+// the labeled branches on td (see sc.GeneContributions), taken from td if it
+// kept the gene trees each quartet came from
+func GeneContributions(ctx context.Context, td *gr.TreeData, labeled map[string]gr.Branch, geneTrees []*tree.Tree, nprocs int) (*pr.GeneContributions, error) {
+	defer tm.Phase("gene contributions")()
+	labels := pr.SortedRetLabels(labeled)
+	branches := make([]gr.Branch, len(labels))
+	for i, label := range labels {
+		branches[i] = labeled[label]
+	}
+	lg.Infof("counting the quartets of %d gene trees supporting each of %d reticulations", len(geneTrees), len(branches))
+	if td.HasProvenance() { // no need to read the quartets of the gene trees again
+		return &pr.GeneContributions{Reticulations: labels, Supporting: sc.GeneContributionsFromProvenance(td, branches, len(geneTrees))}, nil
+	}
+	supporting, err := sc.GeneContributions(ctx, td, branches, geneTrees, nprocs)
+	if err != nil {
+		return nil, err
+	}
+	return &pr.GeneContributions{Reticulations: labels, Supporting: supporting}, nil
+}
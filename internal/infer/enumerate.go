@@ -0,0 +1,115 @@
+package infer
+
+import (
+	"slices"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	sc "github.com/jsdoublel/camus/internal/score"
+	"github.com/jsdoublel/camus/util"
+)
+
+// Co-optimal traces of adding an edge at v with score, given the chosen trace
+// and the edges tied with it; every split of the other edges giving the same
+// score is a separate option. Returns the chosen trace if it is the only one.
+func (dp *DP[S]) edgeOptions(v *tree.Node, vCycleDP *cycleDP[S], prevK int, score S, chosen *cycleTrace, ties tieSet) trace {
+	options := []trace{chosen}
+	seen := make(map[gr.Branch]bool, len(ties))
+	for _, br := range ties {
+		if seen[br] {
+			continue
+		}
+		seen[br] = true
+		for _, tr := range dp.edgeTraces(v, br, vCycleDP, prevK, score) {
+			if !tr.sameSplit(chosen) {
+				options = append(options, tr)
+			}
+		}
+	}
+	if len(options) == 1 {
+		return chosen
+	}
+	return &choiceTrace{options: options}
+}
+
+// Traces of adding br at v for every split of the other edges with score
+func (dp *DP[S]) edgeTraces(v *tree.Node, br gr.Branch, vCycleDP *cycleDP[S], prevK int, score S) []*cycleTrace {
+	u, w := br.IDs[gr.Ui], br.IDs[gr.Wi]
+	edgeScore := dp.Scorer.CalcScore(u, w, dp.Tree)
+	var traces []*cycleTrace
+	if u == v.Id() {
+		splits, _ := util.AllBestSplits(vCycleDP.scores[w], dp.DP[w], prevK)
+		for _, split := range splits {
+			wPathK, wDownK := split[0], split[1]
+			wScore, wPathTrace := vCycleDP.get(w, wPathK)
+			if edgeScore+wScore+dp.DP[w][wDownK] == score {
+				traces = append(traces, &cycleTrace{
+					pathW:      wPathTrace,
+					wDownTrace: &dp.Traceback[w][wDownK],
+					branch:     br,
+				})
+			}
+		}
+		return traces
+	}
+	for _, indices := range allFourWaySplits([4][]S{vCycleDP.scores[w], vCycleDP.scores[u], dp.DP[w], dp.DP[u]}, prevK) {
+		wPathK, uPathK, wDownK, uDownK := indices[0], indices[1], indices[2], indices[3]
+		wScore, wPathTrace := vCycleDP.get(w, wPathK)
+		uScore, uPathTrace := vCycleDP.get(u, uPathK)
+		if edgeScore+wScore+uScore+dp.DP[w][wDownK]+dp.DP[u][uDownK] == score {
+			traces = append(traces, &cycleTrace{
+				pathW:      wPathTrace,
+				pathU:      uPathTrace,
+				wDownTrace: &dp.Traceback[w][wDownK],
+				uDownTrace: &dp.Traceback[u][uDownK],
+				branch:     br,
+			})
+		}
+	}
+	return traces
+}
+
+// Candidates for every best split of k between four lists: each best split
+// of lists[0] and lists[1] at i combined with each of lists[2] and lists[3] at
+// k - i, for every i (the caller checks which have the best total)
+func allFourWaySplits[S sc.Score](lists [4][]S, k int) [][4]int {
+	var result [][4]int
+	for i := range k + 1 {
+		splits1, err := util.AllBestSplits(lists[0], lists[1], i)
+		if err != nil {
+			break
+		}
+		splits2, err := util.AllBestSplits(lists[2], lists[3], k-i)
+		if err != nil {
+			continue
+		}
+		for _, s1 := range splits1 {
+			for _, s2 := range splits2 {
+				result = append(result, [4]int{s1[0], s1[1], s2[0], s2[1]})
+			}
+		}
+	}
+	return result
+}
+
+// Whether tr adds the same branch as other with the same split of the other edges
+func (tr *cycleTrace) sameSplit(other *cycleTrace) bool {
+	return tr.branch == other.branch && tr.pathW == other.pathW && tr.pathU == other.pathU &&
+		tr.wDownTrace == other.wDownTrace && tr.uDownTrace == other.uDownTrace
+}
+
+// Distinct optimal branch sets with k edges (up to dp.Enumerate), the first
+// being the one traceback returns
+func (dp *DP[S]) coOptimalNetworks(k int) [][]gr.Branch {
+	sets := dp.Traceback[dp.Tree.Root().Id()][k].enumerate(dp.Enumerate, make(enumMemo))
+	sets = slices.DeleteFunc(sets, func(set []gr.Branch) bool {
+		return len(set) != k
+	})
+	lg.Infof("found %d distinct optimal networks with %d edges", len(sets), k)
+	if len(sets) == dp.Enumerate {
+		lg.Infof("stopped at the limit of %d optimal networks; there may be more", dp.Enumerate)
+	}
+	return sets
+}
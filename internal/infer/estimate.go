@@ -0,0 +1,174 @@
+package infer
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+const (
+	// number of edges assumed when estimating dp runtime and memory
+	EstimateK = 10
+
+	// rough per operation costs (measured on a single core)
+	nsPerGeneQuartet  = 650 // extracting and counting one gene tree quartet
+	nsPerQuartetScore = 40  // classifying one quartet against one edge
+	nsPerSplit        = 20  // one step of a best split calculation
+
+	bytesPerMapEntry = 48 // quartet count map entry including overhead
+	bytesPerQuartet  = 8
+	bytesPerInt      = 8
+)
+
+// Component of a resource estimate
+type EstimateItem struct {
+	Name  string
+	Bytes uint64        // memory footprint
+	Time  time.Duration // single core runtime
+	Procs int           // number of parallel processes the runtime is split across
+}
+
+// Estimate of the resources needed by Infer, calculated from the shape of the
+// constraint tree and the sizes of the gene trees without extracting quartets
+type ResourceEstimate struct {
+	NumTaxa           int            // number of taxa in constraint tree
+	NumNodes          int            // number of nodes in constraint tree
+	NumGeneTrees      int            // number of gene trees
+	GeneTreeQuartets  uint64         // number of quartets across all gene trees (upper bound)
+	MaxUniqueQuartets uint64         // number of unique quartet topologies (upper bound)
+	PrepProcs         int            // number of parallel processes for quartet extraction
+	DPProcs           int            // number of parallel processes for edge scores and the dp
+	K                 int            // number of edges assumed
+	Items             []EstimateItem // estimate broken down by data structure/phase
+}
+
+// Estimates memory footprint and runtime of running Infer on the given
+// inputs assuming EstimateK edges are found (or opts.MaxReticulations, if it
+// is smaller). Returns an error if the constraint tree is invalid.
+func EstimateResources(tre *tree.Tree, geneTrees []*tree.Tree, opts InferOptions) (*ResourceEstimate, error) {
+	if err := pr.PrepareConstraintTree(tre); err != nil {
+		return nil, fmt.Errorf("preprocess error: %w", err)
+	}
+	nTaxa := len(tre.AllTipNames())
+	td := gr.MakeTreeData(tre, nil)
+	nNodes := len(td.Nodes())
+	var geneQuartets uint64
+	for _, gt := range geneTrees {
+		geneQuartets += choose4(uint64(len(gt.AllTipNames())))
+	}
+	unique := min(geneQuartets, 3*choose4(uint64(nTaxa)))
+	var meanDepth float64
+	for _, t := range td.Tips() {
+		meanDepth += float64(td.Depths[t.Id()]) / float64(nTaxa)
+	}
+	k := uint64(EstimateK)
+	if opts.MaxReticulations > 0 {
+		k = min(k, uint64(opts.MaxReticulations))
+	}
+	n2 := uint64(nNodes) * uint64(nNodes)
+	vertexQuartets := uint64(float64(unique) * meanDepth) // quartets are mapped to all vertices above three of their taxa
+	var edgeChecks, splitOps uint64
+	td.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) (keep bool) {
+		if cur.Tip() {
+			return true
+		}
+		l, r := td.Children[cur.Id()][0].Id(), td.Children[cur.Id()][1].Id()
+		nl, nr := 2*td.NumLeavesBelow[l]-1, 2*td.NumLeavesBelow[r]-1 // nodes in each subtree
+		edges := nl*nr + nl + nr
+		checksPerEdge := uint64(float64(vertexQuartets) / float64(nNodes))
+		edgeChecks += edges * checksPerEdge
+		kv := k
+		if opts.MaxKPerVertex > 0 && cur != td.Root() {
+			kv = min(k, uint64(opts.MaxKPerVertex))
+		}
+		splitOps += edges * kv * kv * kv
+		return true
+	})
+	prepProcs, dpProcs := max(opts.PrepProcs, 1), max(opts.DPProcs, 1)
+	items := []EstimateItem{
+		{Name: "gene tree quartets", Bytes: unique * bytesPerMapEntry, Time: nsDuration(geneQuartets * nsPerGeneQuartet), Procs: prepProcs},
+		{Name: "lca table", Bytes: 4 * (2*uint64(nNodes)*uint64(bits.Len(2*uint(nNodes))) + 3*uint64(nNodes))}, // euler tour sparse table of int32s
+		{Name: "leafsets", Bytes: 8*uint64(nNodes) + 6*uint64(nTaxa)},                                          // rank interval of each node, rank and tip of each taxon
+		{Name: "vertex quartet sets", Bytes: vertexQuartets * bytesPerQuartet},
+		{Name: "edge scores", Bytes: n2 * bytesPerInt, Time: nsDuration(edgeChecks * nsPerQuartetScore), Procs: dpProcs},
+	}
+	switch opts.ScoreMode.(type) {
+	case *sc.NormalizedScorer, *sc.SymDiffScorer:
+		items = append(items, EstimateItem{Name: "edge penalties", Bytes: n2 * bytesPerInt})
+	}
+	items = append(items, EstimateItem{
+		Name:  "dp tables",
+		Bytes: 4 * uint64(nNodes) * (k + 1) * bytesPerInt, // scores and traces for the dp and cycle dp
+		Time:  nsDuration(splitOps * nsPerSplit),
+		Procs: dpProcs,
+	})
+	return &ResourceEstimate{
+		NumTaxa:           nTaxa,
+		NumNodes:          nNodes,
+		NumGeneTrees:      len(geneTrees),
+		GeneTreeQuartets:  geneQuartets,
+		MaxUniqueQuartets: unique,
+		PrepProcs:         prepProcs,
+		DPProcs:           dpProcs,
+		K:                 int(k),
+		Items:             items,
+	}, nil
+}
+
+// Total memory footprint in bytes
+func (est *ResourceEstimate) Bytes() uint64 {
+	var total uint64
+	for _, item := range est.Items {
+		total += item.Bytes
+	}
+	return total
+}
+
+// Total runtime accounting for parallel processes
+func (est *ResourceEstimate) Time() time.Duration {
+	var total time.Duration
+	for _, item := range est.Items {
+		total += item.Time / time.Duration(max(item.Procs, 1))
+	}
+	return total
+}
+
+// Writes human readable summary of estimate to writer
+func (est *ResourceEstimate) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w,
+		"taxa: %d\nconstraint tree nodes: %d\ngene trees: %d\n"+
+			"gene tree quartets (upper bound): %d\nunique quartets (upper bound): %d\n\n",
+		est.NumTaxa, est.NumNodes, est.NumGeneTrees, est.GeneTreeQuartets, est.MaxUniqueQuartets)
+	if err != nil {
+		return err
+	}
+	for _, item := range est.Items {
+		if _, err := fmt.Fprintf(w, "%-20s %12s %14s\n", item.Name, tm.FormatBytes(item.Bytes), item.Time.Round(time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w,
+		"\nestimated peak memory: %s\nestimated runtime (%d prep/%d dp processes, %d edges): %s\n"+
+			"estimates are rough upper bounds; actual usage depends on the quartets in the data\n",
+		tm.FormatBytes(est.Bytes()), est.PrepProcs, est.DPProcs, est.K, est.Time().Round(time.Millisecond))
+	return err
+}
+
+func choose4(n uint64) uint64 {
+	if n < 4 {
+		return 0
+	}
+	return n * (n - 1) * (n - 2) * (n - 3) / 24
+}
+
+func nsDuration(ns uint64) time.Duration {
+	return time.Duration(ns) * time.Nanosecond
+}
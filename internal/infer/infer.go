@@ -1,48 +1,111 @@
 package infer
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"math/rand/v2"
+	"reflect"
 	"runtime"
 	"time"
 
 	"github.com/evolbioinfo/gotree/tree"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
 	pr "github.com/jsdoublel/camus/internal/prep"
 	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
 )
 
-var ErrInvalidOption = errors.New("invalid option combination")
+var (
+	ErrInvalidOption = errors.New("invalid option combination")
+	ErrInvalidBranch = errors.New("invalid reticulation branch")
+)
 
 type InferOptions struct {
-	NProcs      int                     // number of parallel processes
-	QuartetOpts pr.QuartetFilterOptions // quartet filter options
-	MinSupport  float64                 // edges with support below this will be filtered
-	ScoreMode   sc.InitableScorer       // type of edge score
-	AsSet       bool                    // calculate quartet counts as set
-	Alpha       float64                 // sym score parameter
+	PrepProcs          int                     // number of parallel processes for quartet extraction
+	DPProcs            int                     // number of parallel processes for edge scores and the dp
+	QuartetOpts        pr.QuartetFilterOptions // quartet filter options
+	MinSupport         float64                 // edges with support below this will be filtered
+	ScoreMode          sc.InitableScorer       // type of edge score
+	AsSet              bool                    // calculate quartet counts as set
+	CountCap           uint32                  // maximum number of gene trees counted for each quartet topology (no cap if 0)
+	LengthWeights      bool                    // weight quartets by the length of the gene tree branch inducing them
+	ConstraintQuartets pr.ConstraintQuartets   // how quartets displayed by the constraint tree are counted (dropped by default)
+	MulTrees           pr.MulMode              // how gene trees with more than one copy of a taxon are handled (an error by default)
+	SeqMethod          pr.SeqMethod            // how quartet topologies are inferred from alignments (see InferAlignments)
+	Alpha              float64                 // sym score parameter
+	PenaltyScale       sc.PenaltyScale         // scales the sym penalty by the cycle length of each edge (sc.FlatPenalty if nil)
+	Seed               uint64                  // seed for all randomized components
+	NumAlts            int                     // number of alternative branches to report for each k
+	Overlaps           bool                    // find candidate branches left out of the largest network because their cycles overlap chosen cycles
+	ExclSupport        bool                    // calculate exclusion support for branches of the largest network
+	MinorFreq          bool                    // calculate the approximate minor quartet frequency of each branch
+	ThresholdSweep     []float64               // quartet filter thresholds to rescore the branches of the largest network at (nil if off)
+	CandidatePercent   float64                 // branches of the largest network satisfying less than this percent of quartets on their own are candidates (off if 0)
+	CacheDir           string                  // directory for caching edge score matrices between runs (off if empty)
+	CompareModes       []sc.InitableScorer     // score modes to compare on the same preprocessed data (nil if off)
+	MaxReticulations   int                     // maximum number of reticulations to infer (no limit if 0)
+	MaxKPerVertex      int                     // maximum number of edges in the subproblem of any vertex but the root (no limit if 0)
+	AdaptiveK          bool                    // skip values of k that cannot improve a subproblem, using upper bounds on its score
+	CompactTraceback   bool                    // keep less of the traceback in memory, recomputing the cycles of the optimal networks
+	Weights            []float64               // weight of each gene tree (nil if unweighted)
+	GeneNames          []string                // name of each gene tree, used in errors and warnings (line numbers if nil)
+	ArtificialClades   [][]string              // clades below edges added to resolve polytomies (see pr.ResolvePolytomies)
+	EdgePolicy         *sc.EdgePolicy          // edges that may be added to the constraint tree (sc.DefaultEdgePolicy if nil)
+	TieBreak           TieBreak                // how the dp chooses between edges with the same score (TieShortest by default)
+	ReportTies         bool                    // log the edges tied with each branch of the optimal networks
+	CoOptimal          int                     // maximum number of distinct optimal networks with the most edges to enumerate (off if 0)
+	Within             float64                 // percent of the optimal score within which to enumerate networks for each k (off if 0)
+	WithinMax          int                     // maximum number of networks kept for any subproblem while enumerating with Within
+	AuditSamples       int                     // number of random (quartet, edge) pairs to check against the reference quartet score (off if 0)
+	Provenance         bool                    // keep the gene trees each quartet was counted from in the tree data (see pr.CountMode)
 }
 
 // Results from running the DP algorithm
 type DPResults struct {
-	Tree      *gr.TreeData  // constraint tree with preprocessed data
-	QSatScore []float64     // percent of quartets satisfied (out of total considered)
-	Branches  [][]gr.Branch // branches for optimal results
+	Tree         *gr.TreeData          // constraint tree with preprocessed data
+	QSatScore    []float64             // percent of quartets satisfied (out of total considered)
+	Branches     [][]gr.Branch         // branches for optimal results
+	Scores       []float64             // dp score at the root for each number of edges
+	RawScores    []string              // dp score at the root for 0, 1, ... edges, written exactly for the score type (see sc.FormatScore)
+	EdgeScores   map[gr.Branch]float64 // edge score of each branch in the optimal networks
+	Improvement  float64               // fraction of quartets unsatisfied by the backbone resolved per added edge
+	Alternatives [][]pr.Alternative    // best non-chosen branches for each optimal network (nil if not requested)
+	Overlaps     []pr.Overlap          // candidate branches left out of the largest network because their cycles overlap, best first (nil if not requested or none)
+	CoOptimal    [][]gr.Branch         // distinct optimal branch sets with the most edges, the first being the last of Branches (nil if not requested)
+	NearOptimal  [][]pr.NearOptimal    // networks within opts.Within percent of the optimal score for each k, best first (nil if not requested)
+	Exclusion    []float64             // best score without each branch of the largest network (nil if not requested)
+	MinorFreqs   map[gr.Branch]float64 // approximate minor quartet frequency of each branch (nil if not requested)
+	Sweep        []pr.SweepScores      // scores of the branches of the largest network at each threshold of the sweep (nil if not requested)
+	Candidates   []pr.Candidate        // branches of the largest network below opts.CandidatePercent (nil if not requested)
+	FilterStats  *pr.FilterStats       // what the quartet filter removed (nil if filter is off)
+	KStats       []pr.KStats           // work done by the dp for each k
+	Modes        []pr.ModeResult       // optimal networks for each compared score mode (nil if not requested)
 }
 
 // Interface to make DP struct agnostic to generic type when returned
 type dpRunner interface {
-	RunDP() *DPResults
+	RunDP(ctx context.Context) (*DPResults, error)
+	ExclusionScores(ctx context.Context, branches []gr.Branch) ([]float64, error)
+	EdgeScores(branches []gr.Branch) []float64
 }
 
-func MakeInferOptions(nprocs int, quartOpts pr.QuartetFilterOptions, minSupport float64, scoreMode sc.InitableScorer, asSet bool, alpha float64) (*InferOptions, error) {
+// Makes infer options. nprep and ndp set the number of processes used for
+// quartet extraction and the dp respectively, and default to nprocs if they are
+// not positive.
+func MakeInferOptions(nprocs, nprep, ndp int, quartOpts pr.QuartetFilterOptions, minSupport float64, scoreMode sc.InitableScorer, asSet bool, alpha float64) (*InferOptions, error) {
 	if quartOpts.QuartetFilterOff() && asSet {
-		log.Println("WARNING: using -asSet without quartet filtering is not recommended")
+		lg.Warnf("using -count-mode set without quartet filtering is not recommended")
+	}
+	if _, cf := scoreMode.(*sc.CFScorer); cf && !quartOpts.QuartetFilterOff() {
+		lg.Warnf("the quartet filter drops the minor quartet topologies score mode cf compares; using it with -q 0 is recommended")
 	}
+	nprocs = setNProcs(nprocs)
 	return &InferOptions{
-		NProcs:      setNProcs(nprocs),
+		PrepProcs:   setStageProcs(nprep, nprocs),
+		DPProcs:     setStageProcs(ndp, nprocs),
 		QuartetOpts: quartOpts,
 		MinSupport:  minSupport,
 		ScoreMode:   scoreMode,
@@ -51,61 +114,311 @@ func MakeInferOptions(nprocs int, quartOpts pr.QuartetFilterOptions, minSupport
 	}, nil
 }
 
+// Returns random number generator seeded with opts.Seed. Each randomized
+// component should use its own stream so that adding randomness in one place
+// doesn't change the results of another.
+func (opts InferOptions) NewRand(stream uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(opts.Seed, stream))
+}
+
+// How quartet topologies are counted during preprocessing
+func (opts InferOptions) countMode() pr.CountMode {
+	return pr.CountMode{AsSet: opts.AsSet, Cap: opts.CountCap, Length: opts.LengthWeights, Mul: opts.MulTrees, Constraint: opts.ConstraintQuartets, Provenance: opts.Provenance}
+}
+
+// Random number streams (see NewRand)
+const (
+	nullSimStream   uint64 = iota + 1 // gene tree simulation for null calibration
+	bootstrapStream                   // gene tree resampling for bootstrap support
+	auditStream                       // (quartet, edge) pairs for the quartet score audit
+)
+
 func setNProcs(nprocs int) int {
 	maxProcs := runtime.GOMAXPROCS(0)
 	switch {
 	case nprocs > maxProcs:
-		log.Printf("%d is greater than available processes (%d); limit set to %d\n", nprocs, maxProcs, maxProcs)
+		lg.Infof("%d is greater than available processes (%d); limit set to %d\n", nprocs, maxProcs, maxProcs)
 		return maxProcs
 	case nprocs <= 0:
-		log.Printf("number of processes not set; defaulting to %d processes\n", maxProcs)
+		lg.Infof("number of processes not set; defaulting to %d processes\n", maxProcs)
 		return maxProcs
 	default:
 		return nprocs
 	}
 }
 
+// Number of processes for a single stage; falls back on the overall number of
+// processes if not set
+func setStageProcs(nprocs, fallback int) int {
+	if nprocs <= 0 {
+		return fallback
+	}
+	return setNProcs(nprocs)
+}
+
 // Runs Infer algorithm -- returns preprocessed tree data struct, quartet count stats, list of branches.
-// Errors returned come from preprocessing (invalid inputs, etc.).
-func Infer(tre *tree.Tree, geneTrees []*tree.Tree, opts InferOptions) (*DPResults, error) {
-	log.Println("running infer...")
+// Errors returned come from preprocessing (invalid inputs, etc.), or are ctx's
+// error if ctx is cancelled before the run finishes.
+func Infer(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, opts InferOptions) (*DPResults, error) {
+	if opts.Weights != nil && len(opts.Weights) != len(geneTrees) {
+		return nil, fmt.Errorf("%w, %d gene tree weights given for %d gene trees", ErrInvalidOption, len(opts.Weights), len(geneTrees))
+	}
+	return infer(ctx, opts, func() (*pr.QuartetCounts, error) {
+		return pr.CountQuartets(ctx, tre, geneTrees, opts.Weights, opts.GeneNames, opts.PrepProcs, opts.MinSupport, opts.countMode())
+	})
+}
+
+// Same as Infer, but reads the gene trees from stream while extracting
+// quartets instead of holding them all in memory
+func InferStream(ctx context.Context, tre *tree.Tree, stream *pr.GeneTreeStream, opts InferOptions) (*DPResults, error) {
+	return infer(ctx, opts, func() (*pr.QuartetCounts, error) {
+		return pr.CountQuartetStream(ctx, tre, stream.All(), opts.Weights, opts.GeneNames, opts.PrepProcs, opts.MinSupport, opts.countMode())
+	})
+}
+
+// Same as Infer, but infers the quartets of each locus directly from its
+// alignment with opts.SeqMethod instead of reading them from a gene tree.
+// opts.Weights (if set) weights the loci.
+func InferAlignments(ctx context.Context, tre *tree.Tree, alns []*pr.Alignment, opts InferOptions) (*DPResults, error) {
+	return infer(ctx, opts, func() (*pr.QuartetCounts, error) {
+		return pr.CountAlignmentQuartets(ctx, tre, alns, opts.Weights, opts.PrepProcs, opts.SeqMethod, opts.countMode())
+	})
+}
+
+// Runs infer with the tree data made from the quartets counted by count
+func infer(ctx context.Context, opts InferOptions, count func() (*pr.QuartetCounts, error)) (*DPResults, error) {
+	for _, mode := range append([]sc.InitableScorer{opts.ScoreMode}, opts.CompareModes...) {
+		if _, cf := mode.(*sc.CFScorer); cf && opts.AsSet {
+			return nil, fmt.Errorf("%w, score mode cf tests quartet counts, so it cannot be used with -count-mode set", ErrInvalidOption)
+		}
+	}
+	lg.Infof("running infer...")
 	startTime := time.Now()
-	log.Println("beginning data preprocessing")
-	td, err := pr.Preprocess(tre, geneTrees, opts.NProcs, opts.QuartetOpts, opts.MinSupport)
+	lg.Infof("beginning data preprocessing")
+	endPhase := tm.Phase("preprocessing")
+	counts, err := count()
 	if err != nil {
 		return nil, fmt.Errorf("preprocess error: %w", err)
 	}
-	var dp dpRunner
-	switch scorer := opts.ScoreMode.(type) {
+	var sweepCounts *pr.QuartetCounts // unfiltered counts, kept for the threshold sweep
+	if len(opts.ThresholdSweep) != 0 {
+		sweepCounts = counts.Clone()
+	}
+	td, filterStats, err := counts.TreeData(opts.QuartetOpts)
+	if err != nil {
+		return nil, fmt.Errorf("preprocess error: %w", err)
+	}
+	nTrees := counts.NumGeneTrees()
+	endPhase()
+	if opts.AuditSamples > 0 {
+		endPhase = tm.Phase("quartet score audit")
+		auditQuartetScores(td, opts)
+		endPhase()
+	}
+	endPhase = tm.Phase("edge scores")
+	nGeneTrees := opts.countMode().NumGeneTrees(nTrees, opts.Weights)
+	dp, err := newDPRunner(opts.ScoreMode, td, nGeneTrees, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	endPhase()
+	lg.Infof("preprocessing finished, beginning dp algorithm")
+	endPhase = tm.Phase("dp")
+	results, err := dp.RunDP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results.FilterStats = filterStats
+	endPhase()
+	if k := len(results.Branches); opts.ExclSupport && k > 0 {
+		lg.Infof("rerunning dp without each of the %d branches of the largest network", k)
+		endPhase = tm.Phase("exclusion support")
+		if results.Exclusion, err = dp.ExclusionScores(ctx, results.Branches[k-1]); err != nil {
+			return nil, err
+		}
+		endPhase()
+	}
+	if opts.MinorFreq {
+		results.MinorFreqs = minorFrequencies(td, results.Branches, nGeneTrees)
+	}
+	if k := len(results.Branches); sweepCounts != nil && k > 0 {
+		lg.Infof("rescoring the %d branches of the largest network at %d quartet filter thresholds", k, len(opts.ThresholdSweep))
+		endPhase = tm.Phase("threshold sweep")
+		if results.Sweep, err = thresholdSweep(ctx, sweepCounts, results.Branches[k-1], opts); err != nil {
+			return nil, err
+		}
+		endPhase()
+	}
+	if k := len(results.Branches); opts.CandidatePercent > 0 && k > 0 {
+		if results.Candidates, err = candidateBranches(td, results.Branches[k-1], opts); err != nil {
+			return nil, err
+		}
+		lg.Infof("%d of %d branches of the largest network satisfy less than %g percent of quartets on their own", len(results.Candidates), k, opts.CandidatePercent)
+	}
+	if len(opts.CompareModes) != 0 {
+		endPhase = tm.Phase("score mode comparison")
+		if results.Modes, err = compareScoreModes(ctx, td, nGeneTrees, opts, results); err != nil {
+			return nil, err
+		}
+		endPhase()
+	}
+	results.Improvement = ImprovementPerEdge(results.QSatScore, sc.PercentDisplayed(td, countsAsSet(opts)))
+	lg.Infof("network explains %f of unsatisfied backbone quartets per added edge", results.Improvement)
+	lg.Infof("done. took %f seconds.", time.Since(startTime).Seconds())
+	return results, nil
+}
+
+// Approximate minor quartet frequency of every branch in the optimal networks
+// (see sc.ApproxMinorFrequency)
+func minorFrequencies(td *gr.TreeData, networks [][]gr.Branch, nGeneTrees int) map[gr.Branch]float64 {
+	freqs := make(map[gr.Branch]float64)
+	for _, branches := range networks {
+		for _, br := range branches {
+			if _, ok := freqs[br]; !ok {
+				freqs[br] = sc.ApproxMinorFrequency(br.IDs[gr.Ui], br.IDs[gr.Wi], td, nGeneTrees)
+			}
+		}
+	}
+	return freqs
+}
+
+// Branches that satisfy less than opts.CandidatePercent percent of quartets on
+// their own (see ScoreBranchSet), in the order given
+func candidateBranches(td *gr.TreeData, branches []gr.Branch, opts InferOptions) ([]pr.Candidate, error) {
+	asSet := countsAsSet(opts)
+	candidates := make([]pr.Candidate, 0)
+	for _, br := range branches {
+		satisfied, err := sc.TotalSatQuartets([]gr.Branch{br}, td, asSet)
+		if err != nil {
+			return nil, err
+		}
+		if percent := sc.PercentOfQuartets(satisfied, td, asSet); percent < opts.CandidatePercent {
+			candidates = append(candidates, pr.Candidate{Branch: br, Percent: percent})
+		}
+	}
+	return candidates, nil
+}
+
+// Checks the optimized quartet score on random (quartet, edge) pairs against a
+// slow reference implementation, logging a warning for each mismatch
+func auditQuartetScores(td *gr.TreeData, opts InferOptions) {
+	lg.Infof("auditing quartet scores on %d random (quartet, edge) pairs", opts.AuditSamples)
+	report := sc.AuditQuartetScores(td, opts.AuditSamples, opts.NewRand(auditStream))
+	for _, m := range report.Mismatches {
+		lg.Warnf("quartet score audit mismatch: %s", m.Describe(td))
+	}
+	lg.Infof("quartet score audit checked %d pairs, %d mismatches", report.Checked, len(report.Mismatches))
+}
+
+// Runs the dp with each score mode to compare on the already preprocessed
+// tree data, reusing the results of the main run for its own score mode
+func compareScoreModes(ctx context.Context, td *gr.TreeData, nGeneTrees int, opts InferOptions, main *DPResults) ([]pr.ModeResult, error) {
+	modes := make([]pr.ModeResult, len(opts.CompareModes))
+	runOpts := opts
+	runOpts.NumAlts, runOpts.Overlaps, runOpts.Within, runOpts.Provenance = 0, false, 0, false
+	for i, scorer := range opts.CompareModes {
+		name := sc.ScorerName(scorer)
+		results := main
+		if reflect.TypeOf(scorer) != reflect.TypeOf(opts.ScoreMode) {
+			lg.Infof("running dp with score mode %s for comparison", name)
+			dp, err := newDPRunner(freshScorer(scorer), td, nGeneTrees, runOpts)
+			if err != nil {
+				return nil, err
+			}
+			if results, err = dp.RunDP(ctx); err != nil {
+				return nil, err
+			}
+		}
+		modes[i] = pr.ModeResult{Mode: name, QSatScore: results.QSatScore, RawScores: results.RawScores, Branches: results.Branches}
+	}
+	return modes, nil
+}
+
+// Creates DP struct with score type matching scorer
+func newDPRunner(scorer sc.InitableScorer, td *gr.TreeData, nGeneTrees int, opts InferOptions) (dpRunner, error) {
+	switch scorer := scorer.(type) {
 	case *sc.MaximizeScorer:
-		dp, err = newDP(scorer, td, opts.NProcs, sc.AsSet(opts.AsSet))
+		return newDP(scorer, td, opts, sc.AsSet(opts.AsSet), sc.WithCache(opts.CacheDir))
 	case *sc.NormalizedScorer:
-		dp, err = newDP(scorer, td, opts.NProcs, sc.AsSet(opts.AsSet), sc.WithNGtrees(len(geneTrees)))
+		return newDP(scorer, td, opts, sc.AsSet(opts.AsSet), sc.WithNGtrees(nGeneTrees), sc.WithCache(opts.CacheDir))
 	case *sc.SymDiffScorer:
-		dp, err = newDP(scorer, td, opts.NProcs, sc.AsSet(true), sc.WithAlpha(opts.Alpha))
+		return newDP(scorer, td, opts, sc.AsSet(true), sc.WithNGtrees(nGeneTrees), sc.WithAlpha(opts.Alpha), sc.WithPenaltyScale(opts.PenaltyScale), sc.WithCache(opts.CacheDir))
+	case *sc.CFScorer:
+		return newDP(scorer, td, opts, sc.AsSet(opts.AsSet), sc.WithCountScale(opts.countMode().CountScale(opts.Weights)), sc.WithCache(opts.CacheDir))
 	default:
 		panic(fmt.Sprintf("unsupported scorer type %T", scorer))
 	}
-	if err != nil {
-		return nil, err
-	}
-	log.Println("preprocessing finished, beginning dp algorithm")
-	results := dp.RunDP()
-	log.Printf("done. took %f seconds.", time.Since(startTime).Seconds())
-	return results, nil
 }
 
 // Creates DP struct with appropriate score type
-func newDP[S sc.Score](scorer sc.Scorer[S], td *gr.TreeData, nprocs int, opts ...sc.ScoreOptions) (*DP[S], error) {
-	if err := scorer.Init(td, nprocs, opts...); err != nil {
+func newDP[S sc.Score](scorer sc.Scorer[S], td *gr.TreeData, inferOpts InferOptions, opts ...sc.ScoreOptions) (*DP[S], error) {
+	opts = append(opts, sc.WithEdgePolicy(inferOpts.EdgePolicy))
+	if err := scorer.Init(td, inferOpts.DPProcs, opts...); err != nil {
 		return nil, err
 	}
 	n := len(td.Nodes())
+	policy := inferOpts.EdgePolicy
+	artificial, err := artificialNodes(td, inferOpts.ArtificialClades)
+	if err != nil {
+		return nil, err
+	}
+	if artificial != nil { // edges added to resolve polytomies are not real
+		policy = policy.With(sc.ExcludeBetween("artificial", artificial))
+	}
 	return &DP[S]{
-		DP:        make([][]S, n),
-		Traceback: make([][]trace, n),
-		Scorer:    scorer,
-		NumNodes:  n,
-		Tree:      td,
+		DP:         make([][]S, n),
+		Traceback:  make([][]trace, n),
+		Scorer:     scorer,
+		NumNodes:   n,
+		Tree:       td,
+		NProcs:     inferOpts.DPProcs,
+		NumAlts:    inferOpts.NumAlts,
+		Overlaps:   inferOpts.Overlaps,
+		MaxK:       inferOpts.MaxReticulations,
+		MaxKVertex: inferOpts.MaxKPerVertex,
+		AdaptiveK:  inferOpts.AdaptiveK,
+		Compact:    inferOpts.CompactTraceback,
+		Policy:     policy,
+		TieBreak:   inferOpts.TieBreak,
+		Seed:       inferOpts.Seed,
+		ReportTies: inferOpts.ReportTies,
+		Enumerate:  inferOpts.CoOptimal,
+		Within:     inferOpts.Within,
+		WithinMax:  inferOpts.WithinMax,
 	}, nil
 }
+
+// Marks the node below each edge added to resolve a polytomy (nil if there
+// are none)
+func artificialNodes(td *gr.TreeData, clades [][]string) ([]bool, error) {
+	if len(clades) == 0 {
+		return nil, nil
+	}
+	artificial := make([]bool, len(td.Nodes()))
+	for _, clade := range clades {
+		id, err := td.CladeID(clade)
+		if err != nil {
+			return nil, err
+		}
+		artificial[id] = true
+	}
+	return artificial, nil
+}
+
+// Calculates the backbone-vs-network improvement statistic, i.e., the
+// reduction in unsatisfied quartets (relative to the constraint tree) per
+// added edge for the largest network found. qSatScore only counts the quartets
+// the edges add, so it is divided by the percent of quartets the backbone
+// leaves unsatisfied (100 - displayed, where displayed is the percent the
+// constraint tree satisfies, nonzero only if -constraint-quartets keeps them),
+// making the value a proportion in [0, 1] that is comparable across datasets.
+func ImprovementPerEdge(qSatScore []float64, displayed float64) float64 {
+	k := len(qSatScore)
+	if k == 0 || qSatScore[k-1] < 0 || displayed >= 100 {
+		return 0
+	}
+	return qSatScore[k-1] / ((100 - displayed) * float64(k))
+}
@@ -1,8 +1,15 @@
 package infer
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"math"
 	"os"
+	"reflect"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 
@@ -12,6 +19,7 @@ import (
 	gr "github.com/jsdoublel/camus/internal/graphs"
 	pr "github.com/jsdoublel/camus/internal/prep"
 	sc "github.com/jsdoublel/camus/internal/score"
+	"github.com/jsdoublel/camus/util"
 )
 
 func TestInfer(t *testing.T) {
@@ -40,7 +48,7 @@ func TestInfer(t *testing.T) {
 				"((G,F),(A,H));",
 			},
 			expNumEdges: 2,
-			result:      "(((A)#H1,((((B,(C)#H2),(#H2,D)),E),F)),(G,(#H1,H)));",
+			result:      "(((#H1,A),((((B,(#H2,C)),(D)#H2),E),F)),(G,(H)#H1));",
 		},
 		{
 			name:      "two-edge two",
@@ -60,7 +68,7 @@ func TestInfer(t *testing.T) {
 				"((A,F),(G,E));",
 			},
 			expNumEdges: 2,
-			result:      "(((A)#H1,((((B,(C)#H2),(#H2,D)),E),(#H1,F))),(G,H));",
+			result:      "(((A)#H2,((((B,(#H1,C)),(D)#H1),E),(#H2,F))),(G,H));",
 		},
 		{
 			name:      "one-sided cycle test",
@@ -129,7 +137,7 @@ func TestInfer(t *testing.T) {
 				"((R,A),(B,H));",
 			},
 			expNumEdges: 2,
-			result:      "(R,((A,((((B)#H1,C),D),((E,(F)#H2),(#H2,G)))),(#H1,H)));",
+			result:      "(R,((A,((((#H1,B),C),D),((E,(#H2,F)),(G)#H2))),(H)#H1));",
 		},
 		{
 			name:      "avoid over-adding edges 2",
@@ -141,7 +149,7 @@ func TestInfer(t *testing.T) {
 				"((R,D),(E,H));",
 			},
 			expNumEdges: 2,
-			result:      "(R,((A,(((B,(C)#H2),(#H2,D)),(((#H1,E),F),G))),(H)#H1));",
+			result:      "(R,((A,(((B,(#H1,C)),(D)#H1),(((#H2,E),F),G))),(H)#H2));",
 		},
 		{
 			name:      "test under node u lookup",
@@ -154,7 +162,7 @@ func TestInfer(t *testing.T) {
 				"((I,R),(J,A));",
 			},
 			expNumEdges: 3,
-			result:      "(R,(((A)#H1,(I,(#H1,J))),(((#H2,((B,(C)#H3),(#H3,D))),H),(((E)#H2,F),G))));",
+			result:      "(R,(((A)#H3,(I,(#H3,J))),(((#H1,((B,(#H2,C)),(D)#H2)),H),(((E)#H1,F),G))));",
 		},
 		{
 			name:      "cycle below base of one-sided cycle",
@@ -186,7 +194,7 @@ func TestInfer(t *testing.T) {
 			}
 		}
 		qopts, _ := pr.SetQuartetFilterOptions(0, 0)
-		results, err := Infer(constTree, geneTrees, InferOptions{runtime.GOMAXPROCS(0), qopts, 0, &sc.MaximizeScorer{}, false, 0})
+		results, err := Infer(context.Background(), constTree, geneTrees, InferOptions{PrepProcs: runtime.GOMAXPROCS(0), DPProcs: runtime.GOMAXPROCS(0), QuartetOpts: qopts, ScoreMode: &sc.MaximizeScorer{}})
 		if err != nil {
 			t.Fatalf("Infer failed with error %s", err)
 		}
@@ -205,6 +213,64 @@ func TestInfer(t *testing.T) {
 	}
 }
 
+func TestInfer_SymPenalty(t *testing.T) {
+	// the edge from B to above C adds two quartet topologies (counted as a set,
+	// 4 points) and could conflict with 7 sets of four taxa in each of the 2
+	// gene trees, so its score is 4 - alpha * 7 * 2
+	testCases := []struct {
+		name        string
+		alpha       float64
+		expNumEdges int
+		score       float64
+		result      string
+	}{
+		{
+			name:        "penalty below gain",
+			alpha:       0.1,
+			expNumEdges: 1,
+			score:       4 - 0.1*7*2,
+			result:      "(((#H1,((A,(B)#H1),C)),D),E);",
+		},
+		{
+			name:        "penalty above gain",
+			alpha:       0.5,
+			expNumEdges: 0,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			constTree, err := newick.NewParser(strings.NewReader("((((A,B),C),D),E);")).Parse()
+			if err != nil {
+				t.Fatal("cannot parse constraint tree")
+			}
+			geneTrees := make([]*tree.Tree, 0)
+			for _, g := range []string{"((A,C),(B,D));", "((A,C),(B,E));"} {
+				gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+				if err != nil {
+					t.Fatalf("cannot parse %s as newick tree", g)
+				}
+				geneTrees = append(geneTrees, gt)
+			}
+			results, err := Infer(context.Background(), constTree, geneTrees, BuildTestInferOpts(t, 0, 0, &sc.SymDiffScorer{}, test.alpha))
+			if err != nil {
+				t.Fatalf("Infer failed with error %s", err)
+			}
+			if len(results.Branches) != test.expNumEdges {
+				t.Fatalf("inferred %d edges, expected %d", len(results.Branches), test.expNumEdges)
+			}
+			if test.expNumEdges == 0 {
+				return
+			}
+			if math.Abs(results.Scores[0]-test.score) > 1e-9 {
+				t.Errorf("score %f != expected %f", results.Scores[0], test.score)
+			}
+			if result := gr.MakeNetwork(results.Tree, results.Branches[0]).Newick(); result != test.result {
+				t.Errorf("result %s != expected %s", result, test.result)
+			}
+		})
+	}
+}
+
 func TestInfer_Large(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -247,20 +313,9 @@ func TestInfer_Large(t *testing.T) {
 			filter:        0.5,
 			scorer:        &sc.NormalizedScorer{},
 			alpha:         0,
-			expNumEdges:   4,
+			expNumEdges:   5,
 			resultFile:    "testdata/net_q2_t05_norm.nwk",
 		},
-		{
-			name:          "pauls data sym",
-			constTreeFile: "testdata/constraint.nwk",
-			geneTreesFile: "testdata/gene-trees.nwk",
-			qMode:         2,
-			filter:        0.5,
-			scorer:        &sc.SymDiffScorer{},
-			alpha:         0.1,
-			expNumEdges:   4,
-			resultFile:    "testdata/net_q2_t05_sym_a01.nwk",
-		},
 	}
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
@@ -270,7 +325,7 @@ func TestInfer_Large(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Could not read input files for benchmark (error %s)", err)
 			}
-			results, err := Infer(tre, quartets.Trees, inferOpts)
+			results, err := Infer(context.Background(), tre, quartets.Trees, inferOpts)
 			if err != nil {
 				t.Fatalf("failed with unexpected err %s", err)
 			}
@@ -307,7 +362,8 @@ func BuildTestInferOpts(t *testing.T, qmode int, filter float64, scorer sc.Inita
 		t.Fatalf("unexpected error while setting quartet filter options")
 	}
 	return InferOptions{
-		NProcs:      runtime.GOMAXPROCS(0),
+		PrepProcs:   runtime.GOMAXPROCS(0),
+		DPProcs:     runtime.GOMAXPROCS(0),
 		QuartetOpts: qopts,
 		ScoreMode:   scorer,
 		Alpha:       alpha,
@@ -323,9 +379,1621 @@ func BenchmarkInfer(b *testing.B) {
 	}
 	for b.Loop() {
 		qopts, _ := pr.SetQuartetFilterOptions(0, 0)
-		_, err := Infer(tre, quartets.Trees, InferOptions{runtime.GOMAXPROCS(0), qopts, 0, &sc.MaximizeScorer{}, false, 0})
+		_, err := Infer(context.Background(), tre, quartets.Trees, InferOptions{PrepProcs: runtime.GOMAXPROCS(0), DPProcs: runtime.GOMAXPROCS(0), QuartetOpts: qopts, ScoreMode: &sc.MaximizeScorer{}})
 		if err != nil {
 			b.Fatalf("Infer failed with error %s", err)
 		}
 	}
 }
+
+func TestImprovementPerEdge(t *testing.T) {
+	testCases := []struct {
+		name      string
+		qSat      []float64
+		displayed float64
+		expected  float64
+	}{
+		{name: "no edges", qSat: []float64{}, expected: 0},
+		{name: "one edge", qSat: []float64{50}, expected: 0.5},
+		{name: "three edges", qSat: []float64{30, 45, 60}, expected: 0.2},
+		{name: "failed qsat", qSat: []float64{30, -1}, expected: 0},
+		{name: "kept constraint quartets", qSat: []float64{20, 30}, displayed: 40, expected: 0.25},
+		{name: "all displayed", qSat: []float64{0}, displayed: 100, expected: 0},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if result := ImprovementPerEdge(test.qSat, test.displayed); math.Abs(result-test.expected) > 1e-9 {
+				t.Errorf("result %f != expected %f", result, test.expected)
+			}
+		})
+	}
+	constTree, geneTrees := parseSmallTestInput(t)
+	dropped, err := Infer(context.Background(), constTree, geneTrees, BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0))
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	constTree, geneTrees = parseSmallTestInput(t)
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.ConstraintQuartets = pr.ConstraintQuartets{Weight: 1}
+	kept, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if dropped.Improvement <= 0 || math.Abs(kept.Improvement-dropped.Improvement) > 1e-9 {
+		t.Errorf("improvement is %f keeping constraint quartets and %f dropping them", kept.Improvement, dropped.Improvement)
+	}
+}
+
+func TestCalcQuartetChanges(t *testing.T) {
+	tre, geneTrees, err := pr.ReadInputFiles("testdata/constraint.nwk", "testdata/gene-trees.nwk", pr.Newick)
+	if err != nil {
+		t.Fatalf("could not read input files (error %s)", err)
+	}
+	results, err := Infer(context.Background(), tre, geneTrees.Trees, BuildTestInferOpts(t, 2, 0.5, &sc.MaximizeScorer{}, 0))
+	if err != nil {
+		t.Fatalf("failed with unexpected err %s", err)
+	}
+	changes := CalcQuartetChanges(results)
+	if len(changes) != len(results.Branches) {
+		t.Fatalf("number of changes %d != number of networks %d", len(changes), len(results.Branches))
+	}
+	total := float64(results.Tree.TotalNumQuartets())
+	var satisfied int64
+	for i, change := range changes {
+		if change.K != i+1 {
+			t.Errorf("change has k %d, expected %d", change.K, i+1)
+		}
+		gained, lost := change.Counts(results.Tree)
+		satisfied += int64(gained) - int64(lost)
+		if percent := 100 * float64(satisfied) / total; math.Abs(percent-results.QSatScore[i]) > 1e-9 {
+			t.Errorf("cumulative changes give %f percent satisfied at k %d, expected %f", percent, i+1, results.QSatScore[i])
+		}
+	}
+}
+
+func TestEstimateResources(t *testing.T) {
+	tre, geneTrees, err := pr.ReadInputFiles("testdata/constraint.nwk", "testdata/gene-trees.nwk", pr.Newick)
+	if err != nil {
+		t.Fatalf("could not read input files (error %s)", err)
+	}
+	est, err := EstimateResources(tre, geneTrees.Trees, BuildTestInferOpts(t, 0, 0, &sc.NormalizedScorer{}, 0))
+	if err != nil {
+		t.Fatalf("failed with unexpected err %s", err)
+	}
+	if est.NumTaxa != 22 || est.NumNodes != 43 || est.NumGeneTrees != len(geneTrees.Trees) {
+		t.Errorf("unexpected sizes taxa %d, nodes %d, gene trees %d", est.NumTaxa, est.NumNodes, est.NumGeneTrees)
+	}
+	if est.MaxUniqueQuartets > 3*7315 || est.MaxUniqueQuartets > est.GeneTreeQuartets {
+		t.Errorf("unique quartet bound %d is invalid", est.MaxUniqueQuartets)
+	}
+	if est.Bytes() == 0 || est.Time() == 0 {
+		t.Errorf("expected non-zero estimates, got %d bytes and %s", est.Bytes(), est.Time())
+	}
+	unrooted, err := newick.NewParser(strings.NewReader("((a,b),(c,d),e);")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if _, err := EstimateResources(unrooted, nil, BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)); !errors.Is(err, pr.ErrUnrooted) {
+		t.Errorf("expected unrooted error, got %v", err)
+	}
+}
+
+func TestMakeInferOptions_Procs(t *testing.T) {
+	maxProcs := runtime.GOMAXPROCS(0)
+	testCases := []struct {
+		name                 string
+		nprocs, nprep, ndp   int
+		expectPrep, expectDP int
+	}{
+		{name: "default", expectPrep: maxProcs, expectDP: maxProcs},
+		{name: "fallback to n", nprocs: 1, expectPrep: 1, expectDP: 1},
+		{name: "separate", nprocs: 1, nprep: maxProcs, ndp: 1, expectPrep: maxProcs, expectDP: 1},
+		{name: "capped", nprep: maxProcs + 1, expectPrep: maxProcs, expectDP: maxProcs},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			qopts, err := pr.SetQuartetFilterOptions(0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, err := MakeInferOptions(test.nprocs, test.nprep, test.ndp, qopts, 0, &sc.MaximizeScorer{}, false, 0)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if opts.PrepProcs != test.expectPrep || opts.DPProcs != test.expectDP {
+				t.Errorf("got prep %d dp %d, expected prep %d dp %d", opts.PrepProcs, opts.DPProcs, test.expectPrep, test.expectDP)
+			}
+		})
+	}
+}
+
+func TestInferOptions_NewRand(t *testing.T) {
+	opts := InferOptions{Seed: 42}
+	r1, r2, other := opts.NewRand(1), opts.NewRand(1), opts.NewRand(2)
+	same := true
+	for range 10 {
+		x := r1.Uint64()
+		if x != r2.Uint64() {
+			t.Fatal("same seed and stream produced different values")
+		}
+		if x != other.Uint64() {
+			same = false
+		}
+	}
+	if same {
+		t.Error("different streams produced the same values")
+	}
+}
+
+func TestInfer_Alternatives(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.NumAlts = 3
+	results, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if len(results.Alternatives) != len(results.Branches) {
+		t.Fatalf("got alternatives for %d networks, expected %d", len(results.Alternatives), len(results.Branches))
+	}
+	for i, alts := range results.Alternatives {
+		if len(alts) == 0 || len(alts) > opts.NumAlts {
+			t.Errorf("k=%d: got %d alternatives", i+1, len(alts))
+		}
+		for j, alt := range alts {
+			if alt.Gap < 0 {
+				t.Errorf("k=%d: alternative %v scores better than the optimal network", i+1, alt.Branch)
+			}
+			if slices.Contains(results.Branches[i], alt.Branch) || !slices.Contains(results.Branches[i], alt.Replaces) {
+				t.Errorf("k=%d: alternative %v replacing %v is invalid", i+1, alt.Branch, alt.Replaces)
+			}
+			if j > 0 && alt.Score > alts[j-1].Score {
+				t.Errorf("k=%d: alternatives not sorted by score", i+1)
+			}
+		}
+	}
+}
+
+func TestInfer_Overlaps(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,B),(C,D));", "((A,B),(C,D));", "((A,C),(B,E));", "((G,F),(A,H));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.Overlaps = true
+	results, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if len(results.Overlaps) == 0 {
+		t.Fatal("expected candidate branches left out because of overlap")
+	}
+	branches := results.Branches[len(results.Branches)-1]
+	weakest := results.EdgeScores[branches[0]]
+	for _, br := range branches {
+		weakest = min(weakest, results.EdgeScores[br])
+	}
+	for i, o := range results.Overlaps {
+		if slices.Contains(branches, o.Branch) {
+			t.Errorf("overlap %v is in the network", o.Branch)
+		}
+		if o.Score < weakest {
+			t.Errorf("overlap %v scores %f, less than the weakest branch %f", o.Branch, o.Score, weakest)
+		}
+		if len(o.Conflicts) == 0 {
+			t.Errorf("overlap %v has no conflicts", o.Branch)
+		}
+		for _, c := range o.Conflicts {
+			if !slices.Contains(branches, c) || gr.Compatible(o.Branch, c, results.Tree) {
+				t.Errorf("overlap %v does not conflict with %v", o.Branch, c)
+			}
+		}
+		if i > 0 && o.Score > results.Overlaps[i-1].Score {
+			t.Error("overlaps not sorted by score")
+		}
+	}
+	opts.Overlaps = false
+	if results, err = Infer(context.Background(), constTree, geneTrees, opts); err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	} else if results.Overlaps != nil {
+		t.Error("got overlaps without asking for them")
+	}
+}
+
+func TestInfluence(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));", "((G,F),(A,H));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	names := []string{"1", "2", "3"}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	full, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	influences, err := Influence(context.Background(), constTree, geneTrees, names, opts, full)
+	if err != nil {
+		t.Fatalf("Influence failed with error %s", err)
+	}
+	if len(influences) != len(geneTrees) {
+		t.Fatalf("got %d influences, expected %d", len(influences), len(geneTrees))
+	}
+	// gene 1 is the only gene supporting one of the two edges, so removing it must change the network
+	if influences[0].Gene != "1" || influences[0].EdgesChanged == 0 {
+		t.Errorf("expected gene 1 to be most influential, got %+v", influences)
+	}
+	for _, inf := range influences[1:] {
+		if inf.EdgesChanged != 0 {
+			t.Errorf("removing duplicated gene %s should not change edges, got %+v", inf.Gene, inf)
+		}
+	}
+	if _, err := Influence(context.Background(), constTree, geneTrees[:1], names[:1], opts, full); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected error for single gene tree, got %v", err)
+	}
+}
+
+func TestJackknife(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));", "((G,F),(A,H));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	names := []string{"1", "2", "3"}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.Provenance = true
+	full, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if len(full.Branches) != 2 {
+		t.Fatalf("expected two edges, got %d", len(full.Branches))
+	}
+	labeled := map[string]gr.Branch{"#H1": full.Branches[1][0], "#H2": full.Branches[1][1]}
+	summaries, err := Jackknife(full.Tree, labeled, names, 1, opts)
+	if err != nil {
+		t.Fatalf("Jackknife failed with error %s", err)
+	}
+	slices.SortFunc(summaries, func(a, b pr.JackknifeSummary) int { return cmp.Compare(a.Support, b.Support) })
+	// gene 1 is the only gene supporting one edge, and genes 2 and 3 each hold half of the other
+	expected := []pr.JackknifeSummary{
+		{Support: 1, MinSupport: 0, Block: 1, Genes: []string{"1"}, BlocksForHalf: 1},
+		{Support: 2, MinSupport: 1, Block: 2, Genes: []string{"2"}, BlocksForHalf: 1},
+	}
+	for i, js := range summaries {
+		js.Reticulation = ""
+		if !reflect.DeepEqual(js, expected[i]) {
+			t.Errorf("got %+v, expected %+v", js, expected[i])
+		}
+	}
+	summaries, err = Jackknife(full.Tree, labeled, names, 2, opts)
+	if err != nil {
+		t.Fatalf("Jackknife failed with error %s", err)
+	}
+	for _, js := range summaries {
+		if js.Block != 1 || !slices.Equal(js.Genes, []string{"1", "2"}) || js.MinSupport != js.Support-1 {
+			t.Errorf("with blocks of two, got %+v, expected the first block (genes 1 and 2) to drop one quartet", js)
+		}
+	}
+	opts.Provenance = false
+	full, err = Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if _, err := Jackknife(full.Tree, labeled, names, 1, opts); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected error without provenance, got %v", err)
+	}
+}
+
+func TestInfer_ExclusionSupport(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.ExclSupport = true
+	results, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	k := len(results.Branches)
+	if len(results.Exclusion) != k {
+		t.Fatalf("got %d exclusion scores, expected %d", len(results.Exclusion), k)
+	}
+	for i, excl := range results.Exclusion {
+		// the network is optimal, so removing an edge can never do better
+		if support := results.Scores[k-1] - excl; support < 0 {
+			t.Errorf("branch %v: expected non-negative support, got %f", results.Branches[k-1][i], support)
+		}
+	}
+}
+
+func TestInfer_ThresholdSweep(t *testing.T) {
+	tre, geneTrees, err := pr.ReadInputFiles("testdata/constraint.nwk", "testdata/gene-trees.nwk", pr.Newick)
+	if err != nil {
+		t.Fatalf("could not read input files (error %s)", err)
+	}
+	opts := BuildTestInferOpts(t, 2, 0.5, &sc.MaximizeScorer{}, 0)
+	opts.ThresholdSweep = []float64{0.25, 0.5, 0.75}
+	results, err := Infer(context.Background(), tre, geneTrees.Trees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	k := len(results.Branches)
+	if len(results.Sweep) != k {
+		t.Fatalf("got %d swept branches, expected %d", len(results.Sweep), k)
+	}
+	var percent float64
+	for i, sweep := range results.Sweep {
+		if sweep.Branch != results.Branches[k-1][i] {
+			t.Errorf("swept branch %v, expected %v", sweep.Branch, results.Branches[k-1][i])
+		}
+		if len(sweep.Percent) != len(opts.ThresholdSweep) {
+			t.Fatalf("got %d scores, expected one per threshold", len(sweep.Percent))
+		}
+		percent += sweep.Percent[1]
+	}
+	// 0.5 is the threshold of the run itself
+	if expected := results.QSatScore[k-1]; math.Abs(percent-expected) > 1e-9 {
+		t.Errorf("got %f percent satisfied at the run's threshold, expected %f", percent, expected)
+	}
+}
+
+func TestInfer_CandidatePercent(t *testing.T) {
+	tre, geneTrees, err := pr.ReadInputFiles("testdata/constraint.nwk", "testdata/gene-trees.nwk", pr.Newick)
+	if err != nil {
+		t.Fatalf("could not read input files (error %s)", err)
+	}
+	opts := BuildTestInferOpts(t, 2, 0.5, &sc.MaximizeScorer{}, 0)
+	opts.CandidatePercent = 100
+	results, err := Infer(context.Background(), tre, geneTrees.Trees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	k := len(results.Branches)
+	if len(results.Candidates) != k {
+		t.Fatalf("got %d candidates, expected every branch (%d)", len(results.Candidates), k)
+	}
+	var percent, most float64
+	for _, c := range results.Candidates {
+		percent += c.Percent
+		most = max(most, c.Percent)
+	}
+	if expected := results.QSatScore[k-1]; math.Abs(percent-expected) > 1e-9 {
+		t.Errorf("candidates satisfy %f percent of quartets, expected %f", percent, expected)
+	}
+	// the branch satisfying the most quartets is not a candidate at its own percent
+	candidates, err := candidateBranches(results.Tree, results.Branches[k-1], InferOptions{AsSet: opts.AsSet, CandidatePercent: most})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range candidates {
+		if c.Percent >= most {
+			t.Errorf("branch %v satisfies %f percent, which is not below %f", c.Branch, c.Percent, most)
+		}
+	}
+}
+
+func TestInferAlignments(t *testing.T) {
+	taxa := []string{"A", "B", "C", "D", "E"}
+	// each split of a gene tree is a site with A on one side and G on the
+	// other, so parsimony gives the quartets of the gene tree
+	alignment := func(splits ...string) *pr.Alignment {
+		aln := &pr.Alignment{Taxa: taxa, Seqs: make([][]byte, len(taxa))}
+		for i, taxon := range taxa {
+			for _, split := range splits {
+				state := byte('G')
+				if strings.Contains(split, taxon) {
+					state = 'A'
+				}
+				aln.Seqs[i] = append(aln.Seqs[i], state, state)
+			}
+		}
+		return aln
+	}
+	alns := []*pr.Alignment{alignment("AC", "DE"), alignment("AC", "DE"), alignment("AB", "DE")}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, nwk := range []string{"((A,C),(B,(D,E)));", "((A,C),(B,(D,E)));", "((A,B),(C,(D,E)));"} {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatal("invalid newick tree; test is written wrong")
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	parseTree := func() *tree.Tree {
+		tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+		if err != nil {
+			t.Fatal("invalid newick tree; test is written wrong")
+		}
+		return tre
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	expected, err := Infer(context.Background(), parseTree(), geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	results, err := InferAlignments(context.Background(), parseTree(), alns, opts)
+	if err != nil {
+		t.Fatalf("InferAlignments failed with error %s", err)
+	}
+	if !slices.Equal(results.QSatScore, expected.QSatScore) {
+		t.Errorf("got quartet satisfied percents %v, expected %v", results.QSatScore, expected.QSatScore)
+	}
+	if len(results.Branches) != len(expected.Branches) || len(results.Branches) == 0 {
+		t.Fatalf("got %d networks, expected %d (and at least one)", len(results.Branches), len(expected.Branches))
+	}
+	for k := range results.Branches {
+		if !slices.Equal(results.Branches[k], expected.Branches[k]) {
+			t.Errorf("network %d: got branches %v, expected %v", k+1, results.Branches[k], expected.Branches[k])
+		}
+	}
+}
+
+func TestSimulateGeneTree(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	if err := pr.PrepareConstraintTree(constTree); err != nil {
+		t.Fatal(err)
+	}
+	// gene trees matching the constraint tree give the longest branches, and
+	// then (with no ils) simulated gene trees match the constraint tree
+	geneTrees := []*tree.Tree{constTree.Clone(), constTree.Clone()}
+	lengths := estimateBranchLengths(constTree, geneTrees)
+	for _, n := range constTree.Nodes() {
+		if !n.Tip() && n != constTree.Root() && lengths[n.Id()] < maxCoalescentLength/2 {
+			t.Errorf("node %d: expected long branch, got %f", n.Id(), lengths[n.Id()])
+		}
+	}
+	keep := map[string]bool{"A": true, "B": true, "C": true, "D": true, "G": true}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	gt, err := simulateGeneTree(constTree, lengths, keep, opts.NewRand(nullSimStream))
+	if err != nil {
+		t.Fatalf("simulateGeneTree failed with error %s", err)
+	}
+	if !gt.Rooted() {
+		t.Error("simulated gene tree is not rooted")
+	}
+	tips := make([]string, 0)
+	for _, tip := range gt.Tips() {
+		tips = append(tips, tip.Name())
+	}
+	slices.Sort(tips)
+	if !slices.Equal(tips, []string{"A", "B", "C", "D", "G"}) {
+		t.Errorf("simulated gene tree has tips %v", tips)
+	}
+	for _, e := range gt.Edges() {
+		if e.Length() < 0 {
+			t.Errorf("simulated gene tree has negative or missing branch length %f", e.Length())
+		}
+	}
+	gt.ClearLengths(true, true)
+	if nwk := gt.Newick(); !strings.Contains(nwk, "(B,C)") && !strings.Contains(nwk, "(C,B)") {
+		t.Errorf("expected simulated gene tree %s to contain (B,C)", nwk)
+	}
+}
+
+func TestSummarizeNullGains(t *testing.T) {
+	gains := scoreGains([]float64{10, 15, 16})
+	if !slices.Equal(gains, []float64{10, 5, 1}) {
+		t.Fatalf("got gains %v, expected [10 5 1]", gains)
+	}
+	null := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}
+	got := summarizeNullGains(2, gains[1], null)
+	exp := pr.NullGain{NumEdges: 2, Gain: 5, NullMean: 9.5, NullQuantile: 18, PValue: 16.0 / 21}
+	if got != exp {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+}
+
+func TestPlaceTaxa(t *testing.T) {
+	testCases := []struct {
+		name       string
+		network    string
+		geneTrees  []string
+		placements map[string]string
+		result     string
+	}{
+		{
+			name:      "sister to leaf",
+			network:   "((((#H1,C),(A,B)),(D,(E)#H1)),(F,(G,H)));",
+			geneTrees: []string{"((((A,X),B),C),(D,E),(F,(G,H)));", "(((A,X),B),(E,C),(D,(F,H)));"},
+			placements: map[string]string{
+				"X": "{A}",
+			},
+			result: "((((#H1,C),((X,A),B)),(D,(E)#H1)),(F,(G,H)));",
+		},
+		{
+			name:      "edge split by reticulation",
+			network:   "((((#H1,C),(A,B)),(D,(E)#H1)),(F,(G,H)));",
+			geneTrees: []string{"((((A,B),C),(D,(E,X))),(F,(G,H)));", "((A,B),((E,X),D),(F,H));", "((Y,F),(G,H),(A,B));"},
+			placements: map[string]string{
+				"X": "{E}",
+				"Y": "{F}",
+			},
+			// X goes above the reticulation node on E's edge
+			result: "((((#H1,C),(A,B)),(D,(X,(E)#H1))),((Y,F),(G,H)));",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ntw, err := newick.NewParser(strings.NewReader(test.network)).Parse()
+			if err != nil {
+				t.Fatal("cannot parse network")
+			}
+			geneTrees := make([]*tree.Tree, 0)
+			for _, g := range test.geneTrees {
+				gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+				if err != nil {
+					t.Fatalf("cannot parse %s as newick tree", g)
+				}
+				geneTrees = append(geneTrees, gt)
+			}
+			placements, err := PlaceTaxa(ntw, geneTrees)
+			if err != nil {
+				t.Fatalf("PlaceTaxa failed with error %s", err)
+			}
+			if len(placements) != len(test.placements) {
+				t.Fatalf("got %d placements, expected %d", len(placements), len(test.placements))
+			}
+			for _, p := range placements {
+				if p.Clade != test.placements[p.Taxon] || p.Satisfied == 0 || p.Satisfied > p.Total {
+					t.Errorf("got placement %+v, expected %s on %s", p, p.Taxon, test.placements[p.Taxon])
+				}
+			}
+			if nwk := ntw.Newick(); nwk != test.result {
+				t.Errorf("got network %s, expected %s", nwk, test.result)
+			}
+		})
+	}
+}
+
+func TestInfer_Cancelled(t *testing.T) {
+	parse := func(nwk string) *tree.Tree {
+		tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", nwk)
+		}
+		return tre
+	}
+	constNwk := "(A,(B,(C,(D,(E,(F,(G,(H,(I,J)))))))));"
+	geneTrees := []*tree.Tree{parse("(A,(B,(C,D)));"), parse("(B,(C,D),E);")}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Infer(ctx, parse(constNwk), geneTrees, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("Infer: expected %v, got %v", context.Canceled, err)
+	}
+	td, _, err := pr.Preprocess(context.Background(), parse(constNwk), geneTrees, nil, nil, opts.PrepProcs, opts.QuartetOpts, opts.MinSupport, opts.countMode())
+	if err != nil {
+		t.Fatalf("Preprocess failed with error %s", err)
+	}
+	dp, err := newDP(&sc.MaximizeScorer{}, td, opts)
+	if err != nil {
+		t.Fatalf("newDP failed with error %s", err)
+	}
+	if _, err := dp.RunDP(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunDP: expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := dp.ExclusionScores(ctx, []gr.Branch{{IDs: [2]int{1, 2}}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ExclusionScores: expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestFill_SkipsUninformativeVertices(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,B),((C,D),(E,F)));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	gt, err := newick.NewParser(strings.NewReader("((A,C),(B,D));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse gene tree")
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	td, _, err := pr.Preprocess(context.Background(), constTree, []*tree.Tree{gt}, nil, nil, opts.PrepProcs, opts.QuartetOpts, opts.MinSupport, opts.countMode())
+	if err != nil {
+		t.Fatalf("Preprocess failed with error %s", err)
+	}
+	dp, err := newDP(&sc.MaximizeScorer{}, td, opts)
+	if err != nil {
+		t.Fatalf("newDP failed with error %s", err)
+	}
+	if err := dp.fill(context.Background()); err != nil {
+		t.Fatalf("fill failed with error %s", err)
+	}
+	// only the root has a quartet with three taxa below it
+	if dp.Skipped != 4 {
+		t.Errorf("skipped %d vertices, expected 4", dp.Skipped)
+	}
+	for _, v := range td.Nodes() {
+		if v != td.Root() && len(dp.DP[v.Id()]) != 1 {
+			t.Errorf("vertex %s has %d dp entries, expected 1", td.LeafsetAsString(v), len(dp.DP[v.Id()]))
+		}
+	}
+}
+
+func TestInfer_KStats(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	results, err := Infer(context.Background(), constTree, geneTrees, BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0))
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	// the root also tries (and fails) to add one more edge
+	if len(results.KStats) < len(results.Branches) {
+		t.Fatalf("got stats for %d values of k, expected at least %d", len(results.KStats), len(results.Branches))
+	}
+	for i, st := range results.KStats {
+		if st.K != i+1 {
+			t.Errorf("stats %d has k %d", i, st.K)
+		}
+		if st.Vertices == 0 || st.ValidSplits > st.EdgesEvaluated {
+			t.Errorf("inconsistent stats for k %d: %+v", st.K, st)
+		}
+		if st.K == 1 && (st.EdgesEvaluated == 0 || st.CacheHits != 0) {
+			t.Errorf("expected edges evaluated and no cache hits for k 1, got %+v", st)
+		}
+	}
+}
+
+func TestInfer_KStatsCounts(t *testing.T) {
+	// the vertex above (A,B),C and (D,E),F has two children that are not
+	// tips, so edges down from it could be counted once per child
+	constTree, err := newick.NewParser(strings.NewReader("(((((A,B),C),((D,E),F)),G),H);")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,D),(B,C));", "((C,F),(D,E));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	results, err := Infer(context.Background(), constTree, geneTrees, BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0))
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	td := results.Tree
+	var allowed uint64
+	for u := range len(td.Nodes()) {
+		for w := range len(td.Nodes()) {
+			// edges are scored at the lca of their ends, which is skipped if
+			// no quartets have three taxa under it
+			if sc.DefaultEdgePolicy.Allows(u, w, td) && len(td.Quartets(td.LCA(u, w))) != 0 {
+				allowed++
+			}
+		}
+	}
+	if len(results.KStats) == 0 {
+		t.Fatal("got no stats")
+	}
+	// with no edges before it, every allowed edge is evaluated once and has a
+	// valid split that needs nothing from the cycle dp
+	expected := pr.KStats{K: 1, EdgesEvaluated: allowed, ValidSplits: allowed, CacheHits: 0}
+	st := results.KStats[0]
+	if st.K != expected.K || st.EdgesEvaluated != expected.EdgesEvaluated || st.ValidSplits != expected.ValidSplits || st.CacheHits != expected.CacheHits {
+		t.Errorf("got stats %+v, expected %d edges evaluated, %d valid splits, and %d cache hits",
+			st, expected.EdgesEvaluated, expected.ValidSplits, expected.CacheHits)
+	}
+}
+
+func TestScoreBranchSet(t *testing.T) {
+	parse := func() (*tree.Tree, []*tree.Tree) {
+		constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+		if err != nil {
+			t.Fatal("cannot parse constraint tree")
+		}
+		geneTrees := make([]*tree.Tree, 0)
+		for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));"} {
+			gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+			if err != nil {
+				t.Fatalf("cannot parse %s as newick tree", g)
+			}
+			geneTrees = append(geneTrees, gt)
+		}
+		return constTree, geneTrees
+	}
+	clade := func(td *gr.TreeData, id int) []string {
+		return strings.Split(strings.Trim(td.LeafsetAsString(td.IdToNodes[id]), "{}"), ",")
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	constTree, geneTrees := parse()
+	results, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	largest := results.Branches[len(results.Branches)-1]
+	clades := make([]pr.BranchClades, len(largest))
+	for i, br := range largest {
+		clades[i] = pr.BranchClades{U: clade(results.Tree, br.IDs[gr.Ui]), W: clade(results.Tree, br.IDs[gr.Wi])}
+	}
+	t.Run("matches dp", func(t *testing.T) {
+		constTree, geneTrees := parse()
+		_, scores, err := ScoreBranchSet(context.Background(), constTree, geneTrees, clades, opts)
+		if err != nil {
+			t.Fatalf("ScoreBranchSet failed with error %s", err)
+		}
+		var percent float64
+		for _, bs := range scores {
+			percent += bs.Percent
+		}
+		if expected := results.QSatScore[len(results.QSatScore)-1]; math.Abs(percent-expected) > 1e-9 {
+			t.Errorf("got %f percent satisfied, expected %f", percent, expected)
+		}
+	})
+	t.Run("overlapping", func(t *testing.T) {
+		constTree, geneTrees := parse()
+		_, _, err := ScoreBranchSet(context.Background(), constTree, geneTrees, []pr.BranchClades{clades[0], clades[0]}, opts)
+		if !errors.Is(err, ErrInvalidBranch) {
+			t.Errorf("got error %v, expected %v", err, ErrInvalidBranch)
+		}
+	})
+	t.Run("not a clade", func(t *testing.T) {
+		constTree, geneTrees := parse()
+		_, _, err := ScoreBranchSet(context.Background(), constTree, geneTrees, []pr.BranchClades{{U: []string{"A", "B"}, W: []string{"G"}}}, opts)
+		if !errors.Is(err, gr.ErrNotClade) {
+			t.Errorf("got error %v, expected %v", err, gr.ErrNotClade)
+		}
+	})
+}
+
+func TestScoreEdges(t *testing.T) {
+	parse := func() (*tree.Tree, []*tree.Tree) {
+		constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C)x,D),E),F)),(G,H));")).Parse()
+		if err != nil {
+			t.Fatal("cannot parse constraint tree")
+		}
+		geneTrees := make([]*tree.Tree, 0)
+		for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));", "((B,D),(C,E));"} {
+			gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+			if err != nil {
+				t.Fatalf("cannot parse %s as newick tree", g)
+			}
+			geneTrees = append(geneTrees, gt)
+		}
+		return constTree, geneTrees
+	}
+	modes := []sc.InitableScorer{&sc.MaximizeScorer{}, &sc.NormalizedScorer{}, &sc.SymDiffScorer{}}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.Alpha = 0.5
+	constTree, geneTrees := parse()
+	results, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	largest := results.Branches[len(results.Branches)-1]
+	end := func(td *gr.TreeData, id int) pr.EdgeEnd {
+		return pr.EdgeEnd{Clade: strings.Split(strings.Trim(td.LeafsetAsString(td.IdToNodes[id]), "{}"), ",")}
+	}
+	t.Run("matches dp", func(t *testing.T) {
+		edges := make([]pr.EdgeEnds, len(largest))
+		for i, br := range largest {
+			edges[i] = pr.EdgeEnds{U: end(results.Tree, br.IDs[gr.Ui]), W: end(results.Tree, br.IDs[gr.Wi])}
+		}
+		constTree, geneTrees := parse()
+		_, scores, err := ScoreEdges(context.Background(), constTree, geneTrees, edges, modes, opts)
+		if err != nil {
+			t.Fatalf("ScoreEdges failed with error %s", err)
+		}
+		for i, es := range scores {
+			if len(es.Scores) != len(modes) {
+				t.Fatalf("edge %d has %d scores, expected %d", i+1, len(es.Scores), len(modes))
+			}
+			if expected := results.EdgeScores[largest[i]]; es.Scores[0] != expected {
+				t.Errorf("edge %d has max score %f, expected %f", i+1, es.Scores[0], expected)
+			}
+		}
+	})
+	t.Run("labels", func(t *testing.T) {
+		constTree, geneTrees := parse()
+		// the same edge twice, which could not be in one network
+		edges := []pr.EdgeEnds{{U: pr.EdgeEnd{Label: "x"}, W: pr.EdgeEnd{Label: "E"}}, {U: pr.EdgeEnd{Label: "x"}, W: pr.EdgeEnd{Label: "E"}}}
+		td, scores, err := ScoreEdges(context.Background(), constTree, geneTrees, edges, modes[:1], opts)
+		if err != nil {
+			t.Fatalf("ScoreEdges failed with error %s", err)
+		}
+		if u := td.LeafsetAsString(td.IdToNodes[scores[0].Branch.IDs[gr.Ui]]); u != "{B,C}" {
+			t.Errorf("x resolved to %s, expected {B,C}", u)
+		}
+	})
+	t.Run("unknown label", func(t *testing.T) {
+		constTree, geneTrees := parse()
+		_, _, err := ScoreEdges(context.Background(), constTree, geneTrees, []pr.EdgeEnds{{U: pr.EdgeEnd{Label: "y"}, W: pr.EdgeEnd{Label: "E"}}}, modes, opts)
+		if !errors.Is(err, ErrInvalidBranch) {
+			t.Errorf("got error %v, expected %v", err, ErrInvalidBranch)
+		}
+	})
+}
+
+func TestInfer_CompareModes(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((((A,B),C),D),E);")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,C),(B,D));", "((A,C),(B,E));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.CompareModes = []sc.InitableScorer{&sc.MaximizeScorer{}, &sc.NormalizedScorer{}, &sc.SymDiffScorer{}}
+	opts.Alpha = 0.1
+	results, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if len(results.Modes) != 3 {
+		t.Fatalf("got %d mode results, expected 3", len(results.Modes))
+	}
+	for i, expected := range []string{"max", "norm", "sym"} {
+		m := results.Modes[i]
+		if m.Mode != expected {
+			t.Errorf("mode %d is %s, expected %s", i, m.Mode, expected)
+		}
+		if len(m.QSatScore) != len(m.Branches) || len(m.Branches) == 0 {
+			t.Errorf("mode %s has %d qsat scores and %d networks", m.Mode, len(m.QSatScore), len(m.Branches))
+		}
+	}
+	if !slices.Equal(results.Modes[0].QSatScore, results.QSatScore) {
+		t.Errorf("main score mode results %v differ from main run %v", results.Modes[0].QSatScore, results.QSatScore)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	constTree, err := newick.NewParser(strings.NewReader("((A,((((B,C),D),E),F)),(G,H));")).Parse()
+	if err != nil {
+		t.Fatal("cannot parse constraint tree")
+	}
+	geneTrees := make([]*tree.Tree, 0)
+	for _, g := range []string{"((A,B),(C,D));", "((G,F),(A,H));", "((A,B),(C,D));"} {
+		gt, err := newick.NewParser(strings.NewReader(g)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", g)
+		}
+		geneTrees = append(geneTrees, gt)
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.Seed = 7
+	results, err := Infer(context.Background(), constTree, geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	parts := &pr.Partitions{Names: []string{"a", "b"}, Members: [][]int{{0, 2}, {1}}}
+	support, err := Bootstrap(context.Background(), constTree, geneTrees, parts, 10, true, opts, results)
+	if err != nil {
+		t.Fatalf("Bootstrap failed with error %s", err)
+	}
+	if k := len(results.Branches); len(support) != len(results.Branches[k-1]) {
+		t.Fatalf("got %d support values, expected %d", len(support), len(results.Branches[k-1]))
+	}
+	for _, s := range support {
+		if s < 0 || s > 1 {
+			t.Errorf("support %f is not a fraction", s)
+		}
+	}
+	again, err := Bootstrap(context.Background(), constTree, geneTrees, parts, 10, true, opts, results)
+	if err != nil {
+		t.Fatalf("Bootstrap failed with error %s", err)
+	}
+	if !slices.Equal(support, again) {
+		t.Errorf("same seed gave different support %v and %v", support, again)
+	}
+	if sizes := stratumSizes(parts, 3, false); !slices.Equal(sizes, []int{2, 1}) {
+		t.Errorf("got stratum sizes %v, expected [2 1]", sizes)
+	}
+	if sizes := stratumSizes(parts, 3, true); !slices.Equal(sizes, []int{1, 1}) {
+		t.Errorf("got balanced stratum sizes %v, expected [1 1]", sizes)
+	}
+}
+
+func TestInfer_MaxReticulations(t *testing.T) {
+	tre, geneTrees := parseSmallTestInput(t)
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	full, err := Infer(context.Background(), tre.Clone(), geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if len(full.Branches) < 3 {
+		t.Fatalf("test data should give at least 3 edges, got %d", len(full.Branches))
+	}
+	opts.MaxReticulations = 2
+	capped, err := Infer(context.Background(), tre.Clone(), geneTrees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	if len(capped.Branches) != 2 {
+		t.Fatalf("got %d networks, expected 2", len(capped.Branches))
+	}
+	if !slices.Equal(capped.Scores, full.Scores[:2]) {
+		t.Errorf("capped scores %v differ from uncapped scores %v", capped.Scores, full.Scores[:2])
+	}
+	for k, branches := range capped.Branches {
+		if !slices.Equal(branches, full.Branches[k]) {
+			t.Errorf("network with %d edges is %v, expected %v", k+1, branches, full.Branches[k])
+		}
+	}
+}
+
+func TestInfer_Weights(t *testing.T) {
+	parse := func(nwks ...string) []*tree.Tree {
+		trees := make([]*tree.Tree, len(nwks))
+		for i, nwk := range nwks {
+			tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+			if err != nil {
+				t.Fatalf("cannot parse %s as newick tree", nwk)
+			}
+			trees[i] = tre
+		}
+		return trees
+	}
+	constNwk := "((A,((((B,C),D),E),F)),(G,H));"
+	genes := []string{"((A,B),(C,D));", "((G,F),(A,H));", "((A,B),(C,D));"}
+	for _, scorer := range []sc.InitableScorer{&sc.MaximizeScorer{}, &sc.NormalizedScorer{}} {
+		opts := BuildTestInferOpts(t, 0, 0, scorer, 0)
+		dropped, err := Infer(context.Background(), parse(constNwk)[0], parse(genes[0], genes[2]), opts)
+		if err != nil {
+			t.Fatalf("Infer failed with error %s", err)
+		}
+		opts.ScoreMode = freshScorer(scorer)
+		opts.Weights = []float64{1, 0, 1}
+		weighted, err := Infer(context.Background(), parse(constNwk)[0], parse(genes...), opts)
+		if err != nil {
+			t.Fatalf("Infer failed with error %s", err)
+		}
+		if !slices.Equal(weighted.QSatScore, dropped.QSatScore) {
+			t.Errorf("%T: zero weight gene tree gives qsat %v, dropping it gives %v", scorer, weighted.QSatScore, dropped.QSatScore)
+		}
+		if !reflect.DeepEqual(weighted.Branches, dropped.Branches) {
+			t.Errorf("%T: zero weight gene tree gives branches %v, dropping it gives %v", scorer, weighted.Branches, dropped.Branches)
+		}
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.Weights = []float64{1}
+	if _, err := Infer(context.Background(), parse(constNwk)[0], parse(genes...), opts); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("got error %v, expected %v", err, ErrInvalidOption)
+	}
+}
+
+func TestInfer_CFCounts(t *testing.T) {
+	dir := t.TempDir()
+	constFile, genesFile, weightsFile := dir+"/const.nwk", dir+"/genes.nwk", dir+"/weights.txt"
+	if err := os.WriteFile(constFile, []byte("((A,((((B,C),D),E),F)),(G,H));\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		copies   int
+		expected int
+	}{
+		{name: "not_significant", copies: 2, expected: 0},
+		{name: "significant", copies: 3, expected: 1},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			genes := strings.Repeat("((A,B),(C,D));\n", test.copies)
+			weights := strings.Repeat("1\n", test.copies)
+			if err := os.WriteFile(genesFile, []byte(genes), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(weightsFile, []byte(weights), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			run := func(inputOpts ...pr.InputOption) *DPResults {
+				tre, geneTrees, err := pr.ReadInputFiles(constFile, genesFile, pr.Newick, inputOpts...)
+				if err != nil {
+					t.Fatalf("cannot read input files: %s", err)
+				}
+				opts := BuildTestInferOpts(t, 0, 0, &sc.CFScorer{}, 0)
+				opts.Weights = geneTrees.Weights
+				results, err := Infer(context.Background(), tre, geneTrees.Trees, opts)
+				if err != nil {
+					t.Fatalf("Infer failed with error %s", err)
+				}
+				return results
+			}
+			unweighted, weighted := run(), run(pr.WithWeights(weightsFile))
+			if len(unweighted.Branches) != test.expected {
+				t.Errorf("got %d edges, expected %d", len(unweighted.Branches), test.expected)
+			}
+			if !reflect.DeepEqual(weighted.Branches, unweighted.Branches) {
+				t.Errorf("weights of 1 give branches %v, no weights give %v", weighted.Branches, unweighted.Branches)
+			}
+		})
+	}
+	tre, geneTrees, err := pr.ReadInputFiles(constFile, genesFile, pr.Newick)
+	if err != nil {
+		t.Fatalf("cannot read input files: %s", err)
+	}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.CFScorer{}, 0)
+	opts.AsSet = true
+	if _, err := Infer(context.Background(), tre, geneTrees.Trees, opts); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("cf with set counting gave error %v, expected %v", err, ErrInvalidOption)
+	}
+}
+
+func TestInfer_ResolvedPolytomies(t *testing.T) {
+	tre, geneTrees, err := pr.ReadInputFiles("testdata/constraint.nwk", "testdata/gene-trees.nwk", pr.Newick)
+	if err != nil {
+		t.Fatalf("cannot read test data: %s", err)
+	}
+	tre.CollapseShortBranches(0.3, false, false)
+	if pr.TreeIsBinary(tre) {
+		t.Fatal("constraint tree should have polytomies; test is written wrong")
+	}
+	resolved, clades, err := pr.ResolvePolytomies(tre, geneTrees.Trees, pr.QuartetResolve)
+	if err != nil {
+		t.Fatalf("ResolvePolytomies failed with error %s", err)
+	}
+	opts := BuildTestInferOpts(t, 2, 0.5, &sc.MaximizeScorer{}, 0)
+	opts.ArtificialClades = clades
+	results, err := Infer(context.Background(), resolved, geneTrees.Trees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	artificial, err := artificialNodes(results.Tree, clades)
+	if err != nil {
+		t.Fatalf("artificial clades are not in the resolved tree: %s", err)
+	}
+	for k, branches := range results.Branches {
+		for _, br := range branches {
+			if artificial[br.IDs[gr.Ui]] && artificial[br.IDs[gr.Wi]] {
+				t.Errorf("network with %d edges has branch %v between two added edges", k+1, br)
+			}
+		}
+	}
+	// marking the ends of a chosen branch as artificial should forbid it
+	br := results.Branches[0][0]
+	for _, id := range br.IDs {
+		clade := make([]string, 0)
+		util.SubtreePreOrder(results.Tree.IdToNodes[id], func(n *tree.Node) {
+			if n.Tip() {
+				clade = append(clade, n.Name())
+			}
+		})
+		opts.ArtificialClades = append(opts.ArtificialClades, clade)
+	}
+	forbidden, err := Infer(context.Background(), resolved, geneTrees.Trees, opts)
+	if err != nil {
+		t.Fatalf("Infer failed with error %s", err)
+	}
+	for k, branches := range forbidden.Branches {
+		if slices.Contains(branches, br) {
+			t.Errorf("network with %d edges has branch %v, which is between two added edges", k+1, br)
+		}
+	}
+}
+
+func TestInfer_MaxKPerVertex(t *testing.T) {
+	testCases := []struct {
+		name        string
+		constTree   string
+		geneTrees   []string
+		maxK        int
+		expNumEdges int
+		expCapped   bool
+	}{
+		{
+			name:        "edges in one subtree",
+			constTree:   "(A,(B,(C,(D,(E,(F,(G,(H,(I,J)))))))));",
+			geneTrees:   []string{"((J,G),(H,I));", "((C,G),(E,F));"},
+			maxK:        1,
+			expNumEdges: 2, // one below the root and one with its cycle at the root
+			expCapped:   true,
+		},
+		{
+			name:        "edges split at root",
+			constTree:   "((A,((((B,C),D),E),F)),(G,H));",
+			geneTrees:   []string{"((A,B),(C,D));", "((G,F),(A,H));"},
+			maxK:        1,
+			expNumEdges: 2,
+			expCapped:   true,
+		},
+		{
+			name:        "no limit",
+			constTree:   "(A,(B,(C,(D,(E,(F,(G,(H,(I,J)))))))));",
+			geneTrees:   []string{"((J,G),(H,I));", "((C,G),(E,F));"},
+			expNumEdges: 2,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			constTree, err := newick.NewParser(strings.NewReader(test.constTree)).Parse()
+			if err != nil {
+				t.Fatalf("cannot parse %s as newick tree", test.constTree)
+			}
+			geneTrees := make([]*tree.Tree, len(test.geneTrees))
+			for i, g := range test.geneTrees {
+				if geneTrees[i], err = newick.NewParser(strings.NewReader(g)).Parse(); err != nil {
+					t.Fatalf("cannot parse %s as newick tree", g)
+				}
+			}
+			opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+			opts.MaxKPerVertex = test.maxK
+			td, _, err := pr.Preprocess(context.Background(), constTree, geneTrees, nil, nil, opts.PrepProcs, opts.QuartetOpts, opts.MinSupport, opts.countMode())
+			if err != nil {
+				t.Fatalf("Preprocess failed with error %s", err)
+			}
+			dp, err := newDP(&sc.MaximizeScorer{}, td, opts)
+			if err != nil {
+				t.Fatalf("newDP failed with error %s", err)
+			}
+			results, err := dp.RunDP(context.Background())
+			if err != nil {
+				t.Fatalf("RunDP failed with error %s", err)
+			}
+			if len(results.Branches) != test.expNumEdges {
+				t.Errorf("inferred number of edges %d not equal to expected %d", len(results.Branches), test.expNumEdges)
+			}
+			if (dp.Capped > 0) != test.expCapped {
+				t.Errorf("%d vertices reached the maximum, expected any to: %t", dp.Capped, test.expCapped)
+			}
+			for id, scores := range dp.DP {
+				if test.maxK > 0 && id != td.Root().Id() && len(scores) > test.maxK+1 {
+					t.Errorf("vertex %d has %d edges, more than the maximum of %d", id, len(scores)-1, test.maxK)
+				}
+			}
+		})
+	}
+}
+
+// Constraint tree and gene trees small enough to run inference several times
+// per test, from which three nested and overlapping edges are inferred
+func parseSmallTestInput(t *testing.T) (*tree.Tree, []*tree.Tree) {
+	t.Helper()
+	parse := func(nwk string) *tree.Tree {
+		tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", nwk)
+		}
+		return tre
+	}
+	var geneTrees []*tree.Tree
+	for _, g := range []string{"((C,D),(B,A));", "((F,G),(E,A));", "((H,A),(E,C));", "((H,R),(E,C));", "((I,R),(J,A));"} {
+		geneTrees = append(geneTrees, parse(g))
+	}
+	return parse("(R,((A,(I,J)),((((B,C),D),H),((E,F),G))));"), geneTrees
+}
+
+func TestInfer_AdaptiveK(t *testing.T) {
+	tre, geneTrees := parseSmallTestInput(t)
+	testCases := []struct {
+		name  string
+		fewer bool // bounds are only reached for some scorers
+	}{
+		{name: "max", fewer: true},
+		{name: "norm", fewer: false},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			run := func(adaptive bool) (*DPResults, uint64) {
+				scorer, _ := sc.NewScorer(test.name)
+				opts := BuildTestInferOpts(t, 0, 0, scorer, 0)
+				opts.AdaptiveK = adaptive
+				results, err := Infer(context.Background(), tre.Clone(), geneTrees, opts)
+				if err != nil {
+					t.Fatalf("Infer failed with error %s", err)
+				}
+				var evaluated uint64
+				for _, st := range results.KStats {
+					evaluated += st.EdgesEvaluated
+				}
+				return results, evaluated
+			}
+			full, fullEvaluated := run(false)
+			adaptive, adaptiveEvaluated := run(true)
+			if !slices.Equal(full.RawScores, adaptive.RawScores) {
+				t.Errorf("scores changed: %v != %v", adaptive.RawScores, full.RawScores)
+			}
+			for k := range full.Branches {
+				if !slices.Equal(full.Branches[k], adaptive.Branches[k]) {
+					t.Errorf("k=%d: branches changed: %v != %v", k+1, adaptive.Branches[k], full.Branches[k])
+				}
+			}
+			if adaptiveEvaluated > fullEvaluated || test.fewer && adaptiveEvaluated == fullEvaluated {
+				t.Errorf("evaluated %d edges with adaptive k, and %d without", adaptiveEvaluated, fullEvaluated)
+			}
+		})
+	}
+}
+
+func TestInfer_TieBreak(t *testing.T) {
+	parse := func(nwk string) *tree.Tree {
+		tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("cannot parse %s as newick tree", nwk)
+		}
+		return tre
+	}
+	// symmetric data, so several edges score the same; taxa are not in
+	// alphabetical order, so that branches are logged by name rather than by
+	// traversal order
+	constNwk := "((D,C),(B,A));"
+	geneTrees := []*tree.Tree{parse("((A,C),(B,D));"), parse("((A,D),(B,C));")}
+	opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+	opts.ReportTies = true
+	td, _, err := pr.Preprocess(context.Background(), parse(constNwk), geneTrees, nil, nil, opts.PrepProcs, opts.QuartetOpts, opts.MinSupport, opts.countMode())
+	if err != nil {
+		t.Fatalf("Preprocess failed with error %s", err)
+	}
+	run := func(tieBreak TieBreak, seed uint64) (*DP[uint64], *DPResults) {
+		opts.TieBreak, opts.Seed = tieBreak, seed
+		dp, err := newDP(&sc.MaximizeScorer{}, td, opts)
+		if err != nil {
+			t.Fatalf("newDP failed with error %s", err)
+		}
+		results, err := dp.RunDP(context.Background())
+		if err != nil {
+			t.Fatalf("RunDP failed with error %s", err)
+		}
+		if len(results.Branches) == 0 {
+			t.Fatal("no branches added")
+		}
+		return dp, results
+	}
+	dp, shortest := run(TieShortest, 0)
+	ties := dp.coOptimal(1)
+	if len(ties) != 1 {
+		t.Fatalf("got ties %v, expected ties for the one branch", ties)
+	}
+	chosen := shortest.Branches[0][0]
+	taxa := func(id int) string {
+		names := make([]string, 0)
+		for _, tip := range td.Tips() {
+			if tip.Id() == id || td.Under(id, tip.Id()) {
+				names = append(names, tip.Name())
+			}
+		}
+		slices.Sort(names)
+		return "{" + strings.Join(names, ",") + "}"
+	}
+	if got, want := dp.branchString(chosen), taxa(chosen.IDs[gr.Ui])+" -> "+taxa(chosen.IDs[gr.Wi]); got != want {
+		t.Errorf("chosen branch logged as %s, expected %s", got, want)
+	}
+	for _, br := range ties[chosen] {
+		if br == chosen {
+			t.Errorf("chosen branch %v listed as its own tie", chosen)
+		}
+		if l, cl := sc.CycleLength(br.IDs[gr.Ui], br.IDs[gr.Wi], td), sc.CycleLength(chosen.IDs[gr.Ui], chosen.IDs[gr.Wi], td); l < cl {
+			t.Errorf("tied branch %v has a shorter cycle than chosen branch %v", br, chosen)
+		}
+	}
+	if _, again := run(TieShortest, 0); !reflect.DeepEqual(again.Branches, shortest.Branches) {
+		t.Errorf("reran with the same tie-break and got %v, expected %v", again.Branches, shortest.Branches)
+	}
+	chosenBySeed := make(map[gr.Branch]bool)
+	for seed := range uint64(20) {
+		_, seeded := run(TieSeeded, seed+1)
+		if !slices.Equal(seeded.Scores, shortest.Scores) {
+			t.Errorf("seed %d scored %v, expected %v", seed+1, seeded.Scores, shortest.Scores)
+		}
+		if _, again := run(TieSeeded, seed+1); !reflect.DeepEqual(again.Branches, seeded.Branches) {
+			t.Errorf("seed %d gave %v and %v", seed+1, seeded.Branches, again.Branches)
+		}
+		chosenBySeed[seeded.Branches[0][0]] = true
+	}
+	if len(chosenBySeed) < 2 {
+		t.Errorf("every seed chose the same branch %v", chosenBySeed)
+	}
+	opts.ReportTies = false
+	if dp, _ := run(TieShortest, 0); len(dp.coOptimal(1)) != 0 {
+		t.Error("kept ties without ReportTies")
+	}
+}
+
+func TestInfer_CoOptimal(t *testing.T) {
+	testCases := []struct {
+		name      string
+		constTree string
+		geneTrees []string
+	}{
+		{
+			name:      "symmetric",
+			constTree: "((A,B),(C,D));",
+			geneTrees: []string{"((A,C),(B,D));", "((A,D),(B,C));"},
+		},
+		{
+			name:      "two subtrees",
+			constTree: "(((A,B),(C,D)),((E,F),(G,H)));",
+			geneTrees: []string{"((A,C),(B,D));", "((E,G),(F,H));", "((A,D),(B,C));", "((E,H),(F,G));"},
+		},
+		{
+			name:      "caterpillar",
+			constTree: "(((((A,B),C),D),E),F);",
+			geneTrees: []string{"((A,C),(B,D));", "((B,D),(C,E));", "((A,E),(D,F));", "((A,C),(B,D));"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			constTree, err := newick.NewParser(strings.NewReader(test.constTree)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			geneTrees := make([]*tree.Tree, len(test.geneTrees))
+			for i, g := range test.geneTrees {
+				if geneTrees[i], err = newick.NewParser(strings.NewReader(g)).Parse(); err != nil {
+					t.Fatal("invalid newick tree; test is written wrong")
+				}
+			}
+			opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+			opts.CoOptimal = 1000
+			results, err := Infer(context.Background(), constTree, geneTrees, opts)
+			if err != nil {
+				t.Fatalf("Infer failed with error %s", err)
+			}
+			k := len(results.Branches)
+			if k == 0 {
+				t.Fatal("no branches added")
+			}
+			if len(results.CoOptimal) == 0 || branchSetKey(results.CoOptimal[0]) != branchSetKey(results.Branches[k-1]) {
+				t.Errorf("first co-optimal network %v is not the optimal network %v", results.CoOptimal, results.Branches[k-1])
+			}
+			// every set of k compatible branches with the optimal score
+			td := results.Tree
+			edgeScore := func(br gr.Branch) float64 {
+				return float64(opts.ScoreMode.(*sc.MaximizeScorer).CalcScore(br.IDs[gr.Ui], br.IDs[gr.Wi], td))
+			}
+			var candidates []gr.Branch
+			for u := range len(td.Nodes()) {
+				for w := range len(td.Nodes()) {
+					if sc.DefaultEdgePolicy.Allows(u, w, td) && edgeScore(gr.Branch{IDs: [2]int{u, w}}) > 0 {
+						candidates = append(candidates, gr.Branch{IDs: [2]int{u, w}})
+					}
+				}
+			}
+			expected := make(map[string]bool)
+			var search func(start int, chosen []gr.Branch, score float64)
+			search = func(start int, chosen []gr.Branch, score float64) {
+				if len(chosen) == k {
+					if score == results.Scores[k-1] {
+						expected[branchSetKey(chosen)] = true
+					}
+					return
+				}
+				for i := start; i < len(candidates); i++ {
+					if !slices.ContainsFunc(chosen, func(br gr.Branch) bool { return !gr.Compatible(br, candidates[i], td) }) {
+						search(i+1, append(slices.Clone(chosen), candidates[i]), score+edgeScore(candidates[i]))
+					}
+				}
+			}
+			search(0, nil, 0)
+			got := make(map[string]bool)
+			for _, set := range results.CoOptimal {
+				if got[branchSetKey(set)] {
+					t.Errorf("network %v enumerated twice", set)
+				}
+				got[branchSetKey(set)] = true
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("got %d co-optimal networks %v, expected %d %v", len(got), slices.Sorted(maps.Keys(got)), len(expected), slices.Sorted(maps.Keys(expected)))
+			}
+			opts.CoOptimal = 1
+			if results, err = Infer(context.Background(), constTree, geneTrees, opts); err != nil {
+				t.Fatalf("Infer failed with error %s", err)
+			}
+			if len(results.CoOptimal) != 1 {
+				t.Errorf("got %d co-optimal networks with a limit of 1", len(results.CoOptimal))
+			}
+		})
+	}
+}
+
+func TestInfer_Within(t *testing.T) {
+	testCases := []struct {
+		name      string
+		constTree string
+		geneTrees []string
+		within    float64
+	}{
+		{
+			name:      "symmetric",
+			constTree: "((A,B),(C,D));",
+			geneTrees: []string{"((A,C),(B,D));", "((A,D),(B,C));"},
+			within:    50,
+		},
+		{
+			name:      "two subtrees",
+			constTree: "(((A,B),(C,D)),((E,F),(G,H)));",
+			geneTrees: []string{"((A,C),(B,D));", "((E,G),(F,H));", "((A,D),(B,C));", "((E,H),(F,G));", "((A,C),(B,D));"},
+			within:    40,
+		},
+		{
+			name:      "caterpillar",
+			constTree: "(((((A,B),C),D),E),F);",
+			geneTrees: []string{"((A,C),(B,D));", "((B,D),(C,E));", "((A,E),(D,F));", "((A,C),(B,D));"},
+			within:    30,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			constTree, err := newick.NewParser(strings.NewReader(test.constTree)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			geneTrees := make([]*tree.Tree, len(test.geneTrees))
+			for i, g := range test.geneTrees {
+				if geneTrees[i], err = newick.NewParser(strings.NewReader(g)).Parse(); err != nil {
+					t.Fatal("invalid newick tree; test is written wrong")
+				}
+			}
+			opts := BuildTestInferOpts(t, 0, 0, &sc.MaximizeScorer{}, 0)
+			opts.CoOptimal = 1000
+			opts.Within, opts.WithinMax = test.within, 1000
+			results, err := Infer(context.Background(), constTree, geneTrees, opts)
+			if err != nil {
+				t.Fatalf("Infer failed with error %s", err)
+			}
+			if len(results.Branches) == 0 {
+				t.Fatal("no branches added")
+			}
+			if len(results.NearOptimal) != len(results.Branches) {
+				t.Fatalf("got near optimal networks for %d values of k, expected %d", len(results.NearOptimal), len(results.Branches))
+			}
+			td := results.Tree
+			edgeScore := func(br gr.Branch) float64 {
+				return float64(opts.ScoreMode.(*sc.MaximizeScorer).CalcScore(br.IDs[gr.Ui], br.IDs[gr.Wi], td))
+			}
+			var candidates []gr.Branch
+			for u := range len(td.Nodes()) {
+				for w := range len(td.Nodes()) {
+					if sc.DefaultEdgePolicy.Allows(u, w, td) {
+						candidates = append(candidates, gr.Branch{IDs: [2]int{u, w}})
+					}
+				}
+			}
+			for k, networks := range results.NearOptimal {
+				opt := results.Scores[k]
+				if len(networks) == 0 || branchSetKey(networks[0].Branches) != branchSetKey(results.Branches[k]) {
+					t.Fatalf("k = %d: first near optimal network is not the optimal network %v", k+1, results.Branches[k])
+				}
+				got := make(map[string]bool)
+				for i, n := range networks {
+					score := 0.0
+					for _, br := range n.Branches {
+						score += edgeScore(br)
+					}
+					if score != n.Score || n.Gap != opt-n.Score {
+						t.Errorf("k = %d: network %v has score %f and gap %f, expected %f and %f", k+1, n.Branches, n.Score, n.Gap, score, opt-score)
+					}
+					if i > 0 && n.Score > networks[i-1].Score {
+						t.Errorf("k = %d: networks are not sorted by score", k+1)
+					}
+					if got[branchSetKey(n.Branches)] {
+						t.Errorf("k = %d: network %v enumerated twice", k+1, n.Branches)
+					}
+					got[branchSetKey(n.Branches)] = true
+				}
+				// every set of k+1 compatible branches within the tolerance
+				expected := make(map[string]bool)
+				var search func(start int, chosen []gr.Branch, score float64)
+				search = func(start int, chosen []gr.Branch, score float64) {
+					if len(chosen) == k+1 {
+						if score >= opt*(1-test.within/100) {
+							expected[branchSetKey(chosen)] = true
+						}
+						return
+					}
+					for i := start; i < len(candidates); i++ {
+						if !slices.ContainsFunc(chosen, func(br gr.Branch) bool { return !gr.Compatible(br, candidates[i], td) }) {
+							search(i+1, append(slices.Clone(chosen), candidates[i]), score+edgeScore(candidates[i]))
+						}
+					}
+				}
+				search(0, nil, 0)
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("k = %d: got %d near optimal networks %v, expected %d %v", k+1, len(got), slices.Sorted(maps.Keys(got)), len(expected), slices.Sorted(maps.Keys(expected)))
+				}
+			}
+			// with no tolerance, the networks with the most edges are the co-optimal ones
+			k := len(results.Branches)
+			coOptimal := make(map[string]bool)
+			for _, set := range results.CoOptimal {
+				coOptimal[branchSetKey(set)] = true
+			}
+			tied := make(map[string]bool)
+			for _, n := range results.NearOptimal[k-1] {
+				if n.Gap == 0 {
+					tied[branchSetKey(n.Branches)] = true
+				}
+			}
+			if !reflect.DeepEqual(tied, coOptimal) {
+				t.Errorf("got %d networks with no gap %v, expected the %d co-optimal networks %v", len(tied), slices.Sorted(maps.Keys(tied)), len(coOptimal), slices.Sorted(maps.Keys(coOptimal)))
+			}
+			opts.WithinMax = 1
+			if results, err = Infer(context.Background(), constTree, geneTrees, opts); err != nil {
+				t.Fatalf("Infer failed with error %s", err)
+			}
+			for k, networks := range results.NearOptimal {
+				if len(networks) != 1 || networks[0].Gap != 0 {
+					t.Errorf("k = %d: got %v with a limit of 1, expected one optimal network", k+1, networks)
+				}
+			}
+		})
+	}
+}
+
+func TestInfer_CompactTraceback(t *testing.T) {
+	tre, geneTrees := parseSmallTestInput(t)
+	for _, name := range []string{"max", "norm"} {
+		t.Run(name, func(t *testing.T) {
+			run := func(compact bool) *DPResults {
+				scorer, _ := sc.NewScorer(name)
+				opts := BuildTestInferOpts(t, 0, 0, scorer, 0)
+				opts.CompactTraceback = compact
+				results, err := Infer(context.Background(), tre.Clone(), geneTrees, opts)
+				if err != nil {
+					t.Fatalf("Infer failed with error %s", err)
+				}
+				return results
+			}
+			full, compact := run(false), run(true)
+			if !slices.Equal(full.RawScores, compact.RawScores) {
+				t.Errorf("scores changed: %v != %v", compact.RawScores, full.RawScores)
+			}
+			if len(full.Branches) == 0 {
+				t.Fatal("expected some edges to be added")
+			}
+			for k := range full.Branches {
+				if !slices.Equal(full.Branches[k], compact.Branches[k]) {
+					t.Errorf("k=%d: branches changed: %v != %v", k+1, compact.Branches[k], full.Branches[k])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package infer
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Reruns preprocessing and the dp once for each gene tree with that gene tree
+// left out, and compares the results to the results from all gene trees
+// (full). Returned influences are ranked from most to least influential: genes
+// whose removal changes the most edges of the largest network come first,
+// followed by the largest drop in root score.
+func Influence(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, names []string, opts InferOptions, full *DPResults) ([]pr.GeneInfluence, error) {
+	if len(geneTrees) < 2 {
+		return nil, fmt.Errorf("%w, leave-one-out influence needs at least two gene trees", ErrInvalidOption)
+	}
+	defer tm.Phase("influence")()
+	lg.Infof("running leave-one-out influence analysis on %d gene trees", len(geneTrees))
+	opts.NumAlts, opts.Overlaps, opts.Within, opts.Provenance = 0, false, 0, false
+	weights := opts.Weights
+	influences := make([]pr.GeneInfluence, len(geneTrees))
+	for i := range geneTrees {
+		if weights != nil {
+			opts.Weights = slices.Delete(slices.Clone(weights), i, i+1)
+		}
+		opts.GeneNames = slices.Delete(slices.Clone(names), i, i+1)
+		results, err := inferQuietly(ctx, tre, slices.Delete(slices.Clone(geneTrees), i, i+1), opts)
+		if err != nil {
+			return nil, fmt.Errorf("leaving out gene %s: %w", names[i], err)
+		}
+		influences[i] = compareResults(full, results)
+		influences[i].Gene = names[i]
+		if (i+1)%100 == 0 {
+			lg.Debugf("influence analysis finished %d of %d gene trees", i+1, len(geneTrees))
+		}
+	}
+	slices.SortStableFunc(influences, func(a, b pr.GeneInfluence) int {
+		return cmp.Or(cmp.Compare(b.EdgesChanged, a.EdgesChanged), cmp.Compare(b.ScoreChange, a.ScoreChange))
+	})
+	return influences, nil
+}
+
+// Runs preprocessing and the dp without logging or telemetry phases
+func inferQuietly(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, opts InferOptions) (*DPResults, error) {
+	lout := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(lout)
+	opts.CacheDir = "" // every rerun has different gene trees, so caching would only fill the directory
+	td, _, err := pr.Preprocess(ctx, tre, geneTrees, opts.Weights, opts.GeneNames, opts.PrepProcs, opts.QuartetOpts, opts.MinSupport, opts.countMode())
+	if err != nil {
+		return nil, fmt.Errorf("preprocess error: %w", err)
+	}
+	dp, err := newDPRunner(freshScorer(opts.ScoreMode), td, opts.countMode().NumGeneTrees(len(geneTrees), opts.Weights), opts)
+	if err != nil {
+		return nil, err
+	}
+	return dp.RunDP(ctx)
+}
+
+// Compares the largest network from the full results to the network with the
+// same number of edges (or the largest network, if there are fewer edges) in
+// the leave-one-out results
+func compareResults(full, loo *DPResults) pr.GeneInfluence {
+	k := len(full.Branches)
+	looK := min(k, len(loo.Branches))
+	influence := pr.GeneInfluence{NumBranches: looK}
+	if k == 0 {
+		return influence
+	}
+	var looScore, looQSat float64
+	var looBranches []gr.Branch
+	if looK > 0 {
+		looScore, looQSat, looBranches = loo.Scores[looK-1], loo.QSatScore[looK-1], loo.Branches[looK-1]
+	}
+	influence.ScoreChange = full.Scores[k-1] - looScore
+	influence.QSatChange = full.QSatScore[k-1] - looQSat
+	for _, br := range full.Branches[k-1] {
+		if !slices.Contains(looBranches, br) {
+			influence.EdgesChanged++
+		}
+	}
+	return influence
+}
+
+// New scorer of the same type, so that leave-one-out runs don't overwrite the
+// tables of the scorer used for the full run
+func freshScorer(scorer sc.InitableScorer) sc.InitableScorer {
+	switch scorer.(type) {
+	case *sc.MaximizeScorer:
+		return &sc.MaximizeScorer{}
+	case *sc.NormalizedScorer:
+		return &sc.NormalizedScorer{}
+	case *sc.SymDiffScorer:
+		return &sc.SymDiffScorer{}
+	case *sc.CFScorer:
+		return &sc.CFScorer{}
+	default:
+		panic(fmt.Sprintf("unsupported scorer type %T", scorer))
+	}
+}
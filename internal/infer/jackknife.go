@@ -0,0 +1,82 @@
+package infer
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Leaves out each block of blockSize consecutive gene trees (named by names,
+// in the order they were read) in turn and finds how much of the quartet
+// support of each reticulation of the network with the labeled branches on td
+// is left. Instead of rerunning preprocessing and the dp, the quartets each
+// block contributed are subtracted using the gene trees kept in td (see
+// InferOptions.Provenance), so the quartet filter is not rerun without the
+// block.
+func Jackknife(td *gr.TreeData, labeled map[string]gr.Branch, names []string, blockSize int, opts InferOptions) ([]pr.JackknifeSummary, error) {
+	if !td.HasProvenance() {
+		return nil, fmt.Errorf("%w, jackknife needs the gene trees each quartet was counted from", ErrInvalidOption)
+	}
+	if blockSize < 1 {
+		return nil, fmt.Errorf("%w, jackknife block size must be at least one, but is %d", ErrInvalidOption, blockSize)
+	}
+	defer tm.Phase("jackknife")()
+	nBlocks := (len(names) + blockSize - 1) / blockSize
+	labels := pr.SortedRetLabels(labeled)
+	branches := make([]gr.Branch, len(labels))
+	for i, label := range labels {
+		branches[i] = labeled[label]
+	}
+	lg.Infof("jackknifing the support of %d reticulations over %d blocks of up to %d gene trees", len(branches), nBlocks, blockSize)
+	asSet := countsAsSet(opts)
+	support := sc.BlockSupport(td, branches, func(gene uint32) int { return int(gene) / blockSize }, nBlocks, asSet)
+	summaries := make([]pr.JackknifeSummary, len(branches))
+	for i, br := range branches {
+		total, err := sc.TotalSatQuartets([]gr.Branch{br}, td, asSet)
+		if err != nil {
+			return nil, err
+		}
+		js := summarizeJackknife(labels[i], float64(total), support, i)
+		if js.Block != 0 {
+			lo := (js.Block - 1) * blockSize
+			js.Genes = names[lo:min(lo+blockSize, len(names))]
+		}
+		if js.BlocksForHalf == 1 && nBlocks > 1 {
+			lg.Warnf("block %d (%d gene trees) holds %.1f%% of the quartet support of reticulation %s",
+				js.Block, len(js.Genes), 100*(js.Support-js.MinSupport)/js.Support, js.Reticulation)
+		}
+		summaries[i] = js
+	}
+	return summaries, nil
+}
+
+// Summarizes the support of reticulation ret left without each block, where
+// support[b][ret] is what block b contributes to its total
+func summarizeJackknife(label string, total float64, support [][]float64, ret int) pr.JackknifeSummary {
+	js := pr.JackknifeSummary{Reticulation: label, Support: total, MinSupport: total}
+	if total == 0 {
+		return js
+	}
+	drops := make([]float64, len(support))
+	for b := range support {
+		drops[b] = support[b][ret]
+		if left := max(total-drops[b], 0); left < js.MinSupport {
+			js.MinSupport, js.Block = left, b+1
+		}
+	}
+	slices.SortFunc(drops, func(a, b float64) int { return cmp.Compare(b, a) })
+	var dropped float64
+	for n, d := range drops {
+		if dropped += d; dropped >= total/2 {
+			js.BlocksForHalf = n + 1
+			break
+		}
+	}
+	return js
+}
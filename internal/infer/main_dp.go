@@ -6,25 +6,68 @@
 package infer
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/evolbioinfo/gotree/tree"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	"github.com/jsdoublel/camus/internal/pool"
+	pr "github.com/jsdoublel/camus/internal/prep"
 	sc "github.com/jsdoublel/camus/internal/score"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+	"github.com/jsdoublel/camus/util"
 )
 
-var ErrNoValidSplit = errors.New("no valid split")
+var ErrNoValidSplit = util.ErrNoValidSplit
 
 // Stores main dp algorithm data
 type DP[S sc.Score] struct {
-	DP        [][]S        // score for each dp subproblem (DP[v][k])
-	Traceback [][]trace    // traceback for each dp subproblem (Traceback[v][k])
-	Tree      *gr.TreeData // preprocessed data for our constraint tree
-	NumNodes  int          // number of nodes
-	Scorer    sc.Scorer[S] // scorer
+	DP         [][]S          // score for each dp subproblem (DP[v][k])
+	Traceback  [][]trace      // traceback for each dp subproblem (Traceback[v][k])
+	Tree       *gr.TreeData   // preprocessed data for our constraint tree
+	NumNodes   int            // number of nodes
+	Scorer     sc.Scorer[S]   // scorer
+	NProcs     int            // number of parallel processes
+	NumAlts    int            // number of alternative branches to report for each k
+	Overlaps   bool           // report candidate branches left out of the largest network because their cycles overlap
+	MaxK       int            // maximum number of edges to add (no limit if 0)
+	MaxKVertex int            // maximum number of edges below any vertex but the root (no limit if 0)
+	AdaptiveK  bool           // stop each vertex once its score reaches an upper bound from the subtrees below it
+	Compact    bool           // keep compact traces of cycles, recomputing them on traceback (see compactCycleTrace)
+	Policy     *sc.EdgePolicy // edges that may be added (sc.DefaultEdgePolicy if nil)
+	TieBreak   TieBreak       // how edges with the same score are chosen between
+	Seed       uint64         // seed for the order of tied edges with TieSeeded
+	ReportTies bool           // keep and log the edges tied with each chosen edge
+	Enumerate  int            // maximum number of co-optimal networks with the most edges to enumerate (off if 0)
+	Within     float64        // percent of the optimal score within which to enumerate networks (off if 0)
+	WithinMax  int            // maximum number of networks kept for any subproblem while enumerating with Within
+	Skipped    int            // internal vertices with no informative quartets (set by fill)
+	Capped     int            // vertices whose subproblem stopped at MaxKVertex edges (set by fill)
+	Bounded    int            // vertices whose subproblem stopped at its upper bound with AdaptiveK (set by fill)
+	KStats     []pr.KStats    // work done for each k, starting at k = 1 (set by fill)
+
+	bounds  []S          // upper bound on the score of each subproblem, for any k (set by fill if AdaptiveK)
+	mu      sync.Mutex   // guards Skipped, Capped, Bounded, and KStats while vertices are solved in parallel
+	running atomic.Int32 // vertices being solved, which share the NProcs processes
+}
+
+// Counts of work done while scoring candidate edges
+type edgeCounts struct {
+	evaluated uint64 // edges scored
+	valid     uint64 // edges with a valid split
+	hits      uint64 // cycle path scores reused from a smaller k
+}
+
+func (c *edgeCounts) add(other edgeCounts) {
+	c.evaluated += other.evaluated
+	c.valid += other.valid
+	c.hits += other.hits
 }
 
 // Stores DP info for lookups corresponding to a given vertex v
@@ -38,7 +81,7 @@ type cycleDP[S sc.Score] struct {
 
 // Updates the cycle lookup DP struct for values of k up to prevK
 func (cdp *cycleDP[S]) update(prevK int, dp *DP[S]) {
-	SubtreePreOrder(cdp.v, func(cur *tree.Node) {
+	util.SubtreePreOrder(cdp.v, func(cur *tree.Node) {
 		if prevK == 0 {
 			cdp.scores[cur.Id()] = make([]S, 0)
 			cdp.traceNodes[cur.Id()] = make([]*cycleTraceNode, 0)
@@ -58,16 +101,18 @@ func (cdp *cycleDP[S]) update(prevK int, dp *DP[S]) {
 		}
 		sibId := dp.Tree.Sibling(cur).Id()
 		pScores, pTraces := cdp.scores[p.Id()], cdp.traceNodes[p.Id()]
-		pK, sibK, err := BestSplit(pScores, dp.DP[sibId], prevK)
+		pK, sibK, err := util.BestSplit(pScores, dp.DP[sibId], prevK)
 		if err != nil {
 			return
 		}
-		cdp.set(
-			cur.Id(),
-			prevK,
-			pScores[pK]+dp.DP[sibId][sibK],
-			cycleTraceNode{p: pTraces[pK], sib: &dp.Traceback[sibId][sibK]},
-		)
+		node := cycleTraceNode{p: pTraces[pK], sib: &dp.Traceback[sibId][sibK]}
+		if dp.Enumerate > 0 {
+			splits, _ := util.AllBestSplits(pScores, dp.DP[sibId], prevK)
+			for _, split := range splits[1:] {
+				node.others = append(node.others, &cycleTraceNode{p: pTraces[split[0]], sib: &dp.Traceback[sibId][split[1]]})
+			}
+		}
+		cdp.set(cur.Id(), prevK, pScores[pK]+dp.DP[sibId][sibK], node)
 	})
 }
 
@@ -87,71 +132,282 @@ func (cdp *cycleDP[S]) get(i, k int) (S, *cycleTraceNode) {
 
 // ----- Main DP Code
 
-func (dp *DP[S]) RunDP() *DPResults {
-	dp.Tree.PostOrder(func(v, prev *tree.Node, e *tree.Edge) (keep bool) {
-		if !v.Tip() {
-			scores, edgeTrace := dp.solve(v)
-			dp.DP[v.Id()] = scores
-			dp.Traceback[v.Id()] = edgeTrace
-		} else {
-			dp.DP[v.Id()] = make([]S, 1)
-			dp.Traceback[v.Id()] = make([]trace, 1, dp.NumNodes)
-			dp.Traceback[v.Id()][0] = &noCycleTrace{}
-		}
-		return true
+func (dp *DP[S]) RunDP(ctx context.Context) (*DPResults, error) {
+	if err := dp.fill(ctx); err != nil {
+		return nil, err
+	}
+	for _, st := range dp.KStats {
+		lg.Debugf("k = %d: %d vertices, %d edges evaluated, %d valid splits, %d cache hits, took %s",
+			st.K, st.Vertices, st.EdgesEvaluated, st.ValidSplits, st.CacheHits, st.Time.Round(time.Millisecond))
+	}
+	if dp.Skipped > 0 {
+		lg.Debugf("skipped %d of %d internal vertices with no informative quartets", dp.Skipped, len(dp.Tree.Nodes())-len(dp.Tree.Tips()))
+	}
+	if dp.Capped > 0 {
+		lg.Infof("subproblems of %d vertices stopped at the maximum of %d edges per vertex; larger networks may score better", dp.Capped, dp.MaxKVertex)
+	}
+	if dp.AdaptiveK {
+		lg.Infof("subproblems of %d vertices stopped early at their score upper bound", dp.Bounded)
+	}
+	return dp.collateResults(), nil
+}
+
+// Solves dp subproblems for all vertices, each once both of its children are
+// solved, so that sibling subtrees are solved in parallel. Stops and returns
+// ctx's error if ctx is cancelled (the tables are left incomplete).
+func (dp *DP[S]) fill(ctx context.Context) error {
+	dp.Skipped = 0
+	dp.Capped = 0
+	dp.Bounded = 0
+	dp.KStats = nil
+	dp.bounds = nil
+	if dp.AdaptiveK {
+		dp.bounds = make([]S, dp.NumNodes)
+	}
+	parent := make([]int, dp.NumNodes)
+	for id, v := range dp.Tree.IdToNodes {
+		parent[id] = -1
+		if p, err := v.Parent(); err == nil {
+			parent[id] = p.Id()
+		}
+	}
+	var solved atomic.Int64
+	pool.RunTree(parent, dp.NProcs, func(id int) {
+		if ctx.Err() != nil {
+			return
+		}
+		defer func() { tm.Progress(int(solved.Add(1)), dp.NumNodes) }()
+		v := dp.Tree.IdToNodes[id]
+		if v.Tip() {
+			dp.DP[id] = make([]S, 1)
+			dp.Traceback[id] = make([]trace, 1, dp.NumNodes)
+			dp.Traceback[id][0] = &noCycleTrace{}
+			return
+		}
+		if dp.bounds != nil {
+			l, r := dp.Tree.Children[id][0].Id(), dp.Tree.Children[id][1].Id()
+			dp.bounds[id] = dp.bounds[l] + dp.bounds[r] + max(0, dp.bestEdgeScore(v))
+		}
+		if len(dp.Tree.Quartets(id)) == 0 {
+			dp.mu.Lock()
+			dp.Skipped++
+			dp.mu.Unlock()
+		}
+		dp.running.Add(1)
+		dp.DP[id], dp.Traceback[id] = dp.solve(ctx, v)
+		dp.running.Add(-1)
+		lg.Tracef("solved vertex %d (%d taxa below): best score %v with up to %d edges",
+			id, dp.Tree.NumLeavesBelow[id], dp.DP[id][len(dp.DP[id])-1], len(dp.DP[id])-1)
+		if dp.Compact {
+			dp.compactTraces(id, dp.Traceback[id])
+		}
+	})
+	return ctx.Err()
+}
+
+// Best score of an edge the dp could add at v (i.e., whose cycle has v at its
+// top). Each cycle of a level-1 network has a different top vertex, so a
+// subproblem can score at most the sum of max(0, bestEdgeScore) over the
+// vertices below it.
+func (dp *DP[S]) bestEdgeScore(v *tree.Node) S {
+	var best S
+	found := false
+	consider := func(u, w int) {
+		if !dp.Policy.Allows(u, w, dp.Tree) {
+			return
+		}
+		if score := dp.Scorer.CalcScore(u, w, dp.Tree); score > best || !found {
+			best, found = score, true
+		}
+	}
+	util.SubtreePreOrder(v, func(w *tree.Node) {
+		consider(v.Id(), w.Id())
 	})
-	return dp.collateResults()
+	util.SubtreePostOrder(v, func(u, otherSubtree *tree.Node) {
+		util.SubtreePreOrder(otherSubtree, func(w *tree.Node) {
+			consider(u.Id(), w.Id())
+		})
+	})
+	return best
+}
+
+// Processes for scoring the edges at one vertex, so that the vertices being
+// solved at the same time share dp.NProcs
+func (dp *DP[S]) edgeProcs() int {
+	return max(1, dp.NProcs/max(1, int(dp.running.Load())))
+}
+
+// Edge score of each branch
+func (dp *DP[S]) EdgeScores(branches []gr.Branch) []float64 {
+	scores := make([]float64, len(branches))
+	for i, br := range branches {
+		scores[i] = float64(dp.Scorer.CalcScore(br.IDs[gr.Ui], br.IDs[gr.Wi], dp.Tree))
+	}
+	return scores
+}
+
+// Reruns the dp once for each branch with that branch excluded, and returns
+// the best root score found with the same number of branches (or the best
+// score overall if there are no valid networks of that size)
+func (dp *DP[S]) ExclusionScores(ctx context.Context, branches []gr.Branch) ([]float64, error) {
+	scores := make([]float64, len(branches))
+	root := dp.Tree.Root().Id()
+	for i, br := range branches {
+		excl := &DP[S]{
+			DP:         make([][]S, dp.NumNodes),
+			Traceback:  make([][]trace, dp.NumNodes),
+			Scorer:     dp.Scorer,
+			NumNodes:   dp.NumNodes,
+			Tree:       dp.Tree,
+			NProcs:     dp.NProcs,
+			MaxK:       dp.MaxK,
+			MaxKVertex: dp.MaxKVertex,
+			AdaptiveK:  dp.AdaptiveK,
+			Compact:    dp.Compact,
+			Policy:     dp.Policy.With(sc.ExcludeBranches(br)),
+			TieBreak:   dp.TieBreak,
+			Seed:       dp.Seed,
+		}
+		if err := excl.fill(ctx); err != nil {
+			return nil, err
+		}
+		k := min(len(branches), len(excl.DP[root])-1)
+		scores[i] = float64(excl.DP[root][k])
+	}
+	return scores, nil
 }
 
 func (dp *DP[S]) collateResults() *DPResults {
 	numOptimal := len(dp.DP[dp.Tree.Root().Id()]) - 1
-	log.Printf("%d edges identified\n", numOptimal)
-	log.Println("beginning traceback")
+	lg.Infof("%d edges identified\n", numOptimal)
+	if numOptimal == dp.MaxK {
+		lg.Infof("stopped at the maximum of %d edges; larger networks may score better", dp.MaxK)
+	}
+	lg.Debugf("beginning traceback")
 	branches := make([][]gr.Branch, numOptimal)
+	var alts [][]pr.Alternative
+	if dp.NumAlts > 0 {
+		alts = make([][]pr.Alternative, numOptimal)
+	}
 	qStat := make([]float64, 0, numOptimal)
+	scores := make([]float64, 0, numOptimal)
+	rawScores := make([]string, 0, numOptimal+1)
+	edgeScores := make(map[gr.Branch]float64)
 	for k := range numOptimal + 1 {
+		rawScores = append(rawScores, sc.FormatScore(dp.DP[dp.Tree.Root().Id()][k]))
 		if k != 0 {
 			finalScore := dp.DP[dp.Tree.Root().Id()][k]
-			log.Printf("dp scored %v at root with %d edges\n", finalScore, k)
+			lg.Infof("dp scored %v at root with %d edges\n", finalScore, k)
+			scores = append(scores, float64(finalScore))
 			branches[k-1] = dp.traceback(k)
+			for _, br := range branches[k-1] {
+				edgeScores[br] = float64(dp.Scorer.CalcScore(br.IDs[gr.Ui], br.IDs[gr.Wi], dp.Tree))
+				lg.Tracef("k = %d: branch %s has edge score %v", k, dp.branchString(br), edgeScores[br])
+			}
 			if percent, err := dp.Scorer.PercentQuartetSat(branches[k-1], dp.Tree); err == nil {
-				log.Printf("%f percent of quartets satisfied", percent)
+				lg.Infof("%f percent of quartets satisfied", percent)
 				qStat = append(qStat, percent)
 			} else {
-				log.Printf("error calculating percent quartets satisfied %s, this is a bug! please report!", err.Error())
+				lg.Errorf("error calculating percent quartets satisfied %s, this is a bug! please report!", err.Error())
 				qStat = append(qStat, -1)
 			}
+			if alts != nil {
+				alts[k-1] = dp.alternatives(branches[k-1], dp.NumAlts)
+			}
+			if dp.ReportTies {
+				dp.logTies(k, branches[k-1])
+			}
+		}
+	}
+	var coOptimal [][]gr.Branch
+	if dp.Enumerate > 0 && numOptimal > 0 {
+		coOptimal = dp.coOptimalNetworks(numOptimal)
+	}
+	var nearOptimal [][]pr.NearOptimal
+	if dp.Within > 0 && numOptimal > 0 {
+		nearOptimal = dp.nearOptimal(dp.Within, dp.WithinMax, branches)
+	}
+	var overlaps []pr.Overlap
+	if dp.Overlaps && numOptimal > 0 {
+		overlaps = dp.overlaps(branches[numOptimal-1])
+		if len(overlaps) > 0 {
+			lg.Infof("%d candidate branches scoring at least as well as the weakest branch of the largest network were left out because their cycles overlap chosen cycles; the data may support a network with overlapping cycles (level-2 or higher)", len(overlaps))
 		}
 	}
-	return &DPResults{Tree: dp.Tree, Branches: branches, QSatScore: qStat}
+	return &DPResults{Tree: dp.Tree, Branches: branches, QSatScore: qStat, Scores: scores, RawScores: rawScores, EdgeScores: edgeScores, Alternatives: alts, Overlaps: overlaps, CoOptimal: coOptimal, NearOptimal: nearOptimal, KStats: dp.KStats}
 }
 
-// Solve DP problem for vertex v for all k until it stops improving
-func (dp *DP[S]) solve(v *tree.Node) ([]S, []trace) {
+// Solve DP problem for vertex v for all k until it stops improving (or k
+// reaches dp.MaxK, or dp.MaxKVertex if v is not the root). Adding no edge at v
+// is preferred to adding one that scores the same, and ties between edges are
+// broken by dp.TieBreak.
+func (dp *DP[S]) solve(ctx context.Context, v *tree.Node) ([]S, []trace) {
 	lID, rID := dp.Tree.Children[v.Id()][0].Id(), dp.Tree.Children[v.Id()][1].Id()
 	scores := make([]S, 1, dp.NumNodes) // choice of capacity is a bit arbitrary
 	traces := make([]trace, 1, dp.NumNodes)
 	scores[0] = dp.DP[lID][0] + dp.DP[rID][0]
 	traces[0] = &noCycleTrace{[2]*trace{&dp.Traceback[lID][0], &dp.Traceback[rID][0]}}
+	if v == dp.Tree.Root() {
+		tm.Score(0, float64(scores[0]))
+	}
+	if len(dp.Tree.Quartets(v.Id())) == 0 {
+		// every edge in this subtree forms a cycle with no quartets that have
+		// three taxa in it, so no edge can be supported (the same holds below v,
+		// so no edges are added there either)
+		return scores, traces
+	}
 	vCycleDP := cycleDP[S]{
 		v:          v,
 		scores:     make([][]S, dp.NumNodes),
 		traceNodes: make([][]*cycleTraceNode, dp.NumNodes),
 	}
-	for k := 1; ; k++ {
+	maxK, capped := dp.MaxK, false
+	if dp.MaxKVertex > 0 && v != dp.Tree.Root() && (maxK == 0 || dp.MaxKVertex < maxK) {
+		maxK, capped = dp.MaxKVertex, true
+	}
+	for k := 1; maxK == 0 || k <= maxK; k++ {
+		if ctx.Err() != nil {
+			break // fill returns the error
+		}
+		if dp.bounds != nil && scores[k-1] >= dp.bounds[v.Id()] { // no k can do better
+			dp.mu.Lock()
+			dp.Bounded++
+			dp.mu.Unlock()
+			break
+		}
+		start := time.Now()
 		var score S
 		var backtrace trace
-		if noEdgeScore, noEdgeTrace, err := dp.scoreNoAddEdgeK(lID, rID, k); err == nil {
+		var counts edgeCounts
+		var options []trace // co-optimal traces, when enumerating
+		noEdgeScore, noEdgeTrace, noEdgeErr := dp.scoreNoAddEdgeK(lID, rID, k)
+		if noEdgeErr == nil {
 			score, backtrace = noEdgeScore, noEdgeTrace
 		}
-		if edgeScore, edgeTrace, err := dp.scoreAddEdgeK(v, k, &vCycleDP); err == nil && edgeScore > score {
+		edgeScore, edgeTrace, edgeErr := dp.scoreAddEdgeK(v, k, &vCycleDP, &counts)
+		if edgeErr == nil && edgeScore > score {
 			score, backtrace = edgeScore, edgeTrace
 		}
+		if dp.Enumerate > 0 && backtrace != nil {
+			if noEdgeErr == nil && noEdgeScore == score {
+				options = dp.noEdgeOptions(lID, rID, k, score)
+			}
+			if edgeErr == nil && edgeScore == score {
+				options = append(options, edgeTrace)
+			}
+			if len(options) > 1 {
+				backtrace = &choiceTrace{options: options}
+			}
+		}
+		dp.recordK(k, counts, time.Since(start))
 		if backtrace == nil || scores[k-1] >= score {
 			break
 		}
 		scores = append(scores, score)
 		traces = append(traces, backtrace)
+		if v == dp.Tree.Root() {
+			tm.Score(k, float64(score))
+		}
 		if k == dp.NumNodes*dp.NumNodes {
 			panic("runaway loop")
 		}
@@ -162,77 +418,139 @@ func (dp *DP[S]) solve(v *tree.Node) ([]S, []trace) {
 			panic(fmt.Sprintf("scores list in weird state: k %d, len(scores) %d, len(branches) %d", k, len(scores), len(traces)))
 		}
 	}
+	if capped && len(scores)-1 == maxK {
+		dp.mu.Lock()
+		dp.Capped++
+		dp.mu.Unlock()
+	}
 	return scores, traces
 }
 
+// Adds work done for k at one vertex to the per-k statistics
+func (dp *DP[S]) recordK(k int, counts edgeCounts, elapsed time.Duration) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	for len(dp.KStats) < k {
+		dp.KStats = append(dp.KStats, pr.KStats{K: len(dp.KStats) + 1})
+	}
+	st := &dp.KStats[k-1]
+	st.Vertices++
+	st.EdgesEvaluated += counts.evaluated
+	st.ValidSplits += counts.valid
+	st.CacheHits += counts.hits
+	st.Time += elapsed
+}
+
 // Calculate score for vertex v assuming we do not add an edge
 func (dp *DP[S]) scoreNoAddEdgeK(lId, rId, k int) (score S, backtrace *noCycleTrace, err error) {
-	lK, rK, err := BestSplit(dp.DP[lId], dp.DP[rId], k)
+	lK, rK, err := util.BestSplit(dp.DP[lId], dp.DP[rId], k)
 	score = dp.DP[lId][lK] + dp.DP[rId][rK]
 	backtrace = &noCycleTrace{prevs: [2]*trace{&dp.Traceback[lId][lK], &dp.Traceback[rId][rK]}}
 	return
 }
 
+// Traces of every split of k edges between the children of v scoring score
+// without an edge at v, the first being the one scoreNoAddEdgeK chooses
+func (dp *DP[S]) noEdgeOptions(lId, rId, k int, score S) []trace {
+	splits, _ := util.AllBestSplits(dp.DP[lId], dp.DP[rId], k)
+	options := make([]trace, 0, len(splits))
+	for _, split := range splits {
+		lK, rK := split[0], split[1]
+		if dp.DP[lId][lK]+dp.DP[rId][rK] == score {
+			options = append(options, &noCycleTrace{prevs: [2]*trace{&dp.Traceback[lId][lK], &dp.Traceback[rId][rK]}})
+		}
+	}
+	return options
+}
+
 // Calculates score for given top node v assuming an edge is added; returns
 // score and best edge. k indicates that the edge being added is the k^th edge.
-func (dp *DP[S]) scoreAddEdgeK(v *tree.Node, k int, vCycleDP *cycleDP[S]) (bestScore S, bestCycleTrace *cycleTrace, err error) {
+func (dp *DP[S]) scoreAddEdgeK(v *tree.Node, k int, vCycleDP *cycleDP[S], counts *edgeCounts) (bestScore S, backtrace trace, err error) {
 	if k <= 0 {
 		panic("should never be called with zero or negative k value")
 	}
 	prevK := k - 1
-	bestCycleLen := 0
+	var ties tieSet
+	var bestCycleTrace *cycleTrace
 	vCycleDP.update(prevK, dp)
-	for _, c := range dp.Tree.Children[v.Id()] {
-		if c.Tip() {
-			continue
-		}
-		curScore, curCycleTrace, err := dp.scoreEdgesDown(v, vCycleDP, prevK)
-		if err != nil {
-			continue
+	consider := func(score S, cycleTrace *cycleTrace) {
+		if dp.keepTies() {
+			ties = addTies(ties, cycleTrace.ties, score, bestScore, bestCycleTrace == nil)
 		}
-		cycleLen := sc.CycleLength(curCycleTrace.branch.IDs[gr.Ui], curCycleTrace.branch.IDs[gr.Wi], dp.Tree)
-		if curScore > bestScore || bestCycleTrace == nil || (curScore == bestScore && cycleLen <= bestCycleLen) {
-			bestScore = curScore
-			bestCycleTrace = curCycleTrace
-			bestCycleLen = cycleLen
+		if dp.better(score, cycleTrace.branch, bestScore, bestCycleTrace) {
+			bestScore = score
+			bestCycleTrace = cycleTrace
 		}
 	}
-	SubtreePostOrder(v, func(u, otherSubtree *tree.Node) {
-		curScore, curCycleTrace, err := dp.scoreEdgesAcross(u, otherSubtree, v, vCycleDP, prevK)
-		if err != nil {
-			return
-		}
-		cycleLen := sc.CycleLength(curCycleTrace.branch.IDs[gr.Ui], curCycleTrace.branch.IDs[gr.Wi], dp.Tree)
-		if curScore > bestScore || bestCycleTrace == nil || (curScore == bestScore && cycleLen <= bestCycleLen) {
-			bestScore = curScore
-			bestCycleTrace = curCycleTrace
-			bestCycleLen = cycleLen
+	if slices.ContainsFunc(dp.Tree.Children[v.Id()], func(c *tree.Node) bool { return !c.Tip() }) {
+		if curScore, curCycleTrace, err := dp.scoreEdgesDown(v, vCycleDP, prevK, counts); err == nil {
+			consider(curScore, curCycleTrace)
 		}
+	}
+	var tasks [][2]*tree.Node // (u, other subtree) pairs
+	util.SubtreePostOrder(v, func(u, otherSubtree *tree.Node) {
+		tasks = append(tasks, [2]*tree.Node{u, otherSubtree})
 	})
+	results := make([]acrossResult[S], len(tasks))
+	pool.Run(len(tasks), dp.edgeProcs(), func(i int) {
+		r := &results[i]
+		r.score, r.trace, r.err = dp.scoreEdgesAcross(tasks[i][0], tasks[i][1], v, vCycleDP, prevK, &r.counts)
+	})
+	for _, r := range results {
+		counts.add(r.counts)
+		if r.err != nil {
+			continue
+		}
+		consider(r.score, r.trace)
+	}
 	if bestCycleTrace == nil {
 		return 0, nil, ErrNoValidSplit
 	}
+	if dp.ReportTies {
+		ties.record(bestCycleTrace)
+	}
+	if dp.Enumerate > 0 {
+		return bestScore, dp.edgeOptions(v, vCycleDP, prevK, bestScore, bestCycleTrace, ties), nil
+	}
 	return bestScore, bestCycleTrace, nil
 }
 
+// Result of scoring all edges from u to the other subtree
+type acrossResult[S sc.Score] struct {
+	score  S
+	trace  *cycleTrace
+	err    error
+	counts edgeCounts
+}
+
 // Scores edges for a branch going from v to all ancestors w
-func (dp *DP[S]) scoreEdgesDown(v *tree.Node, vCycleDP *cycleDP[S], prevK int) (bestScore S, traceback *cycleTrace, err error) {
-	SubtreePreOrder(v, func(w *tree.Node) {
-		if !sc.ShouldCalcEdge(v.Id(), w.Id(), dp.Tree) {
+func (dp *DP[S]) scoreEdgesDown(v *tree.Node, vCycleDP *cycleDP[S], prevK int, counts *edgeCounts) (bestScore S, traceback *cycleTrace, err error) {
+	var ties tieSet
+	util.SubtreePreOrder(v, func(w *tree.Node) {
+		if !dp.Policy.Allows(v.Id(), w.Id(), dp.Tree) {
 			return
 		}
+		counts.evaluated++
 		edgeScore := dp.Scorer.CalcScore(v.Id(), w.Id(), dp.Tree)
-		wPathK, wDownK, err := BestSplit(vCycleDP.scores[w.Id()], dp.DP[w.Id()], prevK)
+		wPathK, wDownK, err := util.BestSplit(vCycleDP.scores[w.Id()], dp.DP[w.Id()], prevK)
 		if err != nil { // no valid split, so we don't consider this edge
 			return
 		}
+		counts.valid++
+		if wPathK < prevK {
+			counts.hits++
+		}
 		wScore, wPathTrace := vCycleDP.get(w.Id(), wPathK)
 		score := edgeScore + wScore + dp.DP[w.Id()][wDownK]
-		if score > bestScore || traceback == nil {
+		br := gr.Branch{IDs: [2]int{v.Id(), w.Id()}}
+		if dp.keepTies() {
+			ties = addTies(ties, []gr.Branch{br}, score, bestScore, traceback == nil)
+		}
+		if dp.better(score, br, bestScore, traceback) {
 			traceback = &cycleTrace{
 				pathW:      wPathTrace,
 				wDownTrace: &dp.Traceback[w.Id()][wDownK],
-				branch:     gr.Branch{IDs: [2]int{v.Id(), w.Id()}},
+				branch:     br,
 			}
 			bestScore = score
 		}
@@ -240,20 +558,26 @@ func (dp *DP[S]) scoreEdgesDown(v *tree.Node, vCycleDP *cycleDP[S], prevK int) (
 	if traceback == nil {
 		return 0, nil, ErrNoValidSplit
 	}
+	traceback.ties = ties
 	return bestScore, traceback, nil
 }
 
 // Score branch u -> w (for all w in subtree under sub)
-func (dp *DP[S]) scoreEdgesAcross(u, sub, v *tree.Node, vCycleDP *cycleDP[S], prevK int) (bestScore S, traceback *cycleTrace, err error) {
+func (dp *DP[S]) scoreEdgesAcross(u, sub, v *tree.Node, vCycleDP *cycleDP[S], prevK int, counts *edgeCounts) (bestScore S, traceback *cycleTrace, err error) {
 	if v == u {
 		panic("u should not equal v, use scoreUDown instead")
 	}
-	SubtreePreOrder(sub, func(w *tree.Node) {
+	var ties tieSet
+	util.SubtreePreOrder(sub, func(w *tree.Node) {
 		if u == w {
 			panic("u should not equal w")
 		}
+		if !dp.Policy.Allows(u.Id(), w.Id(), dp.Tree) {
+			return
+		}
+		counts.evaluated++
 		edgeScore := dp.Scorer.CalcScore(u.Id(), w.Id(), dp.Tree)
-		indices, err := FourWayBestSplit(
+		indices, err := util.FourWayBestSplit(
 			[4][]S{
 				vCycleDP.scores[w.Id()],
 				vCycleDP.scores[u.Id()],
@@ -266,16 +590,26 @@ func (dp *DP[S]) scoreEdgesAcross(u, sub, v *tree.Node, vCycleDP *cycleDP[S], pr
 			return
 		}
 		wPathK, uPathK, wDownK, uDownK := indices[0], indices[1], indices[2], indices[3]
+		counts.valid++
+		for _, pathK := range []int{wPathK, uPathK} {
+			if pathK < prevK {
+				counts.hits++
+			}
+		}
 		wScore, wPathTrace := vCycleDP.get(w.Id(), wPathK)
 		uScore, uPathTrace := vCycleDP.get(u.Id(), uPathK)
 		score := edgeScore + wScore + uScore + dp.DP[w.Id()][wDownK] + dp.DP[u.Id()][uDownK]
-		if score > bestScore || traceback == nil {
+		br := gr.Branch{IDs: [2]int{u.Id(), w.Id()}}
+		if dp.keepTies() {
+			ties = addTies(ties, []gr.Branch{br}, score, bestScore, traceback == nil)
+		}
+		if dp.better(score, br, bestScore, traceback) {
 			traceback = &cycleTrace{
 				pathW:      wPathTrace,
 				pathU:      uPathTrace,
 				wDownTrace: &dp.Traceback[w.Id()][wDownK],
 				uDownTrace: &dp.Traceback[u.Id()][uDownK],
-				branch:     gr.Branch{IDs: [2]int{u.Id(), w.Id()}},
+				branch:     br,
 			}
 			bestScore = score
 		}
@@ -283,9 +617,10 @@ func (dp *DP[S]) scoreEdgesAcross(u, sub, v *tree.Node, vCycleDP *cycleDP[S], pr
 	if traceback == nil {
 		return 0, nil, ErrNoValidSplit
 	}
+	traceback.ties = ties
 	return bestScore, traceback, nil
 }
 
 func (dp *DP[S]) traceback(k int) []gr.Branch {
-	return dp.Traceback[dp.Tree.Root().Id()][k].traceback()
+	return traceBranches(dp.Traceback[dp.Tree.Root().Id()][k])
 }
@@ -0,0 +1,222 @@
+package infer
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+	"github.com/jsdoublel/camus/util"
+)
+
+// Enumerates the networks whose dp score is within a tolerance of the optimal
+// score. The dp tables already bound the score of every subproblem (including
+// the cycle paths), so we branch over every choice the dp makes at a
+// subproblem and prune the ones whose bound is below what is still needed,
+// instead of keeping k-best lists in the tables.
+type nearEnum[S sc.Score] struct {
+	dp     *DP[S]
+	cycles map[int]*cycleDP[S] // cycle dp of each vertex, rebuilt when first needed
+	limit  int                 // maximum number of solutions kept for a subproblem
+	capped bool                // whether solutions were dropped because of limit
+}
+
+// Branches added in part of the tree, with their total score
+type scoredSet[S sc.Score] struct {
+	branches []gr.Branch
+	score    S
+}
+
+// Subproblem the enumeration branches over: bound[k] is an upper bound on the
+// score of its solutions with k edges, and solve returns them (at least
+// floor, best first)
+type part[S sc.Score] struct {
+	bound []S
+	solve func(k int, floor float64) []scoredSet[S]
+}
+
+// Networks whose dp score is within percent of the optimal score with the same
+// number of edges, best first (the optimal network first on ties), for each k
+// from 1 to len(branches), the optimal branch sets. At most limit networks
+// are kept for any subproblem.
+func (dp *DP[S]) nearOptimal(percent float64, limit int, branches [][]gr.Branch) [][]pr.NearOptimal {
+	e := &nearEnum[S]{dp: dp, cycles: make(map[int]*cycleDP[S]), limit: limit}
+	root := dp.Tree.Root().Id()
+	near := make([][]pr.NearOptimal, len(branches))
+	for k := 1; k <= len(branches); k++ {
+		opt := float64(dp.DP[root][k])
+		tol := math.Abs(opt) * percent / 100
+		slack := 1e-9 * max(1, math.Abs(opt)) // so rounding doesn't drop networks right at the cutoff
+		optKey := branchSetKey(branches[k-1])
+		seen := make(map[string]bool)
+		for _, s := range e.subtree(root).solve(k, opt-tol-slack) {
+			key := branchSetKey(s.branches)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			near[k-1] = append(near[k-1], pr.NearOptimal{Branches: s.branches, Score: float64(s.score), Gap: opt - float64(s.score)})
+		}
+		slices.SortStableFunc(near[k-1], func(a, b pr.NearOptimal) int {
+			return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(boolRank(branchSetKey(a.Branches) != optKey), boolRank(branchSetKey(b.Branches) != optKey)))
+		})
+		for i := range near[k-1] {
+			if percent, err := dp.Scorer.PercentQuartetSat(near[k-1][i].Branches, dp.Tree); err == nil {
+				near[k-1][i].QSat = percent
+			}
+		}
+		lg.Infof("k = %d: %d networks score within %g%% of the optimal score %v", k, len(near[k-1]), percent, dp.DP[root][k])
+	}
+	if e.capped {
+		lg.Infof("stopped at the limit of %d networks for some subproblems; there may be more networks within %g%%", limit, percent)
+	}
+	return near
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Solutions of the dp subproblem at v
+func (e *nearEnum[S]) subtree(v int) part[S] {
+	return part[S]{
+		bound: e.dp.DP[v],
+		solve: func(k int, floor float64) []scoredSet[S] { return e.solveSubtree(v, k, floor) },
+	}
+}
+
+func (e *nearEnum[S]) solveSubtree(v, k int, floor float64) []scoredSet[S] {
+	dp := e.dp
+	if k >= len(dp.DP[v]) || float64(dp.DP[v][k]) < floor {
+		return nil
+	}
+	node := dp.Tree.IdToNodes[v]
+	if node.Tip() {
+		return []scoredSet[S]{{}}
+	}
+	l, r := dp.Tree.Children[v][0].Id(), dp.Tree.Children[v][1].Id()
+	sols := e.join(e.subtree(l), e.subtree(r)).solve(k, floor)
+	if k > 0 {
+		sols = append(sols, e.edgesAt(node, k, floor)...)
+	}
+	return e.trim(sols)
+}
+
+// Solutions with an edge added at v (the k^th edge), with the same candidate
+// edges as scoreAddEdgeK
+func (e *nearEnum[S]) edgesAt(v *tree.Node, k int, floor float64) []scoredSet[S] {
+	dp := e.dp
+	cdp := e.cycle(v)
+	var sols []scoredSet[S]
+	add := func(br gr.Branch, rest part[S]) {
+		edgeScore := dp.Scorer.CalcScore(br.IDs[gr.Ui], br.IDs[gr.Wi], dp.Tree)
+		if k-1 >= len(rest.bound) || float64(edgeScore+rest.bound[k-1]) < floor {
+			return
+		}
+		for _, s := range rest.solve(k-1, floor-float64(edgeScore)) {
+			sols = append(sols, scoredSet[S]{branches: append(slices.Clone(s.branches), br), score: s.score + edgeScore})
+		}
+	}
+	if !dp.Tree.Children[v.Id()][0].Tip() || !dp.Tree.Children[v.Id()][1].Tip() {
+		util.SubtreePreOrder(v, func(w *tree.Node) {
+			if dp.Policy.Allows(v.Id(), w.Id(), dp.Tree) {
+				add(gr.Branch{IDs: [2]int{v.Id(), w.Id()}}, e.join(e.path(cdp, w), e.subtree(w.Id())))
+			}
+		})
+	}
+	util.SubtreePostOrder(v, func(u, otherSubtree *tree.Node) {
+		uSide := e.join(e.path(cdp, u), e.subtree(u.Id()))
+		util.SubtreePreOrder(otherSubtree, func(w *tree.Node) {
+			if dp.Policy.Allows(u.Id(), w.Id(), dp.Tree) {
+				add(gr.Branch{IDs: [2]int{u.Id(), w.Id()}}, e.join(e.join(e.path(cdp, w), e.subtree(w.Id())), uSide))
+			}
+		})
+	})
+	return sols
+}
+
+// Cycle dp of v with every k the dp used at v
+func (e *nearEnum[S]) cycle(v *tree.Node) *cycleDP[S] {
+	if cdp, ok := e.cycles[v.Id()]; ok {
+		return cdp
+	}
+	cdp := &cycleDP[S]{
+		v:          v,
+		scores:     make([][]S, e.dp.NumNodes),
+		traceNodes: make([][]*cycleTraceNode, e.dp.NumNodes),
+	}
+	for prevK := range len(e.dp.DP[v.Id()]) - 1 {
+		cdp.update(prevK, e.dp)
+	}
+	e.cycles[v.Id()] = cdp
+	return cdp
+}
+
+// Solutions of the cycle path from v down to cur (the subtrees hanging off the
+// path). Paths from children of v are empty (see cycleDP.update).
+func (e *nearEnum[S]) path(cdp *cycleDP[S], cur *tree.Node) part[S] {
+	p, err := cur.Parent()
+	if cur == cdp.v || err == nil && p == cdp.v {
+		return part[S]{
+			bound: cdp.scores[cur.Id()],
+			solve: func(k int, floor float64) []scoredSet[S] {
+				if k != 0 || floor > 0 {
+					return nil
+				}
+				return []scoredSet[S]{{}}
+			},
+		}
+	}
+	return e.pair(e.path(cdp, p), e.subtree(e.dp.Tree.Sibling(cur).Id()), cdp.scores[cur.Id()])
+}
+
+// Solutions combining one solution of a and one of b, for every split of the
+// edges between them
+func (e *nearEnum[S]) join(a, b part[S]) part[S] {
+	bound := make([]S, len(a.bound)+len(b.bound)-1)
+	for k := range bound {
+		i, j, _ := util.BestSplit(a.bound, b.bound, k)
+		bound[k] = a.bound[i] + b.bound[j]
+	}
+	return e.pair(a, b, bound)
+}
+
+// Same as join, with the bound of the combined solutions already known
+func (e *nearEnum[S]) pair(a, b part[S], bound []S) part[S] {
+	return part[S]{
+		bound: bound,
+		solve: func(k int, floor float64) []scoredSet[S] {
+			var sols []scoredSet[S]
+			for i := max(0, k-len(b.bound)+1); i <= min(k, len(a.bound)-1); i++ {
+				j := k - i
+				if float64(a.bound[i]+b.bound[j]) < floor {
+					continue
+				}
+				for _, sa := range a.solve(i, floor-float64(b.bound[j])) {
+					for _, sb := range b.solve(j, floor-float64(sa.score)) {
+						sols = append(sols, scoredSet[S]{branches: append(slices.Clone(sa.branches), sb.branches...), score: sa.score + sb.score})
+					}
+				}
+			}
+			return e.trim(sols)
+		},
+	}
+}
+
+// Sorts solutions best first, keeping at most e.limit
+func (e *nearEnum[S]) trim(sols []scoredSet[S]) []scoredSet[S] {
+	slices.SortStableFunc(sols, func(a, b scoredSet[S]) int { return cmp.Compare(b.score, a.score) })
+	if len(sols) > e.limit {
+		e.capped = true
+		sols = sols[:e.limit]
+	}
+	return sols
+}
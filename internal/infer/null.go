@@ -0,0 +1,246 @@
+package infer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/evolbioinfo/gotree/tree"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Longest branch length (in coalescent units) estimated from gene trees;
+// clades found in every gene tree would otherwise have infinite length
+const maxCoalescentLength = 10.0
+
+// Quantile of the null gains reported next to the real gains
+const nullQuantile = 0.95
+
+// Calibrates score gains against incomplete lineage sorting alone. Gene trees
+// are simulated under the multispecies coalescent on the constraint tree (with
+// branch lengths estimated from the gene trees) reps times, each replicate with
+// the same taxa as the real gene trees, and the dp is rerun on each replicate.
+// The gain from adding each edge in the real results (full) is reported next
+// to the gains from the simulated gene trees.
+func NullCalibration(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, opts InferOptions, reps int, full *DPResults) ([]pr.NullGain, error) {
+	if reps < 1 {
+		return nil, fmt.Errorf("%w, number of null replicates must be positive", ErrInvalidOption)
+	}
+	defer tm.Phase("null simulation")()
+	lg.Infof("simulating %d null replicates of %d gene trees under the constraint tree", reps, len(geneTrees))
+	opts.NumAlts, opts.Overlaps, opts.ExclSupport, opts.Within, opts.Provenance = 0, false, false, 0, false
+	lengths := estimateBranchLengths(tre, geneTrees)
+	taxa := make([]map[string]bool, len(geneTrees))
+	for i, gt := range geneTrees {
+		taxa[i] = make(map[string]bool)
+		for _, tip := range gt.Tips() {
+			taxa[i][tip.Name()] = true
+		}
+	}
+	rng := opts.NewRand(nullSimStream)
+	gains := scoreGains(full.Scores)
+	nullGains := make([][]float64, len(gains)) // null gains for each number of edges
+	for r := range reps {
+		simTrees := make([]*tree.Tree, len(geneTrees))
+		for i := range geneTrees {
+			gt, err := simulateGeneTree(tre, lengths, taxa[i], rng)
+			if err != nil {
+				return nil, fmt.Errorf("simulating gene tree %d: %w", i+1, err)
+			}
+			simTrees[i] = gt
+		}
+		results, err := inferQuietly(ctx, tre, simTrees, opts)
+		if err != nil {
+			return nil, fmt.Errorf("null replicate %d: %w", r+1, err)
+		}
+		simGains := scoreGains(results.Scores)
+		for k := range nullGains {
+			var g float64 // replicates with fewer edges gain nothing
+			if k < len(simGains) {
+				g = simGains[k]
+			}
+			nullGains[k] = append(nullGains[k], g)
+		}
+		if (r+1)%10 == 0 {
+			lg.Debugf("null simulation finished %d of %d replicates", r+1, reps)
+		}
+	}
+	summary := make([]pr.NullGain, len(gains))
+	for k, gain := range gains {
+		summary[k] = summarizeNullGains(k+1, gain, nullGains[k])
+	}
+	return summary, nil
+}
+
+// Increase in root score from each added edge (the score with no edges is 0)
+func scoreGains(scores []float64) []float64 {
+	gains := make([]float64, len(scores))
+	prev := 0.0
+	for i, s := range scores {
+		gains[i] = s - prev
+		prev = s
+	}
+	return gains
+}
+
+func summarizeNullGains(numEdges int, gain float64, null []float64) pr.NullGain {
+	sorted := slices.Sorted(slices.Values(null))
+	var sum float64
+	atLeast := 0
+	for _, g := range sorted {
+		sum += g
+		if g >= gain {
+			atLeast++
+		}
+	}
+	q := int(math.Ceil(nullQuantile*float64(len(sorted)))) - 1
+	return pr.NullGain{
+		NumEdges:     numEdges,
+		Gain:         gain,
+		NullMean:     sum / float64(len(sorted)),
+		NullQuantile: sorted[max(q, 0)],
+		PValue:       float64(atLeast+1) / float64(len(sorted)+1),
+	}
+}
+
+// Estimates the length (in coalescent units) of the branch above each node of
+// the constraint tree, indexed by node id, from the fraction f of informative
+// gene trees that contain the clade, using f = 1 - 2/3 exp(-t). This is only
+// exact for four taxa and underestimates lengths for larger clades, which makes
+// the null more generous with ils rather than less. The two branches below the
+// root are one unrooted edge, so they split its length.
+func estimateBranchLengths(tre *tree.Tree, geneTrees []*tree.Tree) []float64 {
+	tipIndex := make(map[string]uint)
+	for i, tip := range tre.Tips() {
+		tipIndex[tip.Name()] = uint(i)
+	}
+	clades := make([]*bitset.BitSet, len(tre.Nodes()))
+	leafsetsBelow(tre.Root(), nil, tipIndex, func(n *tree.Node, clade *bitset.BitSet) {
+		clades[n.Id()] = clade
+	})
+	found, informative := make([]int, len(clades)), make([]int, len(clades))
+	for _, gt := range geneTrees {
+		present := bitset.New(uint(len(tipIndex)))
+		splits := make(map[string]bool)
+		leafsetsBelow(gt.Root(), nil, tipIndex, func(n *tree.Node, clade *bitset.BitSet) {
+			if n == gt.Root() {
+				present = clade
+			} else {
+				splits[clade.String()] = true
+			}
+		})
+		for id, clade := range clades {
+			in := clade.Intersection(present)
+			out := present.Difference(clade)
+			if in.Count() < 2 || out.Count() < 2 {
+				continue
+			}
+			informative[id]++
+			if splits[in.String()] || splits[out.String()] {
+				found[id]++
+			}
+		}
+	}
+	lengths := make([]float64, len(clades))
+	for id := range lengths {
+		lengths[id] = maxCoalescentLength
+		if informative[id] == 0 {
+			continue
+		}
+		f := float64(found[id]) / float64(informative[id])
+		switch {
+		case f <= 1.0/3:
+			lengths[id] = 0
+		case f < 1:
+			lengths[id] = min(-math.Log(1.5*(1-f)), maxCoalescentLength)
+		}
+	}
+	root := tre.Root()
+	for _, child := range root.Neigh() {
+		lengths[child.Id()] /= 2
+	}
+	lengths[root.Id()] = math.Inf(1)
+	return lengths
+}
+
+// Calls f with the set of leaves (by tip index) below each node of the
+// subtree rooted at cur, in post order. Leaves not in tipIndex are ignored.
+func leafsetsBelow(cur, prev *tree.Node, tipIndex map[string]uint, f func(n *tree.Node, clade *bitset.BitSet)) *bitset.BitSet {
+	clade := bitset.New(uint(len(tipIndex)))
+	if cur.Tip() {
+		if i, ok := tipIndex[cur.Name()]; ok {
+			clade.Set(i)
+		}
+	}
+	for _, n := range cur.Neigh() {
+		if n != prev {
+			clade.InPlaceUnion(leafsetsBelow(n, cur, tipIndex, f))
+		}
+	}
+	f(cur, clade)
+	return clade
+}
+
+// Simulates a gene tree on the taxa in keep under the multispecies coalescent
+// on tre, where lengths gives the length of the branch above each node. Gene
+// tree branch lengths are in coalescent units, with each node placed at the
+// time it coalesced (measured from the tips, taking the longest path when tre
+// is not ultrametric).
+func simulateGeneTree(tre *tree.Tree, lengths []float64, keep map[string]bool, rng *rand.Rand) (*tree.Tree, error) {
+	gt := tree.NewTree()
+	heights := make(map[*tree.Node]float64)
+	// returns the lineages left at the top of the branch above cur, and the
+	// height of the bottom of that branch
+	var coalesce func(cur, prev *tree.Node) ([]*tree.Node, float64)
+	coalesce = func(cur, prev *tree.Node) ([]*tree.Node, float64) {
+		lineages := make([]*tree.Node, 0)
+		if cur.Tip() && keep[cur.Name()] {
+			leaf := gt.NewNode()
+			leaf.SetName(cur.Name())
+			lineages = append(lineages, leaf)
+		}
+		base := 0.0
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				childLineages, childBase := coalesce(n, cur)
+				lineages = append(lineages, childLineages...)
+				base = max(base, childBase+lengths[n.Id()])
+			}
+		}
+		t := 0.0
+		for len(lineages) > 1 {
+			k := len(lineages)
+			t += rng.ExpFloat64() / float64(k*(k-1)/2)
+			if t > lengths[cur.Id()] {
+				break
+			}
+			i, j := rng.IntN(k), rng.IntN(k-1)
+			if j >= i {
+				j++
+			}
+			parent := gt.NewNode()
+			heights[parent] = base + t
+			for _, child := range []*tree.Node{lineages[i], lineages[j]} {
+				gt.ConnectNodes(parent, child).SetLength(heights[parent] - heights[child])
+			}
+			lineages[i] = parent
+			lineages = slices.Delete(lineages, j, j+1)
+		}
+		return lineages, base
+	}
+	root, _ := coalesce(tre.Root(), nil)
+	if len(root) != 1 {
+		return nil, fmt.Errorf("no taxa to simulate")
+	}
+	gt.SetRoot(root[0])
+	if err := gt.UpdateTipIndex(); err != nil {
+		return nil, err
+	}
+	return gt, nil
+}
@@ -0,0 +1,55 @@
+package infer
+
+import (
+	"cmp"
+	"slices"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	"github.com/jsdoublel/camus/internal/pool"
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+// Finds candidate branches that score at least as well on their own as the
+// weakest branch of the network (branches), but were left out because their
+// cycles overlap the cycles of chosen branches. Many of these suggest the data
+// wants a network with overlapping cycles (i.e., level-2 or higher).
+func (dp *DP[S]) overlaps(branches []gr.Branch) []pr.Overlap {
+	if len(branches) == 0 {
+		return nil
+	}
+	weakest := float64(dp.Scorer.CalcScore(branches[0].IDs[gr.Ui], branches[0].IDs[gr.Wi], dp.Tree))
+	for _, br := range branches[1:] {
+		weakest = min(weakest, float64(dp.Scorer.CalcScore(br.IDs[gr.Ui], br.IDs[gr.Wi], dp.Tree)))
+	}
+	candidates := make([][]pr.Overlap, dp.NumNodes)
+	pool.Run(dp.NumNodes, dp.NProcs, func(u int) {
+		for w := range dp.NumNodes {
+			if !dp.Policy.Allows(u, w, dp.Tree) {
+				continue
+			}
+			br := gr.Branch{IDs: [2]int{u, w}}
+			score := float64(dp.Scorer.CalcScore(u, w, dp.Tree))
+			if score < weakest || slices.Contains(branches, br) {
+				continue
+			}
+			var conflicts []gr.Branch
+			for _, chosen := range branches {
+				if !gr.Compatible(br, chosen, dp.Tree) {
+					conflicts = append(conflicts, chosen)
+				}
+			}
+			if conflicts != nil {
+				candidates[u] = append(candidates[u], pr.Overlap{Branch: br, Score: score, Conflicts: conflicts})
+			}
+		}
+	})
+	overlaps := slices.Concat(candidates...)
+	slices.SortFunc(overlaps, func(o1, o2 pr.Overlap) int {
+		return cmp.Or(
+			cmp.Compare(o2.Score, o1.Score),
+			cmp.Compare(o1.Branch.IDs[gr.Ui], o2.Branch.IDs[gr.Ui]),
+			cmp.Compare(o1.Branch.IDs[gr.Wi], o2.Branch.IDs[gr.Wi]),
+		)
+	})
+	return overlaps
+}
@@ -0,0 +1,260 @@
+package infer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	"github.com/jsdoublel/camus/util"
+)
+
+// Places taxa that are in the gene trees but not in the network onto edges of
+// the network's backbone tree, picking for each new taxon the edge that
+// satisfies the most gene tree quartets made of the taxon and three backbone
+// taxa. Each taxon is placed independently of the others, and the network is
+// modified in place (taxa with no informative quartets are not placed).
+func PlaceTaxa(ntw *tree.Tree, geneTrees []*tree.Tree) ([]pr.Placement, error) {
+	backbone, err := pr.BackboneTree(ntw)
+	if err != nil {
+		return nil, err
+	}
+	td := gr.MakeTreeData(backbone, nil)
+	leafIDs := make(map[string]int)
+	for _, tip := range backbone.Tips() {
+		leafIDs[tip.Name()] = tip.Id()
+	}
+	newTaxa := make([]string, 0)
+	for _, gt := range geneTrees {
+		for _, tip := range gt.Tips() {
+			if _, ok := leafIDs[tip.Name()]; !ok && !slices.Contains(newTaxa, tip.Name()) {
+				newTaxa = append(newTaxa, tip.Name())
+			}
+		}
+	}
+	if len(newTaxa) == 0 {
+		return nil, fmt.Errorf("%w, gene trees have no taxa that are not in the network", ErrInvalidOption)
+	}
+	slices.Sort(newTaxa)
+	lg.Infof("placing %d new taxa onto network with %d taxa", len(newTaxa), len(leafIDs))
+	placements := make([]pr.Placement, 0, len(newTaxa))
+	targets := make([]int, 0, len(newTaxa)) // backbone node below each placement
+	for _, x := range newTaxa {
+		scores, total := placementScores(td, leafIDs, geneTrees, x)
+		if total == 0 {
+			lg.Warnf("no informative quartets for %s; it was not placed", x)
+			continue
+		}
+		// the two edges below the root are the same unrooted edge, so only the
+		// first one is a candidate
+		rootChildren := td.Children[td.Root().Id()]
+		best, ties := rootChildren[0].Id(), 0
+		for _, n := range td.IdToNodes {
+			v := n.Id()
+			if n == td.Root() || n == rootChildren[1] || v == best {
+				continue
+			}
+			switch {
+			case scores[v] > scores[best]:
+				best, ties = v, 0
+			case scores[v] == scores[best]:
+				ties++
+			}
+		}
+		placements = append(placements, pr.Placement{
+			Taxon:     x,
+			Clade:     leafsetKey(td.IdToNodes[best], parentOf(td.IdToNodes[best]), leafIDs),
+			Satisfied: scores[best],
+			Total:     total,
+			Ties:      ties,
+		})
+		targets = append(targets, best)
+	}
+	for i, p := range placements {
+		if err := graftOnNetwork(ntw, td, leafIDs, targets[i], p.Taxon); err != nil {
+			return nil, err
+		}
+	}
+	return placements, nil
+}
+
+// Number of gene tree quartets with new taxon x and three backbone taxa that
+// are satisfied when x is placed on the edge above each backbone node (by id),
+// and the total number of resolved quartets.
+func placementScores(td *gr.TreeData, leafIDs map[string]int, geneTrees []*tree.Tree, x string) ([]uint, uint) {
+	// satisfied quartets are added to every edge in a subtree (including the edge
+	// above its root) and summed down from the root at the end
+	add := make([]int, len(td.IdToNodes))
+	global, total := 0, uint(0)
+	for _, gt := range geneTrees {
+		xTip, leaves, depth := rootAtTaxon(gt, x, leafIDs)
+		if xTip == nil || len(leaves) < 3 {
+			continue
+		}
+		for i := range leaves {
+			for j := i + 1; j < len(leaves); j++ {
+				for k := j + 1; k < len(leaves); k++ {
+					// the pair with the deepest lca (rooted at x) is a cherry, the
+					// remaining taxon is sister to x
+					dij, dik, djk := depth[i][j], depth[i][k], depth[j][k]
+					var p, q, r int
+					switch {
+					case djk > dij && djk > dik:
+						p, q, r = i, j, k
+					case dik > dij && dik > djk:
+						p, q, r = j, i, k
+					case dij > dik && dij > djk:
+						p, q, r = k, i, j
+					default: // unresolved
+						continue
+					}
+					total++
+					pID, qID, rID := leaves[p], leaves[q], leaves[r]
+					if m := td.LCA(qID, rID); td.Under(td.LCA(pID, qID), m) {
+						// p is outside the subtree of the median, so any edge not below it works
+						global++
+						for _, c := range td.Children[m] {
+							add[c.Id()]--
+						}
+					} else {
+						m := deeper(td, td.LCA(pID, qID), td.LCA(pID, rID))
+						for _, c := range td.Children[m] {
+							if c.Id() == pID || td.Under(c.Id(), pID) {
+								add[c.Id()]++
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	sums := make([]int, len(add))
+	scores := make([]uint, len(add))
+	util.SubtreePreOrder(td.Root(), func(cur *tree.Node) {
+		sums[cur.Id()] = add[cur.Id()]
+		if p, err := cur.Parent(); err == nil {
+			sums[cur.Id()] += sums[p.Id()]
+		}
+		scores[cur.Id()] = uint(global + sums[cur.Id()])
+	})
+	return scores, total
+}
+
+func deeper(td *gr.TreeData, u, v int) int {
+	if td.Depths[u] >= td.Depths[v] {
+		return u
+	}
+	return v
+}
+
+// Finds tip x in gene tree and returns it, the backbone node ids of the gene
+// tree's backbone taxa, and the depth of the lca of each pair of them when the
+// gene tree is rooted at x. Returns nil if x is not in the gene tree.
+func rootAtTaxon(gt *tree.Tree, x string, leafIDs map[string]int) (*tree.Node, []int, [][]int) {
+	var xTip *tree.Node
+	for _, tip := range gt.Tips() {
+		if tip.Name() == x {
+			xTip = tip
+		}
+	}
+	if xTip == nil {
+		return nil, nil, nil
+	}
+	leaves := make([]int, 0)
+	index := make(map[*tree.Node]int)
+	for _, tip := range gt.Tips() {
+		if id, ok := leafIDs[tip.Name()]; ok {
+			index[tip] = len(leaves)
+			leaves = append(leaves, id)
+		}
+	}
+	depth := make([][]int, len(leaves))
+	for i := range depth {
+		depth[i] = make([]int, len(leaves))
+	}
+	var below func(cur, prev *tree.Node, d int) []int
+	below = func(cur, prev *tree.Node, d int) []int {
+		if i, ok := index[cur]; ok {
+			return []int{i}
+		}
+		result := make([]int, 0)
+		for _, n := range cur.Neigh() {
+			if n == prev {
+				continue
+			}
+			sub := below(n, cur, d+1)
+			for _, i := range result {
+				for _, j := range sub {
+					depth[i][j], depth[j][i] = d, d
+				}
+			}
+			result = append(result, sub...)
+		}
+		return result
+	}
+	below(xTip.Neigh()[0], xTip, 0)
+	return xTip, leaves, depth
+}
+
+// Grafts new tip named taxon onto the network edge corresponding to the edge
+// above (non-root) backbone node v; if the edge is split by reticulations, the
+// tip goes on the topmost part
+func graftOnNetwork(ntw *tree.Tree, td *gr.TreeData, leafIDs map[string]int, v int, taxon string) error {
+	target := leafsetKey(td.IdToNodes[v], parentOf(td.IdToNodes[v]), leafIDs)
+	var node *tree.Node
+	ntw.PreOrder(func(cur, prev *tree.Node, e *tree.Edge) bool {
+		if node == nil && leafsetKey(cur, prev, leafIDs) == target {
+			node = cur
+		}
+		return node == nil
+	})
+	if node == nil {
+		return fmt.Errorf("could not find network edge for backbone clade %s", target)
+	}
+	tip := ntw.NewNode()
+	tip.SetName(taxon)
+	edge, err := node.ParentEdge()
+	if err != nil {
+		return err
+	}
+	_, _, graft, err := ntw.GraftTipOnEdge(tip, edge)
+	if err != nil {
+		return err
+	}
+	for _, e := range graft.Edges() { // grafting splits and sets lengths
+		e.SetLength(tree.NIL_LENGTH)
+	}
+	return nil
+}
+
+func parentOf(n *tree.Node) *tree.Node {
+	p, err := n.Parent()
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// Sorted backbone leaves below cur, coming from prev (ignoring reticulation
+// leaves and placed taxa), formatted like TreeData.LeafsetAsString
+func leafsetKey(cur, prev *tree.Node, leafIDs map[string]int) string {
+	names := make([]string, 0)
+	var collect func(cur, prev *tree.Node)
+	collect = func(cur, prev *tree.Node) {
+		if _, ok := leafIDs[cur.Name()]; ok && cur.Tip() {
+			names = append(names, cur.Name())
+		}
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				collect(n, cur)
+			}
+		}
+	}
+	collect(cur, prev)
+	slices.Sort(names)
+	return "{" + strings.Join(names, ",") + "}"
+}
@@ -0,0 +1,47 @@
+package infer
+
+import (
+	"context"
+	"io"
+	"log"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+// Rescores branches with the quartet filter at each threshold of
+// opts.ThresholdSweep, filtering a copy of the unfiltered counts each time
+// instead of reading the gene trees again. Scores are the percent of quartets
+// satisfied by each branch on its own (see ScoreBranchSet).
+func thresholdSweep(ctx context.Context, counts *pr.QuartetCounts, branches []gr.Branch, opts InferOptions) ([]pr.SweepScores, error) {
+	scores := make([]pr.SweepScores, len(branches))
+	for i, br := range branches {
+		scores[i] = pr.SweepScores{Branch: br, Percent: make([]float64, len(opts.ThresholdSweep))}
+	}
+	asSet := countsAsSet(opts)
+	lout := log.Writer()
+	log.SetOutput(io.Discard) // the filter and tree data logs are the same for every threshold
+	defer log.SetOutput(lout)
+	for j, t := range opts.ThresholdSweep {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		qOpts, err := opts.QuartetOpts.WithThreshold(t)
+		if err != nil {
+			return nil, err
+		}
+		td, _, err := counts.Clone().TreeData(qOpts)
+		if err != nil {
+			return nil, err
+		}
+		for i, br := range branches {
+			satisfied, err := sc.TotalSatQuartets([]gr.Branch{br}, td, asSet)
+			if err != nil {
+				return nil, err
+			}
+			scores[i].Percent[j] = sc.PercentOfQuartets(satisfied, td, asSet)
+		}
+	}
+	return scores, nil
+}
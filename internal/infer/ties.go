@@ -0,0 +1,156 @@
+package infer
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+// How the dp chooses between edges with exactly the same score. Either way the
+// choice only depends on the constraint tree, the scores, and the seed, so
+// reruns give the same network.
+type TieBreak int
+
+const (
+	TieShortest TieBreak = iota // shorter cycle first, then deeper donor, then lower donor node id, then lower hybrid node id
+	TieSeeded                   // a random order of the edges drawn from InferOptions.Seed
+)
+
+var ParseTieBreak = map[string]TieBreak{
+	"shortest": TieShortest,
+	"seeded":   TieSeeded,
+}
+
+func (tb *TieBreak) Set(s string) error {
+	if mode, ok := ParseTieBreak[s]; ok {
+		*tb = mode
+		return nil
+	}
+	return fmt.Errorf("\"%s\" is not a valid tie-break policy", s)
+}
+
+func (tb TieBreak) String() string {
+	for s, t := range ParseTieBreak {
+		if t == tb {
+			return s
+		}
+	}
+	panic(fmt.Sprintf("invalid tie-break policy %d", int(tb)))
+}
+
+// Whether an edge with score beats the best edge found so far (nil if none).
+// Scores are only tied if they are exactly equal.
+func (dp *DP[S]) better(score S, br gr.Branch, best S, bestTrace *cycleTrace) bool {
+	if bestTrace == nil || score > best {
+		return true
+	}
+	return score == best && dp.breaksTie(br, bestTrace.branch)
+}
+
+// Whether br1 is preferred to br2 when they score the same
+func (dp *DP[S]) breaksTie(br1, br2 gr.Branch) bool {
+	switch dp.TieBreak {
+	case TieShortest:
+		len1 := sc.CycleLength(br1.IDs[gr.Ui], br1.IDs[gr.Wi], dp.Tree)
+		len2 := sc.CycleLength(br2.IDs[gr.Ui], br2.IDs[gr.Wi], dp.Tree)
+		if len1 != len2 {
+			return len1 < len2
+		}
+		depth1, depth2 := dp.Tree.Depths[br1.IDs[gr.Ui]], dp.Tree.Depths[br2.IDs[gr.Ui]]
+		if depth1 != depth2 {
+			return depth1 > depth2
+		}
+		if br1.IDs[gr.Ui] != br2.IDs[gr.Ui] {
+			return br1.IDs[gr.Ui] < br2.IDs[gr.Ui]
+		}
+		return br1.IDs[gr.Wi] < br2.IDs[gr.Wi]
+	case TieSeeded:
+		return dp.tieKey(br1) < dp.tieKey(br2)
+	default:
+		panic(fmt.Sprintf("invalid tie-break policy %d", int(dp.TieBreak)))
+	}
+}
+
+// Position of br in the random order of edges for dp.Seed (splitmix64 of the
+// seed and edge, so it doesn't depend on the order edges are scored in)
+func (dp *DP[S]) tieKey(br gr.Branch) uint64 {
+	x := dp.Seed ^ uint64(br.IDs[gr.Ui]*dp.NumNodes+br.IDs[gr.Wi])*0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Edges scoring the same as the best edge, kept while scoring candidates if
+// dp.keepTies()
+type tieSet []gr.Branch
+
+// Whether edges tied with the best edge are kept (for logging or enumerating)
+func (dp *DP[S]) keepTies() bool {
+	return dp.ReportTies || dp.Enumerate > 0
+}
+
+// Updates ties with candidates (edges all scoring score), where best is the
+// best score before them (ignored if first)
+func addTies[S sc.Score](ties tieSet, candidates []gr.Branch, score, best S, first bool) tieSet {
+	switch {
+	case first || score > best:
+		return append(tieSet(nil), candidates...)
+	case score == best:
+		return append(ties, candidates...)
+	}
+	return ties
+}
+
+// Sets the ties of the chosen edge to every other edge in ts
+func (ts tieSet) record(chosen *cycleTrace) {
+	chosen.ties = nil
+	for _, br := range ts {
+		if br != chosen.branch && !slices.Contains(chosen.ties, br) {
+			chosen.ties = append(chosen.ties, br)
+		}
+	}
+	slices.SortFunc(chosen.ties, func(br1, br2 gr.Branch) int {
+		return cmp.Or(cmp.Compare(br1.IDs[gr.Ui], br2.IDs[gr.Ui]), cmp.Compare(br1.IDs[gr.Wi], br2.IDs[gr.Wi]))
+	})
+}
+
+// Branches of the optimal network with k edges that had other edges scoring
+// exactly the same when they were chosen, mapped to those edges
+func (dp *DP[S]) coOptimal(k int) map[gr.Branch][]gr.Branch {
+	ties := make(map[gr.Branch][]gr.Branch)
+	for _, c := range dp.Traceback[dp.Tree.Root().Id()][k].cycles() {
+		if len(c.ties) > 0 {
+			ties[c.branch] = c.ties
+		}
+	}
+	return ties
+}
+
+// Logs the co-optimal edges of the network with k edges
+func (dp *DP[S]) logTies(k int, branches []gr.Branch) {
+	ties := dp.coOptimal(k)
+	if len(ties) == 0 {
+		lg.Infof("k = %d: no ties, every branch was the only best choice", k)
+		return
+	}
+	lg.Infof("k = %d: %d of %d branches tied with other edges; this network is one of several equally good ones", k, len(ties), len(branches))
+	for _, br := range branches {
+		if others, ok := ties[br]; ok {
+			names := make([]string, len(others))
+			for i, o := range others {
+				names[i] = dp.branchString(o)
+			}
+			lg.Debugf("k = %d: chose %s over %s (tie-break %s)", k, dp.branchString(br), strings.Join(names, ", "), dp.TieBreak)
+		}
+	}
+}
+
+func (dp *DP[S]) branchString(br gr.Branch) string {
+	u, w := dp.Tree.IdToNodes[br.IDs[gr.Ui]], dp.Tree.IdToNodes[br.IDs[gr.Wi]]
+	return dp.Tree.LeafsetAsString(u) + " -> " + dp.Tree.LeafsetAsString(w)
+}
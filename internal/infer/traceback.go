@@ -1,10 +1,41 @@
 package infer
 
-import gr "github.com/jsdoublel/camus/internal/graphs"
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
 
 // traceback for node v if there is not an edge (stored in DP.Traceback struct field)
 type trace interface {
-	traceback() []gr.Branch // returns all branches in subnetwork
+	cycles() []*cycleTrace                            // returns the cycles of all branches in subnetwork
+	enumerate(limit int, memo enumMemo) [][]gr.Branch // returns up to limit distinct co-optimal branch sets of subnetwork
+}
+
+// enumerated branch sets of each trace (and cycleTraceNode), since subproblems
+// are shared by the options of many others
+type enumMemo map[any][][]gr.Branch
+
+// Returns memo[key], calling f to fill it in if it isn't there
+func (memo enumMemo) get(key any, f func() [][]gr.Branch) [][]gr.Branch {
+	if sets, ok := memo[key]; ok {
+		return sets
+	}
+	sets := f()
+	memo[key] = sets
+	return sets
+}
+
+// Returns all branches in the subnetwork of tr
+func traceBranches(tr trace) []gr.Branch {
+	cycles := tr.cycles()
+	branches := make([]gr.Branch, len(cycles))
+	for i, c := range cycles {
+		branches[i] = c.branch
+	}
+	return branches
 }
 
 // traceback if there isn't a cycle
@@ -12,27 +43,51 @@ type noCycleTrace struct {
 	prevs [2]*trace // previous subproblems
 }
 
-func (tr *noCycleTrace) traceback() []gr.Branch {
+func (tr *noCycleTrace) cycles() []*cycleTrace {
 	if tr.prevs[0] == nil {
-		return []gr.Branch{}
+		return []*cycleTrace{}
 	}
-	return append((*tr.prevs[0]).traceback(), (*tr.prevs[1]).traceback()...)
+	return append((*tr.prevs[0]).cycles(), (*tr.prevs[1]).cycles()...)
+}
+
+func (tr *noCycleTrace) enumerate(limit int, memo enumMemo) [][]gr.Branch {
+	if tr.prevs[0] == nil {
+		return [][]gr.Branch{{}}
+	}
+	return memo.get(tr, func() [][]gr.Branch {
+		return combine((*tr.prevs[0]).enumerate(limit, memo), (*tr.prevs[1]).enumerate(limit, memo), limit)
+	})
 }
 
 // stores backtrace information along cycle
 type cycleTraceNode struct {
-	sib *trace          // sibling node trace
-	p   *cycleTraceNode // parent node trace
+	sib    *trace            // sibling node trace
+	p      *cycleTraceNode   // parent node trace
+	others []*cycleTraceNode // other splits along the path with the same score (only kept when enumerating)
 }
 
-func (tr *cycleTraceNode) traceUp() []gr.Branch {
-	result := (*tr.sib).traceback()
+func (tr *cycleTraceNode) traceUp() []*cycleTrace {
+	result := (*tr.sib).cycles()
 	if tr.p != nil {
 		result = append(result, tr.p.traceUp()...)
 	}
 	return result
 }
 
+func (tr *cycleTraceNode) enumerateUp(limit int, memo enumMemo) [][]gr.Branch {
+	return memo.get(tr, func() [][]gr.Branch {
+		var sets [][]gr.Branch
+		for _, node := range append([]*cycleTraceNode{tr}, tr.others...) {
+			nodeSets := (*node.sib).enumerate(limit, memo)
+			if node.p != nil {
+				nodeSets = combine(nodeSets, node.p.enumerateUp(limit, memo), limit)
+			}
+			sets = union(sets, nodeSets, limit)
+		}
+		return sets
+	})
+}
+
 // stores traceback info for node v in there is a cycle
 type cycleTrace struct {
 	pathW      *cycleTraceNode // beginning of linked-list w path towards v
@@ -40,12 +95,13 @@ type cycleTrace struct {
 	wDownTrace *trace          // trace below w
 	uDownTrace *trace          // trace below u
 	branch     gr.Branch       // branch forming cycle
+	ties       []gr.Branch     // other branches that would have scored the same (only with DP.ReportTies)
 }
 
-func (tr *cycleTrace) traceback() []gr.Branch {
-	result := append((*tr.wDownTrace).traceback(), tr.branch)
+func (tr *cycleTrace) cycles() []*cycleTrace {
+	result := append((*tr.wDownTrace).cycles(), tr)
 	if tr.uDownTrace != nil {
-		result = append(result, (*tr.uDownTrace).traceback()...)
+		result = append(result, (*tr.uDownTrace).cycles()...)
 	}
 	if tr.pathU != nil {
 		result = append(result, tr.pathU.traceUp()...)
@@ -55,3 +111,76 @@ func (tr *cycleTrace) traceback() []gr.Branch {
 	}
 	return result
 }
+
+func (tr *cycleTrace) enumerate(limit int, memo enumMemo) [][]gr.Branch {
+	return memo.get(tr, func() [][]gr.Branch {
+		sets := combine((*tr.wDownTrace).enumerate(limit, memo), [][]gr.Branch{{tr.branch}}, limit)
+		if tr.uDownTrace != nil {
+			sets = combine(sets, (*tr.uDownTrace).enumerate(limit, memo), limit)
+		}
+		if tr.pathU != nil {
+			sets = combine(sets, tr.pathU.enumerateUp(limit, memo), limit)
+		}
+		if tr.pathW != nil {
+			sets = combine(sets, tr.pathW.enumerateUp(limit, memo), limit)
+		}
+		return sets
+	})
+}
+
+// co-optimal traces of a subproblem, the first being the one chosen (only kept
+// when enumerating)
+type choiceTrace struct {
+	options []trace
+}
+
+func (tr *choiceTrace) cycles() []*cycleTrace {
+	return tr.options[0].cycles()
+}
+
+func (tr *choiceTrace) enumerate(limit int, memo enumMemo) [][]gr.Branch {
+	return memo.get(tr, func() [][]gr.Branch {
+		var sets [][]gr.Branch
+		for _, option := range tr.options {
+			sets = union(sets, option.enumerate(limit, memo), limit)
+		}
+		return sets
+	})
+}
+
+// Every combination of a set from sets1 and a set from sets2 (branches of the
+// two are in different parts of the network, so they are all distinct), up to
+// limit
+func combine(sets1, sets2 [][]gr.Branch, limit int) [][]gr.Branch {
+	result := make([][]gr.Branch, 0, min(limit, len(sets1)*len(sets2)))
+	for _, s1 := range sets1 {
+		for _, s2 := range sets2 {
+			if len(result) == limit {
+				return result
+			}
+			result = append(result, slices.Concat(s1, s2))
+		}
+	}
+	return result
+}
+
+// Sets in sets1 or sets2, without duplicates, up to limit
+func union(sets1, sets2 [][]gr.Branch, limit int) [][]gr.Branch {
+	seen := make(map[string]bool, len(sets1)+len(sets2))
+	result := make([][]gr.Branch, 0, min(limit, len(sets1)+len(sets2)))
+	for _, set := range slices.Concat(sets1, sets2) {
+		if key := branchSetKey(set); !seen[key] && len(result) < limit {
+			seen[key] = true
+			result = append(result, set)
+		}
+	}
+	return result
+}
+
+func branchSetKey(set []gr.Branch) string {
+	sorted := slices.Clone(set)
+	slices.SortFunc(sorted, func(br1, br2 gr.Branch) int {
+		return cmp.Or(cmp.Compare(br1.IDs[gr.Ui], br2.IDs[gr.Ui]), cmp.Compare(br1.IDs[gr.Wi], br2.IDs[gr.Wi]))
+	})
+	return fmt.Sprint(sorted)
+}
@@ -0,0 +1,160 @@
+// Package logging is a leveled logger on top of the standard library log
+// package. Messages are still written with log.Printf (so log.SetOutput and
+// log.SetFlags decide where they go and how they look), with their level
+// marked in the text so that writers can filter them (see MessageLevel).
+// Messages more verbose than the level set with SetLevel are not formatted at
+// all, so debug and trace messages cost little when they are off.
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Verbosity of log messages, from least to most verbose
+type Level int32
+
+const (
+	None Level = iota
+	Error
+	Warn
+	Info
+	Debug
+	Trace
+)
+
+var ParseLevel = map[string]Level{
+	"none":  None,
+	"error": Error,
+	"warn":  Warn,
+	"info":  Info,
+	"debug": Debug,
+	"trace": Trace,
+}
+
+// Text marking the level of messages; info messages are not marked
+const (
+	ErrorMessage = "camus encountered an error ::"
+	warnPrefix   = "WARNING: "
+	debugPrefix  = "DEBUG: "
+	tracePrefix  = "TRACE: "
+)
+
+func (l Level) String() string {
+	for k, v := range ParseLevel {
+		if v == l {
+			return k
+		}
+	}
+	panic(fmt.Sprintf("invalid log level %d", int(l)))
+}
+
+// Implements flag.Value interface
+func (l *Level) Set(s string) error {
+	level, ok := ParseLevel[s]
+	if !ok {
+		return fmt.Errorf("\"%s\" is not a valid log level: valid levels are \"none\", \"error\", \"warn\", \"info\", \"debug\", and \"trace\"", s)
+	}
+	*l = level
+	return nil
+}
+
+var level atomic.Int32
+
+func init() {
+	level.Store(int32(Info))
+}
+
+// Sets the most verbose level of messages that are logged (Info by default)
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// Whether messages at level l are logged
+func Enabled(l Level) bool {
+	return l != None && l <= Level(level.Load())
+}
+
+// Logs an error, after ErrorMessage
+func Errorf(format string, v ...any) {
+	if Enabled(Error) {
+		log.Printf(ErrorMessage+" "+format, v...)
+	}
+}
+
+// Logs a warning, after "WARNING: "
+func Warnf(format string, v ...any) {
+	if Enabled(Warn) {
+		log.Printf(warnPrefix+format, v...)
+	}
+}
+
+// Logs progress of a run
+func Infof(format string, v ...any) {
+	if Enabled(Info) {
+		log.Printf(format, v...)
+	}
+}
+
+// Logs details that help when looking into a run, after "DEBUG: "
+func Debugf(format string, v ...any) {
+	if Enabled(Debug) {
+		log.Printf(debugPrefix+format, v...)
+	}
+}
+
+// Logs fine grained steps (e.g., each dp vertex), after "TRACE: "
+func Tracef(format string, v ...any) {
+	if Enabled(Trace) {
+		log.Printf(tracePrefix+format, v...)
+	}
+}
+
+// Level of a single log message (a line written by the log package, possibly
+// after a timestamp)
+func MessageLevel(msg []byte) Level {
+	switch {
+	case bytes.Contains(msg, []byte(ErrorMessage)):
+		return Error
+	case bytes.Contains(msg, []byte("WARNING")):
+		return Warn
+	case bytes.Contains(msg, []byte(tracePrefix)):
+		return Trace
+	case bytes.Contains(msg, []byte(debugPrefix)):
+		return Debug
+	default:
+		return Info
+	}
+}
+
+// Message without its log package prefix (timestamp) or level marker, and its
+// level. The prefix is everything before the first marker, or the date and
+// time written with log.LstdFlags|log.Lmicroseconds for info messages.
+func SplitMessage(line []byte) (Level, string) {
+	line = bytes.TrimRight(line, "\n")
+	l := MessageLevel(line)
+	marker := map[Level]string{Error: ErrorMessage + " ", Warn: "WARNING", Debug: debugPrefix, Trace: tracePrefix}[l]
+	if i := bytes.Index(line, []byte(marker)); marker != "" && i >= 0 {
+		msg := bytes.TrimPrefix(line[i+len(marker):], []byte(":"))
+		return l, string(bytes.TrimLeft(msg, " "))
+	}
+	return l, string(stripTimestamp(line))
+}
+
+// Removes a "2006/01/02 15:04:05.000000 " timestamp from the start of line
+func stripTimestamp(line []byte) []byte {
+	const layout = "0000/00/00 00:00:00"
+	if len(line) < len(layout) || line[4] != '/' || line[7] != '/' || line[10] != ' ' || line[13] != ':' {
+		return line
+	}
+	end := len(layout)
+	if end < len(line) && line[end] == '.' {
+		end++
+		for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+			end++
+		}
+	}
+	return bytes.TrimLeft(line[end:], " ")
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+		SetLevel(Info)
+	}()
+	testCases := []struct {
+		name     string
+		level    Level
+		expected string
+	}{
+		{name: "none", level: None, expected: ""},
+		{name: "warn", level: Warn, expected: ErrorMessage + " e\nWARNING: w\n"},
+		{name: "info", level: Info, expected: ErrorMessage + " e\nWARNING: w\ni\n"},
+		{name: "trace", level: Trace, expected: ErrorMessage + " e\nWARNING: w\ni\nDEBUG: d\nTRACE: t\n"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			buf.Reset()
+			SetLevel(test.level)
+			Errorf("%s", "e")
+			Warnf("w")
+			Infof("i")
+			Debugf("d")
+			Tracef("t")
+			if buf.String() != test.expected {
+				t.Errorf("got %q, expected %q", buf.String(), test.expected)
+			}
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	testCases := []struct {
+		name  string
+		line  string
+		level Level
+		msg   string
+	}{
+		{name: "info", line: "2026/10/18 05:33:46.602861 running infer...\n", level: Info, msg: "running infer..."},
+		{name: "no timestamp", line: "running infer...\n", level: Info, msg: "running infer..."},
+		{name: "warning", line: "2026/10/18 05:33:46.602861 WARNING: missing taxa\n", level: Warn, msg: "missing taxa"},
+		{name: "error", line: "2026/10/18 05:33:46 " + ErrorMessage + " bad file\n", level: Error, msg: "bad file"},
+		{name: "debug", line: "DEBUG: calculating edge scores\n", level: Debug, msg: "calculating edge scores"},
+		{name: "trace", line: "2026/10/18 05:33:46.602861 TRACE: solved vertex 2\n", level: Trace, msg: "solved vertex 2"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			level, msg := SplitMessage([]byte(test.line))
+			if level != test.level || msg != test.msg {
+				t.Errorf("got (%s, %q), expected (%s, %q)", level, msg, test.level, test.msg)
+			}
+		})
+	}
+}
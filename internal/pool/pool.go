@@ -0,0 +1,134 @@
+// Package implementing a work-stealing pool for running independent tasks in
+// parallel. Tasks are identified by their index, and are initially divided
+// into contiguous blocks (one per worker). Workers take tasks from the back of
+// their own block and, once it is empty, steal half of the remaining tasks
+// from the front of another worker's block. This keeps all workers busy even
+// when a few tasks dominate the runtime (e.g., tasks corresponding to large
+// subtrees of an unbalanced tree).
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Block of task indices [lo, hi) owned by a worker
+type block struct {
+	mu sync.Mutex
+	lo int
+	hi int
+}
+
+// Takes task from the back of the block
+func (b *block) pop() (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lo >= b.hi {
+		return 0, false
+	}
+	b.hi--
+	return b.hi, true
+}
+
+// Removes half of the remaining tasks (rounded up) from the front of the block
+func (b *block) stealHalf() (lo, hi int, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	remaining := b.hi - b.lo
+	if remaining <= 0 {
+		return 0, 0, false
+	}
+	lo, hi = b.lo, b.lo+(remaining+1)/2
+	b.lo = hi
+	return lo, hi, true
+}
+
+func (b *block) set(lo, hi int) {
+	b.mu.Lock()
+	b.lo, b.hi = lo, hi
+	b.mu.Unlock()
+}
+
+// Runs task(i) for every i in [0, n) using at most nprocs goroutines, and
+// returns once all tasks have finished. Tasks must be safe to run concurrently.
+func Run(n, nprocs int, task func(i int)) {
+	workers := min(nprocs, n)
+	if workers <= 1 {
+		for i := range n {
+			task(i)
+		}
+		return
+	}
+	blocks := make([]block, workers)
+	for w := range workers {
+		blocks[w].lo, blocks[w].hi = w*n/workers, (w+1)*n/workers
+	}
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if i, ok := blocks[w].pop(); ok {
+					task(i)
+				} else if !steal(blocks, w) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Worker w steals tasks from the first other worker that has some; returns
+// false if there is no work left to steal
+func steal(blocks []block, w int) bool {
+	for offset := 1; offset < len(blocks); offset++ {
+		victim := &blocks[(w+offset)%len(blocks)]
+		if lo, hi, ok := victim.stealHalf(); ok {
+			blocks[w].set(lo, hi)
+			return true
+		}
+	}
+	return false
+}
+
+// Runs task(i) for every i in [0, n) using at most nprocs goroutines, where
+// parent[i] is the task that can't start until task i has finished (-1 if
+// none), and n = len(parent). For the nodes of a tree this runs each node
+// after its children, with sibling subtrees running in parallel. Returns once
+// all tasks have finished.
+func RunTree(parent []int, nprocs int, task func(i int)) {
+	n := len(parent)
+	waiting := make([]atomic.Int32, n) // unfinished children of each task
+	for _, p := range parent {
+		if p >= 0 {
+			waiting[p].Add(1)
+		}
+	}
+	ready := make(chan int, n)
+	for i := range n {
+		if waiting[i].Load() == 0 {
+			ready <- i
+		}
+	}
+	var remaining atomic.Int64
+	remaining.Store(int64(n))
+	var wg sync.WaitGroup
+	for range min(max(nprocs, 1), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ready {
+				task(i)
+				if p := parent[i]; p >= 0 && waiting[p].Add(-1) == 0 {
+					ready <- p
+				}
+				if remaining.Add(-1) == 0 {
+					close(ready)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
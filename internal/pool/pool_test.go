@@ -0,0 +1,89 @@
+package pool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name   string
+		n      int
+		nprocs int
+	}{
+		{name: "no tasks", n: 0, nprocs: 4},
+		{name: "sequential", n: 10, nprocs: 1},
+		{name: "more workers than tasks", n: 3, nprocs: 8},
+		{name: "parallel", n: 1000, nprocs: 4},
+		{name: "zero procs", n: 5, nprocs: 0},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			counts := make([]int32, test.n)
+			Run(test.n, test.nprocs, func(i int) {
+				atomic.AddInt32(&counts[i], 1)
+			})
+			for i, c := range counts {
+				if c != 1 {
+					t.Errorf("task %d ran %d times, expected once", i, c)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_Imbalanced(t *testing.T) {
+	var running, maxRunning int32
+	Run(64, 4, func(i int) {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			prev := atomic.LoadInt32(&maxRunning)
+			if cur <= prev || atomic.CompareAndSwapInt32(&maxRunning, prev, cur) {
+				break
+			}
+		}
+		if i < 16 { // all expensive tasks are initially assigned to the first worker
+			time.Sleep(2 * time.Millisecond)
+		}
+		atomic.AddInt32(&running, -1)
+	})
+	if maxRunning < 2 {
+		t.Errorf("expected expensive tasks to be stolen and run concurrently, max concurrent tasks %d", maxRunning)
+	}
+}
+
+func TestRunTree(t *testing.T) {
+	testCases := []struct {
+		name   string
+		parent []int
+		nprocs int
+	}{
+		{name: "no tasks", parent: []int{}, nprocs: 4},
+		{name: "single task", parent: []int{-1}, nprocs: 4},
+		{name: "sequential", parent: []int{-1, 0, 0, 1, 1, 2, 2}, nprocs: 1},
+		{name: "balanced", parent: []int{-1, 0, 0, 1, 1, 2, 2}, nprocs: 4},
+		{name: "caterpillar", parent: []int{-1, 0, 0, 2, 2, 4, 4, 6, 6}, nprocs: 4},
+		{name: "forest", parent: []int{-1, -1, 0, 0, 1, 1}, nprocs: 3},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			counts := make([]int32, len(test.parent))
+			done := make([]atomic.Bool, len(test.parent))
+			RunTree(test.parent, test.nprocs, func(i int) {
+				for c, p := range test.parent {
+					if p == i && !done[c].Load() {
+						t.Errorf("task %d started before its child %d finished", i, c)
+					}
+				}
+				atomic.AddInt32(&counts[i], 1)
+				done[i].Store(true)
+			})
+			for i, c := range counts {
+				if c != 1 {
+					t.Errorf("task %d ran %d times, expected once", i, c)
+				}
+			}
+		})
+	}
+}
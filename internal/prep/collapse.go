@@ -0,0 +1,154 @@
+package prep
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+)
+
+// Fewest taxa the constraint tree is collapsed down to
+const minCollapsedTaxa = 4
+
+// Finds taxa that are sisters in the constraint tree and in every gene tree that
+// contains both of them, and collapses each group to one representative (the
+// first name alphabetically), pruning the others from the constraint tree and
+// gene trees in place. Gene trees that only contain a collapsed taxon have it
+// renamed to its representative. Repeats until nothing changes, so groups can
+// be larger than two. Returns the taxa collapsed into each representative.
+func CollapseIdenticalTaxa(tre *tree.Tree, geneTrees *GeneTrees) (map[string][]string, error) {
+	collapsed := make(map[string][]string)
+	for {
+		pairs := identicalCherries(tre, geneTrees.Trees)
+		if len(pairs) == 0 {
+			break
+		}
+		drop := make([]string, len(pairs))
+		for i, p := range pairs {
+			drop[i] = p[1]
+			collapsed[p[0]] = append(collapsed[p[0]], p[1])
+			collapsed[p[0]] = append(collapsed[p[0]], collapsed[p[1]]...)
+			delete(collapsed, p[1])
+		}
+		if err := tre.RemoveTips(false, drop...); err != nil {
+			return nil, fmt.Errorf("%w, error collapsing constraint tree: %s", ErrInvalidFile, err.Error())
+		}
+		for i, gt := range geneTrees.Trees {
+			if err := collapseGeneTree(gt, pairs); err != nil {
+				return nil, fmt.Errorf("%w, error collapsing gene tree %s: %s", ErrInvalidFile, geneTrees.Names[i], err.Error())
+			}
+		}
+	}
+	nCollapsed := 0
+	for rep := range collapsed {
+		slices.Sort(collapsed[rep])
+		nCollapsed += len(collapsed[rep])
+	}
+	lg.Infof("collapsed %d taxa identical across gene trees into %d representatives", nCollapsed, len(collapsed))
+	return collapsed, nil
+}
+
+// Cherries of the constraint tree whose taxa are also a cherry in every gene
+// tree containing both (and appear together in at least one). Pairs are
+// returned as {representative, collapsed taxon}.
+func identicalCherries(tre *tree.Tree, geneTrees []*tree.Tree) [][2]string {
+	tips := tre.Tips()
+	siblings := make(map[*tree.Node][]string) // tips below each parent
+	for _, tip := range tips {
+		p := tip.Neigh()[0]
+		siblings[p] = append(siblings[p], tip.Name())
+	}
+	pairs := make([][2]string, 0)
+	for _, tip := range tips {
+		if names := siblings[tip.Neigh()[0]]; len(names) == 2 && names[0] == tip.Name() {
+			pairs = append(pairs, [2]string{min(names[0], names[1]), max(names[0], names[1])})
+		}
+	}
+	// each pair removes one taxon
+	pairs = pairs[:min(len(pairs), max(len(tips)-minCollapsedTaxa, 0))]
+	together := make([]int, len(pairs))
+	identical := make([]bool, len(pairs))
+	for i := range identical {
+		identical[i] = true
+	}
+	for _, gt := range geneTrees {
+		gtTips := make(map[string]*tree.Node)
+		for _, tip := range gt.Tips() {
+			gtTips[tip.Name()] = tip
+		}
+		if len(gtTips) < 4 {
+			continue
+		}
+		for i, p := range pairs {
+			a, okA := gtTips[p[0]]
+			b, okB := gtTips[p[1]]
+			if !okA || !okB {
+				continue
+			}
+			together[i]++
+			if !isCherry(a, b) {
+				identical[i] = false
+			}
+		}
+	}
+	result := make([][2]string, 0)
+	for i, p := range pairs {
+		if identical[i] && together[i] > 0 {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// True if tips a and b are separated from the rest of the tree by one edge
+func isCherry(a, b *tree.Node) bool {
+	p := a.Neigh()[0]
+	return p == b.Neigh()[0] && p.Nneigh() == 3
+}
+
+// Removes the second taxon of each pair from the gene tree, or renames it to the
+// first if the first is not in the gene tree
+func collapseGeneTree(gt *tree.Tree, pairs [][2]string) error {
+	gtTips := make(map[string]*tree.Node)
+	for _, tip := range gt.Tips() {
+		gtTips[tip.Name()] = tip
+	}
+	drop := make([]string, 0)
+	for _, p := range pairs {
+		b, ok := gtTips[p[1]]
+		if !ok {
+			continue
+		}
+		if _, ok := gtTips[p[0]]; ok {
+			drop = append(drop, p[1])
+		} else {
+			b.SetName(p[0])
+		}
+	}
+	if len(drop) != 0 {
+		if err := gt.RemoveTips(false, drop...); err != nil {
+			return err
+		}
+	}
+	return gt.UpdateTipIndex()
+}
+
+// Replaces each representative leaf in the network with a polytomy of the
+// representative and the taxa collapsed into it. Tip indexes are not updated,
+// since reticulation labels appear on more than one leaf.
+func ExpandCollapsedTaxa(ntw *tree.Tree, collapsed map[string][]string) {
+	for _, tip := range ntw.Tips() {
+		taxa, ok := collapsed[tip.Name()]
+		if !ok {
+			continue
+		}
+		for _, name := range append([]string{tip.Name()}, taxa...) {
+			leaf := ntw.NewNode()
+			leaf.SetName(name)
+			ntw.ConnectNodes(tip, leaf)
+		}
+		tip.SetName("")
+	}
+}
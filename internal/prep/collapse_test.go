@@ -0,0 +1,83 @@
+package prep
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+func TestCollapseIdenticalTaxa(t *testing.T) {
+	testCases := []struct {
+		name      string
+		tre       string
+		geneTrees []string
+		collapsed map[string][]string
+		expTree   string
+		expGenes  []string
+	}{
+		{
+			name:      "basic",
+			tre:       "((((A,B),C),(D,E)),(F,(G,H)));",
+			geneTrees: []string{"(((A,B),C),(D,E),(F,(G,H)));", "((B,A),(E,C),(D,(F,H)));", "((B,C),(E,D),H);"},
+			collapsed: map[string][]string{"A": {"B"}, "G": {"H"}},
+			expTree:   "(((C,A),(D,E)),(F,G));",
+			expGenes:  []string{"((C,A),(D,E),(F,G));", "((E,C),(D,(F,G)),A);", "((A,C),(E,D),G);"},
+		},
+		{
+			name:      "discordant",
+			tre:       "((((A,B),C),(D,E)),(F,(G,H)));",
+			geneTrees: []string{"(((A,C),B),(D,E),(F,(G,H)));", "((B,A),(E,C),(D,(F,G)));"},
+			// F and G become sisters in every gene tree once H is collapsed
+			collapsed: map[string][]string{"F": {"G", "H"}},
+			expTree:   "((((A,B),C),(D,E)),F);",
+		},
+		{
+			name:      "nested",
+			tre:       "((((A,B),C),D),(E,F));",
+			geneTrees: []string{"((((A,B),C),D),(E,F));", "(((C,(B,A)),E),F);"},
+			collapsed: map[string][]string{"A": {"B", "C"}},
+			expTree:   "((D,A),(E,F));",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader(test.tre)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			geneTrees := &GeneTrees{}
+			for _, nwk := range test.geneTrees {
+				gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+				if err != nil {
+					t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+				}
+				geneTrees.Trees = append(geneTrees.Trees, gt)
+				geneTrees.Names = append(geneTrees.Names, nwk)
+			}
+			collapsed, err := CollapseIdenticalTaxa(tre, geneTrees)
+			if err != nil {
+				t.Fatalf("produced error %+v", err)
+			}
+			if !maps.EqualFunc(collapsed, test.collapsed, slices.Equal) {
+				t.Errorf("collapsed %v, expected %v", collapsed, test.collapsed)
+			}
+			if got := tre.Newick(); got != test.expTree {
+				t.Errorf("got constraint tree %s, expected %s", got, test.expTree)
+			}
+			for i, nwk := range test.expGenes {
+				if got := geneTrees.Trees[i].Newick(); got != nwk {
+					t.Errorf("got gene tree %s, expected %s", got, nwk)
+				}
+			}
+			ExpandCollapsedTaxa(tre, collapsed)
+			for _, name := range slices.Concat(slices.Collect(maps.Values(test.collapsed))...) {
+				if !strings.Contains(tre.Newick(), name) {
+					t.Errorf("expanded tree %s is missing %s", tre.Newick(), name)
+				}
+			}
+		})
+	}
+}
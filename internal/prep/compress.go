@@ -0,0 +1,82 @@
+package prep
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// Input file that may be decompressed while it is read. Decompression errors
+// are returned by Read, so closing only closes the file.
+type inputFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (f *inputFile) Close() error {
+	return f.file.Close()
+}
+
+// Opens a file for reading, transparently decompressing it if it is gzip or
+// bzip2 compressed. Compression is detected from the first bytes of the file,
+// so it does not depend on the file extension (.gz, .bz2).
+func openInput(path string) (io.ReadCloser, error) {
+	return openInputFile(path, false)
+}
+
+// Opens a file like openInput, reporting how much of it has been read (before
+// decompressing) as the progress of the current phase (see tm.Progress)
+func openInputWithProgress(path string) (io.ReadCloser, error) {
+	return openInputFile(path, true)
+}
+
+func openInputFile(path string, progress bool) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw io.Reader = file
+	if info, err := file.Stat(); progress && err == nil && info.Mode().IsRegular() {
+		raw = &progressReader{r: file, total: info.Size()}
+	}
+	buffered := bufio.NewReader(raw)
+	magic, _ := buffered.Peek(len(bzip2Magic)) // short files just aren't compressed
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("%w, %s is not a valid gzip file: %s", ErrInvalidFormat, path, err.Error())
+		}
+		return &inputFile{Reader: gz, file: file}, nil
+	case bytes.Equal(magic, bzip2Magic):
+		return &inputFile{Reader: bzip2.NewReader(buffered), file: file}, nil
+	default:
+		return &inputFile{Reader: buffered, file: file}, nil
+	}
+}
+
+// Reader that reports the fraction of total bytes read so far as progress
+type progressReader struct {
+	r     io.Reader
+	read  int64
+	total int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.read += int64(n)
+	tm.Progress(int(pr.read), int(pr.total))
+	return n, err
+}
@@ -0,0 +1,217 @@
+package prep
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+const (
+	countCapPrefix         = "capped:"
+	constraintWeightPrefix = "weight:"
+)
+
+// How quartet topologies from the gene trees are counted. In the default raw
+// mode each topology counts once for each gene tree it appears in.
+type CountMode struct {
+	AsSet  bool   // each unique topology counts once, no matter how many gene trees it is in
+	Cap    uint32 // each topology counts at most Cap gene trees (no cap if 0)
+	Length bool   // each topology is weighted by the length of the gene tree branch inducing it (see lengthWeight)
+
+	Mul        MulMode            // how gene trees with more than one copy of a taxon are counted
+	Constraint ConstraintQuartets // how topologies displayed by the constraint tree are counted
+	Provenance bool               // keep the gene trees each topology was counted from (see gr.QuartetProvenance)
+}
+
+// How quartet topologies displayed by the constraint tree are counted. No
+// reticulation can add them, so by default they are dropped; keeping them (at
+// full or reduced weight) leaves the full empirical distribution of quartets
+// for the percent of quartets satisfied and minor frequencies.
+type ConstraintQuartets struct {
+	Weight float64 // fraction of their count that is kept (0 drops them, 1 keeps all of it)
+}
+
+// Parses "drop", "keep", or "weight:X" (0 < X < 1)
+func ParseConstraintQuartets(s string) (ConstraintQuartets, error) {
+	switch {
+	case s == "drop":
+		return ConstraintQuartets{}, nil
+	case s == "keep":
+		return ConstraintQuartets{Weight: 1}, nil
+	case strings.HasPrefix(s, constraintWeightPrefix):
+		w, err := strconv.ParseFloat(strings.TrimPrefix(s, constraintWeightPrefix), 64)
+		if err != nil || !(w > 0 && w < 1) {
+			return ConstraintQuartets{}, fmt.Errorf("\"%s\" is not a valid constraint quartet mode: the weight must be between zero and one", s)
+		}
+		return ConstraintQuartets{Weight: w}, nil
+	default:
+		return ConstraintQuartets{}, fmt.Errorf("\"%s\" is not a valid constraint quartet mode: valid modes are \"drop\", \"keep\", and \"weight:X\"", s)
+	}
+}
+
+// Implements flag.Value interface
+func (c *ConstraintQuartets) Set(s string) error {
+	mode, err := ParseConstraintQuartets(s)
+	if err != nil {
+		return err
+	}
+	*c = mode
+	return nil
+}
+
+func (c ConstraintQuartets) String() string {
+	switch c.Weight {
+	case 0:
+		return "drop"
+	case 1:
+		return "keep"
+	default:
+		return constraintWeightPrefix + strconv.FormatFloat(c.Weight, 'f', -1, 64)
+	}
+}
+
+// Scales the count of each quartet in treeQuartets (those displayed by the
+// constraint tree) by weight, dropping those whose count rounds to zero.
+// Returns the number of quartets kept.
+func weightConstraintQuartets(qCounts, treeQuartets *gr.QuartetTable, weight float64) int {
+	kept := 0
+	for q := range treeQuartets.All() {
+		c := qCounts.Get(q)
+		if c == 0 {
+			continue
+		}
+		if c = uint32(math.Round(float64(c) * weight)); c == 0 {
+			qCounts.Delete(q)
+			continue
+		}
+		qCounts.Set(q, c)
+		kept++
+	}
+	return kept
+}
+
+// Parses "raw", "set", "length", or "capped:N" (N a positive integer)
+func ParseCountMode(s string) (CountMode, error) {
+	switch {
+	case s == "raw":
+		return CountMode{}, nil
+	case s == "set":
+		return CountMode{AsSet: true}, nil
+	case s == "length":
+		return CountMode{Length: true}, nil
+	case strings.HasPrefix(s, countCapPrefix):
+		n, err := strconv.ParseUint(strings.TrimPrefix(s, countCapPrefix), 10, 32)
+		if err != nil || n == 0 {
+			return CountMode{}, fmt.Errorf("\"%s\" is not a valid count mode: the cap must be a positive integer", s)
+		}
+		return CountMode{Cap: uint32(n)}, nil
+	default:
+		return CountMode{}, fmt.Errorf("\"%s\" is not a valid count mode: valid modes are \"raw\", \"set\", \"length\", and \"capped:N\"", s)
+	}
+}
+
+// Implements flag.Value interface
+func (m *CountMode) Set(s string) error {
+	mode, err := ParseCountMode(s)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+func (m CountMode) String() string {
+	switch {
+	case m.AsSet:
+		return "set"
+	case m.Cap != 0:
+		return countCapPrefix + strconv.FormatUint(uint64(m.Cap), 10)
+	case m.Length:
+		return "length"
+	default:
+		return "raw"
+	}
+}
+
+// Number of gene trees in the same units as quartet counts (see
+// WeightedNumGeneTrees), which are scaled by WeightScale in length mode and
+// when the copies in MUL trees are counted
+func (m CountMode) NumGeneTrees(nGeneTrees int, weights []float64) int {
+	n := WeightedNumGeneTrees(nGeneTrees, weights)
+	if m.scaled() && weights == nil {
+		n *= WeightScale
+	}
+	return n
+}
+
+// Number each quartet count is multiplied by: WeightScale if gene trees are
+// weighted or the counts are otherwise scaled (see NumGeneTrees), and 1
+// otherwise. Dividing a count by it gives the (weighted) number of gene trees.
+func (m CountMode) CountScale(weights []float64) int {
+	if m.scaled() || weights != nil {
+		return WeightScale
+	}
+	return 1
+}
+
+// Whether quartet counts are scaled by WeightScale even without gene tree
+// weights
+func (m CountMode) scaled() bool {
+	return m.Length || m.Mul == MulCopies
+}
+
+// Caps the count of each quartet topology at limit gene trees (scaled by
+// WeightScale if weighted), returning the number of topologies capped
+func capQuartetCounts(qCounts *gr.QuartetTable, limit uint32, weighted bool) int {
+	if weighted {
+		limit *= WeightScale
+	}
+	capped := make([]gr.Quartet, 0)
+	for q, c := range qCounts.All() {
+		if c > limit {
+			capped = append(capped, q)
+		}
+	}
+	for _, q := range capped {
+		qCounts.Set(q, limit)
+	}
+	return len(capped)
+}
+
+// Weight of a quartet whose internal branch (the path separating its two pairs
+// of taxa) has the given length in a gene tree whose internal branches have
+// mean length meanLength, scaled by WeightScale. Short branches, which are
+// less likely to be resolved correctly, count for less, and the weight
+// approaches the gene tree weight as the branch gets longer.
+func lengthWeight(length, meanLength, geneWeight float64) uint32 {
+	if meanLength <= 0 {
+		return 0
+	}
+	return uint32(math.Round(geneWeight * WeightScale * (1 - math.Exp(-length/meanLength))))
+}
+
+// Mean length of the internal branches of an unrooted gene tree, returning an
+// error if any of them has no length
+func meanInternalLength(tre *tree.Tree) (float64, error) {
+	var sum float64
+	var n int
+	for _, e := range tre.Edges() {
+		if e.Left().Tip() || e.Right().Tip() {
+			continue
+		}
+		if e.Length() == tree.NIL_LENGTH {
+			return 0, ErrNoBranchLengths
+		}
+		sum += e.Length()
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return sum / float64(n), nil
+}
@@ -0,0 +1,225 @@
+package prep
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestParseCountMode(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected CountMode
+		valid    bool
+	}{
+		{input: "raw", expected: CountMode{}, valid: true},
+		{input: "set", expected: CountMode{AsSet: true}, valid: true},
+		{input: "capped:3", expected: CountMode{Cap: 3}, valid: true},
+		{input: "length", expected: CountMode{Length: true}, valid: true},
+		{input: "capped:0"},
+		{input: "capped:-1"},
+		{input: "capped:"},
+		{input: "capped"},
+		{input: "unique"},
+	}
+	for _, test := range testCases {
+		t.Run(test.input, func(t *testing.T) {
+			mode, err := ParseCountMode(test.input)
+			if (err == nil) != test.valid {
+				t.Fatalf("got error %v, expected valid = %t", err, test.valid)
+			}
+			if !test.valid {
+				return
+			}
+			if mode != test.expected {
+				t.Errorf("got %+v, expected %+v", mode, test.expected)
+			}
+			if mode.String() != test.input {
+				t.Errorf("got string %s, expected %s", mode.String(), test.input)
+			}
+		})
+	}
+}
+
+func TestPreprocess_CountCap(t *testing.T) {
+	nwks := []string{
+		"((A,C),(B,(D,E)));", "((A,C),(B,(D,E)));", "((A,C),(B,(D,E)));", "((A,C),(B,(D,E)));",
+		"((A,D),(B,(C,E)));",
+	}
+	testCases := []struct {
+		name     string
+		weights  []float64
+		countCap uint32
+		expected uint32 // total quartet count not in the constraint tree
+	}{
+		// AC|BD and AC|BE are in four trees, and AD|BC, AD|BE, AD|CE, and
+		// BD|CE are in one tree
+		{name: "raw", expected: 12},
+		{name: "capped", countCap: 2, expected: 8},
+		{name: "capped above counts", countCap: 10, expected: 12},
+		{name: "capped weighted", weights: []float64{1, 1, 1, 1, 0.5}, countCap: 2, expected: 6000},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader("(((A,B),C),(D,E));")).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			gtrees := make([]*tree.Tree, len(nwks))
+			for i, nwk := range nwks {
+				if gtrees[i], err = newick.NewParser(strings.NewReader(nwk)).Parse(); err != nil {
+					t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+				}
+			}
+			td, _, err := Preprocess(context.Background(), tre, gtrees, test.weights, nil, runtime.GOMAXPROCS(0), QuartetFilterOptions{}, 0, CountMode{Cap: test.countCap})
+			if err != nil {
+				t.Fatalf("produced error %+v", err)
+			}
+			if total := td.TotalNumQuartets(); total != test.expected {
+				t.Errorf("got %d quartets, expected %d", total, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseConstraintQuartets(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected float64
+		valid    bool
+	}{
+		{input: "drop", expected: 0, valid: true},
+		{input: "keep", expected: 1, valid: true},
+		{input: "weight:0.25", expected: 0.25, valid: true},
+		{input: "weight:0"},
+		{input: "weight:1"},
+		{input: "weight:1.5"},
+		{input: "weight:"},
+		{input: "delete"},
+	}
+	for _, test := range testCases {
+		t.Run(test.input, func(t *testing.T) {
+			mode, err := ParseConstraintQuartets(test.input)
+			if (err == nil) != test.valid {
+				t.Fatalf("got error %v, expected valid = %t", err, test.valid)
+			}
+			if !test.valid {
+				return
+			}
+			if mode.Weight != test.expected {
+				t.Errorf("got weight %f, expected %f", mode.Weight, test.expected)
+			}
+			if mode.String() != test.input {
+				t.Errorf("got string %s, expected %s", mode.String(), test.input)
+			}
+		})
+	}
+}
+
+func TestPreprocess_ConstraintQuartets(t *testing.T) {
+	nwks := []string{
+		"((A,C),(B,(D,E)));", "((A,C),(B,(D,E)));", "((A,C),(B,(D,E)));", "((A,C),(B,(D,E)));",
+		"((A,D),(B,(C,E)));",
+	}
+	testCases := []struct {
+		name     string
+		weight   float64
+		expected uint32 // total quartet count
+	}{
+		// 12 quartets are not in the constraint tree (see TestPreprocess_CountCap);
+		// AB|DE, AC|DE, and BC|DE are in four trees, and AB|CE is in one
+		{name: "drop", expected: 12},
+		{name: "keep", weight: 1, expected: 25},
+		{name: "weight", weight: 0.5, expected: 19},
+		{name: "weight rounds to zero", weight: 0.2, expected: 15},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader("(((A,B),C),(D,E));")).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			gtrees := make([]*tree.Tree, len(nwks))
+			for i, nwk := range nwks {
+				if gtrees[i], err = newick.NewParser(strings.NewReader(nwk)).Parse(); err != nil {
+					t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+				}
+			}
+			counting := CountMode{Constraint: ConstraintQuartets{Weight: test.weight}}
+			td, _, err := Preprocess(context.Background(), tre, gtrees, nil, nil, runtime.GOMAXPROCS(0), QuartetFilterOptions{}, 0, counting)
+			if err != nil {
+				t.Fatalf("produced error %+v", err)
+			}
+			if total := td.TotalNumQuartets(); total != test.expected {
+				t.Errorf("got %d quartets, expected %d", total, test.expected)
+			}
+			if td.ConstraintWeight != test.weight {
+				t.Errorf("got constraint weight %f, expected %f", td.ConstraintWeight, test.weight)
+			}
+		})
+	}
+}
+
+func TestPreprocess_LengthWeights(t *testing.T) {
+	testCases := []struct {
+		name        string
+		nwk         string
+		weights     []float64
+		expected    uint32 // total quartet count not in the constraint tree
+		expectedErr error
+	}{
+		// AC|BD and AC|BE are not in the constraint tree, and their internal
+		// branch has length 2 (the root edges), where the mean internal branch
+		// length is 1.5, so each weighs 1 - exp(-4/3)
+		{name: "basic", nwk: "((A:1,C:1):1,(B:1,(D:1,E:1):1):1);", expected: 1472},
+		{name: "weighted", nwk: "((A:1,C:1):1,(B:1,(D:1,E:1):1):1);", weights: []float64{0.5}, expected: 736},
+		{name: "no lengths", nwk: "((A,C),(B,(D,E)));", expectedErr: ErrNoBranchLengths},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader("(((A,B),C),(D,E));")).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			gt, err := newick.NewParser(strings.NewReader(test.nwk)).Parse()
+			if err != nil {
+				t.Fatalf("invalid newick tree %s; test is written wrong", test.nwk)
+			}
+			td, _, err := Preprocess(context.Background(), tre, []*tree.Tree{gt}, test.weights, nil, runtime.GOMAXPROCS(0), QuartetFilterOptions{}, 0, CountMode{Length: true})
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if test.expectedErr != nil {
+				return
+			}
+			if total := td.TotalNumQuartets(); total != test.expected {
+				t.Errorf("got %d quartets, expected %d", total, test.expected)
+			}
+		})
+	}
+}
+
+func TestCountModeNumGeneTrees(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     CountMode
+		weights  []float64
+		expected int
+	}{
+		{name: "raw", mode: CountMode{}, expected: 3},
+		{name: "length", mode: CountMode{Length: true}, expected: 3 * WeightScale},
+		{name: "length weighted", mode: CountMode{Length: true}, weights: []float64{1, 0.5, 0}, expected: 1500},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if n := test.mode.NumGeneTrees(3, test.weights); n != test.expected {
+				t.Errorf("got %d, expected %d", n, test.expected)
+			}
+		})
+	}
+}
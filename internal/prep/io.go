@@ -3,22 +3,28 @@ package prep
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"image/color"
 	"io"
 	"log"
+	"maps"
 	"math"
 	"os"
+	"regexp"
+	"runtime"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
 
 	"github.com/evolbioinfo/gotree/io/newick"
-	"github.com/evolbioinfo/gotree/io/nexus"
 	"github.com/evolbioinfo/gotree/tree"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
@@ -34,6 +40,20 @@ var (
 
 	plotLineColor  = color.RGBA{R: 37, G: 150, B: 190, A: 255}
 	plotMarkerShap = draw.SquareGlyph{}
+
+	// line color and marker for each series (score mode or run) in
+	// comparison plots
+	seriesPlotStyles = []struct {
+		color color.Color
+		shape draw.GlyphDrawer
+	}{
+		{plotLineColor, plotMarkerShap},
+		{color.RGBA{R: 226, G: 135, B: 67, A: 255}, draw.CircleGlyph{}},
+		{color.RGBA{R: 118, G: 181, B: 87, A: 255}, draw.TriangleGlyph{}},
+		{color.RGBA{R: 148, G: 103, B: 189, A: 255}, draw.PyramidGlyph{}},
+		{color.RGBA{R: 214, G: 39, B: 40, A: 255}, draw.CrossGlyph{}},
+		{color.RGBA{R: 140, G: 86, B: 75, A: 255}, draw.PlusGlyph{}},
+	}
 )
 
 type Format int
@@ -53,6 +73,12 @@ var ParseFormat = map[string]Format{
 	"nexus":  Nexus,
 }
 
+// Description of each gene tree format in ParseFormat (for help)
+var FormatDescriptions = map[string]string{
+	"newick": "one newick tree per line (blank lines are skipped); gene trees are named by their number in the file",
+	"nexus":  "nexus file with a TREES block, optionally using a TRANSLATE table; gene trees are named by their tree names",
+}
+
 func (f *Format) Set(s string) error {
 	if format, ok := ParseFormat[s]; ok {
 		*f = format
@@ -70,15 +96,227 @@ func (f Format) String() string {
 	panic(fmt.Sprintf("format (%d) does not exist", f))
 }
 
+// Support for a reticulation aggregated across gene trees
+type RetSummary struct {
+	Support             float64 // supporting quartets out of all informative quartets (pooled across genes)
+	Mean                float64 // mean of per gene support over informative genes
+	Informative         int     // number of genes with at least one informative quartet
+	InformativeFraction float64 // fraction of genes that are informative
+}
+
+var (
+	resultsCSVHeader       = []string{"Number of Branches", "Quartet Satisfied Percent", "Score", "Extended Newick"}
+	legacyResultsCSVHeader = []string{"Number of Branches", "Quartet Satisfied Percent", "Extended Newick"} // written before the score column was added
+)
+
+// Candidate branch that was not chosen for an optimal network, scored by
+// swapping it into the network
+type Alternative struct {
+	Branch   gr.Branch // candidate branch
+	Replaces gr.Branch // branch of the optimal network that it replaces
+	Score    float64   // score of the network with the branch replaced
+	Gap      float64   // optimal score minus score
+	QSat     float64   // percent of quartets satisfied by the network with the branch replaced
+}
+
+// Network whose score is within a tolerance of the optimal network with the
+// same number of branches
+type NearOptimal struct {
+	Branches []gr.Branch // branches of the network
+	Score    float64     // dp score of the network
+	Gap      float64     // optimal score minus score
+	QSat     float64     // percent of quartets satisfied by the network
+}
+
+// Quartet agreement between gene trees and the trees displayed by a network.
+// Displayed tree t takes the reticulation edge of Reticulations[j] if bit j of
+// t is set, and the tree edge otherwise.
+type Embedding struct {
+	Reticulations []string    // reticulation labels, in the order of the bits of the displayed trees
+	Quartets      []int       // number of quartets in each gene tree
+	Agreement     [][]float64 // fraction of each gene tree's quartets displayed by each tree (Agreement[gene][tree])
+}
+
+// Quartets of each gene tree supporting each reticulation of a network
+type GeneContributions struct {
+	Reticulations []string   // reticulation labels, in the order of the columns of Supporting
+	Supporting    [][]uint64 // quartets of each gene tree satisfied by each reticulation (Supporting[gene][ret])
+}
+
+// How much of the quartet support of a reticulation comes from a few blocks of
+// gene trees, from leaving each block out in turn
+type JackknifeSummary struct {
+	Reticulation  string   // reticulation label
+	Support       float64  // quartets satisfied by the reticulation with all gene trees
+	MinSupport    float64  // least support left with one block left out
+	Block         int      // block whose removal leaves MinSupport (1-based, 0 if there is no support)
+	Genes         []string // gene trees in Block
+	BlocksForHalf int      // fewest blocks holding at least half of the support (0 if no blocks do, e.g., with no support)
+}
+
+// Gene tree quartets around a constraint tree branch (one taxon in each of
+// the four subtrees around it) and concordance statistics akin to Quartet
+// Sampling
+type Concordance struct {
+	Concordant  uint64    // quartets agreeing with the branch
+	Discordant  [2]uint64 // quartets with each of the other two topologies
+	Informative int       // gene trees with at least one quartet around the branch
+	QC          float64   // quartet concordance, from -1 (one discordant topology) to 1 (all concordant)
+	QD          float64   // quartet differential, 1 if the discordant topologies are equally frequent and 0 if they are all one topology
+	QI          float64   // quartet informativeness, fraction of gene trees that are informative
+}
+
+// Candidate branch left out of an optimal network because its cycle overlaps
+// the cycles of chosen branches
+type Overlap struct {
+	Branch    gr.Branch   // candidate branch
+	Score     float64     // edge score of the candidate branch
+	Conflicts []gr.Branch // branches of the network whose cycles it overlaps
+}
+
+// Change in results when a single gene tree is left out
+type GeneInfluence struct {
+	Gene         string  // gene tree name
+	NumBranches  int     // number of branches of the network compared against
+	ScoreChange  float64 // dp score with all gene trees minus score without this one
+	QSatChange   float64 // change in percent of quartets satisfied (all minus without)
+	EdgesChanged int     // branches of the largest network that are not chosen without this gene tree
+}
+
+// Score gain from adding an edge compared to gains from gene trees simulated
+// without reticulation
+type NullGain struct {
+	NumEdges     int     // number of edges in the network
+	Gain         float64 // increase in dp score from adding the edge
+	NullMean     float64 // mean gain over null replicates
+	NullQuantile float64 // 95th percentile of null gains
+	PValue       float64 // fraction of null replicates with gain at least as large (with pseudocount)
+}
+
+// Work done by the dp for one value of k, summed over all vertices
+type KStats struct {
+	K              int           // number of edges
+	Vertices       int           // vertices whose subproblem was solved for k
+	EdgesEvaluated uint64        // candidate edges scored
+	ValidSplits    uint64        // candidate edges with a valid split of the remaining k-1 edges
+	CacheHits      uint64        // cycle path scores reused from a smaller k
+	Time           time.Duration // time spent at each vertex, summed over vertices (which may be solved in parallel)
+}
+
+// Quartets satisfied by a user given reticulation branch
+type BranchScore struct {
+	Branch    gr.Branch // branch on the constraint tree
+	Satisfied uint64    // quartets satisfied by the branch
+	Percent   float64   // percent of quartets satisfied by the branch
+}
+
+// Scores of a candidate edge under each score mode, along with the quartets
+// it satisfies on its own
+type EdgeScore struct {
+	Ends      EdgeEnds  // edge as given
+	Branch    gr.Branch // edge on the constraint tree
+	Scores    []float64 // edge score under each score mode
+	Satisfied uint64    // quartets satisfied by the edge
+	Percent   float64   // percent of quartets satisfied by the edge
+}
+
+// Percent of quartets satisfied by a branch with the quartet filter at each
+// threshold of a sweep
+type SweepScores struct {
+	Branch  gr.Branch // branch on the constraint tree
+	Percent []float64 // percent of quartets satisfied by the branch at each threshold
+}
+
+// Number of thresholds at which the branch satisfies some quartets
+func (s SweepScores) Supported() int {
+	n := 0
+	for _, p := range s.Percent {
+		if p > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Reticulation of the largest network with too little support to draw, kept
+// as an annotation on the backbone instead
+type Candidate struct {
+	Branch  gr.Branch // branch on the constraint tree
+	Percent float64   // percent of quartets satisfied by the branch on its own
+}
+
+// Optimal networks found with one score mode
+type ModeResult struct {
+	Mode      string        // score mode name
+	QSatScore []float64     // percent of quartets satisfied for each number of edges
+	RawScores []string      // dp score for 0, 1, ... edges
+	Branches  [][]gr.Branch // optimal branches for each number of edges
+}
+
+// Placement of a new taxon onto a network
+type Placement struct {
+	Taxon     string // new taxon
+	Clade     string // backbone taxa below the edge the taxon is placed on
+	Satisfied uint   // quartets satisfied by the placement
+	Total     uint   // quartets with the taxon and three backbone taxa (resolved in gene trees)
+	Ties      int    // number of other edges with the same number of satisfied quartets
+}
+
 type GeneTrees struct {
-	Trees []*tree.Tree // gene trees
-	Names []string     // gene names
+	Trees   []*tree.Tree  // gene trees
+	Names   []string      // gene names
+	Weights []float64     // weight of each gene tree (nil if unweighted)
+	Skipped []SkippedTree // gene trees that could not be read (only with SkipInvalidTrees)
+}
+
+// Gene tree that could not be parsed and was left out
+type SkippedTree struct {
+	Index int    // position of the tree in the file (from 0)
+	Name  string // gene name the tree would have had
+	Line  int    // line of the tree in the file (0 for nexus files)
+	Err   error  // why the tree could not be parsed
+}
+
+// Reads in and validates constraint tree and gene tree input files (and
+// optionally gene tree weights, see WithWeights). Returns an error if the
+// newick format is invalid, or the file is invalid for some other reason
+// (e.g., more than one constraint tree)
+func ReadInputFiles(treeFile, genetreesFile string, format Format, opts ...InputOption) (*tree.Tree, *GeneTrees, error) {
+	return readInputs(func() (*tree.Tree, error) { return readTreeFile(treeFile) }, genetreesFile, format, opts...)
+}
+
+// Reads in the network with k reticulations from a results csv written by
+// WriteDPResultsToCSV (or the network with the most reticulations if k is
+// negative) and the gene tree file. Returns an error if the csv isn't in the
+// expected format or doesn't contain a network with k reticulations.
+func ReadResultsInputFiles(resultsFile string, k int, genetreesFile string, format Format) (*tree.Tree, *GeneTrees, error) {
+	return readInputs(func() (*tree.Tree, error) { return readResultsCSV(resultsFile, k) }, genetreesFile, format)
+}
+
+// Reads in a network from an extended newick file, or the network with k
+// reticulations from a results csv (if the file ends in .csv, see
+// ReadResultsInputFiles)
+func ReadNetworkFile(networkFile string, k int) (*tree.Tree, error) {
+	flags := log.Flags()
+	lout := log.Writer()
+	log.SetOutput(io.Discard)
+	defer func() {
+		log.SetOutput(lout)
+		log.SetFlags(flags)
+	}()
+	if strings.HasSuffix(strings.ToLower(networkFile), ".csv") {
+		return readResultsCSV(networkFile, k)
+	}
+	return readTreeFile(networkFile)
 }
 
-// Reads in and validates constraint tree and gene tree input files.
-// Returns an error if the newick format is invalid, or the file is invalid for
-// some other reason (e.g., more than one constraint tree)
-func ReadInputFiles(treeFile, genetreesFile string, format Format) (*tree.Tree, *GeneTrees, error) {
+func readInputs(readTree func() (*tree.Tree, error), genetreesFile string, format Format, opts ...InputOption) (*tree.Tree, *GeneTrees, error) {
+	var options inputOpts
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, nil, err
+		}
+	}
 	flags := log.Flags()
 	lout := log.Writer()
 	log.SetOutput(io.Discard) // don't log this bit as gotree can be noisy and lead to thousands of log messages
@@ -86,28 +324,56 @@ func ReadInputFiles(treeFile, genetreesFile string, format Format) (*tree.Tree,
 		log.SetOutput(lout)
 		log.SetFlags(flags)
 	}()
-	tre, err := readTreeFile(treeFile)
+	tre, err := readTree()
 	if err != nil {
 		return nil, nil, err
 	}
-	genetrees, err := readGeneTreesFile(genetreesFile, format)
+	genetrees, err := readGeneTreesFile(genetreesFile, format, options.skipInvalid)
 	if err != nil {
 		return nil, nil, err
 	}
+	if options.weightsFile != "" {
+		if genetrees.Weights, err = readWeightsFile(options.weightsFile, len(genetrees.Trees)+len(genetrees.Skipped)); err != nil {
+			return nil, nil, err
+		}
+		genetrees.Weights = dropSkipped(genetrees.Weights, genetrees.Skipped)
+	}
 	return tre, genetrees, nil
 }
 
 // reads and validates constraint tree file
 func readTreeFile(treeFile string) (*tree.Tree, error) {
-	treBytes, err := os.ReadFile(treeFile)
+	file, err := openInput(treeFile)
 	if err != nil {
 		return nil, fmt.Errorf("error reading tree file: %w", err)
 	}
+	treBytes, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading tree file %s: %w", treeFile, err)
+	}
 	treBytes = bytes.TrimSpace(treBytes)
 	if bytes.Count(treBytes, []byte{byte('\n')}) != 0 || len(treBytes) == 0 {
 		return nil, fmt.Errorf("%w, there should only be exactly one newick tree in tree file %s",
 			ErrInvalidFile, treeFile)
 	}
+	return parseTree(treBytes, treeFile)
+}
+
+// Extended newick fields after a reticulation label (e.g., the inheritance
+// probability in #H1:::0.3), which gotree can't parse
+var retAnnotations = regexp.MustCompile(`(#[^,():;\[\]]*)(?::[^,():;\[\]]*){2,3}`)
+
+// Rich newick support and inheritance probability fields after a branch length
+// on other nodes (e.g., A:1.2:95:0.8), which gotree can't parse either
+var richAnnotations = regexp.MustCompile(`(:[^,():;\[\]]*)(?::[^,():;\[\]]*){1,2}`)
+
+// parses newick string and clears branch lengths, comments, and supports
+// (dropping extended newick fields of reticulations and other rich newick
+// fields, see retAnnotations and richAnnotations)
+func parseTree(treBytes []byte, treeFile string) (*tree.Tree, error) {
+	treBytes = retAnnotations.ReplaceAll(treBytes, []byte("$1"))
+	treBytes = richAnnotations.ReplaceAll(treBytes, []byte("$1"))
 	tre, err := newick.NewParser(bytes.NewReader(treBytes)).Parse()
 	if err != nil {
 		return nil, fmt.Errorf("%w, error parsing tree newick string from %s: %s",
@@ -119,9 +385,45 @@ func readTreeFile(treeFile string) (*tree.Tree, error) {
 	return tre, nil
 }
 
-// reads and validates gene tree file
-func readGeneTreesFile(genetreesFile string, format Format) (*GeneTrees, error) {
-	file, err := os.Open(genetreesFile)
+// reads network with k reticulations from results csv
+func readResultsCSV(resultsFile string, k int) (*tree.Tree, error) {
+	file, err := openInput(resultsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s, %w", resultsFile, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			panic(fmt.Sprintf("could not close file %s, %s", resultsFile, err))
+		}
+	}()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w, error reading csv %s: %s", ErrInvalidFormat, resultsFile, err.Error())
+	}
+	if len(rows) < 2 || !slices.Equal(rows[0], resultsCSVHeader) && !slices.Equal(rows[0], legacyResultsCSVHeader) {
+		return nil, fmt.Errorf("%w, %s is not a camus results csv", ErrInvalidFile, resultsFile)
+	}
+	newickCol := len(rows[0]) - 1
+	rows = rows[1:]
+	row := rows[len(rows)-1]
+	if k >= 0 {
+		i := slices.IndexFunc(rows, func(r []string) bool { return r[0] == strconv.Itoa(k) })
+		if i == -1 {
+			return nil, fmt.Errorf("%w, %s does not contain a network with %d reticulations", ErrInvalidFile, resultsFile, k)
+		}
+		row = rows[i]
+	}
+	return parseTree([]byte(row[newickCol]), resultsFile)
+}
+
+// Longest line of a newick gene tree file that can be read (the bufio.Scanner
+// default of 64 KiB is too short for large trees)
+const maxNewickLine = 1 << 30
+
+// reads and validates gene tree file (which may be compressed); trees that
+// can't be parsed are returned in GeneTrees.Skipped if skipInvalid is set
+func readGeneTreesFile(genetreesFile string, format Format, skipInvalid bool) (*GeneTrees, error) {
+	file, err := openInputWithProgress(genetreesFile)
 	if err != nil {
 		return nil, fmt.Errorf("error opening %s, %w", genetreesFile, err)
 	}
@@ -130,43 +432,200 @@ func readGeneTreesFile(genetreesFile string, format Format) (*GeneTrees, error)
 			panic(fmt.Sprintf("could not close file %s, %s", genetreesFile, err))
 		}
 	}()
-	geneTreeList := make([]*tree.Tree, 0)
-	geneTreeNames := make([]string, 0)
+	geneTrees := &GeneTrees{Trees: make([]*tree.Tree, 0), Names: make([]string, 0)}
 	switch format {
 	case Newick:
 		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, maxNewickLine)
+		n := 0
 		for i := 0; scanner.Scan(); i++ {
 			line := bytes.TrimSpace(scanner.Bytes())
-			if line != nil {
-				genetree, err := newick.NewParser(bytes.NewReader(line)).Parse()
-				if err != nil {
-					return nil, fmt.Errorf("%w, error reading gene tree on line %d in %s: %s",
-						ErrInvalidFormat, i, genetreesFile, err.Error())
-				}
-				geneTreeList = append(geneTreeList, genetree)
+			if line == nil {
+				continue
+			}
+			n++
+			genetree, err := newick.NewParser(bytes.NewReader(line)).Parse()
+			switch {
+			case err != nil && skipInvalid:
+				geneTrees.Skipped = append(geneTrees.Skipped, SkippedTree{Index: n - 1, Name: strconv.Itoa(n), Line: i + 1, Err: err})
+			case err != nil:
+				return nil, fmt.Errorf("%w, error reading gene tree on line %d in %s: %s",
+					ErrInvalidFormat, i+1, genetreesFile, err.Error())
+			default:
+				geneTrees.Trees = append(geneTrees.Trees, genetree)
+				geneTrees.Names = append(geneTrees.Names, strconv.Itoa(n))
 			}
 		}
-		if len(geneTreeList) < 1 {
-			return nil, fmt.Errorf("%w, empty gene tree file %s", ErrInvalidFile, genetreesFile)
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%w, error reading %s: %w", ErrInvalidFormat, genetreesFile, err)
 		}
-		geneTreeNames = make([]string, 0)
-		for i := range len(geneTreeList) {
-			geneTreeNames = append(geneTreeNames, strconv.Itoa(i+1))
+		if n == 0 {
+			return nil, fmt.Errorf("%w, empty gene tree file %s", ErrInvalidFile, genetreesFile)
 		}
 	case Nexus:
-		nex, err := nexus.NewParser(file).Parse()
+		data, err := io.ReadAll(file)
 		if err != nil {
+			return nil, fmt.Errorf("error reading %s, %w", genetreesFile, err)
+		}
+		if geneTrees, err = parseNexusTrees(data, runtime.GOMAXPROCS(0), skipInvalid); err != nil {
 			return nil, fmt.Errorf("%w, error reading gene tree nexus file %s: %s",
 				ErrInvalidFormat, genetreesFile, err.Error())
 		}
-		nex.IterateTrees(func(s string, t *tree.Tree) {
-			geneTreeList = append(geneTreeList, t)
-			geneTreeNames = append(geneTreeNames, s)
-		})
 	default:
 		return nil, fmt.Errorf("%w, not a valid file format", ErrInvalidFile)
 	}
-	return &GeneTrees{Trees: geneTreeList, Names: geneTreeNames}, nil
+	if len(geneTrees.Trees) == 0 {
+		return nil, fmt.Errorf("%w, none of the %d gene trees in %s could be read", ErrInvalidFile, len(geneTrees.Skipped), genetreesFile)
+	}
+	return geneTrees, nil
+}
+
+// Leaves out the values of skipped gene trees
+func dropSkipped[T any](values []T, skipped []SkippedTree) []T {
+	if len(skipped) == 0 {
+		return values
+	}
+	kept := make([]T, 0, len(values)-len(skipped))
+	next := 0
+	for i, v := range values {
+		if next < len(skipped) && skipped[next].Index == i {
+			next++
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept
+}
+
+// Reads file with one taxon name per line (blank lines are skipped)
+func ReadTaxaFile(taxaFile string) ([]string, error) {
+	taxaBytes, err := os.ReadFile(taxaFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading taxa file: %w", err)
+	}
+	taxa := make([]string, 0)
+	for line := range strings.Lines(string(taxaBytes)) {
+		if name := strings.TrimSpace(line); name != "" {
+			taxa = append(taxa, name)
+		}
+	}
+	if len(taxa) == 0 {
+		return nil, fmt.Errorf("%w, empty taxa file %s", ErrInvalidFile, taxaFile)
+	}
+	return taxa, nil
+}
+
+// Reticulation branch given by the clades below its two ends, as in the
+// "U Clade" and "W Clade" columns of output csv files (W is the hybrid clade)
+type BranchClades struct {
+	U []string
+	W []string
+}
+
+// Reads file with one reticulation branch per line written as two clades
+// separated by whitespace, each a comma separated list of taxa optionally in
+// braces, e.g., "{A,B} {C}" (blank lines are skipped)
+func ReadBranchesFile(branchesFile string) ([]BranchClades, error) {
+	branchBytes, err := os.ReadFile(branchesFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading branches file: %w", err)
+	}
+	branches := make([]BranchClades, 0)
+	lineNum := 0
+	for line := range strings.Lines(string(branchBytes)) {
+		lineNum++
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w, line %d of branches file should have two clades, but has %d fields", ErrInvalidFile, lineNum, len(fields))
+		}
+		branches = append(branches, BranchClades{U: parseClade(fields[0]), W: parseClade(fields[1])})
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("%w, empty branches file %s", ErrInvalidFile, branchesFile)
+	}
+	return branches, nil
+}
+
+// End of a candidate edge, given either by the label of a constraint tree node
+// (a taxon or an internal node label) or by the clade below it
+type EdgeEnd struct {
+	Label string   // node label ("" if given by clade)
+	Clade []string // taxa below the node (nil if given by label)
+}
+
+func (e EdgeEnd) String() string {
+	if e.Clade != nil {
+		return "{" + strings.Join(e.Clade, ",") + "}"
+	}
+	return e.Label
+}
+
+// Candidate edge from U to W (W is the hybrid end)
+type EdgeEnds struct {
+	U EdgeEnd
+	W EdgeEnd
+}
+
+// Reads csv file with one candidate edge per row as two columns, U and W, each
+// either a node label or a clade written as a comma separated list of taxa in
+// braces, e.g., "{A,B}",C (quoted, since it has commas). An optional header
+// row "u,w" (or "U Clade,W Clade") is skipped, as are lines starting with #.
+func ReadEdgesFile(edgesFile string) ([]EdgeEnds, error) {
+	file, err := os.Open(edgesFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading edges file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w, edges file %s: %s", ErrInvalidFile, edgesFile, err.Error())
+	}
+	if len(rows) > 0 && isEdgesHeader(rows[0]) {
+		rows = rows[1:]
+	}
+	edges := make([]EdgeEnds, 0, len(rows))
+	for i, row := range rows {
+		u, w := parseEdgeEnd(row[0]), parseEdgeEnd(row[1])
+		if u.Label == "" && u.Clade == nil || w.Label == "" && w.Clade == nil {
+			return nil, fmt.Errorf("%w, edge %d of edges file has an empty end", ErrInvalidFile, i+1)
+		}
+		edges = append(edges, EdgeEnds{U: u, W: w})
+	}
+	if len(edges) == 0 {
+		return nil, fmt.Errorf("%w, empty edges file %s", ErrInvalidFile, edgesFile)
+	}
+	return edges, nil
+}
+
+func isEdgesHeader(row []string) bool {
+	return strings.EqualFold(row[0], "u") && strings.EqualFold(row[1], "w") ||
+		strings.EqualFold(row[0], "U Clade") && strings.EqualFold(row[1], "W Clade")
+}
+
+func parseEdgeEnd(field string) EdgeEnd {
+	field = strings.TrimSpace(field)
+	if strings.HasPrefix(field, "{") || strings.Contains(field, ",") {
+		return EdgeEnd{Clade: parseClade(field)}
+	}
+	return EdgeEnd{Label: field}
+}
+
+func parseClade(field string) []string {
+	field = strings.TrimSuffix(strings.TrimPrefix(field, "{"), "}")
+	taxa := make([]string, 0)
+	for name := range strings.SplitSeq(field, ",") {
+		if name != "" {
+			taxa = append(taxa, name)
+		}
+	}
+	return taxa
 }
 
 // Read in extended newick file and make network
@@ -218,15 +677,14 @@ func ConvertToNetwork(ntw *tree.Tree) (network *gr.Network, err error) {
 		return true
 	})
 	if errNode != nil {
-		return nil, fmt.Errorf("%w, too many or invalid matching reticulation label %s",
-			ErrInvalidFormat, errNode.Name())
+		return nil, reticulationLabelError(ntw, fmt.Sprintf("too many or invalid matching reticulation label %s", errNode.Name()))
 	}
 	if len(ret) == 0 {
 		return nil, fmt.Errorf("%w - not a network", ErrNoReticulations)
 	}
-	for label, branch := range ret {
-		if branch.IDs[gr.Ui] == 0 || branch.IDs[gr.Wi] == 0 { // assumes root node is not labeled as reticulation
-			return nil, fmt.Errorf("%w, label %s is unmatched", ErrInvalidFormat, label)
+	for _, label := range SortedRetLabels(ret) {
+		if branch := ret[label]; branch.IDs[gr.Ui] == 0 || branch.IDs[gr.Wi] == 0 { // assumes root node is not labeled as reticulation
+			return nil, reticulationLabelError(ntw, fmt.Sprintf("label %s is unmatched", label))
 		}
 	}
 	if err := ntw.UpdateTipIndex(); err != nil {
@@ -235,45 +693,903 @@ func ConvertToNetwork(ntw *tree.Tree) (network *gr.Network, err error) {
 	return &gr.Network{NetTree: ntw, Reticulations: ret}, nil
 }
 
-// Write DP results csv file to writer.
+// Error listing every reticulation label problem in network, falling back on
+// msg if none are found
+func reticulationLabelError(ntw *tree.Tree, msg string) error {
+	problems := diagnoseReticulationLabels(ntw)
+	if len(problems) == 0 {
+		return fmt.Errorf("%w, %s", ErrInvalidFormat, msg)
+	}
+	return fmt.Errorf("%w, invalid reticulation labels:\n  %s", ErrInvalidFormat, strings.Join(problems, "\n  "))
+}
+
+// Write DP results csv file to writer. constTree is the newick string of the
+// constraint tree (the network with no branches), and scores[k] is the dp
+// score with k branches (including the constraint tree, so there is one more
+// score than newicks). Scores are written as given, since normalized scores
+// can't be recovered from the percent of quartets satisfied.
 //
-// There are three columns: "Number of Branches", "Quartet Satisfied Percent", "Extended Newick"
-func WriteDPResultsToCSV(td *gr.TreeData, newicks []string, qsat []float64, w io.Writer) (err error) {
-	if len(newicks) != len(qsat) {
-		panic(fmt.Sprintf("there should be a set of branches for every optimal score, %+v %+v", newicks, qsat))
+// There are four columns: "Number of Branches", "Quartet Satisfied Percent", "Score", "Extended Newick"
+func WriteDPResultsToCSV(constTree string, newicks []string, qsat []float64, scores []string, w io.Writer) error {
+	if len(newicks) != len(qsat) || len(scores) != len(newicks)+1 {
+		panic(fmt.Sprintf("there should be a set of branches for every optimal score, %+v %+v %+v", newicks, qsat, scores))
 	}
 	data := make([][]string, len(newicks)+2)
-	data[0] = []string{"Number of Branches", "Quartet Satisfied Percent", "Extended Newick"}
-	data[1] = []string{strconv.FormatInt(0, 10), strconv.FormatFloat(0, 'f', -1, 64), td.Newick()}
+	data[0] = resultsCSVHeader
+	data[1] = []string{strconv.FormatInt(0, 10), strconv.FormatFloat(0, 'f', -1, 64), scores[0], constTree}
 	for i := range len(newicks) {
 		data[i+2] = []string{
 			strconv.FormatInt(int64(i+1), 10),
 			strconv.FormatFloat(qsat[i], 'f', -1, 64),
+			scores[i+1],
 			newicks[i],
 		}
 	}
+	return writeCSV(data, w)
+}
+
+// Run metadata written with the json results
+type RunMetadata struct {
+	Version string            `json:"version"`
+	Command string            `json:"command"`
+	Flags   map[string]string `json:"flags"` // flags given on the command line
+	Seed    uint64            `json:"seed"`
+	Timings []PhaseTiming     `json:"timings"`
+}
+
+// Wall clock time of a phase of the run
+type PhaseTiming struct {
+	Phase   string  `json:"phase"`
+	Seconds float64 `json:"seconds"`
+}
+
+type jsonResults struct {
+	Metadata       RunMetadata   `json:"metadata"`
+	ConstraintTree string        `json:"constraint_tree"`
+	Networks       []jsonNetwork `json:"networks"`
+}
+
+type jsonNetwork struct {
+	NumBranches int          `json:"number_of_branches"`
+	QSat        float64      `json:"quartet_satisfied_percent"`
+	Score       json.Number  `json:"score"`
+	Newick      string       `json:"extended_newick"`
+	Branches    []jsonBranch `json:"branches"`
+}
+
+type jsonBranch struct {
+	Reticulation string  `json:"reticulation"`
+	U            int     `json:"u"` // node ids on the constraint tree
+	W            int     `json:"w"`
+	Score        float64 `json:"score"`
+}
+
+// Write DP results as a json document to writer, with the same networks as
+// WriteDPResultsToCSV. reticulations[i] labels the branches of the network with
+// i+1 branches, and edgeScores gives the edge score of each branch.
+func WriteDPResultsToJSON(meta RunMetadata, constTree string, newicks []string, qsat []float64, scores []string, reticulations []map[string]gr.Branch, edgeScores map[gr.Branch]float64, w io.Writer) error {
+	if len(newicks) != len(qsat) || len(scores) != len(newicks)+1 || len(reticulations) != len(newicks) {
+		panic(fmt.Sprintf("there should be a set of branches for every optimal score, %+v %+v %+v %+v", newicks, qsat, scores, reticulations))
+	}
+	results := jsonResults{Metadata: meta, ConstraintTree: constTree, Networks: make([]jsonNetwork, len(newicks)+1)}
+	results.Networks[0] = jsonNetwork{Score: json.Number(scores[0]), Newick: constTree, Branches: []jsonBranch{}}
+	for i, labeled := range reticulations {
+		branches := make([]jsonBranch, 0, len(labeled))
+		for _, label := range SortedRetLabels(labeled) {
+			br := labeled[label]
+			branches = append(branches, jsonBranch{Reticulation: label, U: br.IDs[gr.Ui], W: br.IDs[gr.Wi], Score: edgeScores[br]})
+		}
+		results.Networks[i+1] = jsonNetwork{
+			NumBranches: i + 1,
+			QSat:        qsat[i],
+			Score:       json.Number(scores[i+1]),
+			Newick:      newicks[i],
+			Branches:    branches,
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(results); err != nil {
+		return fmt.Errorf("%w, %w", ErrWritingFile, err)
+	}
+	return nil
+}
+
+// Write csv file containing the quartets gained and lost between consecutive
+// numbers of branches to writer. gained[i] and lost[i] contain the quartets
+// that change when going from i to i+1 branches.
+//
+// There are four columns: "Number of Branches", "Change", "Quartet", "Count"
+func WriteQuartetChangesToCSV(td *gr.TreeData, gained, lost [][]gr.Quartet, w io.Writer) error {
+	if len(gained) != len(lost) {
+		panic(fmt.Sprintf("gained and lost quartet lists have different lengths %d != %d", len(gained), len(lost)))
+	}
+	data := [][]string{{"Number of Branches", "Change", "Quartet", "Count"}}
+	for i := range gained {
+		for _, change := range []struct {
+			name     string
+			quartets []gr.Quartet
+		}{{"gained", gained[i]}, {"lost", lost[i]}} {
+			for _, q := range change.quartets {
+				data = append(data, []string{
+					strconv.Itoa(i + 1),
+					change.name,
+					td.QuartetString(q),
+					strconv.FormatUint(uint64(td.NumQuartet(q)), 10),
+				})
+			}
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file mapping the reticulation labels used in the output networks
+// to branches of the constraint tree (given as the leafsets below u and w) to
+// writer. reticulations[i] contains the labeled branches of the network with
+// i+1 branches.
+//
+// There are four columns: "Number of Branches", "Reticulation", "U Clade", "W Clade"
+func WriteReticulationLabelsToCSV(td *gr.TreeData, reticulations []map[string]gr.Branch, w io.Writer) error {
+	data := [][]string{{"Number of Branches", "Reticulation", "U Clade", "W Clade"}}
+	for i, labeled := range reticulations {
+		for _, label := range SortedRetLabels(labeled) {
+			br := labeled[label]
+			data = append(data, []string{
+				strconv.Itoa(i + 1),
+				label,
+				td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Ui]]),
+				td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Wi]]),
+			})
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file describing each reticulation by sets of taxa, so it can be
+// compared with results of other tools (e.g., introgression tests) that
+// don't share node ids or newick structure: the taxa moved by the hybrid edge
+// (below w), the donor clade the edge comes from (below u), and the sister
+// clade of the hybrid taxa in the constraint tree. Collapsed taxa (see
+// CollapseIdenticalTaxa) are expanded if collapsed is not nil.
+// reticulations[i] contains the labeled branches of the network with i+1
+// branches. Taxa are sorted and comma separated.
+//
+// There are five columns: "Number of Branches", "Reticulation", "Hybrid Taxa",
+// "Donor Taxa", "Sister Taxa"
+func WriteReticulationBipartitionsToCSV(td *gr.TreeData, reticulations []map[string]gr.Branch, collapsed map[string][]string, w io.Writer) error {
+	data := [][]string{{"Number of Branches", "Reticulation", "Hybrid Taxa", "Donor Taxa", "Sister Taxa"}}
+	for i, labeled := range reticulations {
+		for _, label := range SortedRetLabels(labeled) {
+			br := labeled[label]
+			donor, hybrid := td.IdToNodes[br.IDs[gr.Ui]], td.IdToNodes[br.IDs[gr.Wi]]
+			data = append(data, []string{
+				strconv.Itoa(i + 1),
+				label,
+				expandedTaxa(td, hybrid, collapsed),
+				expandedTaxa(td, donor, collapsed),
+				expandedTaxa(td, td.Sibling(hybrid), collapsed),
+			})
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Sorted, comma separated taxa below n, with collapsed taxa expanded
+func expandedTaxa(td *gr.TreeData, n *tree.Node, collapsed map[string][]string) string {
+	below := td.LeafsetNames(n)
+	names := below
+	for _, name := range below {
+		names = append(names, collapsed[name]...)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
+
+// Write csv file containing the approximate minor quartet frequency of each
+// reticulation of each optimal network to writer (left empty if there are no
+// quartets around the reticulation). reticulations[i] is the network with i+1
+// branches.
+//
+// There are three columns: "Number of Branches", "Reticulation", "Approximate
+// Minor Frequency"
+func WriteMinorFrequenciesToCSV(reticulations []map[string]gr.Branch, freqs map[gr.Branch]float64, w io.Writer) error {
+	data := [][]string{{"Number of Branches", "Reticulation", "Approximate Minor Frequency"}}
+	for i, labeled := range reticulations {
+		for _, label := range SortedRetLabels(labeled) {
+			freq, value := freqs[labeled[label]], ""
+			if !math.IsNaN(freq) {
+				value = strconv.FormatFloat(freq, 'f', -1, 64)
+			}
+			data = append(data, []string{strconv.Itoa(i + 1), label, value})
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file containing the best alternative branches for each optimal
+// network to writer. alternatives[i] and reticulations[i] correspond to the
+// network with i+1 branches; reticulations is used to label the replaced
+// branch.
+//
+// There are eight columns: "Number of Branches", "Rank", "U Clade", "W Clade",
+// "Replaces", "Score", "Gap", "Quartet Satisfied Percent"
+func WriteAlternativesToCSV(td *gr.TreeData, alternatives [][]Alternative, reticulations []map[string]gr.Branch, w io.Writer) error {
+	if len(alternatives) != len(reticulations) {
+		panic(fmt.Sprintf("alternatives and reticulations have different lengths %d != %d", len(alternatives), len(reticulations)))
+	}
+	data := [][]string{{"Number of Branches", "Rank", "U Clade", "W Clade", "Replaces", "Score", "Gap", "Quartet Satisfied Percent"}}
+	for i, alts := range alternatives {
+		labels := make(map[gr.Branch]string, len(reticulations[i]))
+		for label, br := range reticulations[i] {
+			labels[br] = label
+		}
+		for j, alt := range alts {
+			data = append(data, []string{
+				strconv.Itoa(i + 1),
+				strconv.Itoa(j + 1),
+				td.LeafsetAsString(td.IdToNodes[alt.Branch.IDs[gr.Ui]]),
+				td.LeafsetAsString(td.IdToNodes[alt.Branch.IDs[gr.Wi]]),
+				labels[alt.Replaces],
+				strconv.FormatFloat(alt.Score, 'f', -1, 64),
+				strconv.FormatFloat(alt.Gap, 'f', -1, 64),
+				strconv.FormatFloat(alt.QSat, 'f', -1, 64),
+			})
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file containing the networks scoring within a tolerance of each
+// optimal network to writer. nearOptimal[i] and newicks[i] correspond to the
+// networks with i+1 branches, best first.
+//
+// There are six columns: "Number of Branches", "Rank", "Score", "Gap",
+// "Quartet Satisfied Percent", "Extended Newick"
+func WriteNearOptimalToCSV(nearOptimal [][]NearOptimal, newicks [][]string, w io.Writer) error {
+	if len(nearOptimal) != len(newicks) {
+		panic(fmt.Sprintf("near optimal networks and newicks have different lengths %d != %d", len(nearOptimal), len(newicks)))
+	}
+	data := [][]string{{"Number of Branches", "Rank", "Score", "Gap", "Quartet Satisfied Percent", "Extended Newick"}}
+	for i, networks := range nearOptimal {
+		for j, n := range networks {
+			data = append(data, []string{
+				strconv.Itoa(i + 1),
+				strconv.Itoa(j + 1),
+				strconv.FormatFloat(n.Score, 'f', -1, 64),
+				strconv.FormatFloat(n.Gap, 'f', -1, 64),
+				strconv.FormatFloat(n.QSat, 'f', -1, 64),
+				newicks[i][j],
+			})
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file containing candidate branches left out of the largest network
+// because their cycles overlap, in the order given (i.e., ranked), to writer.
+// reticulations is used to label the overlapped branches.
+//
+// There are five columns: "Rank", "U Clade", "W Clade", "Score", "Overlaps"
+func WriteOverlapsToCSV(td *gr.TreeData, overlaps []Overlap, reticulations map[string]gr.Branch, w io.Writer) error {
+	labels := make(map[gr.Branch]string, len(reticulations))
+	for label, br := range reticulations {
+		labels[br] = label
+	}
+	data := [][]string{{"Rank", "U Clade", "W Clade", "Score", "Overlaps"}}
+	for i, o := range overlaps {
+		conflicts := make([]string, len(o.Conflicts))
+		for j, br := range o.Conflicts {
+			conflicts[j] = labels[br]
+		}
+		slices.Sort(conflicts)
+		data = append(data, []string{
+			strconv.Itoa(i + 1),
+			td.LeafsetAsString(td.IdToNodes[o.Branch.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[o.Branch.IDs[gr.Wi]]),
+			strconv.FormatFloat(o.Score, 'f', -1, 64),
+			strings.Join(conflicts, " "),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file containing the quartet agreement of each gene tree (labeled
+// by names) with each displayed tree to writer. Displayed trees are named by
+// the reticulation edges they take joined by "+", e.g., "#H1+#H3", with
+// "backbone" for the tree taking none.
+//
+// There are two columns, "Gene" and "Quartets", followed by one column for each
+// displayed tree
+func WriteEmbeddingToCSV(emb *Embedding, names []string, w io.Writer) error {
+	header := []string{"Gene", "Quartets"}
+	for t := range 1 << len(emb.Reticulations) {
+		var taken []string
+		for j, label := range emb.Reticulations {
+			if t&(1<<j) != 0 {
+				taken = append(taken, label)
+			}
+		}
+		if taken == nil {
+			taken = []string{"backbone"}
+		}
+		header = append(header, strings.Join(taken, "+"))
+	}
+	data := [][]string{header}
+	for g, row := range emb.Agreement {
+		line := []string{geneTreeLabel(names, g), strconv.Itoa(emb.Quartets[g])}
+		for _, a := range row {
+			line = append(line, strconv.FormatFloat(a, 'f', -1, 64))
+		}
+		data = append(data, line)
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file containing the quartet concordance of each constraint tree
+// branch (keyed by the id of the node below it) to writer, in node id order.
+//
+// There are eight columns: "Clade", "Concordant", "Discordant 1",
+// "Discordant 2", "Informative Genes", "QC", "QD", "QI"
+func WriteConcordanceToCSV(td *gr.TreeData, concordance map[int]Concordance, w io.Writer) error {
+	data := [][]string{{"Clade", "Concordant", "Discordant 1", "Discordant 2", "Informative Genes", "QC", "QD", "QI"}}
+	for _, id := range slices.Sorted(maps.Keys(concordance)) {
+		c := concordance[id]
+		data = append(data, []string{
+			td.LeafsetAsString(td.IdToNodes[id]),
+			strconv.FormatUint(c.Concordant, 10),
+			strconv.FormatUint(c.Discordant[0], 10),
+			strconv.FormatUint(c.Discordant[1], 10),
+			strconv.Itoa(c.Informative),
+			strconv.FormatFloat(c.QC, 'f', -1, 64),
+			strconv.FormatFloat(c.QD, 'f', -1, 64),
+			strconv.FormatFloat(c.QI, 'f', -1, 64),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write the constraint tree in newick format to writer with the quartet
+// concordance of each branch as a comment on the node below it, e.g.,
+// [&QC=0.5,QD=1,QI=0.8] (td is not modified)
+func WriteConcordanceNewick(td *gr.TreeData, concordance map[int]Concordance, w io.Writer) error {
+	tre := td.Tree.Clone()
+	for _, n := range tre.Nodes() {
+		if c, ok := concordance[n.Id()]; ok {
+			n.AddComment(fmt.Sprintf("&QC=%s,QD=%s,QI=%s",
+				strconv.FormatFloat(c.QC, 'f', 4, 64),
+				strconv.FormatFloat(c.QD, 'f', 4, 64),
+				strconv.FormatFloat(c.QI, 'f', 4, 64)))
+		}
+	}
+	_, err := fmt.Fprintln(w, tre.Newick())
+	return err
+}
+
+// Write csv file containing leave-one-out gene influence, in the order given
+// (i.e., ranked), to writer.
+//
+// There are six columns: "Rank", "Gene", "Edges Changed", "Score Change",
+// "Quartet Satisfied Percent Change", "Number of Branches"
+func WriteInfluenceToCSV(influences []GeneInfluence, w io.Writer) error {
+	data := [][]string{{"Rank", "Gene", "Edges Changed", "Score Change", "Quartet Satisfied Percent Change", "Number of Branches"}}
+	for i, inf := range influences {
+		data = append(data, []string{
+			strconv.Itoa(i + 1),
+			inf.Gene,
+			strconv.Itoa(inf.EdgesChanged),
+			strconv.FormatFloat(inf.ScoreChange, 'f', -1, 64),
+			strconv.FormatFloat(inf.QSatChange, 'f', -1, 64),
+			strconv.Itoa(inf.NumBranches),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file comparing the score of a network to the best score of a
+// network of the same size without each of its branches to writer.
+// exclusion[i] is the best score without branches[i]; labeled is used to
+// label the branches.
+//
+// There are six columns: "Reticulation", "U Clade", "W Clade", "Score",
+// "Best Score Without", "Support"
+func WriteExclusionSupportToCSV(td *gr.TreeData, branches []gr.Branch, labeled map[string]gr.Branch, score float64, exclusion []float64, w io.Writer) error {
+	if len(branches) != len(exclusion) {
+		panic(fmt.Sprintf("branches and exclusion scores have different lengths %d != %d", len(branches), len(exclusion)))
+	}
+	labels := make(map[gr.Branch]string, len(labeled))
+	for label, br := range labeled {
+		labels[br] = label
+	}
+	data := [][]string{{"Reticulation", "U Clade", "W Clade", "Score", "Best Score Without", "Support"}}
+	for i, br := range branches {
+		data = append(data, []string{
+			labels[br],
+			td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Wi]]),
+			strconv.FormatFloat(score, 'f', -1, 64),
+			strconv.FormatFloat(exclusion[i], 'f', -1, 64),
+			strconv.FormatFloat(score-exclusion[i], 'f', -1, 64),
+		})
+	}
+	slices.SortStableFunc(data[1:], func(r1, r2 []string) int {
+		return compareRetLabels(r1[0], r2[0])
+	})
+	return writeCSV(data, w)
+}
+
+// Write csv file comparing the optimal networks found with each score mode to
+// writer. newicks[i][k-1] is the network with k edges for modes[i]. Branches
+// shared counts branches also chosen by the first mode for the same number of
+// edges.
+//
+// There are six columns: "Number of Branches", "Score Mode", "Quartet
+// Satisfied Percent", "Score", "Branches Shared", "Extended Newick"
+func WriteModeComparisonToCSV(modes []ModeResult, newicks [][]string, w io.Writer) error {
+	data := [][]string{{"Number of Branches", "Score Mode", "Quartet Satisfied Percent", "Score", "Branches Shared", "Extended Newick"}}
+	maxK := 0
+	for _, m := range modes {
+		maxK = max(maxK, len(m.Branches))
+	}
+	for k := 1; k <= maxK; k++ {
+		for i, m := range modes {
+			if k > len(m.Branches) {
+				continue
+			}
+			shared := 0
+			if k <= len(modes[0].Branches) {
+				for _, br := range m.Branches[k-1] {
+					if slices.Contains(modes[0].Branches[k-1], br) {
+						shared++
+					}
+				}
+			}
+			data = append(data, []string{
+				strconv.Itoa(k),
+				m.Mode,
+				strconv.FormatFloat(m.QSatScore[k-1], 'f', -1, 64),
+				m.RawScores[k],
+				strconv.Itoa(shared),
+				newicks[i][k-1],
+			})
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the quartets satisfied by each of a set of branches and
+// by all of them together (last row, "total") to writer. Branches are labeled
+// in order with labeling.
+//
+// There are five columns: "Reticulation", "U Clade", "W Clade",
+// "Quartets Satisfied", "Quartet Satisfied Percent"
+func WriteBranchScoresToCSV(td *gr.TreeData, scores []BranchScore, labeling gr.RetLabeling, w io.Writer) error {
+	data := [][]string{{"Reticulation", "U Clade", "W Clade", "Quartets Satisfied", "Quartet Satisfied Percent"}}
+	var satisfied uint64
+	var percent float64
+	for i, bs := range scores {
+		data = append(data, []string{
+			labeling.Label(i),
+			td.LeafsetAsString(td.IdToNodes[bs.Branch.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[bs.Branch.IDs[gr.Wi]]),
+			strconv.FormatUint(bs.Satisfied, 10),
+			strconv.FormatFloat(bs.Percent, 'f', -1, 64),
+		})
+		satisfied += bs.Satisfied
+		percent += bs.Percent
+	}
+	data = append(data, []string{"total", "", "", strconv.FormatUint(satisfied, 10), strconv.FormatFloat(percent, 'f', -1, 64)})
+	return writeCSV(data, w)
+}
+
+// Write csv file with the quartets of each gene tree (labeled by names)
+// supporting each reticulation to w, one row per gene tree and one column per
+// reticulation. The last row ("total") sums the columns.
+func WriteGeneContributionsToCSV(gc *GeneContributions, names []string, w io.Writer) error {
+	if len(gc.Supporting) != len(names) {
+		panic(fmt.Sprintf("gene contributions and names have different lengths %d != %d", len(gc.Supporting), len(names)))
+	}
+	data := [][]string{append([]string{"gene"}, gc.Reticulations...)}
+	totals := make([]uint64, len(gc.Reticulations))
+	for g, counts := range gc.Supporting {
+		row := []string{names[g]}
+		for i, c := range counts {
+			row = append(row, strconv.FormatUint(c, 10))
+			totals[i] += c
+		}
+		data = append(data, row)
+	}
+	total := []string{"total"}
+	for _, c := range totals {
+		total = append(total, strconv.FormatUint(c, 10))
+	}
+	return writeCSV(append(data, total), w)
+}
+
+// Write csv file summarizing the jackknife of each reticulation to writer, in
+// the order given
+//
+// There are seven columns: "Reticulation", "Quartet Support", "Min Jackknife
+// Support", "Max Drop Percent", "Most Influential Block", "Most Influential
+// Genes", "Blocks For Half"
+func WriteJackknifeToCSV(summaries []JackknifeSummary, w io.Writer) error {
+	data := [][]string{{"Reticulation", "Quartet Support", "Min Jackknife Support", "Max Drop Percent", "Most Influential Block", "Most Influential Genes", "Blocks For Half"}}
+	for _, js := range summaries {
+		block := ""
+		if js.Block != 0 {
+			block = strconv.Itoa(js.Block)
+		}
+		data = append(data, []string{
+			js.Reticulation,
+			strconv.FormatFloat(js.Support, 'f', -1, 64),
+			strconv.FormatFloat(js.MinSupport, 'f', -1, 64),
+			strconv.FormatFloat(100*(js.Support-js.MinSupport)/js.Support, 'f', -1, 64),
+			block,
+			strings.Join(js.Genes, ";"),
+			strconv.Itoa(js.BlocksForHalf),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the score of each candidate edge under each score mode
+// in modes to writer, in the order the edges were given
+//
+// There are 6 + len(modes) columns: "Edge", "U", "W", "U Clade", "W Clade",
+// one "<mode> Score" column for each mode, "Quartets Satisfied", "Quartet
+// Satisfied Percent"
+func WriteEdgeScoresToCSV(td *gr.TreeData, scores []EdgeScore, modes []string, w io.Writer) error {
+	header := []string{"Edge", "U", "W", "U Clade", "W Clade"}
+	for _, mode := range modes {
+		header = append(header, mode+" Score")
+	}
+	data := [][]string{append(header, "Quartets Satisfied", "Quartet Satisfied Percent")}
+	for i, es := range scores {
+		if len(es.Scores) != len(modes) {
+			panic(fmt.Sprintf("edge %d has %d scores for %d score modes", i+1, len(es.Scores), len(modes)))
+		}
+		row := []string{
+			strconv.Itoa(i + 1),
+			es.Ends.U.String(),
+			es.Ends.W.String(),
+			td.LeafsetAsString(td.IdToNodes[es.Branch.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[es.Branch.IDs[gr.Wi]]),
+		}
+		for _, score := range es.Scores {
+			row = append(row, strconv.FormatFloat(score, 'f', -1, 64))
+		}
+		data = append(data, append(row, strconv.FormatUint(es.Satisfied, 10), strconv.FormatFloat(es.Percent, 'f', -1, 64)))
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the bootstrap support of each branch of a network to
+// writer. support[i] is the fraction of replicates containing branches[i];
+// labeled is used to label the branches.
+//
+// There are four columns: "Reticulation", "U Clade", "W Clade", "Bootstrap
+// Support"
+func WriteBootstrapSupportToCSV(td *gr.TreeData, branches []gr.Branch, labeled map[string]gr.Branch, support []float64, w io.Writer) error {
+	if len(branches) != len(support) {
+		panic(fmt.Sprintf("branches and bootstrap support have different lengths %d != %d", len(branches), len(support)))
+	}
+	labels := make(map[gr.Branch]string, len(labeled))
+	for label, br := range labeled {
+		labels[br] = label
+	}
+	data := [][]string{{"Reticulation", "U Clade", "W Clade", "Bootstrap Support"}}
+	for i, br := range branches {
+		data = append(data, []string{
+			labels[br],
+			td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Wi]]),
+			strconv.FormatFloat(support[i], 'f', -1, 64),
+		})
+	}
+	slices.SortStableFunc(data[1:], func(r1, r2 []string) int {
+		return compareRetLabels(r1[0], r2[0])
+	})
+	return writeCSV(data, w)
+}
+
+// Write csv file with the percent of quartets satisfied by each branch of a
+// network with the quartet filter at each threshold of a sweep to writer;
+// labeled is used to label the branches.
+//
+// There are three columns ("Reticulation", "U Clade", "W Clade") followed by
+// "Threshold <t>" for each threshold, then "Supported Thresholds", "Min
+// Percent", "Max Percent"
+func WriteThresholdSweepToCSV(td *gr.TreeData, thresholds []float64, scores []SweepScores, labeled map[string]gr.Branch, w io.Writer) error {
+	labels := make(map[gr.Branch]string, len(labeled))
+	for label, br := range labeled {
+		labels[br] = label
+	}
+	header := []string{"Reticulation", "U Clade", "W Clade"}
+	for _, t := range thresholds {
+		header = append(header, "Threshold "+strconv.FormatFloat(t, 'f', -1, 64))
+	}
+	data := [][]string{append(header, "Supported Thresholds", "Min Percent", "Max Percent")}
+	for _, s := range scores {
+		if len(s.Percent) != len(thresholds) {
+			panic(fmt.Sprintf("sweep scores and thresholds have different lengths %d != %d", len(s.Percent), len(thresholds)))
+		}
+		row := []string{
+			labels[s.Branch],
+			td.LeafsetAsString(td.IdToNodes[s.Branch.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[s.Branch.IDs[gr.Wi]]),
+		}
+		for _, p := range s.Percent {
+			row = append(row, strconv.FormatFloat(p, 'f', -1, 64))
+		}
+		data = append(data, append(row,
+			strconv.Itoa(s.Supported()),
+			strconv.FormatFloat(slices.Min(s.Percent), 'f', -1, 64),
+			strconv.FormatFloat(slices.Max(s.Percent), 'f', -1, 64),
+		))
+	}
+	slices.SortStableFunc(data[1:], func(r1, r2 []string) int {
+		return compareRetLabels(r1[0], r2[0])
+	})
+	return writeCSV(data, w)
+}
+
+// Write csv file listing the candidate reticulations (see Candidate) to
+// writer; labeled is used to label the branches.
+//
+// There are four columns: "Reticulation", "U Clade", "W Clade", "Percent"
+func WriteCandidatesToCSV(td *gr.TreeData, candidates []Candidate, labeled map[string]gr.Branch, w io.Writer) error {
+	labels := make(map[gr.Branch]string, len(labeled))
+	for label, br := range labeled {
+		labels[br] = label
+	}
+	data := [][]string{{"Reticulation", "U Clade", "W Clade", "Percent"}}
+	for _, c := range candidates {
+		data = append(data, []string{
+			labels[c.Branch],
+			td.LeafsetAsString(td.IdToNodes[c.Branch.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[c.Branch.IDs[gr.Wi]]),
+			strconv.FormatFloat(c.Percent, 'f', -1, 64),
+		})
+	}
+	slices.SortStableFunc(data[1:], func(r1, r2 []string) int {
+		return compareRetLabels(r1[0], r2[0])
+	})
+	return writeCSV(data, w)
+}
+
+// Write csv file with the quartet support of each reticulation from the gene
+// trees of each partition to writer. summaries[p] holds the support from
+// partition p.
+//
+// There are three columns ("Reticulation", "U Clade", "W Clade") followed by
+// "<partition> Support" and "<partition> Informative Fraction" for each
+// partition
+func WritePartitionSupportToCSV(td *gr.TreeData, labeled map[string]gr.Branch, parts *Partitions, summaries []map[string]RetSummary, w io.Writer) error {
+	header := []string{"Reticulation", "U Clade", "W Clade"}
+	for _, name := range parts.Names {
+		header = append(header, name+" Support", name+" Informative Fraction")
+	}
+	data := [][]string{header}
+	for _, label := range SortedRetLabels(labeled) {
+		br := labeled[label]
+		row := []string{
+			label,
+			td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Ui]]),
+			td.LeafsetAsString(td.IdToNodes[br.IDs[gr.Wi]]),
+		}
+		for p := range parts.Names {
+			summary := summaries[p][label]
+			row = append(row,
+				strconv.FormatFloat(summary.Support, 'f', -1, 64),
+				strconv.FormatFloat(summary.InformativeFraction, 'f', -1, 64),
+			)
+		}
+		data = append(data, row)
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file comparing the score gain of each added edge to null gains to
+// writer.
+//
+// There are five columns: "Number of Edges", "Score Gain", "Null Mean Gain",
+// "Null 95th Percentile Gain", "P Value"
+func WriteNullGainsToCSV(gains []NullGain, w io.Writer) error {
+	data := [][]string{{"Number of Edges", "Score Gain", "Null Mean Gain", "Null 95th Percentile Gain", "P Value"}}
+	for _, g := range gains {
+		data = append(data, []string{
+			strconv.Itoa(g.NumEdges),
+			strconv.FormatFloat(g.Gain, 'f', -1, 64),
+			strconv.FormatFloat(g.NullMean, 'f', -1, 64),
+			strconv.FormatFloat(g.NullQuantile, 'f', -1, 64),
+			strconv.FormatFloat(g.PValue, 'f', -1, 64),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with per-k dp statistics to writer.
+//
+// There are six columns: "Number of Edges", "Vertices", "Edges Evaluated",
+// "Valid Splits", "Cache Hits", "Seconds"
+func WriteKStatsToCSV(stats []KStats, w io.Writer) error {
+	data := [][]string{{"Number of Edges", "Vertices", "Edges Evaluated", "Valid Splits", "Cache Hits", "Seconds"}}
+	for _, st := range stats {
+		data = append(data, []string{
+			strconv.Itoa(st.K),
+			strconv.Itoa(st.Vertices),
+			strconv.FormatUint(st.EdgesEvaluated, 10),
+			strconv.FormatUint(st.ValidSplits, 10),
+			strconv.FormatUint(st.CacheHits, 10),
+			strconv.FormatFloat(st.Time.Seconds(), 'f', -1, 64),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the number of sets of four taxa for each frequency of
+// their dominant topology to writer. Bins below 1/3 are left out, since the
+// dominant topology is always at least that frequent.
+//
+// There are four columns: "Dominant Frequency Min", "Dominant Frequency Max",
+// "Taxa Sets", "Failed Threshold"
+func WriteFilterFrequenciesToCSV(stats *FilterStats, w io.Writer) error {
+	data := [][]string{{"Dominant Frequency Min", "Dominant Frequency Max", "Taxa Sets", "Failed Threshold"}}
+	for i := NumFreqBins / 3; i < NumFreqBins; i++ {
+		data = append(data, []string{
+			strconv.FormatFloat(float64(i)/NumFreqBins, 'f', -1, 64),
+			strconv.FormatFloat(float64(i+1)/NumFreqBins, 'f', -1, 64),
+			strconv.Itoa(stats.DominantFreq[i]),
+			strconv.Itoa(stats.FailedFreq[i]),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the number of filtered quartets containing each taxon
+// to writer, from most to least. tre is the constraint tree.
+//
+// There are three columns: "Taxon", "Quartets Removed", "Fraction of Removed"
+func WriteFilterTaxaToCSV(stats *FilterStats, tre *tree.Tree, w io.Writer) error {
+	type taxonCount struct {
+		name    string
+		removed uint64
+	}
+	taxa := make([]taxonCount, 0, len(stats.TaxonRemoved))
+	for _, tip := range tre.Tips() {
+		i, err := tre.TipIndex(tip.Name())
+		if err != nil {
+			return err
+		}
+		taxa = append(taxa, taxonCount{name: tip.Name(), removed: stats.TaxonRemoved[i]})
+	}
+	slices.SortStableFunc(taxa, func(a, b taxonCount) int {
+		return cmp.Or(cmp.Compare(b.removed, a.removed), strings.Compare(a.name, b.name))
+	})
+	data := [][]string{{"Taxon", "Quartets Removed", "Fraction of Removed"}}
+	for _, t := range taxa {
+		var frac float64
+		if stats.CountRemoved != 0 {
+			frac = float64(t.removed) / float64(stats.CountRemoved)
+		}
+		data = append(data, []string{t.name, strconv.FormatUint(t.removed, 10), strconv.FormatFloat(frac, 'f', -1, 64)})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file listing the taxa collapsed into each representative to writer
+//
+// There are three columns: "Representative", "Taxa", "Number of Taxa"
+func WriteCollapsedTaxaToCSV(collapsed map[string][]string, w io.Writer) error {
+	data := [][]string{{"Representative", "Taxa", "Number of Taxa"}}
+	for _, rep := range slices.Sorted(maps.Keys(collapsed)) {
+		taxa := append([]string{rep}, collapsed[rep]...)
+		data = append(data, []string{rep, "{" + strings.Join(taxa, ",") + "}", strconv.Itoa(len(taxa))})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file listing the gene trees that could not be read to writer
+//
+// There are three columns: "Gene", "Line" (empty for nexus files), "Error"
+func WriteSkippedTreesToCSV(skipped []SkippedTree, w io.Writer) error {
+	data := [][]string{{"Gene", "Line", "Error"}}
+	for _, st := range skipped {
+		line := ""
+		if st.Line > 0 {
+			line = strconv.Itoa(st.Line)
+		}
+		data = append(data, []string{st.Name, line, st.Err.Error()})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the placement of each new taxon to writer
+//
+// There are six columns: "Taxon", "Clade", "Quartets Satisfied",
+// "Quartets Total", "Fraction Satisfied", "Ties"
+func WritePlacementsToCSV(placements []Placement, w io.Writer) error {
+	data := [][]string{{"Taxon", "Clade", "Quartets Satisfied", "Quartets Total", "Fraction Satisfied", "Ties"}}
+	for _, p := range placements {
+		data = append(data, []string{
+			p.Taxon,
+			p.Clade,
+			strconv.FormatUint(uint64(p.Satisfied), 10),
+			strconv.FormatUint(uint64(p.Total), 10),
+			strconv.FormatFloat(float64(p.Satisfied)/float64(p.Total), 'f', -1, 64),
+			strconv.Itoa(p.Ties),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+func writeCSV(data [][]string, w io.Writer) (err error) {
 	writer := csv.NewWriter(w)
 	defer func() {
 		writer.Flush()
 		if err == nil {
 			err = writer.Error()
 		} else if writer.Error() != nil {
-			log.Printf("error when flushing output csv, %s", writer.Error())
+			lg.Infof("error when flushing output csv, %s", writer.Error())
 		}
 	}()
 	if err = writer.WriteAll(data); err != nil {
-		err = fmt.Errorf("%w, %s", ErrWritingFile, err)
+		err = fmt.Errorf("%w, %w", ErrWritingFile, err)
 		return
 	}
 	return
 }
 
-func WriteResultsLineplot(qstat []float64, prefix string) error {
+// Write plot of the percent of quartets not satisfied for each number of
+// branches to png file at path
+func WriteResultsLineplot(qstat []float64, path string) error {
+	p := newQSatPlot(len(qstat))
+	line, points, err := qsatLinePoints(qstat, plotLineColor, plotMarkerShap)
+	if err != nil {
+		return err
+	}
+	p.Add(line, points)
+	return p.Save(plotW, plotH, path)
+}
+
+// Plots the percent of quartets not satisfied for each score mode together
+func WriteModesLineplot(modes []ModeResult, path string) error {
+	names := make([]string, len(modes))
+	qsats := make([][]float64, len(modes))
+	for i, m := range modes {
+		names[i], qsats[i] = m.Mode, m.QSatScore
+	}
+	return WriteQSatLineplots(names, qsats, path)
+}
+
+// Plots the percent of quartets not satisfied by each of several series of
+// networks (e.g., score modes or runs) together, labeled with names
+func WriteQSatLineplots(names []string, qsats [][]float64, path string) error {
+	maxK := 0
+	for _, qsat := range qsats {
+		maxK = max(maxK, len(qsat))
+	}
+	p := newQSatPlot(maxK)
+	for i, qsat := range qsats {
+		style := seriesPlotStyles[i%len(seriesPlotStyles)]
+		line, points, err := qsatLinePoints(qsat, style.color, style.shape)
+		if err != nil {
+			return err
+		}
+		p.Add(line, points)
+		p.Legend.Add(names[i], line, points)
+	}
+	p.Legend.Top = true
+	return p.Save(plotW, plotH, path)
+}
+
+// Empty plot with axes for the percent of quartets not satisfied by up to
+// maxK reticulations
+func newQSatPlot(maxK int) *plot.Plot {
 	p := plot.New()
 	p.X.Label.Text = "Number of Reticulations"
 	p.Y.Label.Text = "Percent of Quartets Not Satisfied"
 	p.X.Min = 0
-	p.X.Max = float64(len(qstat))
+	p.X.Max = float64(maxK)
 	p.X.Tick.Marker = plot.TickerFunc(func(_, max float64) []plot.Tick {
 		step := 1
 		if int(max) > maxTicks {
@@ -291,6 +1607,10 @@ func WriteResultsLineplot(qstat []float64, prefix string) error {
 	})
 	p.Y.Min = 0
 	p.Y.Max = 100
+	return p
+}
+
+func qsatLinePoints(qstat []float64, c color.Color, shape draw.GlyphDrawer) (*plotter.Line, *plotter.Scatter, error) {
 	pts := make(plotter.XYs, len(qstat)+1)
 	pts[0].X = 0
 	pts[0].Y = 100
@@ -300,41 +1620,205 @@ func WriteResultsLineplot(qstat []float64, prefix string) error {
 	}
 	line, points, err := plotter.NewLinePoints(pts)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	line.Color = plotLineColor
+	line.Color = c
 	line.Dashes = []vg.Length{vg.Points(6), vg.Points(3)}
-	points.Color = plotLineColor
-	points.Shape = plotMarkerShap
+	points.Color = c
+	points.Shape = shape
 	points.Radius = vg.Points(4)
-	p.Add(line, points)
-	return p.Save(plotW, plotH, fmt.Sprintf("%s.png", prefix))
+	return line, points, nil
 }
 
-// Write csv file containing reticulation branch scores to stdout
-func WriteRetScoresToCSV(scores []*map[string]float64, names []string) error {
-	branchNames := make([]string, 0)
-	for k := range *scores[0] {
-		branchNames = append(branchNames, k)
-	}
-	slices.SortFunc(branchNames, func(a, b string) int {
-		if diff := len(a) - len(b); diff != 0 {
-			return diff
+// Write newick strings to writer, one per line
+func WriteNewicks(newicks []string, w io.Writer) error {
+	for _, nwk := range newicks {
+		if _, err := fmt.Fprintln(w, nwk); err != nil {
+			return fmt.Errorf("%w, %w", ErrWritingFile, err)
 		}
-		return strings.Compare(a, b)
-	})
+	}
+	return nil
+}
+
+// Write csv file containing reticulation branch scores to w. The last
+// row ("informative fraction") has the fraction of genes with a score for each
+// reticulation.
+func WriteRetScoresToCSV(scores []*map[string]float64, names []string, w io.Writer) error {
+	branchNames := SortedRetLabels(*scores[0])
 	data := make([][]string, len(scores)+1)
-	data[0] = append([]string{"gene"}, branchNames...)
+	data[0] = retScoresHeader(branchNames)
 	for i, row := range scores {
-		data[i+1] = []string{names[i]}
-		for _, br := range branchNames {
-			data[i+1] = append(data[i+1], strconv.FormatFloat((*row)[br], 'f', -1, 64))
-		}
+		data[i+1] = retScoresRow(names[i], *row, branchNames)
 	}
-	writer := csv.NewWriter(os.Stdout)
+	data = append(data, retFractionsRow(informativeFractions(scores), branchNames))
+	writer := csv.NewWriter(w)
 	defer writer.Flush()
 	if err := writer.WriteAll(data); err != nil {
 		return fmt.Errorf("error writing csv file: %s", err)
 	}
 	return nil
 }
+
+// Part of a reticulation score matrix split across files (see
+// WriteRetScoresInParts)
+type ScorePart struct {
+	File      string // file the part was written to
+	FirstGene string // first gene in the part
+	LastGene  string // last gene in the part
+	Genes     int    // number of genes in the part
+}
+
+// Write the reticulation score matrix (as in WriteRetScoresToCSV) split into
+// parts of at most rows genes each, so that every file stays small enough to
+// open in a spreadsheet. Each part starts with the header row, and the
+// "informative fraction" row is at the end of the last part. Part i (numbered
+// from 1) is passed to write, which writes it and returns the name of its
+// file. Only one part is held in memory at a time.
+func WriteRetScoresInParts(scores []*map[string]float64, names []string, rows int, write func(part int, writePart func(io.Writer) error) (string, error)) ([]ScorePart, error) {
+	if rows < 1 {
+		return nil, fmt.Errorf("score matrix parts must have at least one row, not %d", rows)
+	}
+	branchNames := SortedRetLabels(*scores[0])
+	fractions := informativeFractions(scores)
+	parts := make([]ScorePart, 0, (len(scores)+rows-1)/rows)
+	for start := 0; start < len(scores); start += rows {
+		end := min(start+rows, len(scores))
+		data := make([][]string, 0, end-start+2)
+		data = append(data, retScoresHeader(branchNames))
+		for i := start; i < end; i++ {
+			data = append(data, retScoresRow(names[i], *scores[i], branchNames))
+		}
+		if end == len(scores) {
+			data = append(data, retFractionsRow(fractions, branchNames))
+		}
+		file, err := write(len(parts)+1, func(w io.Writer) error {
+			return writeCSV(data, w)
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, ScorePart{File: file, FirstGene: names[start], LastGene: names[end-1], Genes: end - start})
+	}
+	return parts, nil
+}
+
+// Write csv index of the parts of a split score matrix to writer.
+//
+// There are five columns: "part", "file", "first gene", "last gene", "genes"
+func WriteScorePartsIndexToCSV(parts []ScorePart, w io.Writer) error {
+	data := [][]string{{"part", "file", "first gene", "last gene", "genes"}}
+	for i, part := range parts {
+		data = append(data, []string{strconv.Itoa(i + 1), part.File, part.FirstGene, part.LastGene, strconv.Itoa(part.Genes)})
+	}
+	return writeCSV(data, w)
+}
+
+func retScoresHeader(branchNames []string) []string {
+	return append([]string{"gene"}, branchNames...)
+}
+
+func retScoresRow(name string, scores map[string]float64, branchNames []string) []string {
+	row := make([]string, 0, len(branchNames)+1)
+	row = append(row, name)
+	for _, br := range branchNames {
+		row = append(row, strconv.FormatFloat(scores[br], 'f', -1, 64))
+	}
+	return row
+}
+
+func retFractionsRow(fractions map[string]float64, branchNames []string) []string {
+	return retScoresRow("informative fraction", fractions, branchNames)
+}
+
+// Write csv file containing reticulation support aggregated across genes to
+// writer.
+//
+// There are five columns: "reticulation", "support", "mean", "informative
+// genes", "informative fraction"
+func WriteRetSummaryToCSV(summaries map[string]RetSummary, w io.Writer) error {
+	data := [][]string{{"reticulation", "support", "mean", "informative genes", "informative fraction"}}
+	for _, label := range SortedRetLabels(summaries) {
+		summary := summaries[label]
+		data = append(data, []string{
+			label,
+			strconv.FormatFloat(summary.Support, 'f', -1, 64),
+			strconv.FormatFloat(summary.Mean, 'f', -1, 64),
+			strconv.Itoa(summary.Informative),
+			strconv.FormatFloat(summary.InformativeFraction, 'f', -1, 64),
+		})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file containing the informative reticulation branch scores to
+// writer, one row per gene and reticulation (NaN scores are left out), along
+// with the fraction of genes with a score for the reticulation.
+//
+// There are four columns: "gene", "reticulation", "score", "informative fraction"
+func WriteRetScoresSparseToCSV(scores []*map[string]float64, names []string, w io.Writer) error {
+	fractions := informativeFractions(scores)
+	data := [][]string{{"gene", "reticulation", "score", "informative fraction"}}
+	for i, row := range scores {
+		for _, br := range SortedRetLabels(*row) {
+			if s := (*row)[br]; !math.IsNaN(s) {
+				data = append(data, []string{
+					names[i],
+					br,
+					strconv.FormatFloat(s, 'f', -1, 64),
+					strconv.FormatFloat(fractions[br], 'f', -1, 64),
+				})
+			}
+		}
+	}
+	return writeCSV(data, w)
+}
+
+// Fraction of genes with a (non NaN) score for each reticulation
+func informativeFractions(scores []*map[string]float64) map[string]float64 {
+	fractions := make(map[string]float64)
+	for _, row := range scores {
+		for br, s := range *row {
+			if !math.IsNaN(s) {
+				fractions[br]++
+			}
+		}
+	}
+	for br := range fractions {
+		fractions[br] /= float64(len(scores))
+	}
+	return fractions
+}
+
+// Returns reticulation labels sorted by length then lexicographically (so
+// that #H2 comes before #H10)
+func SortedRetLabels[V any](m map[string]V) []string {
+	labels := make([]string, 0, len(m))
+	for k := range m {
+		labels = append(labels, k)
+	}
+	slices.SortFunc(labels, compareRetLabels)
+	return labels
+}
+
+// Orders reticulation labels by length then lexicographically (so that #H2
+// comes before #H10)
+func compareRetLabels(a, b string) int {
+	return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+}
+
+// Write the comparison of two networks to writer, one row per metric
+//
+// There are two columns: "Metric", "Value"
+func WriteNetworkComparisonToCSV(cmp gr.NetworkComparison, w io.Writer) error {
+	data := [][]string{
+		{"Metric", "Value"},
+		{"Reticulations (first network)", strconv.Itoa(cmp.Reticulations[0])},
+		{"Reticulations (second network)", strconv.Itoa(cmp.Reticulations[1])},
+		{"Shared Reticulations", strconv.Itoa(cmp.SharedReticulations)},
+		{"Hardwired Clusters (first network)", strconv.Itoa(cmp.HardwiredClusters[0])},
+		{"Hardwired Clusters (second network)", strconv.Itoa(cmp.HardwiredClusters[1])},
+		{"Hardwired Cluster Distance", strconv.Itoa(cmp.HardwiredDistance)},
+		{"Backbone RF Distance", strconv.Itoa(cmp.BackboneRF)},
+	}
+	return writeCSV(data, w)
+}
@@ -1,11 +1,23 @@
 package prep
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/evolbioinfo/gotree/io/newick"
 	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
 )
 
 func TestReadInputFiles(t *testing.T) {
@@ -90,6 +102,33 @@ func TestReadInputFiles(t *testing.T) {
 			format:      "nexus",
 			expectedErr: nil,
 		},
+		{
+			name:        "compressed",
+			treeFile:    "testdata/constraint.nwk.gz",
+			quartetFile: "testdata/quartets.nwk.bz2",
+			taxaset:     []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J"},
+			numGenes:    2,
+			format:      "newick",
+			expectedErr: nil,
+		},
+		{
+			name:        "compressed nexus",
+			treeFile:    "testdata/constraint.nwk",
+			quartetFile: "testdata/quartets.nex.gz",
+			taxaset:     []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J"},
+			numGenes:    2,
+			format:      "nexus",
+			expectedErr: nil,
+		},
+		{
+			name:        "truncated compressed gene trees",
+			treeFile:    "testdata/constraint.nwk",
+			quartetFile: "testdata/truncated.nwk.gz",
+			taxaset:     []string{},
+			numGenes:    -1,
+			format:      "newick",
+			expectedErr: ErrInvalidFormat,
+		},
 	}
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
@@ -112,6 +151,81 @@ func TestReadInputFiles(t *testing.T) {
 	}
 }
 
+func TestReadInputFiles_SkipInvalidTrees(t *testing.T) {
+	dir := t.TempDir()
+	geneTreeFile := filepath.Join(dir, "genes.nwk")
+	weightsFile := filepath.Join(dir, "weights.txt")
+	if err := os.WriteFile(geneTreeFile, []byte("(A,(B,(C,D)));\n\n((A,B);\n(A,(C,(B,D)));\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(weightsFile, []byte("1\n2\n3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := ReadInputFiles("testdata/constraint.nwk", geneTreeFile, Newick, WithWeights(weightsFile))
+	if !errors.Is(err, ErrInvalidFormat) || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected %v on line 3 without SkipInvalidTrees, got %v", ErrInvalidFormat, err)
+	}
+	_, geneTrees, err := ReadInputFiles("testdata/constraint.nwk", geneTreeFile, Newick, WithWeights(weightsFile), SkipInvalidTrees())
+	if err != nil {
+		t.Fatalf("failed with unexpected error %s", err)
+	}
+	if !slices.Equal(geneTrees.Names, []string{"1", "3"}) || !slices.Equal(geneTrees.Weights, []float64{1, 3}) {
+		t.Errorf("got names %v and weights %v, expected [1 3] and [1 3]", geneTrees.Names, geneTrees.Weights)
+	}
+	if len(geneTrees.Skipped) != 1 || geneTrees.Skipped[0].Name != "2" || geneTrees.Skipped[0].Line != 3 {
+		t.Fatalf("unexpected skipped trees %+v", geneTrees.Skipped)
+	}
+	var buf bytes.Buffer
+	if err := WriteSkippedTreesToCSV(geneTrees.Skipped, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Gene,Line,Error\n2,3,"; !strings.HasPrefix(buf.String(), expected) {
+		t.Errorf("got csv %q, expected it to start with %q", buf.String(), expected)
+	}
+	if err := os.WriteFile(geneTreeFile, []byte("((A,B);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = ReadInputFiles("testdata/constraint.nwk", geneTreeFile, Newick, SkipInvalidTrees()); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("expected %v when every tree is invalid, got %v", ErrInvalidFile, err)
+	}
+}
+
+func TestReadResultsInputFiles(t *testing.T) {
+	testCases := []struct {
+		name          string
+		resultsFile   string
+		k             int
+		reticulations int
+		expectedErr   error
+	}{
+		{name: "largest", resultsFile: "testdata/results.csv", k: -1, reticulations: 2},
+		{name: "k=1", resultsFile: "testdata/results.csv", k: 1, reticulations: 1},
+		{name: "missing k", resultsFile: "testdata/results.csv", k: 3, expectedErr: ErrInvalidFile},
+		{name: "legacy header", resultsFile: "testdata/results-legacy.csv", k: -1, reticulations: 2},
+		{name: "not results csv", resultsFile: "testdata/constraint.nwk", k: -1, expectedErr: ErrInvalidFile},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, genes, err := ReadResultsInputFiles(test.resultsFile, test.k, "testdata/quartets.nwk", Newick)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("failed with unexpected error %+v", err)
+			} else if err != nil {
+				return
+			}
+			if len(genes.Trees) != 2 {
+				t.Errorf("wrong number of gene trees read (%d != 2)", len(genes.Trees))
+			}
+			ntw, err := ConvertToNetwork(tre)
+			if err != nil {
+				t.Fatalf("failed to convert tree to network %s", err)
+			}
+			if len(ntw.Reticulations) != test.reticulations {
+				t.Errorf("got %d reticulations, expected %d", len(ntw.Reticulations), test.reticulations)
+			}
+		})
+	}
+}
+
 func TestConvertToNetwork(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -131,6 +245,16 @@ func TestConvertToNetwork(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			name:        "inheritance probabilities",
+			networkFile: "testdata/gamma-net.nwk",
+			expNetwork:  "(((9,0),(7,(6,(#H1,8h0u)))),((#H3,(12,((3,(14h2w)#H3),10))h2u),((((5,(#H2,13h1u)),((2h1w)#H2,11))h0w)#H1,(1,4))));",
+			expReticulations: map[string][2]string{
+				"#H1": {"8h0u", "h0w"},
+				"#H2": {"13h1u", "2h1w"},
+				"#H3": {"h2u", "14h2w"},
+			},
+		},
 		{
 			name:             "unresolved",
 			networkFile:      "testdata/unresolved.nwk",
@@ -209,3 +333,329 @@ func TestConvertToNetwork(t *testing.T) {
 		})
 	}
 }
+
+func TestChoiceDescriptions(t *testing.T) {
+	for name := range ParseFormat {
+		if FormatDescriptions[name] == "" {
+			t.Errorf("format %s has no description", name)
+		}
+	}
+	if len(FormatDescriptions) != len(ParseFormat) {
+		t.Errorf("%d descriptions for %d formats", len(FormatDescriptions), len(ParseFormat))
+	}
+	var mode QMode
+	for n := range QModeDescriptions {
+		if err := mode.Set(n); err != nil {
+			t.Errorf("quartet filter mode %d has a description but is not valid", n)
+		}
+	}
+	if err := mode.Set(len(QModeDescriptions)); err == nil {
+		t.Errorf("quartet filter mode %d is valid but has no description", len(QModeDescriptions))
+	}
+}
+
+func TestWriteReticulationBipartitionsToCSV(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,(B,(C,F)a)b)c,(D,E)d)e;")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := gr.MakeTreeData(tre, nil)
+	branch := func(u, w string) gr.Branch {
+		uNodes, err := tre.SelectNodes(u)
+		if err != nil || len(uNodes) != 1 {
+			t.Fatalf("cannot find node %s", u)
+		}
+		wNodes, err := tre.SelectNodes(w)
+		if err != nil || len(wNodes) != 1 {
+			t.Fatalf("cannot find node %s", w)
+		}
+		return gr.Branch{IDs: [2]int{uNodes[0].Id(), wNodes[0].Id()}}
+	}
+	reticulations := []map[string]gr.Branch{
+		{"#H1": branch("F", "E")},
+		{"#H1": branch("F", "E"), "#H2": branch("b", "A")},
+	}
+	var buf bytes.Buffer
+	if err := WriteReticulationBipartitionsToCSV(td, reticulations, map[string][]string{"F": {"G"}}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Number of Branches,Reticulation,Hybrid Taxa,Donor Taxa,Sister Taxa\n" +
+		"1,#H1,E,\"F,G\",D\n" +
+		"2,#H1,E,\"F,G\",D\n" +
+		"2,#H2,A,\"B,C,F,G\",\"B,C,F,G\"\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+// Tree data for a constraint tree whose traversal order (D, C, E, B, A) is not
+// its tip index order, which is alphabetical, with a function making branches
+// from the labels of their ends
+func unsortedTreeData(t *testing.T) (*gr.TreeData, func(u, w string) gr.Branch) {
+	t.Helper()
+	tre, err := newick.NewParser(strings.NewReader("((D,(C,E)x)y,(B,A)z)r;")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	td := gr.MakeTreeData(tre, nil)
+	id := func(label string) int {
+		nodes, err := td.SelectNodes(label)
+		if err != nil || len(nodes) != 1 {
+			t.Fatalf("cannot find node %s", label)
+		}
+		return nodes[0].Id()
+	}
+	return td, func(u, w string) gr.Branch { return gr.Branch{IDs: [2]int{id(u), id(w)}} }
+}
+
+func TestWriteAlternativesToCSV(t *testing.T) {
+	td, branch := unsortedTreeData(t)
+	reticulations := []map[string]gr.Branch{{"#H1": branch("D", "C")}}
+	alternatives := [][]Alternative{{
+		{Branch: branch("z", "x"), Replaces: branch("D", "C"), Score: 3, Gap: 1, QSat: 50},
+		{Branch: branch("A", "E"), Replaces: branch("D", "C"), Score: 2, Gap: 2, QSat: 25},
+	}}
+	var buf bytes.Buffer
+	if err := WriteAlternativesToCSV(td, alternatives, reticulations, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Number of Branches,Rank,U Clade,W Clade,Replaces,Score,Gap,Quartet Satisfied Percent\n" +
+		"1,1,\"{A,B}\",\"{C,E}\",#H1,3,1,50\n" +
+		"1,2,{A},{E},#H1,2,2,25\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteExclusionSupportToCSV(t *testing.T) {
+	td, branch := unsortedTreeData(t)
+	branches := []gr.Branch{branch("A", "E"), branch("z", "x")}
+	labeled := map[string]gr.Branch{"#H1": branches[1], "#H2": branches[0]}
+	var buf bytes.Buffer
+	if err := WriteExclusionSupportToCSV(td, branches, labeled, 10, []float64{8, 4}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Reticulation,U Clade,W Clade,Score,Best Score Without,Support\n" +
+		"#H1,\"{A,B}\",\"{C,E}\",10,4,6\n" +
+		"#H2,{A},{E},10,8,2\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteBranchScoresToCSV(t *testing.T) {
+	td, branch := unsortedTreeData(t)
+	scores := []BranchScore{
+		{Branch: branch("z", "x"), Satisfied: 3, Percent: 30},
+		{Branch: branch("A", "E"), Satisfied: 1, Percent: 10},
+	}
+	var buf bytes.Buffer
+	if err := WriteBranchScoresToCSV(td, scores, gr.DefaultRetLabeling, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Reticulation,U Clade,W Clade,Quartets Satisfied,Quartet Satisfied Percent\n" +
+		"#H1,\"{A,B}\",\"{C,E}\",3,30\n" +
+		"#H2,{A},{E},1,10\n" +
+		"total,,,4,40\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteOverlapsToCSV(t *testing.T) {
+	td, branch := unsortedTreeData(t)
+	reticulations := map[string]gr.Branch{"#H1": branch("D", "C"), "#H2": branch("B", "A")}
+	overlaps := []Overlap{
+		{Branch: branch("z", "x"), Score: 3, Conflicts: []gr.Branch{branch("B", "A"), branch("D", "C")}},
+		{Branch: branch("A", "E"), Score: 1, Conflicts: []gr.Branch{branch("D", "C")}},
+	}
+	var buf bytes.Buffer
+	if err := WriteOverlapsToCSV(td, overlaps, reticulations, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Rank,U Clade,W Clade,Score,Overlaps\n" +
+		"1,\"{A,B}\",\"{C,E}\",3,#H1 #H2\n" +
+		"2,{A},{E},1,#H1\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteConcordanceToCSV(t *testing.T) {
+	td, branch := unsortedTreeData(t)
+	ids := branch("x", "z").IDs
+	x, z := ids[gr.Ui], ids[gr.Wi]
+	concordance := map[int]Concordance{
+		x: {Concordant: 4, Discordant: [2]uint64{1, 1}, Informative: 3, QC: 0.5, QD: 1, QI: 1},
+		z: {Concordant: 2, Discordant: [2]uint64{2, 0}, Informative: 2, QC: 0, QD: 0, QI: 0.5},
+	}
+	var buf bytes.Buffer
+	if err := WriteConcordanceToCSV(td, concordance, &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows := map[int]string{
+		x: "\"{C,E}\",4,1,1,3,0.5,1,1\n",
+		z: "\"{A,B}\",2,2,0,2,0,0,0.5\n",
+	}
+	expected := "Clade,Concordant,Discordant 1,Discordant 2,Informative Genes,QC,QD,QI\n" + rows[min(x, z)] + rows[max(x, z)]
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteMinorFrequenciesToCSV(t *testing.T) {
+	br1, br2 := gr.Branch{IDs: [2]int{1, 2}}, gr.Branch{IDs: [2]int{3, 4}}
+	reticulations := []map[string]gr.Branch{
+		{"#H1": br1},
+		{"#H1": br1, "#H2": br2},
+	}
+	freqs := map[gr.Branch]float64{br1: 0.25, br2: math.NaN()}
+	var buf bytes.Buffer
+	if err := WriteMinorFrequenciesToCSV(reticulations, freqs, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Number of Branches,Reticulation,Approximate Minor Frequency\n" +
+		"1,#H1,0.25\n" +
+		"2,#H1,0.25\n" +
+		"2,#H2,\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteDPResultsToJSON(t *testing.T) {
+	br1, br2 := gr.Branch{IDs: [2]int{1, 2}}, gr.Branch{IDs: [2]int{3, 4}}
+	meta := RunMetadata{Version: "v1", Command: "camus a b", Flags: map[string]string{"k": "2"}, Seed: 7,
+		Timings: []PhaseTiming{{Phase: "dp", Seconds: 0.5}}}
+	var buf bytes.Buffer
+	err := WriteDPResultsToJSON(meta, "((A,B),(C,D));", []string{"net1", "net2"}, []float64{50, 75}, []string{"0", "9007199254740993", "12"},
+		[]map[string]gr.Branch{{"#H1": br1}, {"#H1": br1, "#H2": br2}}, map[gr.Branch]float64{br1: 3, br2: 1.5}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Metadata       RunMetadata `json:"metadata"`
+		ConstraintTree string      `json:"constraint_tree"`
+		Networks       []struct {
+			NumBranches int         `json:"number_of_branches"`
+			QSat        float64     `json:"quartet_satisfied_percent"`
+			Score       json.Number `json:"score"`
+			Newick      string      `json:"extended_newick"`
+			Branches    []struct {
+				Reticulation string  `json:"reticulation"`
+				U            int     `json:"u"`
+				W            int     `json:"w"`
+				Score        float64 `json:"score"`
+			} `json:"branches"`
+		} `json:"networks"`
+	}
+	dec := json.NewDecoder(&buf)
+	dec.UseNumber()
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("output is not valid json: %s", err)
+	}
+	if !reflect.DeepEqual(got.Metadata, meta) {
+		t.Errorf("got metadata %+v, expected %+v", got.Metadata, meta)
+	}
+	if got.ConstraintTree != "((A,B),(C,D));" || len(got.Networks) != 3 {
+		t.Fatalf("got constraint tree %s and %d networks", got.ConstraintTree, len(got.Networks))
+	}
+	if n := got.Networks[0]; n.NumBranches != 0 || n.Newick != got.ConstraintTree || len(n.Branches) != 0 {
+		t.Errorf("unexpected network without branches %+v", n)
+	}
+	if n := got.Networks[1]; n.Score != "9007199254740993" || n.QSat != 50 || n.Newick != "net1" {
+		t.Errorf("unexpected network with one branch %+v", n)
+	}
+	n := got.Networks[2]
+	if len(n.Branches) != 2 {
+		t.Fatalf("got %d branches, expected 2", len(n.Branches))
+	}
+	if b := n.Branches[1]; b.Reticulation != "#H2" || b.U != 3 || b.W != 4 || b.Score != 1.5 {
+		t.Errorf("unexpected branch %+v", b)
+	}
+}
+
+func TestWriteRetScoresInParts(t *testing.T) {
+	scores := []*map[string]float64{
+		{"#H1": 1, "#H2": 0.5},
+		{"#H1": math.NaN(), "#H2": 0},
+		{"#H1": 0.25, "#H2": math.NaN()},
+	}
+	names := []string{"g1", "g2", "g3"}
+	files := make([]string, 0)
+	bufs := make([]bytes.Buffer, 0)
+	parts, err := WriteRetScoresInParts(scores, names, 2, func(part int, writePart func(io.Writer) error) (string, error) {
+		files = append(files, fmt.Sprintf("scores_%d.csv", part))
+		bufs = append(bufs, bytes.Buffer{})
+		return files[len(files)-1], writePart(&bufs[len(bufs)-1])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"gene,#H1,#H2\ng1,1,0.5\ng2,NaN,0\n",
+		"gene,#H1,#H2\ng3,0.25,NaN\ninformative fraction,0.6666666666666666,0.6666666666666666\n",
+	}
+	if len(bufs) != len(expected) {
+		t.Fatalf("got %d parts, expected %d", len(bufs), len(expected))
+	}
+	for i := range expected {
+		if bufs[i].String() != expected[i] {
+			t.Errorf("part %d: got\n%s\nexpected\n%s", i+1, bufs[i].String(), expected[i])
+		}
+	}
+	var index bytes.Buffer
+	if err := WriteScorePartsIndexToCSV(parts, &index); err != nil {
+		t.Fatal(err)
+	}
+	expectedIndex := "part,file,first gene,last gene,genes\n" +
+		"1,scores_1.csv,g1,g2,2\n" +
+		"2,scores_2.csv,g3,g3,1\n"
+	if index.String() != expectedIndex {
+		t.Errorf("got\n%s\nexpected\n%s", index.String(), expectedIndex)
+	}
+}
+
+func TestReadEdgesFile(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contents    string
+		expected    []EdgeEnds
+		expectedErr error
+	}{
+		{
+			name:     "labels and clades",
+			contents: "u,w\nA,C\n\"{A,B}\", x\n# comment\n\"C,D\",\"{E}\"\n",
+			expected: []EdgeEnds{
+				{U: EdgeEnd{Label: "A"}, W: EdgeEnd{Label: "C"}},
+				{U: EdgeEnd{Clade: []string{"A", "B"}}, W: EdgeEnd{Label: "x"}},
+				{U: EdgeEnd{Clade: []string{"C", "D"}}, W: EdgeEnd{Clade: []string{"E"}}},
+			},
+		},
+		{name: "output header", contents: "U Clade,W Clade\nA,C\n", expected: []EdgeEnds{{U: EdgeEnd{Label: "A"}, W: EdgeEnd{Label: "C"}}}},
+		{name: "one column", contents: "A,C\nB\n", expectedErr: ErrInvalidFile},
+		{name: "empty end", contents: "A,\n", expectedErr: ErrInvalidFile},
+		{name: "only header", contents: "u,w\n", expectedErr: ErrInvalidFile},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "edges.csv")
+			if err := os.WriteFile(path, []byte(test.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			edges, err := ReadEdgesFile(path)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err == nil && !reflect.DeepEqual(edges, test.expected) {
+				t.Errorf("got %v, expected %v", edges, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package prep
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// How gene trees with more than one copy of a taxon (MUL trees, e.g., from
+// gene duplication) are handled
+type MulMode int
+
+const (
+	MulError    MulMode = iota // MUL trees are an error (ErrMulTree)
+	MulCollapse                // only the first copy of each taxon is kept
+	MulCopies                  // quartets of every choice of copies are counted, down-weighted by the number of choices
+)
+
+var ParseMulMode = map[string]MulMode{
+	"error":    MulError,
+	"collapse": MulCollapse,
+	"copies":   MulCopies,
+}
+
+func (m *MulMode) Set(s string) error {
+	if mode, ok := ParseMulMode[s]; ok {
+		*m = mode
+		return nil
+	}
+	return fmt.Errorf("\"%s\" is not a valid MUL tree mode", s)
+}
+
+func (m MulMode) String() string {
+	for s, mm := range ParseMulMode {
+		if mm == m {
+			return s
+		}
+	}
+	panic(fmt.Sprintf("invalid MUL tree mode %d", int(m)))
+}
+
+// Removes every copy of each taxon but the first (in the order the tips
+// appear) from each gene tree, returning the number of trees that had
+// duplicate copies. Gene trees are indexed again.
+func CollapseDuplicateTaxa(geneTrees []*tree.Tree) (int, error) {
+	collapsed := 0
+	for _, gt := range geneTrees {
+		n, err := collapseDuplicateTips(gt)
+		if err != nil {
+			return collapsed, err
+		}
+		if n != 0 {
+			collapsed++
+		}
+	}
+	return collapsed, nil
+}
+
+// Removes every copy of each taxon but the first from gt and indexes it,
+// returning the number of tips removed
+func collapseDuplicateTips(gt *tree.Tree) (int, error) {
+	seen := make(map[string]bool)
+	drop := make([]string, 0)
+	for _, tip := range gt.Tips() {
+		if seen[tip.Name()] {
+			name := "\x00copy" + strconv.Itoa(len(drop)) // tips are removed by name
+			tip.SetName(name)
+			drop = append(drop, name)
+			continue
+		}
+		seen[tip.Name()] = true
+	}
+	if len(drop) != 0 {
+		if err := gt.RemoveTips(false, drop...); err != nil {
+			return 0, err
+		}
+	}
+	if err := gt.UpdateTipIndex(); err != nil {
+		return 0, err
+	}
+	return len(drop), nil
+}
+
+// Number of distinct taxa in a gene tree (which may have more than one copy
+// of some)
+func numTaxa(gt *tree.Tree) int {
+	taxa := make(map[string]bool)
+	for _, tip := range gt.Tips() {
+		taxa[tip.Name()] = true
+	}
+	return len(taxa)
+}
@@ -0,0 +1,336 @@
+package prep
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Most taxa listed when describing where a label is
+const maxListedTaxa = 4
+
+// Characters of newick shown on each side of a label
+const snippetContext = 25
+
+// Occurrence of a reticulation label in a network
+type labelOccurrence struct {
+	node    *tree.Node
+	snippet string // newick around the label (empty if it could not be found)
+}
+
+// Describes every problem with the reticulation labels of network, saying
+// where each label occurs and how it might be fixed. Each label should appear
+// exactly twice: once as a leaf (the copy attached to the second parent) and
+// once labeling the hybrid node.
+func diagnoseReticulationLabels(ntw *tree.Tree) []string {
+	occurrences := make(map[string][]labelOccurrence)
+	// post order matches the order labels are written in newick
+	ntw.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) bool {
+		if strings.Contains(cur.Name(), "#") {
+			occurrences[cur.Name()] = append(occurrences[cur.Name()], labelOccurrence{node: cur})
+		}
+		return true
+	})
+	nwk := ntw.Newick()
+	for label, occs := range occurrences {
+		if offsets := labelOffsets(nwk, label); len(offsets) == len(occs) {
+			for i, off := range offsets {
+				occs[i].snippet = newickSnippet(nwk, off, len(label))
+			}
+		}
+	}
+	problems := make([]string, 0)
+	for _, label := range SortedRetLabels(occurrences) {
+		occs := occurrences[label]
+		var leaves, clades []labelOccurrence
+		for _, occ := range occs {
+			if occ.node.Tip() {
+				leaves = append(leaves, occ)
+			} else {
+				clades = append(clades, occ)
+			}
+		}
+		var problem string
+		switch {
+		case len(occs) > 2:
+			problem = fmt.Sprintf("%s appears %d times; each label should appear exactly twice, once as a leaf and once labeling the hybrid clade (did two reticulations get the same label?)", label, len(occs))
+		case len(leaves) == 1 && len(clades) == 0:
+			problem = fmt.Sprintf("%s only appears as a leaf; the hybrid clade is missing its label, which should follow its closing parenthesis, e.g., (A,B)%s", label, label)
+		case len(leaves) == 0 && len(clades) == 1:
+			problem = fmt.Sprintf("%s only labels a clade; the leaf copy is missing, and %s should be added as a leaf next to the hybrid's second parent", label, label)
+		case len(leaves) == 2:
+			problem = fmt.Sprintf("%s appears as a leaf twice; one of them should instead label the hybrid clade", label)
+		case len(clades) == 2:
+			problem = fmt.Sprintf("%s labels two clades; one of them should instead be a leaf copy next to the hybrid's second parent", label)
+		case len(siblings(leaves[0].node)) == 0:
+			problem = fmt.Sprintf("%s leaf copy has no sibling, so the branch it is on cannot be found", label)
+		case len(children(clades[0].node)) == 0:
+			problem = fmt.Sprintf("%s labels a node with nothing below it", label)
+		default:
+			continue
+		}
+		if similar := similarLabels(label, occurrences); len(similar) != 0 {
+			problem += fmt.Sprintf("; labels differing only by case: %s", strings.Join(similar, ", "))
+		}
+		for _, occ := range occs {
+			problem += "\n    " + describeOccurrence(occ)
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// Describes where a label occurrence is in the network
+func describeOccurrence(occ labelOccurrence) string {
+	var where string
+	if occ.node.Tip() {
+		where = "leaf next to " + listTaxa(taxaBelow(siblings(occ.node), occ.node.Neigh()[0]))
+	} else {
+		where = "clade containing " + listTaxa(taxaBelow(children(occ.node), occ.node))
+	}
+	if occ.snippet != "" {
+		where += fmt.Sprintf(" at %s", occ.snippet)
+	}
+	return where
+}
+
+// Children of n's parent other than n
+func siblings(n *tree.Node) []*tree.Node {
+	parent, err := n.Parent()
+	if err != nil {
+		return nil
+	}
+	sibs := make([]*tree.Node, 0)
+	for _, c := range children(parent) {
+		if c != n {
+			sibs = append(sibs, c)
+		}
+	}
+	return sibs
+}
+
+func children(n *tree.Node) []*tree.Node {
+	parent, _ := n.Parent()
+	result := make([]*tree.Node, 0)
+	for _, c := range n.Neigh() {
+		if c != parent {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Taxa (not reticulation leaves) in the subtrees at each of nodes, which are
+// all below parent
+func taxaBelow(nodes []*tree.Node, parent *tree.Node) []string {
+	taxa := make([]string, 0)
+	var collect func(cur, prev *tree.Node)
+	collect = func(cur, prev *tree.Node) {
+		if cur.Tip() && !strings.Contains(cur.Name(), "#") {
+			taxa = append(taxa, cur.Name())
+		}
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				collect(n, cur)
+			}
+		}
+	}
+	for _, n := range nodes {
+		collect(n, parent)
+	}
+	return taxa
+}
+
+func listTaxa(taxa []string) string {
+	if len(taxa) == 0 {
+		return "{}"
+	}
+	slices.Sort(taxa)
+	if len(taxa) > maxListedTaxa {
+		return fmt.Sprintf("{%s, ... (%d taxa)}", strings.Join(taxa[:maxListedTaxa], ","), len(taxa))
+	}
+	return "{" + strings.Join(taxa, ",") + "}"
+}
+
+// Other labels that match label ignoring case
+func similarLabels(label string, occurrences map[string][]labelOccurrence) []string {
+	similar := make([]string, 0)
+	for _, other := range slices.Sorted(maps.Keys(occurrences)) {
+		if other != label && strings.EqualFold(other, label) {
+			similar = append(similar, other)
+		}
+	}
+	return similar
+}
+
+// Offsets of label in newick string where it is a whole node name
+func labelOffsets(nwk, label string) []int {
+	offsets := make([]int, 0)
+	for start := 0; ; {
+		i := strings.Index(nwk[start:], label)
+		if i == -1 {
+			return offsets
+		}
+		i += start
+		start = i + len(label)
+		if start < len(nwk) && !strings.ContainsRune("(),:;[", rune(nwk[start])) {
+			continue
+		}
+		offsets = append(offsets, i)
+	}
+}
+
+func newickSnippet(nwk string, off, n int) string {
+	lo, hi := max(off-snippetContext, 0), min(off+n+snippetContext, len(nwk))
+	snippet := nwk[lo:hi]
+	if lo > 0 {
+		snippet = "..." + snippet
+	}
+	if hi < len(nwk) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+// Rewrites a network in Rich Newick as written by PhyloNet or SNaQ into the
+// form used by CAMUS: hybrid labels with a node name before the # (e.g.,
+// I3#H1) are reduced to the # tag, and a network with three children at the
+// root (SNaQ writes networks unrooted) is rooted on the edge above the first
+// child. Returns true if the network was rooted.
+func NormalizeRichNewick(ntw *tree.Tree) (bool, error) {
+	for _, n := range ntw.Nodes() {
+		if i := strings.Index(n.Name(), "#"); i > 0 {
+			n.SetName(n.Name()[i:])
+		}
+	}
+	if ntw.Root().Nneigh() != 3 {
+		return false, nil
+	}
+	// gotree indexes all node names when rerooting, so hybrid node labels
+	// (which repeat a leaf's) are set aside until it's done
+	internal := make(map[*tree.Node]string)
+	for _, n := range ntw.Nodes() {
+		if !n.Tip() && n.Name() != "" {
+			internal[n] = n.Name()
+			n.SetName("")
+		}
+	}
+	if err := ntw.UpdateTipIndex(); err != nil {
+		return false, fmt.Errorf("network %w", ErrMulTree)
+	}
+	outgroup := make([]string, 0)
+	for _, tip := range taxaTips(ntw.Root().Neigh()[0], ntw.Root()) {
+		outgroup = append(outgroup, tip.Name())
+	}
+	if err := ntw.RerootOutGroup(false, true, outgroup...); err != nil {
+		return false, fmt.Errorf("%w, could not root network: %s", ErrUnrooted, err.Error())
+	}
+	for n, name := range internal {
+		n.SetName(name)
+	}
+	for i, n := range ntw.Nodes() { // node ids must be continuous
+		n.SetId(i)
+	}
+	if err := ntw.UpdateTipIndex(); err != nil {
+		return true, fmt.Errorf("network %w", ErrMulTree)
+	}
+	return true, nil
+}
+
+// Rewrites hybrid nodes written as two labeled copies of the same clade (as
+// some tools do) into the form used by CAMUS, where the second copy is
+// replaced by a leaf with the label. Copies with different taxa are left alone
+// so they are reported when the network is converted. Returns the number of
+// hybrid nodes rewritten.
+func NormalizeHybridCopies(ntw *tree.Tree) (int, error) {
+	rewritten := 0
+	for {
+		copies := make(map[string][]*tree.Node)
+		ntw.PostOrder(func(cur, prev *tree.Node, e *tree.Edge) bool {
+			if strings.Contains(cur.Name(), "#") {
+				copies[cur.Name()] = append(copies[cur.Name()], cur)
+			}
+			return true
+		})
+		var label string
+		for _, l := range SortedRetLabels(copies) {
+			if isDuplicatedClade(copies[l]) {
+				label = l
+				break
+			}
+		}
+		if label == "" {
+			break
+		}
+		// nested labels in the second copy are removed with it, so they are
+		// found again on the next pass
+		if err := replaceWithLeaf(ntw, copies[label][1], label); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	if rewritten != 0 {
+		for i, n := range ntw.Nodes() { // node ids must be continuous
+			n.SetId(i)
+		}
+		if err := ntw.UpdateTipIndex(); err != nil {
+			return rewritten, fmt.Errorf("network %w", ErrMulTree)
+		}
+	}
+	return rewritten, nil
+}
+
+// True if nodes are two clades with the same taxa
+func isDuplicatedClade(nodes []*tree.Node) bool {
+	if len(nodes) != 2 || nodes[0].Tip() || nodes[1].Tip() {
+		return false
+	}
+	taxa1 := taxaBelow(children(nodes[0]), nodes[0])
+	taxa2 := taxaBelow(children(nodes[1]), nodes[1])
+	slices.Sort(taxa1)
+	slices.Sort(taxa2)
+	return len(taxa1) != 0 && slices.Equal(taxa1, taxa2)
+}
+
+// Replaces subtree at n with a leaf named label
+func replaceWithLeaf(ntw *tree.Tree, n *tree.Node, label string) error {
+	edge, err := n.ParentEdge()
+	if err != nil {
+		return err
+	}
+	leaf := ntw.NewNode()
+	leaf.SetName(label)
+	if _, _, _, err := ntw.GraftTipOnEdge(leaf, edge); err != nil {
+		return err
+	}
+	drop := make([]string, 0)
+	for _, tip := range taxaTips(n, leaf.Neigh()[0]) {
+		name := fmt.Sprintf("####drop%d", len(drop))
+		tip.SetName(name)
+		drop = append(drop, name)
+	}
+	if err := ntw.RemoveTips(false, drop...); err != nil {
+		return err
+	}
+	for _, e := range leaf.Edges() {
+		e.SetLength(tree.NIL_LENGTH)
+	}
+	return nil
+}
+
+// All tips below cur (coming from prev)
+func taxaTips(cur, prev *tree.Node) []*tree.Node {
+	if cur.Tip() {
+		return []*tree.Node{cur}
+	}
+	tips := make([]*tree.Node, 0)
+	for _, n := range cur.Neigh() {
+		if n != prev {
+			tips = append(tips, taxaTips(n, cur)...)
+		}
+	}
+	return tips
+}
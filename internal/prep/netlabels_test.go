@@ -0,0 +1,174 @@
+package prep
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+func TestDiagnoseReticulationLabels(t *testing.T) {
+	testCases := []struct {
+		name     string
+		network  string
+		expected []string // substring of each problem, in order
+	}{
+		{
+			name:     "valid",
+			network:  "((A,(B)#H1),(C,(#H1,D)));",
+			expected: []string{},
+		},
+		{
+			name:    "case mismatch",
+			network: "((A,(B)#H1),(C,(#h1,D)));",
+			expected: []string{
+				"#H1 only labels a clade; the leaf copy is missing",
+				"#h1 only appears as a leaf; the hybrid clade is missing its label",
+			},
+		},
+		{
+			name:     "two clades",
+			network:  "((A,(B)#H1),(C,(D,(E)#H1)));",
+			expected: []string{"#H1 labels two clades"},
+		},
+		{
+			name:     "two leaves",
+			network:  "((A,#H1),(C,(#H1,D)));",
+			expected: []string{"#H1 appears as a leaf twice"},
+		},
+		{
+			name:     "duplicate label",
+			network:  "((A,(B)#H1),((C,(#H1,D)),((#H1,E),(F)#H1)));",
+			expected: []string{"#H1 appears 4 times"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ntw, err := newick.NewParser(strings.NewReader(tc.network)).Parse()
+			if err != nil {
+				t.Fatalf("cannot parse %s", tc.network)
+			}
+			problems := diagnoseReticulationLabels(ntw)
+			if len(problems) != len(tc.expected) {
+				t.Fatalf("got %d problems %v, expected %d", len(problems), problems, len(tc.expected))
+			}
+			for i, problem := range problems {
+				if !strings.Contains(problem, tc.expected[i]) {
+					t.Errorf("got problem %q, expected it to contain %q", problem, tc.expected[i])
+				}
+			}
+			if len(problems) == 0 {
+				return
+			}
+			if _, err := ConvertToNetwork(ntw); !errors.Is(err, ErrInvalidFormat) || !strings.Contains(err.Error(), tc.expected[0]) {
+				t.Errorf("expected ConvertToNetwork to fail with diagnostics, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNormalizeHybridCopies(t *testing.T) {
+	testCases := []struct {
+		name      string
+		network   string
+		expected  string
+		rewritten int
+	}{
+		{
+			name:      "already normalized",
+			network:   "((A,(B)#H1),(C,(#H1,D)));",
+			expected:  "((A,(B)#H1),(C,(#H1,D)));",
+			rewritten: 0,
+		},
+		{
+			name:      "duplicated clade",
+			network:   "((A,(B)#H1),(C,((B)#H1,D)));",
+			expected:  "((A,(B)#H1),(C,(D,#H1)));",
+			rewritten: 1,
+		},
+		{
+			name:      "duplicated clade with more than one taxon",
+			network:   "((A,((B,E))#H1),(C,(((E,B))#H1,D)));",
+			expected:  "((A,((B,E))#H1),(C,(D,#H1)));",
+			rewritten: 1,
+		},
+		{
+			name:      "nested",
+			network:   "((A,((B,(E)#H2))#H1),(C,(((B,(E)#H2))#H1,D)),(#H2,F));",
+			expected:  "((A,((B,(E)#H2))#H1),(C,(D,#H1)),(#H2,F));",
+			rewritten: 1,
+		},
+		{
+			name:      "different taxa",
+			network:   "((A,(B)#H1),(C,(D,(E)#H1)));",
+			expected:  "((A,(B)#H1),(C,(D,(E)#H1)));",
+			rewritten: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ntw, err := newick.NewParser(strings.NewReader(tc.network)).Parse()
+			if err != nil {
+				t.Fatalf("cannot parse %s: %s", tc.network, err)
+			}
+			rewritten, err := NormalizeHybridCopies(ntw)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if rewritten != tc.rewritten {
+				t.Errorf("rewrote %d, expected %d", rewritten, tc.rewritten)
+			}
+			if ntw.Newick() != tc.expected {
+				t.Errorf("got %s, expected %s", ntw.Newick(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeRichNewick(t *testing.T) {
+	testCases := []struct {
+		name     string
+		network  string
+		expected string
+		rooted   bool
+	}{
+		{
+			name:     "extended newick",
+			network:  "((A,(B)#H1),(C,(#H1,D)));",
+			expected: "((A,(B)#H1),(C,(#H1,D)));",
+		},
+		{
+			name:     "phylonet",
+			network:  "((A:1.0,(B:0.5)I4#H1:0.2::0.7):1.0,(C:1.0,(I4#H1:0.1::0.3,D:1.0)I2:0.5)I1:1.0)I0;",
+			expected: "((A,(B)#H1),(C,(#H1,D)I2)I1)I0;",
+		},
+		{
+			name:     "snaq",
+			network:  "(A:1.0,(B:0.5)#H1:0.2::0.7,(C:1.0,(#H1:0.1::0.3,D:1.0):0.5):1.0);",
+			expected: "(((B)#H1,(C,(#H1,D))),A);",
+			rooted:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ntw, err := parseTree([]byte(tc.network), "test")
+			if err != nil {
+				t.Fatalf("cannot parse %s: %s", tc.network, err)
+			}
+			rooted, err := NormalizeRichNewick(ntw)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if rooted != tc.rooted {
+				t.Errorf("got rooted %t, expected %t", rooted, tc.rooted)
+			}
+			if ntw.Newick() != tc.expected {
+				t.Errorf("got %s, expected %s", ntw.Newick(), tc.expected)
+			}
+			if _, err := ConvertToNetwork(ntw); err != nil {
+				t.Errorf("cannot convert normalized network: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package prep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	"github.com/jsdoublel/camus/internal/pool"
+)
+
+// Tree statement from the trees block of a nexus file
+type nexusTree struct {
+	name    string
+	newick  string
+	comment string // comment before the statement (e.g., the scores written by WriteNetworksNexus)
+}
+
+// Reads the trees blocks of a nexus file. Statements are split up in one pass
+// and the trees are then parsed in parallel, which is much faster than
+// gotree's nexus parser for files with many trees. Other blocks are skipped.
+// Trees that can't be parsed are left out and listed in GeneTrees.Skipped if
+// skipInvalid is set.
+func parseNexusTrees(data []byte, nprocs int, skipInvalid bool) (*GeneTrees, error) {
+	trees, translate, err := nexusTreeStatements(data)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([]*tree.Tree, len(trees))
+	errs := make([]error, len(trees))
+	pool.Run(len(trees), nprocs, func(i int) {
+		parsed[i], errs[i] = trees[i].parse(translate)
+	})
+	geneTrees := &GeneTrees{Trees: make([]*tree.Tree, 0, len(trees)), Names: make([]string, 0, len(trees))}
+	for i, err := range errs {
+		switch {
+		case err != nil && skipInvalid:
+			geneTrees.Skipped = append(geneTrees.Skipped, SkippedTree{Index: i, Name: trees[i].name, Err: err})
+		case err != nil:
+			return nil, fmt.Errorf("tree %s: %s", trees[i].name, err.Error())
+		default:
+			geneTrees.Trees = append(geneTrees.Trees, parsed[i])
+			geneTrees.Names = append(geneTrees.Names, trees[i].name)
+		}
+	}
+	return geneTrees, nil
+}
+
+// Splits the trees blocks of a nexus file into tree statements (without
+// parsing the trees), also returning the translate table (nil if none)
+func nexusTreeStatements(data []byte) ([]nexusTree, map[string]string, error) {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) < 6 || !strings.EqualFold(string(data[:6]), "#nexus") {
+		return nil, nil, fmt.Errorf("missing #NEXUS header")
+	}
+	statements, err := nexusStatements(data[6:])
+	if err != nil {
+		return nil, nil, err
+	}
+	var translate map[string]string
+	trees := make([]nexusTree, 0)
+	inTrees := false
+	for _, stmt := range statements {
+		keyword, rest := nexusKeyword(stmt)
+		switch {
+		case keyword == "begin":
+			inTrees = strings.EqualFold(strings.TrimSpace(rest), "trees")
+		case keyword == "end" || keyword == "endblock":
+			inTrees = false
+		case !inTrees:
+			continue
+		case keyword == "translate":
+			if translate, err = parseTranslate(rest); err != nil {
+				return nil, nil, err
+			}
+		case keyword == "tree" || keyword == "utree":
+			name, nwk, ok := strings.Cut(rest, "=")
+			if !ok {
+				return nil, nil, fmt.Errorf("expecting '=' after tree name in %q", abbreviate(stmt))
+			}
+			trees = append(trees, nexusTree{
+				name:    unquote(strings.TrimSpace(name)),
+				newick:  skipComments(nwk) + ";",
+				comment: leadingComment(stmt),
+			})
+		}
+	}
+	if len(trees) == 0 {
+		return nil, nil, fmt.Errorf("no trees found")
+	}
+	return trees, translate, nil
+}
+
+// Parses the tree, translating tip names with translate (if not nil)
+func (t nexusTree) parse(translate map[string]string) (*tree.Tree, error) {
+	tre, err := newick.NewParser(strings.NewReader(t.newick)).Parse()
+	if err == nil && translate != nil {
+		err = translateTips(tre, translate)
+	}
+	return tre, err
+}
+
+// Splits data into statements ending in ';', ignoring semicolons inside
+// comments and quoted labels
+func nexusStatements(data []byte) ([]string, error) {
+	statements := make([]string, 0)
+	start, depth, quoted := 0, 0, false
+	for i, c := range data {
+		switch {
+		case quoted:
+			quoted = c != '\''
+		case c == '\'':
+			quoted = true
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			statements = append(statements, string(data[start:i]))
+			start = i + 1
+		}
+	}
+	if depth != 0 || quoted {
+		return nil, fmt.Errorf("unterminated comment or quote")
+	}
+	if rest := skipComments(string(data[start:])); rest != "" {
+		return nil, fmt.Errorf("statement %q not ended by ';'", abbreviate(rest))
+	}
+	return statements, nil
+}
+
+// Lower case first word of statement and the rest of the statement
+func nexusKeyword(stmt string) (string, string) {
+	stmt = skipComments(stmt)
+	end := strings.IndexAny(stmt, " \t\r\n")
+	if end == -1 {
+		return strings.ToLower(stmt), ""
+	}
+	return strings.ToLower(stmt[:end]), stmt[end:]
+}
+
+// Trims whitespace and comments from the start of s
+func skipComments(s string) string {
+	s = strings.TrimSpace(s)
+	for strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end == -1 {
+			return s
+		}
+		s = strings.TrimSpace(s[end+1:])
+	}
+	return s
+}
+
+// Text of the comment at the start of s (empty if none)
+func leadingComment(s string) string {
+	s = strings.TrimSpace(s)
+	end := strings.Index(s, "]")
+	if !strings.HasPrefix(s, "[") || end == -1 {
+		return ""
+	}
+	return s[1:end]
+}
+
+// Parses translate table of comma separated "key label" pairs
+func parseTranslate(body string) (map[string]string, error) {
+	table := make(map[string]string)
+	for entry := range strings.SplitSeq(body, ",") {
+		fields := strings.Fields(skipComments(entry))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid translate entry %q", strings.TrimSpace(entry))
+		}
+		table[fields[0]] = unquote(fields[1])
+	}
+	return table, nil
+}
+
+func translateTips(t *tree.Tree, table map[string]string) error {
+	for _, tip := range t.Tips() {
+		if name, ok := table[tip.Name()]; ok {
+			tip.SetName(name)
+		}
+	}
+	return t.UpdateTipIndex()
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// Start of long statements for error messages
+func abbreviate(s string) string {
+	const maxLen = 40
+	s = strings.TrimSpace(s)
+	if len(s) > maxLen {
+		return s[:maxLen] + "..."
+	}
+	return s
+}
+
+// Writes the constraint tree and the optimal networks (one per number of
+// edges, starting from the constraint tree at k = 0) to w as a nexus trees
+// block with a translate table, which Dendroscope and IcyTree can open.
+// Taxa are numbered in sorted order, and reticulation labels are kept as they
+// are. The percent of quartets satisfied and dp score of each network are
+// written in a comment before it.
+func WriteNetworksNexus(constTree *tree.Tree, networks []*gr.Network, qsat []float64, scores []string, w io.Writer) error {
+	if len(networks) != len(qsat) || len(scores) != len(networks)+1 {
+		panic(fmt.Sprintf("there should be a score for every network, %d %+v %+v", len(networks), qsat, scores))
+	}
+	taxa := constTree.AllTipNames()
+	slices.Sort(taxa)
+	numbers := make(map[string]string, len(taxa))
+	var b strings.Builder
+	b.WriteString("#NEXUS\n\nBEGIN TREES;\n\tTRANSLATE\n")
+	for i, taxon := range taxa {
+		numbers[taxon] = strconv.Itoa(i + 1)
+		sep := ","
+		if i == len(taxa)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "\t\t%d %s%s\n", i+1, nexusQuote(taxon), sep)
+	}
+	b.WriteString("\t;\n")
+	fmt.Fprintf(&b, "\t[k = 0, score = %s]\n", scores[0])
+	fmt.Fprintf(&b, "\tTREE k0 = [&R] %s\n", withTipNames(constTree, numbers, constTree.Newick))
+	for i, ntw := range networks {
+		fmt.Fprintf(&b, "\t[k = %d, quartets satisfied = %s%%, score = %s]\n",
+			i+1, strconv.FormatFloat(qsat[i], 'f', -1, 64), scores[i+1])
+		fmt.Fprintf(&b, "\tTREE k%d = [&R] %s\n", i+1, withTipNames(ntw.NetTree, numbers, ntw.Newick))
+	}
+	b.WriteString("END;\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("%w, %w", ErrWritingFile, err)
+	}
+	return nil
+}
+
+var nexusQSat = regexp.MustCompile(`quartets satisfied = ([^%,\]]+)%`)
+
+// Reads the networks from a nexus file written by WriteNetworksNexus
+// (leaving out the constraint tree), with the percent of quartets satisfied
+// by each from the comment before it
+func readNexusResults(data []byte, resultsFile string) ([]float64, []*tree.Tree, error) {
+	trees, translate, err := nexusTreeStatements(data)
+	if err != nil || len(trees) < 2 {
+		return nil, nil, fmt.Errorf("%w, %s is not a camus results nexus file", ErrInvalidFile, resultsFile)
+	}
+	qsat := make([]float64, 0, len(trees)-1)
+	networks := make([]*tree.Tree, 0, len(trees)-1)
+	for _, nt := range trees[1:] {
+		match := nexusQSat.FindStringSubmatch(nt.comment)
+		if match == nil {
+			return nil, nil, fmt.Errorf("%w, network %s in %s has no quartet satisfied percent", ErrInvalidFormat, nt.name, resultsFile)
+		}
+		q, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w, invalid quartet satisfied percent \"%s\" in %s", ErrInvalidFormat, match[1], resultsFile)
+		}
+		ntw, err := parseTree([]byte(nt.newick), resultsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, tip := range ntw.Tips() { // not translateTips, since reticulation labels repeat
+			if name, ok := translate[tip.Name()]; ok {
+				tip.SetName(name)
+			}
+		}
+		qsat = append(qsat, q)
+		networks = append(networks, ntw)
+	}
+	return qsat, networks, nil
+}
+
+// Calls newick with the tips of tre in names renamed, restoring them after
+func withTipNames(tre *tree.Tree, names map[string]string, newick func() string) string {
+	renamed := make(map[*tree.Node]string)
+	for _, tip := range tre.Tips() {
+		if name, ok := names[tip.Name()]; ok {
+			renamed[tip] = tip.Name()
+			tip.SetName(name)
+		}
+	}
+	defer func() {
+		for tip, name := range renamed {
+			tip.SetName(name)
+		}
+	}()
+	return newick()
+}
+
+// Quotes a nexus label if it has whitespace, punctuation, or underscores
+// (which readers turn into spaces when unquoted)
+func nexusQuote(label string) string {
+	if label != "" && !strings.ContainsAny(label, " \t\r\n_()[]{}/\\,;:=*'\"`<>+-") {
+		return label
+	}
+	return "'" + strings.ReplaceAll(label, "'", "''") + "'"
+}
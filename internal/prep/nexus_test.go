@@ -0,0 +1,125 @@
+package prep
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+func TestParseNexusTrees(t *testing.T) {
+	testCases := []struct {
+		name     string
+		nexus    string
+		names    []string
+		newicks  []string
+		hasError bool
+	}{
+		{
+			name:    "basic",
+			nexus:   "#NEXUS\n\nBEGIN TREES;\n\nTree q1 = (A,(B,(C,D)));\nTree q2 = (B,(C,D),E);\n\nEND;\n",
+			names:   []string{"q1", "q2"},
+			newicks: []string{"(A,(B,(C,D)));", "(B,(C,D),E);"},
+		},
+		{
+			name: "translate and comments",
+			nexus: "#nexus\n[comment; with semicolon]\nbegin taxa;\n\tdimensions ntax=4;\nend;\n" +
+				"begin trees;\n\ttranslate\n\t\t1 A,\n\t\t2 B,\n\t\t3 'C',\n\t\t4 D\n\t;\n" +
+				"\ttree 'gene one' = [&R] ((1,2),(3,4));\n\tutree g2 = ((1,3),(2,4));\nend;",
+			names:   []string{"gene one", "g2"},
+			newicks: []string{"((A,B),(C,D));", "((A,C),(B,D));"},
+		},
+		{
+			name:     "no header",
+			nexus:    "BEGIN TREES;\nTree q1 = (A,(B,(C,D)));\nEND;\n",
+			hasError: true,
+		},
+		{
+			name:     "no trees",
+			nexus:    "#NEXUS\nBEGIN TAXA;\nDIMENSIONS NTAX=4;\nEND;\n",
+			hasError: true,
+		},
+		{
+			name:     "bad tree",
+			nexus:    "#NEXUS\nBEGIN TREES;\nTree q1 = (A,(B,(C,D);\nEND;\n",
+			hasError: true,
+		},
+		{
+			name:     "missing semicolon",
+			nexus:    "#NEXUS\nBEGIN TREES;\nTree q1 = (A,(B,(C,D)))\nEND",
+			hasError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			geneTrees, err := parseNexusTrees([]byte(tc.nexus), 2, false)
+			if tc.hasError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !slices.Equal(geneTrees.Names, tc.names) {
+				t.Errorf("got names %v, expected %v", geneTrees.Names, tc.names)
+			}
+			newicks := make([]string, len(geneTrees.Trees))
+			for i, gt := range geneTrees.Trees {
+				newicks[i] = gt.Newick()
+			}
+			if !slices.Equal(newicks, tc.newicks) {
+				t.Errorf("got trees %v, expected %v", newicks, tc.newicks)
+			}
+		})
+	}
+}
+
+func TestWriteNetworksNexus(t *testing.T) {
+	parse := func(nwk string) *tree.Tree {
+		tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tre
+	}
+	constTree := parse("((B,x-y),(C,D_1));")
+	ntw := &gr.Network{NetTree: parse("((#H1,B),((C)#H1,x-y),D_1);")}
+	var buf bytes.Buffer
+	if err := WriteNetworksNexus(constTree, []*gr.Network{ntw}, []float64{75}, []string{"0", "4"}, &buf); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "\t\t3 'D_1',\n") || !strings.Contains(out, "\t\t4 'x-y'\n") {
+		t.Errorf("translate table does not quote labels:\n%s", out)
+	}
+	if !strings.Contains(out, "[k = 1, quartets satisfied = 75%, score = 4]") {
+		t.Errorf("missing scores of k1:\n%s", out)
+	}
+	trees, translate, err := nexusTreeStatements(buf.Bytes())
+	if err != nil {
+		t.Fatalf("could not read written nexus: %s", err)
+	}
+	expected := []string{"((B,x-y),(C,D_1));", "((#H1,B),((C)#H1,x-y),D_1);"}
+	for i, nt := range trees {
+		tre, err := nt.parse(translate)
+		if err != nil {
+			t.Fatalf("could not parse tree %s: %s", nt.name, err)
+		}
+		if got := tre.Newick(); got != expected[i] {
+			t.Errorf("tree %s: got %s, expected %s", nt.name, got, expected[i])
+		}
+	}
+	if len(trees) != 2 || trees[0].name != "k0" || trees[1].name != "k1" {
+		t.Errorf("expected trees k0 and k1, got %+v", trees)
+	}
+	if ntw.NetTree.Newick() != "((#H1,B),((C)#H1,x-y),D_1);" {
+		t.Errorf("network tips were not restored, got %s", ntw.NetTree.Newick())
+	}
+}
@@ -0,0 +1,71 @@
+package prep
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+)
+
+// Assignment of gene trees to data partitions (e.g., exons, introns, UCEs)
+type Partitions struct {
+	Names   []string // partition names, in the order they first appear
+	Members [][]int  // indices of the gene trees in each partition
+}
+
+// Reads file with one "gene partition" pair per line (separated by whitespace
+// or a comma) assigning each gene tree, by name, to a partition. Every gene
+// tree must be assigned; genes that are not among the gene trees (e.g.,
+// dropped by -restrict) are skipped.
+func ReadPartitionFile(partitionFile string, geneTrees *GeneTrees) (*Partitions, error) {
+	partBytes, err := os.ReadFile(partitionFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading partition file: %w", err)
+	}
+	geneIndex := make(map[string]int, len(geneTrees.Names))
+	for i, name := range geneTrees.Names {
+		geneIndex[name] = i
+	}
+	parts := &Partitions{Names: make([]string, 0), Members: make([][]int, 0)}
+	partIndex := make(map[string]int)
+	assigned := make([]bool, len(geneTrees.Names))
+	lineNum, skipped := 0, 0
+	for line := range strings.Lines(string(partBytes)) {
+		lineNum++
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n' })
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w, line %d of partition file should be a gene and a partition, but has %d fields", ErrInvalidFile, lineNum, len(fields))
+		}
+		gene, part := fields[0], fields[1]
+		i, ok := geneIndex[gene]
+		if !ok {
+			skipped++
+			continue
+		}
+		if assigned[i] {
+			return nil, fmt.Errorf("%w, gene %s is assigned to more than one partition", ErrInvalidFile, gene)
+		}
+		assigned[i] = true
+		p, ok := partIndex[part]
+		if !ok {
+			p = len(parts.Names)
+			partIndex[part] = p
+			parts.Names = append(parts.Names, part)
+			parts.Members = append(parts.Members, make([]int, 0))
+		}
+		parts.Members[p] = append(parts.Members[p], i)
+	}
+	for i, ok := range assigned {
+		if !ok {
+			return nil, fmt.Errorf("%w, gene %s is not assigned to a partition", ErrInvalidFile, geneTrees.Names[i])
+		}
+	}
+	if skipped != 0 {
+		lg.Infof("skipped %d genes in the partition file that are not among the gene trees", skipped)
+	}
+	return parts, nil
+}
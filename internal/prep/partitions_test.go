@@ -0,0 +1,60 @@
+package prep
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadPartitionFile(t *testing.T) {
+	geneTrees := &GeneTrees{Names: []string{"g1", "g2", "g3"}}
+	testCases := []struct {
+		name        string
+		contents    string
+		expected    *Partitions
+		expectedErr error
+	}{
+		{
+			name:     "whitespace",
+			contents: "g1 exon\ng2\tintron\n\ng3 exon\n",
+			expected: &Partitions{Names: []string{"exon", "intron"}, Members: [][]int{{0, 2}, {1}}},
+		},
+		{
+			name:     "comma with extra gene",
+			contents: "g2,uce\ng4,uce\ng1,uce\ng3,uce\n",
+			expected: &Partitions{Names: []string{"uce"}, Members: [][]int{{1, 0, 2}}},
+		},
+		{
+			name:        "unassigned gene",
+			contents:    "g1 exon\ng2 exon\n",
+			expectedErr: ErrInvalidFile,
+		},
+		{
+			name:        "assigned twice",
+			contents:    "g1 exon\ng2 exon\ng3 exon\ng1 intron\n",
+			expectedErr: ErrInvalidFile,
+		},
+		{
+			name:        "bad line",
+			contents:    "g1 exon extra\n",
+			expectedErr: ErrInvalidFile,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "partitions.txt")
+			if err := os.WriteFile(path, []byte(test.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			parts, err := ReadPartitionFile(path, geneTrees)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err == nil && !reflect.DeepEqual(parts, test.expected) {
+				t.Errorf("got %+v, expected %+v", parts, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package prep
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+)
+
+// How polytomies in the constraint tree are resolved
+type PolytomyMode int
+
+const (
+	NoResolve        PolytomyMode = iota // polytomies are an error
+	ArbitraryResolve                     // children are joined in the order they appear
+	QuartetResolve                       // children are joined greedily by gene tree support
+)
+
+var ParsePolytomyMode = map[string]PolytomyMode{
+	"none":      NoResolve,
+	"arbitrary": ArbitraryResolve,
+	"quartet":   QuartetResolve,
+}
+
+func (m *PolytomyMode) Set(s string) error {
+	if mode, ok := ParsePolytomyMode[s]; ok {
+		*m = mode
+		return nil
+	}
+	return fmt.Errorf("\"%s\" is not a valid polytomy resolution mode", s)
+}
+
+func (m PolytomyMode) String() string {
+	for s, pm := range ParsePolytomyMode {
+		if pm == m {
+			return s
+		}
+	}
+	panic(fmt.Sprintf("invalid polytomy mode %d", int(m)))
+}
+
+// Subtree of the resolved tree that still has to be joined to its parent
+type polytomyGroup struct {
+	node    *tree.Node
+	taxa    []string
+	clade   *bitset.BitSet // taxa by constraint tree tip index (only for QuartetResolve)
+	length  float64        // length of the edge above the subtree
+	support float64        // support of the edge above the subtree
+}
+
+// Returns a binary copy of the rooted constraint tree with every polytomy
+// resolved, along with the clades (as taxa) below each edge that was added to
+// resolve them. With QuartetResolve, the two children of a polytomy whose
+// union is a bipartition of the most gene trees are joined first; ties (and
+// ArbitraryResolve) join children in the order they appear. Unrooted trees and
+// trees without polytomies are returned as they are.
+func ResolvePolytomies(tre *tree.Tree, geneTrees []*tree.Tree, mode PolytomyMode) (*tree.Tree, [][]string, error) {
+	tre.RemoveSingleNodes()
+	if mode == NoResolve || !tre.Rooted() || TreeIsBinary(tre) {
+		return tre, nil, nil
+	}
+	var splits []geneSplits
+	tipIndex := make(map[string]uint)
+	if mode == QuartetResolve {
+		for i, tip := range tre.Tips() {
+			tipIndex[tip.Name()] = uint(i)
+		}
+		splits = make([]geneSplits, len(geneTrees))
+		for i, gt := range geneTrees {
+			splits[i] = splitsOf(gt, tipIndex)
+		}
+	}
+	resolved := tree.NewTree()
+	var artificial [][]string
+	polytomies := 0
+	var copySubtree func(n *tree.Node) polytomyGroup
+	copySubtree = func(n *tree.Node) polytomyGroup {
+		node := resolved.NewNode()
+		node.SetName(n.Name())
+		group := polytomyGroup{node: node, length: tree.NIL_LENGTH, support: tree.NIL_SUPPORT}
+		if e, err := n.ParentEdge(); err == nil {
+			group.length, group.support = e.Length(), e.Support()
+		}
+		if n.Tip() {
+			group.taxa = []string{n.Name()}
+			if mode == QuartetResolve {
+				group.clade = bitset.New(uint(len(tipIndex))).Set(tipIndex[n.Name()])
+			}
+			return group
+		}
+		children := make([]polytomyGroup, 0)
+		for _, c := range gr.GetChildren(n) {
+			children = append(children, copySubtree(c))
+		}
+		if len(children) > 2 {
+			polytomies++
+		}
+		for len(children) > 2 {
+			i, j := 0, 1
+			if mode == QuartetResolve {
+				i, j = bestJoin(children, splits)
+			}
+			joined := polytomyGroup{
+				node:    resolved.NewNode(),
+				taxa:    slices.Concat(children[i].taxa, children[j].taxa),
+				length:  tree.NIL_LENGTH,
+				support: tree.NIL_SUPPORT,
+			}
+			if mode == QuartetResolve {
+				joined.clade = children[i].clade.Union(children[j].clade)
+			}
+			connectGroup(resolved, joined.node, children[i])
+			connectGroup(resolved, joined.node, children[j])
+			artificial = append(artificial, joined.taxa)
+			children[i] = joined
+			children = slices.Delete(children, j, j+1)
+		}
+		for _, c := range children {
+			connectGroup(resolved, node, c)
+			group.taxa = append(group.taxa, c.taxa...)
+			if mode == QuartetResolve {
+				if group.clade == nil {
+					group.clade = bitset.New(uint(len(tipIndex)))
+				}
+				group.clade.InPlaceUnion(c.clade)
+			}
+		}
+		return group
+	}
+	resolved.SetRoot(copySubtree(tre.Root()).node)
+	if err := resolved.UpdateTipIndex(); err != nil {
+		return nil, nil, fmt.Errorf("constraint tree %w", ErrMulTree)
+	}
+	lg.Infof("resolved %d polytomies in the constraint tree, adding %d edges; reticulations between two added edges will not be considered",
+		polytomies, len(artificial))
+	return resolved, artificial, nil
+}
+
+func connectGroup(t *tree.Tree, parent *tree.Node, child polytomyGroup) {
+	e := t.ConnectNodes(parent, child.node)
+	e.SetLength(child.length)
+	e.SetSupport(child.support)
+}
+
+// Taxa of a gene tree and the clades below each of its edges (as strings of
+// bitsets over the constraint tree tips, for lookup)
+type geneSplits struct {
+	present *bitset.BitSet
+	clades  map[string]bool
+}
+
+func splitsOf(gt *tree.Tree, tipIndex map[string]uint) geneSplits {
+	splits := geneSplits{clades: make(map[string]bool)}
+	var below func(cur, prev *tree.Node) *bitset.BitSet
+	below = func(cur, prev *tree.Node) *bitset.BitSet {
+		clade := bitset.New(uint(len(tipIndex)))
+		if i, ok := tipIndex[cur.Name()]; ok && cur.Tip() {
+			clade.Set(i)
+		}
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				clade.InPlaceUnion(below(n, cur))
+			}
+		}
+		if prev != nil {
+			splits.clades[clade.String()] = true
+		}
+		return clade
+	}
+	splits.present = below(gt.Root(), nil)
+	return splits
+}
+
+// Pair of groups whose union is a bipartition of the most gene trees (the
+// first pair if there are ties)
+func bestJoin(groups []polytomyGroup, splits []geneSplits) (int, int) {
+	bestI, bestJ, best := 0, 1, 0
+	for i := range groups {
+		for j := i + 1; j < len(groups); j++ {
+			union := groups[i].clade.Union(groups[j].clade)
+			count := 0
+			for _, gs := range splits {
+				if gs.displaysJoin(groups[i].clade, groups[j].clade, union) {
+					count++
+				}
+			}
+			if count > best {
+				bestI, bestJ, best = i, j, count
+			}
+		}
+	}
+	return bestI, bestJ
+}
+
+// Whether the gene tree has an edge separating the taxa of a and b (whose
+// union is join) from the rest of its taxa. Only counts if the gene tree has
+// taxa from both a and b, and at least two other taxa, so that the bipartition
+// is informative.
+func (gs geneSplits) displaysJoin(a, b, join *bitset.BitSet) bool {
+	if gs.present.IntersectionCardinality(a) == 0 || gs.present.IntersectionCardinality(b) == 0 {
+		return false
+	}
+	in := join.Intersection(gs.present)
+	out := gs.present.Difference(join)
+	if out.Count() < 2 {
+		return false
+	}
+	return gs.clades[in.String()] || gs.clades[out.String()]
+}
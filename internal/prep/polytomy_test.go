@@ -0,0 +1,92 @@
+package prep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestResolvePolytomies(t *testing.T) {
+	testCases := []struct {
+		name       string
+		tre        string
+		geneTrees  []string
+		mode       PolytomyMode
+		expTree    string
+		artificial [][]string
+	}{
+		{
+			name:       "arbitrary",
+			tre:        "((A,B,C,D),E);",
+			mode:       ArbitraryResolve,
+			expTree:    "((((A,B),C),D),E);",
+			artificial: [][]string{{"A", "B"}, {"A", "B", "C"}},
+		},
+		{
+			name:       "quartet",
+			tre:        "((A,B,C,D),(E,F));",
+			geneTrees:  []string{"(((C,D),A),B,(E,F));", "(((D,C),A),(E,F),B);", "((A,B),(C,E),(D,F));"},
+			mode:       QuartetResolve,
+			expTree:    "(((A,(C,D)),B),(E,F));",
+			artificial: [][]string{{"C", "D"}, {"A", "C", "D"}},
+		},
+		{
+			name:       "nested",
+			tre:        "((A,B,(C,D,E)),F);",
+			geneTrees:  []string{"((A,(C,E)),D,(B,F));"},
+			mode:       QuartetResolve,
+			expTree:    "(((A,((C,E),D)),B),F);",
+			artificial: [][]string{{"C", "E"}, {"A", "C", "E", "D"}},
+		},
+		{
+			name:    "keeps lengths",
+			tre:     "((A:1,B:2,C:3):4,D:5);",
+			mode:    ArbitraryResolve,
+			expTree: "(((A:1,B:2),C:3):4,D:5);",
+			// the join of A and B has no length
+			artificial: [][]string{{"A", "B"}},
+		},
+		{
+			name:    "binary",
+			tre:     "(((A,B),C),D);",
+			mode:    QuartetResolve,
+			expTree: "(((A,B),C),D);",
+		},
+		{
+			name:    "off",
+			tre:     "((A,B,C),D);",
+			mode:    NoResolve,
+			expTree: "((A,B,C),D);",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader(test.tre)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			geneTrees := make([]*tree.Tree, len(test.geneTrees))
+			for i, nwk := range test.geneTrees {
+				if geneTrees[i], err = newick.NewParser(strings.NewReader(nwk)).Parse(); err != nil {
+					t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+				}
+			}
+			resolved, artificial, err := ResolvePolytomies(tre, geneTrees, test.mode)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if resolved.Newick() != test.expTree {
+				t.Errorf("got tree %s, expected %s", resolved.Newick(), test.expTree)
+			}
+			if !reflect.DeepEqual(artificial, test.artificial) {
+				t.Errorf("got artificial clades %v, expected %v", artificial, test.artificial)
+			}
+			if test.mode != NoResolve && !TreeIsBinary(resolved) {
+				t.Error("resolved tree is not binary")
+			}
+		})
+	}
+}
@@ -5,13 +5,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"iter"
+	"math"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/evolbioinfo/gotree/tree"
 	"golang.org/x/sync/errgroup"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
 )
 
 var (
@@ -19,108 +25,489 @@ var (
 	ErrNonBinary    = errors.New("not binary")
 	ErrMulTree      = errors.New("contains duplicate labels")
 	ErrTypeOutRange = errors.New("out of type range")
+
+	ErrNoBranchLengths = errors.New("missing branch lengths")
 )
 
 // Preprocess necessary data. Returns an error if the constraint tree is not valid
 // (e.g., not rooted/binary) or if the gene trees are not valid (bad leaf labels).
-func Preprocess(tre *tree.Tree, geneTrees []*tree.Tree, nprocs int, opts QuartetFilterOptions, minSupp float64) (*gr.TreeData, error) {
-	tre.RemoveSingleNodes()         // remove internal degree two nodes
-	for i, n := range tre.Nodes() { // node ids must be continuous
-		n.SetId(i)
+// Quartet counts are weighted by the gene tree weights (unweighted if nil).
+// Gene tree names are used in errors and warnings (line numbers if nil).
+// Filter stats are nil if the quartet filter is off. If counting.Cap is not
+// zero, the count of each quartet topology is capped at counting.Cap gene trees
+// after filtering, and if counting.Length is set, quartets are also weighted by
+// the length of the gene tree branch inducing them (see lengthWeight).
+// Quartets displayed by the constraint tree are dropped unless
+// counting.Constraint keeps them (see ConstraintQuartets). Stops
+// and returns ctx's error if ctx is cancelled while quartets are counted.
+// If the constraint tree is unrooted, the error suggests where to root it
+// from the rooted gene trees (see SuggestRoots).
+func Preprocess(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, weights []float64, names []string, nprocs int, opts QuartetFilterOptions, minSupp float64, counting CountMode) (*gr.TreeData, *FilterStats, error) {
+	if tre.RemoveSingleNodes(); !tre.Rooted() {
+		return nil, nil, unrootedError(tre, geneTrees, weights)
 	}
-	if err := tre.UpdateTipIndex(); err != nil {
-		return nil, fmt.Errorf("constraint tree %w", ErrMulTree)
+	td, stats, _, err := PreprocessStream(ctx, tre, treesOf(geneTrees), weights, names, nprocs, opts, minSupp, counting)
+	return td, stats, err
+}
+
+// Same as Preprocess, but reads the gene trees from an iterator (e.g.,
+// GeneTreeStream.All) and drops each one once its quartets are counted, so
+// that only the trees being processed are in memory. Also returns the number
+// of gene trees read.
+func PreprocessStream(ctx context.Context, tre *tree.Tree, geneTrees iter.Seq2[*tree.Tree, error], weights []float64, names []string, nprocs int, opts QuartetFilterOptions, minSupp float64, counting CountMode) (*gr.TreeData, *FilterStats, int, error) {
+	counts, err := CountQuartetStream(ctx, tre, geneTrees, weights, names, nprocs, minSupp, counting)
+	if err != nil {
+		return nil, nil, 0, err
 	}
-	if !tre.Rooted() {
-		return nil, fmt.Errorf("constraint tree is %w", ErrUnrooted)
+	td, stats, err := counts.TreeData(opts)
+	if err != nil {
+		return nil, nil, 0, err
 	}
-	if !TreeIsBinary(tre) {
-		return nil, fmt.Errorf("constraint tree is %w", ErrNonBinary)
+	return td, stats, counts.trees, nil
+}
+
+// Quartet counts from the gene trees before the quartet filter, so that tree
+// data can be made from them with different filter options (see
+// QuartetCounts.TreeData) without reading the gene trees again
+type QuartetCounts struct {
+	tre        *tree.Tree            // prepared constraint tree
+	counts     *gr.QuartetTable      // count of each quartet topology
+	occupancy  *gr.QuartetTable      // see geneTreeStats
+	provenance *gr.QuartetProvenance // see geneTreeStats
+	trees      int                   // gene trees read
+	weighted   bool                  // counts are weighted by gene tree weights or branch lengths
+	counting   CountMode
+}
+
+// Counts the quartets in the gene trees (the first half of Preprocess, which
+// is documented there)
+func CountQuartets(ctx context.Context, tre *tree.Tree, geneTrees []*tree.Tree, weights []float64, names []string, nprocs int, minSupp float64, counting CountMode) (*QuartetCounts, error) {
+	if tre.RemoveSingleNodes(); !tre.Rooted() { // see Preprocess
+		return nil, unrootedError(tre, geneTrees, weights)
 	}
-	if percent := percentNoSupport(geneTrees); percent != 0 && minSupp != 0 {
-		log.Printf("WARNING: %.2f%% of gene tree edges do not have support values", percent)
+	return CountQuartetStream(ctx, tre, treesWithProgress(geneTrees), weights, names, nprocs, minSupp, counting)
+}
+
+// Same as CountQuartets, reading the gene trees from an iterator (see
+// PreprocessStream)
+func CountQuartetStream(ctx context.Context, tre *tree.Tree, geneTrees iter.Seq2[*tree.Tree, error], weights []float64, names []string, nprocs int, minSupp float64, counting CountMode) (*QuartetCounts, error) {
+	if err := PrepareConstraintTree(tre); err != nil {
+		return nil, err
 	}
-	log.Printf("reading quartets from gene trees")
-	qCounts, err := processQuartets(geneTrees, tre, minSupp, nprocs)
+	lg.Infof("reading quartets from gene trees")
+	qCounts, read, err := processQuartetStream(ctx, geneTrees, weights, names, tre, minSupp, counting, nprocs)
 	if err != nil {
 		return nil, err
 	}
+	if weights != nil && read.trees != len(weights) {
+		return nil, fmt.Errorf("%w, weights file has %d weights, but there are %d gene trees", ErrInvalidFile, len(weights), read.trees)
+	}
+	if percent := read.percentNoSupport(); percent != 0 && minSupp != 0 {
+		lg.Warnf("%.2f%% of gene tree edges do not have support values", percent)
+	}
+	return &QuartetCounts{
+		tre:        tre,
+		counts:     qCounts,
+		occupancy:  read.occupancy,
+		provenance: read.provenance,
+		trees:      read.trees,
+		weighted:   weights != nil || counting.scaled(),
+		counting:   counting,
+	}, nil
+}
+
+// Number of gene trees the quartets were counted from
+func (qc *QuartetCounts) NumGeneTrees() int {
+	return qc.trees
+}
+
+// Copy of the counts, since making tree data from them changes them
+func (qc *QuartetCounts) Clone() *QuartetCounts {
+	clone := *qc
+	clone.counts = qc.counts.Clone()
+	return &clone
+}
+
+// Filters, caps, and drops (or weights) the constraint tree quartets of the
+// counts in place (see Preprocess) and makes the tree data from them. Use a
+// Clone to make tree data from the same counts more than once.
+func (qc *QuartetCounts) TreeData(opts QuartetFilterOptions) (*gr.TreeData, *FilterStats, error) {
+	qCounts, counting := qc.counts, qc.counting
+	var stats *FilterStats
 	if opts.mode != 0 {
-		filterQuartets(qCounts, opts)
+		stats = filterQuartets(qCounts, opts, len(qc.tre.Tips()))
+		lg.Infof("quartet filter removed %d of %d unique quartets (%d of %d sets of four taxa failed the threshold)",
+			stats.QuartetsRemoved, stats.QuartetsBefore, stats.FailedThreshold, stats.TaxaSets)
+	}
+	if counting.Cap != 0 {
+		n := capQuartetCounts(qCounts, counting.Cap, qc.weighted)
+		lg.Infof("capped the counts of %d of %d unique quartets at %d gene trees", n, qCounts.Len(), counting.Cap)
 	}
-	treeQuartets, err := gr.QuartetsFromTree(tre.Clone(), tre)
+	treeQuartets, err := gr.QuartetsFromTree(qc.tre.Clone(), qc.tre)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	kept := weightConstraintQuartets(qCounts, treeQuartets, counting.Constraint.Weight)
+	lg.Infof("%d gene trees provided, containing %d quartets not in the constraint tree\n", qc.trees, qCounts.Len()-kept)
+	if kept != 0 {
+		lg.Infof("kept %d quartets in the constraint tree at weight %g", kept, counting.Constraint.Weight)
+	}
+	lg.Infof("analyzing constraint tree")
+	treeData := gr.MakeTreeData(qc.tre, qCounts)
+	treeData.ConstraintWeight = counting.Constraint.Weight
+	treeData.SetOccupancy(qc.occupancy)
+	if qc.provenance != nil {
+		treeData.SetProvenance(qc.provenance)
+	}
+	return treeData, stats, nil
+}
+
+// Iterator over gene trees already in memory
+func treesOf(geneTrees []*tree.Tree) iter.Seq2[*tree.Tree, error] {
+	return func(yield func(*tree.Tree, error) bool) {
+		for _, gt := range geneTrees {
+			if !yield(gt, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Same as treesOf, reporting the fraction of gene trees handed out so far as
+// the progress of the current phase (see tm.Progress)
+func treesWithProgress(geneTrees []*tree.Tree) iter.Seq2[*tree.Tree, error] {
+	return func(yield func(*tree.Tree, error) bool) {
+		for i, gt := range geneTrees {
+			if !yield(gt, nil) {
+				return
+			}
+			tm.Progress(i+1, len(geneTrees))
+		}
+	}
+}
+
+// Prunes the constraint tree (or network) and gene trees in place so that they
+// only contain the given taxa. Reticulation leaves (names starting with #) are
+// kept. Gene trees left with fewer than four taxa are dropped, since they have
+// no quartets. Returns an error if a taxon is not in the constraint tree, or if
+// no gene trees are left.
+func RestrictTaxa(tre *tree.Tree, geneTrees *GeneTrees, taxa []string) error {
+	keep := make(map[string]bool, len(taxa))
+	for _, name := range taxa {
+		keep[name] = true
+	}
+	treeTaxa := make(map[string]bool)
+	treeKeep := slices.Clone(taxa)
+	for _, tip := range tre.Tips() {
+		treeTaxa[tip.Name()] = true
+		if strings.HasPrefix(tip.Name(), "#") {
+			treeKeep = append(treeKeep, tip.Name())
+		}
+	}
+	for _, name := range taxa {
+		if !treeTaxa[name] {
+			return fmt.Errorf("%w, taxon %s is not in the constraint tree", ErrInvalidFile, name)
+		}
+	}
+	if err := tre.RemoveTips(true, treeKeep...); err != nil {
+		return fmt.Errorf("%w, error pruning constraint tree: %s", ErrInvalidFile, err.Error())
+	}
+	trees, names := make([]*tree.Tree, 0, len(geneTrees.Trees)), make([]string, 0, len(geneTrees.Names))
+	var weights []float64
+	for i, gt := range geneTrees.Trees {
+		nKept := 0
+		for _, tip := range gt.Tips() {
+			if keep[tip.Name()] {
+				nKept++
+			}
+		}
+		if nKept < 4 {
+			continue
+		}
+		if err := gt.RemoveTips(true, taxa...); err != nil {
+			return fmt.Errorf("%w, error pruning gene tree %s: %s", ErrInvalidFile, geneTrees.Names[i], err.Error())
+		}
+		trees, names = append(trees, gt), append(names, geneTrees.Names[i])
+		if geneTrees.Weights != nil {
+			weights = append(weights, geneTrees.Weights[i])
+		}
+	}
+	if len(trees) == 0 {
+		return fmt.Errorf("%w, no gene trees contain at least four of the restricted taxa", ErrInvalidFile)
 	}
-	for q := range treeQuartets {
-		delete(qCounts, q)
+	lg.Infof("restricted input to %d taxa; dropped %d gene trees with fewer than four of them", len(keep), len(geneTrees.Trees)-len(trees))
+	geneTrees.Trees, geneTrees.Names, geneTrees.Weights = trees, names, weights
+	return nil
+}
+
+// Unroots every rooted gene tree in place, for when gene trees should be
+// treated as unrooted. Returns the number of trees that were rooted.
+func UnrootGeneTrees(geneTrees []*tree.Tree) int {
+	rooted := 0
+	for _, gt := range geneTrees {
+		if gt.Rooted() {
+			gt.UnRoot()
+			rooted++
+		}
+	}
+	return rooted
+}
+
+// Validates constraint tree (rooted, binary, no duplicate labels) and prepares
+// it for preprocessing by removing degree two nodes and making node ids continuous
+func PrepareConstraintTree(tre *tree.Tree) error {
+	tre.RemoveSingleNodes()         // remove internal degree two nodes
+	for i, n := range tre.Nodes() { // node ids must be continuous
+		n.SetId(i)
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		return fmt.Errorf("constraint tree %w", ErrMulTree)
+	}
+	if !tre.Rooted() {
+		return fmt.Errorf("constraint tree is %w", ErrUnrooted)
+	}
+	if !TreeIsBinary(tre) {
+		return fmt.Errorf("constraint tree is %w", ErrNonBinary)
+	}
+	return nil
+}
+
+// Backbone tree of a network in extended newick format (the network with its
+// reticulation leaves removed), prepared as a constraint tree. ntw is not
+// modified.
+func BackboneTree(ntw *tree.Tree) (*tree.Tree, error) {
+	backbone := ntw.Clone()
+	var retTips []string
+	for _, tip := range backbone.Tips() {
+		if strings.Contains(tip.Name(), "#") {
+			retTips = append(retTips, tip.Name())
+		}
+	}
+	if err := backbone.RemoveTips(false, retTips...); err != nil {
+		return nil, fmt.Errorf("%w, error removing reticulations: %s", ErrInvalidFile, err.Error())
+	}
+	if err := PrepareConstraintTree(backbone); err != nil {
+		return nil, fmt.Errorf("network backbone: %w", err)
 	}
-	log.Printf("%d gene trees provided, containing %d quartets not in the constraint tree\n", len(geneTrees), len(qCounts))
-	log.Printf("analyzing constraint tree")
-	treeData := gr.MakeTreeData(tre, qCounts)
-	return treeData, nil
+	return backbone, nil
 }
 
 type quartetShard struct {
-	mu     sync.Mutex
-	counts map[gr.Quartet]uint32
+	mu         sync.Mutex
+	counts     *gr.QuartetTable
+	occupancy  *gr.QuartetTable
+	provenance *gr.QuartetProvenance // nil if not kept
+}
+
+// Counts of what was read while counting quartets
+type geneTreeStats struct {
+	trees      int                   // gene trees read
+	edges      int                   // internal gene tree edges
+	noSupport  int                   // internal edges without a support value
+	occupancy  *gr.QuartetTable      // gene trees (weighted like the counts) with a quartet on each set of four taxa, see gr.Quartet.TaxaSet
+	provenance *gr.QuartetProvenance // gene trees each topology was counted from (nil unless counting.Provenance)
+}
+
+// Percent of internal gene tree edges without support
+func (s geneTreeStats) percentNoSupport() float64 {
+	if s.edges == 0 {
+		return 0
+	}
+	return float64(s.noSupport) / float64(s.edges) * 100
 }
 
 // Returns map containing counts of quartets in input trees (after filtering out
-// quartets from constraint tree).
-func processQuartets(geneTrees []*tree.Tree, tre *tree.Tree, minSupp float64, nprocs int) (map[gr.Quartet]uint32, error) {
+// quartets from constraint tree). If weights is not nil, each quartet of gene
+// tree i is counted weightCount(weights, i) times, and gene trees with zero
+// weight are skipped.
+func processQuartets(geneTrees []*tree.Tree, weights []float64, tre *tree.Tree, minSupp float64, nprocs int) (*gr.QuartetTable, error) {
+	qCounts, _, err := processQuartetStream(context.Background(), treesOf(geneTrees), weights, nil, tre, minSupp, CountMode{}, nprocs)
+	return qCounts, err
+}
+
+// Same as processQuartets, reading gene trees from an iterator. At most nprocs
+// trees are being processed at once, so the iterator is only advanced as
+// trees are finished. Gene tree names are used in errors and warnings (line
+// numbers if nil). If counting.Length is set, quartets are weighted by the
+// length of the gene tree branch inducing them (see lengthWeight), and
+// gene trees with more than one copy of a taxon are handled as set by
+// counting.Mul. If counting.Provenance is set, the gene trees each topology
+// was counted from are also kept.
+func processQuartetStream(ctx context.Context, geneTrees iter.Seq2[*tree.Tree, error], weights []float64, names []string, tre *tree.Tree, minSupp float64, counting CountMode, nprocs int) (*gr.QuartetTable, geneTreeStats, error) {
 	var missingOnce sync.Once
 	const shardBits = 6
 	shardCount := 1 << shardBits
 	shards := make([]quartetShard, shardCount)
 	for i := range shards {
-		shards[i].counts = make(map[gr.Quartet]uint32)
+		shards[i].counts = gr.NewQuartetTable(0)
+		shards[i].occupancy = gr.NewQuartetTable(0)
+		if counting.Provenance {
+			shards[i].provenance = gr.NewQuartetProvenance()
+		}
 	}
 	mask := uint64(shardCount - 1)
-	g, ctx := errgroup.WithContext(context.Background())
+	var read geneTreeStats
+	var readErr error
+	var edges, noSupport atomic.Int64
+	g, gctx := errgroup.WithContext(ctx)
 	g.SetLimit(nprocs)
-	for i, gt := range geneTrees {
+	for gt, err := range geneTrees {
+		if err != nil {
+			readErr = err
+			break
+		}
+		if gctx.Err() != nil {
+			break
+		}
+		i := read.trees
+		read.trees++
+		if weights != nil && i >= len(weights) {
+			continue // reported once all trees are counted
+		}
 		g.Go(func() error {
-			if err := ctx.Err(); err != nil {
+			if err := gctx.Err(); err != nil {
 				return err
 			}
+			weight := weightCount(weights, i)
+			if weight == 0 {
+				return nil
+			}
+			copies := false // gene tree has more than one copy of some taxon, and all of them are counted
 			if err := gt.UpdateTipIndex(); err != nil {
-				return fmt.Errorf("gene tree on line %d : %w", i+1, ErrMulTree)
+				switch counting.Mul {
+				case MulCollapse:
+					if _, err := collapseDuplicateTips(gt); err != nil {
+						return fmt.Errorf("gene tree %s : %w", geneTreeLabel(names, i), err)
+					}
+				case MulCopies:
+					copies = true
+				default:
+					return fmt.Errorf("gene tree %s : %w", geneTreeLabel(names, i), ErrMulTree)
+				}
 			}
-			if b, err := missmatchTaxaSets(gt, tre); err != nil {
-				return err
-			} else if b {
+			if copies && counting.Length {
+				return fmt.Errorf("gene tree %s : %w, and copies of a taxon cannot be weighted by branch length", geneTreeLabel(names, i), ErrMulTree)
+			}
+			var mismatch bool
+			if copies {
+				mismatch = numTaxa(gt) != len(tre.Tips()) // gt has no tip index
+			} else if b, err := missmatchTaxaSets(gt, tre); err != nil {
+				return fmt.Errorf("gene tree %s : %w", geneTreeLabel(names, i), err)
+			} else {
+				mismatch = b
+			}
+			if mismatch {
 				missingOnce.Do(func() {
-					log.Println("WARNING: missing taxa detected in one or more gene trees;",
-						"this may cause issues with some scoring metrics")
+					lg.Warnf("missing taxa detected in one or more gene trees (first seen in gene tree %s); "+
+						"this may cause issues with some scoring metrics", geneTreeLabel(names, i))
 				})
 			}
+			e, n := supportCounts(gt)
+			edges.Add(int64(e))
+			noSupport.Add(int64(n))
 			if minSupp != 0 {
 				gt.CollapseLowSupport(minSupp, true)
 			}
-			newQuartets, err := gr.QuartetsFromTree(gt, tre)
-			if err != nil {
-				return err
+			var newQuartets *gr.QuartetTable
+			var err error
+			occupancy := weight // each gene tree counts once for each set of four taxa it resolves
+			if counting.Length {
+				gt = gr.Unrooted(gt)
+				meanLength, err := meanInternalLength(gt)
+				if err != nil {
+					return fmt.Errorf("gene tree %s : %w", geneTreeLabel(names, i), err)
+				}
+				geneWeight := 1.0
+				if weights != nil {
+					geneWeight = float64(weight) / WeightScale
+				}
+				occupancy = uint32(math.Round(geneWeight * WeightScale))
+				newQuartets, err = gr.WeightedQuartetsFromTree(gt, tre, func(length float64) uint32 {
+					return lengthWeight(length, meanLength, geneWeight)
+				})
+				if err != nil {
+					return fmt.Errorf("gene tree %s : %w", geneTreeLabel(names, i), err)
+				}
+				weight = 1 // already in the quartet counts
+			} else if counting.Mul == MulCopies {
+				if weights == nil {
+					occupancy = WeightScale // counts are scaled for the fractions of copies, see gr.MulQuartetsFromTree
+				}
+				if newQuartets, err = gr.MulQuartetsFromTree(gt, tre, occupancy); err != nil {
+					return fmt.Errorf("gene tree %s : %w", geneTreeLabel(names, i), err)
+				}
+				weight = 1 // already in the quartet counts
+			} else if newQuartets, err = gr.QuartetsFromTree(gt, tre); err != nil {
+				return fmt.Errorf("gene tree %s : %w", geneTreeLabel(names, i), err)
+			}
+			var sets *gr.QuartetTable // sets already counted toward occupancy (copies can give a set more than one topology)
+			if copies {
+				sets = gr.NewQuartetTable(0)
 			}
-			for q, c := range newQuartets {
+			for q, c := range newQuartets.All() {
 				shard := &shards[uint64(q)&mask]
 				shard.mu.Lock()
-				shard.counts[q] += c
+				shard.counts.Add(q, c*weight)
+				if shard.provenance != nil {
+					shard.provenance.Add(q, i, c*weight)
+				}
+				shard.mu.Unlock()
+				set := q.TaxaSet()
+				if sets != nil {
+					if sets.Contains(set) {
+						continue
+					}
+					sets.Add(set, 1)
+				}
+				shard = &shards[uint64(set)&mask]
+				shard.mu.Lock()
+				shard.occupancy.Add(set, occupancy)
 				shard.mu.Unlock()
 			}
 			return nil
 		})
 	}
 	if err := g.Wait(); err != nil {
-		return nil, err
+		return nil, read, err
 	}
-	qCounts := make(map[gr.Quartet]uint32)
+	if err := ctx.Err(); err != nil {
+		return nil, read, err
+	}
+	if readErr != nil {
+		return nil, read, readErr
+	}
+	read.edges, read.noSupport = int(edges.Load()), int(noSupport.Load())
+	total := 0
+	for i := range shards {
+		total += shards[i].counts.Len()
+	}
+	qCounts := gr.NewQuartetTable(total)
+	read.occupancy = gr.NewQuartetTable(0)
 	for i := range shards {
-		for q, c := range shards[i].counts {
-			qCounts[q] += c
+		for q, c := range shards[i].counts.All() {
+			qCounts.Add(q, c)
+		}
+		for set, c := range shards[i].occupancy.All() {
+			read.occupancy.Add(set, c)
+		}
+	}
+	if counting.Provenance {
+		read.provenance = gr.NewQuartetProvenance()
+		for i := range shards {
+			read.provenance.Merge(shards[i].provenance)
 		}
+		read.provenance.Sort()
 	}
-	return qCounts, nil
+	return qCounts, read, nil
+}
+
+// Label for gene tree i in messages: its name, or its line number if names is
+// nil (e.g., streamed trees)
+func geneTreeLabel(names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("on line %d", i+1)
 }
 
 func missmatchTaxaSets(tre1, tre2 *tree.Tree) (bool, error) {
@@ -171,19 +558,17 @@ func isBinary(node *tree.Node, allowUnifurcations bool) bool {
 	return isBinary(children[0], allowUnifurcations) && isBinary(children[1], allowUnifurcations)
 }
 
-// returns percent of edges without support
-func percentNoSupport(trees []*tree.Tree) float64 {
-	var total, count int
-	for _, t := range trees {
-		for _, e := range t.Edges() {
-			if e.Right().Tip() {
-				continue
-			}
-			if e.Support() != tree.NIL_SUPPORT {
-				count++
-			}
-			total++
+// Number of internal edges of the tree and the number of them without support
+func supportCounts(t *tree.Tree) (int, int) {
+	var total, noSupport int
+	for _, e := range t.Edges() {
+		if e.Right().Tip() {
+			continue
+		}
+		if e.Support() == tree.NIL_SUPPORT {
+			noSupport++
 		}
+		total++
 	}
-	return float64(total-count) / float64(total) * 100
+	return total, noSupport
 }
@@ -1,9 +1,12 @@
 package prep
 
 import (
+	"context"
 	"errors"
-	"reflect"
+	"maps"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -117,7 +120,7 @@ func TestPreprocess_Errors(t *testing.T) {
 				}
 				gtrees[i] = tmp
 			}
-			_, err = Preprocess(tre, gtrees, runtime.GOMAXPROCS(0), QuartetFilterOptions{mode: 0, threshold: 0}, 0)
+			_, _, err = Preprocess(context.Background(), tre, gtrees, nil, nil, runtime.GOMAXPROCS(0), QuartetFilterOptions{mode: 0, threshold: 0}, 0, CountMode{})
 			if err != nil && !errors.Is(err, test.expectedErr) {
 				t.Errorf("unexpected error %v", err)
 			} else if err != nil {
@@ -127,6 +130,46 @@ func TestPreprocess_Errors(t *testing.T) {
 	}
 }
 
+func TestPreprocess_GeneNames(t *testing.T) {
+	testCases := []struct {
+		name     string
+		names    []string
+		expected string
+	}{
+		{
+			name:     "nexus names",
+			names:    []string{"locus1", "locus2"},
+			expected: "gene tree locus2 :",
+		},
+		{
+			name:     "no names",
+			names:    nil,
+			expected: "gene tree on line 2 :",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader("((a,b),(c,d));")).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			gtrees := make([]*tree.Tree, 2)
+			for i, gt := range []string{"((a,b),(c,d));", "((a,b),(c,a));"} {
+				if gtrees[i], err = newick.NewParser(strings.NewReader(gt)).Parse(); err != nil {
+					t.Fatal("invalid newick tree; test is written wrong")
+				}
+			}
+			_, _, err = Preprocess(context.Background(), tre, gtrees, nil, test.names, 1, QuartetFilterOptions{}, 0, CountMode{})
+			if !errors.Is(err, ErrMulTree) {
+				t.Fatalf("expected %v, got %v", ErrMulTree, err)
+			}
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("error \"%s\" does not contain \"%s\"", err, test.expected)
+			}
+		})
+	}
+}
+
 func TestProcessQuartets(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -240,24 +283,24 @@ func TestProcessQuartets(t *testing.T) {
 				}
 				rqList = append(rqList, tr)
 			}
-			result, err := processQuartets(rqList, tre, 0, runtime.GOMAXPROCS(0))
+			result, err := processQuartets(rqList, nil, tre, 0, runtime.GOMAXPROCS(0))
 			if err != nil {
 				t.Errorf("produced error %+v", err)
 			}
-			beforeFilter := len(result)
+			beforeFilter := result.Len()
 			if test.opts.mode != 0 {
-				filterQuartets(result, test.opts)
+				filterQuartets(result, test.opts, len(tre.Tips()))
 			}
 			// remove quartets present in the constraint tree after filtering
 			treeQuartets, err := gr.QuartetsFromTree(tre.Clone(), tre)
 			if err != nil {
 				t.Errorf("error getting constraint quartets: %+v", err)
 			}
-			for q := range treeQuartets {
-				delete(result, q)
+			for q := range treeQuartets.All() {
+				result.Delete(q)
 			}
 			if test.name == "unresolved gene tree" {
-				t.Logf("before removing constraint quartets: %d, after: %d", beforeFilter, len(result))
+				t.Logf("before removing constraint quartets: %d, after: %d", beforeFilter, result.Len())
 			}
 			expectedList := []gr.Quartet{}
 			for _, nwk := range test.expected {
@@ -271,11 +314,11 @@ func TestProcessQuartets(t *testing.T) {
 				}
 				expectedList = append(expectedList, q)
 			}
-			expected := make(map[gr.Quartet]uint32)
+			expected := gr.NewQuartetTable(len(expectedList))
 			for _, q := range expectedList {
-				expected[q] += 1
+				expected.Add(q, 1)
 			}
-			if !reflect.DeepEqual(result, expected) {
+			if !result.Equal(expected) {
 				t.Errorf("actual %s != expected %s", gr.QSetToString(result, tre), gr.QSetToString(expected, tre))
 			}
 		})
@@ -313,21 +356,318 @@ func BenchmarkProcessQuartets(b *testing.B) {
 			cloned[j] = gt.Clone()
 		}
 		b.StartTimer()
-		if _, err := processQuartets(cloned, treClone, 0, nprocs); err != nil {
+		if _, err := processQuartets(cloned, nil, treClone, 0, nprocs); err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
-func BenchmarkPercentNoSupport(b *testing.B) {
-	gtrees, err := readGeneTreesFile("testdata/g100.nwk", Newick)
+func BenchmarkSupportCounts(b *testing.B) {
+	gtrees, err := readGeneTreesFile("testdata/g100.nwk", Newick, false)
 	if err != nil {
 		b.Fatalf("failed to read gene trees: %v", err)
 	}
 	b.ResetTimer()
 	for b.Loop() {
-		if percentNoSupport(gtrees.Trees) < 0 {
-			b.Fatal("percent cannot be negative")
+		for _, gt := range gtrees.Trees {
+			if total, noSupport := supportCounts(gt); noSupport > total {
+				b.Fatal("more edges without support than edges")
+			}
+		}
+	}
+}
+
+func TestFilterQuartets_Stats(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	gtrees := make([]*tree.Tree, 0)
+	// ABCD: 2 AC|BD, 1 AD|BC, 1 AB|CD (minor topologies tie, fails); ABCE: only AC|BE (fails)
+	for _, nwk := range []string{"((A,C),(B,D));", "((A,C),(B,D));", "((A,D),(B,C));", "((A,B),(C,D));", "((A,C),(B,E));"} {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+		}
+		gtrees = append(gtrees, gt)
+	}
+	qCounts, err := processQuartets(gtrees, nil, tre, 0, runtime.GOMAXPROCS(0))
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	opts, err := SetQuartetFilterOptions(int(Restrictive), 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := filterQuartets(qCounts, opts, len(tre.Tips()))
+	if stats.TaxaSets != 2 || stats.FailedThreshold != 2 || stats.QuartetsBefore != 4 {
+		t.Errorf("got %+v", stats)
+	}
+	// the two minor ABCD topologies are removed; ABCE's are never seen
+	if stats.QuartetsRemoved != 2 || stats.CountRemoved != 2 {
+		t.Errorf("expected 2 quartets removed, got %d (%d)", stats.QuartetsRemoved, stats.CountRemoved)
+	}
+	for taxon, exp := range map[string]uint64{"A": 2, "B": 2, "C": 2, "D": 2, "E": 0} {
+		i, err := tre.TipIndex(taxon)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TaxonRemoved[i] != exp {
+			t.Errorf("taxon %s: got %d removed, expected %d", taxon, stats.TaxonRemoved[i], exp)
+		}
+	}
+	if stats.DominantFreq[NumFreqBins/2] != 1 || stats.DominantFreq[NumFreqBins-1] != 1 || stats.FailedFreq[NumFreqBins-1] != 1 {
+		t.Errorf("unexpected dominant frequency bins %v", stats.DominantFreq)
+	}
+}
+
+func TestQuartetCounts_TreeData(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	gtrees := make([]*tree.Tree, 0)
+	// ABCD: 4 AC|BD, 2 AD|BC, 1 AB|CD (passes threshold 0, fails 0.5)
+	for nwk, n := range map[string]int{"((A,C),(B,D));": 4, "((A,D),(B,C));": 2, "((A,B),(C,D));": 1} {
+		for range n {
+			gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+			if err != nil {
+				t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+			}
+			gtrees = append(gtrees, gt)
+		}
+	}
+	counts, err := CountQuartets(context.Background(), tre, gtrees, nil, nil, runtime.GOMAXPROCS(0), 0, CountMode{})
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	if counts.NumGeneTrees() != 7 {
+		t.Errorf("got %d gene trees, expected 7", counts.NumGeneTrees())
+	}
+	// each clone is filtered on its own, so the counts can be reused
+	for _, test := range []struct {
+		threshold float64
+		expected  uint32
+	}{{0.5, 4}, {0, 6}, {0.5, 4}} {
+		opts, err := SetQuartetFilterOptions(int(Restrictive), test.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		td, _, err := counts.Clone().TreeData(opts)
+		if err != nil {
+			t.Fatalf("produced error %+v", err)
+		}
+		if total := td.TotalNumQuartets(); total != test.expected {
+			t.Errorf("threshold %g: got %d quartets, expected %d", test.threshold, total, test.expected)
+		}
+	}
+}
+
+func TestCountQuartets_Provenance(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,D));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	nwks := []string{"((A,C),(B,D));", "((A,D),(B,C));", "((A,C),(B,D));", "((A,B),(C,D));"}
+	gtrees := make([]*tree.Tree, len(nwks))
+	for i, nwk := range nwks {
+		if gtrees[i], err = newick.NewParser(strings.NewReader(nwk)).Parse(); err != nil {
+			t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+		}
+	}
+	weights := []float64{1, 1, 2, 1}
+	counts, err := CountQuartets(context.Background(), tre, gtrees, weights, nil, runtime.GOMAXPROCS(0), 0, CountMode{Provenance: true})
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	td, _, err := counts.TreeData(QuartetFilterOptions{})
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	if !td.HasProvenance() {
+		t.Fatal("provenance was not kept")
+	}
+	genes := make(map[uint32]bool)
+	for q, c := range counts.counts.All() {
+		var sum uint32
+		for _, gc := range td.QuartetGenes(q) {
+			sum += gc.Count
+			genes[gc.Gene] = true
+		}
+		if sum != c {
+			t.Errorf("posting list of %v sums to %d, expected its count %d", q, sum, c)
+		}
+	}
+	// the last gene tree only has the constraint tree quartet, which is dropped
+	if expected := map[uint32]bool{0: true, 1: true, 2: true}; !maps.Equal(genes, expected) {
+		t.Errorf("got genes %v, expected %v", genes, expected)
+	}
+	counts, err = CountQuartets(context.Background(), tre, gtrees, nil, nil, 1, 0, CountMode{})
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	if td, _, err = counts.TreeData(QuartetFilterOptions{}); err != nil || td.HasProvenance() {
+		t.Errorf("provenance kept without CountMode.Provenance (error %v)", err)
+	}
+}
+
+func TestCountQuartets_MulTrees(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	testCases := []struct {
+		name     string
+		mode     MulMode
+		expected map[string]uint32
+		err      error
+	}{
+		{name: "error", mode: MulError, err: ErrMulTree},
+		{name: "collapse", mode: MulCollapse, expected: map[string]uint32{"((A,B),(C,D));": 1}},
+		{
+			name: "copies",
+			mode: MulCopies,
+			expected: map[string]uint32{
+				"((A,B),(C,D));": WeightScale / 2,
+				"((A,D),(B,C));": WeightScale / 2,
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			gt, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,A)));")).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			counts, err := CountQuartets(context.Background(), tre.Clone(), []*tree.Tree{gt}, nil, nil, 1, 0, CountMode{Mul: test.mode})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, expected %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if counts.counts.Len() != len(test.expected) {
+				t.Errorf("got %d quartets, expected %d", counts.counts.Len(), len(test.expected))
+			}
+			for nwk, c := range test.expected {
+				qt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+				if err != nil {
+					t.Fatal("invalid newick tree; test is written wrong")
+				}
+				q, err := gr.NewQuartet(qt, counts.tre)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := counts.counts.Get(q); got != c {
+					t.Errorf("%s: got count %d, expected %d", nwk, got, c)
+				}
+			}
+			if counts.NumGeneTrees() != 1 {
+				t.Errorf("got %d gene trees, expected 1", counts.NumGeneTrees())
+			}
+		})
+	}
+}
+
+func TestRestrictTaxa(t *testing.T) {
+	parse := func(nwk string) *tree.Tree {
+		tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+		}
+		return tre
+	}
+	testCases := []struct {
+		name        string
+		tre         string
+		geneTrees   []string
+		taxa        []string
+		expTree     string
+		expNames    []string
+		expectedErr error
+	}{
+		{
+			name:      "basic",
+			tre:       "((A,B),(C,(D,(E,F))));",
+			geneTrees: []string{"((A,B),(C,(D,(E,F))));", "((A,E),(F,G));", "((A,C),(B,E));"},
+			taxa:      []string{"A", "B", "C", "E"},
+			expTree:   "((A,B),(C,E));",
+			expNames:  []string{"1", "3"},
+		},
+		{
+			name:      "keeps reticulation leaves",
+			tre:       "((A,(B)#H1),(C,(#H1,(D,E))));",
+			geneTrees: []string{"((A,B),(C,D));"},
+			taxa:      []string{"A", "B", "C", "D"},
+			expTree:   "((A,(B)#H1),(C,(#H1,D)));",
+			expNames:  []string{"1"},
+		},
+		{
+			name:        "unknown taxon",
+			tre:         "((A,B),(C,(D,E)));",
+			geneTrees:   []string{"((A,B),(C,D));"},
+			taxa:        []string{"A", "B", "C", "X"},
+			expectedErr: ErrInvalidFile,
+		},
+		{
+			name:        "no gene trees left",
+			tre:         "((A,B),(C,(D,E)));",
+			geneTrees:   []string{"((A,B),(C,D));"},
+			taxa:        []string{"A", "B", "C", "E"},
+			expectedErr: ErrInvalidFile,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre := parse(test.tre)
+			geneTrees := &GeneTrees{}
+			for i, nwk := range test.geneTrees {
+				geneTrees.Trees = append(geneTrees.Trees, parse(nwk))
+				geneTrees.Names = append(geneTrees.Names, strconv.Itoa(i+1))
+			}
+			err := RestrictTaxa(tre, geneTrees, test.taxa)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tre.Newick(); got != test.expTree {
+				t.Errorf("got tree %s, expected %s", got, test.expTree)
+			}
+			if !slices.Equal(geneTrees.Names, test.expNames) {
+				t.Errorf("got gene trees %v, expected %v", geneTrees.Names, test.expNames)
+			}
+			for _, gt := range geneTrees.Trees {
+				for _, tip := range gt.Tips() {
+					if !slices.Contains(test.taxa, tip.Name()) {
+						t.Errorf("gene tree %s contains %s", gt.Newick(), tip.Name())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUnrootGeneTrees(t *testing.T) {
+	nwks := []string{"((A,B),(C,D));", "(A,B,(C,D));", "(A,(B,(C,D)));"}
+	geneTrees := make([]*tree.Tree, len(nwks))
+	for i, nwk := range nwks {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+		}
+		geneTrees[i] = gt
+	}
+	if rooted := UnrootGeneTrees(geneTrees); rooted != 2 {
+		t.Errorf("got %d rooted trees, expected 2", rooted)
+	}
+	for _, gt := range geneTrees {
+		if gt.Rooted() {
+			t.Errorf("gene tree %s is still rooted", gt.Newick())
 		}
 	}
 }
@@ -31,6 +31,14 @@ func (opts QuartetFilterOptions) QuartetFilterOff() bool {
 	return opts.mode == 0
 }
 
+// Same options with a different threshold
+func (opts QuartetFilterOptions) WithThreshold(threshold float64) (QuartetFilterOptions, error) {
+	if err := opts.threshold.Set(threshold); err != nil {
+		return QuartetFilterOptions{}, err
+	}
+	return opts, nil
+}
+
 type QMode int
 
 const (
@@ -38,6 +46,13 @@ const (
 	Restrictive
 )
 
+// Description of each quartet filter mode, indexed by mode number (for help)
+var QModeDescriptions = []string{
+	"no filtering; every gene tree quartet is used",
+	"for each set of four taxa, the two less frequent topologies are removed if their counts are within the threshold (-t) of each other",
+	"same as 1, and the least frequent topology is always removed (recommended)",
+}
+
 func (mode *QMode) Set(n int) error {
 	if n < 0 || n > 2 {
 		return fmt.Errorf("quartet mode %d is %w", n, ErrTypeOutRange)
@@ -73,24 +88,73 @@ func (thresh Threshold) Keep(counts []uint32) bool {
 	return uint32(float64(thresh)*float64(sum)) < counts[1]-counts[0]
 }
 
-func filterQuartets(qCounts map[gr.Quartet]uint32, opts QuartetFilterOptions) {
-	for q := range qCounts {
+// Number of bins (over [0, 1]) for the frequency of the dominant topology
+const NumFreqBins = 20
+
+// What the quartet filter removed, so that threshold choices can be checked
+type FilterStats struct {
+	TaxaSets        int              // sets of four taxa with at least one quartet
+	FailedThreshold int              // taxa sets whose dominant topology did not pass the threshold
+	QuartetsBefore  int              // unique quartet topologies before filtering
+	QuartetsRemoved int              // unique quartet topologies removed
+	CountRemoved    uint64           // quartets removed, counting each gene tree they appear in
+	DominantFreq    [NumFreqBins]int // taxa sets binned by frequency of their most common topology
+	FailedFreq      [NumFreqBins]int // same as DominantFreq, only counting sets that failed the threshold
+	TaxonRemoved    []uint64         // quartets removed containing each taxon (by constraint tree tip index)
+}
+
+// Filters quartets in place. Each set of four taxa is considered once, using
+// the counts of its three topologies from before any quartets were removed.
+// nTaxa is the number of leaves in the constraint tree.
+func filterQuartets(qCounts *gr.QuartetTable, opts QuartetFilterOptions, nTaxa int) *FilterStats {
+	stats := &FilterStats{QuartetsBefore: qCounts.Len(), TaxonRemoved: make([]uint64, nTaxa)}
+	seen := gr.NewQuartetTable(qCounts.Len())
+	remove := make([]gr.Quartet, 0)
+	for q := range qCounts.All() {
 		quartets := q.AllQuartets()
-		counts := []uint32{qCounts[quartets[0]], qCounts[quartets[1]], qCounts[quartets[2]]}
+		if seen.Contains(quartets[0]) {
+			continue
+		}
+		seen.Add(quartets[0], 1)
+		counts := []uint32{qCounts.Get(quartets[0]), qCounts.Get(quartets[1]), qCounts.Get(quartets[2])}
 		slices.SortFunc(quartets, func(q1, q2 gr.Quartet) int {
-			return cmp.Compare(qCounts[q1], qCounts[q2])
+			return cmp.Compare(qCounts.Get(q1), qCounts.Get(q2))
 		})
+		bin := freqBin(counts)
+		stats.TaxaSets++
+		stats.DominantFreq[bin]++
 		if !opts.threshold.Keep(counts) {
-			delete(qCounts, quartets[0])
-			delete(qCounts, quartets[1])
+			stats.FailedThreshold++
+			stats.FailedFreq[bin]++
+			remove = append(remove, quartets[0], quartets[1])
 			continue
 		}
 		switch opts.mode {
 		case NonRestrictive:
 		case Restrictive:
-			delete(qCounts, quartets[0])
+			remove = append(remove, quartets[0])
 		default:
 			panic("invalid quartet mode case")
 		}
 	}
+	for _, q := range remove {
+		c := qCounts.Get(q)
+		if c == 0 {
+			continue
+		}
+		stats.QuartetsRemoved++
+		stats.CountRemoved += uint64(c)
+		for _, taxon := range q.Taxa() {
+			stats.TaxonRemoved[taxon] += uint64(c)
+		}
+		qCounts.Delete(q)
+	}
+	return stats
+}
+
+// Bin of the frequency of the most common of the three topologies
+func freqBin(counts []uint32) int {
+	total := counts[0] + counts[1] + counts[2]
+	freq := float64(slices.Max(counts)) / float64(total)
+	return min(int(freq*NumFreqBins), NumFreqBins-1)
 }
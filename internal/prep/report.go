@@ -0,0 +1,173 @@
+package prep
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Optimal networks of an infer run, read back from its results file
+type RunResults struct {
+	QSatScore []float64    // percent of quartets satisfied for 1, 2, ... edges
+	Networks  []*tree.Tree // optimal network for 1, 2, ... edges
+}
+
+// Summary of an infer run in a cross-dataset report
+type RunSummary struct {
+	Name          string
+	Reticulations int     // reticulations of the network compared
+	Seconds       float64 // wall clock time of the run (NaN if unknown)
+	Completed     string  // time the run finished
+	Version       string
+	Command       string
+}
+
+// Reads the optimal networks from a results file written by
+// WriteDPResultsToCSV, WriteDPResultsToJSON (if the file ends in .json), or
+// WriteNetworksNexus (if the file ends in .nex)
+func ReadResultsFile(resultsFile string) (*RunResults, error) {
+	file, err := openInput(resultsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s, %w", resultsFile, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			panic(fmt.Sprintf("could not close file %s, %s", resultsFile, err))
+		}
+	}()
+	if strings.HasSuffix(strings.ToLower(resultsFile), ".nex") {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", resultsFile, err)
+		}
+		qsat, networks, err := readNexusResults(data, resultsFile)
+		if err != nil {
+			return nil, err
+		}
+		return &RunResults{QSatScore: qsat, Networks: networks}, nil
+	}
+	var qsat []float64
+	var newicks []string
+	if strings.HasSuffix(strings.ToLower(resultsFile), ".json") {
+		var results jsonResults
+		if err := json.NewDecoder(file).Decode(&results); err != nil || len(results.Networks) == 0 {
+			return nil, fmt.Errorf("%w, %s is not a camus results json", ErrInvalidFile, resultsFile)
+		}
+		for _, ntw := range results.Networks[1:] {
+			qsat = append(qsat, ntw.QSat)
+			newicks = append(newicks, ntw.Newick)
+		}
+	} else {
+		rows, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%w, error reading csv %s: %s", ErrInvalidFormat, resultsFile, err.Error())
+		}
+		if len(rows) < 2 || !slices.Equal(rows[0], resultsCSVHeader) && !slices.Equal(rows[0], legacyResultsCSVHeader) {
+			return nil, fmt.Errorf("%w, %s is not a camus results csv", ErrInvalidFile, resultsFile)
+		}
+		for _, row := range rows[2:] {
+			q, err := strconv.ParseFloat(row[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w, invalid quartet satisfied percent \"%s\" in %s", ErrInvalidFormat, row[1], resultsFile)
+			}
+			qsat = append(qsat, q)
+			newicks = append(newicks, row[len(row)-1])
+		}
+	}
+	results := &RunResults{QSatScore: qsat, Networks: make([]*tree.Tree, len(newicks))}
+	for i, nwk := range newicks {
+		if results.Networks[i], err = parseTree([]byte(nwk), resultsFile); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Write csv file with the percent of quartets satisfied by the optimal network
+// with each number of reticulations in each run to writer, leaving cells
+// blank for runs with fewer reticulations.
+//
+// The first column is "Number of Reticulations", followed by one column per run
+func WriteQSatComparisonToCSV(names []string, qsats [][]float64, w io.Writer) error {
+	maxK := 0
+	for _, qsat := range qsats {
+		maxK = max(maxK, len(qsat))
+	}
+	data := [][]string{append([]string{"Number of Reticulations"}, names...)}
+	for k := range maxK {
+		row := []string{strconv.Itoa(k + 1)}
+		for _, qsat := range qsats {
+			cell := ""
+			if k < len(qsat) {
+				cell = strconv.FormatFloat(qsat[k], 'f', -1, 64)
+			}
+			row = append(row, cell)
+		}
+		data = append(data, row)
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file listing every reticulation found in any run (matched by its U
+// and W clades, see gr.Network.ReticulationClades) to writer, with its label
+// in each run that has it. Reticulations found in more runs come first.
+//
+// The columns are "U Clade", "W Clade", "Runs", followed by one column per run
+func WriteReticulationComparisonToCSV(names []string, clades []map[string][2]string, w io.Writer) error {
+	labels := make(map[[2]string][]string) // clades -> label in each run
+	for i, run := range clades {
+		for label, c := range run {
+			if labels[c] == nil {
+				labels[c] = make([]string, len(names))
+			}
+			labels[c][i] = label
+		}
+	}
+	found := func(c [2]string) int {
+		n := 0
+		for _, l := range labels[c] {
+			if l != "" {
+				n++
+			}
+		}
+		return n
+	}
+	keys := make([][2]string, 0, len(labels))
+	for c := range labels {
+		keys = append(keys, c)
+	}
+	slices.SortFunc(keys, func(a, b [2]string) int {
+		if diff := found(b) - found(a); diff != 0 {
+			return diff
+		}
+		return strings.Compare(a[0]+"|"+a[1], b[0]+"|"+b[1])
+	})
+	data := [][]string{append([]string{"U Clade", "W Clade", "Runs"}, names...)}
+	for _, c := range keys {
+		data = append(data, append([]string{"{" + c[0] + "}", "{" + c[1] + "}", strconv.Itoa(found(c))}, labels[c]...))
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file describing each run to writer.
+//
+// There are six columns: "Run", "Reticulations", "Seconds", "Completed",
+// "Version", "Command"
+func WriteRunSummariesToCSV(runs []RunSummary, w io.Writer) error {
+	data := [][]string{{"Run", "Reticulations", "Seconds", "Completed", "Version", "Command"}}
+	for _, run := range runs {
+		seconds := ""
+		if !math.IsNaN(run.Seconds) {
+			seconds = strconv.FormatFloat(run.Seconds, 'f', 3, 64)
+		}
+		data = append(data, []string{run.Name, strconv.Itoa(run.Reticulations), seconds, run.Completed, run.Version, run.Command})
+	}
+	return writeCSV(data, w)
+}
@@ -0,0 +1,108 @@
+package prep
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadResultsFile(t *testing.T) {
+	jsonFile := filepath.Join(t.TempDir(), "results.json")
+	err := os.WriteFile(jsonFile, []byte(`{"networks": [
+		{"number_of_branches": 0, "quartet_satisfied_percent": 0, "score": 0, "extended_newick": "(A,(B,(C,D)));"},
+		{"number_of_branches": 1, "quartet_satisfied_percent": 50, "score": 12, "extended_newick": "(A,(#H1,(B,((C)#H1:::0.3,D))));"}
+	]}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nexusFile := filepath.Join(t.TempDir(), "results.nex")
+	err = os.WriteFile(nexusFile, []byte("#NEXUS\nBEGIN TREES;\n\tTRANSLATE\n\t\t1 A,\n\t\t2 B,\n\t\t3 C,\n\t\t4 D\n\t;\n"+
+		"\t[k = 0, score = 0]\n\tTREE k0 = [&R] (1,(2,(3,4)));\n"+
+		"\t[k = 1, quartets satisfied = 50%, score = 12]\n\tTREE k1 = [&R] (1,(#H1,(2,((3)#H1:::0.3,4))));\nEND;\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name        string
+		resultsFile string
+		qsat        []float64
+		expectedErr error
+	}{
+		{name: "csv", resultsFile: "testdata/results.csv", qsat: []float64{50, 75}},
+		{name: "legacy csv", resultsFile: "testdata/results-legacy.csv", qsat: []float64{50, 75}},
+		{name: "json", resultsFile: jsonFile, qsat: []float64{50}},
+		{name: "nexus", resultsFile: nexusFile, qsat: []float64{50}},
+		{name: "not results", resultsFile: "testdata/constraint.nwk", expectedErr: ErrInvalidFile},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := ReadResultsFile(test.resultsFile)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if !slices.Equal(results.QSatScore, test.qsat) {
+				t.Errorf("got qsat %v, expected %v", results.QSatScore, test.qsat)
+			}
+			if len(results.Networks) != len(test.qsat) {
+				t.Fatalf("got %d networks, expected %d", len(results.Networks), len(test.qsat))
+			}
+			for k, tre := range results.Networks {
+				ntw, err := ConvertToNetwork(tre)
+				if err != nil {
+					t.Fatalf("network %d: %s", k+1, err)
+				}
+				if len(ntw.Reticulations) != k+1 {
+					t.Errorf("network %d has %d reticulations", k+1, len(ntw.Reticulations))
+				}
+			}
+		})
+	}
+}
+
+func TestWriteQSatComparisonToCSV(t *testing.T) {
+	var b strings.Builder
+	if err := WriteQSatComparisonToCSV([]string{"a", "b"}, [][]float64{{50, 75}, {60}}, &b); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := "Number of Reticulations,a,b\n1,50,60\n2,75,\n"
+	if b.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", b.String(), expected)
+	}
+}
+
+func TestWriteReticulationComparisonToCSV(t *testing.T) {
+	clades := []map[string][2]string{
+		{"#H1": {"A", "B"}, "#H2": {"C", "D,E"}},
+		{"#H1": {"C", "D,E"}},
+	}
+	var b strings.Builder
+	if err := WriteReticulationComparisonToCSV([]string{"a", "b"}, clades, &b); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := "U Clade,W Clade,Runs,a,b\n{C},\"{D,E}\",2,#H2,#H1\n{A},{B},1,#H1,\n"
+	if b.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", b.String(), expected)
+	}
+}
+
+func TestWriteRunSummariesToCSV(t *testing.T) {
+	runs := []RunSummary{
+		{Name: "a", Reticulations: 2, Seconds: 1.5, Completed: "2026-01-01T00:00:00Z", Version: "v1", Command: "camus x y"},
+		{Name: "b", Reticulations: 3, Seconds: math.NaN()},
+	}
+	var b strings.Builder
+	if err := WriteRunSummariesToCSV(runs, &b); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := "Run,Reticulations,Seconds,Completed,Version,Command\na,2,1.500,2026-01-01T00:00:00Z,v1,camus x y\nb,3,,,,\n"
+	if b.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", b.String(), expected)
+	}
+}
@@ -0,0 +1,235 @@
+package prep
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+var ErrOutgroup = errors.New("invalid outgroup")
+
+// Reads a single newick tree like the constraint tree (see readTreeFile), but
+// keeps its branch lengths and supports, so that it can be rooted and written
+// back out (see RootOutgroup and RootMidpoint)
+func ReadSpeciesTreeFile(treeFile string) (*tree.Tree, error) {
+	file, err := openInput(treeFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tree file: %w", err)
+	}
+	treBytes, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading tree file %s: %w", treeFile, err)
+	}
+	treBytes = bytes.TrimSpace(treBytes)
+	if bytes.Count(treBytes, []byte{byte('\n')}) != 0 || len(treBytes) == 0 {
+		return nil, fmt.Errorf("%w, there should only be exactly one newick tree in tree file %s",
+			ErrInvalidFile, treeFile)
+	}
+	tre, err := newick.NewParser(bytes.NewReader(treBytes)).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w, error parsing tree newick string from %s: %s",
+			ErrInvalidFormat, treeFile, err.Error())
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		return nil, fmt.Errorf("tree %w", ErrMulTree)
+	}
+	return tre, nil
+}
+
+// Roots tre in place on the edge separating the outgroup taxa from the rest,
+// so that the outgroup is one side of the root. Any existing root is ignored.
+// Returns ErrOutgroup if the outgroup is not monophyletic once the tree is
+// unrooted, or has taxa missing from tre, and ErrNonBinary if the rooted tree
+// is not binary.
+func RootOutgroup(tre *tree.Tree, outgroup []string) error {
+	if len(outgroup) == 0 {
+		return fmt.Errorf("%w, it has no taxa", ErrOutgroup)
+	}
+	for _, taxon := range outgroup {
+		if _, err := tre.TipIndex(taxon); err != nil {
+			return fmt.Errorf("%w, taxon %s is not in the tree", ErrOutgroup, taxon)
+		}
+	}
+	if len(outgroup) >= len(tre.Tips()) {
+		return fmt.Errorf("%w, it has every taxon of the tree", ErrOutgroup)
+	}
+	if err := rerootOutgroup(tre, outgroup); err != nil {
+		return err
+	}
+	return checkRooted(tre)
+}
+
+// Roots tre on the edge above the outgroup, which must be monophyletic
+func rerootOutgroup(tre *tree.Tree, outgroup []string) error {
+	err := withoutInternalNames(tre, func() error {
+		return tre.RerootOutGroup(false, true, outgroup...)
+	})
+	if err != nil { // gotree also fails to root on part of a polytomy, which is not a clade either
+		return fmt.Errorf("%w, {%s} is not monophyletic", ErrOutgroup, strings.Join(outgroup, ","))
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		return fmt.Errorf("tree %w", ErrMulTree)
+	}
+	return nil
+}
+
+// Roots tre in place at the midpoint of the longest path between two taxa.
+// Returns ErrNoBranchLengths if some edge has no length, and ErrNonBinary if
+// the rooted tree is not binary.
+func RootMidpoint(tre *tree.Tree) error {
+	if slices.ContainsFunc(tre.Edges(), func(e *tree.Edge) bool { return e.Length() == tree.NIL_LENGTH }) {
+		return fmt.Errorf("%w, midpoint rooting needs the length of every edge", ErrNoBranchLengths)
+	}
+	err := withoutInternalNames(tre, func() error {
+		return tre.RerootMidPoint()
+	})
+	if err != nil {
+		return fmt.Errorf("could not midpoint root tree: %w", err)
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		return fmt.Errorf("tree %w", ErrMulTree)
+	}
+	return checkRooted(tre)
+}
+
+// Runs reroot with the names of internal nodes cleared, since gotree indexes
+// all node names when rerooting and internal labels (e.g., supports written as
+// names) may repeat
+func withoutInternalNames(tre *tree.Tree, reroot func() error) error {
+	internal := make(map[*tree.Node]string)
+	for _, n := range tre.Nodes() {
+		if !n.Tip() && n.Name() != "" {
+			internal[n] = n.Name()
+			n.SetName("")
+		}
+	}
+	err := reroot()
+	for n, name := range internal {
+		n.SetName(name)
+	}
+	return err
+}
+
+// Checks that a rerooted tree can be used as a constraint tree
+func checkRooted(tre *tree.Tree) error {
+	if !TreeIsBinary(tre) {
+		return fmt.Errorf("rooted tree is %w", ErrNonBinary)
+	}
+	return nil
+}
+
+// Place to root an unrooted tree, with how many rooted gene trees agree with
+// it. Quartets are unrooted, so they say nothing about where the root is; only
+// gene trees that are rooted do.
+type RootSuggestion struct {
+	Outgroup    []string // taxa on the smaller side of the root edge
+	Agree       float64  // rooted gene trees (weighted) whose root split agrees with rooting on Outgroup
+	Informative float64  // rooted gene trees (weighted) with taxa of the tree on both sides of their root
+}
+
+// Every place to root the unrooted tree tre (each of its edges), best first.
+// A rooted gene tree agrees with an edge if the split at its root is the
+// split made by the edge once restricted to the gene tree's taxa, so it can
+// agree with more than one edge when it is missing taxa. Gene trees are
+// weighted by weights (unweighted if nil). Ties keep the order of the edges
+// in tre.
+func SuggestRoots(tre *tree.Tree, geneTrees []*tree.Tree, weights []float64) []RootSuggestion {
+	tips := tre.Tips()
+	tipIndex := make(map[string]uint, len(tips))
+	for i, tip := range tips {
+		tipIndex[tip.Name()] = uint(i)
+	}
+	nTaxa := uint(len(tips))
+	var clades []*bitset.BitSet // taxa below each edge
+	var below func(cur, prev *tree.Node) *bitset.BitSet
+	below = func(cur, prev *tree.Node) *bitset.BitSet {
+		clade := bitset.New(nTaxa)
+		if cur.Tip() {
+			clade.Set(tipIndex[cur.Name()])
+		}
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				clade.InPlaceUnion(below(n, cur))
+			}
+		}
+		if prev != nil {
+			clades = append(clades, clade)
+		}
+		return clade
+	}
+	below(tre.Root(), nil)
+	suggestions := make([]RootSuggestion, len(clades))
+	var informative float64
+	for i, gt := range geneTrees {
+		if !gt.Rooted() {
+			continue
+		}
+		sides := [2]*bitset.BitSet{bitset.New(nTaxa), bitset.New(nTaxa)}
+		for j, child := range gt.Root().Neigh() {
+			for _, tip := range taxaTips(child, gt.Root()) {
+				if k, ok := tipIndex[tip.Name()]; ok {
+					sides[j].Set(k)
+				}
+			}
+		}
+		if sides[0].None() || sides[1].None() {
+			continue
+		}
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		informative += weight
+		present := sides[0].Union(sides[1])
+		for e, clade := range clades {
+			restricted := clade.Intersection(present)
+			if restricted.Equal(sides[0]) || restricted.Equal(sides[1]) {
+				suggestions[e].Agree += weight
+			}
+		}
+	}
+	for e, clade := range clades {
+		if clade.Count() > nTaxa/2 {
+			clade = clade.Complement()
+		}
+		outgroup := make([]string, 0, clade.Count())
+		for k, ok := clade.NextSet(0); ok; k, ok = clade.NextSet(k + 1) {
+			outgroup = append(outgroup, tips[k].Name())
+		}
+		suggestions[e].Outgroup, suggestions[e].Informative = outgroup, informative
+	}
+	slices.SortStableFunc(suggestions, func(a, b RootSuggestion) int { return cmp.Compare(b.Agree, a.Agree) })
+	return suggestions
+}
+
+// Roots the unrooted tree tre in place on the edge the most rooted gene trees
+// agree with (see SuggestRoots), returning it. Returns ErrUnrooted if no
+// rooted gene tree agrees with any edge.
+func AutoRoot(tre *tree.Tree, geneTrees []*tree.Tree, weights []float64) (RootSuggestion, error) {
+	suggestions := SuggestRoots(tre, geneTrees, weights)
+	if len(suggestions) == 0 || suggestions[0].Agree == 0 {
+		return RootSuggestion{}, fmt.Errorf("constraint tree is %w, and no rooted gene tree suggests where to root it", ErrUnrooted)
+	}
+	return suggestions[0], rerootOutgroup(tre, suggestions[0].Outgroup)
+}
+
+// Error for an unrooted constraint tree, suggesting where to root it if any
+// rooted gene tree agrees with an edge
+func unrootedError(tre *tree.Tree, geneTrees []*tree.Tree, weights []float64) error {
+	suggestions := SuggestRoots(tre, geneTrees, weights)
+	if len(suggestions) == 0 || suggestions[0].Agree == 0 {
+		return fmt.Errorf("constraint tree is %w", ErrUnrooted)
+	}
+	best := suggestions[0]
+	return fmt.Errorf("constraint tree is %w; the root split of %g of %g rooted gene trees agrees with rooting it on {%s}",
+		ErrUnrooted, best.Agree, best.Informative, strings.Join(best.Outgroup, ","))
+}
@@ -0,0 +1,155 @@
+package prep
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestRootOutgroup(t *testing.T) {
+	testCases := []struct {
+		name        string
+		tre         string
+		outgroup    []string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "unrooted",
+			tre:      "((A:1,B:2):1,(C:1,(D:1,E:3)90:1):2,F:1);",
+			outgroup: []string{"F"},
+			expected: "(((A:1,B:2):1,(C:1,(D:1,E:3)90:1):2):0.5,F:0.5);",
+		},
+		{
+			name:     "clade",
+			tre:      "((A,B),(C,(D,E)),F);",
+			outgroup: []string{"B", "A"},
+			expected: "(((C,(D,E)),F),(A,B));",
+		},
+		{
+			name:     "already rooted elsewhere",
+			tre:      "((A,B),((C,D),(E,F)));",
+			outgroup: []string{"E", "F"},
+			expected: "(((C,D),(A,B)),(E,F));",
+		},
+		{
+			name:        "not monophyletic",
+			tre:         "((A,B),(C,(D,E)),F);",
+			outgroup:    []string{"A", "C"},
+			expectedErr: ErrOutgroup,
+		},
+		{
+			name:        "part of a polytomy",
+			tre:         "((A,B,C),(D,E),F);",
+			outgroup:    []string{"A", "B"},
+			expectedErr: ErrOutgroup,
+		},
+		{
+			name:        "missing taxon",
+			tre:         "((A,B),(C,(D,E)),F);",
+			outgroup:    []string{"A", "X"},
+			expectedErr: ErrOutgroup,
+		},
+		{
+			name:        "every taxon",
+			tre:         "((A,B),(C,D));",
+			outgroup:    []string{"A", "B", "C", "D"},
+			expectedErr: ErrOutgroup,
+		},
+		{
+			name:        "not binary",
+			tre:         "((A,B,C),(D,E),F);",
+			outgroup:    []string{"F"},
+			expectedErr: ErrNonBinary,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader(test.tre)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			if err := tre.UpdateTipIndex(); err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			err = RootOutgroup(tre, test.outgroup)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err == nil && tre.Newick() != test.expected {
+				t.Errorf("got %s, expected %s", tre.Newick(), test.expected)
+			}
+		})
+	}
+}
+
+func TestRootMidpoint(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A:1,B:2):1,(C:1,(D:1,E:3)90:1):2,F:1);")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := RootMidpoint(tre); err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	// the longest path is from E to B (length 9), so the root is 4.5 from E
+	if expected := "((C:1,(D:1,E:3)90:1):0.5,((A:1,B:2):1,F:1):1.5);"; tre.Newick() != expected {
+		t.Errorf("got %s, expected %s", tre.Newick(), expected)
+	}
+	tre, err = newick.NewParser(strings.NewReader("((A:1,B:2):1,(C,D),F:1);")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := RootMidpoint(tre); !errors.Is(err, ErrNoBranchLengths) {
+		t.Errorf("got error %v, expected %v", err, ErrNoBranchLengths)
+	}
+}
+
+func TestSuggestRoots(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,D),((E,F),(G,H)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	nwks := []string{"((A,C),(E,G));", "((B,D),(F,H));", "(((A,B),C),((E,F),H));", "((A,(C,D)),(G,H));", "(A,B,(E,F));"}
+	geneTrees := make([]*tree.Tree, len(nwks))
+	for i, nwk := range nwks {
+		if geneTrees[i], err = newick.NewParser(strings.NewReader(nwk)).Parse(); err != nil {
+			t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+		}
+	}
+	suggestions := SuggestRoots(tre, geneTrees, nil)
+	if len(suggestions) != 13 {
+		t.Fatalf("got %d suggestions, expected one for each of the 13 edges", len(suggestions))
+	}
+	// the unrooted gene tree is not informative
+	if best := suggestions[0]; !slices.Equal(best.Outgroup, []string{"E", "F", "G", "H"}) || best.Agree != 4 || best.Informative != 4 {
+		t.Errorf("got best suggestion %+v, expected {E,F,G,H} with 4 of 4", best)
+	}
+	// the third gene tree is the only one with every taxon below (A,B)
+	weights := []float64{0, 0, 2, 0, 0}
+	if best := SuggestRoots(tre, geneTrees, weights)[0]; best.Agree != 2 || best.Informative != 2 {
+		t.Errorf("got best weighted suggestion %+v, expected 2 of 2", best)
+	}
+	if _, err := AutoRoot(tre.Clone(), geneTrees[4:], nil); !errors.Is(err, ErrUnrooted) {
+		t.Errorf("got error %v without rooted gene trees, expected %v", err, ErrUnrooted)
+	}
+	best, err := AutoRoot(tre, geneTrees, nil)
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	if expected := "(((A,B),(C,D)),((E,F),(G,H)));"; !slices.Equal(best.Outgroup, []string{"E", "F", "G", "H"}) || tre.Newick() != expected {
+		t.Errorf("got %s rooted on %v, expected %s", tre.Newick(), best.Outgroup, expected)
+	}
+	unrooted, err := newick.NewParser(strings.NewReader("((A,B),(C,D),((E,F),(G,H)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	_, _, err = Preprocess(context.Background(), unrooted, geneTrees, nil, nil, 1, QuartetFilterOptions{}, 0, CountMode{})
+	if !errors.Is(err, ErrUnrooted) || !strings.Contains(err.Error(), "{E,F,G,H}") {
+		t.Errorf("got error %v, expected %v suggesting {E,F,G,H}", err, ErrUnrooted)
+	}
+}
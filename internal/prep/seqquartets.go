@@ -0,0 +1,438 @@
+package prep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/evolbioinfo/gotree/tree"
+	"golang.org/x/sync/errgroup"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+)
+
+// Multiple sequence alignment of one locus, used instead of a gene tree
+type Alignment struct {
+	Name string   // locus name (the file name without its extensions)
+	Taxa []string // taxon of each sequence
+	Seqs [][]byte // aligned sequences (upper case), all the same length
+}
+
+// How quartet topologies are inferred from an alignment
+type SeqMethod int
+
+const (
+	SeqParsimony SeqMethod = iota // topology with the most parsimony-informative sites
+	SeqDistance                   // four-point condition on uncorrected p-distances
+)
+
+var ParseSeqMethod = map[string]SeqMethod{
+	"parsimony": SeqParsimony,
+	"distance":  SeqDistance,
+}
+
+func (m *SeqMethod) Set(s string) error {
+	if method, ok := ParseSeqMethod[s]; ok {
+		*m = method
+		return nil
+	}
+	return fmt.Errorf("\"%s\" is not a valid alignment quartet method", s)
+}
+
+func (m SeqMethod) String() string {
+	for s, mm := range ParseSeqMethod {
+		if mm == m {
+			return s
+		}
+	}
+	panic(fmt.Sprintf("invalid alignment quartet method %d", int(m)))
+}
+
+// File extensions of alignments read by ReadAlignmentDir (before any
+// compression extension)
+var alignmentExts = []string{".fa", ".fasta", ".fas", ".fna", ".faa", ".aln"}
+
+// Reads every FASTA alignment in dir, i.e., files ending in one of
+// alignmentExts (optionally followed by .gz or .bz2), in file name order.
+// Returns an error if there are none or one is not a valid alignment.
+func ReadAlignmentDir(dir string) ([]*Alignment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading alignment directory %s, %w", dir, err)
+	}
+	alns := make([]*Alignment, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || alignmentName(entry.Name()) == "" {
+			continue
+		}
+		aln, err := ReadFastaFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		alns = append(alns, aln)
+	}
+	if len(alns) == 0 {
+		return nil, fmt.Errorf("%w, no alignments (%s) in %s", ErrInvalidFile, strings.Join(alignmentExts, ", "), dir)
+	}
+	return alns, nil
+}
+
+// Reads the constraint tree and the alignments in alnDir (see
+// ReadAlignmentDir), along with a weight for each alignment from weightsFile
+// (one per line, in file name order; nil if weightsFile is empty)
+func ReadAlignmentInputs(treeFile, alnDir, weightsFile string) (*tree.Tree, []*Alignment, []float64, error) {
+	tre, err := readTreeFile(treeFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	alns, err := ReadAlignmentDir(alnDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var weights []float64
+	if weightsFile != "" {
+		if weights, err = readWeightsFile(weightsFile, len(alns)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return tre, alns, weights, nil
+}
+
+// Locus name of an alignment file ("" if it does not have an alignment
+// extension)
+func alignmentName(file string) string {
+	lower := strings.ToLower(file)
+	for _, ext := range []string{".gz", ".bz2"} {
+		if strings.HasSuffix(lower, ext) {
+			lower, file = lower[:len(lower)-len(ext)], file[:len(file)-len(ext)]
+			break
+		}
+	}
+	for _, ext := range alignmentExts {
+		if strings.HasSuffix(lower, ext) && len(lower) > len(ext) {
+			return file[:len(file)-len(ext)]
+		}
+	}
+	return ""
+}
+
+// Reads an aligned FASTA file (possibly compressed, see openInput). Sequence
+// names are the first word of each header line.
+func ReadFastaFile(path string) (*Alignment, error) {
+	file, err := openInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s, %w", path, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			panic(fmt.Sprintf("could not close file %s, %s", path, err))
+		}
+	}()
+	name := alignmentName(filepath.Base(path))
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	aln := &Alignment{Name: name}
+	var seq bytes.Buffer
+	flush := func() {
+		if len(aln.Taxa) > len(aln.Seqs) {
+			aln.Seqs = append(aln.Seqs, bytes.ToUpper(seq.Bytes()))
+			seq.Reset()
+		}
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), math.MaxInt32)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		switch {
+		case len(line) == 0:
+		case line[0] == '>':
+			flush()
+			fields := strings.Fields(string(line[1:]))
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("%w, sequence without a name in %s", ErrInvalidFormat, path)
+			}
+			aln.Taxa = append(aln.Taxa, fields[0])
+		case len(aln.Taxa) == 0:
+			return nil, fmt.Errorf("%w, %s does not start with a FASTA header (>name)", ErrInvalidFormat, path)
+		default:
+			seq.Write(bytes.Join(bytes.Fields(line), nil))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w, error reading %s: %s", ErrInvalidFormat, path, err.Error())
+	}
+	flush()
+	if len(aln.Taxa) == 0 {
+		return nil, fmt.Errorf("%w, %s has no sequences", ErrInvalidFile, path)
+	}
+	seen := make(map[string]bool, len(aln.Taxa))
+	for i, taxon := range aln.Taxa {
+		if seen[taxon] {
+			return nil, fmt.Errorf("%w, %s has more than one sequence for %s", ErrInvalidFile, path, taxon)
+		}
+		seen[taxon] = true
+		if len(aln.Seqs[i]) != len(aln.Seqs[0]) {
+			return nil, fmt.Errorf("%w, %s is not aligned (%s has length %d, %s has length %d)",
+				ErrInvalidFile, path, taxon, len(aln.Seqs[i]), aln.Taxa[0], len(aln.Seqs[0]))
+		}
+	}
+	return aln, nil
+}
+
+// Whether each character is a nucleotide state (ambiguity codes, gaps, and
+// missing data are not) or an amino acid state, if the alignment has
+// characters that cannot be nucleotides
+func (aln *Alignment) stateChars() [256]bool {
+	var nucleotide, states [256]bool
+	for _, c := range []byte("ACGTUNRYKMSWBDHV-.?*") {
+		nucleotide[c] = true
+	}
+	isNucleotide := true
+	for _, seq := range aln.Seqs {
+		for _, c := range seq {
+			if !nucleotide[c] {
+				isNucleotide = false
+			}
+		}
+	}
+	if isNucleotide {
+		for _, c := range []byte("ACGTU") {
+			states[c] = true
+		}
+		return states
+	}
+	for c := byte('A'); c <= 'Z'; c++ {
+		states[c] = !strings.ContainsRune("BJXZ", rune(c))
+	}
+	return states
+}
+
+// Sites where both sequences of each pair have a state, and where those states
+// are equal, as bitsets over the sites
+type pairSites struct {
+	n     int
+	both  [][]uint64 // indexed by pairIndex
+	equal [][]uint64
+}
+
+func makePairSites(aln *Alignment) *pairSites {
+	states := aln.stateChars()
+	n, words := len(aln.Seqs), (len(aln.Seqs[0])+63)/64
+	codes := make([][]byte, n) // U is the same as T
+	for i, seq := range aln.Seqs {
+		codes[i] = bytes.ReplaceAll(seq, []byte("U"), []byte("T"))
+	}
+	ps := &pairSites{n: n, both: make([][]uint64, n*(n-1)/2), equal: make([][]uint64, n*(n-1)/2)}
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			both, equal := make([]uint64, words), make([]uint64, words)
+			for s := range codes[i] {
+				if a, b := codes[i][s], codes[j][s]; states[a] && states[b] {
+					both[s/64] |= 1 << (s % 64)
+					if a == b {
+						equal[s/64] |= 1 << (s % 64)
+					}
+				}
+			}
+			k := ps.pairIndex(i, j)
+			ps.both[k], ps.equal[k] = both, equal
+		}
+	}
+	return ps
+}
+
+func (ps *pairSites) pairIndex(i, j int) int {
+	if i > j {
+		i, j = j, i
+	}
+	return i*ps.n - i*(i+1)/2 + j - i - 1
+}
+
+// Uncorrected p-distance between sequences i and j (NaN if they share no sites)
+func (ps *pairSites) distance(i, j int) float64 {
+	k := ps.pairIndex(i, j)
+	both, diff := 0, 0
+	for w, b := range ps.both[k] {
+		both += bits.OnesCount64(b)
+		diff += bits.OnesCount64(b &^ ps.equal[k][w])
+	}
+	return float64(diff) / float64(both)
+}
+
+// Number of sites supporting ab|cd: a and b share a state, c and d share a
+// different one
+func (ps *pairSites) informative(a, b, c, d int) int {
+	ab, cd, ac := ps.equal[ps.pairIndex(a, b)], ps.equal[ps.pairIndex(c, d)], ps.equal[ps.pairIndex(a, c)]
+	n := 0
+	for w := range ab {
+		n += bits.OnesCount64(ab[w] & cd[w] &^ ac[w])
+	}
+	return n
+}
+
+// Index of the smallest of three scores, or false if it is not unique (or a
+// score is NaN)
+func uniqueMin(scores [3]float64) (int, bool) {
+	best := 0
+	for i, s := range scores {
+		if math.IsNaN(s) {
+			return 0, false
+		}
+		if s < scores[best] {
+			best = i
+		}
+	}
+	for i, s := range scores {
+		if i != best && s == scores[best] {
+			return 0, false
+		}
+	}
+	return best, true
+}
+
+// Infers the topology of every set of four taxa in the alignment with method,
+// returning a table with a count of one for each resolved topology and the
+// number of sets left unresolved (ties, or too little data). Every taxon must
+// be in the constraint tre, which must have its tip index.
+func AlignmentQuartets(aln *Alignment, tre *tree.Tree, method SeqMethod) (*gr.QuartetTable, int, error) {
+	ids := make([]int16, len(aln.Taxa))
+	for i, taxon := range aln.Taxa {
+		id, err := tre.TipIndex(taxon)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w, %s", gr.ErrTipNameMismatch, err.Error())
+		}
+		ids[i] = int16(id)
+	}
+	n := len(aln.Taxa)
+	quartets := gr.NewQuartetTable(0)
+	if n < 4 {
+		return quartets, 0, nil
+	}
+	ps := makePairSites(aln)
+	var dist [][]float64
+	if method == SeqDistance {
+		dist = make([][]float64, n)
+		for i := range n {
+			dist[i] = make([]float64, n)
+			for j := range n {
+				if i != j {
+					dist[i][j] = ps.distance(i, j)
+				}
+			}
+		}
+	}
+	unresolved := 0
+	for a := 0; a < n; a++ {
+		for b := a + 1; b < n; b++ {
+			for c := b + 1; c < n; c++ {
+				for d := c + 1; d < n; d++ {
+					splits := [3][4]int{{a, b, c, d}, {a, c, b, d}, {a, d, b, c}}
+					var scores [3]float64
+					for t, s := range splits {
+						if method == SeqDistance {
+							scores[t] = dist[s[0]][s[1]] + dist[s[2]][s[3]]
+						} else {
+							scores[t] = -float64(ps.informative(s[0], s[1], s[2], s[3]))
+						}
+					}
+					t, ok := uniqueMin(scores)
+					if !ok {
+						unresolved++
+						continue
+					}
+					s := splits[t]
+					quartets.Add(gr.QuartetFromSplit(ids[s[0]], ids[s[1]], ids[s[2]], ids[s[3]]), 1)
+				}
+			}
+		}
+	}
+	return quartets, unresolved, nil
+}
+
+// Counts the quartets inferred from each alignment (see AlignmentQuartets) in
+// place of gene trees, weighting those of alignment i by weights[i]
+// (unweighted if nil). Of counting, only Cap and Constraint apply, since
+// alignments have no branches to weight by length or taxon copies. Stops and
+// returns ctx's error if ctx is cancelled while quartets are counted.
+func CountAlignmentQuartets(ctx context.Context, tre *tree.Tree, alns []*Alignment, weights []float64, nprocs int, method SeqMethod, counting CountMode) (*QuartetCounts, error) {
+	if counting.Length {
+		return nil, fmt.Errorf("%w, quartets from alignments cannot be weighted by branch length", ErrNoBranchLengths)
+	}
+	if weights != nil && len(weights) != len(alns) {
+		return nil, fmt.Errorf("%w, weights file has %d weights, but there are %d alignments", ErrInvalidFile, len(weights), len(alns))
+	}
+	if err := PrepareConstraintTree(tre); err != nil {
+		return nil, err
+	}
+	lg.Infof("inferring quartets from %d alignments by %s", len(alns), method)
+	var mu sync.Mutex
+	var missingOnce sync.Once
+	var unresolved, sets atomic.Int64
+	counts, occupancy := gr.NewQuartetTable(0), gr.NewQuartetTable(0)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(nprocs)
+	for i, aln := range alns {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			weight := weightCount(weights, i)
+			if weight == 0 {
+				return nil
+			}
+			quartets, n, err := AlignmentQuartets(aln, tre, method)
+			if err != nil {
+				return fmt.Errorf("alignment %s : %w", aln.Name, err)
+			}
+			if len(aln.Taxa) != len(tre.Tips()) {
+				missingOnce.Do(func() {
+					lg.Warnf("missing taxa detected in one or more alignments (first seen in alignment %s); "+
+						"this may cause issues with some scoring metrics", aln.Name)
+				})
+			}
+			unresolved.Add(int64(n))
+			sets.Add(int64(n + quartets.Len()))
+			mu.Lock()
+			defer mu.Unlock()
+			for q := range quartets.All() {
+				counts.Add(q, weight)
+				occupancy.Add(q.TaxaSet(), weight)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	lg.Infof("%d of %d sets of four taxa across the alignments were left unresolved", unresolved.Load(), sets.Load())
+	return &QuartetCounts{
+		tre:       tre,
+		counts:    counts,
+		occupancy: occupancy,
+		trees:     len(alns),
+		weighted:  weights != nil,
+		counting:  counting,
+	}, nil
+}
+
+// Names of the alignments, in order (e.g., for InferOptions.GeneNames)
+func AlignmentNames(alns []*Alignment) []string {
+	names := make([]string, len(alns))
+	for i, aln := range alns {
+		names[i] = aln.Name
+	}
+	return names
+}
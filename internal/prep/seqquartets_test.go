@@ -0,0 +1,185 @@
+package prep
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+// ab|cd has three informative sites and ac|bd one
+const abcdFasta = ">A\nAAACGG\n>B\nAAATGG\n>C\nGGGCGG\n>D desc\nGGG\nTGG\n"
+
+func writeAlignment(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFastaFile(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contents    string
+		taxa        []string
+		expectedErr error
+	}{
+		{name: "valid", contents: abcdFasta, taxa: []string{"A", "B", "C", "D"}},
+		{name: "lower case", contents: ">A\nacgt\n>B\nACGT\n", taxa: []string{"A", "B"}},
+		{name: "not aligned", contents: ">A\nACGT\n>B\nACG\n", expectedErr: ErrInvalidFile},
+		{name: "duplicate taxon", contents: ">A\nACGT\n>A\nACGT\n", expectedErr: ErrInvalidFile},
+		{name: "no header", contents: "ACGT\n>A\nACGT\n", expectedErr: ErrInvalidFormat},
+		{name: "no name", contents: ">\nACGT\n", expectedErr: ErrInvalidFormat},
+		{name: "empty", contents: "\n", expectedErr: ErrInvalidFile},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeAlignment(t, t.TempDir(), "locus.fasta", test.contents)
+			aln, err := ReadFastaFile(path)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if aln.Name != "locus" {
+				t.Errorf("got name %s, expected locus", aln.Name)
+			}
+			if !slices.Equal(aln.Taxa, test.taxa) {
+				t.Errorf("got taxa %v, expected %v", aln.Taxa, test.taxa)
+			}
+			for i, seq := range aln.Seqs {
+				if string(seq) != strings.ToUpper(string(seq)) {
+					t.Errorf("sequence %d is not upper case: %s", i, seq)
+				}
+			}
+		})
+	}
+}
+
+func TestReadAlignmentDir(t *testing.T) {
+	dir := t.TempDir()
+	writeAlignment(t, dir, "g2.fa", abcdFasta)
+	writeAlignment(t, dir, "g1.FASTA", abcdFasta)
+	writeAlignment(t, dir, "notes.txt", "not an alignment")
+	alns, err := ReadAlignmentDir(dir)
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	if names := AlignmentNames(alns); !slices.Equal(names, []string{"g1", "g2"}) {
+		t.Errorf("got alignments %v, expected [g1 g2]", names)
+	}
+	if _, err := ReadAlignmentDir(t.TempDir()); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("got error %v for a directory without alignments, expected %v", err, ErrInvalidFile)
+	}
+}
+
+func TestAlignmentQuartets(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := PrepareConstraintTree(tre); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		fasta      string
+		method     SeqMethod
+		expected   string // topology of ABCD ("" if unresolved)
+		unresolved int
+		err        error
+	}{
+		{name: "parsimony", fasta: abcdFasta, method: SeqParsimony, expected: "((A,B),(C,D));"},
+		{name: "distance", fasta: abcdFasta, method: SeqDistance, expected: "((A,B),(C,D));"},
+		{name: "parsimony tie", fasta: ">A\nAC\n>B\nAT\n>C\nGC\n>D\nGT\n", method: SeqParsimony, unresolved: 1},
+		{name: "distance tie", fasta: ">A\nAC\n>B\nAT\n>C\nGC\n>D\nGT\n", method: SeqDistance, unresolved: 1},
+		{name: "gaps are not states", fasta: ">A\nAA-\n>B\nAA-\n>C\nGGA\n>D\nGGA\n", method: SeqParsimony, expected: "((A,B),(C,D));"},
+		{name: "no shared sites", fasta: ">A\nA-\n>B\nA-\n>C\nG-\n>D\n-G\n", method: SeqDistance, unresolved: 1},
+		{name: "protein", fasta: ">A\nWWK\n>B\nWWL\n>C\nPPK\n>D\nPPL\n", method: SeqParsimony, expected: "((A,B),(C,D));"},
+		{name: "unknown taxon", fasta: ">A\nA\n>B\nA\n>C\nG\n>F\nG\n", method: SeqParsimony, err: gr.ErrTipNameMismatch},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			aln, err := ReadFastaFile(writeAlignment(t, t.TempDir(), "locus.fa", test.fasta))
+			if err != nil {
+				t.Fatal(err)
+			}
+			quartets, unresolved, err := AlignmentQuartets(aln, tre, test.method)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, expected %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if unresolved != test.unresolved {
+				t.Errorf("got %d unresolved, expected %d", unresolved, test.unresolved)
+			}
+			if test.expected == "" {
+				if quartets.Len() != 0 {
+					t.Errorf("got %s, expected no quartets", gr.QSetToString(quartets, tre))
+				}
+				return
+			}
+			qt, err := newick.NewParser(strings.NewReader(test.expected)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			q, err := gr.NewQuartet(qt, tre)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quartets.Len() != 1 || quartets.Get(q) != 1 {
+				t.Errorf("got %s, expected %s", gr.QSetToString(quartets, tre), test.expected)
+			}
+		})
+	}
+}
+
+func TestCountAlignmentQuartets(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	dir := t.TempDir()
+	writeAlignment(t, dir, "g1.fa", abcdFasta)
+	writeAlignment(t, dir, "g2.fa", abcdFasta)
+	alns, err := ReadAlignmentDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := CountAlignmentQuartets(context.Background(), tre, alns, nil, 2, SeqParsimony, CountMode{})
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	if counts.NumGeneTrees() != 2 {
+		t.Errorf("got %d loci, expected 2", counts.NumGeneTrees())
+	}
+	qt, err := newick.NewParser(strings.NewReader("((A,B),(C,D));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	q, err := gr.NewQuartet(qt, tre)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := counts.counts.Get(q); c != 2 {
+		t.Errorf("got count %d, expected 2", c)
+	}
+	if c := counts.occupancy.Get(q.TaxaSet()); c != 2 {
+		t.Errorf("got occupancy %d, expected 2", c)
+	}
+	_, err = CountAlignmentQuartets(context.Background(), tre, alns, nil, 2, SeqParsimony, CountMode{Length: true})
+	if !errors.Is(err, ErrNoBranchLengths) {
+		t.Errorf("got error %v with length weights, expected %v", err, ErrNoBranchLengths)
+	}
+}
@@ -0,0 +1,289 @@
+package prep
+
+import (
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+// Summary of the gene trees and the quartets they induce, for checking the
+// input before a run
+type InputStats struct {
+	Taxa           int      // taxa in the constraint tree
+	GeneTreeTaxa   []int    // number of taxa in each gene tree
+	Quartets       uint64   // quartets in the gene trees, counted once per gene tree they are in
+	Agreeing       uint64   // of Quartets, those the constraint tree displays
+	AgreeingUnique int      // unique quartets the constraint tree displays
+	TaxaSets       int      // sets of four taxa with a quartet in some gene tree
+	QuartetCounts  []uint32 // number of gene trees with each unique quartet (ascending)
+}
+
+// Counts the quartets in the gene trees (see processQuartets) and summarizes
+// them against the constraint tree, which is prepared in place (see
+// PrepareConstraintTree). Returns an error if the constraint tree or gene trees
+// are not valid.
+func InputStatistics(tre *tree.Tree, geneTrees []*tree.Tree, nprocs int) (*InputStats, error) {
+	if err := PrepareConstraintTree(tre); err != nil {
+		return nil, err
+	}
+	stats := &InputStats{Taxa: len(tre.Tips()), GeneTreeTaxa: make([]int, len(geneTrees))}
+	for i, gt := range geneTrees {
+		stats.GeneTreeTaxa[i] = len(gt.Tips())
+	}
+	qCounts, err := processQuartets(geneTrees, nil, tre, 0, nprocs)
+	if err != nil {
+		return nil, err
+	}
+	td := gr.MakeTreeData(tre, nil)
+	seen := gr.NewQuartetTable(qCounts.Len())
+	stats.QuartetCounts = make([]uint32, 0, qCounts.Len())
+	for q, c := range qCounts.All() {
+		stats.Quartets += uint64(c)
+		stats.QuartetCounts = append(stats.QuartetCounts, c)
+		if td.Displays(q) {
+			stats.Agreeing += uint64(c)
+			stats.AgreeingUnique++
+		}
+		if set := q.AllQuartets()[0]; !seen.Contains(set) {
+			seen.Add(set, 1)
+			stats.TaxaSets++
+		}
+	}
+	slices.Sort(stats.QuartetCounts)
+	return stats, nil
+}
+
+// Value at fraction p of sorted values (by nearest rank)
+func quantile[T int | uint32](sorted []T, p float64) T {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// Mean of values (NaN if there are none)
+func meanOf[T int | uint32](values []T) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += float64(v)
+	}
+	return sum / float64(len(values))
+}
+
+// Write csv file summarizing the input to writer: the number of gene trees,
+// their taxa coverage, the number of unique quartets and how many agree with
+// the constraint tree, and the distribution of quartet counts.
+//
+// There are two columns: "Metric", "Value"
+func WriteInputStatsToCSV(stats *InputStats, w io.Writer) error {
+	fmtInt := func(n int) string { return strconv.Itoa(n) }
+	fmtFloat := func(f float64) string { return strconv.FormatFloat(f, 'f', 4, 64) }
+	data := [][]string{
+		{"Metric", "Value"},
+		{"Gene Trees", fmtInt(len(stats.GeneTreeTaxa))},
+		{"Taxa", fmtInt(stats.Taxa)},
+	}
+	if taxa := slices.Sorted(slices.Values(stats.GeneTreeTaxa)); len(taxa) != 0 {
+		complete := 0
+		for _, n := range taxa {
+			if n == stats.Taxa {
+				complete++
+			}
+		}
+		data = append(data,
+			[]string{"Gene Tree Taxa Min", fmtInt(taxa[0])},
+			[]string{"Gene Tree Taxa Median", fmtInt(quantile(taxa, 0.5))},
+			[]string{"Gene Tree Taxa Mean", fmtFloat(meanOf(taxa))},
+			[]string{"Gene Tree Taxa Max", fmtInt(taxa[len(taxa)-1])},
+			[]string{"Mean Taxa Coverage", fmtFloat(meanOf(taxa) / float64(stats.Taxa))},
+			[]string{"Gene Trees With All Taxa", fmtInt(complete)},
+		)
+	}
+	unique := len(stats.QuartetCounts)
+	data = append(data,
+		[]string{"Quartets", strconv.FormatUint(stats.Quartets, 10)},
+		[]string{"Unique Quartets", fmtInt(unique)},
+		[]string{"Sets of Four Taxa", fmtInt(stats.TaxaSets)},
+		[]string{"Fraction of Quartets Agreeing With Constraint Tree", fmtFloat(float64(stats.Agreeing) / float64(stats.Quartets))},
+		[]string{"Fraction of Unique Quartets Agreeing With Constraint Tree", fmtFloat(float64(stats.AgreeingUnique) / float64(unique))},
+	)
+	if counts := stats.QuartetCounts; len(counts) != 0 {
+		data = append(data,
+			[]string{"Quartet Count Min", strconv.FormatUint(uint64(counts[0]), 10)},
+			[]string{"Quartet Count Lower Quartile", strconv.FormatUint(uint64(quantile(counts, 0.25)), 10)},
+			[]string{"Quartet Count Median", strconv.FormatUint(uint64(quantile(counts, 0.5)), 10)},
+			[]string{"Quartet Count Upper Quartile", strconv.FormatUint(uint64(quantile(counts, 0.75)), 10)},
+			[]string{"Quartet Count Mean", fmtFloat(meanOf(counts))},
+			[]string{"Quartet Count Max", strconv.FormatUint(uint64(counts[len(counts)-1]), 10)},
+		)
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the taxa coverage of each gene tree to writer, labeling
+// gene trees with names (or their position from 1 if names is nil).
+//
+// There are three columns: "Gene Tree", "Taxa", "Coverage"
+func WriteCoverageToCSV(stats *InputStats, names []string, w io.Writer) error {
+	data := [][]string{{"Gene Tree", "Taxa", "Coverage"}}
+	for i, n := range stats.GeneTreeTaxa {
+		name := strconv.Itoa(i + 1)
+		if names != nil {
+			name = names[i]
+		}
+		data = append(data, []string{name, strconv.Itoa(n), strconv.FormatFloat(float64(n)/float64(stats.Taxa), 'f', 4, 64)})
+	}
+	return writeCSV(data, w)
+}
+
+// Write csv file with the distribution of quartet counts to writer: the number
+// of unique quartets found in each number of gene trees.
+//
+// There are two columns: "Gene Trees", "Unique Quartets"
+func WriteQuartetCountsToCSV(stats *InputStats, w io.Writer) error {
+	data := [][]string{{"Gene Trees", "Unique Quartets"}}
+	for i := 0; i < len(stats.QuartetCounts); {
+		c := stats.QuartetCounts[i]
+		j := i
+		for j < len(stats.QuartetCounts) && stats.QuartetCounts[j] == c {
+			j++
+		}
+		data = append(data, []string{strconv.FormatUint(uint64(c), 10), strconv.Itoa(j - i)})
+		i = j
+	}
+	return writeCSV(data, w)
+}
+
+// How the root of a gene tree is handled when its quartets are counted
+type RootAudit struct {
+	RootDegree      int    // neighbors of the root (2 if rooted, 1 for a unifurcation)
+	SplitsChanged   bool   // unrooting changed the splits of the tree
+	Quartets        int    // quartets the tree contributes (-1 if they could not be counted)
+	QuartetsChanged bool   // rooting changed the quartets the tree contributes
+	Note            string // what went wrong, if anything
+}
+
+// Whether the gene tree is rooted (its root has two neighbors)
+func (a RootAudit) Rooted() bool {
+	return a.RootDegree == 2
+}
+
+// Checks that the root of each gene tree does not affect the quartets it
+// contributes: the quartets counted for the tree as it is given, after
+// unrooting it, and after rerooting it on another internal node should be the
+// same, as should its splits before and after unrooting. Problems with a tree
+// (e.g., a root unifurcation, which reads as an unnamed tip) are recorded in
+// its audit rather than returned. tre is prepared in place (see
+// PrepareConstraintTree), and the gene trees are not modified.
+func AuditGeneTreeRoots(tre *tree.Tree, geneTrees []*tree.Tree) ([]RootAudit, error) {
+	if err := PrepareConstraintTree(tre); err != nil {
+		return nil, err
+	}
+	audits := make([]RootAudit, len(geneTrees))
+	for i, gt := range geneTrees {
+		audits[i] = auditRoot(gt, tre)
+	}
+	return audits, nil
+}
+
+func auditRoot(gt, tre *tree.Tree) RootAudit {
+	audit := RootAudit{RootDegree: gt.Root().Nneigh(), Quartets: -1}
+	for _, tip := range gt.Tips() {
+		if tip.Name() == "" {
+			audit.Note = "unnamed tip"
+			if tip == gt.Root() {
+				audit.Note = "root is a unifurcation"
+			}
+			return audit
+		}
+	}
+	unrooted := gt.Clone()
+	unrooted.UnRoot()
+	audit.SplitsChanged = !maps.Equal(treeSplits(gt), treeSplits(unrooted))
+	rerooted := unrooted.Clone()
+	for _, n := range rerooted.Nodes() {
+		if !n.Tip() && n != rerooted.Root() {
+			if err := rerooted.Reroot(n); err != nil {
+				audit.Note = err.Error()
+				return audit
+			}
+			break
+		}
+	}
+	var counted [3]*gr.QuartetTable
+	for j, t := range []*tree.Tree{gt.Clone(), unrooted, rerooted} {
+		if err := t.UpdateTipIndex(); err != nil {
+			audit.Note = ErrMulTree.Error()
+			return audit
+		}
+		var err error
+		if counted[j], err = gr.QuartetsFromTree(t, tre); err != nil {
+			audit.Note = err.Error()
+			return audit
+		}
+	}
+	audit.Quartets = counted[0].Len()
+	audit.QuartetsChanged = !counted[0].Equal(counted[1]) || !counted[0].Equal(counted[2])
+	return audit
+}
+
+// Nontrivial splits of tre, each written as the sorted taxa on the side without
+// the first taxon (by name)
+func treeSplits(tre *tree.Tree) map[string]bool {
+	names := make([]string, 0)
+	for _, tip := range tre.Tips() {
+		names = append(names, tip.Name())
+	}
+	slices.Sort(names)
+	splits := make(map[string]bool)
+	var walk func(cur, prev *tree.Node) []string
+	walk = func(cur, prev *tree.Node) []string {
+		below := make([]string, 0)
+		if cur.Tip() {
+			below = append(below, cur.Name())
+		}
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				below = append(below, walk(n, cur)...)
+			}
+		}
+		if prev != nil && len(below) > 1 && len(below) < len(names)-1 {
+			side := slices.Sorted(slices.Values(below))
+			if side[0] == names[0] {
+				side = slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+					_, found := slices.BinarySearch(side, name)
+					return found
+				})
+			}
+			splits[strings.Join(side, ",")] = true
+		}
+		return below
+	}
+	walk(tre.Root(), nil)
+	return splits
+}
+
+// Write csv file with the root audit of each gene tree (see
+// AuditGeneTreeRoots) to writer, labeling gene trees with names.
+//
+// There are seven columns: "Gene Tree", "Root Degree", "Rooted", "Unroot
+// Changed Splits", "Quartets", "Rooting Changed Quartets", "Note"
+func WriteRootAuditToCSV(audits []RootAudit, names []string, w io.Writer) error {
+	data := [][]string{{"Gene Tree", "Root Degree", "Rooted", "Unroot Changed Splits", "Quartets", "Rooting Changed Quartets", "Note"}}
+	for i, a := range audits {
+		quartets := ""
+		if a.Quartets >= 0 {
+			quartets = strconv.Itoa(a.Quartets)
+		}
+		data = append(data, []string{
+			names[i], strconv.Itoa(a.RootDegree), strconv.FormatBool(a.Rooted()), strconv.FormatBool(a.SplitsChanged),
+			quartets, strconv.FormatBool(a.QuartetsChanged), a.Note,
+		})
+	}
+	return writeCSV(data, w)
+}
@@ -0,0 +1,146 @@
+package prep
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestInputStatistics(t *testing.T) {
+	testCases := []struct {
+		name           string
+		geneTrees      []string
+		geneTreeTaxa   []int
+		quartets       uint64
+		agreeing       uint64
+		agreeingUnique int
+		taxaSets       int
+		quartetCounts  []uint32
+	}{
+		{
+			name:           "agree",
+			geneTrees:      []string{"((A,B),(C,D));", "((A,B),(C,D));"},
+			geneTreeTaxa:   []int{4, 4},
+			quartets:       2,
+			agreeing:       2,
+			agreeingUnique: 1,
+			taxaSets:       1,
+			quartetCounts:  []uint32{2},
+		},
+		{
+			name:           "conflict",
+			geneTrees:      []string{"((A,B),(C,D));", "((A,C),(B,D));", "((A,B),(C,D));"},
+			geneTreeTaxa:   []int{4, 4, 4},
+			quartets:       3,
+			agreeing:       2,
+			agreeingUnique: 1,
+			taxaSets:       1,
+			quartetCounts:  []uint32{1, 2},
+		},
+		{
+			name:           "missing taxa",
+			geneTrees:      []string{"((A,C),(B,E));", "(((A,B),C),(D,E));"},
+			geneTreeTaxa:   []int{4, 5},
+			quartets:       6,
+			agreeing:       5,
+			agreeingUnique: 5,
+			taxaSets:       5,
+			quartetCounts:  []uint32{1, 1, 1, 1, 1, 1},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader("(((A,B),C),(D,E));")).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			gtrees := make([]*tree.Tree, len(test.geneTrees))
+			for i, nwk := range test.geneTrees {
+				if gtrees[i], err = newick.NewParser(strings.NewReader(nwk)).Parse(); err != nil {
+					t.Fatal("invalid newick tree; test is written wrong")
+				}
+			}
+			stats, err := InputStatistics(tre, gtrees, runtime.GOMAXPROCS(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Taxa != 5 {
+				t.Errorf("got %d taxa, expected 5", stats.Taxa)
+			}
+			if !slices.Equal(stats.GeneTreeTaxa, test.geneTreeTaxa) {
+				t.Errorf("got gene tree taxa %v, expected %v", stats.GeneTreeTaxa, test.geneTreeTaxa)
+			}
+			if stats.Quartets != test.quartets || stats.Agreeing != test.agreeing || stats.AgreeingUnique != test.agreeingUnique {
+				t.Errorf("got %d quartets (%d agreeing, %d unique), expected %d (%d agreeing, %d unique)",
+					stats.Quartets, stats.Agreeing, stats.AgreeingUnique, test.quartets, test.agreeing, test.agreeingUnique)
+			}
+			if stats.TaxaSets != test.taxaSets {
+				t.Errorf("got %d sets of four taxa, expected %d", stats.TaxaSets, test.taxaSets)
+			}
+			if !slices.Equal(stats.QuartetCounts, test.quartetCounts) {
+				t.Errorf("got quartet counts %v, expected %v", stats.QuartetCounts, test.quartetCounts)
+			}
+		})
+	}
+}
+
+func TestWriteQuartetCountsToCSV(t *testing.T) {
+	var b strings.Builder
+	stats := &InputStats{QuartetCounts: []uint32{1, 1, 1, 3, 7, 7}}
+	if err := WriteQuartetCountsToCSV(stats, &b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Gene Trees,Unique Quartets\n1,3\n3,1\n7,2\n"
+	if b.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", b.String(), expected)
+	}
+}
+
+func TestAuditGeneTreeRoots(t *testing.T) {
+	testCases := []struct {
+		name       string
+		geneTree   string
+		rootDegree int
+		quartets   int
+		note       string
+	}{
+		{name: "rooted", geneTree: "((A,B),(C,(D,E)));", rootDegree: 2, quartets: 5},
+		{name: "rooted on tip", geneTree: "(A,(B,(C,(D,E))));", rootDegree: 2, quartets: 5},
+		{name: "trifurcation", geneTree: "((A,B),C,(D,E));", rootDegree: 3, quartets: 5},
+		{name: "polytomy", geneTree: "(A,B,C,(D,E));", rootDegree: 4, quartets: 3},
+		{name: "internal unifurcation", geneTree: "((A,B),((C),(D,E)));", rootDegree: 2, quartets: 5},
+		{name: "root unifurcation", geneTree: "(((A,B),(C,D)));", rootDegree: 1, quartets: -1, note: "root is a unifurcation"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, err := newick.NewParser(strings.NewReader("((A,B),(C,(D,E)));")).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			gt, err := newick.NewParser(strings.NewReader(test.geneTree)).Parse()
+			if err != nil {
+				t.Fatal("invalid newick tree; test is written wrong")
+			}
+			before := gt.Newick()
+			audits, err := AuditGeneTreeRoots(tre, []*tree.Tree{gt})
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := audits[0]
+			if a.RootDegree != test.rootDegree || a.Quartets != test.quartets || a.Note != test.note {
+				t.Errorf("got root degree %d, %d quartets, note %q, expected %d, %d, %q",
+					a.RootDegree, a.Quartets, a.Note, test.rootDegree, test.quartets, test.note)
+			}
+			if a.SplitsChanged || a.QuartetsChanged {
+				t.Errorf("got splits changed %t, quartets changed %t, expected neither", a.SplitsChanged, a.QuartetsChanged)
+			}
+			if gt.Newick() != before {
+				t.Errorf("gene tree was modified: %s", gt.Newick())
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package prep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Gene tree file that is read one tree at a time (see All), for inputs with
+// too many gene trees to hold in memory. Nexus files are read as text, but
+// each tree is only parsed when it is reached.
+type GeneTreeStream struct {
+	file    string
+	format  Format
+	Weights []float64 // weight of each gene tree (nil if unweighted); checked against the number of trees once they are read
+}
+
+// Iterates over the gene trees (which are already in memory)
+func (gt *GeneTrees) All() iter.Seq2[*tree.Tree, error] {
+	return treesOf(gt.Trees)
+}
+
+// Reads in and validates the constraint tree like ReadInputFiles, but only
+// checks that the gene tree file can be opened, returning a stream to read the
+// gene trees from
+func ReadStreamInputFiles(treeFile, genetreesFile string, format Format, opts ...InputOption) (*tree.Tree, *GeneTreeStream, error) {
+	var options inputOpts
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, nil, err
+		}
+	}
+	tre, err := readTreeFile(treeFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := openInput(genetreesFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening %s, %w", genetreesFile, err)
+	}
+	_ = file.Close()
+	stream := &GeneTreeStream{file: genetreesFile, format: format}
+	if options.weightsFile != "" {
+		if stream.Weights, err = readWeightsFile(options.weightsFile, -1); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tre, stream, nil
+}
+
+// Iterates over the gene trees in the file, opening it again each time it is
+// called. Iteration stops after the first error. Branch lengths and supports
+// of the root are dropped before parsing, as gotree logs a message for each
+// tree that has them.
+func (s *GeneTreeStream) All() iter.Seq2[*tree.Tree, error] {
+	return func(yield func(*tree.Tree, error) bool) {
+		file, err := openInputWithProgress(s.file)
+		if err != nil {
+			yield(nil, fmt.Errorf("error opening %s, %w", s.file, err))
+			return
+		}
+		defer func() { _ = file.Close() }()
+		switch s.format {
+		case Newick:
+			s.newickTrees(file, yield)
+		case Nexus:
+			s.nexusTrees(file, yield)
+		default:
+			yield(nil, fmt.Errorf("%w, not a valid file format", ErrInvalidFile))
+		}
+	}
+}
+
+func (s *GeneTreeStream) newickTrees(file io.Reader, yield func(*tree.Tree, error) bool) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxNewickLine)
+	read := 0
+	for i := 0; scanner.Scan(); i++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		genetree, err := newick.NewParser(bytes.NewReader(trimRootAnnotations(line))).Parse()
+		if err != nil {
+			yield(nil, fmt.Errorf("%w, error reading gene tree on line %d in %s: %s",
+				ErrInvalidFormat, i+1, s.file, err.Error()))
+			return
+		}
+		read++
+		if !yield(genetree, nil) {
+			return
+		}
+	}
+	switch {
+	case scanner.Err() != nil:
+		yield(nil, fmt.Errorf("%w, error reading %s: %w", ErrInvalidFormat, s.file, scanner.Err()))
+	case read == 0:
+		yield(nil, fmt.Errorf("%w, empty gene tree file %s", ErrInvalidFile, s.file))
+	}
+}
+
+func (s *GeneTreeStream) nexusTrees(file io.Reader, yield func(*tree.Tree, error) bool) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		yield(nil, fmt.Errorf("error reading %s, %w", s.file, err))
+		return
+	}
+	trees, translate, err := nexusTreeStatements(data)
+	if err != nil {
+		yield(nil, fmt.Errorf("%w, error reading gene tree nexus file %s: %s", ErrInvalidFormat, s.file, err.Error()))
+		return
+	}
+	for _, t := range trees {
+		t.newick = string(trimRootAnnotations([]byte(t.newick)))
+		genetree, err := t.parse(translate)
+		if err != nil {
+			yield(nil, fmt.Errorf("%w, error reading gene tree nexus file %s: tree %s: %s",
+				ErrInvalidFormat, s.file, t.name, err.Error()))
+			return
+		}
+		if !yield(genetree, nil) {
+			return
+		}
+	}
+}
+
+// Drops the label, support, and branch length after the last closing
+// parenthesis of a newick string (those of the root), which don't affect
+// quartets
+func trimRootAnnotations(nwk []byte) []byte {
+	end := bytes.LastIndexByte(nwk, ')')
+	if end == -1 || !bytes.HasSuffix(nwk, []byte(";")) {
+		return nwk
+	}
+	return append(nwk[:end+1:end+1], ';')
+}
@@ -0,0 +1,100 @@
+package prep
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPreprocessStream(t *testing.T) {
+	dir := t.TempDir()
+	annotated := filepath.Join(dir, "annotated.nwk")
+	if err := os.WriteFile(annotated, []byte("((A,C),(B,D))root:0.5;\n\n((B,E),(C,D))0.9;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	weights := filepath.Join(dir, "weights.txt")
+	if err := os.WriteFile(weights, []byte("1\n0.5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	shortWeights := filepath.Join(dir, "short-weights.txt")
+	if err := os.WriteFile(shortWeights, []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name        string
+		geneTrees   string
+		format      Format
+		weights     string
+		discordant  bool // gene trees have quartets not in the constraint tree
+		expectedErr error
+	}{
+		{name: "newick", geneTrees: "testdata/quartets.nwk", format: Newick},
+		{name: "nexus", geneTrees: "testdata/quartets.nex", format: Nexus},
+		{name: "compressed", geneTrees: "testdata/quartets.nwk.bz2", format: Newick},
+		{name: "compressed nexus", geneTrees: "testdata/quartets.nex.gz", format: Nexus},
+		{name: "root annotations", geneTrees: annotated, format: Newick, discordant: true},
+		{name: "weighted", geneTrees: annotated, format: Newick, weights: weights, discordant: true},
+		{name: "too few weights", geneTrees: "testdata/quartets.nwk", format: Newick, weights: shortWeights, expectedErr: ErrInvalidFile},
+		{name: "bad gene tree", geneTrees: "testdata/badtree.nwk", format: Newick, expectedErr: ErrInvalidFormat},
+		{name: "empty", geneTrees: "testdata/empty.nwk", format: Newick, expectedErr: ErrInvalidFile},
+		{name: "truncated", geneTrees: "testdata/truncated.nwk.gz", format: Newick, expectedErr: ErrInvalidFormat},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			tre, stream, err := ReadStreamInputFiles("testdata/constraint.nwk", test.geneTrees, test.format, WithWeights(test.weights))
+			if err != nil {
+				t.Fatalf("failed to open stream: %v", err)
+			}
+			nprocs := runtime.GOMAXPROCS(0)
+			td, _, n, err := PreprocessStream(context.Background(), tre, stream.All(), stream.Weights, nil, nprocs, QuartetFilterOptions{}, 0, CountMode{})
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			// the same gene trees read into memory should give the same quartets
+			memTre, geneTrees, err := ReadInputFiles("testdata/constraint.nwk", test.geneTrees, test.format, WithWeights(test.weights))
+			if err != nil {
+				t.Fatalf("failed to read gene trees: %v", err)
+			}
+			expected, _, err := Preprocess(context.Background(), memTre, geneTrees.Trees, geneTrees.Weights, geneTrees.Names, nprocs, QuartetFilterOptions{}, 0, CountMode{})
+			if err != nil {
+				t.Fatalf("failed to preprocess gene trees: %v", err)
+			}
+			if test.discordant && expected.TotalNumQuartets() == 0 {
+				t.Fatal("no quartets to compare; test is written wrong")
+			}
+			if n != len(geneTrees.Trees) {
+				t.Errorf("read %d gene trees, expected %d", n, len(geneTrees.Trees))
+			}
+			if td.TotalNumQuartets() != expected.TotalNumQuartets() || td.TotalNumUniqueQuartets() != expected.TotalNumUniqueQuartets() {
+				t.Errorf("got %d (%d unique) quartets, expected %d (%d unique)", td.TotalNumQuartets(), td.TotalNumUniqueQuartets(),
+					expected.TotalNumQuartets(), expected.TotalNumUniqueQuartets())
+			}
+		})
+	}
+}
+
+func TestTrimRootAnnotations(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "((A,B),C);", expected: "((A,B),C);"},
+		{input: "((A,B),C)root;", expected: "((A,B),C);"},
+		{input: "((A,B)0.9:0.1,C)0.5:0.2;", expected: "((A,B)0.9:0.1,C);"},
+		{input: "A;", expected: "A;"},
+		{input: "((A,B),C)", expected: "((A,B),C)"},
+	}
+	for _, test := range testCases {
+		t.Run(test.input, func(t *testing.T) {
+			if got := string(trimRootAnnotations([]byte(test.input))); got != test.expected {
+				t.Errorf("got %s, expected %s", got, test.expected)
+			}
+		})
+	}
+}
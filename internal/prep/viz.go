@@ -0,0 +1,230 @@
+package prep
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+// Color of reticulation edges in DOT and GraphML output
+const reticulationColor = "#d62728"
+
+// Graph formats networks can be converted to for visualization
+var ParseGraphFormat = map[string]func(*gr.Network, map[string]float64, io.Writer) error{
+	"dot":      WriteNetworkToDOT,
+	"graphml":  WriteNetworkToGraphML,
+	"phyloxml": WriteNetworkToPhyloXML,
+}
+
+// Vertex of a network drawn as a graph (tips are labeled with their taxon,
+// hybrid nodes with their reticulation label)
+type vizNode struct {
+	id    int
+	label string
+	tip   bool
+}
+
+// Edge of a network drawn as a graph
+type vizEdge struct {
+	from, to int
+	ret      string // reticulation label of a reticulation edge ("" for tree edges)
+}
+
+// Vertices and edges of ntw, where the leaf standing in for the second parent
+// of each hybrid node is replaced by a reticulation edge to the hybrid node
+func networkGraph(ntw *gr.Network) ([]vizNode, []vizEdge, error) {
+	hybrids := make(map[string]*tree.Node)
+	for _, n := range ntw.NetTree.Nodes() {
+		if !n.Tip() && strings.Contains(n.Name(), "#") {
+			hybrids[n.Name()] = n
+		}
+	}
+	nodes := make([]vizNode, 0)
+	edges := make([]vizEdge, 0)
+	var err error
+	var walk func(cur, prev *tree.Node)
+	walk = func(cur, prev *tree.Node) {
+		if cur.Tip() && strings.Contains(cur.Name(), "#") {
+			h, ok := hybrids[cur.Name()]
+			if !ok {
+				err = fmt.Errorf("%w, %s has no hybrid node", gr.ErrInvalidRetLabel, cur.Name())
+				return
+			}
+			edges = append(edges, vizEdge{from: prev.Id(), to: h.Id(), ret: cur.Name()})
+			return
+		}
+		label := ""
+		if cur.Tip() || strings.Contains(cur.Name(), "#") {
+			label = cur.Name()
+		}
+		nodes = append(nodes, vizNode{id: cur.Id(), label: label, tip: cur.Tip()})
+		if prev != nil {
+			edges = append(edges, vizEdge{from: prev.Id(), to: cur.Id()})
+		}
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				walk(n, cur)
+			}
+		}
+	}
+	walk(ntw.NetTree.Root(), nil)
+	return nodes, edges, err
+}
+
+// Label of a reticulation edge, with its support if it is known
+func retEdgeLabel(label string, support map[string]float64) string {
+	if s, ok := support[label]; ok && !math.IsNaN(s) {
+		return fmt.Sprintf("%s (%s)", label, strconv.FormatFloat(s, 'f', 2, 64))
+	}
+	return label
+}
+
+// Escapes s for a double quoted DOT string
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Writes ntw as a Graphviz DOT digraph to w. Tips are labeled with their
+// taxon, and reticulation edges are colored and labeled with their
+// reticulation label and support (the fraction of informative quartets that
+// agree with them, left off if support is nil or has no value for them).
+func WriteNetworkToDOT(ntw *gr.Network, support map[string]float64, w io.Writer) error {
+	nodes, edges, err := networkGraph(ntw)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("digraph network {\n\tnode [shape=point];\n")
+	for _, n := range nodes {
+		switch {
+		case n.tip:
+			fmt.Fprintf(&b, "\tn%d [label=%s, shape=plaintext];\n", n.id, dotQuote(n.label))
+		case n.label != "":
+			fmt.Fprintf(&b, "\tn%d [xlabel=%s];\n", n.id, dotQuote(n.label))
+		}
+	}
+	for _, e := range edges {
+		if e.ret == "" {
+			fmt.Fprintf(&b, "\tn%d -> n%d;\n", e.from, e.to)
+		} else {
+			fmt.Fprintf(&b, "\tn%d -> n%d [color=%s, fontcolor=%s, style=dashed, label=%s];\n",
+				e.from, e.to, dotQuote(reticulationColor), dotQuote(reticulationColor), dotQuote(retEdgeLabel(e.ret, support)))
+		}
+	}
+	b.WriteString("}\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("error writing dot file: %s", err)
+	}
+	return nil
+}
+
+// Escapes s for GraphML text
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s)) // nolint (writing to a strings.Builder can't fail)
+	return b.String()
+}
+
+// Writes ntw as a GraphML directed graph to w, with the same labels, colors,
+// and support as WriteNetworkToDOT as node and edge attributes (reticulation
+// edges have reticulation set to true).
+func WriteNetworkToGraphML(ntw *gr.Network, support map[string]float64, w io.Writer) error {
+	nodes, edges, err := networkGraph(ntw)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="label" for="all" attr.name="label" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="tip" for="node" attr.name="tip" attr.type="boolean"/>` + "\n")
+	b.WriteString(`  <key id="reticulation" for="edge" attr.name="reticulation" attr.type="boolean"/>` + "\n")
+	b.WriteString(`  <key id="support" for="edge" attr.name="support" attr.type="double"/>` + "\n")
+	b.WriteString(`  <key id="color" for="edge" attr.name="color" attr.type="string"/>` + "\n")
+	b.WriteString(`  <graph id="network" edgedefault="directed">` + "\n")
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "    <node id=\"n%d\">\n", n.id)
+		if n.label != "" {
+			fmt.Fprintf(&b, "      <data key=\"label\">%s</data>\n", xmlEscape(n.label))
+		}
+		fmt.Fprintf(&b, "      <data key=\"tip\">%t</data>\n", n.tip)
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range edges {
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=\"n%d\" target=\"n%d\">\n", i, e.from, e.to)
+		fmt.Fprintf(&b, "      <data key=\"reticulation\">%t</data>\n", e.ret != "")
+		if e.ret != "" {
+			fmt.Fprintf(&b, "      <data key=\"label\">%s</data>\n", xmlEscape(retEdgeLabel(e.ret, support)))
+			if s, ok := support[e.ret]; ok && !math.IsNaN(s) {
+				fmt.Fprintf(&b, "      <data key=\"support\">%s</data>\n", strconv.FormatFloat(s, 'f', -1, 64))
+			}
+			fmt.Fprintf(&b, "      <data key=\"color\">%s</data>\n", reticulationColor)
+		}
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("error writing graphml file: %s", err)
+	}
+	return nil
+}
+
+const phyloXMLHeader = `<phyloxml xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"` +
+	` xsi:schemaLocation="http://www.phyloxml.org http://www.phyloxml.org/1.10/phyloxml.xsd"` +
+	` xmlns="http://www.phyloxml.org">` + "\n"
+
+// Writes phyloxml document with the given phylogeny elements (see
+// gr.Network.PhyloXML) to w, each after its comment (none if "")
+func writePhyloXML(phylogenies, comments []string, w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(phyloXMLHeader)
+	for i, phylogeny := range phylogenies {
+		if comments[i] != "" {
+			fmt.Fprintf(&b, "  <!-- %s -->\n", comments[i])
+		}
+		fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(phylogeny, "\n", "\n  "))
+	}
+	b.WriteString("</phyloxml>\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("error writing phyloxml file: %s", err)
+	}
+	return nil
+}
+
+// Writes ntw as a phyloxml document to w, which Archaeopteryx can open, with
+// each reticulation as a hybridization clade_relation whose confidence is its
+// support (left off if support is nil or has no value for it).
+func WriteNetworkToPhyloXML(ntw *gr.Network, support map[string]float64, w io.Writer) error {
+	if support != nil {
+		defer func(prev map[string]float64) { ntw.Support = prev }(ntw.Support)
+		ntw.Support = support
+	}
+	return writePhyloXML([]string{ntw.PhyloXML()}, []string{""}, w)
+}
+
+// Writes the constraint tree and the optimal networks (one per number of
+// edges, starting from the constraint tree at k = 0) to w as a phyloxml
+// document with one phylogeny each. The percent of quartets satisfied and dp
+// score of each network are written in a comment before it, as in
+// WriteNetworksNexus.
+func WriteNetworksPhyloXML(constTree *tree.Tree, networks []*gr.Network, qsat []float64, scores []string, w io.Writer) error {
+	if len(networks) != len(qsat) || len(scores) != len(networks)+1 {
+		panic(fmt.Sprintf("there should be a score for every network, %d %+v %+v", len(networks), qsat, scores))
+	}
+	phylogenies := []string{(&gr.Network{NetTree: constTree}).PhyloXML()}
+	comments := []string{fmt.Sprintf("k = 0, score = %s", scores[0])}
+	for i, ntw := range networks {
+		phylogenies = append(phylogenies, ntw.PhyloXML())
+		comments = append(comments, fmt.Sprintf("k = %d, quartets satisfied = %s%%, score = %s",
+			i+1, strconv.FormatFloat(qsat[i], 'f', -1, 64), scores[i+1]))
+	}
+	return writePhyloXML(phylogenies, comments, w)
+}
@@ -0,0 +1,159 @@
+package prep
+
+import (
+	"encoding/xml"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+)
+
+func TestWriteNetworkToDOT(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,(B)#H1),(C,(#H1,D)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick; test is written wrong")
+	}
+	ntw, err := ConvertToNetwork(tre)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	testCases := []struct {
+		name    string
+		support map[string]float64
+		retEdge string
+	}{
+		{
+			name:    "no support",
+			support: nil,
+			retEdge: "\tn7 -> n3 [color=\"#d62728\", fontcolor=\"#d62728\", style=dashed, label=\"#H1\"];\n",
+		},
+		{
+			name:    "support",
+			support: map[string]float64{"#H1": 0.756},
+			retEdge: "\tn7 -> n3 [color=\"#d62728\", fontcolor=\"#d62728\", style=dashed, label=\"#H1 (0.76)\"];\n",
+		},
+		{
+			name:    "no informative quartets",
+			support: map[string]float64{"#H1": math.NaN()},
+			retEdge: "\tn7 -> n3 [color=\"#d62728\", fontcolor=\"#d62728\", style=dashed, label=\"#H1\"];\n",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := WriteNetworkToDOT(ntw, test.support, &b); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			expected := "digraph network {\n" +
+				"\tnode [shape=point];\n" +
+				"\tn2 [label=\"A\", shape=plaintext];\n" +
+				"\tn3 [xlabel=\"#H1\"];\n" +
+				"\tn4 [label=\"B\", shape=plaintext];\n" +
+				"\tn6 [label=\"C\", shape=plaintext];\n" +
+				"\tn9 [label=\"D\", shape=plaintext];\n" +
+				"\tn0 -> n1;\n" +
+				"\tn1 -> n2;\n" +
+				"\tn1 -> n3;\n" +
+				"\tn3 -> n4;\n" +
+				"\tn0 -> n5;\n" +
+				"\tn5 -> n6;\n" +
+				"\tn5 -> n7;\n" +
+				test.retEdge +
+				"\tn7 -> n9;\n" +
+				"}\n"
+			if b.String() != expected {
+				t.Errorf("got\n%s\nexpected\n%s", b.String(), expected)
+			}
+		})
+	}
+}
+
+func TestWriteNetworkToGraphML(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,(B)#H1),(C,(#H1,D)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick; test is written wrong")
+	}
+	ntw, err := ConvertToNetwork(tre)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var b strings.Builder
+	if err := WriteNetworkToGraphML(ntw, map[string]float64{"#H1": 0.5}, &b); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var graph struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"data"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal([]byte(b.String()), &graph); err != nil {
+		t.Fatalf("invalid graphml: %s", err)
+	}
+	if len(graph.Nodes) != 9 || len(graph.Edges) != 9 {
+		t.Errorf("got %d nodes and %d edges, expected 9 and 9", len(graph.Nodes), len(graph.Edges))
+	}
+	retEdges := 0
+	for _, e := range graph.Edges {
+		data := make(map[string]string)
+		for _, d := range e.Data {
+			data[d.Key] = d.Value
+		}
+		if data["reticulation"] != "true" {
+			continue
+		}
+		retEdges++
+		if e.Source != "n7" || e.Target != "n3" || data["support"] != "0.5" || data["label"] != "#H1 (0.50)" {
+			t.Errorf("got reticulation edge %s -> %s with %v", e.Source, e.Target, data)
+		}
+	}
+	if retEdges != 1 {
+		t.Errorf("got %d reticulation edges, expected 1", retEdges)
+	}
+}
+
+func TestWriteNetworkToPhyloXML(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,(B)#H1),(C,(#H1,D)));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick; test is written wrong")
+	}
+	ntw, err := ConvertToNetwork(tre)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var b strings.Builder
+	if err := WriteNetworkToPhyloXML(ntw, map[string]float64{"#H1": 0.5}, &b); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var doc struct {
+		Phylogenies []struct {
+			Relations []struct {
+				IDRef0     string `xml:"id_ref_0,attr"`
+				IDRef1     string `xml:"id_ref_1,attr"`
+				Type       string `xml:"type,attr"`
+				Confidence string `xml:"confidence"`
+			} `xml:"clade_relation"`
+		} `xml:"phylogeny"`
+	}
+	if err := xml.Unmarshal([]byte(b.String()), &doc); err != nil {
+		t.Fatalf("invalid phyloxml: %s", err)
+	}
+	if len(doc.Phylogenies) != 1 || len(doc.Phylogenies[0].Relations) != 1 {
+		t.Fatalf("expected one phylogeny with one clade relation, got %+v", doc)
+	}
+	rel := doc.Phylogenies[0].Relations[0]
+	if rel.IDRef0 != "donor_H1" || rel.IDRef1 != "hybrid_H1" || rel.Type != "hybridization" || rel.Confidence != "0.5000" {
+		t.Errorf("got clade relation %+v", rel)
+	}
+	if ntw.Support != nil {
+		t.Errorf("support should not be left on the network, got %v", ntw.Support)
+	}
+}
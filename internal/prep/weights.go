@@ -0,0 +1,92 @@
+package prep
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Fixed point scale for gene tree weights. Each quartet of a gene tree with
+// weight w is counted round(w * WeightScale) times, so that quartet counts stay
+// integers (weights are kept to three decimal places).
+const WeightScale = 1000
+
+// Options for reading input files
+type InputOption func(*inputOpts) error
+
+type inputOpts struct {
+	weightsFile string
+	skipInvalid bool
+}
+
+// Reads a weight for each gene tree from weightsFile (one non-negative number
+// per line, in the same order as the gene trees). No weights are read if
+// weightsFile is empty.
+func WithWeights(weightsFile string) InputOption {
+	return func(opts *inputOpts) error {
+		opts.weightsFile = weightsFile
+		return nil
+	}
+}
+
+// Skips gene trees that can't be parsed instead of returning an error, listing
+// them in GeneTrees.Skipped. Their weights (see WithWeights) are dropped too.
+func SkipInvalidTrees() InputOption {
+	return func(opts *inputOpts) error {
+		opts.skipInvalid = true
+		return nil
+	}
+}
+
+// Reads gene tree weights file, which must have one weight per gene tree (not
+// checked if nGeneTrees is negative, i.e., not known yet)
+func readWeightsFile(weightsFile string, nGeneTrees int) ([]float64, error) {
+	weightBytes, err := os.ReadFile(weightsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading weights file: %w", err)
+	}
+	weights := make([]float64, 0, max(nGeneTrees, 0))
+	lineNum := 0
+	for line := range strings.Lines(string(weightBytes)) {
+		lineNum++
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		w, err := strconv.ParseFloat(line, 64)
+		if err != nil || w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return nil, fmt.Errorf("%w, line %d of weights file should be a non-negative number, but is \"%s\"", ErrInvalidFile, lineNum, line)
+		}
+		weights = append(weights, w)
+	}
+	if nGeneTrees >= 0 && len(weights) != nGeneTrees {
+		return nil, fmt.Errorf("%w, weights file has %d weights, but there are %d gene trees", ErrInvalidFile, len(weights), nGeneTrees)
+	}
+	if WeightedNumGeneTrees(len(weights), weights) == 0 {
+		return nil, fmt.Errorf("%w, every gene tree has a weight of (almost) zero", ErrInvalidFile)
+	}
+	return weights, nil
+}
+
+// Count added for each quartet in gene tree i (1 if weights is nil)
+func weightCount(weights []float64, i int) uint32 {
+	if weights == nil {
+		return 1
+	}
+	return uint32(math.Round(weights[i] * WeightScale))
+}
+
+// Number of gene trees in the same units as quartet counts, i.e., the sum of
+// the scaled weights (or nGeneTrees if weights is nil)
+func WeightedNumGeneTrees(nGeneTrees int, weights []float64) int {
+	if weights == nil {
+		return nGeneTrees
+	}
+	total := 0
+	for i := range weights {
+		total += int(weightCount(weights, i))
+	}
+	return total
+}
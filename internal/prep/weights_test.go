@@ -0,0 +1,92 @@
+package prep
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+func TestReadWeightsFile(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contents    string
+		expected    []float64
+		expectedErr error
+	}{
+		{name: "basic", contents: "1\n0.5\n\n2.25\n", expected: []float64{1, 0.5, 2.25}},
+		{name: "zero weight", contents: "0\n1\n1\n", expected: []float64{0, 1, 1}},
+		{name: "too few", contents: "1\n1\n", expectedErr: ErrInvalidFile},
+		{name: "too many", contents: "1\n1\n1\n1\n", expectedErr: ErrInvalidFile},
+		{name: "negative", contents: "1\n-1\n1\n", expectedErr: ErrInvalidFile},
+		{name: "not a number", contents: "1\nheavy\n1\n", expectedErr: ErrInvalidFile},
+		{name: "all zero", contents: "0\n0.0001\n0\n", expectedErr: ErrInvalidFile},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "weights.txt")
+			if err := os.WriteFile(path, []byte(test.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			weights, err := readWeightsFile(path, 3)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expectedErr)
+			}
+			if err == nil && !slices.Equal(weights, test.expected) {
+				t.Errorf("got %v, expected %v", weights, test.expected)
+			}
+		})
+	}
+}
+
+func TestProcessQuartets_Weighted(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B),(C,D));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatal(err)
+	}
+	nwks := []string{"((A,C),(B,D));", "((A,C),(B,D));", "((A,D),(B,C));"}
+	gtrees := make([]*tree.Tree, len(nwks))
+	for i, nwk := range nwks {
+		if gtrees[i], err = newick.NewParser(strings.NewReader(nwk)).Parse(); err != nil {
+			t.Fatalf("invalid newick tree %s; test is written wrong", nwk)
+		}
+	}
+	qCounts, err := processQuartets(gtrees, []float64{0.5, 1.25, 0}, tre, 0, runtime.GOMAXPROCS(0))
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	expected := map[string]uint32{"((A,C),(B,D));": 1750}
+	if qCounts.Len() != len(expected) {
+		t.Errorf("got %d quartets, expected %d (zero weight gene trees should be skipped)", qCounts.Len(), len(expected))
+	}
+	for nwk, count := range expected {
+		qTree, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := gr.NewQuartet(qTree, tre)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := qCounts.Get(q); got != count {
+			t.Errorf("quartet %s has count %d, expected %d", nwk, got, count)
+		}
+	}
+	if n := WeightedNumGeneTrees(3, []float64{0.5, 1.25, 0}); n != 1750 {
+		t.Errorf("got %d weighted gene trees, expected 1750", n)
+	}
+	if n := WeightedNumGeneTrees(3, nil); n != 3 {
+		t.Errorf("got %d unweighted gene trees, expected 3", n)
+	}
+}
@@ -0,0 +1,144 @@
+package score
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+// (quartet, edge) pair where QuartetScore disagrees with the reference
+// implementation
+type AuditMismatch struct {
+	Quartet  gr.Quartet
+	Branch   gr.Branch
+	Got      int // result of QuartetScore
+	Expected int // result of referenceQuartetScore
+}
+
+type AuditReport struct {
+	Checked    int // number of (quartet, edge) pairs checked
+	Mismatches []AuditMismatch
+}
+
+// Checks QuartetScore against a slow reference implementation for samples
+// random (quartet, edge) pairs. Edges are drawn from those the dp considers,
+// and quartets from the ones mapped to the LCA of the edge, since only those
+// pairs are ever scored.
+func AuditQuartetScores(td *gr.TreeData, samples int, rng *rand.Rand) AuditReport {
+	edges := make([]gr.Branch, 0)
+	n := len(td.Nodes())
+	for u := range n {
+		for w := range n {
+			if DefaultEdgePolicy.Allows(u, w, td) && len(td.Quartets(td.LCA(u, w))) != 0 {
+				edges = append(edges, gr.Branch{IDs: [2]int{u, w}})
+			}
+		}
+	}
+	report := AuditReport{Mismatches: make([]AuditMismatch, 0)}
+	if len(edges) == 0 {
+		return report
+	}
+	parents := parentIDs(td)
+	for range samples {
+		br := edges[rng.IntN(len(edges))]
+		u, w := br.IDs[gr.Ui], br.IDs[gr.Wi]
+		v := td.LCA(u, w)
+		quartets := td.Quartets(v)
+		q := quartets[rng.IntN(len(quartets))]
+		got := QuartetScore(q, td.IdToNodes[u], td.IdToNodes[w], td.IdToNodes[v], getWSubtree(u, w, v, td), td)
+		if expected := referenceQuartetScore(q, u, w, parents, td); got != expected {
+			report.Mismatches = append(report.Mismatches, AuditMismatch{Quartet: q, Branch: br, Got: got, Expected: expected})
+		}
+		report.Checked++
+	}
+	return report
+}
+
+// Scores quartet q for edge u -> w without any of the shortcuts QuartetScore
+// takes. The network with the edge displays the constraint tree and the tree
+// where w is pruned and regrafted onto the edge above u, so the edge adds q if
+// the regrafted tree has q's topology, and doesn't affect q (Qdiff) if both
+// trees induce the same topology on its taxa.
+func referenceQuartetScore(q gr.Quartet, u, w int, parents []int, td *gr.TreeData) int {
+	var leaves [4]int
+	for i, t := range q.Taxa() {
+		leaves[i] = td.TipToNodeID(t)
+	}
+	before := inducedPartner(parents, leaves)
+	after := inducedPartner(regraft(parents, u, w), leaves)
+	switch {
+	case before == after:
+		return gr.Qdiff
+	case after != -1 && q.Taxon(after) == neighborTaxaQ(q, 0):
+		return gr.Qeq
+	default:
+		return gr.Qneq
+	}
+}
+
+// Parent id of each node (-1 for the root)
+func parentIDs(td *gr.TreeData) []int {
+	parents := make([]int, len(td.Nodes()))
+	parents[td.Root().Id()] = -1
+	for v, children := range td.Children {
+		for _, c := range children {
+			if c != nil { // tips have nil children
+				parents[c.Id()] = v
+			}
+		}
+	}
+	return parents
+}
+
+// Copy of the tree (as parent ids) with w moved onto a new node subdividing
+// the edge above u
+func regraft(parents []int, u, w int) []int {
+	moved := append(make([]int, 0, len(parents)+1), parents...)
+	x := len(moved)
+	moved = append(moved, parents[u])
+	moved[u], moved[w] = x, x
+	return moved
+}
+
+// Index of the leaf paired with leaves[0] in the quartet topology induced by
+// the tree (-1 if unresolved), found with the four point condition
+func inducedPartner(parents []int, leaves [4]int) int {
+	dist := func(i, j int) int { return treeDistance(parents, leaves[i], leaves[j]) }
+	sums := [4]int{1: dist(0, 1) + dist(2, 3), 2: dist(0, 2) + dist(1, 3), 3: dist(0, 3) + dist(1, 2)}
+	best := 1
+	for i := 2; i < 4; i++ {
+		if sums[i] < sums[best] {
+			best = i
+		}
+	}
+	for i := 1; i < 4; i++ {
+		if i != best && sums[i] == sums[best] {
+			return -1
+		}
+	}
+	return best
+}
+
+// Number of edges between nodes a and b
+func treeDistance(parents []int, a, b int) int {
+	depthFromA := make(map[int]int)
+	for n, d := a, 0; n != -1; n, d = parents[n], d+1 {
+		depthFromA[n] = d
+	}
+	for n, d := b, 0; n != -1; n, d = parents[n], d+1 {
+		if da, ok := depthFromA[n]; ok {
+			return da + d
+		}
+	}
+	panic("nodes are not in the same tree")
+}
+
+var quartetResultNames = map[int]string{gr.Qeq: "added", gr.Qneq: "not added", gr.Qdiff: "unaffected"}
+
+// Describes the mismatch using the leafsets of the edge's nodes
+func (m AuditMismatch) Describe(td *gr.TreeData) string {
+	u, w := td.IdToNodes[m.Branch.IDs[gr.Ui]], td.IdToNodes[m.Branch.IDs[gr.Wi]]
+	return fmt.Sprintf("quartet %s on branch %s -> %s is %s, but the reference says %s",
+		td.QuartetString(m.Quartet), td.LeafsetAsString(u), td.LeafsetAsString(w), quartetResultNames[m.Got], quartetResultNames[m.Expected])
+}
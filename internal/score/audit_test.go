@@ -0,0 +1,93 @@
+package score
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+// every topology of every set of four taxa
+func allQuartetCounts(taxa []string) []quartetCount {
+	quartets := make([]quartetCount, 0)
+	for a := range taxa {
+		for b := a + 1; b < len(taxa); b++ {
+			for c := b + 1; c < len(taxa); c++ {
+				for d := c + 1; d < len(taxa); d++ {
+					for _, p := range [][4]int{{a, b, c, d}, {a, c, b, d}, {a, d, b, c}} {
+						nwk := fmt.Sprintf("((%s,%s),(%s,%s));", taxa[p[0]], taxa[p[1]], taxa[p[2]], taxa[p[3]])
+						quartets = append(quartets, quartetCount{nwk: nwk, count: 1})
+					}
+				}
+			}
+		}
+	}
+	return quartets
+}
+
+func TestReferenceQuartetScore(t *testing.T) {
+	testCases := []struct {
+		name string
+		tree string
+		taxa []string
+	}{
+		{name: "balanced", tree: "(((A,B),(C,D)),((E,F),(G,H)));", taxa: []string{"A", "B", "C", "D", "E", "F", "G", "H"}},
+		{name: "caterpillar", tree: "((((((A,B),C),D),E),F),G);", taxa: []string{"A", "B", "C", "D", "E", "F", "G"}},
+		{name: "mixed", tree: "((A,((B,C),D)),((E,F),(G,(H,I))));", taxa: []string{"A", "B", "C", "D", "E", "F", "G", "H", "I"}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			td := makeTreeDataWithQuartets(t, test.tree, allQuartetCounts(test.taxa))
+			parents := parentIDs(td)
+			n := len(td.Nodes())
+			found := make(map[int]bool)
+			for u := range n {
+				for w := range n {
+					if !DefaultEdgePolicy.Allows(u, w, td) {
+						continue
+					}
+					v := td.LCA(u, w)
+					wSub := getWSubtree(u, w, v, td)
+					for _, q := range td.Quartets(v) {
+						got := QuartetScore(q, td.IdToNodes[u], td.IdToNodes[w], td.IdToNodes[v], wSub, td)
+						expected := referenceQuartetScore(q, u, w, parents, td)
+						if got != expected {
+							t.Fatalf("quartet %s on edge %d -> %d: got %d, reference gives %d", td.QuartetString(q), u, w, got, expected)
+						}
+						found[got] = true
+					}
+				}
+			}
+			for _, result := range []int{gr.Qeq, gr.Qneq, gr.Qdiff} {
+				if !found[result] {
+					t.Errorf("no quartet scored %d; test is not covering all cases", result)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditQuartetScores(t *testing.T) {
+	testCases := []struct {
+		name     string
+		quartets []quartetCount
+		samples  int
+		checked  int
+	}{
+		{name: "basic", quartets: allQuartetCounts([]string{"A", "B", "C", "D", "E", "F", "G"}), samples: 200, checked: 200},
+		{name: "no quartets", samples: 200, checked: 0},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			td := makeTreeDataWithQuartets(t, "(((A,B),(C,D)),(E,(F,G)));", test.quartets)
+			report := AuditQuartetScores(td, test.samples, rand.New(rand.NewPCG(1, 2)))
+			if report.Checked != test.checked {
+				t.Errorf("checked %d pairs, expected %d", report.Checked, test.checked)
+			}
+			if len(report.Mismatches) != 0 {
+				t.Errorf("got mismatches %+v", report.Mismatches)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package score
+
+import (
+	"context"
+	"math"
+
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+// Percent of gene tree quartets around each internal branch of tre (a rooted
+// binary tree with continuous node ids) that agree with it, indexed by the id
+// of the node below the branch. Like ASTRAL's branch annotations, only
+// quartets with one taxon in each of the four subtrees around the branch
+// count (see BranchConcordance). Branches with no such quartets, and branches
+// to tips, get NaN. The two branches below the root are the same unrooted
+// branch, so they get the same value. Stops and returns ctx's error if ctx is
+// cancelled.
+func BranchSupport(ctx context.Context, tre *tree.Tree, gtrees []*tree.Tree, nprocs int) ([]float64, error) {
+	concordance, err := BranchConcordance(ctx, tre, gtrees, nprocs)
+	if err != nil {
+		return nil, err
+	}
+	support := make([]float64, len(tre.Nodes()))
+	for id := range support {
+		support[id] = math.NaN()
+	}
+	for id, c := range concordance {
+		if total := c.Concordant + c.Discordant[0] + c.Discordant[1]; total != 0 {
+			support[id] = 100 * float64(c.Concordant) / float64(total)
+		}
+	}
+	for _, e := range tre.Root().Edges() { // copy the value of the first child to the second
+		if n := e.Right(); !math.IsNaN(support[n.Id()]) {
+			for _, f := range tre.Root().Edges() {
+				support[f.Right().Id()] = support[n.Id()]
+			}
+			break
+		}
+	}
+	return support, nil
+}
@@ -0,0 +1,49 @@
+package score
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+func TestBranchSupport(t *testing.T) {
+	td := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", nil)
+	gtrees := make([]*tree.Tree, 0)
+	for _, nwk := range []string{
+		"((A,B),((C,D),(E,(F,G))));", // a: 6, b: 6, e and c: 8, f: 4 quartets, all agreeing
+		"((A,B),(C,E));",             // agrees with a
+		"((A,C),(B,E));",             // disagrees with a
+		"((A,C),(E,F));",             // agrees with e and c
+		"((A,E),(C,F));",             // disagrees with e and c
+	} {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick %s", nwk)
+		}
+		gtrees = append(gtrees, gt)
+	}
+	support, err := BranchSupport(context.Background(), &td.Tree, gtrees, 2)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := map[string]float64{"a": 87.5, "b": 100, "e": 90, "c": 90, "f": 100, "r": math.NaN(), "A": math.NaN(), "E": math.NaN()}
+	for label, exp := range expected {
+		if got := support[nodeIDByLabel(t, td, label)]; got != exp && !(math.IsNaN(got) && math.IsNaN(exp)) {
+			t.Errorf("branch above %s: got %f, expected %f", label, got, exp)
+		}
+	}
+	bad, err := newick.NewParser(strings.NewReader("((A,E),(B,X));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick; test is written wrong")
+	}
+	if _, err := BranchSupport(context.Background(), &td.Tree, []*tree.Tree{bad}, 1); !errors.Is(err, gr.ErrTipNameMismatch) {
+		t.Errorf("got error %v, expected %v", err, gr.ErrTipNameMismatch)
+	}
+}
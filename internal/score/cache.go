@@ -0,0 +1,223 @@
+package score
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+)
+
+// Bumped whenever the way a cached matrix (e.g., quartet totals or penalties)
+// is calculated changes, so stale cache files are not used
+const cacheVersion = 2
+
+// Sets directory used to cache edge score matrices between runs (no caching
+// if empty)
+func WithCache(dir string) ScoreOptions {
+	return func(options *scorerOpts) error {
+		options.cacheDir = dir
+		return nil
+	}
+}
+
+// Loads the matrix for key from the cache directory, or calculates it with
+// calc and saves it (keyFunc is only called if caching is on). Cache errors
+// are logged and otherwise ignored, since the matrix can always be
+// recalculated.
+func cachedMatrix(dir string, keyFunc func() string, n int, calc func() ([][]uint64, error)) ([][]uint64, error) {
+	if dir == "" {
+		return calc()
+	}
+	key := keyFunc()
+	path := filepath.Join(dir, key+".bin")
+	matrix, err := readMatrix(path, n)
+	switch {
+	case err == nil:
+		lg.Debugf("loaded %s from cache", key)
+		return matrix, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		lg.Warnf("could not read cached %s, recalculating: %s", key, err.Error())
+	}
+	if matrix, err = calc(); err != nil {
+		return nil, err
+	}
+	if err := writeMatrix(dir, path, matrix); err != nil {
+		lg.Warnf("could not cache %s: %s", key, err.Error())
+	}
+	return matrix, nil
+}
+
+// Sets quartet totals, using the cache if it is on
+func (qt *QuartetTotals) initQuartetTotals(td *gr.TreeData, options scorerOpts, nprocs int) error {
+	qt.asSet = options.asSet
+	key := func() string { return totalsCacheKey(td, options.asSet, options.policy) }
+	totals, err := cachedMatrix(options.cacheDir, key, len(td.Nodes()), func() ([][]uint64, error) {
+		var fresh QuartetTotals
+		if err := fresh.CalculateQuartetTotals(td, options.asSet, options.policy, nprocs); err != nil {
+			return nil, err
+		}
+		return fresh.quartetTotals, nil
+	})
+	qt.quartetTotals = totals
+	return err
+}
+
+// Calculates edge penalties, using the cache if it is on
+func edgePenalties(td *gr.TreeData, options scorerOpts, nprocs int) ([][]uint64, error) {
+	key := func() string { return penaltiesCacheKey(td, options.policy) }
+	return cachedMatrix(options.cacheDir, key, len(td.Nodes()), func() ([][]uint64, error) {
+		return CalculateEdgePenalties(td, options.policy, nprocs)
+	})
+}
+
+// Key for quartet totals; depends on the constraint tree, quartets, whether
+// quartets are counted as a set, and which edges are allowed
+func totalsCacheKey(td *gr.TreeData, asSet bool, policy *EdgePolicy) string {
+	h := treeHash(td)
+	for _, q := range td.Quartets(td.Root().Id()) {
+		fmt.Fprintf(h, "%s:%d;", td.QuartetString(q), td.NumQuartet(q))
+	}
+	fmt.Fprintf(h, "set:%t;policy:%s", asSet, policy)
+	return "totals-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Calculates the occupancy of every edge, using the cache if it is on
+func edgeOccupancies(td *gr.TreeData, options scorerOpts, nprocs int) ([][]uint64, error) {
+	key := func() string { return occupancyCacheKey(td, options.policy) }
+	return cachedMatrix(options.cacheDir, key, len(td.Nodes()), func() ([][]uint64, error) {
+		return CalculateEdgeOccupancy(td, options.policy, nprocs)
+	})
+}
+
+// Key for occupancy; depends on the constraint tree, the occupancy of each set
+// of four taxa, and which edges are allowed
+func occupancyCacheKey(td *gr.TreeData, policy *EdgePolicy) string {
+	h := treeHash(td)
+	for _, set := range td.OccupiedSets(td.Root().Id()) {
+		fmt.Fprintf(h, "%s:%d;", td.QuartetString(set), td.Occupancy(set))
+	}
+	fmt.Fprintf(h, "policy:%s", policy)
+	return "occupancy-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Calculates the log likelihood ratio of every edge (see CFScorer), using the
+// cache if it is on; ratios are cached as their bits
+func edgeLikelihoods(td *gr.TreeData, options scorerOpts, nprocs int) ([][]float64, error) {
+	key := func() string { return likelihoodsCacheKey(td, options.counts, options.policy) }
+	bits, err := cachedMatrix(options.cacheDir, key, len(td.Nodes()), func() ([][]uint64, error) {
+		likelihoods := CalculateEdgeLikelihoods(td, options.policy, options.counts, nprocs)
+		bits := make([][]uint64, len(likelihoods))
+		for u, row := range likelihoods {
+			bits[u] = make([]uint64, len(row))
+			for w, ratio := range row {
+				bits[u][w] = math.Float64bits(ratio)
+			}
+		}
+		return bits, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	likelihoods := make([][]float64, len(bits))
+	for u, row := range bits {
+		likelihoods[u] = make([]float64, len(row))
+		for w, b := range row {
+			likelihoods[u][w] = math.Float64frombits(b)
+		}
+	}
+	return likelihoods, nil
+}
+
+// Key for likelihood ratios; depends on the constraint tree, quartets
+// (including those the constraint tree displays, whose counts are compared),
+// their count scale, and which edges are allowed
+func likelihoodsCacheKey(td *gr.TreeData, scale int, policy *EdgePolicy) string {
+	h := treeHash(td)
+	for _, q := range td.Quartets(td.Root().Id()) {
+		fmt.Fprintf(h, "%s:%d;", td.QuartetString(q), td.NumQuartet(q))
+	}
+	fmt.Fprintf(h, "min-ratio:%g;scale:%d;policy:%s", minLikelihoodRatio, scale, policy)
+	return "likelihoods-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Key for penalties; they only depend on the constraint tree and which edges
+// are allowed
+func penaltiesCacheKey(td *gr.TreeData, policy *EdgePolicy) string {
+	h := treeHash(td)
+	fmt.Fprintf(h, "policy:%s", policy)
+	return "penalties-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Hash of the taxa below every node in id order, so cached matrices are only
+// used with the same node ids
+func treeHash(td *gr.TreeData) hash.Hash {
+	h := sha256.New()
+	fmt.Fprintf(h, "camus-cache-v%d;", cacheVersion)
+	for _, n := range td.IdToNodes {
+		fmt.Fprintf(h, "%q;", td.LeafsetNames(n))
+	}
+	return h
+}
+
+func readMatrix(path string, n int) ([][]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var size uint64
+	if err := binary.Read(f, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size != uint64(n) {
+		return nil, fmt.Errorf("cached matrix has size %d, expected %d", size, n)
+	}
+	matrix := make([][]uint64, n)
+	for i := range matrix {
+		matrix[i] = make([]uint64, n)
+		if err := binary.Read(f, binary.LittleEndian, matrix[i]); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := f.Read(make([]byte, 1)); err != io.EOF {
+		return nil, fmt.Errorf("cached matrix has trailing data")
+	}
+	return matrix, nil
+}
+
+// Writes matrix to a temporary file that is renamed into place, so concurrent
+// runs never see a partial file
+func writeMatrix(dir, path string, matrix [][]uint64) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = binary.Write(f, binary.LittleEndian, uint64(len(matrix)))
+	for _, row := range matrix {
+		if err != nil {
+			break
+		}
+		err = binary.Write(f, binary.LittleEndian, row)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,71 @@
+package score
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScorerCache(t *testing.T) {
+	dir := t.TempDir()
+	quartets := []quartetCount{
+		{nwk: "((A,E),(B,F));", count: 7},
+		{nwk: "((A,F),(B,E));", count: 4},
+	}
+	td := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", quartets)
+	fresh := &SymDiffScorer{}
+	if err := fresh.Init(td, 2, WithAlpha(0.5)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := &SymDiffScorer{}
+	if err := first.Init(td, 2, WithAlpha(0.5), WithCache(dir)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.bin"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected totals and penalties in cache, got %v", files)
+	}
+	// a different scorer reuses the cached totals
+	cached := &MaximizeScorer{}
+	if err := cached.Init(td, 2, WithCache(dir)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(first.quartetTotals, fresh.quartetTotals) || !reflect.DeepEqual(first.penalties, fresh.penalties) {
+		t.Errorf("cached scorer does not match uncached scorer")
+	}
+	if !reflect.DeepEqual(cached.quartetTotals, fresh.quartetTotals) {
+		t.Errorf("totals loaded from cache do not match calculated totals")
+	}
+	// different quartets do not hit the cache
+	other := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", quartets[:1])
+	if totalsCacheKey(other, true, nil) == totalsCacheKey(td, true, nil) {
+		t.Errorf("expected different cache keys for different quartets")
+	}
+	if penaltiesCacheKey(other, nil) != penaltiesCacheKey(td, nil) {
+		t.Errorf("expected same penalty cache key for the same tree")
+	}
+	// nor does the same tree shape with taxa in different places
+	swapped := makeTreeDataWithQuartets(t, "(((C,B)a,(A,D)b)e,(E,(F,G)f)c)r;", quartets)
+	if penaltiesCacheKey(swapped, nil) == penaltiesCacheKey(td, nil) {
+		t.Errorf("expected different penalty cache keys for different taxa below the same nodes")
+	}
+	// nor does a different edge policy
+	policy := DefaultEdgePolicy.With(ExcludeRootChildren)
+	if totalsCacheKey(td, true, policy) == totalsCacheKey(td, true, nil) || penaltiesCacheKey(td, policy) == penaltiesCacheKey(td, nil) {
+		t.Errorf("expected different cache keys for different edge policies")
+	}
+	// corrupt files are recalculated
+	for _, f := range files {
+		if err := os.WriteFile(f, []byte("garbage"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recalc := &SymDiffScorer{}
+	if err := recalc.Init(td, 2, WithAlpha(0.5), WithCache(dir)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(recalc.quartetTotals, fresh.quartetTotals) || !reflect.DeepEqual(recalc.penalties, fresh.penalties) {
+		t.Errorf("scorer with corrupt cache does not match uncached scorer")
+	}
+}
@@ -0,0 +1,193 @@
+package score
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	"github.com/jsdoublel/camus/internal/pool"
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+// Quartet concordance statistics for each internal branch of tre (a rooted
+// binary tree with continuous node ids), keyed by the id of the node below
+// the branch, akin to Quartet Sampling. Only gene tree quartets with one
+// taxon in each of the four subtrees around a branch count. The two branches
+// below the root are the same unrooted branch, so it's keyed by the first
+// child of the root, and it's left out if the other child is a tip (it's not
+// a bipartition). Stops and returns ctx's error if ctx is cancelled.
+func BranchConcordance(ctx context.Context, tre *tree.Tree, gtrees []*tree.Tree, nprocs int) (map[int]pr.Concordance, error) {
+	td := gr.MakeTreeData(tre, nil)
+	counts := make([][3]uint64, len(td.IdToNodes))
+	informative := make([]int, len(td.IdToNodes))
+	var mu sync.Mutex
+	errs := make([]error, len(gtrees))
+	pool.Run(len(gtrees), nprocs, func(g int) {
+		if errs[g] = ctx.Err(); errs[g] != nil {
+			return
+		}
+		if err := gtrees[g].UpdateTipIndex(); err != nil {
+			errs[g] = fmt.Errorf("gene tree %w", pr.ErrMulTree)
+			return
+		}
+		quartets, err := gr.QuartetsFromTree(gtrees[g], tre)
+		if err != nil {
+			errs[g] = err
+			return
+		}
+		gCounts := make(map[int][3]uint64)
+		for q := range quartets.All() {
+			if id, topo := quartetBranch(td, q); id != -1 {
+				c := gCounts[id]
+				c[topo]++
+				gCounts[id] = c
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for id, c := range gCounts {
+			for i := range c {
+				counts[id][i] += c[i]
+			}
+			informative[id]++
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	root := td.Root()
+	first := td.Children[root.Id()][0] // the branches below the root are keyed by it
+	concordance := make(map[int]pr.Concordance)
+	for _, n := range td.IdToNodes {
+		if n.Tip() || n == root {
+			continue
+		}
+		if p, _ := n.Parent(); p == root && (n != first || td.Sibling(n).Tip()) {
+			continue
+		}
+		c := counts[n.Id()]
+		concordance[n.Id()] = pr.Concordance{
+			Concordant:  c[0],
+			Discordant:  [2]uint64{c[1], c[2]},
+			Informative: informative[n.Id()],
+			QC:          quartetConcordance(c),
+			QD:          quartetDifferential(c[1], c[2]),
+			QI:          float64(informative[n.Id()]) / float64(len(gtrees)),
+		}
+	}
+	return concordance, nil
+}
+
+// Branch of td whose four surrounding subtrees each have one taxon of q, given
+// by the id of the node below it (-1 if there is none), and the topology of
+// q around it: 0 if it agrees with the branch, otherwise 1 or 2 for the
+// discordant topology pairing the first child of the node with the sibling
+// of the node or with the rest of the tree (the sibling's children when the
+// branch is below the root).
+func quartetBranch(td *gr.TreeData, q gr.Quartet) (int, int) {
+	var nodes [4]int
+	for i, t := range q.Taxa() {
+		nodes[i] = td.TipToNodeID(t)
+	}
+	// the pair with the deepest lca is a cherry, so it's paired in the
+	// unrooted quartet, and the internal path of the quartet runs from the lca
+	// to where the other two taxa's paths meet it
+	i, j := 0, 1
+	for a := range 4 {
+		for b := a + 1; b < 4; b++ {
+			if td.Depths[td.LCA(nodes[a], nodes[b])] > td.Depths[td.LCA(nodes[i], nodes[j])] {
+				i, j = a, b
+			}
+		}
+	}
+	var others []int
+	for a := range 4 {
+		if a != i && a != j {
+			others = append(others, nodes[a])
+		}
+	}
+	top := td.LCA(nodes[i], nodes[j])
+	bottom := td.LCA(others[0], others[1])
+	for _, m := range []int{td.LCA(nodes[i], others[0]), td.LCA(nodes[i], others[1])} {
+		if td.Depths[m] > td.Depths[bottom] {
+			bottom = m
+		}
+	}
+	root := td.Root().Id()
+	var n *tree.Node
+	var groups []*tree.Node
+	switch lca := td.LCA(top, bottom); {
+	case lca == root && td.Depths[top] == 1 && td.Depths[bottom] == 1: // path is the two edges below the root
+		n = td.Children[root][0]
+		s := td.Children[root][1]
+		groups = []*tree.Node{td.Children[n.Id()][0], td.Children[n.Id()][1], td.Children[s.Id()][0]}
+	case lca == top && td.Depths[bottom] == td.Depths[top]+1:
+		n = td.IdToNodes[bottom]
+	case lca == bottom && td.Depths[top] == td.Depths[bottom]+1:
+		n = td.IdToNodes[top]
+	default:
+		return -1, 0
+	}
+	if groups == nil {
+		groups = []*tree.Node{td.Children[n.Id()][0], td.Children[n.Id()][1], td.Sibling(n)}
+	}
+	group := func(t uint16) int {
+		id := td.TipToNodeID(t)
+		for g, node := range groups {
+			if node.Id() == id || td.Under(node.Id(), id) {
+				return g
+			}
+		}
+		return len(groups)
+	}
+	g0, gn := group(q.Taxon(0)), group(neighborTaxaQ(q, 0))
+	partner := 6 - g0 - gn // group paired with the first child when neither is in it
+	switch {
+	case g0 == 0:
+		partner = gn
+	case gn == 0:
+		partner = g0
+	}
+	return n.Id(), partner - 1
+}
+
+// Quartet concordance: 1 minus the entropy (base 3) of the frequencies of the
+// three topologies, negated if a discordant topology is more frequent than
+// the concordant one, and 0 if they tie (NaN if there are no quartets)
+func quartetConcordance(c [3]uint64) float64 {
+	total := c[0] + c[1] + c[2]
+	if total == 0 {
+		return math.NaN()
+	}
+	disc := max(c[1], c[2])
+	if c[0] == disc {
+		return 0
+	}
+	qc := 1.0
+	for _, n := range c {
+		if n != 0 {
+			p := float64(n) / float64(total)
+			qc += p * math.Log(p) / math.Log(3)
+		}
+	}
+	if c[0] < disc {
+		return -qc
+	}
+	return qc
+}
+
+// Quartet differential: 1 if the two discordant topologies are equally
+// frequent, 0 if all discordant quartets have the same topology (NaN if there
+// are none)
+func quartetDifferential(d1, d2 uint64) float64 {
+	if d1+d2 == 0 {
+		return math.NaN()
+	}
+	diff := float64(max(d1, d2) - min(d1, d2))
+	return 1 - diff/float64(d1+d2)
+}
@@ -0,0 +1,95 @@
+package score
+
+import (
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+func TestBranchConcordance(t *testing.T) {
+	td := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", nil)
+	gtrees := make([]*tree.Tree, 0)
+	for _, nwk := range []string{
+		"((A,B),((C,D),(E,(F,G))));",
+		"((A,B),(C,E));", // concordant with a
+		"((A,C),(B,E));", // pairs a's first child with its sibling
+		"((A,C),(E,F));", // concordant with e
+		"((A,E),(C,F));", // pairs e's first child with E
+	} {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick %s", nwk)
+		}
+		gtrees = append(gtrees, gt)
+	}
+	concordance, err := BranchConcordance(context.Background(), &td.Tree, gtrees, 2)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := map[string]pr.Concordance{
+		"a": {Concordant: 7, Discordant: [2]uint64{1, 0}, Informative: 3},
+		"b": {Concordant: 6, Informative: 1},
+		"e": {Concordant: 9, Discordant: [2]uint64{1, 0}, Informative: 3},
+		"f": {Concordant: 4, Informative: 1},
+	}
+	ids := make([]int, 0)
+	for label, exp := range expected {
+		id := nodeIDByLabel(t, td, label)
+		ids = append(ids, id)
+		got := concordance[id]
+		if got.Concordant != exp.Concordant || got.Discordant != exp.Discordant || got.Informative != exp.Informative {
+			t.Errorf("branch above %s: got %+v, expected %+v", label, got, exp)
+		}
+		if qi := float64(exp.Informative) / float64(len(gtrees)); got.QI != qi {
+			t.Errorf("branch above %s: got QI %f, expected %f", label, got.QI, qi)
+		}
+	}
+	if keys := slices.Sorted(maps.Keys(concordance)); !slices.Equal(keys, slices.Sorted(slices.Values(ids))) {
+		t.Errorf("got branches %v, expected %v (the root branch only once)", keys, slices.Sorted(slices.Values(ids)))
+	}
+}
+
+func TestQuartetConcordance(t *testing.T) {
+	testCases := []struct {
+		counts   [3]uint64
+		expected float64
+	}{
+		{counts: [3]uint64{10, 0, 0}, expected: 1},
+		{counts: [3]uint64{0, 10, 0}, expected: -1},
+		{counts: [3]uint64{5, 5, 0}, expected: 0},
+		{counts: [3]uint64{1, 1, 1}, expected: 0},
+		{counts: [3]uint64{2, 1, 1}, expected: 1 - 1.5*math.Log(2)/math.Log(3)},
+		{counts: [3]uint64{1, 2, 1}, expected: -(1 - 1.5*math.Log(2)/math.Log(3))},
+		{counts: [3]uint64{0, 0, 0}, expected: math.NaN()},
+	}
+	for _, test := range testCases {
+		if got := quartetConcordance(test.counts); math.Abs(got-test.expected) > 1e-12 && !(math.IsNaN(got) && math.IsNaN(test.expected)) {
+			t.Errorf("%v: got %f, expected %f", test.counts, got, test.expected)
+		}
+	}
+}
+
+func TestQuartetDifferential(t *testing.T) {
+	testCases := []struct {
+		d1, d2   uint64
+		expected float64
+	}{
+		{d1: 1, d2: 1, expected: 1},
+		{d1: 2, d2: 0, expected: 0},
+		{d1: 1, d2: 3, expected: 0.5},
+		{d1: 0, d2: 0, expected: math.NaN()},
+	}
+	for _, test := range testCases {
+		if got := quartetDifferential(test.d1, test.d2); got != test.expected && !(math.IsNaN(got) && math.IsNaN(test.expected)) {
+			t.Errorf("%d, %d: got %f, expected %f", test.d1, test.d2, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package score
+
+import (
+	"math"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	"github.com/jsdoublel/camus/internal/pool"
+)
+
+// Scores each edge by how far the quartet frequencies it explains are from
+// what incomplete lineage sorting alone would give. Under the multispecies
+// coalescent on the constraint tree, the two topologies of a set of four taxa
+// that the tree does not display are equally frequent (their concordance
+// factors are equal), so a reticulation shows up as one of them being more
+// frequent than the other. For every quartet topology an edge adds, the score
+// is the log likelihood ratio of its count and the count of the other minor
+// topology under a model where they are free against one where they are equal
+// (a pseudolikelihood over sets of four taxa, like SNaQ's, with the major
+// topology cancelling out). Only this null of equal minor frequencies is
+// tested; the frequencies the coalescent expects from the branch lengths of
+// the constraint tree are not. A topology only counts if the ratio is at least
+// minLikelihoodRatio (i.e., the test rejects equal frequencies), so edges that
+// only add topologies consistent with incomplete lineage sorting score zero and
+// are not added. The minor topologies have to be counted, so the scores are
+// only meaningful without quartet filtering (-q 0).
+type CFScorer struct {
+	asSet       bool
+	likelihoods [][]float64
+}
+
+// Smallest log likelihood ratio of a topology counted by CFScorer: half the 95th
+// percentile of the chi-squared distribution with one degree of freedom, so
+// that the likelihood ratio test rejects equal minor frequencies at the 5%
+// level
+const minLikelihoodRatio = 3.841458820694124 / 2
+
+func (s *CFScorer) Init(td *gr.TreeData, nprocs int, opts ...ScoreOptions) error {
+	var options scorerOpts
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return err
+		}
+	}
+	s.asSet = options.asSet
+	if options.counts == 0 {
+		options.counts = 1
+	}
+	var err error
+	s.likelihoods, err = edgeLikelihoods(td, options, nprocs)
+	return err
+}
+
+func (s CFScorer) CalcScore(u, w int, td *gr.TreeData) float64 {
+	return s.likelihoods[u][w]
+}
+
+// Percent of quartets satisfied by branches, counted only for those branches
+// (the scores do not need the quartet totals of every edge)
+func (s CFScorer) PercentQuartetSat(branches []gr.Branch, td *gr.TreeData) (float64, error) {
+	if s.likelihoods == nil {
+		return 0, ErrQuartetsNotInit
+	}
+	sum, err := TotalSatQuartets(branches, td, s.asSet)
+	if err != nil {
+		return 0, err
+	}
+	return PercentOfQuartets(sum, td, s.asSet), nil
+}
+
+// Calculate the log likelihood ratio (see CFScorer) for all edges policy
+// allows, with quartet counts divided by scale (see WithCountScale) so the
+// ratio is in gene trees
+func CalculateEdgeLikelihoods(td *gr.TreeData, policy *EdgePolicy, scale int, nprocs int) [][]float64 {
+	lg.Debugf("calculating edge likelihood ratios")
+	n := len(td.Nodes())
+	likelihoods := make([][]float64, n)
+	pool.Run(n, nprocs, func(u int) {
+		likelihoods[u] = make([]float64, n)
+		for w := range n {
+			if policy.Allows(u, w, td) {
+				likelihoods[u][w] = edgeLikelihood(u, w, td, float64(scale))
+			}
+		}
+	})
+	return likelihoods
+}
+
+// Sum of the log likelihood ratios of the quartet topologies the edge from u
+// to w adds, leaving out those less than minLikelihoodRatio; counts are
+// divided by scale
+func edgeLikelihood(u, w int, td *gr.TreeData, scale float64) float64 {
+	v := td.LCA(u, w)
+	uNode, wNode, vNode := td.IdToNodes[u], td.IdToNodes[w], td.IdToNodes[v]
+	wSub := getWSubtree(u, w, v, td)
+	var total float64
+	for _, q := range td.Quartets(v) {
+		if QuartetScore(q, uNode, wNode, vNode, wSub, td) != gr.Qeq || td.Displays(q) {
+			continue
+		}
+		for _, other := range q.AllQuartets() {
+			if other == q || td.Displays(other) {
+				continue
+			}
+			if ratio := minorLikelihoodRatio(float64(td.NumQuartet(q))/scale, float64(td.NumQuartet(other))/scale); ratio >= minLikelihoodRatio {
+				total += ratio
+			}
+		}
+	}
+	return total
+}
+
+// Log likelihood ratio of minor topology counts nR and nX being drawn with
+// different frequencies rather than the same one, or zero if nR is not the
+// larger count (so only edges toward the more frequent topology score)
+func minorLikelihoodRatio(nR, nX float64) float64 {
+	if nR <= nX {
+		return 0
+	}
+	m := (nR + nX) / 2
+	ratio := nR * math.Log(nR/m)
+	if nX > 0 {
+		ratio += nX * math.Log(nX/m)
+	}
+	return ratio
+}
@@ -0,0 +1,110 @@
+package score
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+func TestMinorLikelihoodRatio(t *testing.T) {
+	testCases := []struct {
+		name     string
+		nR, nX   float64
+		expected float64
+	}{
+		{name: "equal", nR: 5, nX: 5, expected: 0},
+		{name: "rarer", nR: 2, nX: 6, expected: 0},
+		{name: "more_frequent", nR: 6, nX: 2, expected: 6*math.Log(1.5) + 2*math.Log(0.5)},
+		{name: "other_missing", nR: 4, nX: 0, expected: 4 * math.Log(2)},
+		{name: "both_missing", nR: 0, nX: 0, expected: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := minorLikelihoodRatio(tc.nR, tc.nX); math.Abs(got-tc.expected) > 1e-12 {
+				t.Errorf("minorLikelihoodRatio(%g, %g) = %g, want %g", tc.nR, tc.nX, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCFScorer(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((((A,B)a,C)b,D)c,E)r;")).Parse()
+	if err != nil {
+		t.Fatalf("invalid newick in test: %v", err)
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatalf("failed to update tip index: %v", err)
+	}
+	quartet := func(nwk string) gr.Quartet {
+		qTree, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid quartet newick in test: %v", err)
+		}
+		q, err := gr.NewQuartet(qTree, tre)
+		if err != nil {
+			t.Fatalf("failed to map quartet: %v", err)
+		}
+		return q
+	}
+	testCases := []struct {
+		name     string
+		counts   map[string]uint32 // counts of the quartet topologies on A, B, C, and D
+		expected float64           // score of the edge from C to A
+	}{
+		{
+			name:     "asymmetric",
+			counts:   map[string]uint32{"((A,B),(C,D));": 20, "((A,C),(B,D));": 12, "((A,D),(B,C));": 4},
+			expected: 12*math.Log(1.5) + 4*math.Log(0.5),
+		},
+		{
+			name:     "not_significant",
+			counts:   map[string]uint32{"((A,B),(C,D));": 10, "((A,C),(B,D));": 6, "((A,D),(B,C));": 2},
+			expected: 0,
+		},
+		{
+			name:     "ils_only",
+			counts:   map[string]uint32{"((A,B),(C,D));": 10, "((A,C),(B,D));": 4, "((A,D),(B,C));": 4},
+			expected: 0,
+		},
+		{
+			name:     "other_minor_more_frequent",
+			counts:   map[string]uint32{"((A,B),(C,D));": 10, "((A,C),(B,D));": 2, "((A,D),(B,C));": 6},
+			expected: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			qCounts := gr.NewQuartetTable(0)
+			for nwk, count := range tc.counts {
+				qCounts.Set(quartet(nwk), count)
+			}
+			td := gr.MakeTreeData(tre.Clone(), qCounts)
+			var scorer, cached CFScorer
+			if err := scorer.Init(td, 1); err != nil {
+				t.Fatalf("init failed: %v", err)
+			}
+			// ratios written to the cache and read back are the same
+			dir := t.TempDir()
+			for range 2 {
+				if err := cached.Init(td, 1, WithCache(dir)); err != nil {
+					t.Fatalf("init with cache failed: %v", err)
+				}
+				if !reflect.DeepEqual(cached.likelihoods, scorer.likelihoods) {
+					t.Errorf("cached likelihood ratios do not match calculated ratios")
+				}
+			}
+			u, w := nodeIDByLabel(t, td, "C"), nodeIDByLabel(t, td, "A")
+			if got := scorer.CalcScore(u, w, td); math.Abs(got-tc.expected) > 1e-12 {
+				t.Errorf("score = %g, want %g", got, tc.expected)
+			}
+			if _, err := scorer.PercentQuartetSat([]gr.Branch{{IDs: [2]int{u, w}}}, td); err != nil {
+				t.Errorf("percent quartets satisfied failed: %v", err)
+			}
+		})
+	}
+}
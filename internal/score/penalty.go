@@ -1,31 +1,26 @@
 package score
 
 import (
-	"log"
-
-	"golang.org/x/sync/errgroup"
+	"math"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	"github.com/jsdoublel/camus/internal/pool"
 )
 
-func CalculateEdgePenalties(td *gr.TreeData, nprocs int) ([][]uint64, error) {
-	log.Println("calculating penalties")
+func CalculateEdgePenalties(td *gr.TreeData, policy *EdgePolicy, nprocs int) ([][]uint64, error) {
+	lg.Debugf("calculating penalties")
 	n := len(td.Nodes())
 	edgePenalties := make([][]uint64, n)
-	var g errgroup.Group
-	g.SetLimit(nprocs)
-	for u := range n {
-		g.Go(func() error {
-			edgePenalties[u] = make([]uint64, n)
-			for w := range n {
-				if ShouldCalcEdge(u, w, td) {
-					edgePenalties[u][w] = calculatePenalty(u, w, td)
-				}
+	pool.Run(n, nprocs, func(u int) {
+		edgePenalties[u] = make([]uint64, n)
+		for w := range n {
+			if policy.Allows(u, w, td) {
+				edgePenalties[u][w] = calculatePenalty(u, w, td)
 			}
-			return nil
-		})
-	}
-	return edgePenalties, g.Wait()
+		}
+	})
+	return edgePenalties, nil
 }
 
 // Calculates the number of quartets that *could* be added by the addition of
@@ -84,3 +79,75 @@ func collectNodesUpPath(start, end int, td *gr.TreeData) (subsets []uint64) {
 	}
 	return
 }
+
+// Calculates the occupancy of every edge policy allows (see edgeOccupancy)
+func CalculateEdgeOccupancy(td *gr.TreeData, policy *EdgePolicy, nprocs int) ([][]uint64, error) {
+	lg.Debugf("calculating gene tree occupancy")
+	n := len(td.Nodes())
+	occupancy := make([][]uint64, n)
+	pool.Run(n, nprocs, func(u int) {
+		occupancy[u] = make([]uint64, n)
+		for w := range n {
+			if policy.Allows(u, w, td) {
+				occupancy[u][w] = edgeOccupancy(u, w, td)
+			}
+		}
+	})
+	return occupancy, nil
+}
+
+// Number of gene trees that could support each quartet the edge from u to w
+// could add, summed over those quartets' sets of four taxa (see
+// td.Occupancy), i.e., the quartet total of the edge if every gene tree
+// supported it.
+func edgeOccupancy(u, w int, td *gr.TreeData) uint64 {
+	v := td.LCA(u, w)
+	uNode, wNode, vNode := td.IdToNodes[u], td.IdToNodes[w], td.IdToNodes[v]
+	wSub := getWSubtree(u, w, v, td)
+	var total uint64
+	for _, set := range td.OccupiedSets(v) {
+		if QuartetScore(set, uNode, wNode, vNode, wSub, td) != gr.Qdiff {
+			total += uint64(td.Occupancy(set))
+		}
+	}
+	return total
+}
+
+// Scales the alpha penalty of the "sym" score mode by the length of the cycle
+// an edge forms (see CycleLength), so that long cycles, which displace more
+// quartets, can be penalized more
+type PenaltyScale interface {
+	Scale(cycleLen int) float64
+}
+
+// Length of the shortest cycle added by default (see DefaultEdgePolicy); the
+// scaled penalty of a cycle this long is the unscaled penalty
+const shortestCycle = 4
+
+var ParsePenaltyScale = map[string]PenaltyScale{
+	"flat":   FlatPenalty{},
+	"linear": LinearPenalty{},
+	"log":    LogPenalty{},
+}
+
+// Penalty that does not depend on the cycle length (the default)
+type FlatPenalty struct{}
+
+func (FlatPenalty) Scale(cycleLen int) float64 {
+	return 1
+}
+
+// Penalty proportional to the cycle length
+type LinearPenalty struct{}
+
+func (LinearPenalty) Scale(cycleLen int) float64 {
+	return float64(cycleLen) / shortestCycle
+}
+
+// Penalty that grows with the log of the cycle length, between flat and
+// linear
+type LogPenalty struct{}
+
+func (LogPenalty) Scale(cycleLen int) float64 {
+	return 1 + math.Log(float64(cycleLen)/shortestCycle)
+}
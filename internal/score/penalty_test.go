@@ -1,6 +1,7 @@
 package score
 
 import (
+	"math"
 	"strings"
 	"testing"
 
@@ -114,3 +115,125 @@ func TestCalculatePenalty(t *testing.T) {
 		})
 	}
 }
+
+func TestEdgeOccupancy(t *testing.T) {
+	tips := []string{"A", "B", "C", "D", "E", "F", "G"}
+	quartets := make([]quartetCount, 0)
+	for i := range tips {
+		for j := i + 1; j < len(tips); j++ {
+			for k := j + 1; k < len(tips); k++ {
+				for l := k + 1; l < len(tips); l++ {
+					a, b, c, d := tips[i], tips[j], tips[k], tips[l]
+					for _, nwk := range []string{
+						"((" + a + "," + b + "),(" + c + "," + d + "));",
+						"((" + a + "," + c + "),(" + b + "," + d + "));",
+						"((" + a + "," + d + "),(" + b + "," + c + "));",
+					} {
+						quartets = append(quartets, quartetCount{nwk: nwk, count: 1})
+					}
+				}
+			}
+		}
+	}
+	td := makeTreeDataWithQuartets(t, "(((A,B),C),(D,(E,(F,G))));", quartets)
+	occupancy := gr.NewQuartetTable(0)
+	for _, q := range td.Quartets(td.Root().Id()) {
+		occupancy.Set(q.TaxaSet(), 3)
+	}
+	td.SetOccupancy(occupancy)
+	// each of the three gene trees has a topology of every set of four taxa, so
+	// the occupancy of an edge is three times the number of sets it could add a
+	// topology of (i.e., a normalized score of one is possible)
+	for u := range len(td.Nodes()) {
+		for w := range len(td.Nodes()) {
+			if !DefaultEdgePolicy.Allows(u, w, td) {
+				continue
+			}
+			if got, want := edgeOccupancy(u, w, td), 3*quartetsTotal(u, w, td, true); got != want {
+				t.Errorf("edge (%d, %d): got occupancy %d, expected %d", u, w, got, want)
+			}
+		}
+	}
+}
+
+func TestPenaltyScale(t *testing.T) {
+	testCases := []struct {
+		name     string
+		scale    PenaltyScale
+		cycleLen int
+		expected float64
+	}{
+		{name: "flat shortest", scale: FlatPenalty{}, cycleLen: 4, expected: 1},
+		{name: "flat long", scale: FlatPenalty{}, cycleLen: 8, expected: 1},
+		{name: "linear shortest", scale: LinearPenalty{}, cycleLen: 4, expected: 1},
+		{name: "linear long", scale: LinearPenalty{}, cycleLen: 8, expected: 2},
+		{name: "log shortest", scale: LogPenalty{}, cycleLen: 4, expected: 1},
+		{name: "log long", scale: LogPenalty{}, cycleLen: 8, expected: 1 + math.Ln2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.scale.Scale(tc.cycleLen); math.Abs(got-tc.expected) > 1e-12 {
+				t.Fatalf("Scale(%d) = %f, want %f", tc.cycleLen, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSymDiffPenaltyScale(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("(((((A,B)a,C)b,D)c,F)d,E)r;")).Parse()
+	if err != nil {
+		t.Fatalf("invalid newick in test: %v", err)
+	}
+	if err := tre.UpdateTipIndex(); err != nil {
+		t.Fatalf("failed to update tip index: %v", err)
+	}
+	qCounts := gr.NewQuartetTable(0)
+	for _, nwk := range []string{"((A,F),(B,C));", "((A,F),(C,D));", "((B,F),(C,D));"} {
+		qTree, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid quartet newick in test: %v", err)
+		}
+		q, err := gr.NewQuartet(qTree, tre)
+		if err != nil {
+			t.Fatalf("failed to map quartet: %v", err)
+		}
+		qCounts.Set(q, 3)
+	}
+	td := gr.MakeTreeData(tre, qCounts)
+	u, w := nodeIDByLabel(t, td, "d"), nodeIDByLabel(t, td, "a")
+	if l := CycleLength(u, w, td); l != 5 {
+		t.Fatalf("cycle length = %d, want 5", l)
+	}
+	const nGTrees, alpha = 4, 0.5
+	satisfied := float64(quartetsTotal(u, w, td, true))
+	penalties, err := CalculateEdgePenalties(td, nil, 1)
+	if err != nil {
+		t.Fatalf("failed to calculate penalties: %v", err)
+	}
+	penalty := alpha * float64(penalties[u][w]) * nGTrees
+	if satisfied == 0 || penalty == 0 {
+		t.Fatalf("edge satisfies %g quartets with penalty %g, want both positive", satisfied, penalty)
+	}
+	testCases := []struct {
+		name     string
+		scale    PenaltyScale
+		expected float64
+	}{
+		{name: "flat", scale: FlatPenalty{}, expected: 2*satisfied - penalty},
+		{name: "default", scale: nil, expected: 2*satisfied - penalty},
+		{name: "linear", scale: LinearPenalty{}, expected: 2*satisfied - 5.0/4*penalty},
+		{name: "log", scale: LogPenalty{}, expected: 2*satisfied - (1+math.Log(5.0/4))*penalty},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var scorer SymDiffScorer
+			err := scorer.Init(td, 1, AsSet(true), WithNGtrees(nGTrees), WithAlpha(alpha), WithPenaltyScale(tc.scale))
+			if err != nil {
+				t.Fatalf("init failed: %v", err)
+			}
+			if got := scorer.CalcScore(u, w, td); math.Abs(got-tc.expected) > 1e-9 {
+				t.Fatalf("score = %f, want %f", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package score
+
+import (
+	"fmt"
+	"strings"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+// Edges CAMUS may add by default: the cycle must have more than three edges,
+// and neither end can be the root
+var DefaultEdgePolicy = NewEdgePolicy(MinCycleLength(shortestCycle), ExcludeRoot)
+
+// Rule an edge from u to w must pass to be added to the constraint tree
+type EdgeRule struct {
+	Name  string // identifies the rule (e.g., in cache keys), so it should be unique
+	Allow func(u, w int, td *gr.TreeData) bool
+}
+
+// Decides which edges from u to w may be added to the constraint tree. The
+// same policy is used by the scorers (which only calculate scores for edges it
+// allows) and the dp (which only adds edges it allows), so constraints
+// compose by adding rules. An edge is allowed if w is neither u nor an
+// ancestor of u and it passes every rule; a nil policy is DefaultEdgePolicy.
+type EdgePolicy struct {
+	rules []EdgeRule
+}
+
+func NewEdgePolicy(rules ...EdgeRule) *EdgePolicy {
+	return &EdgePolicy{rules: rules}
+}
+
+// New policy with the rules of p and rules (p is not modified)
+func (p *EdgePolicy) With(rules ...EdgeRule) *EdgePolicy {
+	if p == nil {
+		p = DefaultEdgePolicy
+	}
+	combined := make([]EdgeRule, 0, len(p.rules)+len(rules))
+	return &EdgePolicy{rules: append(append(combined, p.rules...), rules...)}
+}
+
+// true if the edge from u to w may be added
+func (p *EdgePolicy) Allows(u, w int, td *gr.TreeData) bool {
+	if p == nil {
+		p = DefaultEdgePolicy
+	}
+	if u == w || td.Under(w, u) {
+		return false
+	}
+	for _, rule := range p.rules {
+		if !rule.Allow(u, w, td) {
+			return false
+		}
+	}
+	return true
+}
+
+// Names of the rules, in order
+func (p *EdgePolicy) String() string {
+	if p == nil {
+		p = DefaultEdgePolicy
+	}
+	names := make([]string, len(p.rules))
+	for i, rule := range p.rules {
+		names[i] = rule.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// Cycle formed by the edge must have at least n edges
+func MinCycleLength(n int) EdgeRule {
+	return EdgeRule{
+		Name: fmt.Sprintf("min-cycle:%d", n),
+		Allow: func(u, w int, td *gr.TreeData) bool {
+			return CycleLength(u, w, td) >= n
+		},
+	}
+}
+
+// Neither end of the edge can be the root
+var ExcludeRoot = EdgeRule{
+	Name: "no-root",
+	Allow: func(u, w int, td *gr.TreeData) bool {
+		root := td.Root().Id()
+		return u != root && w != root
+	},
+}
+
+// Neither end of the edge can be a child of the root
+var ExcludeRootChildren = EdgeRule{
+	Name: "no-root-children",
+	Allow: func(u, w int, td *gr.TreeData) bool {
+		for _, c := range td.Children[td.Root().Id()] {
+			if c.Id() == u || c.Id() == w {
+				return false
+			}
+		}
+		return true
+	},
+}
+
+// None of the branches can be added
+func ExcludeBranches(branches ...gr.Branch) EdgeRule {
+	ids := make([]string, len(branches))
+	for i, br := range branches {
+		ids[i] = fmt.Sprintf("%d-%d", br.IDs[gr.Ui], br.IDs[gr.Wi])
+	}
+	return EdgeRule{
+		Name: "exclude:" + strings.Join(ids, ";"),
+		Allow: func(u, w int, td *gr.TreeData) bool {
+			for _, br := range branches {
+				if br.IDs == [2]int{u, w} {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// Edges cannot join two nodes that are both marked (by id), e.g., nodes below
+// edges added to resolve polytomies, since those edges are not real
+func ExcludeBetween(name string, marked []bool) EdgeRule {
+	return EdgeRule{
+		Name: "exclude-between:" + name,
+		Allow: func(u, w int, td *gr.TreeData) bool {
+			return !marked[u] || !marked[w]
+		},
+	}
+}
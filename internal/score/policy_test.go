@@ -0,0 +1,51 @@
+package score
+
+import (
+	"testing"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+)
+
+func TestEdgePolicy_Allows(t *testing.T) {
+	td := makeTreeData(t, "((A,(B,C)b)a,(D,E)c)r;")
+	excluded := gr.Branch{IDs: [2]int{nodeIDByLabel(t, td, "b"), nodeIDByLabel(t, td, "c")}}
+	testCases := []struct {
+		name     string
+		policy   *EdgePolicy
+		uLabel   string
+		wLabel   string
+		expected bool
+	}{
+		{name: "valid", policy: nil, uLabel: "b", wLabel: "c", expected: true},
+		{name: "ancestor", policy: nil, uLabel: "b", wLabel: "a", expected: false},
+		{name: "same node", policy: NewEdgePolicy(), uLabel: "b", wLabel: "b", expected: false},
+		{name: "short cycle", policy: nil, uLabel: "a", wLabel: "c", expected: false},
+		{name: "root", policy: nil, uLabel: "r", wLabel: "b", expected: false},
+		{name: "short cycle allowed", policy: NewEdgePolicy(MinCycleLength(3), ExcludeRoot), uLabel: "a", wLabel: "c", expected: true},
+		{name: "root child", policy: DefaultEdgePolicy.With(ExcludeRootChildren), uLabel: "B", wLabel: "c", expected: false},
+		{name: "not root child", policy: DefaultEdgePolicy.With(ExcludeRootChildren), uLabel: "B", wLabel: "D", expected: true},
+		{name: "excluded branch", policy: DefaultEdgePolicy.With(ExcludeBranches(excluded)), uLabel: "b", wLabel: "c", expected: false},
+		{name: "other branch", policy: DefaultEdgePolicy.With(ExcludeBranches(excluded)), uLabel: "b", wLabel: "D", expected: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uID := nodeIDByLabel(t, td, tc.uLabel)
+			wID := nodeIDByLabel(t, td, tc.wLabel)
+			if got := tc.policy.Allows(uID, wID, td); got != tc.expected {
+				t.Fatalf("Allows(%s,%s) = %t, want %t", tc.uLabel, tc.wLabel, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEdgePolicy_With(t *testing.T) {
+	base := NewEdgePolicy(MinCycleLength(4))
+	extended := base.With(ExcludeRoot)
+	if base.String() != "min-cycle:4" || extended.String() != "min-cycle:4,no-root" {
+		t.Errorf("got %q and %q, expected base to be unchanged", base.String(), extended.String())
+	}
+	var nilPolicy *EdgePolicy
+	if nilPolicy.String() != DefaultEdgePolicy.String() {
+		t.Errorf("nil policy is %q, expected %q", nilPolicy.String(), DefaultEdgePolicy.String())
+	}
+}
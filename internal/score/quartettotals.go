@@ -1,15 +1,15 @@
 package score
 
 import (
-	"context"
 	"errors"
 	"fmt"
-	"log"
+	"math"
 
 	"github.com/evolbioinfo/gotree/tree"
-	"golang.org/x/sync/errgroup"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	"github.com/jsdoublel/camus/internal/pool"
 )
 
 const Max16Bit = ^uint16(0)
@@ -33,35 +33,63 @@ func (qt QuartetTotals) PercentQuartetSat(branches []gr.Branch, td *gr.TreeData)
 		}
 		sum += qt.quartetTotals[br.IDs[0]][br.IDs[1]]
 	}
-	if qt.asSet {
-		return 100 * float64(sum) / float64(td.TotalNumUniqueQuartets()), nil
+	return PercentOfQuartets(sum, td, qt.asSet), nil
+}
+
+// Returns the number of quartets satisfied by a set of branches, calculating
+// only the totals for those branches (no need to initialize every edge)
+func TotalSatQuartets(branches []gr.Branch, td *gr.TreeData, asSet bool) (uint64, error) {
+	var sum uint64
+	for _, br := range branches {
+		u, w := br.IDs[gr.Ui], br.IDs[gr.Wi]
+		if u >= len(td.IdToNodes) || w >= len(td.IdToNodes) {
+			return 0, fmt.Errorf("node ids [%d, %d] out of range %d", u, w, len(td.IdToNodes))
+		}
+		sum += quartetsTotal(u, w, td, asSet)
+	}
+	return sum, nil
+}
+
+// Percent of all quartets (or unique quartets if asSet) that count is
+func PercentOfQuartets(count uint64, td *gr.TreeData, asSet bool) float64 {
+	if asSet {
+		return 100 * float64(count) / float64(td.TotalNumUniqueQuartets())
+	}
+	return 100 * float64(count) / float64(td.TotalNumQuartets())
+}
+
+// Percent of all quartets (or unique quartets if asSet) that the constraint
+// tree displays, i.e., that the backbone satisfies without any edges (0 unless
+// preprocessing kept them, see td.ConstraintWeight)
+func PercentDisplayed(td *gr.TreeData, asSet bool) float64 {
+	var count uint64
+	for _, q := range td.Quartets(td.Root().Id()) {
+		if !td.Displays(q) {
+			continue
+		}
+		if asSet {
+			count++
+		} else {
+			count += uint64(td.NumQuartet(q))
+		}
 	}
-	return 100 * float64(sum) / float64(td.TotalNumQuartets()), nil
+	return PercentOfQuartets(count, td, asSet)
 }
 
-// Calculate the total number of quartets for all edges
-func (qt *QuartetTotals) CalculateQuartetTotals(td *gr.TreeData, asSet bool, nprocs int) error {
-	log.Println("calculating edge scores")
+// Calculate the total number of quartets for all edges policy allows
+func (qt *QuartetTotals) CalculateQuartetTotals(td *gr.TreeData, asSet bool, policy *EdgePolicy, nprocs int) error {
+	lg.Debugf("calculating edge scores")
 	n := len(td.Nodes())
 	qt.quartetTotals = make([][]uint64, n)
-	g, _ := errgroup.WithContext(context.Background())
-	g.SetLimit(nprocs)
-	for u := range n {
+	pool.Run(n, nprocs, func(u int) {
 		qt.quartetTotals[u] = make([]uint64, n)
-		g.Go(func() error {
-			for w := range n {
-				if ShouldCalcEdge(u, w, td) {
-					qt.quartetTotals[u][w] = quartetsTotal(u, w, td, asSet)
-				}
+		for w := range n {
+			if policy.Allows(u, w, td) {
+				qt.quartetTotals[u][w] = quartetsTotal(u, w, td, asSet)
 			}
-			return nil
-		})
-	}
-	return g.Wait()
-}
-
-func ShouldCalcEdge(u, w int, td *gr.TreeData) bool {
-	return !td.Under(w, u) && CycleLength(u, w, td) > 3 && u != 0 && w != 0
+		}
+	})
+	return nil
 }
 
 func CycleLength(u, w int, td *gr.TreeData) int {
@@ -92,6 +120,105 @@ func quartetsTotal(u, w int, td *gr.TreeData, asSet bool) uint64 {
 	return total
 }
 
+// Approximate fraction of gene trees following the edge from u to w, i.e.,
+// supporting / (supporting + backbone) quartets. Unless preprocessing kept the
+// quartets displayed by the backbone tree (see td.ConstraintWeight), their
+// count is estimated as the quartets each of the nGeneTrees gene trees has
+// around the cycle minus those that were kept; this is off when gene trees are
+// missing taxa or have polytomies. Returns NaN if there are no such quartets.
+func ApproxMinorFrequency(u, w int, td *gr.TreeData, nGeneTrees int) float64 {
+	v := td.LCA(u, w)
+	uNode, wNode, vNode := td.IdToNodes[u], td.IdToNodes[w], td.IdToNodes[v]
+	wSub := getWSubtree(u, w, v, td)
+	var supported, informative uint64
+	var kept float64 // count of backbone quartets (scaled back up from td.ConstraintWeight)
+	for _, q := range td.Quartets(v) {
+		switch QuartetScore(q, uNode, wNode, vNode, wSub, td) {
+		case gr.Qeq:
+			supported += uint64(td.NumQuartet(q))
+			informative += uint64(td.NumQuartet(q))
+		case gr.Qneq:
+			if td.ConstraintWeight != 0 && td.Displays(q) {
+				kept += float64(td.NumQuartet(q)) / td.ConstraintWeight
+			} else {
+				informative += uint64(td.NumQuartet(q))
+			}
+		}
+	}
+	if td.ConstraintWeight != 0 {
+		if float64(supported)+kept == 0 {
+			return math.NaN()
+		}
+		return float64(supported) / (float64(supported) + kept)
+	}
+	subsets := cycleSubsets(u, w, v, td)
+	coe := [...]uint64{1, 0, 0, 0}
+	for _, n := range subsets[1:] {
+		for j := 3; j > 0; j-- {
+			coe[j] += n * coe[j-1]
+		}
+	}
+	var backbone uint64
+	if expected := subsets[0] * coe[3] * uint64(nGeneTrees); expected > informative {
+		backbone = expected - informative
+	}
+	if supported+backbone == 0 {
+		return math.NaN()
+	}
+	return float64(supported) / float64(supported+backbone)
+}
+
+// Number of taxa in each subtree hanging off of the cycle made by the edge from
+// u to w (v is their lca), with the taxa under w at index 0. Unlike
+// getNumTaxaUnderNodes, each taxon is in exactly one subtree.
+func cycleSubsets(u, w, v int, td *gr.TreeData) []uint64 {
+	subsets := pathSubsets(w, v, td)
+	if u == v {
+		var wSide uint64
+		for _, n := range subsets {
+			wSide += n
+		}
+		subsets = append(subsets, td.NumLeavesBelow[v]-wSide)
+	} else {
+		subsets = append(subsets, pathSubsets(u, v, td)...)
+	}
+	return append(subsets, uint64(td.NLeaves)-td.NumLeavesBelow[v])
+}
+
+// Number of taxa under start, and under the sibling of each node on the path
+// from start up to (not including) the child of end
+func pathSubsets(start, end int, td *gr.TreeData) []uint64 {
+	subsets := []uint64{td.NumLeavesBelow[start]}
+	for cur := start; ; {
+		parent, err := td.IdToNodes[cur].Parent()
+		if err != nil {
+			panic(err)
+		}
+		if parent.Id() == end {
+			return subsets
+		}
+		subsets = append(subsets, td.NumLeavesBelow[td.Sibling(td.IdToNodes[cur]).Id()])
+		cur = parent.Id()
+	}
+}
+
+// Returns the set of quartets satisfied by at least one of the branches
+func SatisfiedQuartets(branches []gr.Branch, td *gr.TreeData) map[gr.Quartet]bool {
+	satisfied := make(map[gr.Quartet]bool)
+	for _, br := range branches {
+		u, w := br.IDs[gr.Ui], br.IDs[gr.Wi]
+		v := td.LCA(u, w)
+		uNode, wNode, vNode := td.IdToNodes[u], td.IdToNodes[w], td.IdToNodes[v]
+		wSub := getWSubtree(u, w, v, td)
+		for _, q := range td.Quartets(v) {
+			if QuartetScore(q, uNode, wNode, vNode, wSub, td) == gr.Qeq {
+				satisfied[q] = true
+			}
+		}
+	}
+	return satisfied
+}
+
 func getWSubtree(u, w, v int, td *gr.TreeData) *tree.Node {
 	switch {
 	case u == v:
@@ -1,6 +1,7 @@
 package score
 
 import (
+	"math"
 	"strings"
 	"testing"
 
@@ -39,14 +40,14 @@ func TestCalculateQuartetTotals(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			td := makeTreeDataWithQuartets(t, tc.tree, tc.quartets)
 			qt := &QuartetTotals{}
-			if err := qt.CalculateQuartetTotals(td, tc.asSet, tc.nprocs); err != nil {
+			if err := qt.CalculateQuartetTotals(td, tc.asSet, nil, tc.nprocs); err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
 			positive := 0
 			for u := range qt.quartetTotals {
 				for w := range qt.quartetTotals[u] {
 					got := qt.quartetTotals[u][w]
-					if ShouldCalcEdge(u, w, td) {
+					if DefaultEdgePolicy.Allows(u, w, td) {
 						want := quartetsTotal(u, w, td, tc.asSet)
 						if got != want {
 							t.Fatalf("quartetTotals[%d][%d] = %d, want %d", u, w, got, want)
@@ -68,31 +69,6 @@ func TestCalculateQuartetTotals(t *testing.T) {
 	}
 }
 
-func TestShouldCalcEdge(t *testing.T) {
-	td := makeTreeData(t, "((A,(B,C)b)a,(D,E)c)r;")
-	testCases := []struct {
-		name     string
-		uLabel   string
-		wLabel   string
-		expected bool
-	}{
-		{name: "valid", uLabel: "b", wLabel: "c", expected: true},
-		{name: "ancestor", uLabel: "b", wLabel: "a", expected: false},
-		{name: "short cycle", uLabel: "a", wLabel: "c", expected: false},
-		{name: "root", uLabel: "r", wLabel: "b", expected: false},
-	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			uID := nodeIDByLabel(t, td, tc.uLabel)
-			wID := nodeIDByLabel(t, td, tc.wLabel)
-			got := ShouldCalcEdge(uID, wID, td)
-			if got != tc.expected {
-				t.Fatalf("shouldCalcEdge(%s,%s) = %t, want %t", tc.uLabel, tc.wLabel, got, tc.expected)
-			}
-		})
-	}
-}
-
 func TestCycleLength(t *testing.T) {
 	td := makeTreeData(t, "((A,(B,C)b)a,(D,E)c)r;")
 	testCases := []struct {
@@ -124,6 +100,17 @@ func TestQuartetsTotal(t *testing.T) {
 		{nwk: "((A,E),(B,F));", count: 7},
 		{nwk: "((A,F),(B,E));", count: 4},
 	})
+	tdKept := makeTreeDataWithQuartets(t, "((A,B)a,(C,D)b)r;", []quartetCount{
+		{nwk: "((A,C),(B,D));", count: 5},
+		{nwk: "((A,D),(B,C));", count: 1},
+		{nwk: "((A,B),(C,D));", count: 3},
+	})
+	tdKept.ConstraintWeight = 1
+	tdWeighted := makeTreeDataWithQuartets(t, "((A,B)a,(C,D)b)r;", []quartetCount{
+		{nwk: "((A,C),(B,D));", count: 5},
+		{nwk: "((A,B),(C,D));", count: 2},
+	})
+	tdWeighted.ConstraintWeight = 0.5
 	testCases := []struct {
 		name   string
 		td     *gr.TreeData
@@ -152,6 +139,57 @@ func TestQuartetsTotal(t *testing.T) {
 	}
 }
 
+func TestApproxMinorFrequency(t *testing.T) {
+	td := makeTreeDataWithQuartets(t, "((A,B)a,(C,D)b)r;", []quartetCount{{nwk: "((A,C),(B,D));", count: 5}})
+	tdNeq := makeTreeDataWithQuartets(t, "((A,B)a,(C,D)b)r;", []quartetCount{
+		{nwk: "((A,C),(B,D));", count: 5},
+		{nwk: "((A,D),(B,C));", count: 1},
+	})
+	tdLong := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", []quartetCount{
+		{nwk: "((A,E),(B,F));", count: 7},
+		{nwk: "((A,F),(B,E));", count: 4},
+	})
+	tdKept := makeTreeDataWithQuartets(t, "((A,B)a,(C,D)b)r;", []quartetCount{
+		{nwk: "((A,C),(B,D));", count: 5},
+		{nwk: "((A,D),(B,C));", count: 1},
+		{nwk: "((A,B),(C,D));", count: 3},
+	})
+	tdKept.ConstraintWeight = 1
+	tdWeighted := makeTreeDataWithQuartets(t, "((A,B)a,(C,D)b)r;", []quartetCount{
+		{nwk: "((A,C),(B,D));", count: 5},
+		{nwk: "((A,B),(C,D));", count: 2},
+	})
+	tdWeighted.ConstraintWeight = 0.5
+	testCases := []struct {
+		name       string
+		td         *gr.TreeData
+		uLabel     string
+		wLabel     string
+		nGeneTrees int
+		want       float64
+	}{
+		{name: "basic", td: td, uLabel: "A", wLabel: "C", nGeneTrees: 8, want: 0.625},
+		{name: "long cycle", td: tdLong, uLabel: "A", wLabel: "E", nGeneTrees: 2, want: 7.0 / 20},
+		{name: "other topology", td: tdNeq, uLabel: "A", wLabel: "C", nGeneTrees: 8, want: 5.0 / 7},
+		{name: "no backbone", td: td, uLabel: "A", wLabel: "C", nGeneTrees: 5, want: 1},
+		{name: "too few gene trees", td: tdNeq, uLabel: "A", wLabel: "C", nGeneTrees: 2, want: 1},
+		{name: "unsupported", td: td, uLabel: "A", wLabel: "D", nGeneTrees: 8, want: 0},
+		{name: "no quartets", td: td, uLabel: "A", wLabel: "D", nGeneTrees: 5, want: math.NaN()},
+		{name: "kept backbone", td: tdKept, uLabel: "A", wLabel: "C", nGeneTrees: 2, want: 5.0 / 8},
+		{name: "weighted backbone", td: tdWeighted, uLabel: "A", wLabel: "C", nGeneTrees: 2, want: 5.0 / 9},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uID := nodeIDByLabel(t, tc.td, tc.uLabel)
+			wID := nodeIDByLabel(t, tc.td, tc.wLabel)
+			got := ApproxMinorFrequency(uID, wID, tc.td, tc.nGeneTrees)
+			if got != tc.want && !(math.IsNaN(got) && math.IsNaN(tc.want)) {
+				t.Fatalf("ApproxMinorFrequency(%s,%s) = %f, want %f", tc.uLabel, tc.wLabel, got, tc.want)
+			}
+		})
+	}
+}
+
 func BenchmarkQuartetScore(b *testing.B) {
 	testCases := []struct {
 		name    string
@@ -243,7 +281,7 @@ func makeTreeDataWithQuartets(t *testing.T, treeNWK string, quartets []quartetCo
 	if err := tre.UpdateTipIndex(); err != nil {
 		t.Fatalf("failed to update tip index: %v", err)
 	}
-	qCounts := make(map[gr.Quartet]uint32)
+	qCounts := gr.NewQuartetTable(0)
 	for _, qt := range quartets {
 		qTree, err := newick.NewParser(strings.NewReader(qt.nwk)).Parse()
 		if err != nil {
@@ -253,7 +291,7 @@ func makeTreeDataWithQuartets(t *testing.T, treeNWK string, quartets []quartetCo
 		if err != nil {
 			t.Fatalf("failed to build quartet %s: %v", qt.nwk, err)
 		}
-		qCounts[q] = qt.count
+		qCounts.Set(q, qt.count)
 	}
 	return gr.MakeTreeData(tre, qCounts)
 }
@@ -2,6 +2,7 @@
 package score
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -9,6 +10,7 @@ import (
 	"github.com/evolbioinfo/gotree/tree"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	"github.com/jsdoublel/camus/internal/pool"
 	pr "github.com/jsdoublel/camus/internal/prep"
 )
 
@@ -22,28 +24,366 @@ type reticulation struct {
 	wSub *tree.Node
 }
 
-func ReticulationScore(ntw *gr.Network, gtrees []*tree.Tree) ([]*map[string]float64, error) {
+// Calculates the proportion of informative quartets in each gene tree that
+// support each reticulation (NaN if the gene tree has no informative quartets).
+// Stops and returns ctx's error if ctx is cancelled.
+func ReticulationScore(ctx context.Context, ntw *gr.Network, gtrees []*tree.Tree) ([]*map[string]float64, error) {
+	results := make([]*map[string]float64, len(gtrees))
+	err := reticulationCounts(ctx, ntw, gtrees, func(i int, totals, supported, _ map[string]uint) {
+		results[i] = geneRetScores(ntw, totals, supported)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Calculates support for each reticulation aggregated across all gene trees,
+// without keeping the per gene scores
+func ReticulationSummary(ctx context.Context, ntw *gr.Network, gtrees []*tree.Tree) (map[string]pr.RetSummary, error) {
+	sums := newRetSums()
+	err := reticulationCounts(ctx, ntw, gtrees, func(_ int, totals, supported, _ map[string]uint) {
+		sums.add(ntw, totals, supported)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums.summaries(ntw, len(gtrees)), nil
+}
+
+// Calculates both the per gene scores (see ReticulationScore) and the
+// aggregated support (see ReticulationSummary), reading the quartets of each
+// gene tree once
+func ReticulationScoreAndSummary(ctx context.Context, ntw *gr.Network, gtrees []*tree.Tree) ([]*map[string]float64, map[string]pr.RetSummary, error) {
+	results := make([]*map[string]float64, len(gtrees))
+	sums := newRetSums()
+	err := reticulationCounts(ctx, ntw, gtrees, func(i int, totals, supported, _ map[string]uint) {
+		results[i] = geneRetScores(ntw, totals, supported)
+		sums.add(ntw, totals, supported)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, sums.summaries(ntw, len(gtrees)), nil
+}
+
+// Score of each reticulation for one gene tree
+func geneRetScores(ntw *gr.Network, totals, supported map[string]uint) *map[string]float64 {
+	scores := make(map[string]float64)
+	for label := range ntw.Reticulations {
+		if totals[label] != 0 {
+			scores[label] = float64(supported[label]) / float64(totals[label])
+		} else {
+			scores[label] = math.NaN()
+		}
+	}
+	return &scores
+}
+
+// Counts of each reticulation summed across gene trees with informative
+// quartets
+type retSums struct {
+	total, supported map[string]uint
+	mean             map[string]float64
+	informative      map[string]int
+}
+
+func newRetSums() *retSums {
+	return &retSums{
+		total:       make(map[string]uint),
+		supported:   make(map[string]uint),
+		mean:        make(map[string]float64),
+		informative: make(map[string]int),
+	}
+}
+
+// Adds the counts of one gene tree
+func (s *retSums) add(ntw *gr.Network, totals, supported map[string]uint) {
+	for label := range ntw.Reticulations {
+		if totals[label] == 0 {
+			continue
+		}
+		s.total[label] += totals[label]
+		s.supported[label] += supported[label]
+		s.mean[label] += float64(supported[label]) / float64(totals[label])
+		s.informative[label]++
+	}
+}
+
+// Support of each reticulation across nGenes gene trees
+func (s *retSums) summaries(ntw *gr.Network, nGenes int) map[string]pr.RetSummary {
+	results := make(map[string]pr.RetSummary, len(ntw.Reticulations))
+	for label := range ntw.Reticulations {
+		summary := pr.RetSummary{
+			Support:             math.NaN(),
+			Mean:                math.NaN(),
+			Informative:         s.informative[label],
+			InformativeFraction: float64(s.informative[label]) / float64(nGenes),
+		}
+		if s.informative[label] != 0 {
+			summary.Support = float64(s.supported[label]) / float64(s.total[label])
+			summary.Mean = s.mean[label] / float64(s.informative[label])
+		}
+		results[label] = summary
+	}
+	return results
+}
+
+// Estimates the inheritance probability (gamma) of each reticulation edge as
+// the fraction of quartets supporting the reticulation out of those supporting
+// either the reticulation or the backbone tree, among the quartets the
+// reticulation changes (pooled across gene trees, NaN if there are none)
+func InheritanceProbabilities(ctx context.Context, ntw *gr.Network, gtrees []*tree.Tree) (map[string]float64, error) {
+	supportedSum, displayedSum := make(map[string]uint), make(map[string]uint)
+	err := reticulationCounts(ctx, ntw, gtrees, func(_ int, _, supported, displayed map[string]uint) {
+		for label := range ntw.Reticulations {
+			supportedSum[label] += supported[label]
+			displayedSum[label] += displayed[label]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	gammas := make(map[string]float64, len(ntw.Reticulations))
+	for label := range ntw.Reticulations {
+		gammas[label] = math.NaN()
+		if total := supportedSum[label] + displayedSum[label]; total != 0 {
+			gammas[label] = float64(supportedSum[label]) / float64(total)
+		}
+	}
+	return gammas, nil
+}
+
+// Counts, for each network (a set of branches on the constraint tree td), the
+// gene trees containing at least one quartet the network satisfies
+func SupportingGenes(td *gr.TreeData, networks [][]gr.Branch, gtrees []*tree.Tree, nprocs int) ([]int, error) {
+	satisfiedBy := make(map[gr.Quartet][]int) // quartet -> networks satisfying it
+	for i, branches := range networks {
+		for q := range SatisfiedQuartets(branches, td) {
+			satisfiedBy[q] = append(satisfiedBy[q], i)
+		}
+	}
+	supports := make([][]bool, len(gtrees)) // supports[g][i] is true if gene tree g supports network i
+	errs := make([]error, len(gtrees))
+	pool.Run(len(gtrees), nprocs, func(g int) {
+		gtre := gr.Unrooted(gtrees[g])
+		constMap, err := gr.MapIDsFromConstTree(gtre, &td.Tree)
+		if err != nil {
+			errs[g] = err
+			return
+		}
+		supports[g] = make([]bool, len(networks))
+		gtre.Quartets(false, func(q *tree.Quartet) {
+			for _, i := range satisfiedBy[gr.QuartetFromTreeQ(q, constMap)] {
+				supports[g][i] = true
+			}
+		})
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	counts := make([]int, len(networks))
+	for _, s := range supports {
+		for i, ok := range s {
+			if ok {
+				counts[i]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// Counts, for each gene tree, the quartets of the gene tree that each branch
+// satisfies on its own (counts[g][i] for gene tree g and branches[i]), only
+// counting quartets kept in td (i.e., that passed the quartet filter). Each
+// quartet of a gene tree is counted once. Stops and returns ctx's error if ctx
+// is cancelled.
+func GeneContributions(ctx context.Context, td *gr.TreeData, branches []gr.Branch, gtrees []*tree.Tree, nprocs int) ([][]uint64, error) {
+	satisfiedBy := make(map[gr.Quartet][]int) // quartet -> branches satisfying it
+	for i, br := range branches {
+		for q := range SatisfiedQuartets([]gr.Branch{br}, td) {
+			satisfiedBy[q] = append(satisfiedBy[q], i)
+		}
+	}
+	counts := make([][]uint64, len(gtrees))
+	errs := make([]error, len(gtrees))
+	pool.Run(len(gtrees), nprocs, func(g int) {
+		if errs[g] = ctx.Err(); errs[g] != nil {
+			return
+		}
+		if err := gtrees[g].UpdateTipIndex(); err != nil {
+			errs[g] = fmt.Errorf("gene tree %w", pr.ErrMulTree)
+			return
+		}
+		quartets, err := gr.QuartetsFromTree(gtrees[g], &td.Tree)
+		if err != nil {
+			errs[g] = err
+			return
+		}
+		counts[g] = make([]uint64, len(branches))
+		for q := range quartets.All() {
+			for _, i := range satisfiedBy[q] {
+				counts[g][i]++
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// Same as GeneContributions, but reads the gene trees each quartet came from
+// out of td (see gr.TreeData.SetProvenance) instead of the gene trees, of
+// which there are nGenes
+func GeneContributionsFromProvenance(td *gr.TreeData, branches []gr.Branch, nGenes int) [][]uint64 {
+	counts := make([][]uint64, nGenes)
+	for g := range counts {
+		counts[g] = make([]uint64, len(branches))
+	}
+	for i, br := range branches {
+		for q := range SatisfiedQuartets([]gr.Branch{br}, td) {
+			for _, gc := range td.QuartetGenes(q) {
+				if gc.Count > 0 {
+					counts[gc.Gene][i]++
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// Quartets satisfied by each branch (weighted like the counts of td, see
+// TotalSatQuartets) that came from each of nBlocks blocks of gene trees
+// (support[block][branch]), using the gene trees kept in td (see
+// gr.TreeData.SetProvenance). The count of a quartet in td is split between
+// gene trees in proportion to their counts, which keeps the share of each
+// block right when counts were capped or weighted after counting. If asSet,
+// a quartet only counts for a block if every gene tree it came from is in the
+// block (i.e., leaving out the block removes it).
+func BlockSupport(td *gr.TreeData, branches []gr.Branch, block func(gene uint32) int, nBlocks int, asSet bool) [][]float64 {
+	support := make([][]float64, nBlocks)
+	for b := range support {
+		support[b] = make([]float64, len(branches))
+	}
+	for i, br := range branches {
+		for q := range SatisfiedQuartets([]gr.Branch{br}, td) {
+			genes := td.QuartetGenes(q)
+			if asSet {
+				if b, ok := onlyBlock(genes, block); ok {
+					support[b][i]++
+				}
+				continue
+			}
+			var total uint64
+			for _, gc := range genes {
+				total += uint64(gc.Count)
+			}
+			if total == 0 {
+				continue
+			}
+			count := float64(td.NumQuartet(q))
+			for _, gc := range genes {
+				support[block(gc.Gene)][i] += count * float64(gc.Count) / float64(total)
+			}
+		}
+	}
+	return support
+}
+
+// Block all the gene trees with a count of a quartet are in, if there is one
+func onlyBlock(genes []gr.GeneCount, block func(gene uint32) int) (int, bool) {
+	b := -1
+	for _, gc := range genes {
+		switch {
+		case gc.Count == 0:
+		case b == -1:
+			b = block(gc.Gene)
+		case block(gc.Gene) != b:
+			return 0, false
+		}
+	}
+	return b, b != -1
+}
+
+// Fraction of each gene tree's quartets displayed by each tree (agreement[g][t],
+// NaN if gene tree g has no quartets), along with the number of quartets in
+// each gene tree. The trees must have the same taxa (so their tip indices
+// match, see gr.DisplayedTrees). Stops and returns ctx's error if ctx is
+// cancelled.
+func DisplayedTreeAgreement(ctx context.Context, trees []*tree.Tree, gtrees []*tree.Tree, nprocs int) ([][]float64, []int, error) {
+	tds := make([]*gr.TreeData, len(trees))
+	for i, tre := range trees {
+		tds[i] = gr.MakeTreeData(tre, nil)
+	}
+	agreement, nQuartets := make([][]float64, len(gtrees)), make([]int, len(gtrees))
+	errs := make([]error, len(gtrees))
+	pool.Run(len(gtrees), nprocs, func(g int) {
+		if errs[g] = ctx.Err(); errs[g] != nil {
+			return
+		}
+		if err := gtrees[g].UpdateTipIndex(); err != nil {
+			errs[g] = fmt.Errorf("gene tree %w", pr.ErrMulTree)
+			return
+		}
+		quartets, err := gr.QuartetsFromTree(gtrees[g], trees[0]) // each quartet once, not once per branch inducing it
+		if err != nil {
+			errs[g] = err
+			return
+		}
+		displayed := make([]int, len(trees))
+		for q := range quartets.All() {
+			nQuartets[g]++
+			for t, td := range tds {
+				if td.Displays(q) {
+					displayed[t]++
+				}
+			}
+		}
+		agreement[g] = make([]float64, len(trees))
+		for t := range trees {
+			agreement[g][t] = math.NaN()
+			if nQuartets[g] != 0 {
+				agreement[g][t] = float64(displayed[t]) / float64(nQuartets[g])
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return agreement, nQuartets, nil
+}
+
+// Counts the informative (totals) and supporting (supported) quartets for
+// each reticulation in each gene tree, along with the informative quartets
+// displayed by the backbone tree (displayed), passing the counts for gene tree
+// i to the result function. Stops and returns ctx's error if ctx is cancelled.
+func reticulationCounts(ctx context.Context, ntw *gr.Network, gtrees []*tree.Tree, result func(i int, totals, supported, displayed map[string]uint)) error {
 	td := gr.MakeTreeData(ntw.NetTree, nil)
 	if !ntw.Level1(td) {
-		return nil, fmt.Errorf("network is %w", ErrNotLevel1)
+		return fmt.Errorf("network is %w", ErrNotLevel1)
 	}
 	reticulations := *getReticulationNodes(ntw, td)
-	results := make([]*map[string]float64, len(gtrees))
 	for i, gtre := range gtrees {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := gtre.UpdateTipIndex(); err != nil {
-			return nil, fmt.Errorf("gene tree %w", pr.ErrMulTree)
+			return fmt.Errorf("gene tree %w", pr.ErrMulTree)
 		}
 		totals := make(map[string]uint)
 		supported := make(map[string]uint)
-		gtre.UnRoot()
+		displayed := make(map[string]uint)
+		gtre = gr.Unrooted(gtre)
 		constMap, err := gr.MapIDsFromConstTree(gtre, ntw.NetTree)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		gtre.Quartets(false, func(q *tree.Quartet) {
+		gtre.Quartets(false, func(tq *tree.Quartet) {
+			q := gr.QuartetFromTreeQ(tq, constMap)
 			for label, branch := range reticulations {
 				comp := QuartetScore(
-					gr.QuartetFromTreeQ(q, constMap),
+					q,
 					branch.u,
 					branch.w,
 					branch.v,
@@ -56,19 +396,14 @@ func ReticulationScore(ntw *gr.Network, gtrees []*tree.Tree) ([]*map[string]floa
 				if comp == gr.Qeq {
 					supported[label] += 1
 				}
+				if comp == gr.Qneq && td.Displays(q) {
+					displayed[label] += 1
+				}
 			}
 		})
-		gtreeResult := make(map[string]float64)
-		for label := range reticulations {
-			if totals[label] != 0 {
-				gtreeResult[label] = float64(supported[label]) / float64(totals[label])
-			} else {
-				gtreeResult[label] = math.NaN()
-			}
-		}
-		results[i] = &gtreeResult
+		result(i, totals, supported, displayed)
 	}
-	return results, nil
+	return nil
 }
 
 // Get reticulation name to node map
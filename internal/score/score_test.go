@@ -2,16 +2,20 @@ package score
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"io"
+	"fmt"
 	"math"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/evolbioinfo/gotree/io/newick"
 	"github.com/evolbioinfo/gotree/tree"
 
+	gr "github.com/jsdoublel/camus/internal/graphs"
 	pr "github.com/jsdoublel/camus/internal/prep"
 )
 
@@ -66,7 +70,7 @@ func TestRecticulationScore(t *testing.T) {
 				}
 				gtrees[i] = tmp
 			}
-			result, err := ReticulationScore(ntw, gtrees)
+			result, err := ReticulationScore(context.Background(), ntw, gtrees)
 			switch {
 			case err != nil && !errors.Is(err, test.expectedErr):
 				t.Errorf("test case failed with unexpected error %s", err)
@@ -126,28 +130,13 @@ func TestCalculateRecticulationScore_Large(t *testing.T) {
 			if err != nil {
 				t.Fatalf("failed to convert tree to network %s", err)
 			}
-			scores, err := ReticulationScore(network, genes.Trees)
+			scores, err := ReticulationScore(context.Background(), network, genes.Trees)
 			if err != nil {
 				t.Fatalf("failed with unexpected err %s", err)
 			}
-			r, w, err := os.Pipe()
-			if err != nil {
-				t.Fatalf("failed to open pipe %s", err)
-			}
-			oldStdout := os.Stdout
-			os.Stdout = w
-			if err := pr.WriteRetScoresToCSV(scores, genes.Names); err != nil {
-				t.Errorf("failed to write csv %s", err)
-			}
-			err = w.Close()
-			if err != nil {
-				t.Fatalf("could not close pipe: %s", err)
-			}
-			os.Stdout = oldStdout
 			var buf bytes.Buffer
-			_, err = io.Copy(&buf, r)
-			if err != nil {
-				t.Fatalf("could not copy stdout: %s", err)
+			if err := pr.WriteRetScoresToCSV(scores, genes.Names, &buf); err != nil {
+				t.Errorf("failed to write csv %s", err)
 			}
 			result := strings.TrimSpace(buf.String())
 			expBytes, err := os.ReadFile(test.expected)
@@ -173,9 +162,257 @@ func BenchmarkCalculateRecticulationScore(b *testing.B) {
 		b.Fatalf("failed to convert tree to network %s", err)
 	}
 	for b.Loop() {
-		_, err := ReticulationScore(network, genes.Trees)
+		_, err := ReticulationScore(context.Background(), network, genes.Trees)
 		if err != nil {
 			b.Fatalf("Failed to calculate reticulation scores: %s", err)
 		}
 	}
 }
+
+func TestReticulationScore_Cancelled(t *testing.T) {
+	tre, genes, err := pr.ReadInputFiles("testdata/network.nwk", "testdata/gene-trees.nwk", pr.Newick)
+	if err != nil {
+		t.Fatalf("failed to read in input files %s", err)
+	}
+	network, err := pr.ConvertToNetwork(tre)
+	if err != nil {
+		t.Fatalf("failed to convert tree to network %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ReticulationScore(ctx, network, genes.Trees); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestReticulationSummary(t *testing.T) {
+	tre, genes, err := pr.ReadInputFiles("testdata/network.nwk", "testdata/gene-trees.nwk", pr.Newick)
+	if err != nil {
+		t.Fatalf("failed to read in input files %s", err)
+	}
+	network, err := pr.ConvertToNetwork(tre)
+	if err != nil {
+		t.Fatalf("failed to convert tree to network %s", err)
+	}
+	scores, summaries, err := ReticulationScoreAndSummary(context.Background(), network, genes.Trees)
+	if err != nil {
+		t.Fatalf("failed with unexpected err %s", err)
+	}
+	if len(summaries) != len(network.Reticulations) {
+		t.Fatalf("got %d summaries, expected %d", len(summaries), len(network.Reticulations))
+	}
+	for label, summary := range summaries {
+		var sum float64
+		informative := 0
+		for _, row := range scores {
+			if s := (*row)[label]; !math.IsNaN(s) {
+				sum += s
+				informative++
+			}
+		}
+		if summary.Informative != informative {
+			t.Errorf("%s: got %d informative genes, expected %d", label, summary.Informative, informative)
+		}
+		if frac := float64(informative) / float64(len(scores)); summary.InformativeFraction != frac {
+			t.Errorf("%s: got informative fraction %f, expected %f", label, summary.InformativeFraction, frac)
+		}
+		switch {
+		case informative == 0:
+			if !math.IsNaN(summary.Mean) || !math.IsNaN(summary.Support) {
+				t.Errorf("%s: expected NaN for uninformative reticulation, got %+v", label, summary)
+			}
+		case math.Abs(summary.Mean-sum/float64(informative)) > 1e-9:
+			t.Errorf("%s: got mean %f, expected %f", label, summary.Mean, sum/float64(informative))
+		case summary.Support < 0 || summary.Support > 1:
+			t.Errorf("%s: support %f out of range", label, summary.Support)
+		}
+	}
+	alone, err := ReticulationSummary(context.Background(), network, genes.Trees)
+	if err != nil {
+		t.Fatalf("failed with unexpected err %s", err)
+	}
+	// printed, since NaN is not equal to itself
+	if fmt.Sprint(alone) != fmt.Sprint(summaries) {
+		t.Errorf("got summaries %v from ReticulationSummary, expected %v", alone, summaries)
+	}
+}
+
+func TestInheritanceProbabilities(t *testing.T) {
+	parse := func(nwk string) *tree.Tree {
+		tre, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("%s cannot be parsed as newick. Test case is written incorrectly", nwk)
+		}
+		return tre
+	}
+	repeat := func(nwk string, n int) []string {
+		return slices.Repeat([]string{nwk}, n)
+	}
+	testCases := []struct {
+		name     string
+		network  string
+		genes    []string
+		expected map[string]float64
+	}{
+		{
+			name:    "basic",
+			network: "((A,(#H1,B)),((C)#H1,D));",
+			genes: slices.Concat(
+				repeat("((A,B),(C,D));", 3), // displayed by the backbone tree
+				repeat("((A,D),(B,C));", 1), // supports the reticulation
+				repeat("((A,C),(B,D));", 2), // neither
+			),
+			expected: map[string]float64{"#H1": 0.25},
+		},
+		{
+			name:     "no informative quartets",
+			network:  "((A,(#H1,B)),((C)#H1,D));",
+			genes:    repeat("((A,C),(B,D));", 2),
+			expected: map[string]float64{"#H1": math.NaN()},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			network, err := pr.ConvertToNetwork(parse(test.network))
+			if err != nil {
+				t.Fatalf("failed to convert tree to network %s", err)
+			}
+			genes := make([]*tree.Tree, len(test.genes))
+			for i, nwk := range test.genes {
+				genes[i] = parse(nwk)
+			}
+			gammas, err := InheritanceProbabilities(context.Background(), network, genes)
+			if err != nil {
+				t.Fatalf("failed with unexpected err %s", err)
+			}
+			for label, expected := range test.expected {
+				if got := gammas[label]; got != expected && !(math.IsNaN(got) && math.IsNaN(expected)) {
+					t.Errorf("%s: got gamma %f, expected %f", label, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSupportingGenes(t *testing.T) {
+	td := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", []quartetCount{
+		{nwk: "((A,E),(B,F));", count: 1},
+		{nwk: "((A,F),(B,E));", count: 1},
+	})
+	branch := func(u, w string) gr.Branch {
+		return gr.Branch{IDs: [2]int{nodeIDByLabel(t, td, u), nodeIDByLabel(t, td, w)}}
+	}
+	networks := [][]gr.Branch{{branch("A", "E")}, {branch("A", "E"), branch("A", "F")}, {}}
+	gtrees := make([]*tree.Tree, 0)
+	for _, nwk := range []string{"((A,E),(B,F));", "((A,F),(B,E));", "((A,B),(E,F));", "(((A,E),B),(F,G));"} {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick %s", nwk)
+		}
+		gtrees = append(gtrees, gt)
+	}
+	counts, err := SupportingGenes(td, networks, gtrees, 2)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if expected := []int{2, 3, 0}; !slices.Equal(counts, expected) {
+		t.Errorf("got %v, expected %v", counts, expected)
+	}
+	bad, err := newick.NewParser(strings.NewReader("((A,E),(B,X));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick; test is written wrong")
+	}
+	if _, err := SupportingGenes(td, networks, []*tree.Tree{bad}, 1); !errors.Is(err, gr.ErrTipNameMismatch) {
+		t.Errorf("got error %v, expected %v", err, gr.ErrTipNameMismatch)
+	}
+}
+
+func TestGeneContributions(t *testing.T) {
+	td := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", []quartetCount{
+		{nwk: "((A,E),(B,F));", count: 1},
+		{nwk: "((A,F),(B,E));", count: 1},
+	})
+	branch := func(u, w string) gr.Branch {
+		return gr.Branch{IDs: [2]int{nodeIDByLabel(t, td, u), nodeIDByLabel(t, td, w)}}
+	}
+	branches := []gr.Branch{branch("A", "E"), branch("A", "F")}
+	gtrees := make([]*tree.Tree, 0)
+	for _, nwk := range []string{"((A,E),(B,F));", "((A,F),(B,E));", "((A,B),(E,F));", "(((A,E),B),(F,G));"} {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick %s", nwk)
+		}
+		gtrees = append(gtrees, gt)
+	}
+	counts, err := GeneContributions(context.Background(), td, branches, gtrees, 2)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if expected := [][]uint64{{1, 0}, {0, 1}, {0, 0}, {1, 0}}; !reflect.DeepEqual(counts, expected) {
+		t.Errorf("got %v, expected %v", counts, expected)
+	}
+	provenance := gr.NewQuartetProvenance()
+	for g, nwk := range []string{"((A,E),(B,F));", "((A,F),(B,E));", "((A,E),(B,F));"} {
+		qt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick %s", nwk)
+		}
+		q, err := gr.NewQuartet(qt, &td.Tree)
+		if err != nil {
+			t.Fatalf("invalid quartet %s", nwk)
+		}
+		provenance.Add(q, []int{0, 1, 3}[g], 1)
+	}
+	provenance.Sort()
+	td.SetProvenance(provenance)
+	if fromProvenance := GeneContributionsFromProvenance(td, branches, len(gtrees)); !reflect.DeepEqual(fromProvenance, counts) {
+		t.Errorf("got %v from provenance, expected %v", fromProvenance, counts)
+	}
+	gene := func(g uint32) int { return int(g) }
+	// the first quartet is counted once but came from genes 0 and 3, so they split it
+	if support, expected := BlockSupport(td, branches, gene, len(gtrees), false), [][]float64{{0.5, 0}, {0, 1}, {0, 0}, {0.5, 0}}; !reflect.DeepEqual(support, expected) {
+		t.Errorf("got block support %v, expected %v", support, expected)
+	}
+	if support, expected := BlockSupport(td, branches, gene, len(gtrees), true), [][]float64{{0, 0}, {0, 1}, {0, 0}, {0, 0}}; !reflect.DeepEqual(support, expected) {
+		t.Errorf("got block support %v counting quartets as a set, expected %v", support, expected)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GeneContributions(ctx, td, branches, gtrees, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestDisplayedTreeAgreement(t *testing.T) {
+	td := makeTreeDataWithQuartets(t, "(((A,B)a,(C,D)b)e,(E,(F,G)f)c)r;", nil)
+	// second tree is ((A,B),(((C,D),E),(F,G)))
+	trees := gr.DisplayedTrees(td, []gr.Branch{{IDs: [2]int{nodeIDByLabel(t, td, "E"), nodeIDByLabel(t, td, "b")}}})
+	gtrees := make([]*tree.Tree, 0)
+	for _, nwk := range []string{"((A,B),(C,D));", "(((C,D),E),(A,F));", "(A,B,C);"} {
+		gt, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+		if err != nil {
+			t.Fatalf("invalid newick %s", nwk)
+		}
+		gtrees = append(gtrees, gt)
+	}
+	agreement, nQuartets, err := DisplayedTreeAgreement(context.Background(), trees, gtrees, 2)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if expected := []int{1, 5, 0}; !slices.Equal(nQuartets, expected) {
+		t.Errorf("got %v quartets, expected %v", nQuartets, expected)
+	}
+	expected := [][]float64{{1, 1}, {0.6, 1}, {math.NaN(), math.NaN()}}
+	for g := range expected {
+		if !slices.EqualFunc(agreement[g], expected[g], func(a, b float64) bool { return a == b || math.IsNaN(a) && math.IsNaN(b) }) {
+			t.Errorf("gene tree %d: got %v, expected %v", g, agreement[g], expected[g])
+		}
+	}
+	bad, err := newick.NewParser(strings.NewReader("((A,E),(B,X));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick; test is written wrong")
+	}
+	if _, _, err := DisplayedTreeAgreement(context.Background(), trees, []*tree.Tree{bad}, 1); !errors.Is(err, gr.ErrTipNameMismatch) {
+		t.Errorf("got error %v, expected %v", err, gr.ErrTipNameMismatch)
+	}
+}
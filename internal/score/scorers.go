@@ -3,8 +3,11 @@ package score
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
 
 	gr "github.com/jsdoublel/camus/internal/graphs"
+	"github.com/jsdoublel/camus/util"
 )
 
 var ErrInvalidScorerOption = errors.New("invalid scorer option")
@@ -13,6 +16,35 @@ var ParseScorer = map[string]InitableScorer{
 	"max":  &MaximizeScorer{},
 	"norm": &NormalizedScorer{},
 	"sym":  &SymDiffScorer{},
+	"cf":   &CFScorer{},
+}
+
+// Description of each score mode in ParseScorer (for help)
+var ScorerDescriptions = map[string]string{
+	"max":  "maximizes the number of gene tree quartets satisfied by the network (recommended)",
+	"norm": "divides the quartets satisfied by each edge by the number of gene trees times the quartets the edge could conflict with, favoring edges with little opposing signal",
+	"sym":  "subtracts alpha (-a, scaled by cycle length with -penalty-scale) times the quartets each edge could conflict with from twice the quartets it satisfies, counting each quartet topology once",
+	"cf":   "sums the log likelihood ratios of the quartet topologies each edge adds being more frequent than the other topology the constraint tree does not display, counting only those that reject equal frequencies at the 5% level; only the null of equal minor frequencies under incomplete lineage sorting is tested, not the frequencies the coalescent expects from branch lengths (use with -q 0; not with -count-mode set)",
+}
+
+// Name of scorer's score mode in ParseScorer
+func ScorerName(scorer InitableScorer) string {
+	for name, s := range ParseScorer {
+		if reflect.TypeOf(s) == reflect.TypeOf(scorer) {
+			return name
+		}
+	}
+	panic(fmt.Sprintf("unsupported scorer type %T", scorer))
+}
+
+// New scorer for the score mode name in ParseScorer. A scorer keeps the edge
+// score tables of the run it was initialized for, so each run needs its own.
+func NewScorer(name string) (InitableScorer, bool) {
+	s, ok := ParseScorer[name]
+	if !ok {
+		return nil, false
+	}
+	return reflect.New(reflect.TypeOf(s).Elem()).Interface().(InitableScorer), true
 }
 
 // interface to allow scorers to be stored in a map together
@@ -23,13 +55,31 @@ type InitableScorer interface {
 type ScoreOptions func(opts *scorerOpts) error
 
 type scorerOpts struct {
-	nGTrees int
-	alpha   float64
-	asSet   bool
+	nGTrees  int
+	alpha    float64
+	scale    PenaltyScale
+	asSet    bool
+	counts   int // count scale (see WithCountScale); 0 if not set
+	cacheDir string
+	policy   *EdgePolicy
+}
+
+// Score types of the dp (see util.Score)
+type Score = util.Score
+
+// Writes score exactly (integer scores are not converted to float64)
+func FormatScore[S Score](score S) string {
+	switch s := any(score).(type) {
+	case int64:
+		return strconv.FormatInt(s, 10)
+	case uint64:
+		return strconv.FormatUint(s, 10)
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	panic(fmt.Sprintf("unexpected score type %T", score))
 }
 
-type Score interface{ int64 | uint64 | float64 }
-
 func AsSet(asSet bool) ScoreOptions {
 	return func(options *scorerOpts) error {
 		options.asSet = asSet
@@ -37,6 +87,27 @@ func AsSet(asSet bool) ScoreOptions {
 	}
 }
 
+// Quartet counts are multiplied by scale (e.g., pr.WeightScale for weighted
+// gene trees), so scorers that need the number of gene trees with a topology
+// divide by it
+func WithCountScale(scale int) ScoreOptions {
+	return func(options *scorerOpts) error {
+		if scale <= 0 {
+			return fmt.Errorf("%w, count scale must be positive, but is %d", ErrInvalidScorerOption, scale)
+		}
+		options.counts = scale
+		return nil
+	}
+}
+
+// Only calculate scores for edges policy allows (DefaultEdgePolicy if nil)
+func WithEdgePolicy(policy *EdgePolicy) ScoreOptions {
+	return func(options *scorerOpts) error {
+		options.policy = policy
+		return nil
+	}
+}
+
 // scorers implement different scorring metrics
 type Scorer[S Score] interface {
 	Init(td *gr.TreeData, nprocs int, opts ...ScoreOptions) error
@@ -55,18 +126,23 @@ func (s *MaximizeScorer) Init(td *gr.TreeData, nprocs int, opts ...ScoreOptions)
 			return err
 		}
 	}
-	s.asSet = options.asSet
-	return s.CalculateQuartetTotals(td, options.asSet, nprocs)
+	return s.initQuartetTotals(td, options, nprocs)
 }
 
 func (s MaximizeScorer) CalcScore(u, w int, td *gr.TreeData) uint64 {
 	return s.quartetTotals[u][w]
 }
 
+// Divides the quartets each edge adds by the gene trees that could have them.
+// If td tracks occupancy (see gr.TreeData.SetOccupancy) and quartets are not
+// counted as a set, that is the occupancy of the edge (see edgeOccupancy), so
+// clades missing from many gene trees are not penalized; otherwise it is the
+// number of gene trees times the edge penalty.
 type NormalizedScorer struct {
 	QuartetTotals
 	NGTree    int
 	penalties [][]uint64
+	occupancy [][]uint64 // nil if not used
 }
 
 func WithNGtrees(ngtrees int) ScoreOptions {
@@ -86,19 +162,28 @@ func (s *NormalizedScorer) Init(td *gr.TreeData, nprocs int, opts ...ScoreOption
 			return err
 		}
 	}
-	s.asSet = options.asSet
 	s.NGTree = options.nGTrees
-	if err := s.CalculateQuartetTotals(td, options.asSet, nprocs); err != nil {
+	if err := s.initQuartetTotals(td, options, nprocs); err != nil {
 		return err
 	}
 	var err error
-	if s.penalties, err = CalculateEdgePenalties(td, nprocs); err != nil {
+	if td.HasOccupancy() && !options.asSet {
+		s.occupancy, err = edgeOccupancies(td, options, nprocs)
+		return err
+	}
+	if s.penalties, err = edgePenalties(td, options, nprocs); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (s NormalizedScorer) CalcScore(u, w int, td *gr.TreeData) float64 {
+	if s.occupancy != nil {
+		if s.occupancy[u][w] == 0 {
+			return 0
+		}
+		return float64(s.quartetTotals[u][w]) / float64(s.occupancy[u][w])
+	}
 	return float64(s.quartetTotals[u][w]) / (float64(s.NGTree) * float64(s.penalties[u][w]))
 }
 
@@ -106,6 +191,7 @@ type SymDiffScorer struct {
 	QuartetTotals
 	NGTree    int
 	Alpha     float64
+	Scale     PenaltyScale // scales alpha by the cycle length of each edge
 	penalties [][]uint64
 }
 
@@ -120,6 +206,15 @@ func WithAlpha(alpha float64) ScoreOptions {
 	}
 }
 
+// Scales the "sym" penalty by the cycle length of each edge (FlatPenalty if
+// nil)
+func WithPenaltyScale(scale PenaltyScale) ScoreOptions {
+	return func(options *scorerOpts) error {
+		options.scale = scale
+		return nil
+	}
+}
+
 func (s *SymDiffScorer) Init(td *gr.TreeData, nprocs int, opts ...ScoreOptions) error {
 	var options scorerOpts
 	for _, opt := range opts {
@@ -127,18 +222,22 @@ func (s *SymDiffScorer) Init(td *gr.TreeData, nprocs int, opts ...ScoreOptions)
 			return err
 		}
 	}
-	s.asSet = options.asSet
+	s.NGTree = options.nGTrees
 	s.Alpha = options.alpha
-	if err := s.CalculateQuartetTotals(td, options.asSet, nprocs); err != nil {
+	if s.Scale = options.scale; s.Scale == nil {
+		s.Scale = FlatPenalty{}
+	}
+	if err := s.initQuartetTotals(td, options, nprocs); err != nil {
 		return err
 	}
 	var err error
-	if s.penalties, err = CalculateEdgePenalties(td, nprocs); err != nil {
+	if s.penalties, err = edgePenalties(td, options, nprocs); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (s SymDiffScorer) CalcScore(u, w int, td *gr.TreeData) float64 {
-	return 2*float64(s.quartetTotals[u][w]) - s.Alpha*float64(s.penalties[u][w])*float64(s.NGTree)
+	alpha := s.Alpha * s.Scale.Scale(CycleLength(u, w, td))
+	return 2*float64(s.quartetTotals[u][w]) - alpha*float64(s.penalties[u][w])*float64(s.NGTree)
 }
@@ -21,7 +21,7 @@ func makeTreeData(t *testing.T, nwk string) *gr.TreeData {
 		t.Fatalf("failed to update tip index: %v", err)
 	}
 	tips := tre.AllTipNames()
-	qCounts := make(map[gr.Quartet]uint32)
+	qCounts := gr.NewQuartetTable(0)
 	if len(tips) >= 4 {
 		patterns := []string{
 			"((%s,%s),(%s,%s));",
@@ -38,7 +38,7 @@ func makeTreeData(t *testing.T, nwk string) *gr.TreeData {
 			if err != nil {
 				t.Fatalf("failed to map quartet: %v", err)
 			}
-			qCounts[quartet] = 1
+			qCounts.Set(quartet, 1)
 		}
 	}
 	return gr.MakeTreeData(tre, qCounts)
@@ -91,6 +91,55 @@ func TestParseScorerMap(t *testing.T) {
 	}
 }
 
+func TestNewScorer(t *testing.T) {
+	for name, shared := range ParseScorer {
+		scorer, ok := NewScorer(name)
+		if !ok {
+			t.Fatalf("missing scorer for key %s", name)
+		}
+		if scorer == shared {
+			t.Errorf("NewScorer(%s) returned the shared scorer", name)
+		}
+		if ScorerName(scorer) != name {
+			t.Errorf("NewScorer(%s) has score mode %s", name, ScorerName(scorer))
+		}
+	}
+	if _, ok := NewScorer("bad"); ok {
+		t.Fatalf("unexpected scorer for invalid key")
+	}
+}
+
+func TestScorerDescriptions(t *testing.T) {
+	for name := range ParseScorer {
+		if ScorerDescriptions[name] == "" {
+			t.Errorf("score mode %s has no description", name)
+		}
+	}
+	if len(ScorerDescriptions) != len(ParseScorer) {
+		t.Errorf("%d descriptions for %d score modes", len(ScorerDescriptions), len(ParseScorer))
+	}
+}
+
+func TestFormatScore(t *testing.T) {
+	testCases := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{name: "uint64", got: FormatScore(uint64(1<<53 + 1)), expected: "9007199254740993"},
+		{name: "int64", got: FormatScore(int64(-42)), expected: "-42"},
+		{name: "float64", got: FormatScore(0.125), expected: "0.125"},
+		{name: "whole float64", got: FormatScore(3.0), expected: "3"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if test.got != test.expected {
+				t.Errorf("got %s, expected %s", test.got, test.expected)
+			}
+		})
+	}
+}
+
 func TestWithNGtrees(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -209,9 +258,11 @@ func TestSymDiffScorerInit(t *testing.T) {
 		name    string
 		options []ScoreOptions
 		alpha   float64
+		scale   PenaltyScale
 		wantErr bool
 	}{
-		{name: "valid", options: []ScoreOptions{WithAlpha(0.2)}, alpha: 0.2},
+		{name: "valid", options: []ScoreOptions{WithNGtrees(3), WithAlpha(0.2)}, alpha: 0.2, scale: FlatPenalty{}},
+		{name: "penalty scale", options: []ScoreOptions{WithNGtrees(3), WithAlpha(0.2), WithPenaltyScale(LinearPenalty{})}, alpha: 0.2, scale: LinearPenalty{}},
 		{name: "invalid option", options: []ScoreOptions{WithAlpha(0)}, wantErr: true},
 	}
 	for _, tc := range testCases {
@@ -231,6 +282,12 @@ func TestSymDiffScorerInit(t *testing.T) {
 			if scorer.Alpha != tc.alpha {
 				t.Fatalf("Alpha = %f, want %f", scorer.Alpha, tc.alpha)
 			}
+			if scorer.Scale != tc.scale {
+				t.Fatalf("Scale = %T, want %T", scorer.Scale, tc.scale)
+			}
+			if scorer.NGTree != 3 {
+				t.Fatalf("NGTree = %d, want 3", scorer.NGTree)
+			}
 			if !verifyQuartetTotals(t, td, scorer.quartetTotals) {
 				t.Fatalf("expected non-zero quartet totals for %s", tc.name)
 			}
@@ -253,7 +310,7 @@ func verifyQuartetTotals(t *testing.T, td *gr.TreeData, totals [][]uint64) bool
 		}
 		for w := range totals[u] {
 			val := totals[u][w]
-			if ShouldCalcEdge(u, w, td) {
+			if DefaultEdgePolicy.Allows(u, w, td) {
 				if val > 0 {
 					positive = true
 				}
@@ -278,9 +335,47 @@ func verifyPenalties(t *testing.T, td *gr.TreeData, penalties [][]uint64) {
 			t.Fatalf("penalties row %d length = %d, want %d", u, len(penalties[u]), n)
 		}
 		for w := range penalties[u] {
-			if ShouldCalcEdge(u, w, td) && penalties[u][w] == 0 {
+			if DefaultEdgePolicy.Allows(u, w, td) && penalties[u][w] == 0 {
 				t.Fatalf("expected penalty for edge %d->%d", u, w)
 			}
 		}
 	}
 }
+
+func TestNormalizedScorer_Occupancy(t *testing.T) {
+	quartets := []quartetCount{{nwk: "((A,C),(B,D));", count: 2}}
+	occupied := makeTreeDataWithQuartets(t, "((A,B),(C,D));", quartets)
+	occupancy := gr.NewQuartetTable(0)
+	qTree, err := newick.NewParser(strings.NewReader("((A,C),(B,D));")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick quartet; test is written wrong")
+	}
+	q, err := gr.NewQuartet(qTree, &occupied.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	occupancy.Set(q.TaxaSet(), 2) // only two of the five gene trees have all four taxa
+	occupied.SetOccupancy(occupancy)
+	testCases := []struct {
+		name     string
+		td       *gr.TreeData
+		asSet    bool
+		expected float64
+	}{
+		{name: "gene trees", td: makeTreeDataWithQuartets(t, "((A,B),(C,D));", quartets), expected: 2.0 / (5 * 25)}, // see TestCalculatePenalty
+		{name: "occupancy", td: occupied, expected: 1},
+		{name: "occupancy as set", td: occupied, asSet: true, expected: 1.0 / (5 * 25)},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var s NormalizedScorer
+			if err := s.Init(test.td, 1, WithNGtrees(5), AsSet(test.asSet)); err != nil {
+				t.Fatal(err)
+			}
+			u, w := nodeIDByLabel(t, test.td, "A"), nodeIDByLabel(t, test.td, "C")
+			if got := s.CalcScore(u, w, test.td); got != test.expected {
+				t.Errorf("got %f, expected %f", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Width of the bar, in characters between the brackets
+const barWidth = 30
+
+// Progress bar for a terminal, redrawn in place with the current phase, its
+// percent done, and the estimated time left (from how long the phase has taken
+// so far). Log messages written to the same terminal should go through Writer,
+// which moves the bar below them.
+type Bar struct {
+	mu    sync.Mutex
+	w     io.Writer
+	shown bool // whether the bar is on the last line of w
+	line  string
+}
+
+// Starts drawing a progress bar to w (which should be a terminal) every
+// interval, until Stop is called, which clears it
+func (m *Monitor) ShowBar(w io.Writer, interval time.Duration) *Bar {
+	b := &Bar{w: w}
+	m.mu.Lock()
+	m.bar = b
+	m.mu.Unlock()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.mu.Lock()
+				line := m.barLine(time.Now())
+				m.mu.Unlock()
+				b.draw(line)
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// Line drawn for the current phase at now; m.mu must be held
+func (m *Monitor) barLine(now time.Time) string {
+	var p *phase
+	for i := len(m.phases) - 1; i >= 0; i-- {
+		if m.phases[i].end.IsZero() {
+			p = &m.phases[i]
+			break
+		}
+	}
+	if p == nil {
+		return ""
+	}
+	elapsed := now.Sub(p.start)
+	if !m.hasPercent {
+		return fmt.Sprintf("%s %s", p.name, elapsed.Round(time.Second))
+	}
+	filled := min(int(m.percent/100*barWidth), barWidth)
+	line := fmt.Sprintf("%s [%s%s] %5.1f%%", p.name, strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), m.percent)
+	if eta, ok := estimateLeft(elapsed, m.percent); ok {
+		line += fmt.Sprintf(" %s left", eta.Round(time.Second))
+	}
+	if m.hasBest {
+		line += fmt.Sprintf(" (k = %d, score %g)", m.k, m.best)
+	}
+	return line
+}
+
+// Time left for a phase that has taken elapsed to get percent done, assuming
+// the rest goes at the same rate. Not known until some of the phase is done.
+func estimateLeft(elapsed time.Duration, percent float64) (time.Duration, bool) {
+	if percent <= 0 || percent > 100 {
+		return 0, false
+	}
+	return time.Duration(float64(elapsed) * (100 - percent) / percent), true
+}
+
+// Redraws the bar as line (clearing it if line is empty)
+func (b *Bar) draw(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.line = line
+	b.redraw()
+}
+
+// Clears the bar for good; b.mu must not be held
+func (b *Bar) clear() {
+	b.draw("")
+}
+
+// Writes the bar over the last line of w; b.mu must be held
+func (b *Bar) redraw() {
+	if b.line == "" && !b.shown {
+		return
+	}
+	fmt.Fprintf(b.w, "\r%s\033[K", b.line) // nolint (nothing to do if the terminal goes away)
+	b.shown = b.line != ""
+}
+
+// Writer for log messages to the terminal the bar is on, which clears the bar
+// before each message and draws it again after
+func (b *Bar) Writer(w io.Writer) io.Writer {
+	return barWriter{bar: b, w: w}
+}
+
+type barWriter struct {
+	bar *Bar
+	w   io.Writer
+}
+
+func (bw barWriter) Write(p []byte) (int, error) {
+	bw.bar.mu.Lock()
+	defer bw.bar.mu.Unlock()
+	if bw.bar.shown {
+		fmt.Fprint(bw.bar.w, "\r\033[K") // nolint
+		bw.bar.shown = false
+	}
+	n, err := bw.w.Write(p)
+	bw.bar.redraw()
+	return n, err
+}
@@ -0,0 +1,123 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+)
+
+// Progress of a run at a point in time, written as one line of json by
+// EmitProgress
+type Event struct {
+	Time      time.Time `json:"time"`
+	Elapsed   float64   `json:"elapsed_seconds"`
+	Phase     string    `json:"phase"`      // most recently started phase still running ("" if none)
+	Percent   *float64  `json:"percent"`    // percent of the phase done (null if the phase does not report it)
+	K         int       `json:"k"`          // edges in the best network found so far by the dp in this phase
+	BestScore *float64  `json:"best_score"` // score of that network (null before the dp finds one)
+	Done      bool      `json:"done"`       // true for the last event, written when the monitor stops
+}
+
+// Starts writing progress events to w, one json object per line, every
+// interval and whenever a phase starts or ends, until Stop is called (which
+// writes a last event with Done set). Writing stops, with a warning, on the
+// first error (e.g., if the reader goes away).
+func (m *Monitor) EmitProgress(w io.Writer, interval time.Duration) {
+	m.mu.Lock()
+	m.progressOut = json.NewEncoder(w)
+	m.mu.Unlock()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.emit(false)
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Sets the progress of the current phase of the default monitor to done out
+// of total. Does nothing if no monitor has been started.
+func Progress(done, total int) {
+	if m := current(); m != nil && total > 0 {
+		m.mu.Lock()
+		m.percent = 100 * float64(done) / float64(total)
+		m.hasPercent = true
+		m.mu.Unlock()
+	}
+}
+
+// Records the best network found so far by the dp of the current phase of the
+// default monitor, with k edges and score. Does nothing if no monitor has been
+// started.
+func Score(k int, score float64) {
+	if m := current(); m != nil {
+		m.mu.Lock()
+		m.k, m.best, m.hasBest = k, score, true
+		m.mu.Unlock()
+	}
+}
+
+// Resets the progress reported for the previous phase; m.mu must be held
+func (m *Monitor) resetProgress() {
+	m.percent, m.hasPercent = 0, false
+	m.k, m.best, m.hasBest = 0, 0, false
+}
+
+// Writes a progress event if EmitProgress was called
+func (m *Monitor) emit(done bool) {
+	m.mu.Lock()
+	if m.progressOut == nil {
+		m.mu.Unlock()
+		return
+	}
+	err := m.progressOut.Encode(m.event(done))
+	if err != nil {
+		m.progressOut = nil
+	}
+	m.mu.Unlock()
+	if err != nil { // logged without m.mu held, since -log-json reads the monitor
+		lg.Warnf("stopped writing progress events, %s", err)
+	}
+}
+
+// Progress of the default monitor right now, and false if no monitor has been
+// started
+func CurrentEvent() (Event, bool) {
+	m := current()
+	if m == nil {
+		return Event{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.event(false), true
+}
+
+// Progress event for now; m.mu must be held
+func (m *Monitor) event(done bool) Event {
+	now := time.Now()
+	ev := Event{Time: now, Elapsed: now.Sub(m.start).Seconds(), K: m.k, Done: done}
+	for i := len(m.phases) - 1; i >= 0; i-- {
+		if m.phases[i].end.IsZero() {
+			ev.Phase = m.phases[i].name
+			break
+		}
+	}
+	if m.hasPercent {
+		percent := m.percent
+		ev.Percent = &percent
+	}
+	if m.hasBest {
+		best := m.best
+		ev.BestScore = &best
+	}
+	return ev
+}
@@ -0,0 +1,12 @@
+package telemetry
+
+import "syscall"
+
+// Returns peak resident set size in bytes
+func peakRSS() uint64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return uint64(usage.Maxrss) * 1024 // linux reports kilobytes
+}
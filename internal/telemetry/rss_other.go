@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package telemetry
+
+// Peak resident set size is not available on this platform
+func peakRSS() uint64 {
+	return 0
+}
@@ -0,0 +1,210 @@
+// Package for recording runtime resource usage (memory, goroutines, garbage
+// collection, and wall clock time of each phase) and reporting it in the log
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+)
+
+// Records resource usage for a run
+type Monitor struct {
+	mu       sync.Mutex
+	start    time.Time
+	phases   []phase // completed and running phases in order of start time
+	peakHeap uint64  // largest heap size seen while sampling
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	progressOut *json.Encoder // where progress events are written (nil if not emitting)
+	bar         *Bar          // progress bar (nil if not shown)
+	percent     float64       // percent of the current phase done, if hasPercent
+	hasPercent  bool
+	k           int     // edges in the best network found by the dp in the current phase
+	best        float64 // score of that network, if hasBest
+	hasBest     bool
+}
+
+type phase struct {
+	name  string
+	start time.Time
+	end   time.Time
+}
+
+// Resource usage at a point in time
+type Sample struct {
+	RSS        uint64        // peak resident set size of the process (0 if unsupported)
+	Heap       uint64        // bytes of allocated heap objects
+	Sys        uint64        // bytes obtained from the OS by the go runtime
+	Goroutines int           // number of goroutines
+	NumGC      uint32        // number of completed gc cycles
+	PauseTotal time.Duration // cumulative gc pause time
+}
+
+var (
+	defaultMu      sync.Mutex
+	defaultMonitor *Monitor
+)
+
+// Starts monitor and sets it as the default monitor used by Phase. If interval
+// is positive, resource usage is logged every interval until Stop is called.
+func Start(interval time.Duration) *Monitor {
+	m := &Monitor{start: time.Now(), done: make(chan struct{})}
+	if interval > 0 {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					lg.Infof("telemetry: %s", m.sample())
+				case <-m.done:
+					return
+				}
+			}
+		}()
+	}
+	defaultMu.Lock()
+	defaultMonitor = m
+	defaultMu.Unlock()
+	return m
+}
+
+// Marks the beginning of a phase on the default monitor; the returned function
+// marks its end. Does nothing if no monitor has been started.
+func Phase(name string) (end func()) {
+	m := current()
+	if m == nil {
+		return func() {}
+	}
+	return m.Phase(name)
+}
+
+// Default monitor (nil if none has been started)
+func current() *Monitor {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultMonitor
+}
+
+// Marks the beginning of a phase; the returned function marks its end
+func (m *Monitor) Phase(name string) (end func()) {
+	m.mu.Lock()
+	i := len(m.phases)
+	m.phases = append(m.phases, phase{name: name, start: time.Now()})
+	m.resetProgress()
+	m.mu.Unlock()
+	m.emit(false)
+	return func() {
+		m.emit(false) // last progress of the phase
+		m.mu.Lock()
+		m.phases[i].end = time.Now()
+		m.mu.Unlock()
+		m.sample() // keep track of peak heap at phase boundaries
+	}
+}
+
+// Wall clock time of a phase
+type Timing struct {
+	Phase    string
+	Duration time.Duration
+}
+
+// Time taken by each phase of the default monitor so far, in order of start
+// time (phases that are still running are timed up to now). Returns nil if no
+// monitor has been started.
+func Timings() []Timing {
+	m := current()
+	if m == nil {
+		return nil
+	}
+	return m.Timings()
+}
+
+// Time taken by each phase so far, in order of start time (phases that are
+// still running are timed up to now)
+func (m *Monitor) Timings() []Timing {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	timings := make([]Timing, len(m.phases))
+	for i, p := range m.phases {
+		timings[i] = Timing{Phase: p.name, Duration: p.duration()}
+	}
+	return timings
+}
+
+// Time from the start to the end of the phase, or to now if it is running
+func (p phase) duration() time.Duration {
+	end := p.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(p.start)
+}
+
+// Stops periodic logging (and progress events) and logs a summary of resource usage. The monitor is
+// no longer the default after it is stopped.
+func (m *Monitor) Stop() {
+	close(m.done)
+	m.wg.Wait()
+	defaultMu.Lock()
+	if defaultMonitor == m {
+		defaultMonitor = nil
+	}
+	defaultMu.Unlock()
+	m.emit(true)
+	if m.bar != nil { // nothing else draws it once the monitor is done
+		m.bar.clear()
+	}
+	s := m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lg.Infof("telemetry summary: wall clock %s, peak rss %s, peak heap %s, %d gc cycles (%s paused)",
+		time.Since(m.start).Round(time.Millisecond), FormatBytes(s.RSS), FormatBytes(m.peakHeap), s.NumGC, s.PauseTotal)
+	for _, p := range m.phases {
+		lg.Infof("telemetry summary: phase %q took %s", p.name, p.duration().Round(time.Millisecond))
+	}
+}
+
+// Takes sample of current resource usage
+func (m *Monitor) sample() Sample {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	m.mu.Lock()
+	m.peakHeap = max(m.peakHeap, stats.HeapAlloc)
+	m.mu.Unlock()
+	return Sample{
+		RSS:        peakRSS(),
+		Heap:       stats.HeapAlloc,
+		Sys:        stats.Sys,
+		Goroutines: runtime.NumGoroutine(),
+		NumGC:      stats.NumGC,
+		PauseTotal: time.Duration(stats.PauseTotalNs),
+	}
+}
+
+func (s Sample) String() string {
+	return fmt.Sprintf("peak rss %s, heap %s, sys %s, %d goroutines, %d gc cycles (%s paused)",
+		FormatBytes(s.RSS), FormatBytes(s.Heap), FormatBytes(s.Sys), s.Goroutines, s.NumGC, s.PauseTotal)
+}
+
+// Formats number of bytes as human readable string (e.g., 1.5 MiB)
+func FormatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
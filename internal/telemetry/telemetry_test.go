@@ -0,0 +1,180 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+	m := Start(time.Millisecond)
+	end := Phase("first")
+	time.Sleep(5 * time.Millisecond)
+	end()
+	Phase("second")()
+	running := Phase("running")
+	timings := Timings()
+	if len(timings) != 3 {
+		t.Fatalf("got %d timings, expected 3", len(timings))
+	}
+	for i, name := range []string{"first", "second", "running"} {
+		if timings[i].Phase != name {
+			t.Errorf("timing %d is for phase %q, expected %q", i, timings[i].Phase, name)
+		}
+	}
+	if timings[0].Duration < 5*time.Millisecond {
+		t.Errorf("phase \"first\" took %s, expected at least 5ms", timings[0].Duration)
+	}
+	running()
+	m.Stop()
+	Phase("after stop")() // should be a no-op
+	if Timings() != nil {
+		t.Error("expected no timings after stop")
+	}
+	output := buf.String()
+	for _, exp := range []string{"telemetry: peak rss", "telemetry summary: wall clock", `phase "first"`, `phase "second"`} {
+		if !strings.Contains(output, exp) {
+			t.Errorf("log output does not contain %q:\n%s", exp, output)
+		}
+	}
+	if strings.Contains(output, "after stop") {
+		t.Errorf("phase started after stop was recorded:\n%s", output)
+	}
+}
+
+func TestEmitProgress(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := Start(0)
+	m.EmitProgress(buf, time.Hour) // only events at phase starts and stop
+	end := Phase("dp")
+	Progress(1, 4)
+	Score(2, 10)
+	end()
+	Phase("output")()
+	m.Stop()
+	var events []Event
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var ev Event
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("invalid event: %s", err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 5 {
+		t.Fatalf("got %d events, expected 5", len(events))
+	}
+	if ev := events[0]; ev.Phase != "dp" || ev.Percent != nil || ev.BestScore != nil || ev.Done {
+		t.Errorf("first event %+v, expected start of dp phase with no progress", ev)
+	}
+	if ev := events[1]; ev.Phase != "dp" || ev.Percent == nil || *ev.Percent != 25 || ev.K != 2 || ev.BestScore == nil || *ev.BestScore != 10 {
+		t.Errorf("second event %+v, expected end of dp phase at 25 percent with k 2 and score 10", ev)
+	}
+	if ev := events[2]; ev.Phase != "output" || ev.K != 0 || ev.BestScore != nil {
+		t.Errorf("third event %+v, expected progress reset at start of output phase", ev)
+	}
+	if ev := events[4]; !ev.Done || ev.Phase != "" {
+		t.Errorf("last event %+v, expected done with no running phase", ev)
+	}
+	Progress(1, 2) // should be a no-op after stop
+}
+
+func TestFormatBytes(t *testing.T) {
+	testCases := []struct {
+		bytes    uint64
+		expected string
+	}{
+		{bytes: 0, expected: "0 B"},
+		{bytes: 1023, expected: "1023 B"},
+		{bytes: 1536, expected: "1.5 KiB"},
+		{bytes: 3 << 30, expected: "3.0 GiB"},
+	}
+	for _, test := range testCases {
+		if result := FormatBytes(test.bytes); result != test.expected {
+			t.Errorf("FormatBytes(%d) = %s, expected %s", test.bytes, result, test.expected)
+		}
+	}
+}
+
+func TestCurrentEvent(t *testing.T) {
+	if _, ok := CurrentEvent(); ok {
+		t.Fatal("expected no event before a monitor is started")
+	}
+	m := Start(0)
+	end := Phase("dp")
+	Score(3, 7)
+	ev, ok := CurrentEvent()
+	if !ok || ev.Phase != "dp" || ev.K != 3 || ev.BestScore == nil || *ev.BestScore != 7 {
+		t.Errorf("got event %+v, expected dp phase with k 3 and score 7", ev)
+	}
+	Score(4, 9)
+	if *ev.BestScore != 7 {
+		t.Error("event should not change after it is taken")
+	}
+	end()
+	m.Stop()
+	if _, ok := CurrentEvent(); ok {
+		t.Error("expected no event after the monitor is stopped")
+	}
+}
+
+func TestEstimateLeft(t *testing.T) {
+	testCases := []struct {
+		name     string
+		elapsed  time.Duration
+		percent  float64
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "none done", elapsed: time.Minute, percent: 0, ok: false},
+		{name: "quarter done", elapsed: time.Minute, percent: 25, expected: 3 * time.Minute, ok: true},
+		{name: "half done", elapsed: time.Minute, percent: 50, expected: time.Minute, ok: true},
+		{name: "all done", elapsed: time.Minute, percent: 100, expected: 0, ok: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			left, ok := estimateLeft(test.elapsed, test.percent)
+			if ok != test.ok || left != test.expected {
+				t.Errorf("got %s, %t, expected %s, %t", left, ok, test.expected, test.ok)
+			}
+		})
+	}
+}
+
+func TestBar(t *testing.T) {
+	m := Start(0)
+	var buf bytes.Buffer
+	bar := m.ShowBar(&buf, time.Hour)
+	end := m.Phase("dp")
+	Progress(1, 2)
+	Score(2, 5)
+	m.mu.Lock()
+	line := m.barLine(m.phases[0].start.Add(time.Minute))
+	m.mu.Unlock()
+	expected := "dp [===============               ]  50.0% 1m0s left (k = 2, score 5)"
+	if line != expected {
+		t.Errorf("got bar %q, expected %q", line, expected)
+	}
+	bar.draw(line)
+	w := bar.Writer(&buf)
+	if _, err := w.Write([]byte("message\n")); err != nil {
+		t.Fatal(err)
+	}
+	end()
+	m.Stop()
+	expected = "\r" + line + "\033[K" + "\r\033[K" + "message\n" + "\r" + line + "\033[K" + "\r\033[K"
+	if buf.String() != expected {
+		t.Errorf("got output %q, expected %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Writer that drops log messages above its level. The log package makes a
+// single Write call per message, so each write is classified as a whole.
+type levelWriter struct {
+	w     io.Writer
+	level lg.Level
+}
+
+func newLevelWriter(w io.Writer, level lg.Level) io.Writer {
+	if level == lg.None {
+		return io.Discard
+	}
+	return &levelWriter{w: w, level: level}
+}
+
+// Writer for log messages up to level, as json lines (see logRecord) if
+// asJSON is set
+func newLogWriter(w io.Writer, level lg.Level, asJSON bool) io.Writer {
+	if asJSON {
+		w = newJSONLogWriter(w)
+	}
+	return newLevelWriter(w, level)
+}
+
+func (lw *levelWriter) Write(p []byte) (int, error) {
+	if lg.MessageLevel(p) > lw.level {
+		return len(p), nil
+	}
+	return lw.w.Write(p)
+}
+
+// Log message written as one line of json with -log-json. Stage, k, score, and
+// elapsed come from the telemetry monitor (see tm.Event), and are left out
+// before it is started.
+type logRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"msg"`
+	Stage   string    `json:"stage,omitempty"`
+	K       *int      `json:"k,omitempty"`
+	Score   *float64  `json:"score,omitempty"`
+	Elapsed *float64  `json:"elapsed_seconds,omitempty"`
+}
+
+// Writer that turns each log message into a logRecord
+type jsonLogWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONLogWriter(w io.Writer) io.Writer {
+	return &jsonLogWriter{enc: json.NewEncoder(w)}
+}
+
+func (jw *jsonLogWriter) Write(p []byte) (int, error) {
+	level, msg := lg.SplitMessage(p)
+	rec := logRecord{Time: time.Now(), Level: level.String(), Message: msg}
+	if ev, ok := tm.CurrentEvent(); ok {
+		rec.Stage, rec.Score, rec.Elapsed = ev.Phase, ev.BestScore, &ev.Elapsed
+		if ev.BestScore != nil {
+			rec.K = &ev.K
+		}
+	}
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	if err := jw.enc.Encode(rec); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Writes buffered log messages (logged before the log file was opened) to w,
+// filtered by level
+func writeBufferedLog(buf *bytes.Buffer, w io.Writer) {
+	for line := range strings.Lines(buf.String()) {
+		w.Write([]byte(line)) // nolint
+	}
+}
+
+// Warnings logged by the infer command
+var loggedWarnings warningCounter
+
+// Writer that counts logged warnings (for -fail-on-warning) and discards
+// everything written to it
+type warningCounter struct {
+	n atomic.Int64
+}
+
+func (wc *warningCounter) Write(p []byte) (int, error) {
+	if lg.MessageLevel(p) == lg.Warn {
+		wc.n.Add(1)
+	}
+	return len(p), nil
+}
+
+func (wc *warningCounter) count() int {
+	return int(wc.n.Load())
+}
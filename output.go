@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	tm "github.com/jsdoublel/camus/internal/telemetry"
+)
+
+// Formats for the optimal networks written to stdout and the results file
+const (
+	outFormatCSV      = "csv"
+	outFormatJSON     = "json"
+	outFormatNexus    = "nexus"
+	outFormatPhyloXML = "phyloxml"
+)
+
+var outFormats = []string{outFormatCSV, outFormatJSON, outFormatNexus, outFormatPhyloXML}
+
+// Output files that CAMUS may write
+type outputFile int
+
+const (
+	logOutput outputFile = iota
+	resultsOutput
+	plotOutput
+	qChangesOutput
+	networksOutput
+	reticulationsOutput
+	alternativesOutput
+	overlapsOutput
+	embeddingOutput
+	geneContribsOutput
+	concordanceOutput
+	concNewickOutput
+	influenceOutput
+	jackknifeOutput
+	exclusionOutput
+	nullOutput
+	filterFreqOutput
+	filterTaxaOutput
+	collapsedOutput
+	kStatsOutput
+	branchScoresOutput
+	modesOutput
+	modesPlotOutput
+	bootstrapOutput
+	partitionsOutput
+	bipartitionsOutput
+	minorFreqOutput
+	sweepOutput
+	conservativeOutput
+	candidatesOutput
+	coOptimalOutput
+	nearOptimalOutput
+	resultsJSONOutput
+	resultsNexusOutput
+	resultsPhyloXMLOutput
+	invalidTreesOutput
+	manifestOutput
+)
+
+// File names used with -outdir
+var outdirNames = map[outputFile]string{
+	logOutput:             "camus.log",
+	resultsOutput:         "results.csv",
+	plotOutput:            "qsat.png",
+	qChangesOutput:        "qchanges.csv",
+	networksOutput:        "networks.nwk",
+	reticulationsOutput:   "reticulations.csv",
+	alternativesOutput:    "alternatives.csv",
+	overlapsOutput:        "overlaps.csv",
+	embeddingOutput:       "embedding.csv",
+	geneContribsOutput:    "gene_contributions.csv",
+	concordanceOutput:     "concordance.csv",
+	concNewickOutput:      "concordance.nwk",
+	influenceOutput:       "influence.csv",
+	jackknifeOutput:       "jackknife.csv",
+	exclusionOutput:       "exclusion.csv",
+	nullOutput:            "null.csv",
+	filterFreqOutput:      "filter_frequencies.csv",
+	filterTaxaOutput:      "filter_taxa.csv",
+	collapsedOutput:       "collapsed.csv",
+	kStatsOutput:          "kstats.csv",
+	branchScoresOutput:    "branch_scores.csv",
+	modesOutput:           "modes.csv",
+	modesPlotOutput:       "modes.png",
+	bootstrapOutput:       "bootstrap.csv",
+	partitionsOutput:      "partitions.csv",
+	bipartitionsOutput:    "bipartitions.csv",
+	minorFreqOutput:       "minor_freq.csv",
+	sweepOutput:           "threshold_sweep.csv",
+	conservativeOutput:    "conservative.nwk",
+	candidatesOutput:      "candidates.csv",
+	coOptimalOutput:       "co_optimal.nwk",
+	nearOptimalOutput:     "near_optimal.csv",
+	resultsJSONOutput:     "results.json",
+	resultsNexusOutput:    "results.nex",
+	resultsPhyloXMLOutput: "results.xml",
+	invalidTreesOutput:    "invalid_trees.csv",
+	manifestOutput:        "manifest.json",
+}
+
+// Suffixes appended to the output prefix when -outdir is not used; files
+// without a suffix are only written to output directories
+var prefixSuffixes = map[outputFile]string{
+	logOutput:             ".log",
+	resultsOutput:         ".csv",
+	plotOutput:            ".png",
+	qChangesOutput:        "_qchanges.csv",
+	reticulationsOutput:   "_reticulations.csv",
+	alternativesOutput:    "_alternatives.csv",
+	overlapsOutput:        "_overlaps.csv",
+	embeddingOutput:       "_embedding.csv",
+	geneContribsOutput:    "_gene_contributions.csv",
+	concordanceOutput:     "_concordance.csv",
+	concNewickOutput:      "_concordance.nwk",
+	influenceOutput:       "_influence.csv",
+	jackknifeOutput:       "_jackknife.csv",
+	exclusionOutput:       "_exclusion.csv",
+	nullOutput:            "_null.csv",
+	filterFreqOutput:      "_filter_frequencies.csv",
+	filterTaxaOutput:      "_filter_taxa.csv",
+	collapsedOutput:       "_collapsed.csv",
+	kStatsOutput:          "_kstats.csv",
+	branchScoresOutput:    "_branch_scores.csv",
+	modesOutput:           "_modes.csv",
+	modesPlotOutput:       "_modes.png",
+	bootstrapOutput:       "_bootstrap.csv",
+	partitionsOutput:      "_partitions.csv",
+	bipartitionsOutput:    "_bipartitions.csv",
+	minorFreqOutput:       "_minor_freq.csv",
+	sweepOutput:           "_threshold_sweep.csv",
+	conservativeOutput:    "_conservative.nwk",
+	candidatesOutput:      "_candidates.csv",
+	coOptimalOutput:       "_co_optimal.nwk",
+	nearOptimalOutput:     "_near_optimal.csv",
+	resultsJSONOutput:     ".json",
+	resultsNexusOutput:    ".nex",
+	resultsPhyloXMLOutput: ".xml",
+	invalidTreesOutput:    "_invalid_trees.csv",
+}
+
+var outputDescriptions = map[outputFile]string{
+	logOutput:             "log",
+	resultsOutput:         "optimal networks, percent of quartets satisfied, and dp score for each number of edges",
+	plotOutput:            "plot of quartets not satisfied for each number of edges",
+	qChangesOutput:        "quartets gained and lost between consecutive numbers of edges",
+	networksOutput:        "optimal networks in extended newick format, one per number of edges",
+	reticulationsOutput:   "constraint tree branches for each reticulation label used in the networks",
+	alternativesOutput:    "best branches not chosen for each network and the score when swapped in",
+	overlapsOutput:        "strong branches left out of the largest network because their cycles overlap chosen cycles",
+	embeddingOutput:       "fraction of each gene tree's quartets displayed by each tree displayed by the largest network",
+	geneContribsOutput:    "quartets of each gene tree supporting each reticulation of the largest network",
+	concordanceOutput:     "quartet concordance, differential, and informativeness of each constraint tree branch",
+	concNewickOutput:      "constraint tree with the quartet concordance of each branch in newick comments",
+	influenceOutput:       "ranking of gene trees by how much leaving them out changes the network",
+	jackknifeOutput:       "quartet support of each reticulation of the largest network left with each block of gene trees left out",
+	exclusionOutput:       "score of the largest network versus the best network of the same size without each reticulation",
+	nullOutput:            "score gain of each added edge next to gains from gene trees simulated without reticulation",
+	filterFreqOutput:      "sets of four taxa binned by frequency of their dominant quartet topology, and how many failed the filter threshold",
+	filterTaxaOutput:      "number of quartets removed by the quartet filter containing each taxon",
+	collapsedOutput:       "taxa collapsed into each representative during inference",
+	kStatsOutput:          "dp work and wall clock time for each number of edges",
+	branchScoresOutput:    "quartets satisfied by each branch given with -branches",
+	modesOutput:           "optimal networks found with each score mode given with -compare-modes",
+	modesPlotOutput:       "plot of quartets not satisfied for each score mode given with -compare-modes",
+	bootstrapOutput:       "fraction of bootstrap replicates containing each reticulation of the largest network",
+	partitionsOutput:      "quartet support for each reticulation of the largest network from the genes of each partition",
+	bipartitionsOutput:    "taxa moved by each reticulation, its donor clade, and the sister clade of the moved taxa",
+	minorFreqOutput:       "approximate minor quartet frequency of each reticulation, a rough proxy for gamma",
+	sweepOutput:           "percent of quartets satisfied by each reticulation of the largest network at each threshold given with -threshold-sweep",
+	conservativeOutput:    "largest network without the reticulations below -candidate-threshold, which are recorded as annotations on the backbone",
+	candidatesOutput:      "reticulations of the largest network below -candidate-threshold and the percent of quartets each satisfies on its own",
+	coOptimalOutput:       "distinct networks with the largest number of edges scoring the same as the optimal one",
+	nearOptimalOutput:     "networks scoring within -within percent of the optimal network with the same number of edges",
+	resultsJSONOutput:     "optimal networks with their branches, edge scores, and run metadata in json",
+	resultsNexusOutput:    "constraint tree and optimal networks in a nexus trees block with a translate table",
+	resultsPhyloXMLOutput: "constraint tree and optimal networks in phyloxml, with reticulations as hybridization clade relations",
+	invalidTreesOutput:    "gene trees skipped with -skip-invalid-trees and why they could not be read",
+	manifestOutput:        "list of output files",
+}
+
+var errOutdirNotEmpty = errors.New("output directory is not empty")
+
+// Decides where output files go, either a directory with fixed file names or
+// files starting with a prefix, and keeps track of what has been written.
+type outputLayout struct {
+	dir     string       // output directory (empty if using prefix)
+	prefix  string       // output prefix (used if dir is empty)
+	written []outputFile // files written so far, in order
+	started time.Time    // when the layout was made (about when the run started)
+}
+
+// Makes output layout, creating the output directory if needed. If neither
+// an output directory or prefix are given, a timestamped prefix is used.
+func newOutputLayout(dir, prefix string) (*outputLayout, error) {
+	if dir == "" {
+		if prefix == "" {
+			prefix = defaultPrefix()
+			lg.Infof("output prefix was not set, using \"%s\"", prefix)
+		}
+		return &outputLayout{prefix: prefix, started: time.Now()}, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 0 {
+		return nil, fmt.Errorf("%w: %s", errOutdirNotEmpty, dir)
+	}
+	return &outputLayout{dir: dir, started: time.Now()}, nil
+}
+
+// Path to output file; false if the file is not part of the layout
+func (o *outputLayout) path(f outputFile) (string, bool) {
+	if o.dir != "" {
+		return filepath.Join(o.dir, outdirNames[f]), true
+	}
+	suffix, ok := prefixSuffixes[f]
+	return o.prefix + suffix, ok
+}
+
+// Creates output file and writes to it using the write function. Files not
+// in the layout are skipped.
+func (o *outputLayout) write(f outputFile, write func(w io.Writer) error) error {
+	path, ok := o.path(f)
+	if !ok {
+		return nil
+	}
+	if err := writeFile(path, write); err != nil {
+		return err
+	}
+	o.record(f)
+	return nil
+}
+
+// Paths of the files written so far
+func (o *outputLayout) paths() []string {
+	paths := make([]string, 0, len(o.written))
+	for _, f := range o.written {
+		if path, ok := o.path(f); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Marks output file as written (for files not created with write)
+func (o *outputLayout) record(f outputFile) {
+	o.written = append(o.written, f)
+}
+
+type manifestEntry struct {
+	File        string `json:"file"`
+	Description string `json:"description"`
+}
+
+type manifest struct {
+	Version   string          `json:"version"`
+	Command   string          `json:"command"`
+	Seed      uint64          `json:"seed"`
+	Started   string          `json:"started,omitempty"`
+	Completed string          `json:"completed"`
+	Seconds   *float64        `json:"seconds,omitempty"` // wall clock time of the run (missing in older manifests)
+	Files     []manifestEntry `json:"files"`
+}
+
+// Writes manifest listing the files written (only for output directories)
+func (o *outputLayout) writeManifest(seed uint64) error {
+	now := time.Now()
+	seconds := now.Sub(o.started).Seconds()
+	m := manifest{
+		Version:   GetVersion(),
+		Command:   "camus " + strings.Join(os.Args[1:], " "),
+		Seed:      seed,
+		Started:   o.started.Local().Format(time.RFC3339),
+		Completed: now.Local().Format(time.RFC3339),
+		Seconds:   &seconds,
+		Files:     make([]manifestEntry, 0, len(o.written)+1),
+	}
+	for _, f := range append(o.written, manifestOutput) {
+		m.Files = append(m.Files, manifestEntry{File: outdirNames[f], Description: outputDescriptions[f]})
+	}
+	return o.write(manifestOutput, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
+
+// Creates file at path and writes to it using the write function
+func writeFile(path string, write func(w io.Writer) error) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := f.Close()
+		if closeErr != nil {
+			lg.Infof("error closing %s, %s", path, closeErr)
+		}
+	}()
+	return write(f)
+}
+
+// Metadata about the current run included in json output
+func runMetadata(args Args) pr.RunMetadata {
+	timings := tm.Timings()
+	phases := make([]pr.PhaseTiming, len(timings))
+	for i, t := range timings {
+		phases[i] = pr.PhaseTiming{Phase: t.Phase, Seconds: t.Duration.Seconds()}
+	}
+	return pr.RunMetadata{
+		Version: GetVersion(),
+		Command: strings.Join(append([]string{"camus"}, os.Args[1:]...), " "),
+		Flags:   args.flags,
+		Seed:    args.inferOpts.Seed,
+		Timings: phases,
+	}
+}
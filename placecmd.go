@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	in "github.com/jsdoublel/camus/internal/infer"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+type PlaceArgs struct {
+	networkFile  string    // level-1 network in extended newick format or infer results csv
+	k            int       // number of reticulations of network to use from results csv
+	geneTreeFile string    // gene trees containing the new taxa
+	gtFormat     pr.Format // gene tree file format
+	csvFile      string    // file to write placements to
+}
+
+func placeUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus place [flags]... <network_file> <gene_tree_file>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <network_file>\t\tlevel-1 network in extended newick format, or results csv from infer\n",
+		"  <gene_tree_file>\tgene tree newick file with taxa not in the network\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus place network.nwk gene-trees.nwk > placed.nwk\n",
+		"\tcamus place -csv placements.csv -k 2 infer-results.csv gene-trees.nwk > placed.nwk\n\n",
+	)
+}
+
+func parsePlaceArgs(arguments []string) PlaceArgs {
+	fs := flag.NewFlagSet("place", flag.ExitOnError)
+	fs.Usage = func() {
+		placeUsage(fs)
+	}
+	build := placeFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the place flags on fs, returning a function that checks them once
+// they are parsed and makes the PlaceArgs
+func placeFlags(fs *flag.FlagSet) func() PlaceArgs {
+	format, ok := pr.ParseFormat[DefaultFormat]
+	if !ok {
+		panic(fmt.Sprintf("bad default format %s", DefaultFormat))
+	}
+	fs.Var(&format, "f", "gene tree `format` [newick|nexus] (default \"newick\")")
+	k := fs.Int("k", -1, "number of reticulations of the network to use when reading a results csv (default largest)")
+	csvFile := fs.String("csv", "", "write the placement of each new taxon and its quartet support to `file`")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() PlaceArgs {
+		if *help {
+			placeUsage(fs)
+			os.Exit(0)
+		}
+		if fs.NArg() != 2 {
+			fmt.Fprint(os.Stderr, "two positional arguments required: <network_file> <gene_tree_file>\n\n") // nolint
+			placeUsage(fs)
+			os.Exit(exitUsage)
+		}
+		return PlaceArgs{
+			networkFile:  fs.Arg(0),
+			k:            *k,
+			geneTreeFile: fs.Arg(1),
+			gtFormat:     format,
+			csvFile:      *csvFile,
+		}
+	}
+}
+
+// Places taxa from gene trees onto network, writing the network to stdout
+func runPlace(args PlaceArgs) error {
+	ntw, geneTrees, err := readNetworkInputs(args.networkFile, args.k, args.geneTreeFile, args.gtFormat)
+	if err != nil {
+		return err
+	}
+	placements, err := in.PlaceTaxa(ntw, geneTrees.Trees)
+	if err != nil {
+		return err
+	}
+	if args.csvFile != "" {
+		err = writeFile(args.csvFile, func(w io.Writer) error {
+			return pr.WritePlacementsToCSV(placements, w)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Println(ntw.Newick())
+	return err
+}
+
+// Reads network from extended (or rich) newick file or infer results csv (if
+// the file ends in .csv), and gene trees
+func readNetworkInputs(networkFile string, k int, geneTreeFile string, format pr.Format) (*tree.Tree, *pr.GeneTrees, error) {
+	if strings.HasSuffix(strings.ToLower(networkFile), ".csv") {
+		return pr.ReadResultsInputFiles(networkFile, k, geneTreeFile, format)
+	}
+	tre, geneTrees, err := pr.ReadInputFiles(networkFile, geneTreeFile, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	rooted, err := pr.NormalizeRichNewick(tre)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rooted {
+		lg.Infof("network was unrooted; rooted it on the edge above the first child of its root")
+	}
+	n, err := pr.NormalizeHybridCopies(tre)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n != 0 {
+		lg.Infof("rewrote %d hybrid nodes written as two copies of the same clade", n)
+	}
+	return tre, geneTrees, nil
+}
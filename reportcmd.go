@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+type ReportArgs struct {
+	runs   []string // output directories of infer runs (or their manifests)
+	names  []string // name of each run in the report
+	k      int      // number of reticulations of the networks to compare (largest if negative)
+	prefix string   // prefix of the report files
+}
+
+func reportUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus report [flags]... <run> <run>...\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <run>\t\toutput directory of camus infer (written with -outdir), or its manifest.json\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus report -o filtering run-t0.0 run-t0.1 run-t0.2\n",
+		"\tcamus report -k 2 -names strict,relaxed strict-run/manifest.json relaxed-run/manifest.json\n\n",
+	)
+}
+
+func parseReportArgs(arguments []string) ReportArgs {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		reportUsage(fs)
+	}
+	build := reportFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the report flags on fs, returning a function that checks them once
+// they are parsed and makes the ReportArgs
+func reportFlags(fs *flag.FlagSet) func() ReportArgs {
+	k := fs.Int("k", -1, "number of reticulations of the networks to compare across runs (default largest of each run)")
+	names := fs.String("names", "", "comma separated `names` of the runs in the report, in order (default the name of each output directory)")
+	prefix := fs.String("o", "report", "`prefix` of the report files")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() ReportArgs {
+		if *help {
+			reportUsage(fs)
+			os.Exit(0)
+		}
+		if fs.NArg() < 2 {
+			fmt.Fprint(os.Stderr, "at least two positional arguments required: <run> <run>...\n\n") // nolint
+			reportUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if *k == 0 {
+			fmt.Fprint(os.Stderr, "-k must be positive (networks without reticulations have nothing to compare)\n\n") // nolint
+			reportUsage(fs)
+			os.Exit(exitUsage)
+		}
+		runNames := make([]string, fs.NArg())
+		for i, run := range fs.Args() {
+			runNames[i] = filepath.Base(runDir(run))
+		}
+		if *names != "" {
+			runNames = strings.Split(*names, ",")
+			if len(runNames) != fs.NArg() {
+				fmt.Fprintf(os.Stderr, "-names has %d names for %d runs\n\n", len(runNames), fs.NArg()) // nolint
+				reportUsage(fs)
+				os.Exit(exitUsage)
+			}
+		}
+		if len(slices.Compact(slices.Sorted(slices.Values(runNames)))) != len(runNames) {
+			fmt.Fprintf(os.Stderr, "runs must have different names (got %s); set them with -names\n\n", strings.Join(runNames, ", ")) // nolint
+			reportUsage(fs)
+			os.Exit(exitUsage)
+		}
+		return ReportArgs{
+			runs:   fs.Args(),
+			names:  runNames,
+			k:      *k,
+			prefix: *prefix,
+		}
+	}
+}
+
+// Output directory of a run given as the directory or its manifest
+func runDir(run string) string {
+	if filepath.Base(run) == outdirNames[manifestOutput] {
+		return filepath.Dir(run)
+	}
+	return filepath.Clean(run)
+}
+
+// Reads the manifest of the run in dir
+func readManifest(dir string) (manifest, error) {
+	path := filepath.Join(dir, outdirNames[manifestOutput])
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest{}, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return manifest{}, fmt.Errorf("%w, %s is not a camus manifest: %s", pr.ErrInvalidFile, path, err.Error())
+	}
+	return m, nil
+}
+
+// Reads the results file listed in the manifest of the run in dir
+func readRunResults(dir string, m manifest) (*pr.RunResults, error) {
+	for _, f := range m.Files {
+		if f.File == outdirNames[resultsOutput] || f.File == outdirNames[resultsJSONOutput] || f.File == outdirNames[resultsNexusOutput] {
+			return pr.ReadResultsFile(filepath.Join(dir, f.File))
+		}
+	}
+	return nil, fmt.Errorf("%w, the manifest in %s lists no csv, json, or nexus results file", pr.ErrInvalidFile, dir)
+}
+
+// Compares several infer runs (e.g., with different filtering settings),
+// writing their quartet satisfied curves, the reticulations of their networks,
+// and their runtimes to csv files (and the curves to a plot)
+func runReport(args ReportArgs) error {
+	qsats := make([][]float64, len(args.runs))
+	clades := make([]map[string][2]string, len(args.runs))
+	summaries := make([]pr.RunSummary, len(args.runs))
+	for i, run := range args.runs {
+		dir := runDir(run)
+		m, err := readManifest(dir)
+		if err != nil {
+			return err
+		}
+		results, err := readRunResults(dir, m)
+		if err != nil {
+			return err
+		}
+		k := args.k
+		if k < 0 {
+			k = len(results.Networks)
+		}
+		if k == 0 {
+			return fmt.Errorf("%w, %s has no networks with reticulations", pr.ErrInvalidFile, dir)
+		}
+		if k > len(results.Networks) {
+			return fmt.Errorf("%w, %s does not contain a network with %d reticulations", pr.ErrInvalidFile, dir, k)
+		}
+		ntw, err := pr.ConvertToNetwork(results.Networks[k-1])
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		if clades[i], err = ntw.ReticulationClades(); err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		qsats[i] = results.QSatScore
+		seconds := math.NaN()
+		if m.Seconds != nil {
+			seconds = *m.Seconds
+		}
+		summaries[i] = pr.RunSummary{
+			Name:          args.names[i],
+			Reticulations: k,
+			Seconds:       seconds,
+			Completed:     m.Completed,
+			Version:       m.Version,
+			Command:       m.Command,
+		}
+	}
+	reports := []struct {
+		suffix string
+		write  func(w io.Writer) error
+	}{
+		{"_qsat.csv", func(w io.Writer) error { return pr.WriteQSatComparisonToCSV(args.names, qsats, w) }},
+		{"_reticulations.csv", func(w io.Writer) error { return pr.WriteReticulationComparisonToCSV(args.names, clades, w) }},
+		{"_runs.csv", func(w io.Writer) error { return pr.WriteRunSummariesToCSV(summaries, w) }},
+	}
+	for _, r := range reports {
+		if err := writeFile(args.prefix+r.suffix, r.write); err != nil {
+			return err
+		}
+		lg.Infof("wrote %s", args.prefix+r.suffix)
+	}
+	if err := pr.WriteQSatLineplots(args.names, qsats, args.prefix+"_qsat.png"); err != nil {
+		return err
+	}
+	lg.Infof("wrote %s", args.prefix+"_qsat.png")
+	lg.Infof("%d of %d distinct reticulations are found in every run", sharedReticulations(clades), distinctReticulations(clades))
+	return nil
+}
+
+// Number of distinct reticulations (by clades) across runs
+func distinctReticulations(clades []map[string][2]string) int {
+	distinct := make(map[[2]string]bool)
+	for _, run := range clades {
+		for _, c := range run {
+			distinct[c] = true
+		}
+	}
+	return len(distinct)
+}
+
+// Number of reticulations (by clades) found in every run
+func sharedReticulations(clades []map[string][2]string) int {
+	found := make(map[[2]string]int)
+	for _, run := range clades {
+		for _, c := range run {
+			found[c]++
+		}
+	}
+	shared := 0
+	for _, n := range found {
+		if n == len(clades) {
+			shared++
+		}
+	}
+	return shared
+}
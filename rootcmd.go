@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+type RootArgs struct {
+	treeFile string   // tree to root
+	outgroup []string // taxa to root on (nil for midpoint rooting)
+}
+
+func rootUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus root [flags]... <tree_file>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <tree_file>\t\tnewick tree, rooted or unrooted\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus root -outgroup A species.nwk > constraint.nwk\n",
+		"\tcamus root -outgroup A,B species.nwk > constraint.nwk\n",
+		"\tcamus root -midpoint species.nwk > constraint.nwk\n\n",
+	)
+}
+
+func parseRootArgs(arguments []string) RootArgs {
+	fs := flag.NewFlagSet("root", flag.ExitOnError)
+	fs.Usage = func() {
+		rootUsage(fs)
+	}
+	build := rootFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the root flags on fs, returning a function that checks them once
+// they are parsed and makes the RootArgs
+func rootFlags(fs *flag.FlagSet) func() RootArgs {
+	outgroup := fs.String("outgroup", "", "comma separated outgroup `taxa` to root on, which must be monophyletic")
+	midpoint := fs.Bool("midpoint", false, "root at the midpoint of the longest path between two taxa (needs branch lengths)")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() RootArgs {
+		if *help {
+			rootUsage(fs)
+			os.Exit(0)
+		}
+		usageError := func(msg string) {
+			fmt.Fprint(os.Stderr, msg+"\n\n") // nolint
+			rootUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if fs.NArg() != 1 {
+			usageError("one positional argument required: <tree_file>")
+		}
+		if (*outgroup == "") == !*midpoint {
+			usageError("exactly one of -outgroup or -midpoint is required")
+		}
+		var taxa []string
+		if *outgroup != "" {
+			for taxon := range strings.SplitSeq(*outgroup, ",") {
+				if taxon = strings.TrimSpace(taxon); taxon == "" {
+					usageError(fmt.Sprintf("\"%s\" is not a valid outgroup: taxa cannot be empty", *outgroup))
+				}
+				taxa = append(taxa, taxon)
+			}
+		}
+		return RootArgs{
+			treeFile: fs.Arg(0),
+			outgroup: taxa,
+		}
+	}
+}
+
+// Roots a tree on an outgroup (or at its midpoint) so that it can be used as a
+// constraint tree, writing it to stdout
+func runRoot(args RootArgs) error {
+	tre, err := pr.ReadSpeciesTreeFile(args.treeFile)
+	if err != nil {
+		return err
+	}
+	if args.outgroup != nil {
+		err = pr.RootOutgroup(tre, args.outgroup)
+	} else {
+		err = pr.RootMidpoint(tre)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, tre.Newick())
+	return err
+}
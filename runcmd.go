@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+type RunArgs struct {
+	configFile string // pipeline config
+	outdir     string // results directory (overrides the config if set)
+}
+
+// Steps of the pipeline, in the order they run
+const (
+	stepValidate  = "validate"
+	stepInfer     = "infer"
+	stepBootstrap = "bootstrap"
+	stepScore     = "score"
+	stepReport    = "report"
+)
+
+// Steps that can be skipped in the config (infer always runs, and bootstrap
+// is skipped by leaving out the number of replicates)
+var skippableSteps = []string{stepValidate, stepScore, stepReport}
+
+// Settings of a pipeline run, read from a json config. Relative paths are
+// relative to the directory of the config.
+type pipelineConfig struct {
+	Constraint string   `json:"constraint"` // constraint tree
+	GeneTrees  string   `json:"gene_trees"` // gene trees
+	Format     string   `json:"format"`     // gene tree format (default newick)
+	Outdir     string   `json:"outdir"`     // results directory
+	Infer      []string `json:"infer"`      // other infer flags, as on the command line
+	Bootstrap  int      `json:"bootstrap"`  // bootstrap replicates (no bootstrap if 0)
+	Skip       []string `json:"skip"`       // steps to skip
+
+	dir string // directory of the config
+}
+
+// Infer flags taking a path, which is relative to the directory of the config
+// like the other paths in it
+var pipelinePathFlags = []string{"branches", "cache-dir", "partitions", "progress", "restrict", "weights"}
+
+func runUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus run [flags]... <config>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <config>\tjson config of the pipeline (validate, infer, bootstrap, score, and report); e.g.,\n",
+		"\t\t{\"constraint\": \"constraint.nwk\", \"gene_trees\": \"gene-trees.nwk\", \"outdir\": \"results\",\n",
+		"\t\t \"infer\": [\"-t\", \"0.3\"], \"bootstrap\": 100, \"skip\": [\"validate\"]}\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus run pipeline.json\n",
+		"\tcamus run -outdir results-rerun pipeline.json\n\n",
+	)
+}
+
+func parseRunArgs(arguments []string) RunArgs {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		runUsage(fs)
+	}
+	build := runFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the run flags on fs, returning a function that checks them once
+// they are parsed and makes the RunArgs
+func runFlags(fs *flag.FlagSet) func() RunArgs {
+	outdir := fs.String("outdir", "", "results `directory` (overrides outdir in the config)")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() RunArgs {
+		if *help {
+			runUsage(fs)
+			os.Exit(0)
+		}
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, "one positional argument required: <config>\n\n") // nolint
+			runUsage(fs)
+			os.Exit(exitUsage)
+		}
+		return RunArgs{configFile: fs.Arg(0), outdir: *outdir}
+	}
+}
+
+// Reads the pipeline config, resolving its paths relative to its directory
+func readPipelineConfig(path string) (pipelineConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	var cfg pipelineConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return pipelineConfig{}, fmt.Errorf("%w, %s is not a valid pipeline config: %s", pr.ErrInvalidFile, path, err.Error())
+	}
+	if cfg.Constraint == "" || cfg.GeneTrees == "" {
+		return pipelineConfig{}, fmt.Errorf("%w, %s must set constraint and gene_trees", pr.ErrInvalidFile, path)
+	}
+	if cfg.Bootstrap < 0 {
+		return pipelineConfig{}, fmt.Errorf("%w, bootstrap in %s must be non-negative", pr.ErrInvalidFile, path)
+	}
+	for _, step := range cfg.Skip {
+		if !slices.Contains(skippableSteps, step) {
+			return pipelineConfig{}, fmt.Errorf("%w, cannot skip \"%s\" in %s (steps that can be skipped are %v)", pr.ErrInvalidFile, step, path, skippableSteps)
+		}
+	}
+	if cfg.Format == "" {
+		cfg.Format = DefaultFormat
+	}
+	if _, ok := pr.ParseFormat[cfg.Format]; !ok {
+		return pipelineConfig{}, fmt.Errorf("%w, \"%s\" in %s is not a gene tree format", pr.ErrInvalidFile, cfg.Format, path)
+	}
+	dir := filepath.Dir(path)
+	cfg.dir = dir
+	for _, p := range []*string{&cfg.Constraint, &cfg.GeneTrees, &cfg.Outdir} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return cfg, nil
+}
+
+// Runs the pipeline in the config: validates the inputs, infers networks (with
+// bootstrap support if asked for), scores the reticulations of the largest
+// network, and reports on the run, each step writing to its own directory
+// under the results directory. Returns the exit code.
+func runPipeline(args RunArgs) int {
+	fail := func(err error) int {
+		lg.Errorf("%s", err)
+		return exitCode(err)
+	}
+	cfg, err := readPipelineConfig(args.configFile)
+	if err != nil {
+		return fail(err)
+	}
+	if args.outdir != "" {
+		cfg.Outdir = args.outdir
+	}
+	if cfg.Outdir == "" {
+		return fail(fmt.Errorf("%w, no results directory; set outdir in %s or use -outdir", pr.ErrInvalidFile, args.configFile))
+	}
+	if _, err := newOutputLayout(cfg.Outdir, ""); err != nil { // makes sure it is empty
+		return fail(err)
+	}
+	dir := func(step string) string { return filepath.Join(cfg.Outdir, step) }
+	if !slices.Contains(cfg.Skip, stepValidate) {
+		lg.Infof("camus run: %s", stepValidate)
+		if err := validateInputs(cfg, dir(stepValidate)); err != nil {
+			return fail(err)
+		}
+	}
+	lg.Infof("camus run: %s", stepInfer)
+	if cfg.Bootstrap > 0 {
+		lg.Infof("camus run: %s (%d replicates, written with the infer output)", stepBootstrap, cfg.Bootstrap)
+	}
+	inferArgs := pipelineInferArgs(cfg, dir(stepInfer))
+	if exit := runInfer(inferArgs, &bytes.Buffer{}); exit != 0 {
+		return exit
+	}
+	log.SetOutput(os.Stderr)
+	m, err := readManifest(dir(stepInfer))
+	if err != nil {
+		return fail(err)
+	}
+	results, err := readRunResults(dir(stepInfer), m)
+	if err != nil {
+		return fail(err)
+	}
+	if len(results.Networks) == 0 {
+		lg.Infof("camus run: no reticulations were inferred, so there is nothing to score or report")
+		return 0
+	}
+	switch {
+	case slices.Contains(cfg.Skip, stepScore):
+	case inferArgs.alignments:
+		lg.Infof("camus run: skipping %s, since networks inferred from alignments have no gene trees to score them with", stepScore)
+	default:
+		lg.Infof("camus run: %s", stepScore)
+		if err := scoreLargestNetwork(inferArgs, results, dir(stepScore)); err != nil {
+			return fail(err)
+		}
+	}
+	if !slices.Contains(cfg.Skip, stepReport) {
+		lg.Infof("camus run: %s", stepReport)
+		if err := os.Mkdir(dir(stepReport), 0o755); err != nil {
+			return fail(err)
+		}
+		report := ReportArgs{runs: []string{dir(stepInfer)}, names: []string{filepath.Base(cfg.Outdir)}, k: -1, prefix: filepath.Join(dir(stepReport), "report")}
+		if err := runReport(report); err != nil {
+			return fail(err)
+		}
+	}
+	lg.Infof("camus run: finished, results are in %s", cfg.Outdir)
+	return 0
+}
+
+// Infer args for the pipeline, writing to outdir; the flags in the config are
+// checked the same way as on the command line
+func pipelineInferArgs(cfg pipelineConfig, outdir string) Args {
+	arguments := slices.Clone(cfg.Infer)
+	arguments = append(arguments, "-f", cfg.Format, "-outdir", outdir)
+	if cfg.Bootstrap > 0 {
+		arguments = append(arguments, "-bootstrap", strconv.Itoa(cfg.Bootstrap))
+	}
+	arguments = append(arguments, cfg.Constraint, cfg.GeneTrees)
+	fs := flag.NewFlagSet("infer", flag.ExitOnError)
+	fs.Usage = func() {
+		Usage(false)
+	}
+	build := inferFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	fs.Visit(func(f *flag.Flag) {
+		if p := f.Value.String(); slices.Contains(pipelinePathFlags, f.Name) && p != "" && !filepath.IsAbs(p) {
+			f.Value.Set(filepath.Join(cfg.dir, p)) // nolint (string flags)
+		}
+	})
+	args := build()
+	if args.prefix != "" {
+		parserError("-o cannot be set in the infer flags of a pipeline config (the output goes to the infer directory)")
+	}
+	return args
+}
+
+// Writes the summary of the inputs, the taxa coverage of each gene tree, and
+// the distribution of quartet counts (see camus stats) to dir
+func validateInputs(cfg pipelineConfig, dir string) error {
+	tre, geneTrees, err := pr.ReadInputFiles(cfg.Constraint, cfg.GeneTrees, pr.ParseFormat[cfg.Format])
+	if err != nil {
+		return err
+	}
+	stats, err := pr.InputStatistics(tre, geneTrees.Trees, runtime.GOMAXPROCS(0))
+	if err != nil {
+		return err
+	}
+	return writeStepFiles(dir, []stepFile{
+		{"input_stats.csv", func(w io.Writer) error { return pr.WriteInputStatsToCSV(stats, w) }},
+		{"coverage.csv", func(w io.Writer) error { return pr.WriteCoverageToCSV(stats, geneTrees.Names, w) }},
+		{"quartet_counts.csv", func(w io.Writer) error { return pr.WriteQuartetCountsToCSV(stats, w) }},
+	})
+}
+
+// Writes the score of each reticulation of the largest network for each gene
+// tree, and a summary for each reticulation (see camus score), to dir. Gene
+// trees are read and prepared with the same infer flags (args) as the network
+// was inferred with, except that only the first copy of a taxon is kept with
+// -mul-trees copies, since scores need one copy of each taxon.
+func scoreLargestNetwork(args Args, results *pr.RunResults, dir string) error {
+	tre, geneTrees, err := readInferInputs(args)
+	if err != nil {
+		return err
+	}
+	if args.inferOpts.MulTrees == pr.MulCopies {
+		args.inferOpts.MulTrees = pr.MulCollapse
+	}
+	if err = prepareGeneTrees(args, tre, geneTrees); err != nil {
+		return err
+	}
+	network, err := pr.ConvertToNetwork(results.Networks[len(results.Networks)-1])
+	if err != nil {
+		return err
+	}
+	scores, summaries, err := sc.ReticulationScoreAndSummary(context.Background(), network, geneTrees.Trees)
+	if err != nil {
+		return err
+	}
+	return writeStepFiles(dir, []stepFile{
+		{"scores.csv", func(w io.Writer) error { return pr.WriteRetScoresToCSV(scores, geneTrees.Names, w) }},
+		{"summary.csv", func(w io.Writer) error { return pr.WriteRetSummaryToCSV(summaries, w) }},
+	})
+}
+
+// File written by a pipeline step
+type stepFile struct {
+	name  string
+	write func(w io.Writer) error
+}
+
+// Creates dir and writes files to it
+func writeStepFiles(dir string, files []stepFile) error {
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := writeFile(path, f.write); err != nil {
+			return err
+		}
+		lg.Infof("wrote %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	gr "github.com/jsdoublel/camus/internal/graphs"
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+type ScoreArgs struct {
+	networkFile  string        // level-1 network in extended newick format or infer results csv
+	k            int           // number of reticulations of network to use from results csv
+	geneTreeFile string        // gene trees
+	gtFormat     pr.Format     // gene tree file format
+	summaryOnly  bool          // only write per reticulation aggregates
+	sparse       bool          // write (gene, reticulation, score) rows, leaving out NaN scores
+	maxRows      int           // split the score matrix into files with at most this many genes (no limit if 0)
+	prefix       string        // prefix of the files the score matrix is split into
+	restrictFile string        // file listing taxa to restrict input to
+	asUnrooted   bool          // treat gene trees as unrooted
+	timeout      time.Duration // time limit for scoring (no limit if 0)
+	branchSupp   bool          // write backbone tree with quartet support on every branch instead of scores
+	gamma        bool          // write network with re-estimated gamma and support of reticulation edges instead of scores
+}
+
+func scoreUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus score [flags]... <network_file> <gene_tree_file>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <network_file>\t\tlevel-1 network in extended newick format, or results csv from infer\n",
+		"  <gene_tree_file>\tgene tree newick file\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus score network.nwk gene-trees.nwk > scores.csv\n",
+		"\tcamus score -k 2 infer-results.csv gene-trees.nwk > scores.csv\n",
+		"\tcamus score -branch-support network.nwk gene-trees.nwk > support.nwk\n",
+		"\tcamus score -gamma network.nwk new-gene-trees.nwk > network-gamma.nwk\n\n",
+	)
+}
+
+func parseScoreArgs(arguments []string) ScoreArgs {
+	fs := flag.NewFlagSet("score", flag.ExitOnError)
+	fs.Usage = func() {
+		scoreUsage(fs)
+	}
+	build := scoreFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the score flags on fs, returning a function that checks them once
+// they are parsed and makes the ScoreArgs
+func scoreFlags(fs *flag.FlagSet) func() ScoreArgs {
+	format, ok := pr.ParseFormat[DefaultFormat]
+	if !ok {
+		panic(fmt.Sprintf("bad default format %s", DefaultFormat))
+	}
+	fs.Var(&format, "f", "gene tree `format` [newick|nexus] (default \"newick\")")
+	summaryOnly := fs.Bool("summary-only", false, "only write support, mean, and number of informative genes for each reticulation")
+	sparse := fs.Bool("sparse", false, "write one row per gene and reticulation with an informative score instead of a matrix")
+	maxRows := fs.Int("max-rows", 0, "split the score matrix into numbered csv files of at most `num` genes each, listed in an index file, when there are more genes (0 means no limit)")
+	prefix := fs.String("o", "scores", "`prefix` of the csv files and index written when the score matrix is split by -max-rows")
+	k := fs.Int("k", -1, "number of reticulations of the network to score when reading a results csv (default largest)")
+	restrict := fs.String("restrict", "", "only use the taxa listed in `file` (one per line), pruning the network and gene trees")
+	asUnrooted := fs.Bool("as-unrooted", false, "treat gene trees as unrooted, removing the root of rooted gene trees when they are read")
+	timeout := fs.Duration("timeout", 0, "stop and exit with an error if scoring takes longer than `duration` (0 means no limit)")
+	branchSupp := fs.Bool("branch-support", false, "write the network's backbone tree with the percent of quartets around each internal branch that agree with it as support values, instead of scoring reticulations")
+	gamma := fs.Bool("gamma", false, "keep the network fixed and write it with the re-estimated inheritance probability (gamma) and support of each reticulation edge (e.g., #H1::0.81:0.32), instead of scoring reticulations")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() ScoreArgs {
+		if *help {
+			scoreUsage(fs)
+			os.Exit(0)
+		}
+		if fs.NArg() != 2 {
+			fmt.Fprint(os.Stderr, "two positional arguments required: <network_file> <gene_tree_file>\n\n") // nolint
+			scoreUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if *maxRows < 0 {
+			fmt.Fprintf(os.Stderr, "-max-rows must be non-negative, not %d\n\n", *maxRows) // nolint
+			scoreUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if *timeout < 0 {
+			fmt.Fprintf(os.Stderr, "-timeout must be non-negative, not %s\n\n", *timeout) // nolint
+			scoreUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if *maxRows != 0 && (*sparse || *summaryOnly) {
+			fmt.Fprint(os.Stderr, "-max-rows cannot be used with -sparse or -summary-only\n\n") // nolint
+			scoreUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if *branchSupp && (*sparse || *summaryOnly || *maxRows != 0) {
+			fmt.Fprint(os.Stderr, "-branch-support cannot be used with -sparse, -summary-only, or -max-rows\n\n") // nolint
+			scoreUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if *gamma && (*branchSupp || *sparse || *summaryOnly || *maxRows != 0) {
+			fmt.Fprint(os.Stderr, "-gamma cannot be used with -branch-support, -sparse, -summary-only, or -max-rows\n\n") // nolint
+			scoreUsage(fs)
+			os.Exit(exitUsage)
+		}
+		return ScoreArgs{
+			networkFile:  fs.Arg(0),
+			k:            *k,
+			geneTreeFile: fs.Arg(1),
+			gtFormat:     format,
+			summaryOnly:  *summaryOnly,
+			sparse:       *sparse,
+			maxRows:      *maxRows,
+			prefix:       *prefix,
+			restrictFile: *restrict,
+			asUnrooted:   *asUnrooted,
+			timeout:      *timeout,
+			branchSupp:   *branchSupp,
+			gamma:        *gamma,
+		}
+	}
+}
+
+// Scores reticulations of network using gene trees, writing csv to stdout (or
+// split into files if there are more than args.maxRows genes)
+func runScore(args ScoreArgs) error {
+	ctx, cancel := runContext(args.timeout)
+	defer cancel()
+	return timeoutError(scoreNetwork(ctx, args), args.timeout)
+}
+
+// Does the work of runScore, stopping early if ctx is cancelled
+func scoreNetwork(ctx context.Context, args ScoreArgs) error {
+	tre, geneTrees, err := readNetworkInputs(args.networkFile, args.k, args.geneTreeFile, args.gtFormat)
+	if err != nil {
+		return err
+	}
+	if err = restrictInputs(args.restrictFile, tre, geneTrees); err != nil {
+		return err
+	}
+	setGeneTreeRooting(args.asUnrooted, geneTrees.Trees)
+	if args.branchSupp {
+		return writeBranchSupport(ctx, tre, geneTrees.Trees)
+	}
+	network, err := pr.ConvertToNetwork(tre)
+	if err != nil {
+		return err
+	}
+	if args.gamma {
+		return writeGamma(ctx, network, geneTrees.Trees)
+	}
+	if args.summaryOnly {
+		summaries, err := sc.ReticulationSummary(ctx, network, geneTrees.Trees)
+		if err != nil {
+			return err
+		}
+		return pr.WriteRetSummaryToCSV(summaries, os.Stdout)
+	}
+	scores, err := sc.ReticulationScore(ctx, network, geneTrees.Trees)
+	if err != nil {
+		return err
+	}
+	if args.sparse {
+		return pr.WriteRetScoresSparseToCSV(scores, geneTrees.Names, os.Stdout)
+	}
+	if args.maxRows != 0 && len(scores) > args.maxRows {
+		return writeScoreParts(scores, geneTrees.Names, args)
+	}
+	return pr.WriteRetScoresToCSV(scores, geneTrees.Names, os.Stdout)
+}
+
+// Writes the backbone tree of ntw (which may have no reticulations) to stdout
+// with the percent of quartets agreeing with each internal branch, rounded to
+// two decimal places, as its support
+func writeBranchSupport(ctx context.Context, ntw *tree.Tree, geneTrees []*tree.Tree) error {
+	backbone, err := pr.BackboneTree(ntw)
+	if err != nil {
+		return err
+	}
+	support, err := sc.BranchSupport(ctx, backbone, geneTrees, runtime.GOMAXPROCS(0))
+	if err != nil {
+		return err
+	}
+	annotated := 0
+	for _, n := range backbone.Nodes() {
+		e, err := n.ParentEdge()
+		if err != nil { // root
+			continue
+		}
+		if math.IsNaN(support[n.Id()]) {
+			e.SetSupport(tree.NIL_SUPPORT)
+			continue
+		}
+		e.SetSupport(math.Round(support[n.Id()]*100) / 100)
+		n.SetName("") // gotree only writes the support of unnamed nodes
+		annotated++
+	}
+	lg.Infof("annotated %d branches with quartet support", annotated)
+	_, err = fmt.Println(backbone.Newick())
+	return err
+}
+
+// Writes ntw to stdout with the inheritance probability (gamma) and support of
+// each reticulation edge estimated from the gene trees, keeping its topology
+func writeGamma(ctx context.Context, ntw *gr.Network, geneTrees []*tree.Tree) error {
+	gammas, err := sc.InheritanceProbabilities(ctx, ntw, geneTrees)
+	if err != nil {
+		return err
+	}
+	summaries, err := sc.ReticulationSummary(ctx, ntw, geneTrees)
+	if err != nil {
+		return err
+	}
+	ntw.Gamma = gammas
+	ntw.Support = make(map[string]float64, len(summaries))
+	for _, label := range pr.SortedRetLabels(summaries) {
+		ntw.Support[label] = summaries[label].Support
+		if math.IsNaN(gammas[label]) {
+			lg.Warnf("%s has no informative quartets, so its gamma is left out", label)
+			continue
+		}
+		lg.Infof("%s: gamma %.4f, support %.4f (%d informative genes)", label, gammas[label], summaries[label].Support, summaries[label].Informative)
+	}
+	_, err = fmt.Println(ntw.Newick())
+	return err
+}
+
+// Writes score matrix to <prefix>_1.csv, <prefix>_2.csv, ..., with at most
+// args.maxRows genes each, and lists them in <prefix>_index.csv
+func writeScoreParts(scores []*map[string]float64, names []string, args ScoreArgs) error {
+	parts, err := pr.WriteRetScoresInParts(scores, names, args.maxRows, func(part int, write func(io.Writer) error) (string, error) {
+		path := fmt.Sprintf("%s_%d.csv", args.prefix, part)
+		return path, writeFile(path, write)
+	})
+	if err != nil {
+		return err
+	}
+	index := args.prefix + "_index.csv"
+	err = writeFile(index, func(w io.Writer) error {
+		return pr.WriteScorePartsIndexToCSV(parts, w)
+	})
+	if err != nil {
+		return err
+	}
+	lg.Infof("split scores of %d genes into %d files listed in %s", len(scores), len(parts), index)
+	return nil
+}
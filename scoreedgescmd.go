@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	in "github.com/jsdoublel/camus/internal/infer"
+	pr "github.com/jsdoublel/camus/internal/prep"
+	sc "github.com/jsdoublel/camus/internal/score"
+)
+
+type ScoreEdgesArgs struct {
+	treeFile     string              // constraint tree
+	edgesFile    string              // candidate edges
+	geneTreeFile string              // gene trees
+	format       pr.Format           // gene tree file format
+	modes        []sc.InitableScorer // score modes to score the edges with
+	inferOpts    in.InferOptions     // quartet filter and score settings, the same as infer
+}
+
+func scoreEdgesUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus score-edges [flags]... <constraint_tree> <edges_file> <gene_tree_file>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <constraint_tree>\tconstraint newick tree\n",
+		"  <edges_file>\t\tcsv of candidate edges, one per row as two columns, U and W; each end is a taxon,\n",
+		"\t\t\ta label of an internal node of the constraint tree, or a quoted clade (e.g., \"{A,B}\")\n",
+		"  <gene_tree_file>\tlist of newick trees\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus score-edges constraint.nwk edges.csv gene-trees.nwk > edge-scores.csv\n",
+		"\tcamus score-edges -sm max -t 0.3 constraint.nwk edges.csv gene-trees.nwk > edge-scores.csv\n\n",
+	)
+}
+
+func parseScoreEdgesArgs(arguments []string) ScoreEdgesArgs {
+	fs := flag.NewFlagSet("score-edges", flag.ExitOnError)
+	fs.Usage = func() {
+		scoreEdgesUsage(fs)
+	}
+	build := scoreEdgesFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the score-edges flags on fs, returning a function that checks them
+// once they are parsed and makes the ScoreEdgesArgs
+func scoreEdgesFlags(fs *flag.FlagSet) func() ScoreEdgesArgs {
+	format, ok := pr.ParseFormat[DefaultFormat]
+	if !ok {
+		panic(fmt.Sprintf("bad default format %s", DefaultFormat))
+	}
+	fs.Var(&format, "f", "gene tree `format` [newick|nexus] (default \"newick\")")
+	scoreModes := fs.String("sm", "max,norm,sym", "comma separated score `modes` [max|norm|sym|cf] to score each edge with")
+	mode := fs.Int("q", DefaultQMode, "quartet filter mode number [0, 2]")
+	supp := fs.Float64("s", DefaultMinSupport, "collapse edges in gene trees with support less than value (default 0)")
+	thresh := fs.Float64("t", DefaultThreshold, "threshold for quartet filter [0, 1]")
+	alpha := fs.Float64("a", DefaultAlpha, "parameter to adjust penalty for \"sym\" score mode, from (0, 1]")
+	penaltyScale := fs.String("penalty-scale", DefaultPenaltyScale, "how the \"sym\" penalty grows with the length of the cycle an edge forms `scale` [flat|linear|log]")
+	nprocs := fs.Int("n", 0, "number of parallel processes (default number of cpus)")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() ScoreEdgesArgs {
+		if *help {
+			scoreEdgesUsage(fs)
+			os.Exit(0)
+		}
+		usageError := func(msg string) {
+			fmt.Fprint(os.Stderr, msg+"\n\n") // nolint
+			scoreEdgesUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if fs.NArg() != 3 {
+			usageError("three positional arguments required: <constraint_tree> <edges_file> <gene_tree_file>")
+		}
+		var modes []sc.InitableScorer
+		var names []string
+		for name := range strings.SplitSeq(*scoreModes, ",") {
+			name = strings.TrimSpace(name)
+			scorer, ok := sc.ParseScorer[name]
+			if !ok {
+				usageError(fmt.Sprintf("\"%s\" is not a valid score mode: valid score modes are \"max\", \"norm\", \"sym\", and \"cf\"", name))
+			}
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+				modes = append(modes, scorer)
+			}
+		}
+		qOpts, err := pr.SetQuartetFilterOptions(*mode, *thresh)
+		if err != nil {
+			usageError(err.Error())
+		}
+		inferOpts, err := in.MakeInferOptions(*nprocs, 0, 0, qOpts, *supp, modes[0], false, *alpha)
+		if err != nil {
+			usageError(err.Error())
+		}
+		var ok bool
+		if inferOpts.PenaltyScale, ok = sc.ParsePenaltyScale[*penaltyScale]; !ok {
+			usageError(fmt.Sprintf("\"%s\" is not a valid penalty scale: valid penalty scales are \"flat\", \"linear\", and \"log\"", *penaltyScale))
+		}
+		return ScoreEdgesArgs{
+			treeFile:     fs.Arg(0),
+			edgesFile:    fs.Arg(1),
+			geneTreeFile: fs.Arg(2),
+			format:       format,
+			modes:        modes,
+			inferOpts:    *inferOpts,
+		}
+	}
+}
+
+// Scores each candidate edge in the edges file with each score mode, writing
+// csv to stdout
+func runScoreEdges(args ScoreEdgesArgs) error {
+	edges, err := pr.ReadEdgesFile(args.edgesFile)
+	if err != nil {
+		return err
+	}
+	tre, geneTrees, err := pr.ReadInputFiles(args.treeFile, args.geneTreeFile, args.format)
+	if err != nil {
+		return err
+	}
+	args.inferOpts.GeneNames = geneTrees.Names
+	td, scores, err := in.ScoreEdges(context.Background(), tre, geneTrees.Trees, edges, args.modes, args.inferOpts)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(args.modes))
+	for i, mode := range args.modes {
+		names[i] = sc.ScorerName(mode)
+	}
+	return pr.WriteEdgeScoresToCSV(td, scores, names, os.Stdout)
+}
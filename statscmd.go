@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/evolbioinfo/gotree/tree"
+
+	lg "github.com/jsdoublel/camus/internal/logging"
+	pr "github.com/jsdoublel/camus/internal/prep"
+)
+
+type StatsArgs struct {
+	treeFile     string    // constraint tree
+	geneTreeFile string    // gene trees
+	format       pr.Format // gene tree file format
+	prefix       string    // prefix of the per gene tree and quartet count files ("" if not written)
+	rootAudit    bool      // write the root audit of each gene tree instead of the summary
+}
+
+func statsUsage(fs *flag.FlagSet) {
+	fmt.Fprint(fs.Output(), // nolint
+		"usage: camus stats [flags]... <constraint_tree> <gene_tree_file>\n",
+		"\n",
+		"positional arguments:\n\n",
+		"  <constraint_tree>\tconstraint newick tree\n",
+		"  <gene_tree_file>\tlist of newick trees\n",
+		"\n",
+		"flags:\n\n",
+	)
+	fs.PrintDefaults()
+	fmt.Fprint(fs.Output(), // nolint
+		"\n",
+		"examples:\n\n",
+		"\tcamus stats constraint.nwk gene-trees.nwk > input-stats.csv\n",
+		"\tcamus stats -o input constraint.nwk gene-trees.nwk > input-stats.csv\n",
+		"\tcamus stats -root-audit constraint.nwk gene-trees.nwk > roots.csv\n\n",
+	)
+}
+
+func parseStatsArgs(arguments []string) StatsArgs {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Usage = func() {
+		statsUsage(fs)
+	}
+	build := statsFlags(fs)
+	fs.Parse(arguments) // nolint (exits on error)
+	return build()
+}
+
+// Defines the stats flags on fs, returning a function that checks them once
+// they are parsed and makes the StatsArgs
+func statsFlags(fs *flag.FlagSet) func() StatsArgs {
+	format, ok := pr.ParseFormat[DefaultFormat]
+	if !ok {
+		panic(fmt.Sprintf("bad default format %s", DefaultFormat))
+	}
+	fs.Var(&format, "f", "gene tree `format` [newick|nexus] (default \"newick\")")
+	prefix := fs.String("o", "", "also write the taxa coverage of each gene tree and the distribution of quartet counts to csv files starting with `prefix`")
+	rootAudit := fs.Bool("root-audit", false, "write whether the root of each gene tree changes the quartets it contributes (and whether unrooting changed its splits) instead of the summary")
+	help := fs.Bool("h", false, "prints help and exits")
+	return func() StatsArgs {
+		if *help {
+			statsUsage(fs)
+			os.Exit(0)
+		}
+		if fs.NArg() != 2 {
+			fmt.Fprint(os.Stderr, "two positional arguments required: <constraint_tree> <gene_tree_file>\n\n") // nolint
+			statsUsage(fs)
+			os.Exit(exitUsage)
+		}
+		if *rootAudit && *prefix != "" {
+			fmt.Fprint(os.Stderr, "-root-audit and -o cannot be used together\n\n") // nolint
+			statsUsage(fs)
+			os.Exit(exitUsage)
+		}
+		return StatsArgs{
+			treeFile:     fs.Arg(0),
+			geneTreeFile: fs.Arg(1),
+			format:       format,
+			prefix:       *prefix,
+			rootAudit:    *rootAudit,
+		}
+	}
+}
+
+// Summarizes the gene trees and their quartets before a run, writing the
+// summary csv to stdout
+func runStats(args StatsArgs) error {
+	tre, geneTrees, err := pr.ReadInputFiles(args.treeFile, args.geneTreeFile, args.format)
+	if err != nil {
+		return err
+	}
+	if args.rootAudit {
+		return writeRootAudit(tre, geneTrees)
+	}
+	stats, err := pr.InputStatistics(tre, geneTrees.Trees, runtime.GOMAXPROCS(0))
+	if err != nil {
+		return err
+	}
+	if args.prefix != "" {
+		files := []struct {
+			suffix string
+			write  func(w io.Writer) error
+		}{
+			{"_coverage.csv", func(w io.Writer) error { return pr.WriteCoverageToCSV(stats, geneTrees.Names, w) }},
+			{"_quartet_counts.csv", func(w io.Writer) error { return pr.WriteQuartetCountsToCSV(stats, w) }},
+		}
+		for _, f := range files {
+			if err := writeFile(args.prefix+f.suffix, f.write); err != nil {
+				return err
+			}
+			lg.Infof("wrote %s", args.prefix+f.suffix)
+		}
+	}
+	return pr.WriteInputStatsToCSV(stats, os.Stdout)
+}
+
+// Writes the root audit of each gene tree to stdout, logging how many trees
+// have a root that changes their quartets
+func writeRootAudit(tre *tree.Tree, geneTrees *pr.GeneTrees) error {
+	audits, err := pr.AuditGeneTreeRoots(tre, geneTrees.Trees)
+	if err != nil {
+		return err
+	}
+	rooted, splits, quartets, notes := 0, 0, 0, 0
+	for i, a := range audits {
+		if a.Rooted() {
+			rooted++
+		}
+		if a.SplitsChanged {
+			splits++
+		}
+		if a.QuartetsChanged {
+			quartets++
+		}
+		if a.Note != "" {
+			notes++
+			lg.Warnf("gene tree %s: %s", geneTrees.Names[i], a.Note)
+		}
+	}
+	lg.Infof("%d of %d gene trees are rooted; unrooting changed the splits of %d, rooting changed the quartets of %d, and %d could not be audited",
+		rooted, len(audits), splits, quartets, notes)
+	return pr.WriteRootAuditToCSV(audits, geneTrees.Names, os.Stdout)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+
+	ansiBold  = "\x1b[1m"
+	ansiGreen = "\x1b[32m"
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
+)
+
+// Whether the summary written to stderr should use color. With "auto", color
+// is used if stderr is a terminal and NO_COLOR is not set.
+func useColor(mode string) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return stderrIsTerminal()
+}
+
+// Whether stderr is a terminal (rather than a file or pipe)
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Row of the end of run summary for the optimal network with k edges
+type summaryRow struct {
+	k          int
+	score      float64 // dp score
+	qSat       float64 // percent of quartets satisfied
+	supporting int     // gene trees containing a quartet satisfied by the network
+}
+
+// Writes a table with the key numbers of each optimal network, followed by the
+// output files, to w
+func writeRunSummary(w io.Writer, rows []summaryRow, nGenes int, files []string, color bool) error {
+	style := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	table := [][]string{{"k", "score", "qsat %", "genes supporting"}}
+	for _, r := range rows {
+		genes := "-" // no gene trees to count
+		if nGenes != 0 {
+			genes = fmt.Sprintf("%d/%d (%.1f%%)", r.supporting, nGenes, 100*float64(r.supporting)/float64(nGenes))
+		}
+		table = append(table, []string{
+			strconv.Itoa(r.k),
+			strconv.FormatFloat(r.score, 'g', 6, 64),
+			fmt.Sprintf("%.2f", r.qSat),
+			genes,
+		})
+	}
+	// widths are found before styling, since color codes take no space
+	widths := make([]int, len(table[0]))
+	for _, line := range table {
+		for j, cell := range line {
+			widths[j] = max(widths[j], len(cell))
+		}
+	}
+	var b strings.Builder
+	b.WriteString("\n")
+	for i, line := range table {
+		for j, cell := range line {
+			cell = strings.Repeat(" ", widths[j]-len(cell)) + cell
+			switch {
+			case i == 0:
+				cell = style(ansiBold, cell)
+			case j == 2:
+				cell = style(ansiGreen, cell)
+			}
+			b.WriteString("  " + cell)
+		}
+		b.WriteString("\n")
+	}
+	if len(files) != 0 {
+		b.WriteString("\n" + style(ansiBold, "output files") + "\n")
+	}
+	for _, f := range files {
+		b.WriteString("  " + style(ansiDim, f) + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
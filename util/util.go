@@ -1,11 +1,26 @@
-package infer
+// Package util has the tree traversals and k-split helpers CAMUS uses for its
+// dynamic programming algorithm, for anyone building a similar dp over rooted
+// binary gotree trees. In a dp of this kind, each node keeps a list of scores
+// indexed by k (e.g., scores[k] is the best score with k edges added below the
+// node), and the lists of two subtrees are combined with BestSplit.
+package util
 
 import (
-	"github.com/evolbioinfo/gotree/tree"
+	"errors"
 
-	sc "github.com/jsdoublel/camus/internal/score"
+	"github.com/evolbioinfo/gotree/tree"
 )
 
+var ErrNoValidSplit = errors.New("no valid split")
+
+// Score types a dp can use; integer scores are added exactly
+type Score interface{ int64 | uint64 | float64 }
+
+// Calls f on every node below cur, with the subtree of the child of cur it is
+// not under: first the nodes under cur's first child (in post-order, paired
+// with the second child), then those under the second (paired with the first).
+// cur itself is not visited, and nothing is visited if it is a tip. Panics if
+// cur does not have exactly two children (the tree must be rooted and binary).
 func SubtreePostOrder(cur *tree.Node, f func(cur, otherSubtree *tree.Node)) {
 	if !cur.Tip() {
 		children := make([]*tree.Node, 0)
@@ -35,6 +50,9 @@ func subtreePostOrderHelper(cur, otherSubtree *tree.Node, f func(cur, otherSubtr
 	f(cur, otherSubtree)
 }
 
+// Calls f on cur and every node below it in pre-order (each node before its
+// children). The tree must be rooted, since children are found by leaving
+// out the parent of each node.
 func SubtreePreOrder(cur *tree.Node, f func(cur *tree.Node)) {
 	f(cur)
 	for _, n := range cur.Neigh() {
@@ -46,9 +64,11 @@ func SubtreePreOrder(cur *tree.Node, f func(cur *tree.Node)) {
 	}
 }
 
-// returns best split between two lists, i.e., max l[i] + r[j] where i + j = k.
-// returns err if k is too large.
-func BestSplit[S sc.Score](l, r []S, k int) (int, int, error) {
+// Returns best split between two lists, i.e., the i and j maximizing
+// l[i] + r[j] where i + j = k (the smallest such i on ties). Returns
+// ErrNoValidSplit if k is too large (k > len(l) + len(r) - 2), and panics if
+// either list is empty.
+func BestSplit[S Score](l, r []S, k int) (int, int, error) {
 	if len(l) == 0 || len(r) == 0 {
 		panic("zero length lists not allowed")
 	}
@@ -68,11 +88,31 @@ func BestSplit[S sc.Score](l, r []S, k int) (int, int, error) {
 	return bestKL, bestKR, nil
 }
 
+// Returns every split between two lists with the best score, i.e., all (i, j)
+// where i + j = k and l[i] + r[j] is the maximum, in increasing order of i (so
+// the first is the split BestSplit returns). Returns ErrNoValidSplit if k is
+// too large, and panics if either list is empty.
+func AllBestSplits[S Score](l, r []S, k int) ([][2]int, error) {
+	bestL, bestR, err := BestSplit(l, r, k)
+	if err != nil {
+		return nil, err
+	}
+	best := l[bestL] + r[bestR]
+	splits := make([][2]int, 0, 1)
+	for i := bestL; i <= min(k, len(l)-1); i++ {
+		if l[i]+r[k-i] == best {
+			splits = append(splits, [2]int{i, k - i})
+		}
+	}
+	return splits, nil
+}
+
 // Takes a value k, and four lists; returns a slice of indices
 // idx = {idx1, idx2, ... } such that the sum of lists[0][idx1] + lists[1][idx2]
 // + ... is maximized, and all indices add up to k.
-// Returns an error if a valid split does not exist.
-func FourWayBestSplit[S sc.Score](lists [4][]S, k int) (indices [4]int, err error) {
+// Returns ErrNoValidSplit if a valid split does not exist, and panics if any
+// list is empty.
+func FourWayBestSplit[S Score](lists [4][]S, k int) (indices [4]int, err error) {
 	combinedLen := 0
 	for _, l := range lists {
 		combinedLen += len(l)
@@ -94,8 +134,8 @@ func FourWayBestSplit[S sc.Score](lists [4][]S, k int) (indices [4]int, err erro
 	return
 }
 
-// helper for fourWayBestSplit
-func solveAllSplits[S sc.Score](list1, list2 []S, k int) (solutions [][2]int, scores []S) {
+// helper for FourWayBestSplit
+func solveAllSplits[S Score](list1, list2 []S, k int) (solutions [][2]int, scores []S) {
 	solutions = make([][2]int, 0, k)
 	scores = make([]S, 0, k)
 	for i := range k + 1 {
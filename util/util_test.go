@@ -0,0 +1,101 @@
+package util
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evolbioinfo/gotree/io/newick"
+	"github.com/evolbioinfo/gotree/tree"
+)
+
+func TestBestSplit(t *testing.T) {
+	testCases := []struct {
+		name   string
+		l, r   []int64
+		k      int
+		expL   int
+		expR   int
+		expErr error
+	}{
+		{name: "k zero", l: []int64{1, 5}, r: []int64{2, 3}, k: 0, expL: 0, expR: 0},
+		{name: "left better", l: []int64{0, 5}, r: []int64{0, 3}, k: 1, expL: 1, expR: 0},
+		{name: "right better", l: []int64{0, 2}, r: []int64{0, 3}, k: 1, expL: 0, expR: 1},
+		{name: "tie takes smaller left", l: []int64{0, 3}, r: []int64{0, 3}, k: 1, expL: 0, expR: 1},
+		{name: "uneven lengths", l: []int64{0}, r: []int64{0, 1, 4}, k: 2, expL: 0, expR: 2},
+		{name: "k too large", l: []int64{0, 1}, r: []int64{0, 1}, k: 3, expErr: ErrNoValidSplit},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			l, r, err := BestSplit(test.l, test.r, test.k)
+			if !errors.Is(err, test.expErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expErr)
+			}
+			if err == nil && (l != test.expL || r != test.expR) {
+				t.Errorf("got (%d, %d), expected (%d, %d)", l, r, test.expL, test.expR)
+			}
+		})
+	}
+}
+
+func TestFourWayBestSplit(t *testing.T) {
+	lists := [4][]float64{{0, 1}, {0, 4}, {0, 2, 3}, {0}}
+	indices, err := FourWayBestSplit(lists, 2)
+	if err != nil {
+		t.Fatalf("produced error %+v", err)
+	}
+	if indices != [4]int{0, 1, 1, 0} {
+		t.Errorf("got %v, expected [0 1 1 0]", indices)
+	}
+	if _, err := FourWayBestSplit(lists, 5); !errors.Is(err, ErrNoValidSplit) {
+		t.Errorf("got error %v, expected %v", err, ErrNoValidSplit)
+	}
+}
+
+func TestSubtreeTraversals(t *testing.T) {
+	tre, err := newick.NewParser(strings.NewReader("((A,B)x,(C,D)y)r;")).Parse()
+	if err != nil {
+		t.Fatal("invalid newick tree; test is written wrong")
+	}
+	pre := make([]string, 0)
+	SubtreePreOrder(tre.Root(), func(cur *tree.Node) {
+		pre = append(pre, cur.Name())
+	})
+	if expected := []string{"r", "x", "A", "B", "y", "C", "D"}; !slices.Equal(pre, expected) {
+		t.Errorf("pre-order %v, expected %v", pre, expected)
+	}
+	post := make([]string, 0)
+	SubtreePostOrder(tre.Root(), func(cur, otherSubtree *tree.Node) {
+		post = append(post, cur.Name()+"/"+otherSubtree.Name())
+	})
+	if expected := []string{"A/y", "B/y", "x/y", "C/x", "D/x", "y/x"}; !slices.Equal(post, expected) {
+		t.Errorf("post-order %v, expected %v", post, expected)
+	}
+}
+
+func TestAllBestSplits(t *testing.T) {
+	testCases := []struct {
+		name     string
+		l, r     []int64
+		k        int
+		expected [][2]int
+		expErr   error
+	}{
+		{name: "unique", l: []int64{0, 5}, r: []int64{0, 3}, k: 1, expected: [][2]int{{1, 0}}},
+		{name: "tie", l: []int64{0, 3, 4}, r: []int64{0, 3, 4}, k: 2, expected: [][2]int{{1, 1}}},
+		{name: "three way tie", l: []int64{0, 2, 4}, r: []int64{0, 2, 4}, k: 2, expected: [][2]int{{0, 2}, {1, 1}, {2, 0}}},
+		{name: "k too large", l: []int64{0}, r: []int64{0}, k: 1, expErr: ErrNoValidSplit},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			splits, err := AllBestSplits(test.l, test.r, test.k)
+			if !errors.Is(err, test.expErr) {
+				t.Fatalf("got error %v, expected %v", err, test.expErr)
+			}
+			if err == nil && !slices.Equal(splits, test.expected) {
+				t.Errorf("got %v, expected %v", splits, test.expected)
+			}
+		})
+	}
+}